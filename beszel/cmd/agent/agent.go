@@ -3,41 +3,55 @@ package main
 import (
 	"beszel"
 	"beszel/internal/agent"
+	"beszel/internal/logging"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strings"
 )
 
 func main() {
+	// options of the config file are used for unset environment variables
+	configErr := agent.LoadConfig()
+	logging.SetDefault(agent.GetEnv)
+	if configErr != nil {
+		fatal("Failed to load config file", "err", configErr)
+	}
+
 	// handle flags / subcommands
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
 		case "-v":
 			fmt.Println(beszel.AppName+"-agent", beszel.Version)
 		case "update":
-			agent.Update()
+			agent.Update(os.Args[2:])
+		case "health":
+			if err := agent.Health(listenAddr()); err != nil {
+				fatal("Agent is unhealthy", "err", err)
+			}
+		case "enroll":
+			agent.Enroll(os.Args[2:])
+		case "install":
+			if err := agent.InstallService(os.Args[2:]); err != nil {
+				fatal("Failed to install service", "err", err)
+			}
+		case "uninstall":
+			if err := agent.UninstallService(); err != nil {
+				fatal("Failed to uninstall service", "err", err)
+			}
 		}
 		os.Exit(0)
 	}
 
-	// Try to get the key from the KEY environment variable.
-	key, _ := agent.GetEnv("KEY")
-	pubKey := []byte(key)
-
-	// If KEY is not set, try to read the key from the file specified by KEY_FILE.
-	if len(pubKey) == 0 {
-		keyFile, exists := agent.GetEnv("KEY_FILE")
-		if !exists {
-			log.Fatal("Must set KEY or KEY_FILE environment variable")
-		}
-		var err error
-		pubKey, err = os.ReadFile(keyFile)
-		if err != nil {
-			log.Fatal(err)
-		}
+	// run under the service control manager if started as a Windows service
+	if agent.RunService(run) {
+		return
 	}
+	run()
+}
 
+// Returns the address the agent listens on from the PORT environment variable
+func listenAddr() string {
 	addr := ":45876"
 	// TODO: change env var to ADDR
 	if portEnvVar, exists := agent.GetEnv("PORT"); exists {
@@ -47,6 +61,48 @@ func main() {
 		}
 		addr = portEnvVar
 	}
+	return addr
+}
+
+// Starts the agent using the address and key from environment variables
+func run() {
+	addr := listenAddr()
+
+	// Try to get the key from the KEY environment variable.
+	key, _ := agent.GetEnv("KEY")
+	pubKey := []byte(key)
+
+	// If KEY is not set, try to read the key from the file specified by KEY_FILE.
+	if len(pubKey) == 0 {
+		if keyFile, exists := agent.GetEnv("KEY_FILE"); exists {
+			var err error
+			pubKey, err = os.ReadFile(keyFile)
+			if err != nil {
+				fatal("Failed to read key file", "err", err)
+			}
+		}
+	}
+
+	// If neither is set, register with the hub using HUB_URL and TOKEN.
+	// The https transport always registers so the hub knows to use it.
+	if transport, _ := agent.GetEnv("TRANSPORT"); len(pubKey) == 0 || transport == "https" {
+		hubURL, _ := agent.GetEnv("HUB_URL")
+		token, _ := agent.GetEnv("TOKEN")
+		if hubURL == "" || token == "" {
+			fatal("Must set KEY, KEY_FILE, or HUB_URL and TOKEN environment variables")
+		}
+		var err error
+		pubKey, err = agent.Register(hubURL, token, addr)
+		if err != nil {
+			fatal("Failed to register with hub", "err", err)
+		}
+	}
 
 	agent.NewAgent().Run(pubKey, addr)
 }
+
+// Logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -3,6 +3,10 @@ package main
 import (
 	"beszel"
 	"beszel/internal/hub"
+	"beszel/internal/logging"
+	"beszel/internal/secrets"
+	"log/slog"
+	"os"
 
 	_ "beszel/migrations"
 
@@ -11,8 +15,31 @@ import (
 )
 
 func main() {
+	logging.SetDefault(hub.GetEnv)
+
+	// checked before creating the app so healthchecks don't open the database
+	if len(os.Args) > 1 && os.Args[1] == "health" {
+		if err := hub.Health(os.Args[2:]); err != nil {
+			slog.Error("Hub is unhealthy", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// encryption of stored credentials, also used for PocketBase's settings
+	if err := secrets.Load(hub.GetEnv); err != nil {
+		slog.Error("Invalid encryption key", "err", err)
+		os.Exit(1)
+	}
+	var encryptionEnv string
+	if secrets.Enabled() {
+		encryptionEnv = "BESZEL_HUB_SETTINGS_KEY"
+		os.Setenv(encryptionEnv, secrets.DeriveKey("settings"))
+	}
+
 	app := pocketbase.NewWithConfig(pocketbase.Config{
-		DefaultDataDir: beszel.AppName + "_data",
+		DefaultDataDir:       beszel.AppName + "_data",
+		DefaultEncryptionEnv: encryptionEnv,
 	})
 	app.RootCmd.Version = beszel.Version
 	app.RootCmd.Use = beszel.AppName
@@ -3,41 +3,73 @@ package agent
 
 import (
 	"beszel"
+	"beszel/internal/common"
 	"beszel/internal/entities/system"
 	"context"
+	"errors"
 	"log/slog"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/shirou/gopsutil/v4/common"
+	psutilCommon "github.com/shirou/gopsutil/v4/common"
 )
 
 type Agent struct {
 	debug            bool                       // true if LOG_LEVEL is set to debug
 	zfs              bool                       // true if system has arcstats
 	memCalc          string                     // Memory calculation formula
+	cpuCores         bool                       // Report the usage of each logical cpu (CPU_CORES=true)
+	fingerprint      string                     // Persistent id sent with stats so the hub can detect impostors
 	fsNames          []string                   // List of filesystem device names being monitored
 	fsStats          map[string]*system.FsStats // Keeps track of disk stats for each filesystem
+	diskMounts       map[string][]string        // Filesystems on each physical disk, for S.M.A.R.T. data
 	netInterfaces    map[string]struct{}        // Stores all valid network interfaces
-	netIoStats       system.NetIoStats          // Keeps track of bandwidth usage
+	nicSpeeds        map[string]float64         // Link speeds (Mb/s) of network interfaces set with NIC_SPEED
+	counters         counterTracker             // Previous cpu, disk and network counters for each polling interval
+	statsMutex       sync.Mutex                 // Collects stats for one request at a time
 	dockerManager    *dockerManager             // Manages Docker API requests
+	kubeletManager   *kubeletManager            // Reads pod stats from the kubelet in Kubernetes mode
+	lxcManager       *lxcManager                // Reads LXC container stats from cgroups
+	proxmoxManager   *proxmoxManager            // Reads Proxmox VM stats from the Proxmox API
 	sensorsContext   context.Context            // Sensors context to override sys location
+	sensorsSysPath   string                     // Path of sysfs for hwmon sensors
 	sensorsWhitelist map[string]struct{}        // List of sensors to monitor
 	systemInfo       system.Info                // Host system info
 	gpuManager       *GPUManager                // Manages GPU data
+	smartManager     *SmartManager              // Manages S.M.A.R.T. data
+	systemdManager   *systemdManager            // Manages systemd service stats
+	portsManager     *portsManager              // Lists listening TCP and UDP ports
+	throttleManager  *throttleManager           // Reduces collection on battery / thermal pressure
+	batteryManager   *batteryManager            // Reads battery or UPS charge
+	guestManager     *guestManager              // Lists virtual machines of KVM and Hyper-V hosts
+	smartError       common.ErrorCode           // Why the S.M.A.R.T. manager couldn't be created
+	lastCollection   atomic.Int64               // Unix time of the last stats request
 }
 
 func NewAgent() *Agent {
 	newAgent := &Agent{
 		sensorsContext: context.Background(),
+		sensorsSysPath: sysPath,
 		fsStats:        make(map[string]*system.FsStats),
 	}
 	newAgent.memCalc, _ = GetEnv("MEM_CALC")
 	return newAgent
 }
 
-// GetEnv retrieves an environment variable with a "BESZEL_AGENT_" prefix, or falls back to the unprefixed key.
+// GetEnv retrieves an environment variable with a "BESZEL_AGENT_" prefix, or falls back to the unprefixed key
+// and then to the option of the config file.
 func GetEnv(key string) (value string, exists bool) {
+	if value, exists = lookupEnv(key); exists {
+		return value, exists
+	}
+	return configValue(key)
+}
+
+// Retrieves an environment variable with a "BESZEL_AGENT_" prefix, or falls back to the unprefixed key.
+func lookupEnv(key string) (value string, exists bool) {
 	if value, exists = os.LookupEnv("BESZEL_AGENT_" + key); exists {
 		return value, exists
 	}
@@ -46,30 +78,83 @@ func GetEnv(key string) (value string, exists bool) {
 }
 
 func (a *Agent) Run(pubKey []byte, addr string) {
-	// Set up slog with a log level determined by the LOG_LEVEL env var
-	if logLevelStr, exists := GetEnv("LOG_LEVEL"); exists {
-		switch strings.ToLower(logLevelStr) {
-		case "debug":
-			a.debug = true
-			slog.SetLogLoggerLevel(slog.LevelDebug)
-		case "warn":
-			slog.SetLogLoggerLevel(slog.LevelWarn)
-		case "error":
-			slog.SetLogLoggerLevel(slog.LevelError)
-		}
-	}
+	// the default logger is set up from LOG_LEVEL and LOG_FORMAT in main
+	a.debug = slog.Default().Enabled(context.Background(), slog.LevelDebug)
 
 	slog.Debug(beszel.Version)
 
+	a.applySettings()
+
+	if fingerprint, err := getFingerprint(); err != nil {
+		slog.Warn("Failed to get fingerprint", "err", err)
+	} else {
+		a.fingerprint = fingerprint
+	}
+
+	// initialize system info / docker manager
+	a.initializeSystemInfo()
+	a.initializeDiskInfo()
+	a.initializeNetIoStats()
+	a.dockerManager = newDockerManager(a)
+	a.initializeModules()
+
+	// reload the config file on SIGHUP
+	go a.reloadOnSignal()
+
+	// check for updates on a schedule
+	if au, err := newAutoUpdater(); errors.Is(err, errAutoUpdateDisabled) {
+		slog.Debug("Auto update", "err", err)
+	} else if err != nil {
+		slog.Error("Auto update", "err", err)
+	} else {
+		go au.run()
+	}
+
+	// initialize throttle manager
+	if tm, err := newThrottleManager(); err != nil {
+		slog.Error("Throttle", "err", err)
+	} else {
+		a.throttleManager = tm
+	}
+
+	// if debugging, print stats
+	if a.debug {
+		slog.Debug("Stats", "data", a.gatherStats(0))
+	}
+
+	// HEALTH_ADDR serves a health endpoint for container healthchecks and probes
+	if healthAddr, _ := GetEnv("HEALTH_ADDR"); healthAddr != "" {
+		go a.startProbeServer(healthAddr)
+	}
+
+	// TRANSPORT=https serves stats over https with certificates issued by the hub
+	if transport, _ := GetEnv("TRANSPORT"); transport == "https" {
+		a.startTLSServer(addr)
+		return
+	}
+	a.startServer(pubKey, addr)
+}
+
+// Applies the settings that can be changed by reloading the config file
+func (a *Agent) applySettings() {
+	a.memCalc, _ = GetEnv("MEM_CALC")
+	// per-core usage is opt-in, since it adds a value per cpu to each update
+	cpuCores, _ := GetEnv("CPU_CORES")
+	a.cpuCores = cpuCores == "true"
+
 	// Set sensors context (allows overriding sys location for sensors)
+	a.sensorsContext = context.Background()
+	a.sensorsSysPath = sysPath
 	if sysSensors, exists := GetEnv("SYS_SENSORS"); exists {
 		slog.Info("SYS_SENSORS", "path", sysSensors)
+		a.sensorsSysPath = sysSensors
 		a.sensorsContext = context.WithValue(a.sensorsContext,
-			common.EnvKey, common.EnvMap{common.HostSysEnvKey: sysSensors},
+			psutilCommon.EnvKey, psutilCommon.EnvMap{psutilCommon.HostSysEnvKey: sysSensors},
 		)
 	}
 
 	// Set sensors whitelist
+	a.sensorsWhitelist = nil
 	if sensors, exists := GetEnv("SENSORS"); exists {
 		a.sensorsWhitelist = make(map[string]struct{})
 		for _, sensor := range strings.Split(sensors, ",") {
@@ -78,49 +163,234 @@ func (a *Agent) Run(pubKey []byte, addr string) {
 			}
 		}
 	}
+}
 
-	// initialize system info / docker manager
-	a.initializeSystemInfo()
-	a.initializeDiskInfo()
-	a.initializeNetIoStats()
-	a.dockerManager = newDockerManager(a)
+// Creates the managers of enabled modules that don't exist yet. Managers of
+// modules disabled later are kept, but their stats aren't collected.
+func (a *Agent) initializeModules() {
+	if moduleEnabled("kubernetes") && a.kubeletManager == nil {
+		a.kubeletManager = newKubeletManager()
+	}
+	a.systemInfo.Kubernetes = a.kubeletManager != nil && moduleEnabled("kubernetes")
+	if moduleEnabled("lxc") && a.lxcManager == nil {
+		a.lxcManager = newLxcManager()
+	}
+	if moduleEnabled("proxmox") && a.proxmoxManager == nil {
+		a.proxmoxManager = newProxmoxManager()
+	}
 
 	// initialize GPU manager
-	if gm, err := NewGPUManager(); err != nil {
-		slog.Debug("GPU", "err", err)
-	} else {
-		a.gpuManager = gm
+	if moduleEnabled("gpu") && a.gpuManager == nil {
+		if gm, err := NewGPUManager(); err != nil {
+			slog.Debug("GPU", "err", err)
+		} else {
+			a.gpuManager = gm
+		}
 	}
 
-	// if debugging, print stats
-	if a.debug {
-		slog.Debug("Stats", "data", a.gatherStats())
+	// initialize S.M.A.R.T. manager
+	if moduleEnabled("smart") && a.smartManager == nil {
+		a.smartError = ""
+		if sm, err := NewSmartManager(); err != nil {
+			slog.Debug("SMART", "err", err)
+			switch {
+			case errors.Is(err, errSmartctlMissing):
+				a.smartError = common.ErrSmartctlMissing
+			case !errors.Is(err, errNoSmartDevices):
+				a.smartError = common.ErrorCodeOf(err, common.ErrCollectionFailed)
+			}
+		} else {
+			a.smartManager = sm
+		}
 	}
 
-	a.startServer(pubKey, addr)
+	// initialize systemd manager
+	if moduleEnabled("systemd") && a.systemdManager == nil {
+		if sm, err := newSystemdManager(); err != nil {
+			slog.Debug("Systemd", "err", err)
+		} else {
+			a.systemdManager = sm
+		}
+	}
+
+	// initialize listening ports manager
+	if moduleEnabled("ports") && a.portsManager == nil {
+		if pm, err := newPortsManager(); err != nil {
+			slog.Debug("Ports", "err", err)
+		} else {
+			a.portsManager = pm
+		}
+	}
+
+	// initialize battery manager
+	if moduleEnabled("battery") && a.batteryManager == nil {
+		if bm, err := newBatteryManager(); err != nil {
+			slog.Debug("Battery", "err", err)
+		} else {
+			a.batteryManager = bm
+		}
+	}
+
+	// initialize guest manager
+	if moduleEnabled("guests") && a.guestManager == nil {
+		if gm, err := newGuestManager(); err != nil {
+			slog.Debug("Guests", "err", err)
+		} else {
+			a.guestManager = gm
+		}
+	}
 }
 
-func (a *Agent) gatherStats() system.CombinedData {
+// Returns only the stats of the host system, without containers, services and
+// other slower collections. Used by hubs that poll more often than once a minute.
+// While throttled, nothing is collected and the last full collection is returned
+// with Info.Throttled set, so hubs don't save it as a new sample.
+func (a *Agent) gatherSystemStats(interval uint16) system.CombinedData {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	if tm := a.throttleManager; tm != nil {
+		if throttled := tm.updateMode(); throttled != "" {
+			slog.Debug("Throttled, skipping fast stats", "mode", throttled)
+			data := system.CombinedData{
+				Stats:       tm.lastData.Stats,
+				Info:        tm.lastData.Info,
+				Fingerprint: a.fingerprint,
+			}
+			data.Info.Throttled = throttled
+			return data
+		}
+	}
+	return system.CombinedData{
+		Stats:       a.getSystemStats(interval),
+		Info:        a.systemInfo,
+		Fingerprint: a.fingerprint,
+	}
+}
+
+// Collects system, container and service stats. Rates like network usage are
+// calculated over the requester's polling interval in seconds (0 if unknown).
+func (a *Agent) gatherStats(interval uint16) system.CombinedData {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	// while throttled, return the last data until the throttle interval has passed
+	var throttled string
+	if tm := a.throttleManager; tm != nil {
+		throttled = tm.updateMode()
+		if throttled != "" && time.Since(tm.lastTime) < tm.interval {
+			slog.Debug("Throttled, using last stats", "mode", throttled)
+			return tm.lastData
+		}
+	}
 	slog.Debug("Getting stats")
+	a.lastCollection.Store(time.Now().Unix())
 	systemData := system.CombinedData{
-		Stats: a.getSystemStats(),
-		Info:  a.systemInfo,
+		Stats:       a.getSystemStats(interval),
+		Info:        a.systemInfo,
+		Fingerprint: a.fingerprint,
+	}
+	systemData.Info.Throttled = throttled
+	// add battery / ups charge
+	if a.batteryManager != nil && moduleEnabled("battery") {
+		if battery := a.batteryManager.getBattery(); battery != nil {
+			systemData.Info.Battery = battery
+			systemData.Stats.Battery = battery.Capacity
+		}
 	}
 	slog.Debug("System stats", "data", systemData)
-	// add docker stats
-	if containerStats, err := a.dockerManager.getDockerStats(); err == nil {
-		systemData.Containers = containerStats
-		slog.Debug("Docker stats", "data", systemData.Containers)
-	} else {
-		slog.Debug("Error getting docker stats", "err", err)
+	errorCodes := make(map[string]common.ErrorCode)
+	// add pod stats in kubernetes mode, or docker stats otherwise (skipped while throttled)
+	if throttled == "" && a.kubeletManager != nil && moduleEnabled("kubernetes") {
+		if podStats, err := a.kubeletManager.getPodStats(interval); err == nil {
+			systemData.Containers = podStats
+			slog.Debug("Pod stats", "data", systemData.Containers)
+		} else {
+			slog.Debug("Error getting pod stats", "err", err)
+			errorCodes[common.SubsystemKubernetes] = common.ErrorCodeOf(err, common.ErrCollectionFailed)
+		}
+	} else if throttled == "" && moduleEnabled("docker") {
+		if containerStats, err := a.dockerManager.getDockerStats(interval); err == nil {
+			systemData.Containers = containerStats
+			slog.Debug("Docker stats", "data", systemData.Containers)
+			// HEALTHCHECKS=false disables health checks from container labels
+			if enabled, _ := GetEnv("HEALTHCHECKS"); enabled != "false" {
+				systemData.HealthChecks = a.dockerManager.runHealthChecks()
+			}
+		} else {
+			slog.Debug("Error getting docker stats", "err", err)
+			if a.dockerManager.configured {
+				errorCodes[common.SubsystemDocker] = common.ErrorCodeOf(err, common.ErrDockerUnavailable)
+			}
+		}
+	}
+	// add lxc container stats (skipped while throttled)
+	if a.lxcManager != nil && throttled == "" && moduleEnabled("lxc") {
+		systemData.Containers = append(systemData.Containers, a.lxcManager.getContainerStats(interval)...)
+	}
+	// add proxmox vm stats (skipped while throttled)
+	if a.proxmoxManager != nil && throttled == "" && moduleEnabled("proxmox") {
+		if vmStats, err := a.proxmoxManager.getVMStats(interval); err == nil {
+			systemData.Containers = append(systemData.Containers, vmStats...)
+		} else {
+			slog.Debug("Error getting Proxmox VM stats", "err", err)
+			errorCodes[common.SubsystemProxmox] = common.ErrorCodeOf(err, common.ErrCollectionFailed)
+		}
 	}
 	// add extra filesystems
 	systemData.Stats.ExtraFs = make(map[string]*system.FsStats)
 	for name, stats := range a.fsStats {
 		if !stats.Root && stats.DiskTotal > 0 {
-			systemData.Stats.ExtraFs[name] = stats
+			// copy so the next request doesn't change the data while it's sent
+			fsStats := *stats
+			systemData.Stats.ExtraFs[name] = &fsStats
 		}
 	}
 	slog.Debug("Extra filesystems", "data", systemData.Stats.ExtraFs)
+	// add S.M.A.R.T. data
+	if a.smartManager != nil {
+		// pause collection while throttled or disabled
+		a.smartManager.paused.Store(throttled != "" || !moduleEnabled("smart"))
+	}
+	if a.smartManager != nil && moduleEnabled("smart") {
+		systemData.Smart = a.smartManager.GetCurrentData()
+		a.addSmartMounts(systemData.Smart)
+		if code := a.smartManager.errorCode(); code != "" {
+			errorCodes[common.SubsystemSmart] = code
+		}
+	} else if a.smartError != "" && moduleEnabled("smart") {
+		errorCodes[common.SubsystemSmart] = a.smartError
+	}
+	// add systemd service stats (skipped while throttled)
+	if a.systemdManager != nil && throttled == "" && moduleEnabled("systemd") {
+		if services, err := a.systemdManager.getServiceStats(interval); err == nil {
+			systemData.Services = services
+		} else {
+			slog.Debug("Error getting systemd services", "err", err)
+			errorCodes[common.SubsystemSystemd] = common.ErrorCodeOf(err, common.ErrCollectionFailed)
+		}
+	}
+	// add listening ports (skipped while throttled)
+	if a.portsManager != nil && throttled == "" && moduleEnabled("ports") {
+		if ports, err := a.portsManager.getPorts(); err == nil {
+			systemData.Ports = ports
+		} else {
+			slog.Debug("Error getting listening ports", "err", err)
+		}
+	}
+	// add virtual machines of a hypervisor host (skipped while throttled)
+	if a.guestManager != nil && throttled == "" && moduleEnabled("guests") {
+		if guests, err := a.guestManager.getGuests(interval); err == nil {
+			systemData.Guests = guests
+		} else {
+			slog.Debug("Error getting guests", "err", err)
+		}
+	}
+	if len(errorCodes) > 0 {
+		systemData.Info.Errors = errorCodes
+	}
+	a.counters.prune(time.Now())
+	if a.throttleManager != nil {
+		a.throttleManager.lastData = systemData
+		a.throttleManager.lastTime = time.Now()
+	}
 	return systemData
 }
@@ -0,0 +1,290 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sources of battery data
+const (
+	batterySysfs   = "sysfs"
+	batteryApcupsd = "apcupsd"
+	batteryNut     = "nut"
+)
+
+// Battery states reported to the hub
+const (
+	batteryCharging    = "charging"
+	batteryDischarging = "discharging"
+	batteryFull        = "full"
+	batteryIdle        = "idle"
+)
+
+var errNoBattery = errors.New("no battery found")
+
+type batteryManager struct {
+	source string // sysfs, apcupsd or nut
+	addr   string // address of the apcupsd or nut server
+	ups    string // name of the nut ups (first ups on the server if empty)
+}
+
+// Returns the current charge of the battery or UPS, or nil if it couldn't be read
+func (bm *batteryManager) getBattery() *system.Battery {
+	var battery *system.Battery
+	var err error
+	switch bm.source {
+	case batteryApcupsd:
+		battery, err = readApcupsd(bm.addr)
+	case batteryNut:
+		battery, err = readNut(bm.addr, bm.ups)
+	default:
+		battery, err = readSysfsBattery()
+	}
+	if err != nil {
+		slog.Debug("Error getting battery", "source", bm.source, "err", err)
+		return nil
+	}
+	battery.Capacity = twoDecimals(battery.Capacity)
+	battery.Source = bm.source
+	return battery
+}
+
+// Returns the combined charge of the host's batteries from /sys/class/power_supply.
+// Batteries of peripherals like mice and keyboards are skipped.
+func readSysfsBattery() (*system.Battery, error) {
+	supplies, _ := filepath.Glob("/sys/class/power_supply/*")
+	var capacity, energyNow, energyFull float64
+	var count int
+	weighted := true
+	states := make([]string, 0, len(supplies))
+	for _, supply := range supplies {
+		if kind := readSysValue(filepath.Join(supply, "type")); kind != "Battery" && kind != "UPS" {
+			continue
+		}
+		if readSysValue(filepath.Join(supply, "scope")) == "Device" {
+			continue
+		}
+		pct, err := strconv.ParseFloat(readSysValue(filepath.Join(supply, "capacity")), 64)
+		if err != nil {
+			continue
+		}
+		capacity += pct
+		count++
+		// weight by energy if every battery reports it
+		now, errNow := strconv.ParseFloat(readSysValue(filepath.Join(supply, "energy_now")), 64)
+		full, errFull := strconv.ParseFloat(readSysValue(filepath.Join(supply, "energy_full")), 64)
+		if errNow != nil || errFull != nil || full == 0 {
+			weighted = false
+		}
+		energyNow += now
+		energyFull += full
+		switch readSysValue(filepath.Join(supply, "status")) {
+		case "Charging":
+			states = append(states, batteryCharging)
+		case "Discharging":
+			states = append(states, batteryDischarging)
+		case "Full":
+			states = append(states, batteryFull)
+		default:
+			states = append(states, batteryIdle)
+		}
+	}
+	if count == 0 {
+		return nil, errNoBattery
+	}
+	battery := &system.Battery{Capacity: capacity / float64(count)}
+	if weighted {
+		battery.Capacity = min(energyNow/energyFull*100, 100)
+	}
+	// report the most significant state of all batteries
+	for _, state := range []string{batteryDischarging, batteryCharging, batteryIdle, batteryFull} {
+		if slices.Contains(states, state) {
+			battery.State = state
+			break
+		}
+	}
+	return battery, nil
+}
+
+// Returns the charge of a UPS from an apcupsd network information server
+func readApcupsd(addr string) (*system.Battery, error) {
+	conn, err := net.DialTimeout("tcp", addr, 3*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// requests and responses are prefixed with their length as a big endian uint16
+	cmd := "status"
+	if err := binary.Write(conn, binary.BigEndian, uint16(len(cmd))); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(conn, cmd); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for {
+		var size uint16
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			break
+		}
+		line := make([]byte, size)
+		if _, err := io.ReadFull(conn, line); err != nil {
+			return nil, err
+		}
+		// Example line: BCHARGE  : 100.0 Percent
+		if key, value, ok := strings.Cut(string(line), ":"); ok {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	charge, ok := values["BCHARGE"]
+	if !ok {
+		return nil, errNoBattery
+	}
+	battery := &system.Battery{}
+	if battery.Capacity, err = strconv.ParseFloat(strings.Fields(charge)[0], 64); err != nil {
+		return nil, err
+	}
+	status := strings.Fields(values["STATUS"])
+	switch {
+	case slices.Contains(status, "ONBATT"):
+		battery.State = batteryDischarging
+	case battery.Capacity >= 100:
+		battery.State = batteryFull
+	default:
+		battery.State = batteryCharging
+	}
+	return battery, nil
+}
+
+// Returns the charge of a UPS from a Network UPS Tools server
+func readNut(addr, ups string) (*system.Battery, error) {
+	conn, err := net.DialTimeout("tcp", addr, 3*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	readLine := func() (string, error) {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if err == nil && strings.HasPrefix(line, "ERR ") {
+			err = fmt.Errorf("nut: %s", strings.TrimPrefix(line, "ERR "))
+		}
+		return line, err
+	}
+
+	if ups == "" {
+		// use the first ups on the server
+		fmt.Fprint(conn, "LIST UPS\n")
+		for {
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			if strings.HasPrefix(line, "END LIST") {
+				break
+			}
+			// Example line: UPS myups "Description"
+			if fields := strings.Fields(line); ups == "" && len(fields) > 1 && fields[0] == "UPS" {
+				ups = fields[1]
+			}
+		}
+		if ups == "" {
+			return nil, errNoBattery
+		}
+	}
+
+	getVar := func(name string) (string, error) {
+		fmt.Fprintf(conn, "GET VAR %s %s\n", ups, name)
+		// Example line: VAR myups battery.charge "100"
+		line, err := readLine()
+		if err != nil {
+			return "", err
+		}
+		_, value, _ := strings.Cut(line, `"`)
+		return strings.TrimSuffix(value, `"`), nil
+	}
+
+	charge, err := getVar("battery.charge")
+	if err != nil {
+		return nil, err
+	}
+	battery := &system.Battery{}
+	if battery.Capacity, err = strconv.ParseFloat(charge, 64); err != nil {
+		return nil, err
+	}
+	value, err := getVar("ups.status")
+	if err != nil {
+		return nil, err
+	}
+	// Example status: OL CHRG
+	status := strings.Fields(value)
+	switch {
+	case slices.Contains(status, "OB"), slices.Contains(status, "DISCHRG"):
+		battery.State = batteryDischarging
+	case slices.Contains(status, "CHRG"):
+		battery.State = batteryCharging
+	case battery.Capacity >= 100:
+		battery.State = batteryFull
+	default:
+		battery.State = batteryIdle
+	}
+	fmt.Fprint(conn, "LOGOUT\n")
+	return battery, nil
+}
+
+// Creates a batteryManager from BATTERY, which can be "apcupsd[:host:port]",
+// "nut[:ups@host:port]" or "false" to disable. By default, batteries are read
+// from sysfs if the host has any.
+func newBatteryManager() (*batteryManager, error) {
+	value, _ := GetEnv("BATTERY")
+	source, addr, _ := strings.Cut(value, ":")
+	bm := &batteryManager{source: source}
+	switch source {
+	case "false":
+		return nil, fmt.Errorf("battery monitoring disabled")
+	case batteryApcupsd:
+		bm.addr = addr
+		if bm.addr == "" {
+			bm.addr = "localhost:3551"
+		}
+	case batteryNut:
+		if ups, host, ok := strings.Cut(addr, "@"); ok {
+			bm.ups, addr = ups, host
+		} else if !strings.Contains(addr, ":") {
+			// only a ups name
+			bm.ups, addr = addr, ""
+		}
+		bm.addr = addr
+		if bm.addr == "" {
+			bm.addr = "localhost:3493"
+		}
+	case "", batterySysfs:
+		bm.source = batterySysfs
+		if _, err := readSysfsBattery(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid battery source %q", source)
+	}
+	slog.Debug("Battery", "source", bm.source, "addr", bm.addr, "ups", bm.ups)
+	return bm, nil
+}
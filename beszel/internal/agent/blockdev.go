@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Location of block device information in sysfs. Partitions are only listed
+// in /sys/class/block.
+var (
+	sysBlockPath      = "/sys/block"
+	sysClassBlockPath = "/sys/class/block"
+)
+
+var (
+	// nvme0n1, nvme0n1p2 -> nvme0
+	nvmeNamespacePattern = regexp.MustCompile(`^(nvme\d+)n\d+(p\d+)?$`)
+	// nvme0c1n1 is a per-controller path to a namespace when native NVMe multipath is enabled
+	nvmePathPattern = regexp.MustCompile(`^nvme\d+c\d+n\d+$`)
+)
+
+// blockDevice describes a kernel block device and the physical device it belongs to
+type blockDevice struct {
+	Name       string // kernel device name (nvme0n1, sda, dm-0)
+	Controller string // physical device to query for health data (nvme0, sda)
+	Holder     string // multipath device holding this path, if any (dm-0)
+}
+
+// Returns the physical controller for a block device name.
+// NVMe namespaces and partitions resolve to their controller, everything else to itself.
+func deviceController(name string) string {
+	if m := nvmeNamespacePattern.FindStringSubmatch(name); m != nil {
+		return m[1]
+	}
+	return name
+}
+
+// Returns true if the device is one path of a multipathed device,
+// meaning its I/O is already counted by the multipath device.
+func isMultipathMember(name string) bool {
+	if nvmePathPattern.MatchString(name) {
+		return true
+	}
+	return multipathHolder(name) != ""
+}
+
+// Returns the device-mapper multipath device that holds the named device, if any
+func multipathHolder(name string) string {
+	holders, err := os.ReadDir(filepath.Join(sysBlockPath, name, "holders"))
+	if err != nil {
+		return ""
+	}
+	for _, holder := range holders {
+		if isMultipathDevice(holder.Name()) {
+			return holder.Name()
+		}
+	}
+	return ""
+}
+
+// Returns true if the named device-mapper device is a multipath device
+func isMultipathDevice(name string) bool {
+	if !strings.HasPrefix(name, "dm-") {
+		return false
+	}
+	uuid, err := os.ReadFile(filepath.Join(sysBlockPath, name, "dm", "uuid"))
+	return err == nil && strings.HasPrefix(string(uuid), "mpath-")
+}
+
+// Returns the paths (slaves) that make up a multipath device
+func multipathMembers(name string) []string {
+	slaves, err := os.ReadDir(filepath.Join(sysBlockPath, name, "slaves"))
+	if err != nil {
+		return nil
+	}
+	members := make([]string, 0, len(slaves))
+	for _, slave := range slaves {
+		members = append(members, slave.Name())
+	}
+	return members
+}
+
+// Resolves device names into block devices, with each physical controller included once.
+// Multipath devices are resolved to the controller of their first path.
+func physicalDevices(names []string) []blockDevice {
+	seen := make(map[string]struct{}, len(names))
+	devices := make([]blockDevice, 0, len(names))
+	for _, name := range names {
+		dev := blockDevice{Name: name, Controller: deviceController(name)}
+		if isMultipathDevice(name) {
+			members := multipathMembers(name)
+			if len(members) == 0 {
+				continue
+			}
+			dev.Controller = deviceController(members[0])
+		} else if holder := multipathHolder(name); holder != "" {
+			dev.Holder = holder
+		}
+		if _, ok := seen[dev.Controller]; ok {
+			continue
+		}
+		seen[dev.Controller] = struct{}{}
+		devices = append(devices, dev)
+	}
+	return devices
+}
+
+// Returns the physical controllers of the disks backing a block device.
+// Partitions resolve to their disk, and device-mapper or md devices (LVM, LUKS,
+// RAID) to the disks they're built on, so a filesystem can be matched to the
+// S.M.A.R.T. data of its disks.
+func backingControllers(name string) []string {
+	seen := make(map[string]struct{})
+	var controllers []string
+	var resolve func(name string, depth int)
+	resolve = func(name string, depth int) {
+		path := filepath.Join(sysClassBlockPath, name)
+		if _, err := os.Stat(path); err != nil || depth > 8 {
+			return
+		}
+		// a partition's sysfs directory is inside its disk's directory
+		if _, err := os.Stat(filepath.Join(path, "partition")); err == nil {
+			if target, err := filepath.EvalSymlinks(path); err == nil {
+				resolve(filepath.Base(filepath.Dir(target)), depth+1)
+			}
+			return
+		}
+		if slaves, _ := os.ReadDir(filepath.Join(path, "slaves")); len(slaves) > 0 {
+			for _, slave := range slaves {
+				resolve(slave.Name(), depth+1)
+			}
+			return
+		}
+		controller := deviceController(name)
+		if _, ok := seen[controller]; !ok {
+			seen[controller] = struct{}{}
+			controllers = append(controllers, controller)
+		}
+	}
+	resolve(name, 0)
+	return controllers
+}
@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"beszel/internal/entities/container"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	psutilNet "github.com/shirou/gopsutil/v4/net"
+)
+
+// Location of the cgroup v2 hierarchy that contains LXC and Docker containers
+var cgroupRoot = "/sys/fs/cgroup"
+
+// Returns true if DOCKER_STATS is set to cgroup and the cgroup v2 hierarchy is
+// available. The agent has to see the host's cgroups, e.g. with cgroup: host
+// in docker compose, or the /sys/fs/cgroup mount of a binary install.
+func useCgroupStats() bool {
+	if mode, _ := GetEnv("DOCKER_STATS"); mode != "cgroup" || runtime.GOOS != "linux" {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		slog.Warn("DOCKER_STATS=cgroup needs cgroup v2, using the Docker API", "err", err)
+		return false
+	}
+	slog.Info("DOCKER_STATS", "mode", "cgroup")
+	return true
+}
+
+// Returns the cgroup of a container with the full id, for the systemd and
+// cgroupfs drivers of Docker and for rootful and rootless Podman
+func findContainerCgroup(id string) (string, error) {
+	candidates := []string{
+		filepath.Join(cgroupRoot, "system.slice", "docker-"+id+".scope"),
+		filepath.Join(cgroupRoot, "docker", id),
+		filepath.Join(cgroupRoot, "machine.slice", "libpod-"+id+".scope"),
+	}
+	rootless, _ := filepath.Glob(filepath.Join(cgroupRoot, "user.slice", "user-*.slice", "user@*.service", "user.slice", "libpod-"+id+".scope"))
+	candidates = append(candidates, rootless...)
+	for _, path := range candidates {
+		if _, err := os.Stat(filepath.Join(path, "cpu.stat")); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("cgroup of container %s not found", id[:12])
+}
+
+// Updates the stats of a container from its cgroup files instead of the
+// Docker stats endpoint, which takes about a second per container. Network
+// usage is read from the network namespace of the container's first process,
+// which needs the agent to share the host's pid namespace, and is left at
+// zero otherwise.
+func (dm *dockerManager) updateCgroupStats(ctr container.ApiInfo, interval uint16) error {
+	dm.containerStatsMutex.Lock()
+	defer dm.containerStatsMutex.Unlock()
+
+	path, ok := dm.cgroupPaths[ctr.IdShort]
+	if !ok {
+		var err error
+		if path, err = findContainerCgroup(ctr.Id); err != nil {
+			return err
+		}
+		dm.cgroupPaths[ctr.IdShort] = path
+	}
+	now := time.Now()
+	cpuUsage, err := readCgroupValue(filepath.Join(path, "cpu.stat"), "usage_usec")
+	if err != nil {
+		// cgroup is gone, e.g. after a restart
+		delete(dm.cgroupPaths, ctr.IdShort)
+		return err
+	}
+	memory, err := readCgroupValue(filepath.Join(path, "memory.current"), "")
+	if err != nil {
+		return err
+	}
+	// exclude inactive page cache, like docker stats
+	if inactive, err := readCgroupValue(filepath.Join(path, "memory.stat"), "inactive_file"); err == nil && inactive < memory {
+		memory -= inactive
+	}
+	diskRead, diskWrite, _ := readCgroupIo(filepath.Join(path, "io.stat"))
+	sent, recv, _ := readContainerNetwork(path, ctr.Id)
+
+	stats, ok := dm.containerStatsMap[ctr.IdShort]
+	if !ok {
+		stats = &container.Stats{
+			Name:    ctr.Names[0][1:],
+			Project: ctr.Labels[container.LabelComposeProject],
+			Service: ctr.Labels[container.LabelComposeService],
+		}
+		dm.containerStatsMap[ctr.IdShort] = stats
+	}
+	stats.Mem = bytesToMegabytes(float64(memory))
+	stats.Cpu, stats.NetworkSent, stats.NetworkRecv, stats.DiskRead, stats.DiskWrite = 0, 0, 0, 0, 0
+
+	// counters differ from those of the stats endpoint, so they're kept separately
+	counters := []uint64{cpuUsage, sent, recv, diskRead, diskWrite}
+	if deltas, secondsElapsed, ok := dm.counters.deltas(interval, ctr.IdShort+"/cgroup", now, counters...); ok {
+		// cpu usage is in microseconds
+		stats.Cpu = twoDecimals(float64(deltas[0]) / (secondsElapsed * 1e6 * float64(runtime.NumCPU())) * 100)
+		stats.NetworkSent = bytesToMegabytes(float64(deltas[1]) / secondsElapsed)
+		stats.NetworkRecv = bytesToMegabytes(float64(deltas[2]) / secondsElapsed)
+		stats.DiskRead = bytesToMegabytes(float64(deltas[3]) / secondsElapsed)
+		stats.DiskWrite = bytesToMegabytes(float64(deltas[4]) / secondsElapsed)
+	}
+	return nil
+}
+
+// Returns the bytes read and written by a cgroup on all devices
+func readCgroupIo(path string) (read, write uint64, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	// 8:0 rbytes=1024 wbytes=2048 rios=1 wios=2 dbytes=0 dios=0
+	for _, line := range strings.Split(string(data), "\n") {
+		for _, field := range strings.Fields(line) {
+			key, value, _ := strings.Cut(field, "=")
+			n, _ := strconv.ParseUint(value, 10, 64)
+			switch key {
+			case "rbytes":
+				read += n
+			case "wbytes":
+				write += n
+			}
+		}
+	}
+	return read, write, nil
+}
+
+// Returns the bytes sent and received by a container, excluding loopback.
+// The process is checked to belong to the container, as pids of another pid
+// namespace would point to unrelated processes.
+func readContainerNetwork(cgroupPath, id string) (sent, recv uint64, err error) {
+	procs, err := os.ReadFile(filepath.Join(cgroupPath, "cgroup.procs"))
+	if err != nil {
+		return 0, 0, err
+	}
+	pid, _, _ := strings.Cut(string(procs), "\n")
+	if pid == "" {
+		return 0, 0, fmt.Errorf("no processes in %s", cgroupPath)
+	}
+	procCgroup, err := os.ReadFile(filepath.Join("/proc", pid, "cgroup"))
+	if err != nil || !strings.Contains(string(procCgroup), id) {
+		return 0, 0, fmt.Errorf("process %s of container %s not visible", pid, id[:12])
+	}
+	interfaces, err := psutilNet.IOCountersByFile(true, filepath.Join("/proc", pid, "net/dev"))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, iface := range interfaces {
+		if iface.Name != "lo" {
+			sent += iface.BytesSent
+			recv += iface.BytesRecv
+		}
+	}
+	return sent, recv, nil
+}
@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Modules that can be disabled in the config file
+var agentModules = []string{"docker", "kubernetes", "lxc", "proxmox", "gpu", "smart", "systemd", "ports", "battery", "guests"}
+
+// Options of the config file. Keys are the names of the environment variables
+// in lower case (e.g. key, port, filesystem, docker_host), and modules can be
+// disabled with a map of module names, e.g. modules: {gpu: false}.
+type fileConfig struct {
+	values  map[string]string
+	modules map[string]bool
+}
+
+var agentConfig atomic.Pointer[fileConfig]
+
+// Returns the path of the config file, set with CONFIG
+func configPath() string {
+	if path, exists := lookupEnv("CONFIG"); exists {
+		return path
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "beszel", "agent.yml")
+	}
+	return "/etc/beszel/agent.yml"
+}
+
+// LoadConfig reads the agent's config file, if it exists. Environment
+// variables take precedence over its options.
+func LoadConfig() error {
+	data, err := os.ReadFile(configPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		agentConfig.Store(&fileConfig{})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	config, err := parseConfig(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", configPath(), err)
+	}
+	agentConfig.Store(config)
+	return nil
+}
+
+func parseConfig(data []byte) (*fileConfig, error) {
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	config := &fileConfig{values: make(map[string]string, len(raw)), modules: make(map[string]bool)}
+	for key, value := range raw {
+		if key == "modules" {
+			modules, ok := value.(map[string]any)
+			if !ok {
+				return nil, errors.New("modules must be a map of module names to true or false")
+			}
+			for name, enabled := range modules {
+				if !slices.Contains(agentModules, name) {
+					return nil, fmt.Errorf("unknown module %q", name)
+				}
+				if config.modules[name], ok = enabled.(bool); !ok {
+					return nil, fmt.Errorf("module %q must be true or false", name)
+				}
+			}
+			continue
+		}
+		switch value := value.(type) {
+		case nil:
+		case []any:
+			// lists are joined like the comma separated environment variables
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			config.values[strings.ToUpper(key)] = strings.Join(items, ",")
+		default:
+			config.values[strings.ToUpper(key)] = fmt.Sprint(value)
+		}
+	}
+	return config, nil
+}
+
+// Returns the value of an option in the config file
+func configValue(key string) (string, bool) {
+	if config := agentConfig.Load(); config != nil {
+		value, exists := config.values[key]
+		return value, exists
+	}
+	return "", false
+}
+
+// Returns false if a module is disabled in the config file
+func moduleEnabled(name string) bool {
+	if config := agentConfig.Load(); config != nil {
+		if enabled, exists := config.modules[name]; exists {
+			return enabled
+		}
+	}
+	return true
+}
+
+// Reloads the config file on SIGHUP. Options read when collecting stats, the
+// sensors, memory calculation and modules are applied. Others, like the key
+// and port, need a restart.
+func (a *Agent) reloadOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		if err := LoadConfig(); err != nil {
+			slog.Error("Failed to reload config, keeping previous", "err", err)
+			continue
+		}
+		a.statsMutex.Lock()
+		a.applySettings()
+		a.initializeModules()
+		a.statsMutex.Unlock()
+		slog.Info("Reloaded config", "path", configPath())
+	}
+}
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantValues  map[string]string
+		wantModules map[string]bool
+		wantErr     bool
+	}{
+		{
+			name:        "empty",
+			data:        "",
+			wantValues:  map[string]string{},
+			wantModules: map[string]bool{},
+		},
+		{
+			name:        "values",
+			data:        "key: ssh-ed25519 AAAA\nport: 45876\nmem_calc: htop\n",
+			wantValues:  map[string]string{"KEY": "ssh-ed25519 AAAA", "PORT": "45876", "MEM_CALC": "htop"},
+			wantModules: map[string]bool{},
+		},
+		{
+			name:        "lists are comma separated",
+			data:        "extra_filesystems:\n  - sdb\n  - sdc1\nsensors: [coretemp, nct6775]\n",
+			wantValues:  map[string]string{"EXTRA_FILESYSTEMS": "sdb,sdc1", "SENSORS": "coretemp,nct6775"},
+			wantModules: map[string]bool{},
+		},
+		{
+			name:        "null values are skipped",
+			data:        "filesystem:\nport: 45876\n",
+			wantValues:  map[string]string{"PORT": "45876"},
+			wantModules: map[string]bool{},
+		},
+		{
+			name:        "modules",
+			data:        "modules:\n  gpu: false\n  docker: true\n",
+			wantValues:  map[string]string{},
+			wantModules: map[string]bool{"gpu": false, "docker": true},
+		},
+		{
+			name:    "unknown module",
+			data:    "modules:\n  gpus: false\n",
+			wantErr: true,
+		},
+		{
+			name:    "module that isn't a bool",
+			data:    "modules:\n  gpu: off please\n",
+			wantErr: true,
+		},
+		{
+			name:    "modules that aren't a map",
+			data:    "modules: [gpu]\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid yaml",
+			data:    "key: [unclosed\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseConfig([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseConfig() = %+v, want error", config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(config.values, tt.wantValues) {
+				t.Errorf("values = %v, want %v", config.values, tt.wantValues)
+			}
+			if !maps.Equal(config.modules, tt.wantModules) {
+				t.Errorf("modules = %v, want %v", config.modules, tt.wantModules)
+			}
+		})
+	}
+}
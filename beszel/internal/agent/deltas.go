@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Readings older than this (or three polling intervals, if longer) are removed,
+// e.g. those of removed containers or of a scraper that stopped polling
+const minCounterAge = 10 * time.Minute
+
+// Keeps the previous readings of counters (bytes sent, cpu time, ...) for each
+// polling interval. Hubs or scrapers that poll the agent at different intervals
+// each get rates over their own interval, instead of over the time since
+// whichever of them polled last. Interval 0 is used by requests that don't
+// specify one, like those of older hubs.
+type counterTracker struct {
+	mutex    sync.Mutex
+	readings map[uint16]map[string]counterReading // by interval, then counter name
+	latest   map[string]counterReading            // most recent reading of each counter
+}
+
+type counterReading struct {
+	values []uint64
+	time   time.Time
+}
+
+// Stores a reading of a counter for the interval and returns the increase of
+// each value since the interval's previous reading, and the seconds elapsed.
+// Intervals without a previous reading use the most recent reading of any
+// interval, so new pollers get rates right away. ok is false if there's no
+// previous reading or a value decreased (e.g. a container restarted).
+func (ct *counterTracker) deltas(interval uint16, name string, now time.Time, values ...uint64) (deltas []uint64, seconds float64, ok bool) {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+	if ct.readings == nil {
+		ct.readings = make(map[uint16]map[string]counterReading)
+		ct.latest = make(map[string]counterReading)
+	}
+	if ct.readings[interval] == nil {
+		ct.readings[interval] = make(map[string]counterReading)
+	}
+	prev, found := ct.readings[interval][name]
+	if !found {
+		prev, found = ct.latest[name]
+	}
+	reading := counterReading{values: values, time: now}
+	ct.readings[interval][name] = reading
+	ct.latest[name] = reading
+
+	seconds = now.Sub(prev.time).Seconds()
+	if !found || seconds <= 0 || len(prev.values) != len(values) {
+		return nil, 0, false
+	}
+	deltas = make([]uint64, len(values))
+	for i, value := range values {
+		if value < prev.values[i] {
+			return nil, 0, false
+		}
+		deltas[i] = value - prev.values[i]
+	}
+	return deltas, seconds, true
+}
+
+// Starts a counter over, e.g. at startup or after its source changed. Previous
+// readings of every interval are discarded and the reading is used by all of them.
+func (ct *counterTracker) reset(name string, now time.Time, values ...uint64) {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+	if ct.latest == nil {
+		ct.readings = make(map[uint16]map[string]counterReading)
+		ct.latest = make(map[string]counterReading)
+	}
+	for _, readings := range ct.readings {
+		delete(readings, name)
+	}
+	ct.latest[name] = counterReading{values: values, time: now}
+}
+
+// Removes readings that weren't updated recently
+func (ct *counterTracker) prune(now time.Time) {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+	for interval, readings := range ct.readings {
+		maxAge := max(minCounterAge, 3*time.Duration(interval)*time.Second)
+		for name, reading := range readings {
+			if now.Sub(reading.time) > maxAge {
+				delete(readings, name)
+			}
+		}
+		if len(readings) == 0 {
+			delete(ct.readings, interval)
+		}
+	}
+	for name, reading := range ct.latest {
+		if now.Sub(reading.time) > minCounterAge {
+			delete(ct.latest, name)
+		}
+	}
+}
+
+// Parses the polling interval of a stats request in seconds. Invalid or missing
+// intervals return 0.
+func parseInterval(s string) uint16 {
+	interval, _ := strconv.ParseUint(s, 10, 16)
+	return uint16(interval)
+}
@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCounterTrackerDeltas(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	type reading struct {
+		interval    uint16
+		name        string
+		after       time.Duration // since start
+		values      []uint64
+		wantDeltas  []uint64
+		wantSeconds float64
+		wantOk      bool
+	}
+	tests := []struct {
+		name     string
+		readings []reading
+	}{
+		{
+			name: "first reading",
+			readings: []reading{
+				{interval: 60, name: "eth0", values: []uint64{100, 200}},
+			},
+		},
+		{
+			name: "increase over interval",
+			readings: []reading{
+				{interval: 60, name: "eth0", values: []uint64{100, 200}},
+				{interval: 60, name: "eth0", after: time.Minute, values: []uint64{700, 500}, wantDeltas: []uint64{600, 300}, wantSeconds: 60, wantOk: true},
+			},
+		},
+		{
+			name: "counter reset",
+			readings: []reading{
+				{interval: 60, name: "eth0", values: []uint64{100, 200}},
+				{interval: 60, name: "eth0", after: time.Minute, values: []uint64{50, 300}},
+				{interval: 60, name: "eth0", after: 2 * time.Minute, values: []uint64{80, 400}, wantDeltas: []uint64{30, 100}, wantSeconds: 60, wantOk: true},
+			},
+		},
+		{
+			name: "different number of values",
+			readings: []reading{
+				{interval: 60, name: "cpu", values: []uint64{1, 2}},
+				{interval: 60, name: "cpu", after: time.Minute, values: []uint64{3, 4, 5}},
+			},
+		},
+		{
+			name: "no time elapsed",
+			readings: []reading{
+				{interval: 60, name: "eth0", values: []uint64{100}},
+				{interval: 60, name: "eth0", values: []uint64{200}},
+			},
+		},
+		{
+			name: "intervals are tracked separately",
+			readings: []reading{
+				{interval: 60, name: "eth0", values: []uint64{0}},
+				{interval: 10, name: "eth0", after: 50 * time.Second, values: []uint64{500}, wantDeltas: []uint64{500}, wantSeconds: 50, wantOk: true},
+				{interval: 10, name: "eth0", after: time.Minute, values: []uint64{600}, wantDeltas: []uint64{100}, wantSeconds: 10, wantOk: true},
+				{interval: 60, name: "eth0", after: time.Minute, values: []uint64{600}, wantDeltas: []uint64{600}, wantSeconds: 60, wantOk: true},
+			},
+		},
+		{
+			name: "counters are tracked separately",
+			readings: []reading{
+				{interval: 60, name: "eth0", values: []uint64{100}},
+				{interval: 60, name: "eth1", after: time.Minute, values: []uint64{500}},
+				{interval: 60, name: "eth0", after: time.Minute, values: []uint64{160}, wantDeltas: []uint64{60}, wantSeconds: 60, wantOk: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ct counterTracker
+			for i, r := range tt.readings {
+				deltas, seconds, ok := ct.deltas(r.interval, r.name, start.Add(r.after), r.values...)
+				if ok != r.wantOk || seconds != r.wantSeconds || !slices.Equal(deltas, r.wantDeltas) {
+					t.Fatalf("reading %d: deltas = %v, %v, %v, want %v, %v, %v", i, deltas, seconds, ok, r.wantDeltas, r.wantSeconds, r.wantOk)
+				}
+			}
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package agent
 
 import (
+	"beszel/internal/entities/smart"
 	"beszel/internal/entities/system"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -32,11 +35,12 @@ func (a *Agent) initializeDiskInfo() {
 	if err != nil {
 		slog.Error("Error getting diskstats", "err", err)
 	}
+	updateIoCounters(diskIoCounters)
 	slog.Debug("Disk I/O", "diskstats", diskIoCounters)
 
 	// Helper function to add a filesystem to fsStats if it doesn't exist
 	addFsStat := func(device, mountpoint string, root bool) {
-		key := filepath.Base(device)
+		key := deviceName(device)
 		var ioMatch bool
 		if _, exists := a.fsStats[key]; !exists {
 			if root {
@@ -49,6 +53,11 @@ func (a *Agent) initializeDiskInfo() {
 					}
 				}
 			} else {
+				// Use the multipath device if this is one path of it, so I/O isn't missed or counted twice
+				if holder := multipathHolder(key); holder != "" {
+					slog.Info("Using multipath device", "device", key, "holder", holder)
+					key = holder
+				}
 				// Check if non-root has diskstats and fall back to folder name if not
 				// Scenario: device is encrypted and named luks-2bcb02be-999d-4417-8d18-5c61e660fb6e - not in /proc/diskstats.
 				// However, the device can be specified by mounting folder from luks device at /extra-filesystems/sda1
@@ -103,8 +112,8 @@ func (a *Agent) initializeDiskInfo() {
 	for _, p := range partitions {
 		// fmt.Println(p.Device, p.Mountpoint)
 		// Binary root fallback or docker root fallback
-		if !hasRoot && (p.Mountpoint == "/" || (p.Mountpoint == "/etc/hosts" && strings.HasPrefix(p.Device, "/dev"))) {
-			fs, match := findIoDevice(filepath.Base(p.Device), diskIoCounters, a.fsStats)
+		if !hasRoot && (p.Mountpoint == rootMountpoint() || (p.Mountpoint == "/etc/hosts" && strings.HasPrefix(p.Device, "/dev"))) {
+			fs, match := findIoDevice(deviceName(p.Device), diskIoCounters, a.fsStats)
 			if match {
 				addFsStat(fs, p.Mountpoint, true)
 				hasRoot = true
@@ -136,12 +145,43 @@ func (a *Agent) initializeDiskInfo() {
 
 	// If no root filesystem set, use fallback
 	if !hasRoot {
-		rootDevice, _ := findIoDevice(filepath.Base(filesystem), diskIoCounters, a.fsStats)
-		slog.Info("Root disk", "mountpoint", "/", "io", rootDevice)
-		a.fsStats[rootDevice] = &system.FsStats{Root: true, Mountpoint: "/"}
+		rootDevice, _ := findIoDevice(deviceName(filesystem), diskIoCounters, a.fsStats)
+		slog.Info("Root disk", "mountpoint", rootMountpoint(), "io", rootDevice)
+		a.fsStats[rootDevice] = &system.FsStats{Root: true, Mountpoint: rootMountpoint()}
 	}
 
 	a.initializeDiskIoStats(diskIoCounters)
+	a.initializeDiskMounts()
+}
+
+// Maps the disks backing each monitored filesystem to the filesystem, so
+// S.M.A.R.T. data can show what a disk holds (e.g. nvme0n1p2 -> nvme0 holds /).
+// The root filesystem is listed by its mountpoint and others by their name.
+func (a *Agent) initializeDiskMounts() {
+	a.diskMounts = make(map[string][]string)
+	for name, stats := range a.fsStats {
+		mount := name
+		if stats.Root {
+			mount = rootMountpoint()
+		}
+		for _, controller := range backingControllers(name) {
+			a.diskMounts[controller] = append(a.diskMounts[controller], mount)
+		}
+	}
+	for controller, mounts := range a.diskMounts {
+		slices.Sort(mounts)
+		slog.Debug("Disk mounts", "disk", controller, "mounts", mounts)
+	}
+}
+
+// Adds the filesystems on each disk to its S.M.A.R.T. data
+func (a *Agent) addSmartMounts(data map[string]smart.SmartData) {
+	for name, d := range data {
+		if mounts := a.diskMounts[deviceController(filepath.Base(d.DiskName))]; len(mounts) > 0 {
+			d.Mounts = mounts
+			data[name] = d
+		}
+	}
 }
 
 // Returns matching device from /proc/diskstats,
@@ -154,7 +194,8 @@ func findIoDevice(filesystem string, diskIoCounters map[string]disk.IOCountersSt
 		if d.Name == filesystem || (d.Label != "" && d.Label == filesystem) {
 			return d.Name, true
 		}
-		if d.ReadBytes > maxReadBytes {
+		// skip paths of multipath devices since their I/O is included in the holder device
+		if d.ReadBytes > maxReadBytes && !isMultipathMember(d.Name) {
 			// don't use if device already exists in fsStats
 			if _, exists := fsStats[d.Name]; !exists {
 				maxReadBytes = d.ReadBytes
@@ -167,7 +208,7 @@ func findIoDevice(filesystem string, diskIoCounters map[string]disk.IOCountersSt
 
 // Sets start values for disk I/O stats.
 func (a *Agent) initializeDiskIoStats(diskIoCounters map[string]disk.IOCountersStat) {
-	for device, stats := range a.fsStats {
+	for device := range a.fsStats {
 		// skip if not in diskIoCounters
 		d, exists := diskIoCounters[device]
 		if !exists {
@@ -175,10 +216,67 @@ func (a *Agent) initializeDiskIoStats(diskIoCounters map[string]disk.IOCountersS
 			continue
 		}
 		// populate initial values
-		stats.Time = time.Now()
-		stats.TotalRead = d.ReadBytes
-		stats.TotalWrite = d.WriteBytes
+		a.counters.reset(diskCounterName(device), time.Now(), diskCounterValues(d)...)
 		// add to list of valid io device names
 		a.fsNames = append(a.fsNames, device)
 	}
 }
+
+// Name of the counters of a disk in the agent's counter tracker
+func diskCounterName(device string) string {
+	return "disk:" + device
+}
+
+// Returns the counters of a disk: bytes read and written, operations read and
+// written, and the time spent reading and writing
+func diskCounterValues(d disk.IOCountersStat) []uint64 {
+	return []uint64{d.ReadBytes, d.WriteBytes, d.ReadCount, d.WriteCount, d.ReadTime, d.WriteTime}
+}
+
+// Prefixes of linux block devices that aren't disks (loop devices, ram disks,
+// optical and floppy drives)
+var skipDiskDevices = []string{"loop", "ram", "zram", "sr", "fd"}
+
+// Returns the throughput, IOPS, average wait and utilization of each disk
+// device. Partitions are skipped on linux, so I/O is only counted once.
+func (a *Agent) getDiskDeviceStats(interval uint16, ioCounters map[string]disk.IOCountersStat, now time.Time) map[string]system.IoStats {
+	devices := make(map[string]system.IoStats)
+	for name, d := range ioCounters {
+		if d.ReadCount == 0 && d.WriteCount == 0 || !isDiskDevice(name) {
+			continue
+		}
+		values := append(diskCounterValues(d), d.IoTime)
+		deltas, secondsElapsed, ok := a.counters.deltas(interval, "dev:"+name, now, values...)
+		if !ok {
+			continue
+		}
+		devices[name] = system.IoStats{
+			Read:       bytesToMegabytes(float64(deltas[0]) / secondsElapsed),
+			Write:      bytesToMegabytes(float64(deltas[1]) / secondsElapsed),
+			ReadIops:   twoDecimals(float64(deltas[2]) / secondsElapsed),
+			WriteIops:  twoDecimals(float64(deltas[3]) / secondsElapsed),
+			ReadAwait:  ioLatency(deltas[4], deltas[2]),
+			WriteAwait: ioLatency(deltas[5], deltas[3]),
+			Await:      ioLatency(deltas[4]+deltas[5], deltas[2]+deltas[3]),
+			// io time is in milliseconds
+			Util: twoDecimals(min(float64(deltas[6])/(secondsElapsed*10), 100)),
+		}
+	}
+	return devices
+}
+
+// Returns true if a device in the disk I/O counters is a disk rather than a
+// partition or virtual device. Only linux counters include partitions.
+func isDiskDevice(name string) bool {
+	if runtime.GOOS != "linux" {
+		return true
+	}
+	for _, prefix := range skipDiskDevices {
+		if strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+	// partitions are only listed under their disk in /sys/block
+	_, err := os.Stat(filepath.Join("/sys/block", strings.ReplaceAll(name, "/", "!")))
+	return err == nil
+}
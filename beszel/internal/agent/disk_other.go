@@ -0,0 +1,25 @@
+//go:build !windows
+
+package agent
+
+import (
+	"path/filepath"
+
+	"github.com/shirou/gopsutil/v4/disk"
+)
+
+// Returns the mountpoint of the root filesystem
+func rootMountpoint() string {
+	return "/"
+}
+
+// Returns the name of a device as used in disk I/O counters (e.g. sda1 for /dev/sda1)
+func deviceName(device string) string {
+	return filepath.Base(device)
+}
+
+// Disk I/O counters from gopsutil are complete on non-Windows platforms
+func updateIoCounters(ioCounters map[string]disk.IOCountersStat) {}
+
+// Drive temperatures are reported by sensors on non-Windows platforms
+func (a *Agent) addDiskTemperatures(temperatures map[string]float64) {}
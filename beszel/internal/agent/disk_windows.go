@@ -0,0 +1,99 @@
+//go:build windows
+
+package agent
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"github.com/shirou/gopsutil/v4/disk"
+	"golang.org/x/sys/windows"
+)
+
+// DISK_PERFORMANCE structure returned by IOCTL_DISK_PERFORMANCE
+type diskPerformance struct {
+	BytesRead           int64
+	BytesWritten        int64
+	ReadTime            int64
+	WriteTime           int64
+	IdleTime            int64
+	ReadCount           uint32
+	WriteCount          uint32
+	QueueDepth          uint32
+	SplitCount          uint32
+	QueryTime           int64
+	StorageDeviceNumber uint32
+	StorageManagerName  [8]uint16
+	alignmentPadding    uint32
+}
+
+const ioctlDiskPerformance = 0x70020
+
+// Returns the drive Windows is installed on, which is used as the root filesystem
+func rootMountpoint() string {
+	if drive := os.Getenv("SystemDrive"); drive != "" {
+		return strings.ToUpper(drive)
+	}
+	return "C:"
+}
+
+// Returns the name of a device as used in disk I/O counters, which is the drive letter on Windows (e.g. C:)
+func deviceName(device string) string {
+	if volume := filepath.VolumeName(device); volume != "" {
+		return strings.ToUpper(volume)
+	}
+	return filepath.Base(device)
+}
+
+// Reads performance counters for a drive letter (e.g. "C:")
+func getDiskPerformance(drive string) (diskPerformance, error) {
+	var perf diskPerformance
+	path, err := windows.UTF16PtrFromString(fmt.Sprintf(`\\.\%s`, drive))
+	if err != nil {
+		return perf, err
+	}
+	h, err := windows.CreateFile(path, 0, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return perf, err
+	}
+	defer windows.CloseHandle(h)
+	var size uint32
+	err = windows.DeviceIoControl(h, ioctlDiskPerformance, nil, 0, (*byte)(unsafe.Pointer(&perf)), uint32(unsafe.Sizeof(perf)), &size, nil)
+	return perf, err
+}
+
+// Adds queue depth to disk I/O counters and corrects read / write times,
+// which gopsutil reports in seconds rather than milliseconds on Windows.
+func updateIoCounters(ioCounters map[string]disk.IOCountersStat) {
+	for name, d := range ioCounters {
+		perf, err := getDiskPerformance(name)
+		if err != nil {
+			slog.Debug("Disk performance", "name", name, "err", err)
+			continue
+		}
+		// times are in 100 nanosecond units
+		d.ReadTime = uint64(perf.ReadTime / 10_000)
+		d.WriteTime = uint64(perf.WriteTime / 10_000)
+		d.IopsInProgress = uint64(perf.QueueDepth)
+		ioCounters[name] = d
+	}
+}
+
+// Adds drive temperatures from S.M.A.R.T. data, since Windows sensors rarely include them
+func (a *Agent) addDiskTemperatures(temperatures map[string]float64) {
+	if a.smartManager == nil {
+		return
+	}
+	for name, data := range a.smartManager.GetCurrentData() {
+		if data.Temperature > 0 {
+			if data.ModelName != "" {
+				name = data.ModelName
+			}
+			temperatures[name] = data.Temperature
+		}
+	}
+}
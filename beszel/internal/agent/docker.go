@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -26,6 +27,10 @@ type dockerManager struct {
 	containerStatsMap   map[string]*container.Stats // Keeps track of container stats
 	validIds            map[string]struct{}         // Map of valid container ids, used to prune invalid containers from containerStatsMap
 	goodDockerVersion   bool                        // Whether docker version is at least 25.0.0 (one-shot works correctly)
+	configured          bool                        // Whether DOCKER_HOST is set or a socket exists, so errors are reported
+	counters            counterTracker              // Previous cpu and network counters of containers for each polling interval
+	cgroupStats         bool                        // Whether stats are read from cgroup files instead of the stats endpoint (DOCKER_STATS=cgroup)
+	cgroupPaths         map[string]string           // Cgroup of each container, if cgroupStats is enabled
 }
 
 // Add goroutine to the queue
@@ -44,8 +49,8 @@ func (d *dockerManager) dequeue() {
 	}
 }
 
-// Returns stats for all running containers
-func (dm *dockerManager) getDockerStats() ([]*container.Stats, error) {
+// Returns stats for all running containers, with rates over the polling interval
+func (dm *dockerManager) getDockerStats(interval uint16) ([]*container.Stats, error) {
 	resp, err := dm.client.Get("http://localhost/containers/json")
 	if err != nil {
 		return nil, err
@@ -76,10 +81,14 @@ func (dm *dockerManager) getDockerStats() ([]*container.Stats, error) {
 			// if so, remove old container data
 			dm.deleteContainerStatsSync(ctr.IdShort)
 		}
+		// cgroup files are read directly, falling back to the stats endpoint
+		if dm.cgroupStats && dm.updateCgroupStats(ctr, interval) == nil {
+			continue
+		}
 		dm.queue()
 		go func() {
 			defer dm.dequeue()
-			err := dm.updateContainerStats(ctr)
+			err := dm.updateContainerStats(ctr, interval)
 			// if error, delete from map and add to failed list to retry
 			if err != nil {
 				dm.containerStatsMutex.Lock()
@@ -99,7 +108,7 @@ func (dm *dockerManager) getDockerStats() ([]*container.Stats, error) {
 			dm.queue()
 			go func() {
 				defer dm.dequeue()
-				err = dm.updateContainerStats(ctr)
+				err = dm.updateContainerStats(ctr, interval)
 				if err != nil {
 					slog.Error("Error getting container stats", "err", err)
 				}
@@ -113,16 +122,20 @@ func (dm *dockerManager) getDockerStats() ([]*container.Stats, error) {
 	for id, v := range dm.containerStatsMap {
 		if _, exists := dm.validIds[id]; !exists {
 			delete(dm.containerStatsMap, id)
+			delete(dm.cgroupPaths, id)
 		} else {
-			stats = append(stats, v)
+			// copy so the next request doesn't change the data while it's sent
+			ctrStats := *v
+			stats = append(stats, &ctrStats)
 		}
 	}
+	dm.counters.prune(time.Now())
 
 	return stats, nil
 }
 
 // Updates stats for individual container
-func (dm *dockerManager) updateContainerStats(ctr container.ApiInfo) error {
+func (dm *dockerManager) updateContainerStats(ctr container.ApiInfo, interval uint16) error {
 	name := ctr.Names[0][1:]
 
 	resp, err := dm.client.Get("http://localhost/containers/" + ctr.IdShort + "/stats?stream=0&one-shot=1")
@@ -135,9 +148,13 @@ func (dm *dockerManager) updateContainerStats(ctr container.ApiInfo) error {
 	defer dm.containerStatsMutex.Unlock()
 
 	// add empty values if they doesn't exist in map
-	stats, initialized := dm.containerStatsMap[ctr.IdShort]
-	if !initialized {
-		stats = &container.Stats{Name: name}
+	stats, ok := dm.containerStatsMap[ctr.IdShort]
+	if !ok {
+		stats = &container.Stats{
+			Name:    name,
+			Project: ctr.Labels[container.LabelComposeProject],
+			Service: ctr.Labels[container.LabelComposeService],
+		}
 		dm.containerStatsMap[ctr.IdShort] = stats
 	}
 
@@ -165,36 +182,31 @@ func (dm *dockerManager) updateContainerStats(ctr container.ApiInfo) error {
 	}
 	usedMemory := res.MemoryStats.Usage - memCache
 
-	// cpu
-	cpuDelta := res.CPUStats.CPUUsage.TotalUsage - stats.PrevCpu[0]
-	systemDelta := res.CPUStats.SystemUsage - stats.PrevCpu[1]
-	cpuPct := float64(cpuDelta) / float64(systemDelta) * 100
-	if cpuPct > 100 {
-		return fmt.Errorf("%s cpu pct greater than 100: %+v", name, cpuPct)
-	}
-	stats.PrevCpu = [2]uint64{res.CPUStats.CPUUsage.TotalUsage, res.CPUStats.SystemUsage}
-
 	// network
-	var total_sent, total_recv uint64
+	var totalSent, totalRecv uint64
 	for _, v := range res.Networks {
-		total_sent += v.TxBytes
-		total_recv += v.RxBytes
+		totalSent += v.TxBytes
+		totalRecv += v.RxBytes
 	}
-	var sent_delta, recv_delta float64
-	// prevent first run from sending all prev sent/recv bytes
-	if initialized {
-		secondsElapsed := time.Since(stats.PrevNet.Time).Seconds()
-		sent_delta = float64(total_sent-stats.PrevNet.Sent) / secondsElapsed
-		recv_delta = float64(total_recv-stats.PrevNet.Recv) / secondsElapsed
+
+	// cpu and network rates, skipped on the first run and after a restart
+	var cpuPct, sentPerSecond, recvPerSecond float64
+	counters := []uint64{res.CPUStats.CPUUsage.TotalUsage, res.CPUStats.SystemUsage, totalSent, totalRecv}
+	if deltas, secondsElapsed, ok := dm.counters.deltas(interval, ctr.IdShort, time.Now(), counters...); ok {
+		if deltas[1] > 0 {
+			cpuPct = float64(deltas[0]) / float64(deltas[1]) * 100
+		}
+		if cpuPct > 100 {
+			return fmt.Errorf("%s cpu pct greater than 100: %+v", name, cpuPct)
+		}
+		sentPerSecond = float64(deltas[2]) / secondsElapsed
+		recvPerSecond = float64(deltas[3]) / secondsElapsed
 	}
-	stats.PrevNet.Sent = total_sent
-	stats.PrevNet.Recv = total_recv
-	stats.PrevNet.Time = time.Now()
 
 	stats.Cpu = twoDecimals(cpuPct)
 	stats.Mem = bytesToMegabytes(float64(usedMemory))
-	stats.NetworkSent = bytesToMegabytes(sent_delta)
-	stats.NetworkRecv = bytesToMegabytes(recv_delta)
+	stats.NetworkSent = bytesToMegabytes(sentPerSecond)
+	stats.NetworkRecv = bytesToMegabytes(recvPerSecond)
 
 	return nil
 }
@@ -231,6 +243,12 @@ func newDockerManager(a *Agent) *dockerManager {
 		transport.DialContext = func(ctx context.Context, proto, addr string) (net.Conn, error) {
 			return (&net.Dialer{}).DialContext(ctx, "unix", parsedURL.Path)
 		}
+	case "npipe":
+		// npipe:////./pipe/docker_engine -> \\.\pipe\docker_engine
+		parsedURL.Path = strings.ReplaceAll(parsedURL.Path, "/", `\`)
+		transport.DialContext = func(ctx context.Context, proto, addr string) (net.Conn, error) {
+			return dialPipe(ctx, parsedURL.Path)
+		}
 	case "tcp", "http", "https":
 		transport.DialContext = func(ctx context.Context, proto, addr string) (net.Conn, error) {
 			return (&net.Dialer{}).DialContext(ctx, "tcp", parsedURL.Host)
@@ -258,8 +276,14 @@ func newDockerManager(a *Agent) *dockerManager {
 		},
 		containerStatsMap: make(map[string]*container.Stats),
 		sem:               make(chan struct{}, 5),
+		cgroupStats:       useCgroupStats(),
+		cgroupPaths:       make(map[string]string),
 	}
 
+	// docker isn't reported as unavailable on systems that don't use it
+	_, statErr := os.Stat(parsedURL.Path)
+	dockerClient.configured = exists || statErr == nil
+
 	// If using podman, return client
 	if strings.Contains(dockerHost, "podman") {
 		a.systemInfo.Podman = true
@@ -293,6 +317,9 @@ func newDockerManager(a *Agent) *dockerManager {
 
 // Test docker / podman sockets and return if one exists
 func getDockerHost() string {
+	if runtime.GOOS == "windows" {
+		return "npipe:////./pipe/docker_engine"
+	}
 	scheme := "unix://"
 	socks := []string{"/var/run/docker.sock", fmt.Sprintf("/run/user/%v/podman/podman.sock", os.Getuid())}
 	for _, sock := range socks {
@@ -0,0 +1,254 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+	"time"
+)
+
+const (
+	enrollEnvFile  = "/etc/beszel-agent.env"
+	enrollUnitFile = "/etc/systemd/system/beszel-agent.service"
+)
+
+type enrollClient struct {
+	hub   string
+	token string
+	http  *http.Client
+}
+
+// Creates a client for requests to the hub. If pin is set, the hub's certificate
+// must have that SHA-256 fingerprint. It's checked instead of the usual chain
+// verification, so it also works with self-signed hub certificates.
+func newEnrollClient(hubURL, token, pin string) (*enrollClient, error) {
+	client := &enrollClient{
+		hub:   strings.TrimSuffix(hubURL, "/"),
+		token: token,
+		http:  &http.Client{Timeout: 15 * time.Second},
+	}
+	if pin == "" {
+		return client, nil
+	}
+	if !strings.HasPrefix(client.hub, "https://") {
+		return nil, errors.New("certificate fingerprint requires an https hub URL")
+	}
+	fingerprint, err := parseCertFingerprint(pin)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: true,
+		// only the leaf is checked, since without chain verification
+		// the other certificates could be anything
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("hub sent no certificate")
+			}
+			sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+			if subtle.ConstantTimeCompare(sum[:], fingerprint) != 1 {
+				return fmt.Errorf("hub certificate fingerprint %X doesn't match pinned fingerprint", sum)
+			}
+			return nil
+		},
+	}
+	client.http.Transport = transport
+	return client, nil
+}
+
+// Parses a SHA-256 certificate fingerprint in hex, with or without colons.
+// Accepts the output of: openssl x509 -noout -fingerprint -sha256
+func parseCertFingerprint(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if _, after, ok := strings.Cut(value, "="); ok {
+		value = after
+	}
+	fingerprint, err := hex.DecodeString(strings.ReplaceAll(value, ":", ""))
+	if err != nil || len(fingerprint) != sha256.Size {
+		return nil, fmt.Errorf("invalid certificate fingerprint %q, expected SHA-256 in hex", value)
+	}
+	return fingerprint, nil
+}
+
+// Enroll registers the agent with a hub, writes a systemd service and starts it.
+//
+// Usage: beszel-agent enroll --hub https://hub.example.com --token <token>
+func Enroll(args []string) {
+	flags := flag.NewFlagSet("enroll", flag.ExitOnError)
+	hubURL := flags.String("hub", "", "URL of the hub")
+	token := flags.String("token", "", "auth token of a hub user")
+	name := flags.String("name", "", "system name (default: hostname)")
+	host := flags.String("host", "", "address the hub uses to connect to the agent (default: outbound IP)")
+	port := flags.String("port", "45876", "port the agent listens on")
+	pin := flags.String("fingerprint", "", "SHA-256 fingerprint of the hub's TLS certificate to pin")
+	flags.Parse(args)
+
+	if *hubURL == "" || *token == "" {
+		fmt.Println("Usage: beszel-agent enroll --hub URL --token TOKEN")
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	if *name == "" {
+		*name, _ = os.Hostname()
+	}
+	client, err := newEnrollClient(*hubURL, *token, *pin)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if *host == "" {
+		ip, err := outboundIP(client.hub)
+		if err != nil {
+			fmt.Println("Error getting outbound IP, set it with --host:", err)
+			os.Exit(1)
+		}
+		*host = ip
+	}
+
+	fmt.Println("Fetching hub key...")
+	var keyRes struct {
+		Key string `json:"key"`
+	}
+	if err := client.request(http.MethodGet, "/api/beszel/getkey", nil, &keyRes); err != nil {
+		fmt.Println("Error fetching hub key:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Writing", enrollEnvFile)
+	env := fmt.Sprintf("KEY=%q\nPORT=%s\n", keyRes.Key, *port)
+	if err := os.WriteFile(enrollEnvFile, []byte(env), 0600); err != nil {
+		fmt.Println("Error writing config:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Writing", enrollUnitFile)
+	if err := writeSystemdUnit(); err != nil {
+		fmt.Println("Error writing service:", err)
+		os.Exit(1)
+	}
+	for _, cmd := range [][]string{{"daemon-reload"}, {"enable", "--now", "beszel-agent.service"}} {
+		if out, err := exec.Command("systemctl", cmd...).CombinedOutput(); err != nil {
+			fmt.Printf("Error running systemctl %s: %s %s\n", strings.Join(cmd, " "), err, out)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Adding system %s (%s:%s) to hub...\n", *name, *host, *port)
+	var authRes struct {
+		Record struct {
+			Id string `json:"id"`
+		} `json:"record"`
+	}
+	if err := client.request(http.MethodPost, "/api/collections/users/auth-refresh", nil, &authRes); err != nil {
+		fmt.Println("Error authenticating with hub:", err)
+		os.Exit(1)
+	}
+	system := map[string]any{
+		"name":   *name,
+		"host":   *host,
+		"port":   *port,
+		"status": "pending",
+		"users":  []string{authRes.Record.Id},
+	}
+	if err := client.request(http.MethodPost, "/api/collections/systems/records", system, nil); err != nil {
+		fmt.Println("Error adding system:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Successfully enrolled")
+}
+
+// Sends a request to the hub and decodes the JSON response into res if not nil
+func (c *enrollClient) request(method, path string, body any, res any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.hub+path, reader)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	if res == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// Returns the local IP used to reach the hub
+func outboundIP(hubURL string) (string, error) {
+	parsed, err := url.Parse(hubURL)
+	if err != nil {
+		return "", err
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = "443"
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(parsed.Hostname(), port))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+// Writes a systemd unit running the current binary with the enroll env file
+func writeSystemdUnit() error {
+	binaryPath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	// run as the beszel user if it was created by the install script
+	runAs := ""
+	if _, err := user.Lookup("beszel"); err == nil {
+		runAs = "User=beszel\n"
+	}
+	unit := fmt.Sprintf(`[Unit]
+Description=Beszel Agent Service
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+EnvironmentFile=%s
+ExecStart=%s
+%sRestart=always
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`, enrollEnvFile, binaryPath, runAs)
+	return os.WriteFile(enrollUnitFile, []byte(unit), 0644)
+}
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Path of procfs, which provides file descriptor and entropy stats on Linux
+const procPath = "/proc"
+
+// Returns the number of allocated file descriptors and the system-wide limit
+// from /proc/sys/fs/file-nr
+func readFileNr() (used, limit float64, err error) {
+	data, err := os.ReadFile(filepath.Join(procPath, "sys/fs/file-nr"))
+	if err != nil {
+		return 0, 0, err
+	}
+	// Example: 1344	0	9223372036854775807 (allocated, free, max)
+	fields := strings.Fields(string(data))
+	if len(fields) != 3 {
+		return 0, 0, fmt.Errorf("unexpected file-nr format: %q", data)
+	}
+	var values [3]float64
+	for i, field := range fields {
+		if values[i], err = strconv.ParseFloat(field, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	return values[0] - values[1], values[2], nil
+}
+
+// Returns the number of open file descriptors of a process and its soft limit
+func processFds(pid int32) (open, limit int, err error) {
+	dir := filepath.Join(procPath, strconv.Itoa(int(pid)))
+	f, err := os.Open(filepath.Join(dir, "fd"))
+	if err != nil {
+		return 0, 0, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+	limits, err := os.Open(filepath.Join(dir, "limits"))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer limits.Close()
+	scanner := bufio.NewScanner(limits)
+	for scanner.Scan() {
+		// Example line: Max open files            1024                 524288               files
+		value, ok := strings.CutPrefix(scanner.Text(), "Max open files")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			break
+		}
+		// an unlimited soft limit is reported as 0
+		limit, _ = strconv.Atoi(fields[0])
+		return len(names), limit, nil
+	}
+	return len(names), 0, scanner.Err()
+}
+
+// Returns the highest file descriptor usage of any process as a percentage of its
+// soft limit. Processes of other users are skipped unless the agent runs as root.
+func maxProcessFdPct() float64 {
+	entries, err := os.ReadDir(procPath)
+	if err != nil {
+		return 0
+	}
+	var maxPct float64
+	for _, entry := range entries {
+		pid, err := strconv.ParseInt(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		open, limit, err := processFds(int32(pid))
+		if err != nil || limit == 0 {
+			continue
+		}
+		maxPct = max(maxPct, float64(open)/float64(limit)*100)
+	}
+	return twoDecimals(maxPct)
+}
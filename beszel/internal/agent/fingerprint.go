@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Sources of the agent fingerprint, set with FINGERPRINT_SOURCE
+const (
+	fingerprintFile      = "file"       // random id stored in DATA_DIR (default)
+	fingerprintMachineID = "machine-id" // derived from /etc/machine-id and the hardware uuid
+	fingerprintTPM       = "tpm"        // derived from the TPM endorsement key
+)
+
+// Persistent handles of the RSA and ECC endorsement keys (TCG EK Credential Profile)
+var tpmEndorsementKeyHandles = []uint32{0x81010001, 0x81010002}
+
+// Returns the directory for files the agent keeps between restarts
+// (DATA_DIR, default /var/lib/beszel-agent or %ProgramData%\beszel-agent on Windows)
+func dataDir() string {
+	if dir, _ := GetEnv("DATA_DIR"); dir != "" {
+		return dir
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(cmp.Or(os.Getenv("ProgramData"), `C:\ProgramData`), "beszel-agent")
+	}
+	return "/var/lib/beszel-agent"
+}
+
+// Returns the fingerprint the hub uses to identify this agent.
+// Sources that are unavailable fall back to the next one (tpm, machine-id, file).
+func getFingerprint() (string, error) {
+	source, _ := GetEnv("FINGERPRINT_SOURCE")
+	switch source {
+	case fingerprintTPM:
+		name, err := tpmEndorsementKeyName()
+		if err == nil {
+			return deriveFingerprint(name), nil
+		}
+		slog.Warn("TPM fingerprint unavailable, using machine-id", "err", err)
+		fallthrough
+	case fingerprintMachineID:
+		id, err := machineID()
+		if err == nil {
+			return deriveFingerprint(id), nil
+		}
+		slog.Warn("machine-id fingerprint unavailable, using file", "err", err)
+	case "", fingerprintFile:
+	default:
+		return "", fmt.Errorf("invalid FINGERPRINT_SOURCE %q", source)
+	}
+	return fileFingerprint()
+}
+
+// Hashes identifying data with an application specific key so the
+// underlying id (e.g. machine-id) isn't exposed to the hub
+func deriveFingerprint(data []byte) string {
+	mac := hmac.New(sha256.New, []byte("beszel-agent-fingerprint"))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Returns the machine-id combined with the hardware uuid when readable,
+// which changes when a VM image is cloned even if the machine-id doesn't
+func machineID() ([]byte, error) {
+	var id []byte
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if data, err := os.ReadFile(path); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+			id = []byte(strings.TrimSpace(string(data)))
+			break
+		}
+	}
+	if id == nil {
+		return nil, errors.New("no machine-id found")
+	}
+	if uuid, err := os.ReadFile("/sys/class/dmi/id/product_uuid"); err == nil {
+		id = append(id, strings.TrimSpace(string(uuid))...)
+	}
+	return id, nil
+}
+
+// Returns the random fingerprint stored in the data dir, creating it on first start
+func fileFingerprint() (string, error) {
+	path := filepath.Join(dataDir(), "fingerprint")
+	if data, err := os.ReadFile(path); err == nil {
+		if fingerprint := strings.TrimSpace(string(data)); fingerprint != "" {
+			return fingerprint, nil
+		}
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	fingerprint := hex.EncodeToString(buf)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	return fingerprint, os.WriteFile(path, []byte(fingerprint+"\n"), 0600)
+}
+
+// Returns the name of the TPM's endorsement key, a digest of its public area
+// that is unique to the TPM and isn't copied with a VM image.
+// Uses TPM2_ReadPublic on the persistent EK handles.
+func tpmEndorsementKeyName() ([]byte, error) {
+	var tpm *os.File
+	var err error
+	for _, path := range []string{"/dev/tpmrm0", "/dev/tpm0"} {
+		if tpm, err = os.OpenFile(path, os.O_RDWR, 0); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer tpm.Close()
+	for _, handle := range tpmEndorsementKeyHandles {
+		if name, err := tpmReadPublicName(tpm, handle); err == nil {
+			return name, nil
+		}
+	}
+	return nil, errors.New("no endorsement key found in TPM")
+}
+
+// Sends TPM2_ReadPublic for a handle and returns the key's name from the response
+func tpmReadPublicName(tpm io.ReadWriter, handle uint32) ([]byte, error) {
+	cmd := make([]byte, 14)
+	binary.BigEndian.PutUint16(cmd[0:], 0x8001)     // TPM_ST_NO_SESSIONS
+	binary.BigEndian.PutUint32(cmd[2:], 14)         // command size
+	binary.BigEndian.PutUint32(cmd[6:], 0x00000173) // TPM_CC_ReadPublic
+	binary.BigEndian.PutUint32(cmd[10:], handle)
+	if _, err := tpm.Write(cmd); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, 4096)
+	n, err := tpm.Read(resp)
+	if err != nil {
+		return nil, err
+	}
+	resp = resp[:n]
+	if len(resp) < 10 {
+		return nil, errors.New("short TPM response")
+	}
+	if rc := binary.BigEndian.Uint32(resp[6:]); rc != 0 {
+		return nil, fmt.Errorf("TPM error 0x%x", rc)
+	}
+	// response parameters are TPM2B_PUBLIC followed by TPM2B_NAME
+	body := resp[10:]
+	if len(body) < 2 {
+		return nil, errors.New("short TPM response")
+	}
+	publicSize := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+publicSize+2 {
+		return nil, errors.New("short TPM response")
+	}
+	body = body[2+publicSize:]
+	nameSize := int(binary.BigEndian.Uint16(body))
+	if nameSize == 0 || len(body) < 2+nameSize {
+		return nil, errors.New("invalid TPM key name")
+	}
+	return body[2 : 2+nameSize], nil
+}
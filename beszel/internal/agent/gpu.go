@@ -5,8 +5,10 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os/exec"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,13 +17,15 @@ import (
 	"golang.org/x/exp/slog"
 )
 
-// GPUManager manages data collection for GPUs (either Nvidia or AMD)
+// GPUManager manages data collection for GPUs (Nvidia, AMD or Intel)
 type GPUManager struct {
-	nvidiaSmi  bool
-	rocmSmi    bool
-	tegrastats bool
-	GpuDataMap map[string]*system.GPUData
-	mutex      sync.Mutex
+	nvidiaSmi   bool
+	rocmSmi     bool
+	tegrastats  bool
+	intelGpuTop bool
+	GpuDataMap  map[string]*system.GPUData
+	nvidiaIds   map[string]string // nvidia gpu uuid -> index
+	mutex       sync.Mutex
 }
 
 // RocmSmiJson represents the JSON structure of rocm-smi output
@@ -36,6 +40,15 @@ type RocmSmiJson struct {
 	PowerSocket  string `json:"Current Socket Graphics Package Power (W)"`
 }
 
+// Readable names of the engine classes reported by intel_gpu_top
+var intelEngineNames = map[string]string{
+	"RCS":  "Render/3D",
+	"BCS":  "Blitter",
+	"VCS":  "Video",
+	"VECS": "VideoEnhance",
+	"CCS":  "Compute",
+}
+
 // gpuCollector defines a collector for a specific GPU management utility (nvidia-smi or rocm-smi)
 type gpuCollector struct {
 	name  string
@@ -164,6 +177,9 @@ func (gm *GPUManager) parseNvidiaData(output []byte) bool {
 						return false
 					}
 				}
+				if len(fields) >= 8 {
+					gm.nvidiaIds[strings.TrimSpace(fields[7])] = id
+				}
 				// update gpu data
 				gpu := gm.GpuDataMap[id]
 				gpu.Temperature = temp
@@ -178,6 +194,36 @@ func (gm *GPUManager) parseNvidiaData(output []byte) bool {
 	return true
 }
 
+// collectNvidiaProcesses periodically counts the running compute processes of each nvidia gpu
+func (gm *GPUManager) collectNvidiaProcesses() {
+	for {
+		time.Sleep(time.Second * 10)
+		output, err := exec.Command("nvidia-smi", "--query-compute-apps=gpu_uuid", "--format=csv,noheader").Output()
+		if err != nil {
+			slog.Debug("nvidia-smi compute apps", "err", err)
+			continue
+		}
+		gm.parseNvidiaProcesses(output)
+	}
+}
+
+// parseNvidiaProcesses sets the process count of each gpu from the output of --query-compute-apps
+func (gm *GPUManager) parseNvidiaProcesses(output []byte) {
+	counts := make(map[string]float64, len(gm.nvidiaIds))
+	for _, line := range strings.Split(string(output), "\n") {
+		if uuid := strings.TrimSpace(line); uuid != "" {
+			counts[uuid]++
+		}
+	}
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+	for uuid, id := range gm.nvidiaIds {
+		if gpu, ok := gm.GpuDataMap[id]; ok {
+			gpu.Processes = counts[uuid]
+		}
+	}
+}
+
 // parseAmdData parses the output of rocm-smi and updates the GPUData map
 func (gm *GPUManager) parseAmdData(output []byte) bool {
 	var rocmSmiInfo map[string]RocmSmiJson
@@ -211,6 +257,65 @@ func (gm *GPUManager) parseAmdData(output []byte) bool {
 	return true
 }
 
+// getIntelParser returns a function to parse the output of intel_gpu_top -l and update the GPUData map
+func (gm *GPUManager) getIntelParser() func(output []byte) bool {
+	// engine names and the column of the power draw, read from the repeated header lines
+	var engines []string
+	powerCol := -1
+
+	return func(output []byte) bool {
+		fields := strings.Fields(string(output))
+		if len(fields) == 0 {
+			return true
+		}
+		switch fields[0] {
+		case "Freq":
+			// first header line names the engines, e.g. "RCS" or "VCS/1"
+			engines = engines[:0]
+			for _, field := range fields {
+				class, instance, _ := strings.Cut(field, "/")
+				if name, ok := intelEngineNames[class]; ok {
+					if instance != "" && instance != "0" {
+						name += " " + instance
+					}
+					engines = append(engines, name)
+				}
+			}
+			return true
+		case "req":
+			// second header line names the columns of each value
+			powerCol = slices.Index(fields, "gpu")
+			return true
+		}
+		// each engine has busy, sema and wait columns at the end of the line
+		first := len(fields) - len(engines)*3
+		if len(engines) == 0 || first < 0 {
+			return true
+		}
+		gm.mutex.Lock()
+		defer gm.mutex.Unlock()
+		gpu, ok := gm.GpuDataMap["i0"]
+		if !ok {
+			gpu = &system.GPUData{Name: "Intel GPU", Engines: make(map[string]float64, len(engines))}
+			gm.GpuDataMap["i0"] = gpu
+		}
+		var usage float64
+		for i, name := range engines {
+			busy, _ := strconv.ParseFloat(fields[first+i*3], 64)
+			gpu.Engines[name] += busy
+			usage = max(usage, busy)
+		}
+		if powerCol >= 0 && powerCol < len(fields) {
+			power, _ := strconv.ParseFloat(fields[powerCol], 64)
+			gpu.Power += power
+		}
+		// busiest engine is the usage of the gpu
+		gpu.Usage += usage
+		gpu.Count++
+		return true
+	}
+}
+
 // sums and resets the current GPU utilization data since the last update
 func (gm *GPUManager) GetCurrentData() map[string]system.GPUData {
 	gm.mutex.Lock()
@@ -229,12 +334,17 @@ func (gm *GPUManager) GetCurrentData() map[string]system.GPUData {
 		gpu.Temperature = twoDecimals(gpu.Temperature)
 		gpu.MemoryUsed = twoDecimals(gpu.MemoryUsed)
 		gpu.MemoryTotal = twoDecimals(gpu.MemoryTotal)
+		gpu.MemoryFree = twoDecimals(max(0, gpu.MemoryTotal-gpu.MemoryUsed))
 		gpu.Usage = twoDecimals(gpu.Usage / gpu.Count)
 		gpu.Power = twoDecimals(gpu.Power / gpu.Count)
+		for name, busy := range gpu.Engines {
+			gpu.Engines[name] = twoDecimals(busy / gpu.Count)
+		}
 		// reset the count
 		gpu.Count = 1
 		// dereference to avoid overwriting anything else
 		gpuCopy := *gpu
+		gpuCopy.Engines = maps.Clone(gpu.Engines)
 		// append id to the name if there are multiple GPUs with the same name
 		if nameCounts[gpu.Name] > 1 {
 			gpuCopy.Name = fmt.Sprintf("%s %s", gpu.Name, id)
@@ -244,7 +354,7 @@ func (gm *GPUManager) GetCurrentData() map[string]system.GPUData {
 	return gpuData
 }
 
-// detectGPUs checks for the presence of GPU management tools (nvidia-smi, rocm-smi, tegrastats)
+// detectGPUs checks for the presence of GPU management tools (nvidia-smi, rocm-smi, tegrastats, intel_gpu_top)
 // in the system path. It sets the corresponding flags in the GPUManager struct if any of these
 // tools are found. If none of the tools are found, it returns an error indicating that no GPU
 // management tools are available.
@@ -258,10 +368,13 @@ func (gm *GPUManager) detectGPUs() error {
 	if _, err := exec.LookPath("tegrastats"); err == nil {
 		gm.tegrastats = true
 	}
-	if gm.nvidiaSmi || gm.rocmSmi || gm.tegrastats {
+	if _, err := exec.LookPath("intel_gpu_top"); err == nil {
+		gm.intelGpuTop = true
+	}
+	if gm.nvidiaSmi || gm.rocmSmi || gm.tegrastats || gm.intelGpuTop {
 		return nil
 	}
-	return fmt.Errorf("no GPU found - install nvidia-smi, rocm-smi, or tegrastats")
+	return fmt.Errorf("no GPU found - install nvidia-smi, rocm-smi, tegrastats, or intel_gpu_top")
 }
 
 // startCollector starts the appropriate GPU data collector based on the command
@@ -271,11 +384,14 @@ func (gm *GPUManager) startCollector(command string) {
 		nvidia := gpuCollector{
 			name: "nvidia-smi",
 			cmd: exec.Command("nvidia-smi", "-l", "4",
-				"--query-gpu=index,name,temperature.gpu,memory.used,memory.total,utilization.gpu,power.draw",
+				"--query-gpu=index,name,temperature.gpu,memory.used,memory.total,utilization.gpu,power.draw,uuid",
 				"--format=csv,noheader,nounits"),
 			parse: gm.parseNvidiaData,
 		}
 		go nvidia.start()
+		if !gm.tegrastats {
+			go gm.collectNvidiaProcesses()
+		}
 	case "rocm-smi":
 		amdCollector := gpuCollector{
 			name: "rocm-smi",
@@ -291,6 +407,13 @@ func (gm *GPUManager) startCollector(command string) {
 			parse: gm.getJetsonParser(),
 		}
 		go jetsonCollector.start()
+	case "intel_gpu_top":
+		intelCollector := gpuCollector{
+			name:  "intel_gpu_top",
+			cmd:   exec.Command("intel_gpu_top", "-s", "3300", "-l"),
+			parse: gm.getIntelParser(),
+		}
+		go intelCollector.start()
 	}
 }
 
@@ -301,6 +424,7 @@ func NewGPUManager() (*GPUManager, error) {
 		return nil, err
 	}
 	gm.GpuDataMap = make(map[string]*system.GPUData, 1)
+	gm.nvidiaIds = make(map[string]string, 1)
 
 	if gm.nvidiaSmi {
 		gm.startCollector("nvidia-smi")
@@ -311,6 +435,9 @@ func NewGPUManager() (*GPUManager, error) {
 	if gm.tegrastats {
 		gm.startCollector("tegrastats")
 	}
+	if gm.intelGpuTop {
+		gm.startCollector("intel_gpu_top")
+	}
 
 	return &gm, nil
 }
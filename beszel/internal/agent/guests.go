@@ -0,0 +1,175 @@
+package agent
+
+import (
+	"beszel/internal/entities/guest"
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Time allowed for virsh or PowerShell to list guests
+const guestsTimeout = 15 * time.Second
+
+// States of libvirt domains by number (virDomainState)
+var libvirtStates = []string{"nostate", "running", "blocked", "paused", "shutdown", "shutoff", "crashed", "pmsuspended"}
+
+// Lists the virtual machines of a KVM host with virsh, or of a Hyper-V host
+// with PowerShell, so they're visible without an agent in each guest
+type guestManager struct {
+	hypervisor string         // kvm or hyperv
+	uri        string         // libvirt connection URI
+	counters   counterTracker // previous cpu time of kvm guests for each polling interval
+}
+
+// Creates a guest manager if the system is a KVM host with virsh or a Hyper-V
+// host. GUESTS=false disables it and LIBVIRT_URI sets the libvirt connection
+// (default qemu:///system).
+func newGuestManager() (*guestManager, error) {
+	if enabled, _ := GetEnv("GUESTS"); enabled == "false" {
+		return nil, errors.New("disabled")
+	}
+	switch runtime.GOOS {
+	case "linux":
+		if _, err := exec.LookPath("virsh"); err != nil {
+			return nil, err
+		}
+		uri, _ := GetEnv("LIBVIRT_URI")
+		gm := &guestManager{hypervisor: "kvm", uri: cmp.Or(uri, "qemu:///system")}
+		if err := gm.run("virsh", "-r", "-c", gm.uri, "list"); err != nil {
+			return nil, err
+		}
+		return gm, nil
+	case "windows":
+		gm := &guestManager{hypervisor: "hyperv"}
+		if err := gm.run("powershell", "-NoProfile", "-NonInteractive", "-Command", "Get-Command Get-VM"); err != nil {
+			return nil, errors.New("Hyper-V PowerShell module not found")
+		}
+		return gm, nil
+	}
+	return nil, errors.ErrUnsupported
+}
+
+func (gm *guestManager) run(name string, args ...string) error {
+	_, err := gm.output(name, args...)
+	return err
+}
+
+func (gm *guestManager) output(name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), guestsTimeout)
+	defer cancel()
+	return exec.CommandContext(ctx, name, args...).Output()
+}
+
+// Returns all guests with their allocations, and the usage of running guests
+// over the polling interval
+func (gm *guestManager) getGuests(interval uint16) ([]*guest.Guest, error) {
+	if gm.hypervisor == "hyperv" {
+		return gm.getHyperVGuests()
+	}
+	return gm.getKVMGuests(interval)
+}
+
+// Reads guests from the output of virsh domstats, e.g.
+//
+//	Domain: 'web'
+//	  state.state=1
+//	  cpu.time=2795160000000
+//	  balloon.maximum=4194304
+//	  balloon.rss=3305776
+//	  vcpu.current=2
+func (gm *guestManager) getKVMGuests(interval uint16) ([]*guest.Guest, error) {
+	output, err := gm.output("virsh", "-r", "-c", gm.uri, "domstats", "--raw", "--state", "--cpu-total", "--balloon", "--vcpu")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	numCPU := float64(runtime.NumCPU())
+	guests := []*guest.Guest{}
+	var current *guest.Guest
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if name, ok := strings.CutPrefix(line, "Domain: "); ok {
+			current = &guest.Guest{Name: strings.Trim(name, "'"), Hypervisor: gm.hypervisor}
+			guests = append(guests, current)
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if current == nil || !ok {
+			continue
+		}
+		n, _ := strconv.ParseUint(value, 10, 64)
+		switch key {
+		case "state.state":
+			current.State = "nostate"
+			if n < uint64(len(libvirtStates)) {
+				current.State = libvirtStates[n]
+			}
+		case "cpu.time":
+			// nanoseconds of cpu time, skipped on the first run and after a guest restarts
+			if deltas, seconds, ok := gm.counters.deltas(interval, current.Name, now, n); ok && seconds > 0 {
+				current.Cpu = twoDecimals(float64(deltas[0]) / 1e9 / seconds / numCPU * 100)
+			}
+		case "balloon.maximum":
+			current.MemMax = bytesToMegabytes(float64(n) * 1024)
+		case "balloon.rss":
+			current.Mem = bytesToMegabytes(float64(n) * 1024)
+		case "vcpu.current":
+			current.Vcpus = uint16(n)
+		}
+	}
+	gm.counters.prune(now)
+	return guests, nil
+}
+
+// Virtual machine in the output of Get-VM
+type hyperVGuest struct {
+	Name                 string
+	State                string
+	ProcessorCount       uint16
+	CPUUsage             float64 // percent of the host's cpu
+	MemoryAssigned       uint64
+	MemoryStartup        uint64
+	MemoryMaximum        uint64
+	DynamicMemoryEnabled bool
+}
+
+// Reads guests from Get-VM, which needs the agent to run as an administrator
+// or a member of Hyper-V Administrators
+func (gm *guestManager) getHyperVGuests() ([]*guest.Guest, error) {
+	const script = "ConvertTo-Json -Compress -InputObject @(Get-VM | Select-Object Name, @{n='State';e={$_.State.ToString()}}, " +
+		"ProcessorCount, CPUUsage, MemoryAssigned, MemoryStartup, MemoryMaximum, DynamicMemoryEnabled)"
+	output, err := gm.output("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	if err != nil {
+		return nil, err
+	}
+	var vms []hyperVGuest
+	if err := json.Unmarshal(output, &vms); err != nil {
+		return nil, err
+	}
+	guests := make([]*guest.Guest, 0, len(vms))
+	for _, vm := range vms {
+		memMax := vm.MemoryStartup
+		if vm.DynamicMemoryEnabled {
+			memMax = vm.MemoryMaximum
+		}
+		guests = append(guests, &guest.Guest{
+			Name:       vm.Name,
+			Hypervisor: gm.hypervisor,
+			State:      strings.ToLower(vm.State),
+			Vcpus:      vm.ProcessorCount,
+			MemMax:     bytesToMegabytes(float64(memMax)),
+			Cpu:        vm.CPUUsage,
+			Mem:        bytesToMegabytes(float64(vm.MemoryAssigned)),
+		})
+	}
+	return guests, nil
+}
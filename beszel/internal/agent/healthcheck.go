@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"beszel/internal/entities/healthcheck"
+	"log/slog"
+	"strconv"
+	"sync"
+)
+
+// Runs HTTP health checks for containers with a beszel.healthcheck.url label.
+// Uses the container list from the last call to getDockerStats.
+func (dm *dockerManager) runHealthChecks() []*healthcheck.Result {
+	results := []*healthcheck.Result{}
+	if dm.apiContainerList == nil {
+		return results
+	}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, ctr := range *dm.apiContainerList {
+		url := ctr.Labels[healthcheck.LabelURL]
+		if url == "" || len(ctr.Names) == 0 {
+			continue
+		}
+		expected, _ := strconv.Atoi(ctr.Labels[healthcheck.LabelStatus])
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := healthcheck.Check{Type: healthcheck.TypeHTTP, Target: url, Status: expected}.Run()
+			result.Name = ctr.Names[0][1:]
+			mutex.Lock()
+			results = append(results, result)
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	slog.Debug("Health checks", "data", results)
+	return results
+}
@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"cmp"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v4/sensors"
+)
+
+// Default path of sysfs, overridden with SYS_SENSORS
+const sysPath = "/sys"
+
+// A hardware monitoring chip in /sys/class/hwmon
+type hwmonChip struct {
+	key    string // name of the chip, with a number if other chips have the same name
+	name   string
+	dir    string // directory of the chip's sensor files
+	device string // resolved path of the device, which orders chips with the same name
+}
+
+// A reading of a hwmon sensor
+type hwmonReading struct {
+	key   string  // chip key and sensor label, e.g. coretemp_core_0
+	value float64 // in the sensor's unit, e.g. degrees Celsius
+}
+
+// Returns the temperatures of hwmon chips. Falls back to gopsutil, which also
+// reads thermal zones and supports other platforms, if no chip reports any.
+func (a *Agent) getTemperatures() ([]sensors.TemperatureStat, error) {
+	readings, err := readHwmon(a.sensorsSysPath, "temp", 1000)
+	if err != nil || len(readings) == 0 {
+		slog.Debug("No hwmon temperatures", "err", err)
+		return sensors.TemperaturesWithContext(a.sensorsContext)
+	}
+	temps := make([]sensors.TemperatureStat, 0, len(readings))
+	for _, reading := range readings {
+		temps = append(temps, sensors.TemperatureStat{SensorKey: reading.key, Temperature: reading.value})
+	}
+	return temps, nil
+}
+
+// Lists the hwmon chips with sensors of a kind (temp, in, fan, ...). Chips with
+// the same name, like the coretemp chips of each cpu socket, are ordered by
+// device path and all but the first get a number, e.g. nvme and nvme_1.
+func hwmonChips(root, kind string) ([]hwmonChip, error) {
+	dirs, err := filepath.Glob(filepath.Join(root, "class/hwmon/hwmon*"))
+	if err != nil {
+		return nil, err
+	}
+	chips := make([]hwmonChip, 0, len(dirs))
+	for _, dir := range dirs {
+		chip := hwmonChip{dir: dir, device: dir}
+		if device, err := filepath.EvalSymlinks(filepath.Join(dir, "device")); err == nil {
+			chip.device = device
+		}
+		// some kernels keep sensor files in the device directory
+		if inputs, _ := filepath.Glob(filepath.Join(dir, kind+"*_input")); len(inputs) == 0 {
+			chip.dir = filepath.Join(dir, "device")
+		}
+		if name, err := os.ReadFile(filepath.Join(dir, "name")); err == nil {
+			chip.name = strings.TrimSpace(string(name))
+		} else if name, err := os.ReadFile(filepath.Join(chip.dir, "name")); err == nil {
+			chip.name = strings.TrimSpace(string(name))
+		}
+		if chip.name == "" {
+			chip.name = filepath.Base(chip.device)
+		}
+		chips = append(chips, chip)
+	}
+	slices.SortFunc(chips, func(a, b hwmonChip) int {
+		return cmp.Or(cmp.Compare(a.name, b.name), cmp.Compare(a.device, b.device))
+	})
+	for i := range chips {
+		chips[i].key = chips[i].name
+		if n := i - slices.IndexFunc(chips, func(c hwmonChip) bool { return c.name == chips[i].name }); n > 0 {
+			chips[i].key += "_" + strconv.Itoa(n)
+		}
+	}
+	return chips, nil
+}
+
+// Returns the voltages of hwmon chips, like motherboard rails and PSU outputs
+func (a *Agent) getVoltages() ([]hwmonReading, error) {
+	return readHwmon(a.sensorsSysPath, "in", 1000)
+}
+
+// Reads the sensors of a kind from all hwmon chips, dividing raw values by
+// scale. Sensors are keyed by chip and label like gopsutil (e.g. coretemp_core_0).
+// Unlabeled temperatures are keyed by chip alone, while other unlabeled sensors,
+// which chips usually have many of, get their channel, e.g. nct6775_in1. Sensors
+// whose key is already taken get their channel appended, e.g. acpitz_temp2.
+// Sensors that fail to read are skipped.
+func readHwmon(root, kind string, scale float64) ([]hwmonReading, error) {
+	chips, err := hwmonChips(root, kind)
+	if err != nil {
+		return nil, err
+	}
+	var readings []hwmonReading
+	used := make(map[string]struct{})
+	for _, chip := range chips {
+		inputs, _ := filepath.Glob(filepath.Join(chip.dir, kind+"*_input"))
+		slices.SortFunc(inputs, func(a, b string) int {
+			return cmp.Compare(hwmonChannel(a, kind), hwmonChannel(b, kind))
+		})
+		for _, input := range inputs {
+			raw, err := os.ReadFile(input)
+			if err != nil {
+				continue
+			}
+			value, err := strconv.ParseFloat(strings.TrimSpace(string(raw)), 64)
+			if err != nil {
+				continue
+			}
+			channel := strings.TrimSuffix(filepath.Base(input), "_input")
+			key := chip.key
+			if label, err := os.ReadFile(filepath.Join(chip.dir, channel+"_label")); err == nil {
+				if label := strings.Join(strings.Fields(strings.ToLower(string(label))), "_"); label != "" {
+					key += "_" + label
+				}
+			}
+			if key == chip.key && kind != "temp" {
+				key += "_" + channel
+			}
+			if _, taken := used[key]; taken {
+				key += "_" + channel
+			}
+			used[key] = struct{}{}
+			readings = append(readings, hwmonReading{key: key, value: value / scale})
+		}
+	}
+	return readings, nil
+}
+
+// Returns the channel number of a sensor file, e.g. 2 for temp2_input
+func hwmonChannel(path, kind string) int {
+	name := strings.TrimPrefix(filepath.Base(path), kind)
+	n, _ := strconv.Atoi(name[:strings.IndexByte(name, '_')])
+	return n
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// Creates a hwmon chip in a fake sysfs with files like temp1_input and temp1_label
+func writeHwmonChip(t *testing.T, root, dir string, files map[string]string) {
+	t.Helper()
+	path := filepath.Join(root, "class/hwmon", dir)
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(path, name), []byte(content+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadHwmon(t *testing.T) {
+	tests := []struct {
+		name  string
+		kind  string
+		chips map[string]map[string]string // by hwmon directory
+		want  []hwmonReading
+	}{
+		{
+			name: "labeled temperatures",
+			kind: "temp",
+			chips: map[string]map[string]string{
+				"hwmon0": {"name": "coretemp", "temp1_input": "45000", "temp1_label": "Package id 0", "temp2_input": "43500", "temp2_label": "Core 0"},
+			},
+			want: []hwmonReading{{"coretemp_package_id_0", 45}, {"coretemp_core_0", 43.5}},
+		},
+		{
+			name: "unlabeled temperature is keyed by chip",
+			kind: "temp",
+			chips: map[string]map[string]string{
+				"hwmon0": {"name": "nvme", "temp1_input": "38850"},
+			},
+			want: []hwmonReading{{"nvme", 38.85}},
+		},
+		{
+			name: "taken keys get their channel",
+			kind: "temp",
+			chips: map[string]map[string]string{
+				"hwmon0": {"name": "acpitz", "temp1_input": "27800", "temp2_input": "29800"},
+			},
+			want: []hwmonReading{{"acpitz", 27.8}, {"acpitz_temp2", 29.8}},
+		},
+		{
+			name: "channels are sorted numerically",
+			kind: "temp",
+			chips: map[string]map[string]string{
+				"hwmon0": {"name": "k10temp", "temp10_input": "50000", "temp10_label": "Tccd8", "temp2_input": "40000", "temp2_label": "Tccd1"},
+			},
+			want: []hwmonReading{{"k10temp_tccd1", 40}, {"k10temp_tccd8", 50}},
+		},
+		{
+			name: "chips with the same name are numbered",
+			kind: "temp",
+			chips: map[string]map[string]string{
+				"hwmon1": {"name": "nvme", "temp1_input": "40000"},
+				"hwmon2": {"name": "nvme", "temp1_input": "42000"},
+			},
+			want: []hwmonReading{{"nvme", 40}, {"nvme_1", 42}},
+		},
+		{
+			name: "unlabeled voltages get their channel",
+			kind: "in",
+			chips: map[string]map[string]string{
+				"hwmon0": {"name": "nct6775", "in0_input": "1040", "in1_input": "12096", "in1_label": "+12V", "temp1_input": "30000"},
+			},
+			want: []hwmonReading{{"nct6775_in0", 1.04}, {"nct6775_+12v", 12.096}},
+		},
+		{
+			name: "invalid values are skipped",
+			kind: "temp",
+			chips: map[string]map[string]string{
+				"hwmon0": {"name": "coretemp", "temp1_input": "n/a", "temp2_input": "41000", "temp2_label": "Core 1"},
+			},
+			want: []hwmonReading{{"coretemp_core_1", 41}},
+		},
+		{
+			name:  "no chips",
+			kind:  "temp",
+			chips: map[string]map[string]string{},
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for dir, files := range tt.chips {
+				writeHwmonChip(t, root, dir, files)
+			}
+			readings, err := readHwmon(root, tt.kind, 1000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(readings, tt.want) {
+				t.Fatalf("readHwmon() = %v, want %v", readings, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"beszel/internal/entities/container"
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Directory of the service account mounted into pods
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Reads pod stats from the kubelet of the node the agent runs on. Used instead
+// of the Docker API when the agent runs as a Kubernetes DaemonSet.
+type kubeletManager struct {
+	mutex     sync.Mutex
+	client    *http.Client
+	url       string                      // kubelet stats summary URL
+	tokenPath string                      // service account token, read on each request since it's rotated
+	podStats  map[string]*container.Stats // keeps track of pod stats by pod uid
+	counters  counterTracker              // previous network counters of pods for each polling interval
+}
+
+// Creates a kubelet manager if KUBERNETES is set to true.
+//
+// The kubelet is reached at KUBELET_URL (default https://NODE_IP:10250, with NODE_IP
+// set from status.hostIP) using the pod's service account token, which needs get
+// permission on the nodes/stats resource. KUBELET_INSECURE=true skips verification
+// of the kubelet's certificate, which is often self-signed.
+func newKubeletManager() *kubeletManager {
+	if enabled, _ := GetEnv("KUBERNETES"); enabled != "true" {
+		return nil
+	}
+	kubeletURL, _ := GetEnv("KUBELET_URL")
+	if kubeletURL == "" {
+		nodeIP, _ := GetEnv("NODE_IP")
+		kubeletURL = "https://" + net.JoinHostPort(cmp.Or(nodeIP, "localhost"), "10250")
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if insecure, _ := GetEnv("KUBELET_INSECURE"); insecure == "true" {
+		tlsConfig.InsecureSkipVerify = true
+	} else if caPEM, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt")); err == nil {
+		// kubelet certificates signed by the cluster CA
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pool.AppendCertsFromPEM(caPEM)
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	km := &kubeletManager{
+		client:    &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		url:       strings.TrimSuffix(kubeletURL, "/") + "/stats/summary",
+		tokenPath: filepath.Join(serviceAccountDir, "token"),
+		podStats:  make(map[string]*container.Stats),
+	}
+	if tokenPath, _ := GetEnv("KUBELET_TOKEN_FILE"); tokenPath != "" {
+		km.tokenPath = tokenPath
+	}
+	slog.Info("KUBERNETES", "kubelet", km.url)
+	return km
+}
+
+// Returns stats for all pods on the node, with rates over the polling interval.
+// Pod namespaces are reported as the project.
+func (km *kubeletManager) getPodStats(interval uint16) ([]*container.Stats, error) {
+	req, err := http.NewRequest(http.MethodGet, km.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token, err := os.ReadFile(km.tokenPath); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	res, err := km.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("kubelet returned %s: %w", res.Status, fs.ErrPermission)
+	case res.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("kubelet returned %s", res.Status)
+	}
+	var summary container.KubeletSummary
+	if err := json.NewDecoder(res.Body).Decode(&summary); err != nil {
+		return nil, err
+	}
+
+	km.mutex.Lock()
+	defer km.mutex.Unlock()
+
+	now := time.Now()
+	// usageNanoCores is per core, but container cpu is a percentage of the whole system
+	systemNanoCores := float64(runtime.NumCPU()) * 1e9
+	validIds := make(map[string]struct{}, len(summary.Pods))
+	stats := make([]*container.Stats, 0, len(summary.Pods))
+	for _, pod := range summary.Pods {
+		id := pod.PodRef.UID
+		validIds[id] = struct{}{}
+		podStats, ok := km.podStats[id]
+		if !ok {
+			podStats = &container.Stats{
+				Name:    pod.PodRef.Name,
+				Project: pod.PodRef.Namespace,
+			}
+			km.podStats[id] = podStats
+		}
+		podStats.Cpu, podStats.Mem, podStats.NetworkSent, podStats.NetworkRecv = 0, 0, 0, 0
+		if pod.CPU != nil && pod.CPU.UsageNanoCores != nil {
+			podStats.Cpu = twoDecimals(float64(*pod.CPU.UsageNanoCores) / systemNanoCores * 100)
+		}
+		if pod.Memory != nil && pod.Memory.WorkingSetBytes != nil {
+			podStats.Mem = bytesToMegabytes(float64(*pod.Memory.WorkingSetBytes))
+		}
+		if pod.Network != nil && pod.Network.RxBytes != nil && pod.Network.TxBytes != nil {
+			// skipped on the first run and after counter resets
+			if deltas, secondsElapsed, ok := km.counters.deltas(interval, id, now, *pod.Network.TxBytes, *pod.Network.RxBytes); ok {
+				podStats.NetworkSent = bytesToMegabytes(float64(deltas[0]) / secondsElapsed)
+				podStats.NetworkRecv = bytesToMegabytes(float64(deltas[1]) / secondsElapsed)
+			}
+		}
+		// copy so the next request doesn't change the data while it's sent
+		podCopy := *podStats
+		stats = append(stats, &podCopy)
+	}
+	// remove pods that no longer exist
+	for id := range km.podStats {
+		if _, ok := validIds[id]; !ok {
+			delete(km.podStats, id)
+		}
+	}
+	km.counters.prune(now)
+	return stats, nil
+}
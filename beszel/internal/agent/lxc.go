@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"beszel/internal/entities/container"
+	"bufio"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reads stats of LXC containers (including Proxmox and Incus containers) from
+// their cgroups, so they're reported alongside Docker containers
+type lxcManager struct {
+	mutex    sync.Mutex
+	stats    map[string]*container.Stats // Keeps track of container stats by cgroup path
+	counters counterTracker              // Previous cpu and network counters of containers for each polling interval
+}
+
+// Creates a new LXC manager on Linux unless LXC is set to false
+func newLxcManager() *lxcManager {
+	if enabled, _ := GetEnv("LXC"); enabled == "false" || runtime.GOOS != "linux" {
+		return nil
+	}
+	return &lxcManager{stats: make(map[string]*container.Stats)}
+}
+
+// Returns the cgroups of running LXC containers: lxc.payload.<name> for LXC 4+
+// and Incus, and lxc/<vmid> for Proxmox
+func lxcCgroups() map[string]struct{} {
+	cgroups := make(map[string]struct{})
+	payloads, _ := filepath.Glob(filepath.Join(cgroupRoot, "lxc.payload.*"))
+	for _, path := range payloads {
+		cgroups[path] = struct{}{}
+	}
+	entries, _ := os.ReadDir(filepath.Join(cgroupRoot, "lxc"))
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() {
+			cgroups[filepath.Join(cgroupRoot, "lxc", entry.Name())] = struct{}{}
+		}
+	}
+	return cgroups
+}
+
+// Returns the name of the container in a cgroup. Proxmox containers are named
+// after the hostname in their config, falling back to the vmid.
+func lxcContainerName(cgroupPath string) string {
+	name := filepath.Base(cgroupPath)
+	if payloadName, ok := strings.CutPrefix(name, "lxc.payload."); ok {
+		return payloadName
+	}
+	file, err := os.Open(filepath.Join("/etc/pve/lxc", name+".conf"))
+	if err != nil {
+		return name
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if hostname, ok := strings.CutPrefix(scanner.Text(), "hostname:"); ok {
+			return strings.TrimSpace(hostname)
+		}
+	}
+	return name
+}
+
+// Returns stats for all running LXC containers, with rates over the polling interval
+func (lm *lxcManager) getContainerStats(interval uint16) []*container.Stats {
+	cgroups := lxcCgroups()
+
+	lm.mutex.Lock()
+	defer lm.mutex.Unlock()
+
+	stats := make([]*container.Stats, 0, len(cgroups))
+	for path := range cgroups {
+		ctr, ok := lm.stats[path]
+		if !ok {
+			ctr = &container.Stats{Name: lxcContainerName(path)}
+			lm.stats[path] = ctr
+		}
+		if err := lm.updateLxcStats(ctr, path, interval); err != nil {
+			continue
+		}
+		// copy so the next request doesn't change the data while it's sent
+		ctrStats := *ctr
+		stats = append(stats, &ctrStats)
+	}
+	// remove containers that were stopped
+	for path := range lm.stats {
+		if _, ok := cgroups[path]; !ok {
+			delete(lm.stats, path)
+		}
+	}
+	lm.counters.prune(time.Now())
+	return stats
+}
+
+// Updates the cpu, memory and network usage of a container from its cgroup
+func (lm *lxcManager) updateLxcStats(ctr *container.Stats, cgroupPath string, interval uint16) error {
+	now := time.Now()
+	cpuUsage, err := readCgroupValue(filepath.Join(cgroupPath, "cpu.stat"), "usage_usec")
+	if err != nil {
+		return err
+	}
+	memory, err := readCgroupValue(filepath.Join(cgroupPath, "memory.current"), "")
+	if err != nil {
+		return err
+	}
+	// exclude inactive page cache, like docker stats
+	if inactive, err := readCgroupValue(filepath.Join(cgroupPath, "memory.stat"), "inactive_file"); err == nil && inactive < memory {
+		memory -= inactive
+	}
+	ctr.Mem = bytesToMegabytes(float64(memory))
+
+	// cpu usage is in microseconds
+	ctr.Cpu = 0
+	if deltas, secondsElapsed, ok := lm.counters.deltas(interval, cgroupPath, now, cpuUsage); ok {
+		ctr.Cpu = twoDecimals(float64(deltas[0]) / (secondsElapsed * 1e6 * float64(runtime.NumCPU())) * 100)
+	}
+
+	// network is only available for Proxmox containers, whose host side veth
+	// interfaces are named veth<vmid>i<n>. The host receives what the container sends.
+	ctr.NetworkSent, ctr.NetworkRecv = 0, 0
+	if filepath.Base(filepath.Dir(cgroupPath)) != "lxc" {
+		return nil
+	}
+	interfaces, _ := filepath.Glob("/sys/class/net/veth" + filepath.Base(cgroupPath) + "i*")
+	if len(interfaces) == 0 {
+		return nil
+	}
+	var sent, recv uint64
+	for _, iface := range interfaces {
+		rx, _ := readCgroupValue(filepath.Join(iface, "statistics/rx_bytes"), "")
+		tx, _ := readCgroupValue(filepath.Join(iface, "statistics/tx_bytes"), "")
+		sent += rx
+		recv += tx
+	}
+	// skipped on the first run and after counter resets
+	if deltas, secondsElapsed, ok := lm.counters.deltas(interval, cgroupPath+"/net", now, sent, recv); ok {
+		ctr.NetworkSent = bytesToMegabytes(float64(deltas[0]) / secondsElapsed)
+		ctr.NetworkRecv = bytesToMegabytes(float64(deltas[1]) / secondsElapsed)
+	}
+	return nil
+}
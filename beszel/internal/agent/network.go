@@ -1,7 +1,11 @@
 package agent
 
 import (
+	"beszel/internal/entities/system"
+	"fmt"
 	"log/slog"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,13 +26,25 @@ func (a *Agent) initializeNetIoStats() {
 		}
 	}
 
-	// reset network I/O stats
-	a.netIoStats.BytesSent = 0
-	a.netIoStats.BytesRecv = 0
+	// link speeds set with NIC_SPEED, e.g. "1000" for all interfaces or "eth0:10000,wlan0:300"
+	a.nicSpeeds = make(map[string]float64)
+	if speeds, exists := GetEnv("NIC_SPEED"); exists {
+		for _, entry := range strings.Split(speeds, ",") {
+			name, speed, found := strings.Cut(strings.TrimSpace(entry), ":")
+			if !found {
+				name, speed = "", name
+			}
+			if value, err := strconv.ParseFloat(speed, 64); err == nil && value > 0 {
+				a.nicSpeeds[name] = value
+			} else {
+				slog.Warn("Invalid NIC_SPEED", "value", entry)
+			}
+		}
+	}
 
 	// get intial network I/O stats
 	if netIO, err := psutilNet.IOCounters(true); err == nil {
-		a.netIoStats.Time = time.Now()
+		var bytesSent, bytesRecv uint64
 		for _, v := range netIO {
 			switch {
 			// skip if nics exists and the interface is not in the list
@@ -43,11 +59,13 @@ func (a *Agent) initializeNetIoStats() {
 				}
 			}
 			slog.Info("Detected network interface", "name", v.Name, "sent", v.BytesSent, "recv", v.BytesRecv)
-			a.netIoStats.BytesSent += v.BytesSent
-			a.netIoStats.BytesRecv += v.BytesRecv
+			bytesSent += v.BytesSent
+			bytesRecv += v.BytesRecv
 			// store as a valid network interface
 			a.netInterfaces[v.Name] = struct{}{}
 		}
+		// reset network I/O stats
+		a.counters.reset("net", time.Now(), bytesSent, bytesRecv)
 	}
 }
 
@@ -57,6 +75,9 @@ func (a *Agent) skipNetworkInterface(v psutilNet.IOCountersStat) bool {
 		strings.HasPrefix(v.Name, "docker"),
 		strings.HasPrefix(v.Name, "br-"),
 		strings.HasPrefix(v.Name, "veth"),
+		// windows loopback and hyper-v / wsl virtual switches
+		strings.HasPrefix(v.Name, "Loopback Pseudo-Interface"),
+		strings.HasPrefix(v.Name, "vEthernet"),
 		v.BytesRecv == 0,
 		v.BytesSent == 0:
 		return true
@@ -64,3 +85,53 @@ func (a *Agent) skipNetworkInterface(v psutilNet.IOCountersStat) bool {
 		return false
 	}
 }
+
+// Returns the throughput of each valid network interface and its utilization
+// of the link speed. Utilization uses the higher of sent and received, as links
+// are full duplex.
+func (a *Agent) getNicStats(interval uint16, netIO []psutilNet.IOCountersStat, now time.Time) map[string]system.NicStats {
+	nics := make(map[string]system.NicStats, len(a.netInterfaces))
+	for _, v := range netIO {
+		if _, exists := a.netInterfaces[v.Name]; !exists {
+			continue
+		}
+		deltas, secondsElapsed, ok := a.counters.deltas(interval, "nic:"+v.Name, now, v.BytesSent, v.BytesRecv)
+		if !ok {
+			continue
+		}
+		sentPs := float64(deltas[0]) / secondsElapsed
+		recvPs := float64(deltas[1]) / secondsElapsed
+		nic := system.NicStats{
+			Sent:  bytesToMegabytes(sentPs),
+			Recv:  bytesToMegabytes(recvPs),
+			Speed: a.nicSpeed(v.Name),
+		}
+		if nic.Speed > 0 {
+			nic.Util = twoDecimals(max(sentPs, recvPs) * 8 / (nic.Speed * 1e6) * 100)
+		}
+		nics[v.Name] = nic
+	}
+	return nics
+}
+
+// Returns the link speed of a network interface in Mb/s from NIC_SPEED, or
+// from sysfs on linux. Returns 0 if the speed is unknown, e.g. for wireless
+// and virtual interfaces.
+func (a *Agent) nicSpeed(name string) float64 {
+	if speed, ok := a.nicSpeeds[name]; ok {
+		return speed
+	}
+	if speed, ok := a.nicSpeeds[""]; ok {
+		return speed
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/sys/class/net/%s/speed", name))
+	if err != nil {
+		return 0
+	}
+	// -1 if the link is down or the driver doesn't report a speed
+	speed, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil || speed <= 0 {
+		return 0
+	}
+	return speed
+}
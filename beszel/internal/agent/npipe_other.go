@@ -0,0 +1,14 @@
+//go:build !windows
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// Named pipes are only used for the Docker API on Windows
+func dialPipe(ctx context.Context, path string) (net.Conn, error) {
+	return nil, errors.New("named pipes are only supported on Windows")
+}
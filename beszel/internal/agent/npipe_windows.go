@@ -0,0 +1,99 @@
+//go:build windows
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// Connection to a Windows named pipe using overlapped I/O, so reads and writes
+// don't block each other
+type pipeConn struct {
+	handle windows.Handle
+	path   string
+	once   sync.Once
+}
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// Dials a named pipe such as \\.\pipe\docker_engine, waiting while it's busy
+func dialPipe(ctx context.Context, path string) (net.Conn, error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		handle, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil,
+			windows.OPEN_EXISTING, windows.FILE_FLAG_OVERLAPPED, 0)
+		if err == nil {
+			return &pipeConn{handle: handle, path: path}, nil
+		}
+		if !errors.Is(err, windows.ERROR_PIPE_BUSY) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// Runs an overlapped read or write and waits for it to complete
+func (c *pipeConn) overlapped(b []byte, op func(windows.Handle, []byte, *uint32, *windows.Overlapped) error) (int, error) {
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(event)
+	ov := windows.Overlapped{HEvent: event}
+	var n uint32
+	err = op(c.handle, b, &n, &ov)
+	if errors.Is(err, windows.ERROR_IO_PENDING) {
+		err = windows.GetOverlappedResult(c.handle, &ov, &n, true)
+	}
+	switch {
+	case errors.Is(err, windows.ERROR_BROKEN_PIPE), errors.Is(err, windows.ERROR_PIPE_NOT_CONNECTED):
+		return int(n), io.EOF
+	case errors.Is(err, windows.ERROR_OPERATION_ABORTED), errors.Is(err, windows.ERROR_INVALID_HANDLE):
+		return int(n), net.ErrClosed
+	}
+	return int(n), err
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	return c.overlapped(b, windows.ReadFile)
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	return c.overlapped(b, windows.WriteFile)
+}
+
+// Cancels pending reads and writes and closes the pipe
+func (c *pipeConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		windows.CancelIoEx(c.handle, nil)
+		err = windows.CloseHandle(c.handle)
+	})
+	return err
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return pipeAddr(c.path) }
+func (c *pipeConn) RemoteAddr() net.Addr { return pipeAddr(c.path) }
+
+// Deadlines aren't supported. Requests are bounded by the http client timeout,
+// which closes the connection.
+func (c *pipeConn) SetDeadline(t time.Time) error      { return nil }
+func (c *pipeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *pipeConn) SetWriteDeadline(t time.Time) error { return nil }
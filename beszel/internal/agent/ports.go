@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"beszel/internal/entities/ports"
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	psutilNet "github.com/shirou/gopsutil/v4/net"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// How long the listening ports inventory is reused before reading it again
+const portsInterval = 5 * time.Minute
+
+type portsManager struct {
+	ports   []*ports.Port // Last inventory of listening sockets
+	updated time.Time     // When the inventory was read
+}
+
+// Returns the TCP and UDP sockets listening on the system with the names of
+// their processes. The inventory is cached, as listening sockets rarely change.
+func (pm *portsManager) getPorts() ([]*ports.Port, error) {
+	if pm.ports != nil && time.Since(pm.updated) < portsInterval {
+		return pm.ports, nil
+	}
+	conns, err := psutilNet.Connections("inet")
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int32]string)
+	seen := make(map[string]struct{})
+	list := make([]*ports.Port, 0, len(conns))
+	for _, conn := range conns {
+		var proto string
+		switch {
+		case conn.Type == syscall.SOCK_STREAM && conn.Status == "LISTEN":
+			proto = "tcp"
+		// udp sockets don't listen, but unconnected ones receive from any address
+		case conn.Type == syscall.SOCK_DGRAM && conn.Raddr.Port == 0:
+			proto = "udp"
+		default:
+			continue
+		}
+		if strings.Contains(conn.Laddr.IP, ":") {
+			proto += "6"
+		}
+		port := &ports.Port{Proto: proto, Address: conn.Laddr.IP, Port: conn.Laddr.Port}
+		// sockets of forked workers or SO_REUSEPORT share an address
+		key := port.Key()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		// pids of other users' sockets are unknown without root
+		if conn.Pid > 0 {
+			name, ok := names[conn.Pid]
+			if !ok {
+				if p, err := process.NewProcess(conn.Pid); err == nil {
+					name, _ = p.Name()
+				}
+				names[conn.Pid] = name
+			}
+			port.Process = name
+		}
+		list = append(list, port)
+	}
+	slices.SortFunc(list, func(a, b *ports.Port) int {
+		return cmp.Or(cmp.Compare(a.Port, b.Port), cmp.Compare(a.Proto, b.Proto), cmp.Compare(a.Address, b.Address))
+	})
+	pm.ports = list
+	pm.updated = time.Now()
+	return list, nil
+}
+
+// Creates a new ports manager unless listening ports are disabled with PORTS=false
+func newPortsManager() (*portsManager, error) {
+	if enabled, _ := GetEnv("PORTS"); enabled == "false" {
+		return nil, fmt.Errorf("listening ports disabled")
+	}
+	return &portsManager{}, nil
+}
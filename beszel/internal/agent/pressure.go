@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Resources with pressure stall information in /proc/pressure
+var pressureResources = [...]string{"cpu", "memory", "io"}
+
+// Returns the total stall time in microseconds of some and full pressure of each
+// resource in /proc/pressure, as consecutive pairs. Full cpu pressure is 0, since
+// it's undefined for the whole system. Returns errors.ErrUnsupported if the
+// kernel doesn't report pressure (before 4.20, or disabled with psi=0).
+func readPressure() ([]uint64, error) {
+	values := make([]uint64, 0, len(pressureResources)*2)
+	for _, resource := range pressureResources {
+		some, full, err := readPressureFile(filepath.Join(procPath, "pressure", resource))
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, errors.ErrUnsupported) {
+			return nil, errors.ErrUnsupported
+		}
+		if err != nil {
+			return nil, err
+		}
+		if resource == "cpu" {
+			full = 0
+		}
+		values = append(values, some, full)
+	}
+	return values, nil
+}
+
+// Returns the totals of the some and full lines of a pressure file
+func readPressureFile(path string) (some, full uint64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	// Example: some avg10=0.00 avg60=0.00 avg300=0.00 total=232726577
+	scanner := bufio.NewScanner(file)
+	found := false
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		total, ok := strings.CutPrefix(fields[len(fields)-1], "total=")
+		if !ok {
+			return 0, 0, fmt.Errorf("unexpected pressure format: %q", scanner.Text())
+		}
+		value, err := strconv.ParseUint(total, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		switch fields[0] {
+		case "some":
+			some, found = value, true
+		case "full":
+			full = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+	if !found {
+		return 0, 0, fmt.Errorf("no some pressure in %s", path)
+	}
+	return some, full, nil
+}
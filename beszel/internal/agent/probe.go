@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"beszel"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Health of the agent process reported to Docker healthchecks and Kubernetes probes
+type probeResponse struct {
+	Status         string     `json:"status"`
+	Version        string     `json:"version"`
+	Uptime         int64      `json:"uptime"`                    // seconds since the agent started
+	LastCollection *time.Time `json:"last_collection,omitempty"` // last time stats were requested
+}
+
+// Serves GET /health over plain HTTP on HEALTH_ADDR, separately from the
+// authenticated SSH or HTTPS server
+func (a *Agent) startProbeServer(addr string) {
+	started := time.Now()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		res := probeResponse{
+			Status:  "ok",
+			Version: beszel.Version,
+			Uptime:  int64(time.Since(started).Seconds()),
+		}
+		if last := a.lastCollection.Load(); last > 0 {
+			t := time.Unix(last, 0).UTC()
+			res.LastCollection = &t
+		}
+		writeJSON(w, res)
+	})
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	slog.Info("Starting health server", "address", addr)
+	if err := server.ListenAndServe(); err != nil {
+		slog.Error("Error starting health server", "err", err)
+	}
+}
+
+// Health checks a running agent for use as a container healthcheck command.
+// It requests /health from HEALTH_ADDR if set, and otherwise checks that the
+// agent accepts connections on its listen address.
+func Health(addr string) error {
+	if healthAddr, _ := GetEnv("HEALTH_ADDR"); healthAddr != "" {
+		client := &http.Client{Timeout: 5 * time.Second}
+		res, err := client.Get("http://" + localAddr(healthAddr) + "/health")
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("health server returned %s", res.Status)
+		}
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", localAddr(addr), 5*time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Returns an address to connect to for a listen address, using localhost
+// if the listen address has no host (":45876")
+func localAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
+	}
+	return addr
+}
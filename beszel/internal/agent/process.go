@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// Time between cpu samples when calculating process cpu usage
+const processSampleInterval = 500 * time.Millisecond
+
+// Returns the top n processes by cpu, by memory and by file descriptor usage
+func getTopProcesses(n int) (system.ProcessList, error) {
+	procs, err := process.Processes()
+	if err != nil {
+		return system.ProcessList{}, err
+	}
+
+	// sample cpu times twice to get current usage rather than the average since process start
+	startTimes := make(map[int32]float64, len(procs))
+	for _, p := range procs {
+		if times, err := p.Times(); err == nil {
+			startTimes[p.Pid] = times.User + times.System
+		}
+	}
+	start := time.Now()
+	time.Sleep(processSampleInterval)
+	elapsed := time.Since(start).Seconds() * float64(runtime.NumCPU())
+
+	list := make([]system.Process, 0, len(procs))
+	for _, p := range procs {
+		startTime, ok := startTimes[p.Pid]
+		if !ok {
+			continue
+		}
+		times, err := p.Times()
+		if err != nil {
+			continue
+		}
+		proc := system.Process{Pid: p.Pid}
+		proc.Name, _ = p.Name()
+		proc.User, _ = p.Username()
+		proc.Cpu = twoDecimals((times.User + times.System - startTime) / elapsed * 100)
+		if mem, err := p.MemoryInfo(); err == nil {
+			proc.Mem = bytesToMegabytes(float64(mem.RSS))
+		}
+		proc.Fds, proc.FdLimit, _ = processFds(p.Pid)
+		list = append(list, proc)
+	}
+
+	n = min(n, len(list))
+	var result system.ProcessList
+	sort.Slice(list, func(i, j int) bool { return list[i].Cpu > list[j].Cpu })
+	result.Cpu = append(result.Cpu, list[:n]...)
+	sort.Slice(list, func(i, j int) bool { return list[i].Mem > list[j].Mem })
+	result.Mem = append(result.Mem, list[:n]...)
+	// only linux reports file descriptors
+	if runtime.GOOS == "linux" {
+		sort.Slice(list, func(i, j int) bool { return fdPct(list[i]) > fdPct(list[j]) })
+		result.Fd = append(result.Fd, list[:n]...)
+	}
+	return result, nil
+}
+
+// Returns the open file descriptors of a process as a percentage of its limit
+func fdPct(p system.Process) float64 {
+	if p.FdLimit == 0 {
+		return 0
+	}
+	return float64(p.Fds) / float64(p.FdLimit) * 100
+}
@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"beszel/internal/entities/container"
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CA that signs the certificates of Proxmox VE nodes
+const proxmoxCAPath = "/etc/pve/pve-root-ca.pem"
+
+// Reads stats of the QEMU virtual machines on a Proxmox VE node from the
+// Proxmox API, so they're reported alongside containers
+type proxmoxManager struct {
+	mutex    sync.Mutex
+	client   *http.Client
+	url      string                   // node qemu API URL
+	token    string                   // API token in the form user@realm!tokenid=secret
+	vmStats  map[int]*container.Stats // keeps track of vm stats by vmid
+	counters counterTracker           // previous network and disk counters of vms for each polling interval
+}
+
+// Virtual machine in the response of /nodes/{node}/qemu
+type proxmoxVM struct {
+	VMID      int     `json:"vmid"`
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	CPU       float64 `json:"cpu"`  // fraction of the vm's cpus
+	CPUs      float64 `json:"cpus"` // number of cpus
+	Mem       uint64  `json:"mem"`
+	NetIn     uint64  `json:"netin"`
+	NetOut    uint64  `json:"netout"`
+	DiskRead  uint64  `json:"diskread"`
+	DiskWrite uint64  `json:"diskwrite"`
+}
+
+// Creates a Proxmox manager if PROXMOX_TOKEN is set.
+//
+// The API is reached at PROXMOX_URL (default https://localhost:8006) for the node
+// PROXMOX_NODE (default the hostname). The token needs the VM.Audit privilege on
+// /vms, e.g. from the PVEAuditor role. The node's certificate is verified with
+// the cluster CA if it exists, and PROXMOX_INSECURE=true skips verification.
+func newProxmoxManager() *proxmoxManager {
+	token, _ := GetEnv("PROXMOX_TOKEN")
+	if token == "" {
+		return nil
+	}
+	apiURL, _ := GetEnv("PROXMOX_URL")
+	apiURL = cmp.Or(apiURL, "https://localhost:8006")
+	node, _ := GetEnv("PROXMOX_NODE")
+	if node == "" {
+		hostname, _ := os.Hostname()
+		node, _, _ = strings.Cut(hostname, ".")
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if insecure, _ := GetEnv("PROXMOX_INSECURE"); insecure == "true" {
+		tlsConfig.InsecureSkipVerify = true
+	} else if caPEM, err := os.ReadFile(proxmoxCAPath); err == nil {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pool.AppendCertsFromPEM(caPEM)
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	pm := &proxmoxManager{
+		client:  &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		url:     strings.TrimSuffix(apiURL, "/") + "/api2/json/nodes/" + url.PathEscape(node) + "/qemu",
+		token:   strings.TrimPrefix(token, "PVEAPIToken="),
+		vmStats: make(map[int]*container.Stats),
+	}
+	slog.Info("PROXMOX", "url", pm.url)
+	return pm
+}
+
+// Returns stats for all running virtual machines on the node, with rates over
+// the polling interval
+func (pm *proxmoxManager) getVMStats(interval uint16) ([]*container.Stats, error) {
+	req, err := http.NewRequest(http.MethodGet, pm.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "PVEAPIToken="+pm.token)
+	res, err := pm.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("proxmox returned %s: %w", res.Status, fs.ErrPermission)
+	case res.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("proxmox returned %s", res.Status)
+	}
+	var body struct {
+		Data []proxmoxVM `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	now := time.Now()
+	numCPU := float64(runtime.NumCPU())
+	validIds := make(map[int]struct{}, len(body.Data))
+	stats := make([]*container.Stats, 0, len(body.Data))
+	for _, vm := range body.Data {
+		if vm.Status != "running" {
+			continue
+		}
+		validIds[vm.VMID] = struct{}{}
+		vmStats, ok := pm.vmStats[vm.VMID]
+		if !ok {
+			vmStats = &container.Stats{}
+			pm.vmStats[vm.VMID] = vmStats
+		}
+		vmStats.Name = cmp.Or(vm.Name, strconv.Itoa(vm.VMID))
+		// cpu is a fraction of the vm's cpus, but container cpu is a percentage of the whole system
+		vmStats.Cpu = twoDecimals(vm.CPU * vm.CPUs / numCPU * 100)
+		vmStats.Mem = bytesToMegabytes(float64(vm.Mem))
+		vmStats.NetworkSent, vmStats.NetworkRecv, vmStats.DiskRead, vmStats.DiskWrite = 0, 0, 0, 0
+		// skipped on the first run and after counter resets when a vm restarts
+		counters := []uint64{vm.NetOut, vm.NetIn, vm.DiskRead, vm.DiskWrite}
+		if deltas, secondsElapsed, ok := pm.counters.deltas(interval, strconv.Itoa(vm.VMID), now, counters...); ok {
+			vmStats.NetworkSent = bytesToMegabytes(float64(deltas[0]) / secondsElapsed)
+			vmStats.NetworkRecv = bytesToMegabytes(float64(deltas[1]) / secondsElapsed)
+			vmStats.DiskRead = bytesToMegabytes(float64(deltas[2]) / secondsElapsed)
+			vmStats.DiskWrite = bytesToMegabytes(float64(deltas[3]) / secondsElapsed)
+		}
+		// copy so the next request doesn't change the data while it's sent
+		vmCopy := *vmStats
+		stats = append(stats, &vmCopy)
+	}
+	// remove vms that were stopped or deleted
+	for id := range pm.vmStats {
+		if _, ok := validIds[id]; !ok {
+			delete(pm.vmStats, id)
+		}
+	}
+	pm.counters.prune(now)
+	return stats, nil
+}
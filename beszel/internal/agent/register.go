@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Register registers the agent with the hub using an enrollment token
+// and returns the hub's public key. The hub creates the system if it doesn't
+// exist, so this is safe to call on every start. The secret the hub issues is
+// saved in the data dir and sent with later registrations, so the agent can
+// change its address or transport without an admin approving it.
+func Register(hubURL, token, addr string) ([]byte, error) {
+	pin, _ := GetEnv("HUB_CERT_FINGERPRINT")
+	client, err := newEnrollClient(hubURL, "", pin)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := GetEnv("SYSTEM_NAME")
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	// the hub falls back to the request's remote address if host is empty
+	host, _ := outboundIP(client.hub)
+	transport, _ := GetEnv("TRANSPORT")
+	fingerprint, err := getFingerprint()
+	if err != nil {
+		return nil, err
+	}
+	req := map[string]string{
+		"token":       token,
+		"name":        name,
+		"host":        host,
+		"port":        port,
+		"transport":   transport,
+		"fingerprint": fingerprint,
+		"secret":      readAgentSecret(),
+	}
+	var res struct {
+		Key    string `json:"key"`
+		Secret string `json:"secret"`
+		Status string `json:"status"`
+	}
+	if err := client.request(http.MethodPost, "/api/beszel/register", req, &res); err != nil {
+		return nil, err
+	}
+	if res.Secret != "" {
+		if err := saveAgentSecret(res.Secret); err != nil {
+			return nil, err
+		}
+	}
+	if res.Status == "pending" {
+		return nil, errors.New("system is registered with another address or transport, an admin must approve the change")
+	}
+	if res.Key == "" {
+		return nil, fmt.Errorf("hub returned empty key")
+	}
+	return []byte(res.Key), nil
+}
+
+// Returns the path of the secret the hub issued to the agent
+func agentSecretPath() string {
+	return filepath.Join(dataDir(), "secret")
+}
+
+// Returns the secret the hub issued to the agent, or an empty string if it has none
+func readAgentSecret() string {
+	data, err := os.ReadFile(agentSecretPath())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func saveAgentSecret(secret string) error {
+	path := agentSecretPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(secret+"\n"), 0600)
+}
@@ -0,0 +1,88 @@
+//go:build testing
+
+package agent
+
+import (
+	"beszel/internal/testutil/fakehub"
+	"strings"
+	"testing"
+)
+
+func TestRegisterWithFakeHub(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		pin     func(hub *fakehub.Hub) string
+		wantErr string
+	}{
+		{
+			name:  "valid token and pinned certificate",
+			token: "enroll-token",
+			pin:   (*fakehub.Hub).CertFingerprint,
+		},
+		{
+			name:    "invalid token",
+			token:   "wrong-token",
+			pin:     (*fakehub.Hub).CertFingerprint,
+			wantErr: "Invalid token",
+		},
+		{
+			name:    "other certificate",
+			token:   "enroll-token",
+			pin:     func(*fakehub.Hub) string { return strings.Repeat("ab", 32) },
+			wantErr: "doesn't match pinned fingerprint",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub, err := fakehub.New("enroll-token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer hub.Close()
+			t.Setenv("BESZEL_AGENT_HUB_CERT_FINGERPRINT", tt.pin(hub))
+			t.Setenv("BESZEL_AGENT_DATA_DIR", t.TempDir())
+			t.Setenv("BESZEL_AGENT_FINGERPRINT_SOURCE", fingerprintFile)
+			t.Setenv("BESZEL_AGENT_SYSTEM_NAME", "test-agent")
+
+			key, err := Register(hub.URL, tt.token, ":45876")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Register() error = %v, want %q", err, tt.wantErr)
+				}
+				if registrations := hub.Registrations(); len(registrations) != 0 {
+					t.Fatalf("hub accepted %d registrations, want 0", len(registrations))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(key) != strings.TrimSpace(string(hub.PublicKey)) {
+				t.Fatalf("Register() key = %q, want %q", key, hub.PublicKey)
+			}
+			registrations := hub.Registrations()
+			if len(registrations) != 1 {
+				t.Fatalf("hub received %d registrations, want 1", len(registrations))
+			}
+			fingerprint, err := getFingerprint()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r := registrations[0]; r.Name != "test-agent" || r.Port != "45876" || r.Host == "" || r.Fingerprint != fingerprint {
+				t.Fatalf("registration = %+v, want name test-agent, port 45876, a host and fingerprint %s", r, fingerprint)
+			}
+			// the secret issued at the first registration is sent with later ones
+			secret := readAgentSecret()
+			if secret == "" {
+				t.Fatal("secret issued by the hub wasn't saved")
+			}
+			if _, err := Register(hub.URL, tt.token, ":45876"); err != nil {
+				t.Fatal(err)
+			}
+			if r := hub.Registrations()[1]; r.Secret != secret {
+				t.Fatalf("second registration secret = %q, want %q", r.Secret, secret)
+			}
+		})
+	}
+}
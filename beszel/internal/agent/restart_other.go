@@ -0,0 +1,14 @@
+//go:build !windows
+
+package agent
+
+import (
+	"os"
+	"syscall"
+)
+
+// Replaces the running agent with the executable at path, keeping the same pid
+// so service managers like systemd don't notice the restart
+func restartAgent(path string) error {
+	return syscall.Exec(path, os.Args, os.Environ())
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package agent
+
+import (
+	"os"
+	"os/exec"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// Restarts the agent after updating. A service exits with an error so the
+// service manager's recovery actions start the updated executable.
+func restartAgent(path string) error {
+	if isService, _ := svc.IsWindowsService(); isService {
+		os.Exit(1)
+	}
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
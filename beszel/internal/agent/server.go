@@ -1,13 +1,22 @@
 package agent
 
 import (
+	"beszel/internal/entities/healthcheck"
+	"encoding/base64"
 	"encoding/json"
 	"log/slog"
 	"os"
+	"strconv"
 
 	sshServer "github.com/gliderlabs/ssh"
 )
 
+// Default and max number of processes returned by the processes command
+const (
+	defaultProcessCount = 10
+	maxProcessCount     = 50
+)
+
 func (a *Agent) startServer(pubKey []byte, addr string) {
 	sshServer.Handle(a.handleSession)
 
@@ -24,11 +33,66 @@ func (a *Agent) startServer(pubKey []byte, addr string) {
 }
 
 func (a *Agent) handleSession(s sshServer.Session) {
-	stats := a.gatherStats()
-	if err := json.NewEncoder(s).Encode(stats); err != nil {
-		slog.Error("Error encoding stats", "err", err, "stats", stats)
+	var data any
+	// sessions without a command request system stats
+	switch cmd := s.Command(); {
+	case len(cmd) > 0 && cmd[0] == "processes":
+		var n string
+		if len(cmd) > 1 {
+			n = cmd[1]
+		}
+		processes, err := getTopProcesses(processCount(n))
+		if err != nil {
+			slog.Error("Error getting processes", "err", err)
+			s.Exit(1)
+			return
+		}
+		data = processes
+	case len(cmd) > 0 && cmd[0] == "update":
+		var channel string
+		if len(cmd) > 1 {
+			channel = cmd[1]
+		}
+		data = a.handleUpdateRequest(channel)
+	case len(cmd) > 1 && cmd[0] == "check":
+		// hubs delegate checks of services they can't reach as base64 json
+		data = runCheck(cmd[1])
+	case len(cmd) > 2 && cmd[0] == "stats" && cmd[2] == "system":
+		// only system stats, for hubs polling more often than once a minute
+		data = a.gatherSystemStats(parseInterval(cmd[1]))
+	case len(cmd) > 1 && cmd[0] == "stats":
+		// hubs send their polling interval so rates are calculated over it
+		data = a.gatherStats(parseInterval(cmd[1]))
+	default:
+		data = a.gatherStats(0)
+	}
+	if err := json.NewEncoder(s).Encode(data); err != nil {
+		slog.Error("Error encoding stats", "err", err, "data", data)
 		s.Exit(1)
 		return
 	}
 	s.Exit(0)
 }
+
+// Runs a check sent by the hub as base64 encoded json
+func runCheck(encoded string) *healthcheck.Result {
+	var check healthcheck.Check
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err == nil {
+		err = json.Unmarshal(b, &check)
+	}
+	if err != nil {
+		return &healthcheck.Result{Status: healthcheck.StatusDown, Error: "invalid check: " + err.Error()}
+	}
+	result := check.Run()
+	slog.Debug("Check", "data", result)
+	return result
+}
+
+// Parses the number of processes to return, applying the default and max
+func processCount(s string) int {
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return min(n, maxProcessCount)
+	}
+	return defaultProcessCount
+}
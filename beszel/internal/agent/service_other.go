@@ -0,0 +1,22 @@
+//go:build !windows
+
+package agent
+
+import "errors"
+
+var errServiceUnsupported = errors.New("services can only be installed on Windows (use systemd on Linux)")
+
+// RunService returns false since Windows services aren't supported on this platform
+func RunService(run func()) bool {
+	return false
+}
+
+// InstallService is only supported on Windows
+func InstallService(args []string) error {
+	return errServiceUnsupported
+}
+
+// UninstallService is only supported on Windows
+func UninstallService() error {
+	return errServiceUnsupported
+}
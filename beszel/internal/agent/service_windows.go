@@ -0,0 +1,137 @@
+//go:build windows
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const serviceName = "beszel-agent"
+
+// agentService runs the agent under the Windows service control manager
+type agentService struct {
+	run func()
+}
+
+func (s *agentService) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	go s.run()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for req := range requests {
+		switch req.Cmd {
+		case svc.Interrogate:
+			changes <- req.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			changes <- svc.Status{State: svc.StopPending}
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// RunService runs the agent as a Windows service if the process was started by the
+// service control manager. Returns false if it wasn't.
+func RunService(run func()) bool {
+	if isService, err := svc.IsWindowsService(); err != nil || !isService {
+		return false
+	}
+	if err := svc.Run(serviceName, &agentService{run: run}); err != nil {
+		slog.Error("Service", "err", err)
+	}
+	return true
+}
+
+// InstallService registers the agent as a Windows service that starts automatically.
+// Arguments in the form KEY=VALUE are saved as environment variables of the service.
+func InstallService(args []string) error {
+	for _, arg := range args {
+		if key, _, ok := strings.Cut(arg, "="); !ok || key == "" {
+			return fmt.Errorf("invalid argument %q (expected KEY=VALUE)", arg)
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", serviceName)
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "Beszel Agent",
+		Description: "Collects system stats for the Beszel hub",
+		StartType:   mgr.StartAutomatic,
+	})
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	// restart after crashes, resetting the failure count after a day
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+	}, 86400); err != nil {
+		slog.Warn("Failed to set recovery actions", "err", err)
+	}
+	if len(args) > 0 {
+		key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+serviceName, registry.SET_VALUE)
+		if err != nil {
+			return err
+		}
+		defer key.Close()
+		if err := key.SetStringsValue("Environment", args); err != nil {
+			return err
+		}
+	}
+	if err := s.Start(); err != nil {
+		return err
+	}
+	fmt.Println("Installed and started service", serviceName)
+	return nil
+}
+
+// UninstallService stops and removes the Windows service
+func UninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+	if status, err := s.Control(svc.Stop); err == nil {
+		// wait for the service to stop so the executable can be replaced
+		for deadline := time.Now().Add(10 * time.Second); status.State != svc.Stopped && time.Now().Before(deadline); {
+			time.Sleep(300 * time.Millisecond)
+			if status, err = s.Query(); err != nil {
+				break
+			}
+		}
+	} else if !errors.Is(err, windows.ERROR_SERVICE_NOT_ACTIVE) {
+		slog.Warn("Failed to stop service", "err", err)
+	}
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	fmt.Println("Removed service", serviceName)
+	return nil
+}
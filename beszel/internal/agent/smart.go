@@ -0,0 +1,225 @@
+package agent
+
+import (
+	"beszel/internal/common"
+	"beszel/internal/entities/smart"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SmartManager manages S.M.A.R.T. data collection using smartctl
+type SmartManager struct {
+	SmartDataMap map[string]*smart.SmartData
+	devices      []smart.ScanDevice
+	interval     time.Duration
+	paused       atomic.Bool      // skips collection while the agent is throttled
+	errCode      common.ErrorCode // set if no device could be read in the last collection
+	mutex        sync.Mutex
+}
+
+// Errors returned by NewSmartManager
+var (
+	errSmartctlMissing = errors.New("smartctl not found")
+	errNoSmartDevices  = errors.New("no devices found")
+)
+
+// Attribute IDs of SATA reallocated / pending sector counts
+const (
+	ataReallocatedSectorCount = 5
+	ataCurrentPendingSector   = 197
+)
+
+// Scans for devices with smartctl and returns the ones to monitor.
+// Devices that are namespaces or paths of an already included controller are skipped.
+func (sm *SmartManager) scanDevices() error {
+	output, err := exec.Command("smartctl", "--scan", "-j").Output()
+	if err != nil {
+		return err
+	}
+	var scan smart.ScanOutput
+	if err := json.Unmarshal(output, &scan); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(scan.Devices))
+	devicesByName := make(map[string]smart.ScanDevice, len(scan.Devices))
+	for _, device := range scan.Devices {
+		name := filepath.Base(device.Name)
+		names = append(names, name)
+		devicesByName[name] = device
+	}
+	sm.devices = sm.devices[:0]
+	for _, dev := range physicalDevices(names) {
+		sm.devices = append(sm.devices, devicesByName[dev.Name])
+	}
+	if len(sm.devices) == 0 {
+		return errNoSmartDevices
+	}
+	slog.Debug("smartctl", "devices", sm.devices)
+	return nil
+}
+
+// Collects SMART data for all devices and updates the SmartDataMap.
+// Drives with a serial number already seen through another path are ignored.
+func (sm *SmartManager) collect() {
+	serials := make(map[string]struct{}, len(sm.devices))
+	data := make(map[string]*smart.SmartData, len(sm.devices))
+	for _, device := range sm.devices {
+		smartData, err := collectSmartData(device)
+		if err != nil {
+			slog.Debug("smartctl", "device", device.Name, "err", err)
+			continue
+		}
+		if smartData.SerialNumber != "" {
+			if _, ok := serials[smartData.SerialNumber]; ok {
+				continue
+			}
+			serials[smartData.SerialNumber] = struct{}{}
+		}
+		data[smartData.DiskName] = smartData
+	}
+	// smartctl needs root (or CAP_SYS_RAWIO) to open devices
+	var errCode common.ErrorCode
+	if len(data) == 0 && len(sm.devices) > 0 {
+		errCode = common.ErrCollectionFailed
+		if os.Geteuid() != 0 {
+			errCode = common.ErrPermissionDenied
+		}
+	}
+	sm.mutex.Lock()
+	sm.SmartDataMap = data
+	sm.errCode = errCode
+	sm.mutex.Unlock()
+}
+
+// Returns the error code of the last collection, if any
+func (sm *SmartManager) errorCode() common.ErrorCode {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	return sm.errCode
+}
+
+// Runs smartctl for a single device and parses the output
+func collectSmartData(device smart.ScanDevice) (*smart.SmartData, error) {
+	args := []string{"-a", "-j", "-n", "standby"}
+	if device.Type != "" {
+		args = append(args, "-d", device.Type)
+	}
+	args = append(args, device.Name)
+	// smartctl sets exit status bits for drive problems, so check the output instead of the error
+	output, _ := exec.Command("smartctl", args...).Output()
+	if len(output) == 0 {
+		return nil, fmt.Errorf("no output")
+	}
+	var out smart.SmartctlOutput
+	if err := json.Unmarshal(output, &out); err != nil {
+		return nil, err
+	}
+	// bits 0 and 1 mean the command failed or the device could not be opened
+	if out.Smartctl.ExitStatus&0b11 != 0 {
+		return nil, fmt.Errorf("smartctl exit status %d", out.Smartctl.ExitStatus)
+	}
+	return parseSmartData(device, &out), nil
+}
+
+// Converts smartctl output for NVMe, SATA, or SCSI devices into SmartData
+func parseSmartData(device smart.ScanDevice, out *smart.SmartctlOutput) *smart.SmartData {
+	data := &smart.SmartData{
+		DiskName:        device.Name,
+		DiskType:        device.Type,
+		ModelName:       out.ModelName,
+		SerialNumber:    out.SerialNumber,
+		FirmwareVersion: out.FirmwareVersion,
+		Capacity:        out.UserCapacity.Bytes,
+		SmartStatus:     smart.StatusUnknown,
+		Temperature:     out.Temperature.Current,
+		PowerOnHours:    out.PowerOnTime.Hours,
+		PowerCycles:     out.PowerCycleCount,
+	}
+	if data.ModelName == "" {
+		data.ModelName = out.ScsiModelName
+	}
+	if out.SmartStatus != nil {
+		if out.SmartStatus.Passed {
+			data.SmartStatus = smart.StatusPassed
+		} else {
+			data.SmartStatus = smart.StatusFailed
+		}
+	}
+	switch {
+	case out.NvmeSmartHealthInformationLog != nil:
+		nvme := out.NvmeSmartHealthInformationLog
+		if data.Temperature == 0 {
+			data.Temperature = nvme.Temperature
+		}
+		data.MediaErrors = nvme.MediaErrors
+		data.PercentageUsed = nvme.PercentageUsed
+		if data.PowerOnHours == 0 {
+			data.PowerOnHours = nvme.PowerOnHours
+		}
+		if data.PowerCycles == 0 {
+			data.PowerCycles = nvme.PowerCycles
+		}
+	case len(out.AtaSmartAttributes.Table) > 0:
+		for _, attr := range out.AtaSmartAttributes.Table {
+			switch attr.ID {
+			case ataReallocatedSectorCount, ataCurrentPendingSector:
+				data.ReallocatedSectors += attr.Raw.Value
+			}
+		}
+	default:
+		data.ReallocatedSectors = out.ScsiGrownDefectList
+	}
+	return data
+}
+
+// Collects data on an interval since smartctl is too slow to run on every request
+func (sm *SmartManager) start() {
+	for {
+		if !sm.paused.Load() {
+			sm.collect()
+		}
+		time.Sleep(sm.interval)
+	}
+}
+
+// Returns a copy of the most recent SMART data keyed by device name
+func (sm *SmartManager) GetCurrentData() map[string]smart.SmartData {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	data := make(map[string]smart.SmartData, len(sm.SmartDataMap))
+	for name, d := range sm.SmartDataMap {
+		data[name] = *d
+	}
+	return data
+}
+
+// NewSmartManager creates and starts a new SmartManager if smartctl is available
+func NewSmartManager() (*SmartManager, error) {
+	if _, err := exec.LookPath("smartctl"); err != nil {
+		return nil, errSmartctlMissing
+	}
+	sm := &SmartManager{
+		SmartDataMap: make(map[string]*smart.SmartData),
+		interval:     time.Hour,
+	}
+	if interval, exists := GetEnv("SMART_INTERVAL"); exists {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, err
+		}
+		sm.interval = d
+	}
+	if err := sm.scanDevices(); err != nil {
+		return nil, err
+	}
+	go sm.start()
+	return sm, nil
+}
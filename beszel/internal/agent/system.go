@@ -4,9 +4,13 @@ import (
 	"beszel"
 	"beszel/internal/entities/system"
 	"bufio"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -14,14 +18,15 @@ import (
 	"github.com/shirou/gopsutil/v4/cpu"
 	"github.com/shirou/gopsutil/v4/disk"
 	"github.com/shirou/gopsutil/v4/host"
+	"github.com/shirou/gopsutil/v4/load"
 	"github.com/shirou/gopsutil/v4/mem"
 	psutilNet "github.com/shirou/gopsutil/v4/net"
-	"github.com/shirou/gopsutil/v4/sensors"
 )
 
 // Sets initial / non-changing values about the host system
 func (a *Agent) initializeSystemInfo() {
 	a.systemInfo.AgentVersion = beszel.Version
+	a.systemInfo.Os = runtime.GOOS
 	a.systemInfo.Hostname, _ = os.Hostname()
 	a.systemInfo.KernelVersion, _ = host.KernelVersion()
 
@@ -40,6 +45,17 @@ func (a *Agent) initializeSystemInfo() {
 		}
 	}
 
+	// initial cpu times, so the first request has a cpu percent
+	if times, err := cpuTimes(); err == nil {
+		a.counters.reset("cpu", time.Now(), times...)
+	}
+	if times, err := a.cpuCoreTimes(); err == nil {
+		a.counters.reset("cpu cores", time.Now(), times...)
+	}
+	if totals, err := readPressure(); err == nil {
+		a.counters.reset("pressure", time.Now(), totals...)
+	}
+
 	// zfs
 	if _, err := getARCSize(); err == nil {
 		a.zfs = true
@@ -48,16 +64,80 @@ func (a *Agent) initializeSystemInfo() {
 	}
 }
 
-// Returns current info, stats about the host system
-func (a *Agent) getSystemStats() system.Stats {
+// Returns current info, stats about the host system. Rates are calculated over
+// the polling interval in seconds.
+func (a *Agent) getSystemStats(interval uint16) system.Stats {
 	systemStats := system.Stats{}
 
 	// cpu percent
-	cpuPct, err := cpu.Percent(0, false)
-	if err != nil {
+	if times, err := cpuTimes(); err != nil {
 		slog.Error("Error getting cpu percent", "err", err)
-	} else if len(cpuPct) > 0 {
-		systemStats.Cpu = twoDecimals(cpuPct[0])
+		systemStats.Missing = append(systemStats.Missing, system.StatsCpu)
+	} else if deltas, _, ok := a.counters.deltas(interval, "cpu", time.Now(), times...); ok && deltas[0] > 0 {
+		percent := func(delta uint64) float64 {
+			return twoDecimals(min(float64(delta)/float64(deltas[0])*100, 100))
+		}
+		systemStats.Cpu = percent(deltas[1])
+		systemStats.CpuUser = percent(deltas[2])
+		systemStats.CpuSystem = percent(deltas[3])
+		systemStats.CpuIowait = percent(deltas[4])
+		systemStats.CpuSteal = percent(deltas[5])
+	}
+	// usage of each logical cpu in whole percent (if enabled), skipped if cpus were added or removed
+	if times, err := a.cpuCoreTimes(); err == nil && !systemStats.IsMissing(system.StatsCpu) {
+		if deltas, _, ok := a.counters.deltas(interval, "cpu cores", time.Now(), times...); ok {
+			systemStats.CpuCores = make([]float64, len(deltas)/2)
+			for i := range systemStats.CpuCores {
+				if total := deltas[i*2]; total > 0 {
+					systemStats.CpuCores[i] = math.Round(min(float64(deltas[i*2+1])/float64(total)*100, 100))
+				}
+			}
+		}
+	}
+
+	// load average
+	if avg, err := load.Avg(); err == nil {
+		systemStats.LoadAvg1 = twoDecimals(avg.Load1)
+		systemStats.LoadAvg5 = twoDecimals(avg.Load5)
+		systemStats.LoadAvg15 = twoDecimals(avg.Load15)
+	} else {
+		slog.Debug("Error getting load average", "err", err)
+		systemStats.Missing = append(systemStats.Missing, system.StatsLoad)
+	}
+
+	// open file descriptors and entropy (linux only)
+	if runtime.GOOS == "linux" {
+		if used, limit, err := readFileNr(); err == nil {
+			systemStats.Fds = used
+			systemStats.FdMax = limit
+			systemStats.FdProcPct = maxProcessFdPct()
+		} else {
+			slog.Debug("Error getting file descriptors", "err", err)
+			systemStats.Missing = append(systemStats.Missing, system.StatsFd)
+		}
+		// entropy is constant on kernels 5.18+, which don't block on low entropy
+		if entropy, err := strconv.ParseFloat(readSysValue(filepath.Join(procPath, "sys/kernel/random/entropy_avail")), 64); err == nil {
+			systemStats.Entropy = entropy
+			systemStats.EntropyPool, _ = strconv.ParseFloat(readSysValue(filepath.Join(procPath, "sys/kernel/random/poolsize")), 64)
+		}
+		// pressure stall information over the interval, from the total stall time in microseconds
+		if totals, err := readPressure(); err == nil {
+			if deltas, secondsElapsed, ok := a.counters.deltas(interval, "pressure", time.Now(), totals...); ok {
+				percent := func(stalled uint64) float64 {
+					return twoDecimals(min(float64(stalled)/(secondsElapsed*1e4), 100))
+				}
+				systemStats.Pressure = &system.Pressure{
+					CpuSome: percent(deltas[0]),
+					MemSome: percent(deltas[2]),
+					MemFull: percent(deltas[3]),
+					IoSome:  percent(deltas[4]),
+					IoFull:  percent(deltas[5]),
+				}
+			}
+		} else if !errors.Is(err, errors.ErrUnsupported) {
+			slog.Debug("Error getting pressure", "err", err)
+			systemStats.Missing = append(systemStats.Missing, system.StatsPsi)
+		}
 	}
 
 	// memory
@@ -86,6 +166,12 @@ func (a *Agent) getSystemStats() system.Stats {
 		systemStats.MemBuffCache = bytesToGigabytes(cacheBuff)
 		systemStats.MemUsed = bytesToGigabytes(v.Used)
 		systemStats.MemPct = twoDecimals(v.UsedPercent)
+		systemStats.MemAvailable = bytesToGigabytes(v.Available)
+		systemStats.HugePages = bytesToGigabytes(v.HugePagesTotal * v.HugePageSize)
+		systemStats.HugePagesUsed = bytesToGigabytes((v.HugePagesTotal - v.HugePagesFree) * v.HugePageSize)
+	} else {
+		slog.Error("Error getting memory stats", "err", err)
+		systemStats.Missing = append(systemStats.Missing, system.StatsMem)
 	}
 
 	// disk usage
@@ -101,46 +187,57 @@ func (a *Agent) getSystemStats() system.Stats {
 		} else {
 			// reset stats if error (likely unmounted)
 			slog.Error("Error getting disk stats", "name", stats.Mountpoint, "err", err)
+			if stats.Root {
+				systemStats.Missing = append(systemStats.Missing, system.StatsDisk)
+			}
 			stats.DiskTotal = 0
 			stats.DiskUsed = 0
-			stats.TotalRead = 0
-			stats.TotalWrite = 0
 		}
 	}
 
 	// disk i/o
-	if ioCounters, err := disk.IOCounters(a.fsNames...); err == nil {
+	if ioCounters, err := disk.IOCounters(); err == nil {
+		updateIoCounters(ioCounters)
+		now := time.Now()
+		systemStats.DiskIo = a.getDiskDeviceStats(interval, ioCounters, now)
 		for _, d := range ioCounters {
 			stats := a.fsStats[d.Name]
 			if stats == nil {
 				continue
 			}
-			secondsElapsed := time.Since(stats.Time).Seconds()
-			readPerSecond := bytesToMegabytes(float64(d.ReadBytes-stats.TotalRead) / secondsElapsed)
-			writePerSecond := bytesToMegabytes(float64(d.WriteBytes-stats.TotalWrite) / secondsElapsed)
-			// check for invalid values and reset stats if so
-			if readPerSecond < 0 || writePerSecond < 0 || readPerSecond > 50_000 || writePerSecond > 50_000 {
-				slog.Warn("Invalid disk I/O. Resetting.", "name", d.Name, "read", readPerSecond, "write", writePerSecond)
-				a.initializeDiskIoStats(ioCounters)
-				break
+			stats.DiskReadPs, stats.DiskWritePs, stats.ReadLatency, stats.WriteLatency = 0, 0, 0, 0
+			stats.QueueLength = float64(d.IopsInProgress)
+			if deltas, secondsElapsed, ok := a.counters.deltas(interval, diskCounterName(d.Name), now, diskCounterValues(d)...); ok {
+				readPerSecond := bytesToMegabytes(float64(deltas[0]) / secondsElapsed)
+				writePerSecond := bytesToMegabytes(float64(deltas[1]) / secondsElapsed)
+				// check for invalid values and reset stats if so
+				if readPerSecond > 50_000 || writePerSecond > 50_000 {
+					slog.Warn("Invalid disk I/O. Resetting.", "name", d.Name, "read", readPerSecond, "write", writePerSecond)
+					a.initializeDiskIoStats(ioCounters)
+					systemStats.Missing = append(systemStats.Missing, system.StatsDiskIO)
+					break
+				}
+				stats.DiskReadPs = readPerSecond
+				stats.DiskWritePs = writePerSecond
+				stats.ReadLatency = ioLatency(deltas[4], deltas[2])
+				stats.WriteLatency = ioLatency(deltas[5], deltas[3])
 			}
-			stats.Time = time.Now()
-			stats.DiskReadPs = readPerSecond
-			stats.DiskWritePs = writePerSecond
-			stats.TotalRead = d.ReadBytes
-			stats.TotalWrite = d.WriteBytes
 			// if root filesystem, update system stats
 			if stats.Root {
 				systemStats.DiskReadPs = stats.DiskReadPs
 				systemStats.DiskWritePs = stats.DiskWritePs
+				systemStats.DiskReadLat = stats.ReadLatency
+				systemStats.DiskWriteLat = stats.WriteLatency
+				systemStats.DiskQueue = stats.QueueLength
 			}
 		}
+	} else {
+		slog.Error("Error getting disk I/O", "err", err)
+		systemStats.Missing = append(systemStats.Missing, system.StatsDiskIO)
 	}
 
 	// network stats
 	if netIO, err := psutilNet.IOCounters(true); err == nil {
-		secondsElapsed := time.Since(a.netIoStats.Time).Seconds()
-		a.netIoStats.Time = time.Now()
 		bytesSent := uint64(0)
 		bytesRecv := uint64(0)
 		// sum all bytes sent and received
@@ -153,10 +250,11 @@ func (a *Agent) getSystemStats() system.Stats {
 			bytesRecv += v.BytesRecv
 		}
 		// add to systemStats
-		sentPerSecond := float64(bytesSent-a.netIoStats.BytesSent) / secondsElapsed
-		recvPerSecond := float64(bytesRecv-a.netIoStats.BytesRecv) / secondsElapsed
-		networkSentPs := bytesToMegabytes(sentPerSecond)
-		networkRecvPs := bytesToMegabytes(recvPerSecond)
+		var networkSentPs, networkRecvPs float64
+		if deltas, secondsElapsed, ok := a.counters.deltas(interval, "net", time.Now(), bytesSent, bytesRecv); ok {
+			networkSentPs = bytesToMegabytes(float64(deltas[0]) / secondsElapsed)
+			networkRecvPs = bytesToMegabytes(float64(deltas[1]) / secondsElapsed)
+		}
 		// add check for issue (#150) where sent is a massive number
 		if networkSentPs > 10_000 || networkRecvPs > 10_000 {
 			slog.Warn("Invalid net stats. Resetting.", "sent", networkSentPs, "recv", networkRecvPs)
@@ -168,52 +266,80 @@ func (a *Agent) getSystemStats() system.Stats {
 			}
 			// reset network I/O stats
 			a.initializeNetIoStats()
+			systemStats.Missing = append(systemStats.Missing, system.StatsNet)
 		} else {
 			systemStats.NetworkSent = networkSentPs
 			systemStats.NetworkRecv = networkRecvPs
-			// update netIoStats
-			a.netIoStats.BytesSent = bytesSent
-			a.netIoStats.BytesRecv = bytesRecv
+			systemStats.Nics = a.getNicStats(interval, netIO, time.Now())
 		}
+	} else {
+		slog.Error("Error getting network I/O", "err", err)
+		systemStats.Missing = append(systemStats.Missing, system.StatsNet)
 	}
 
 	// temperatures (skip if sensors whitelist is set to empty string)
 	if a.sensorsWhitelist != nil && len(a.sensorsWhitelist) == 0 {
 		slog.Debug("Skipping temperature collection")
 	} else {
-		temps, err := sensors.TemperaturesWithContext(a.sensorsContext)
+		temps, err := a.getTemperatures()
 		if err != nil {
 			slog.Debug("Sensor error", "err", err)
 		}
 		slog.Debug("Temperature", "sensors", temps)
-		if len(temps) > 0 {
-			systemStats.Temperatures = make(map[string]float64, len(temps))
-			for i, sensor := range temps {
-				// skip if temperature is 0
-				if sensor.Temperature <= 0 || sensor.Temperature >= 200 {
-					continue
-				}
-				if _, ok := systemStats.Temperatures[sensor.SensorKey]; ok {
-					// if key already exists, append int to key
-					systemStats.Temperatures[sensor.SensorKey+"_"+strconv.Itoa(i)] = twoDecimals(sensor.Temperature)
-				} else {
-					systemStats.Temperatures[sensor.SensorKey] = twoDecimals(sensor.Temperature)
+		systemStats.Temperatures = make(map[string]float64, len(temps))
+		for i, sensor := range temps {
+			// skip if temperature is 0
+			if sensor.Temperature <= 0 || sensor.Temperature >= 200 {
+				continue
+			}
+			if _, ok := systemStats.Temperatures[sensor.SensorKey]; ok {
+				// if key already exists, append int to key
+				systemStats.Temperatures[sensor.SensorKey+"_"+strconv.Itoa(i)] = twoDecimals(sensor.Temperature)
+			} else {
+				systemStats.Temperatures[sensor.SensorKey] = twoDecimals(sensor.Temperature)
+			}
+		}
+		// add drive temperatures (windows only)
+		a.addDiskTemperatures(systemStats.Temperatures)
+		// remove sensors from systemStats if whitelist exists and sensor is not in whitelist
+		// (do this here instead of in initial loop so we have correct keys if int was appended)
+		if a.sensorsWhitelist != nil {
+			for key := range systemStats.Temperatures {
+				if _, nameInWhitelist := a.sensorsWhitelist[key]; !nameInWhitelist {
+					delete(systemStats.Temperatures, key)
 				}
 			}
-			// remove sensors from systemStats if whitelist exists and sensor is not in whitelist
-			// (do this here instead of in initial loop so we have correct keys if int was appended)
+		}
+		if len(systemStats.Temperatures) == 0 {
+			systemStats.Temperatures = nil
+		}
+	}
+
+	// voltages (linux only, skipped like temperatures if the sensors whitelist is empty)
+	if a.sensorsWhitelist == nil || len(a.sensorsWhitelist) > 0 {
+		voltages, err := a.getVoltages()
+		if err != nil {
+			slog.Debug("Voltage error", "err", err)
+		}
+		for _, sensor := range voltages {
+			// skip unconnected inputs
+			if sensor.value <= 0 {
+				continue
+			}
 			if a.sensorsWhitelist != nil {
-				for key := range systemStats.Temperatures {
-					if _, nameInWhitelist := a.sensorsWhitelist[key]; !nameInWhitelist {
-						delete(systemStats.Temperatures, key)
-					}
+				if _, nameInWhitelist := a.sensorsWhitelist[sensor.key]; !nameInWhitelist {
+					continue
 				}
 			}
+			if systemStats.Voltages == nil {
+				systemStats.Voltages = make(map[string]float64, len(voltages))
+			}
+			systemStats.Voltages[sensor.key] = twoDecimals(sensor.value)
 		}
 	}
 
 	// GPU data
-	if a.gpuManager != nil {
+	if a.gpuManager != nil && moduleEnabled("gpu") {
 		if gpuData := a.gpuManager.GetCurrentData(); len(gpuData) > 0 {
 			systemStats.GPUData = gpuData
 			// add temperatures
@@ -231,14 +357,98 @@ func (a *Agent) getSystemStats() system.Stats {
 	// update base system info
 	a.systemInfo.Cpu = systemStats.Cpu
 	a.systemInfo.MemPct = systemStats.MemPct
+	a.systemInfo.SwapPct = 0
+	if systemStats.Swap > 0 {
+		a.systemInfo.SwapPct = twoDecimals(systemStats.SwapUsed / systemStats.Swap * 100)
+	}
 	a.systemInfo.DiskPct = systemStats.DiskPct
+	a.systemInfo.LoadAvg1 = systemStats.LoadAvg1
+	a.systemInfo.LoadAvg5 = systemStats.LoadAvg5
+	a.systemInfo.LoadAvg15 = systemStats.LoadAvg15
+	a.systemInfo.Entropy = nil
+	if systemStats.EntropyPool > 0 {
+		a.systemInfo.Entropy = &systemStats.Entropy
+	}
+	a.systemInfo.FdPct = systemStats.FdProcPct
+	if systemStats.FdMax > 0 {
+		a.systemInfo.FdPct = twoDecimals(max(systemStats.Fds/systemStats.FdMax*100, systemStats.FdProcPct))
+	}
 	a.systemInfo.Uptime, _ = host.Uptime()
 	a.systemInfo.Bandwidth = twoDecimals(systemStats.NetworkSent + systemStats.NetworkRecv)
+	a.systemInfo.NetUtil = 0
+	for _, nic := range systemStats.Nics {
+		a.systemInfo.NetUtil = max(a.systemInfo.NetUtil, nic.Util)
+	}
 	slog.Debug("sysinfo", "data", a.systemInfo)
 
 	return systemStats
 }
 
+// Returns the total, busy, user, system, iowait and steal cpu time of all cpus
+// in milliseconds. Total and busy time match the calculation of cpu.Percent.
+func cpuTimes() ([]uint64, error) {
+	times, err := cpu.Times(false)
+	if err != nil {
+		return nil, err
+	}
+	if len(times) == 0 {
+		return nil, errors.New("no cpu times")
+	}
+	t := times[0]
+	total, busy := cpuTimesMs(t)
+	user := t.User + t.Nice
+	if runtime.GOOS == "linux" {
+		user -= t.Guest + t.GuestNice
+	}
+	return []uint64{
+		total,
+		busy,
+		uint64(max(user, 0) * 1000),
+		uint64((t.System + t.Irq + t.Softirq) * 1000),
+		uint64(t.Iowait * 1000),
+		uint64(t.Steal * 1000),
+	}, nil
+}
+
+// Returns the total and busy cpu time of each logical cpu in milliseconds,
+// as consecutive pairs. Returns an error if CPU_CORES isn't enabled.
+func (a *Agent) cpuCoreTimes() ([]uint64, error) {
+	if !a.cpuCores {
+		return nil, errors.New("cpu cores not enabled")
+	}
+	times, err := cpu.Times(true)
+	if err != nil {
+		return nil, err
+	}
+	if len(times) == 0 {
+		return nil, errors.New("no cpu times")
+	}
+	values := make([]uint64, 0, len(times)*2)
+	for _, t := range times {
+		total, busy := cpuTimesMs(t)
+		values = append(values, total, busy)
+	}
+	return values, nil
+}
+
+// Converts cpu times to total and busy time in milliseconds
+func cpuTimesMs(t cpu.TimesStat) (total, busy uint64) {
+	all := t.Total()
+	if runtime.GOOS == "linux" {
+		// guest time is also counted in user time
+		all -= t.Guest + t.GuestNice
+	}
+	return uint64(all * 1000), uint64((all - t.Idle - t.Iowait) * 1000)
+}
+
+// Returns the average time in milliseconds of I/O operations completed since the last update
+func ioLatency(timeDelta, opsDelta uint64) float64 {
+	if opsDelta == 0 || timeDelta > 1<<63 {
+		return 0
+	}
+	return twoDecimals(float64(timeDelta) / float64(opsDelta))
+}
+
 // Returns the size of the ZFS ARC memory cache in bytes
 func getARCSize() (uint64, error) {
 	file, err := os.Open("/proc/spl/kstat/zfs/arcstats")
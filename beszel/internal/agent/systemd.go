@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"beszel/internal/entities/systemd"
+	"bufio"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Location of the systemd system.slice cgroup (cgroup v2)
+var systemSliceCgroup = "/sys/fs/cgroup/system.slice"
+
+type systemdManager struct {
+	patterns []string                    // Unit name patterns to monitor (all services if empty)
+	services map[string]*systemd.Service // Keeps track of service stats
+	counters counterTracker              // Previous cpu usage of services for each polling interval
+}
+
+// Returns state and resource usage for monitored services, with cpu usage over
+// the polling interval. Inactive services are skipped unless they failed.
+func (sm *systemdManager) getServiceStats(interval uint16) ([]*systemd.Service, error) {
+	output, err := exec.Command("systemctl", "list-units", "--type=service", "--all",
+		"--no-legend", "--no-pager", "--plain").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	valid := make(map[string]struct{}, len(sm.services))
+	stats := make([]*systemd.Service, 0, len(sm.services))
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		// Example line: nginx.service loaded active running A high performance web server
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[1] != "loaded" {
+			continue
+		}
+		name, state, sub := fields[0], fields[2], fields[3]
+		if state == "inactive" || !sm.isMonitored(name) {
+			continue
+		}
+		service, ok := sm.services[name]
+		if !ok {
+			service = &systemd.Service{Name: name}
+			sm.services[name] = service
+		}
+		service.State = state
+		service.Sub = sub
+		sm.updateResourceUsage(service, interval)
+		valid[name] = struct{}{}
+		// copy so the next request doesn't change the data while it's sent
+		serviceStats := *service
+		stats = append(stats, &serviceStats)
+	}
+
+	// remove services that no longer exist
+	for name := range sm.services {
+		if _, ok := valid[name]; !ok {
+			delete(sm.services, name)
+		}
+	}
+	sm.counters.prune(time.Now())
+
+	return stats, nil
+}
+
+// Returns true if the unit name matches a pattern in SERVICES, or if no patterns are set
+func (sm *systemdManager) isMonitored(name string) bool {
+	if len(sm.patterns) == 0 {
+		return true
+	}
+	for _, pattern := range sm.patterns {
+		if match, _ := filepath.Match(pattern, name); match {
+			return true
+		}
+	}
+	return false
+}
+
+// Reads cpu and memory usage of a service from its cgroup
+func (sm *systemdManager) updateResourceUsage(service *systemd.Service, interval uint16) {
+	cgroupPath := filepath.Join(systemSliceCgroup, service.Name)
+	service.Cpu = 0
+	service.Mem = 0
+
+	if memory, err := readCgroupValue(filepath.Join(cgroupPath, "memory.current"), ""); err == nil {
+		service.Mem = bytesToMegabytes(float64(memory))
+	}
+
+	cpuUsage, err := readCgroupValue(filepath.Join(cgroupPath, "cpu.stat"), "usage_usec")
+	if err != nil {
+		return
+	}
+	// cpu usage is in microseconds
+	if deltas, secondsElapsed, ok := sm.counters.deltas(interval, service.Name, time.Now(), cpuUsage); ok {
+		service.Cpu = twoDecimals(float64(deltas[0]) / (secondsElapsed * 1e6 * float64(runtime.NumCPU())) * 100)
+	}
+}
+
+// Reads a value from a cgroup file. If key is set, reads the value of the
+// matching "key value" line, otherwise the file is expected to contain a single value.
+func readCgroupValue(path, key string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if key == "" {
+		return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, found := strings.CutPrefix(line, key+" "); found {
+			return strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("%s not found in %s", key, path)
+}
+
+// Creates a new systemd manager if the system is running systemd
+func newSystemdManager() (*systemdManager, error) {
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		return nil, fmt.Errorf("systemd not running")
+	}
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return nil, err
+	}
+	sm := &systemdManager{
+		services: make(map[string]*systemd.Service),
+	}
+	if services, exists := GetEnv("SERVICES"); exists {
+		// skip service monitoring if SERVICES is set to an empty string
+		if services == "" {
+			return nil, fmt.Errorf("service monitoring disabled")
+		}
+		for _, pattern := range strings.Split(services, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				if !strings.Contains(pattern, ".") {
+					pattern += ".service"
+				}
+				sm.patterns = append(sm.patterns, pattern)
+			}
+		}
+		slog.Info("SERVICES", "patterns", sm.patterns)
+	}
+	return sm, nil
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Throttle modes reported to the hub
+const (
+	throttleBattery = "battery"
+	throttleThermal = "thermal"
+)
+
+// throttleManager reduces collection while the host is on battery or under thermal pressure
+type throttleManager struct {
+	maxTemp       float64             // temperature that counts as thermal pressure (0 = only use kernel throttle events)
+	interval      time.Duration       // minimum time between full collections while throttled
+	throttleCount uint64              // last total of cpu thermal throttle events
+	lastData      system.CombinedData // data returned while waiting for the next collection
+	lastTime      time.Time
+	thermalUntil  time.Time // end of the thermal pressure from the last throttle events
+}
+
+// Returns the current throttle mode, or an empty string if not throttled
+func (tm *throttleManager) updateMode() string {
+	if onBattery() {
+		return throttleBattery
+	}
+	// new kernel throttle events since the last check count for an interval, so
+	// they aren't missed by full collections when fast polls check more often
+	if count := cpuThrottleCount(); count > tm.throttleCount {
+		tm.throttleCount = count
+		tm.thermalUntil = time.Now().Add(tm.interval)
+	}
+	if time.Now().Before(tm.thermalUntil) {
+		return throttleThermal
+	}
+	if tm.maxTemp > 0 {
+		for _, temp := range tm.lastData.Stats.Temperatures {
+			if temp >= tm.maxTemp {
+				return throttleThermal
+			}
+		}
+	}
+	return ""
+}
+
+// Returns true if the host is running on battery power
+func onBattery() bool {
+	supplies, _ := filepath.Glob("/sys/class/power_supply/*")
+	discharging := false
+	for _, supply := range supplies {
+		switch readSysValue(filepath.Join(supply, "type")) {
+		case "Mains", "USB":
+			if readSysValue(filepath.Join(supply, "online")) == "1" {
+				return false
+			}
+		case "Battery":
+			if readSysValue(filepath.Join(supply, "status")) == "Discharging" {
+				discharging = true
+			}
+		}
+	}
+	return discharging
+}
+
+// Returns the total number of cpu thermal throttle events since boot
+func cpuThrottleCount() uint64 {
+	files, _ := filepath.Glob("/sys/devices/system/cpu/cpu*/thermal_throttle/package_throttle_count")
+	var total uint64
+	for _, file := range files {
+		count, _ := strconv.ParseUint(readSysValue(file), 10, 64)
+		total += count
+	}
+	return total
+}
+
+func readSysValue(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Creates a throttleManager unless disabled with THROTTLE=false.
+//
+// THROTTLE_TEMP sets a temperature (°C) that also counts as thermal pressure and
+// THROTTLE_INTERVAL the minimum time between collections while throttled (default 5m).
+func newThrottleManager() (*throttleManager, error) {
+	if enabled, _ := GetEnv("THROTTLE"); enabled == "false" {
+		return nil, nil
+	}
+	tm := &throttleManager{interval: 5 * time.Minute}
+	if maxTemp, exists := GetEnv("THROTTLE_TEMP"); exists {
+		temp, err := strconv.ParseFloat(maxTemp, 64)
+		if err != nil {
+			return nil, err
+		}
+		tm.maxTemp = temp
+	}
+	if interval, exists := GetEnv("THROTTLE_INTERVAL"); exists {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, err
+		}
+		tm.interval = d
+	}
+	tm.throttleCount = cpuThrottleCount()
+	slog.Debug("Throttle", "temp", tm.maxTemp, "interval", tm.interval)
+	return tm, nil
+}
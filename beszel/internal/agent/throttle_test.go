@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"testing"
+	"time"
+)
+
+func TestGatherSystemStatsThrottled(t *testing.T) {
+	if onBattery() {
+		t.Skip("host is on battery")
+	}
+	lastData := system.CombinedData{
+		Stats: system.Stats{Cpu: 12.5, Temperatures: map[string]float64{"cpu": 90}},
+		Info:  system.Info{Hostname: "host"},
+	}
+	tests := []struct {
+		name string
+		tm   *throttleManager
+	}{
+		{
+			name: "temperature above THROTTLE_TEMP",
+			tm:   &throttleManager{maxTemp: 80, interval: time.Minute, lastData: lastData},
+		},
+		{
+			name: "recent throttle events",
+			tm:   &throttleManager{interval: time.Minute, lastData: lastData, thermalUntil: time.Now().Add(time.Minute)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// counts of throttle events on this host aren't new to the manager
+			tt.tm.throttleCount = cpuThrottleCount()
+			a := &Agent{throttleManager: tt.tm, fingerprint: "fp"}
+			data := a.gatherSystemStats(10)
+			if data.Info.Throttled != throttleThermal {
+				t.Fatalf("Info.Throttled = %q, want %q", data.Info.Throttled, throttleThermal)
+			}
+			if data.Stats.Cpu != lastData.Stats.Cpu || data.Info.Hostname != lastData.Info.Hostname || data.Fingerprint != "fp" {
+				t.Fatalf("gatherSystemStats() = %+v, want last data", data)
+			}
+			if tt.tm.lastData.Info.Throttled != "" {
+				t.Fatal("last data was changed")
+			}
+		})
+	}
+}
+
+func TestThermalThrottleLastsInterval(t *testing.T) {
+	tm := &throttleManager{interval: time.Minute, thermalUntil: time.Now().Add(-time.Second)}
+	tm.throttleCount = cpuThrottleCount()
+	if mode := tm.updateMode(); mode == throttleThermal {
+		t.Fatalf("updateMode() = %q after the interval of the last events", mode)
+	}
+}
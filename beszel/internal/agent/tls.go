@@ -0,0 +1,262 @@
+package agent
+
+import (
+	"beszel/internal/entities/healthcheck"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// How often the certificate is checked for renewal
+const certCheckInterval = 12 * time.Hour
+
+// certManager keeps the agent's server certificate issued by the hub up to date
+type certManager struct {
+	client      *enrollClient
+	token       string
+	fingerprint string // the hub only issues certificates for the system with this fingerprint
+	dir         string
+	key         *ecdsa.PrivateKey
+	caPool      *x509.CertPool
+	cert        atomic.Pointer[tls.Certificate]
+}
+
+// Loads the key and certificate from TLS_DIR (default DATA_DIR),
+// requesting a new certificate from the hub if needed
+func newCertManager() (*certManager, error) {
+	hubURL, _ := GetEnv("HUB_URL")
+	token, _ := GetEnv("TOKEN")
+	if hubURL == "" || token == "" {
+		return nil, errors.New("HUB_URL and TOKEN are required for the https transport")
+	}
+	dir, _ := GetEnv("TLS_DIR")
+	if dir == "" {
+		dir = dataDir()
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	pin, _ := GetEnv("HUB_CERT_FINGERPRINT")
+	client, err := newEnrollClient(hubURL, "", pin)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := getFingerprint()
+	if err != nil {
+		return nil, err
+	}
+	cm := &certManager{
+		client:      client,
+		token:       token,
+		fingerprint: fingerprint,
+		dir:         dir,
+	}
+	if err := cm.loadKey(); err != nil {
+		return nil, err
+	}
+	if err := cm.loadCert(); err != nil || cm.needsRenewal() {
+		if err := cm.renew(); err != nil {
+			return nil, err
+		}
+	}
+	return cm, nil
+}
+
+// Loads the private key, generating it on first start
+func (cm *certManager) loadKey() error {
+	keyPath := filepath.Join(cm.dir, "agent.key")
+	if keyPEM, err := os.ReadFile(keyPath); err == nil {
+		block, _ := pem.Decode(keyPEM)
+		if block == nil {
+			return errors.New("invalid key file " + keyPath)
+		}
+		cm.key, err = x509.ParseECPrivateKey(block.Bytes)
+		return err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	cm.key = key
+	return os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+}
+
+// Loads the saved certificate and hub CA
+func (cm *certManager) loadCert() error {
+	certPEM, err := os.ReadFile(filepath.Join(cm.dir, "agent.crt"))
+	if err != nil {
+		return err
+	}
+	caPEM, err := os.ReadFile(filepath.Join(cm.dir, "ca.crt"))
+	if err != nil {
+		return err
+	}
+	return cm.setCert(certPEM, caPEM)
+}
+
+func (cm *certManager) setCert(certPEM, caPEM []byte) error {
+	keyDER, err := x509.MarshalECPrivateKey(cm.key)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	if err != nil {
+		return err
+	}
+	// the CA doesn't change, so the pool is only set once
+	if cm.caPool == nil {
+		cm.caPool = x509.NewCertPool()
+		if !cm.caPool.AppendCertsFromPEM(caPEM) {
+			return errors.New("invalid CA certificate")
+		}
+	}
+	cm.cert.Store(&cert)
+	return nil
+}
+
+// Returns true if less than a third of the certificate's validity remains, or
+// if it wasn't issued for this agent's fingerprint (e.g. by an older hub)
+func (cm *certManager) needsRenewal() bool {
+	cert := cm.cert.Load()
+	if cert == nil {
+		return true
+	}
+	leaf := cert.Leaf
+	if len(leaf.URIs) != 1 || leaf.URIs[0].Path != "/"+cm.fingerprint {
+		return true
+	}
+	return time.Until(leaf.NotAfter) < leaf.NotAfter.Sub(leaf.NotBefore)/3
+}
+
+// Requests a new certificate from the hub and saves it
+func (cm *certManager) renew() error {
+	hostname, _ := os.Hostname()
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: hostname},
+		DNSNames: []string{hostname},
+	}, cm.key)
+	if err != nil {
+		return err
+	}
+	// the hub only issues certificates to the system's agent, which proves it with
+	// the secret from its registration or with its current certificate and key
+	req := map[string]string{
+		"token":       cm.token,
+		"csr":         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})),
+		"fingerprint": cm.fingerprint,
+		"secret":      readAgentSecret(),
+	}
+	if cert := cm.cert.Load(); cert != nil {
+		req["cert"] = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}))
+	}
+	var res struct {
+		Cert string `json:"cert"`
+		CA   string `json:"ca"`
+	}
+	if err := cm.client.request(http.MethodPost, "/api/beszel/tls/issue", req, &res); err != nil {
+		return err
+	}
+	if err := cm.setCert([]byte(res.Cert), []byte(res.CA)); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(cm.dir, "agent.crt"), []byte(res.Cert), 0644); err != nil {
+		return err
+	}
+	slog.Info("Certificate issued by hub", "expires", cm.cert.Load().Leaf.NotAfter)
+	return os.WriteFile(filepath.Join(cm.dir, "ca.crt"), []byte(res.CA), 0644)
+}
+
+// Renews the certificate in the background before it expires
+func (cm *certManager) startRenewal() {
+	for range time.Tick(certCheckInterval) {
+		if cm.needsRenewal() {
+			if err := cm.renew(); err != nil {
+				slog.Error("Failed to renew certificate", "err", err)
+			}
+		}
+	}
+}
+
+func (cm *certManager) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return cm.cert.Load(), nil
+}
+
+// Serves stats over https, only accepting clients with a certificate issued by the hub
+func (a *Agent) startTLSServer(addr string) {
+	cm, err := newCertManager()
+	if err != nil {
+		slog.Error("Error loading certificate", "err", err)
+		os.Exit(1)
+	}
+	go cm.startRenewal()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		interval := parseInterval(r.URL.Query().Get("interval"))
+		if r.URL.Query().Get("scope") == "system" {
+			writeJSON(w, a.gatherSystemStats(interval))
+			return
+		}
+		writeJSON(w, a.gatherStats(interval))
+	})
+	mux.HandleFunc("GET /processes", func(w http.ResponseWriter, r *http.Request) {
+		processes, err := getTopProcesses(processCount(r.URL.Query().Get("n")))
+		if err != nil {
+			slog.Error("Error getting processes", "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, processes)
+	})
+	mux.HandleFunc("POST /check", func(w http.ResponseWriter, r *http.Request) {
+		var check healthcheck.Check
+		if err := json.NewDecoder(r.Body).Decode(&check); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, check.Run())
+	})
+	mux.HandleFunc("POST /update", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, a.handleUpdateRequest(r.URL.Query().Get("channel")))
+	})
+	server := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+		TLSConfig: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			ClientAuth:     tls.RequireAndVerifyClientCert,
+			ClientCAs:      cm.caPool,
+			GetCertificate: cm.getCertificate,
+		},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	slog.Info("Starting HTTPS server", "address", addr)
+	if err := server.ListenAndServeTLS("", ""); err != nil {
+		slog.Error("Error starting HTTPS server", "err", err)
+		os.Exit(1)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		slog.Error("Error encoding stats", "err", err, "data", data)
+	}
+}
@@ -1,56 +1,385 @@
 package agent
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"beszel"
+	"beszel/internal/entities/system"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"time"
 
 	"github.com/blang/semver"
-	"github.com/rhysd/go-github-selfupdate/selfupdate"
 )
 
-// Update updates beszel-agent to the latest version
-func Update() {
-	var latest *selfupdate.Release
-	var found bool
-	var err error
-	currentVersion := semver.MustParse(beszel.Version)
-	fmt.Println("beszel-agent", currentVersion)
-	fmt.Println("Checking for updates...")
-	updater, _ := selfupdate.NewUpdater(selfupdate.Config{
-		Filters: []string{"beszel-agent"},
-	})
-	latest, found, err = updater.DetectLatest("henrygd/beszel")
+const updateRepo = "henrygd/beszel"
+
+// Release channels
+const (
+	channelStable = "stable"
+	channelBeta   = "beta" // includes pre-releases
+)
+
+var updateClient = &http.Client{Timeout: 5 * time.Minute}
 
+// Release from the GitHub API
+type githubRelease struct {
+	TagName    string `json:"tag_name"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+	Body       string `json:"body"`
+	Assets     []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+	version semver.Version
+}
+
+// Returns the download URL of the first asset whose name matches
+func (r *githubRelease) assetURL(match func(name string) bool) (string, error) {
+	for _, asset := range r.Assets {
+		if match(asset.Name) {
+			return asset.URL, nil
+		}
+	}
+	return "", fmt.Errorf("no matching asset in release %s", r.TagName)
+}
+
+// Returns the newest release in the channel
+func latestRelease(channel string) (*githubRelease, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://api.github.com/repos/%s/releases?per_page=30", updateRepo), nil)
 	if err != nil {
-		fmt.Println("Error checking for updates:", err)
-		os.Exit(1)
+		return nil, err
 	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := updateClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("github api: %s", res.Status)
+	}
+	var releases []*githubRelease
+	if err := json.NewDecoder(res.Body).Decode(&releases); err != nil {
+		return nil, err
+	}
+	var latest *githubRelease
+	for _, release := range releases {
+		if release.Draft || (release.Prerelease && channel != channelBeta) {
+			continue
+		}
+		version, err := semver.ParseTolerant(release.TagName)
+		if err != nil {
+			continue
+		}
+		release.version = version
+		if latest == nil || version.GT(latest.version) {
+			latest = release
+		}
+	}
+	if latest == nil {
+		return nil, errors.New("no releases found")
+	}
+	return latest, nil
+}
 
-	if !found {
-		fmt.Println("No updates found")
-		os.Exit(0)
+// Downloads a release asset into memory
+func download(url string) ([]byte, error) {
+	res, err := updateClient.Get(url)
+	if err != nil {
+		return nil, err
 	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download %s: %s", url, res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
 
-	fmt.Println("Latest version:", latest.Version)
+// Downloads the agent binary for this platform from a release, verifying the
+// archive against the release's checksums. Releases aren't signed, so this only
+// detects corrupted downloads. The checksums come from the same GitHub release
+// as the archive and don't protect against a compromised release.
+func downloadAgent(release *githubRelease) ([]byte, error) {
+	archiveName := fmt.Sprintf("beszel-agent_%s_%s.tar.gz", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		archiveName = strings.TrimSuffix(archiveName, ".tar.gz") + ".zip"
+	}
+	archiveURL, err := release.assetURL(func(name string) bool { return name == archiveName })
+	if err != nil {
+		return nil, err
+	}
+	checksumsURL, err := release.assetURL(func(name string) bool { return strings.HasSuffix(name, "checksums.txt") })
+	if err != nil {
+		return nil, err
+	}
+	checksums, err := download(checksumsURL)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := download(archiveURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyChecksum(archive, archiveName, checksums); err != nil {
+		return nil, err
+	}
+	if runtime.GOOS == "windows" {
+		return extractZip(archive, "beszel-agent.exe")
+	}
+	return extractTarGz(archive, "beszel-agent")
+}
 
-	if latest.Version.LTE(currentVersion) {
-		fmt.Println("You are up to date")
-		return
+// Checks the sha256 of a file against its line in a checksums file
+func verifyChecksum(data []byte, name string, checksums []byte) error {
+	sum := sha256.Sum256(data)
+	for _, line := range strings.Split(string(checksums), "\n") {
+		// Example line: 3a7bd3e2360a3d29eea436fcfb7e44c735d117c42d1c1835420b6b9942dd4f1b  beszel-agent_linux_amd64.tar.gz
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[1] != name {
+			continue
+		}
+		if fields[0] != hex.EncodeToString(sum[:]) {
+			return fmt.Errorf("checksum mismatch for %s", name)
+		}
+		return nil
 	}
+	return fmt.Errorf("no checksum for %s", name)
+}
 
-	var binaryPath string
-	fmt.Printf("Updating from %s to %s...\n", currentVersion, latest.Version)
-	binaryPath, err = os.Executable()
+// Returns the contents of a file in a gzipped tar archive
+func extractTarGz(archive []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
 	if err != nil {
-		fmt.Println("Error getting binary path:", err)
-		os.Exit(1)
+		return nil, err
 	}
-	err = selfupdate.UpdateTo(latest.AssetURL, binaryPath)
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			return nil, fmt.Errorf("%s not found in archive: %w", name, err)
+		}
+		if filepath.Base(header.Name) == name {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// Returns the contents of a file in a zip archive
+func extractZip(archive []byte, name string) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range zr.File {
+		if filepath.Base(file.Name) != name {
+			continue
+		}
+		f, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+	return nil, fmt.Errorf("%s not found in archive", name)
+}
+
+// Replaces the running executable with a new binary. The binary is written next
+// to the executable and renamed over it, so the swap is atomic.
+func replaceExecutable(binary []byte) (string, error) {
+	path, err := os.Executable()
 	if err != nil {
+		return "", err
+	}
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	newPath := path + ".new"
+	if err := os.WriteFile(newPath, binary, info.Mode().Perm()|0o100); err != nil {
+		return "", err
+	}
+	// windows can't replace a running executable, but it can rename it
+	oldPath := path + ".old"
+	if runtime.GOOS == "windows" {
+		os.Remove(oldPath)
+		if err := os.Rename(path, oldPath); err != nil {
+			os.Remove(newPath)
+			return "", err
+		}
+	}
+	if err := os.Rename(newPath, path); err != nil {
+		os.Remove(newPath)
+		if runtime.GOOS == "windows" {
+			os.Rename(oldPath, path)
+		}
+		return "", err
+	}
+	return path, nil
+}
+
+// Updates the executable to the latest release in the channel, returning the
+// release and the path of the executable. The release is nil if the agent is
+// already up to date.
+func updateAgent(channel string) (*githubRelease, string, error) {
+	currentVersion := semver.MustParse(beszel.Version)
+	release, err := latestRelease(channel)
+	if err != nil {
+		return nil, "", err
+	}
+	if release.version.LTE(currentVersion) {
+		return nil, "", nil
+	}
+	binary, err := downloadAgent(release)
+	if err != nil {
+		return nil, "", err
+	}
+	path, err := replaceExecutable(binary)
+	if err != nil {
+		return nil, "", err
+	}
+	return release, path, nil
+}
+
+// Update updates beszel-agent to the latest version
+func Update(args []string) {
+	flags := flag.NewFlagSet("update", flag.ExitOnError)
+	channel := flags.String("channel", channelStable, "release channel (stable or beta)")
+	flags.Parse(args)
+
+	fmt.Println("beszel-agent", beszel.Version)
+	fmt.Println("Checking for updates...")
+	release, _, err := updateAgent(*channel)
+	if errors.Is(err, os.ErrPermission) {
 		fmt.Println("Please try rerunning with sudo. Error:", err)
 		os.Exit(1)
 	}
-	fmt.Printf("Successfully updated to %s\n\n%s\n", latest.Version, strings.TrimSpace(latest.ReleaseNotes))
+	if err != nil {
+		fmt.Println("Error updating:", err)
+		os.Exit(1)
+	}
+	if release == nil {
+		fmt.Println("You are up to date")
+		return
+	}
+	fmt.Printf("Successfully updated to %s\n\n%s\n", release.version, strings.TrimSpace(release.Body))
+}
+
+// Updates the agent when requested by the hub and restarts it after the result
+// has been sent. Disabled with REMOTE_UPDATE=false.
+func (a *Agent) handleUpdateRequest(channel string) system.UpdateResult {
+	result := system.UpdateResult{Version: beszel.Version}
+	if enabled, _ := GetEnv("REMOTE_UPDATE"); enabled == "false" {
+		result.Error = "remote updates are disabled on this agent"
+		return result
+	}
+	if channel == "" {
+		channel = channelStable
+	}
+	if channel != channelStable && channel != channelBeta {
+		result.Error = fmt.Sprintf("invalid channel %q", channel)
+		return result
+	}
+	slog.Info("Update requested by hub", "channel", channel)
+	release, path, err := updateAgent(channel)
+	if err != nil {
+		slog.Error("Update failed", "err", err)
+		result.Error = err.Error()
+		return result
+	}
+	if release == nil {
+		return result
+	}
+	result.Version = release.version.String()
+	result.Updated = true
+	go func() {
+		time.Sleep(time.Second)
+		slog.Info("Updated, restarting", "version", release.version)
+		if err := restartAgent(path); err != nil {
+			slog.Error("Restart failed", "err", err)
+		}
+	}()
+	return result
+}
+
+// Returned by newAutoUpdater if AUTO_UPDATE isn't set
+var errAutoUpdateDisabled = errors.New("auto update disabled")
+
+// Checks for new releases on a schedule and restarts the agent after updating
+type autoUpdater struct {
+	interval time.Duration
+	channel  string
+}
+
+// Creates an autoUpdater from AUTO_UPDATE, which can be hourly, daily, weekly
+// or a duration like 12h. UPDATE_CHANNEL=beta includes pre-releases.
+func newAutoUpdater() (*autoUpdater, error) {
+	value, _ := GetEnv("AUTO_UPDATE")
+	au := &autoUpdater{channel: channelStable}
+	switch value {
+	case "", "false":
+		return nil, errAutoUpdateDisabled
+	case "hourly":
+		au.interval = time.Hour
+	case "daily":
+		au.interval = 24 * time.Hour
+	case "weekly":
+		au.interval = 7 * 24 * time.Hour
+	default:
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < time.Hour {
+			return nil, fmt.Errorf("invalid AUTO_UPDATE %q (hourly, daily, weekly or a duration of at least 1h)", value)
+		}
+		au.interval = interval
+	}
+	if channel, exists := GetEnv("UPDATE_CHANNEL"); exists {
+		if channel != channelStable && channel != channelBeta {
+			return nil, fmt.Errorf("invalid UPDATE_CHANNEL %q (stable or beta)", channel)
+		}
+		au.channel = channel
+	}
+	slog.Info("Auto update", "interval", au.interval, "channel", au.channel)
+	return au, nil
+}
+
+// Checks for updates every interval, starting after a random delay so that
+// agents started together don't check at the same time
+func (au *autoUpdater) run() {
+	time.Sleep(rand.N(min(au.interval, time.Hour)))
+	for {
+		release, path, err := updateAgent(au.channel)
+		switch {
+		case err != nil:
+			slog.Error("Auto update failed", "err", err)
+		case release != nil:
+			slog.Info("Updated, restarting", "version", release.version)
+			if err := restartAgent(path); err != nil {
+				slog.Error("Restart failed", "err", err)
+			}
+		}
+		time.Sleep(au.interval)
+	}
 }
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	data := []byte("beszel-agent archive")
+	sum := sha256.Sum256(data)
+	valid := hex.EncodeToString(sum[:])
+	other := sha256.Sum256([]byte("something else"))
+	tests := []struct {
+		name      string
+		checksums string
+		wantErr   bool
+	}{
+		{
+			name:      "match",
+			checksums: valid + "  beszel-agent_linux_amd64.tar.gz\n",
+		},
+		{
+			name:      "match among other files",
+			checksums: hex.EncodeToString(other[:]) + "  beszel_linux_amd64.tar.gz\n" + valid + "  beszel-agent_linux_amd64.tar.gz\n",
+		},
+		{
+			name:      "mismatch",
+			checksums: hex.EncodeToString(other[:]) + "  beszel-agent_linux_amd64.tar.gz\n",
+			wantErr:   true,
+		},
+		{
+			name:      "file not listed",
+			checksums: valid + "  beszel-agent_linux_arm64.tar.gz\n",
+			wantErr:   true,
+		},
+		{
+			name:      "name is a suffix of another file",
+			checksums: valid + "  old-beszel-agent_linux_amd64.tar.gz\n",
+			wantErr:   true,
+		},
+		{
+			name:      "empty",
+			checksums: "",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyChecksum(data, "beszel-agent_linux_amd64.tar.gz", []byte(tt.checksums))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyChecksum() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,11 +2,19 @@
 package alerts
 
 import (
+	"beszel/internal/entities/healthcheck"
+	"beszel/internal/entities/ports"
 	"beszel/internal/entities/system"
+	"beszel/internal/expr"
+	"beszel/internal/i18n"
+	"beszel/internal/secrets"
 	"fmt"
-	"net/mail"
+	"log/slog"
+	"math"
 	"net/url"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/containrrr/shoutrrr"
@@ -15,13 +23,19 @@ import (
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
-	"github.com/pocketbase/pocketbase/tools/mailer"
 	"github.com/pocketbase/pocketbase/tools/types"
 	"github.com/spf13/cast"
 )
 
 type AlertManager struct {
-	app *pocketbase.PocketBase
+	app       *pocketbase.PocketBase
+	logger    *slog.Logger
+	mutex     sync.RWMutex
+	templates map[string]NotificationTemplate // default templates from config.yml
+	// serializes saving notification channel health from concurrent notifications
+	channelsMutex sync.Mutex
+	// wakes up the notification queue worker
+	queueSignal chan struct{}
 }
 
 type AlertMessageData struct {
@@ -30,20 +44,69 @@ type AlertMessageData struct {
 	Message  string
 	Link     string
 	LinkText string
+	Data     TemplateData // variables for user defined templates
+	time     time.Time    // when the alert was created
+	value    *alertValue  // formatted into Message and Data for each user
+	text     *alertText   // translated into Title, Message, LinkText and Data for each user
+	systemId string       // system the alert is for, used to match quiet hours
 }
 
 type UserNotificationSettings struct {
-	Emails   []string `json:"emails"`
-	Webhooks []string `json:"webhooks"`
+	Emails     []string                        `json:"emails"`
+	Webhooks   []string                        `json:"webhooks"`
+	Templates  map[string]NotificationTemplate `json:"templates,omitempty"`
+	Locale     string                          `json:"locale,omitempty"`     // language tag for text and number formatting (e.g. de-DE)
+	Units      string                          `json:"units,omitempty"`      // decimal (GB) or binary (GiB)
+	TimeFormat string                          `json:"timeFormat,omitempty"` // 24h or 12h
 }
 
 type SystemAlertStats struct {
 	Cpu          float64            `json:"cpu"`
 	Mem          float64            `json:"mp"`
+	Swap         float64            `json:"s"`
+	SwapUsed     float64            `json:"su"`
 	Disk         float64            `json:"dp"`
 	NetSent      float64            `json:"ns"`
 	NetRecv      float64            `json:"nr"`
+	Battery      float64            `json:"bat"`
+	Fds          float64            `json:"fd"`
+	FdMax        float64            `json:"fdm"`
+	FdProcPct    float64            `json:"fdp"`
+	Entropy      float64            `json:"ent"`
+	EntropyPool  float64            `json:"entp"`
+	LoadAvg1     float64            `json:"l1"`
+	LoadAvg5     float64            `json:"l5"`
+	LoadAvg15    float64            `json:"l15"`
+	Latency      float64            `json:"lat"`
+	PacketLoss   *float64           `json:"pl"`
 	Temperatures map[string]float32 `json:"t"`
+	Voltages     map[string]float64 `json:"volt"`
+	Pressure     *system.Pressure   `json:"psi"`
+	GPUData      map[string]struct {
+		MemoryFree float64            `json:"mf"`
+		Engines    map[string]float64 `json:"e"`
+	} `json:"g"`
+	Nics map[string]struct {
+		Util float64 `json:"u"`
+	} `json:"ni"`
+	Missing []string `json:"mi"`
+}
+
+// Groups of stats used by alerts, which are skipped while their stats are missing
+var alertStatsGroups = map[string]string{
+	"CPU":              system.StatsCpu,
+	"Memory":           system.StatsMem,
+	"Swap":             system.StatsMem,
+	"Bandwidth":        system.StatsNet,
+	"NIC":              system.StatsNet,
+	"Disk":             system.StatsDisk,
+	"LoadAvg1":         system.StatsLoad,
+	"LoadAvg5":         system.StatsLoad,
+	"LoadAvg15":        system.StatsLoad,
+	"File Descriptors": system.StatsFd,
+	"CPU Pressure":     system.StatsPsi,
+	"Memory Pressure":  system.StatsPsi,
+	"IO Pressure":      system.StatsPsi,
 }
 
 type SystemAlertData struct {
@@ -54,20 +117,27 @@ type SystemAlertData struct {
 	val          float64
 	threshold    float64
 	triggered    bool
+	below        bool // triggers when the value falls below the threshold
 	time         time.Time
 	count        uint8
 	min          uint8
 	mapSums      map[string]float32
-	descriptor   string // override descriptor in notification body (for temp sensor, disk partition, etc)
+	descriptor   i18n.Message // override descriptor in notification body (for temp sensor, disk partition, etc)
+	project      string       // docker compose project targeted by the alert
+	engine       string       // gpu engine targeted by the alert, any engine if empty
+	expr         *expr.Expr   // metric expression of an Expression alert
 }
 
-func NewAlertManager(app *pocketbase.PocketBase) *AlertManager {
+func NewAlertManager(app *pocketbase.PocketBase, logger *slog.Logger) *AlertManager {
 	return &AlertManager{
-		app: app,
+		app:         app,
+		logger:      logger,
+		queueSignal: make(chan struct{}, 1),
 	}
 }
 
-func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo system.Info, temperatures map[string]float64, extraFs map[string]*system.FsStats) error {
+// Handles the alerts of a system using the info and stats of its latest update
+func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo system.Info, current *system.Stats) error {
 	// start := time.Now()
 	// defer func() {
 	// 	log.Println("alert stats took", time.Since(start))
@@ -86,7 +156,17 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 
 	for _, alertRecord := range alertRecords {
 		name := alertRecord.GetString("name")
+		// alerts for a docker compose project are handled in HandleProjectAlerts
+		if alertRecord.GetString("project") != "" {
+			continue
+		}
+		// no data is not the same as zero, so don't change alert state without it
+		if current.IsMissing(alertStatsGroups[name]) {
+			continue
+		}
 		var val float64
+		var below bool
+		var metricExpr *expr.Expr
 		unit := "%"
 
 		switch name {
@@ -94,12 +174,22 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 			val = systemInfo.Cpu
 		case "Memory":
 			val = systemInfo.MemPct
+		case "Swap":
+			val = systemInfo.SwapPct
 		case "Bandwidth":
 			val = systemInfo.Bandwidth
 			unit = " MB/s"
+		case "NIC":
+			val = systemInfo.NetUtil
+		case "LoadAvg1":
+			val = loadPerCore(systemInfo.LoadAvg1, systemInfo)
+		case "LoadAvg5":
+			val = loadPerCore(systemInfo.LoadAvg5, systemInfo)
+		case "LoadAvg15":
+			val = loadPerCore(systemInfo.LoadAvg15, systemInfo)
 		case "Disk":
 			maxUsedPct := systemInfo.DiskPct
-			for _, fs := range extraFs {
+			for _, fs := range current.ExtraFs {
 				usedPct := fs.DiskUsed / fs.DiskTotal * 100
 				if usedPct > maxUsedPct {
 					maxUsedPct = usedPct
@@ -107,27 +197,114 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 			}
 			val = maxUsedPct
 		case "Temperature":
-			if temperatures == nil {
+			if current.Temperatures == nil {
 				continue
 			}
-			for _, temp := range temperatures {
+			for _, temp := range current.Temperatures {
 				if temp > val {
 					val = temp
 				}
 			}
 			unit = "°C"
+		case "Voltage":
+			var found bool
+			for key, volts := range current.Voltages {
+				if deviation, ok := system.VoltageDeviation(key, volts); ok {
+					val = max(val, deviation)
+					found = true
+				}
+			}
+			// no rails with a known nominal voltage
+			if !found {
+				continue
+			}
+		case "File Descriptors":
+			val = systemInfo.FdPct
+		case "CPU Pressure", "Memory Pressure", "IO Pressure":
+			if current.Pressure == nil {
+				continue
+			}
+			val = pressureSome(name, current.Pressure)
+		case "Entropy":
+			if systemInfo.Entropy == nil {
+				continue
+			}
+			val = *systemInfo.Entropy
+			unit = " bits"
+			below = true
+		case "Latency":
+			if systemInfo.Latency == nil {
+				continue
+			}
+			val = *systemInfo.Latency
+			unit = " ms"
+		case "Packet Loss":
+			if systemInfo.PacketLoss == nil {
+				continue
+			}
+			val = *systemInfo.PacketLoss
+		case "Battery":
+			if systemInfo.Battery == nil {
+				continue
+			}
+			val = systemInfo.Battery.Capacity
+			below = true
+		case "GPU Memory":
+			if len(current.GPUData) == 0 {
+				continue
+			}
+			val = math.MaxFloat64
+			for _, gpu := range current.GPUData {
+				val = min(val, gpu.MemoryFree/1000)
+			}
+			unit = " GB"
+			below = true
+		case "GPU Engine":
+			var found bool
+			for _, gpu := range current.GPUData {
+				for name, busy := range gpu.Engines {
+					if engineMatches(alertRecord, name) {
+						val = max(val, busy)
+						found = true
+					}
+				}
+			}
+			if !found {
+				continue
+			}
+		case "Expression":
+			var ok bool
+			if metricExpr, err = ParseMetricExpr(alertRecord.GetString("expression")); err != nil {
+				continue
+			}
+			// no value if a metric in the expression is missing
+			if val, ok = metricExpr.Eval(current.Values()); !ok {
+				continue
+			}
+			unit = ""
+		case "Status", "SMART", "Service", "HTTP", "Port", "Stale":
+			// handled separately when status changes
+			continue
 		}
 
 		triggered := alertRecord.GetBool("triggered")
 		threshold := alertRecord.GetFloat("value")
 
 		// CONTINUE
-		// IF alert is not triggered and curValue is less than threshold
-		// OR alert is triggered and curValue is greater than threshold
-		if (!triggered && val <= threshold) || (triggered && val > threshold) {
+		// IF alert is not triggered and curValue is within threshold
+		// OR alert is triggered and curValue is past threshold
+		if triggered == exceedsThreshold(val, threshold, below) {
 			// log.Printf("Skipping alert %s: val %f | threshold %f | triggered %v\n", name, val, threshold, triggered)
 			continue
 		}
+		// don't trigger again until the cooldown after the last resolution has passed
+		if !triggered && inCooldown(alertRecord, now) {
+			continue
+		}
+		// only trigger during the alert's hours in the system's time zone
+		if !triggered && !inAlertHours(alertRecord, systemRecord, now) {
+			continue
+		}
 
 		min := max(1, cast.ToUint8(alertRecord.Get("min")))
 		// add time to alert time to make sure it's slighty after record creation
@@ -144,25 +321,32 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 			val:          val,
 			threshold:    threshold,
 			triggered:    triggered,
+			below:        below,
 			time:         time,
 			min:          min,
+			engine:       alertRecord.GetString("engine"),
+			expr:         metricExpr,
 		})
 	}
 
-	systemStats := []struct {
+	type statsRow struct {
 		Stats   []byte         `db:"stats"`
 		Created types.DateTime `db:"created"`
-	}{}
+	}
+	systemStats := []statsRow{}
 
 	err = am.app.DB().
 		Select("stats", "created").
 		From("system_stats").
 		Where(dbx.NewExp(
-			"system={:system} AND type='1m' AND created > {:created}",
+			"system={:system} AND type='1m' AND created > {:created} AND created < {:now}",
 			dbx.Params{
 				"system": systemRecord.Id,
 				// subtract some time to give us a bit of buffer
 				"created": oldestTime.Add(-time.Second * 90),
+				// the current stats are created after the system is updated and
+				// may not be saved yet, so they're added below instead
+				"now": now.Format(types.DefaultDateLayout),
 			},
 		)).
 		OrderBy("created").
@@ -171,6 +355,11 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 	if err != nil {
 		return err
 	}
+	currentStats, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	systemStats = append(systemStats, statsRow{currentStats, systemRecord.GetDateTime("updated")})
 
 	// get oldest record creation time from first record in the slice
 	oldestRecordTime := systemStats[0].Created.Time()
@@ -190,15 +379,26 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 	}
 
 	var stats SystemAlertStats
+	hasExpr := slices.ContainsFunc(validAlerts, func(alert SystemAlertData) bool { return alert.expr != nil })
 
-	// we can skip the latest systemStats record since it's the current value
+	// the last record is the current stats, which may not be saved yet
 	for i := 0; i < len(systemStats); i++ {
 		stat := systemStats[i]
 		// subtract 10 seconds to give a small time buffer
 		systemStatsCreation := stat.Created.Time().Add(-time.Second * 10)
+		stats = SystemAlertStats{} // null values don't overwrite previous values when unmarshalling
 		if err := json.Unmarshal(stat.Stats, &stats); err != nil {
 			return err
 		}
+		// expressions can use any field, so they need the full stats
+		var recordValues map[string]float64
+		if hasExpr {
+			var fullStats system.Stats
+			if err := json.Unmarshal(stat.Stats, &fullStats); err != nil {
+				return err
+			}
+			recordValues = fullStats.Values()
+		}
 		// log.Println("stats", stats)
 		for j := range validAlerts {
 			alert := &validAlerts[j]
@@ -210,17 +410,63 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 			if systemStatsCreation.Before(alert.time) {
 				continue
 			}
+			// skip records missing the alert's stats
+			if slices.Contains(stats.Missing, alertStatsGroups[alert.name]) {
+				continue
+			}
 			// add to alert value
 			switch alert.name {
 			case "CPU":
 				alert.val += stats.Cpu
 			case "Memory":
 				alert.val += stats.Mem
+			case "Swap":
+				if stats.Swap > 0 {
+					alert.val += stats.SwapUsed / stats.Swap * 100
+				}
 			case "Bandwidth":
 				alert.val += stats.NetSent + stats.NetRecv
+			case "File Descriptors":
+				alert.val += fdPct(stats)
+			case "CPU Pressure", "Memory Pressure", "IO Pressure":
+				// skip records without pressure stall information
+				if stats.Pressure == nil {
+					continue
+				}
+				alert.val += pressureSome(alert.name, stats.Pressure)
+			case "Entropy":
+				// skip records without entropy data
+				if stats.EntropyPool == 0 {
+					continue
+				}
+				alert.val += stats.Entropy
+			case "Latency":
+				// skip records without a reply to latency probes
+				if stats.Latency == 0 {
+					continue
+				}
+				alert.val += stats.Latency
+			case "Packet Loss":
+				// skip records without latency probes
+				if stats.PacketLoss == nil {
+					continue
+				}
+				alert.val += *stats.PacketLoss
+			case "Battery":
+				// skip records without battery data
+				if stats.Battery == 0 {
+					continue
+				}
+				alert.val += stats.Battery
+			case "LoadAvg1":
+				alert.val += loadPerCore(stats.LoadAvg1, systemInfo)
+			case "LoadAvg5":
+				alert.val += loadPerCore(stats.LoadAvg5, systemInfo)
+			case "LoadAvg15":
+				alert.val += loadPerCore(stats.LoadAvg15, systemInfo)
 			case "Disk":
 				if alert.mapSums == nil {
-					alert.mapSums = make(map[string]float32, len(extraFs)+1)
+					alert.mapSums = make(map[string]float32, len(current.ExtraFs)+1)
 				}
 				// add root disk
 				if _, ok := alert.mapSums["root"]; !ok {
@@ -228,7 +474,7 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 				}
 				alert.mapSums["root"] += float32(stats.Disk)
 				// add extra disks
-				for key, fs := range extraFs {
+				for key, fs := range current.ExtraFs {
 					if _, ok := alert.mapSums[key]; !ok {
 						alert.mapSums[key] = 0.0
 					}
@@ -244,6 +490,55 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 					}
 					alert.mapSums[key] += temp
 				}
+			case "Voltage":
+				// skip records without current.Voltages
+				if len(stats.Voltages) == 0 {
+					continue
+				}
+				if alert.mapSums == nil {
+					alert.mapSums = make(map[string]float32, len(stats.Voltages))
+				}
+				for key, volts := range stats.Voltages {
+					if deviation, ok := system.VoltageDeviation(key, volts); ok {
+						alert.mapSums[key] += float32(deviation)
+					}
+				}
+			case "NIC":
+				if alert.mapSums == nil {
+					alert.mapSums = make(map[string]float32, len(stats.Nics))
+				}
+				for key, nic := range stats.Nics {
+					alert.mapSums[key] += float32(nic.Util)
+				}
+			case "GPU Memory":
+				if alert.mapSums == nil {
+					alert.mapSums = make(map[string]float32, len(stats.GPUData))
+				}
+				for key, gpu := range stats.GPUData {
+					alert.mapSums[key] += float32(gpu.MemoryFree / 1000)
+				}
+			case "GPU Engine":
+				// skip records without gpu data
+				if len(stats.GPUData) == 0 {
+					continue
+				}
+				if alert.mapSums == nil {
+					alert.mapSums = make(map[string]float32, len(stats.GPUData))
+				}
+				// keyed by engine and gpu, engine names don't contain colons
+				for key, gpu := range stats.GPUData {
+					for name, busy := range gpu.Engines {
+						if engineMatches(alert.alertRecord, name) {
+							alert.mapSums[name+":"+key] += float32(busy)
+						}
+					}
+				}
+			case "Expression":
+				val, ok := alert.expr.Eval(recordValues)
+				if !ok {
+					continue
+				}
+				alert.val += val
 			default:
 				continue
 			}
@@ -259,7 +554,7 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 				sumPct := float32(value)
 				if sumPct > maxPct {
 					maxPct = sumPct
-					alert.descriptor = fmt.Sprintf("Usage of %s", key)
+					alert.descriptor = i18n.M("Usage of {filesystem}", "filesystem", key)
 				}
 			}
 			alert.val = float64(maxPct / float32(alert.count))
@@ -269,10 +564,59 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 				sumTemp := float32(value) / float32(alert.count)
 				if sumTemp > maxTemp {
 					maxTemp = sumTemp
-					alert.descriptor = fmt.Sprintf("Highest sensor %s", key)
+					alert.descriptor = i18n.M("Highest sensor {sensor}", "sensor", key)
 				}
 			}
 			alert.val = float64(maxTemp)
+		case "Voltage":
+			maxDeviation := float32(0)
+			for key, value := range alert.mapSums {
+				avgDeviation := value / float32(alert.count)
+				if avgDeviation > maxDeviation {
+					maxDeviation = avgDeviation
+					alert.descriptor = i18n.M("Deviation of {sensor}", "sensor", key)
+				}
+			}
+			alert.val = float64(maxDeviation)
+		case "NIC":
+			maxUtil := float32(0)
+			for key, value := range alert.mapSums {
+				avgUtil := value / float32(alert.count)
+				if avgUtil > maxUtil {
+					maxUtil = avgUtil
+					alert.descriptor = i18n.M("Utilization of {interface}", "interface", key)
+				}
+			}
+			alert.val = float64(maxUtil)
+		case "GPU Memory":
+			minFree := float32(math.MaxFloat32)
+			for key, value := range alert.mapSums {
+				avgFree := value / float32(alert.count)
+				if avgFree < minFree {
+					minFree = avgFree
+					name := key
+					if gpu, ok := current.GPUData[key]; ok {
+						name = gpu.Name
+					}
+					alert.descriptor = i18n.M("Free memory of {gpu}", "gpu", name)
+				}
+			}
+			alert.val = float64(minFree)
+		case "GPU Engine":
+			maxBusy := float32(0)
+			for key, value := range alert.mapSums {
+				avgBusy := value / float32(alert.count)
+				if avgBusy > maxBusy {
+					maxBusy = avgBusy
+					engine, id, _ := strings.Cut(key, ":")
+					name := id
+					if gpu, ok := current.GPUData[id]; ok {
+						name = gpu.Name
+					}
+					alert.descriptor = i18n.M("{engine} engine of {gpu}", "engine", engine, "gpu", name)
+				}
+			}
+			alert.val = float64(maxBusy)
 		default:
 			alert.val = alert.val / float64(alert.count)
 		}
@@ -281,10 +625,11 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 		// log.Printf("%s: val %f | count %d | min-count %f | threshold %f\n", alert.name, alert.val, alert.count, minCount, alert.threshold)
 		// pass through alert if count is greater than or equal to minCount
 		if float32(alert.count) >= minCount {
-			if !alert.triggered && alert.val > alert.threshold {
+			exceeds := exceedsThreshold(alert.val, alert.threshold, alert.below)
+			if !alert.triggered && exceeds {
 				alert.triggered = true
 				go am.sendSystemAlert(alert)
-			} else if alert.triggered && alert.val <= alert.threshold {
+			} else if alert.triggered && !exceeds {
 				alert.triggered = false
 				go am.sendSystemAlert(alert)
 			}
@@ -293,53 +638,162 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 	return nil
 }
 
+// Returns a load average as a percentage of the system's logical cores
+func loadPerCore(load float64, info system.Info) float64 {
+	cores := max(info.Threads, info.Cores, 1)
+	return load / float64(cores) * 100
+}
+
+// Returns the highest of the system's file descriptor usage and the usage of any
+// process relative to its own limit, which is usually reached first
+func fdPct(stats SystemAlertStats) float64 {
+	if stats.FdMax == 0 {
+		return stats.FdProcPct
+	}
+	return max(stats.Fds/stats.FdMax*100, stats.FdProcPct)
+}
+
+// Returns the share of time that some tasks were stalled on the resource of a
+// pressure alert. Full pressure, when all tasks were stalled, is rare outside
+// of severe memory or i/o shortage, so it's left to expression alerts.
+func pressureSome(name string, p *system.Pressure) float64 {
+	switch name {
+	case "Memory Pressure":
+		return p.MemSome
+	case "IO Pressure":
+		return p.IoSome
+	default:
+		return p.CpuSome
+	}
+}
+
+// Returns true if the alert resolved less than its cooldown ago
+func inCooldown(alertRecord *core.Record, now time.Time) bool {
+	cooldown := alertRecord.GetInt("cooldown")
+	resolved := alertRecord.GetDateTime("resolved")
+	if cooldown <= 0 || resolved.IsZero() {
+		return false
+	}
+	return now.Before(resolved.Time().Add(time.Duration(cooldown) * time.Minute))
+}
+
+// Returns true if an engine is targeted by a GPU Engine alert
+func engineMatches(alertRecord *core.Record, engine string) bool {
+	target := alertRecord.GetString("engine")
+	return target == "" || target == engine
+}
+
+// Returns true if the value is past the threshold of an alert
+func exceedsThreshold(val, threshold float64, below bool) bool {
+	if below {
+		return val < threshold
+	}
+	return val > threshold
+}
+
+// Names of system alerts in notification bodies and titles. Titles use lowercase
+// names unless they start with an acronym.
+var alertMetricNames = map[string][2]i18n.Message{
+	"CPU":              {i18n.M("CPU"), i18n.M("CPU")},
+	"Memory":           {i18n.M("Memory"), i18n.M("memory")},
+	"Swap":             {i18n.M("Swap usage"), i18n.M("swap usage")},
+	"Bandwidth":        {i18n.M("Bandwidth"), i18n.M("bandwidth")},
+	"NIC":              {i18n.M("Network utilization"), i18n.M("network utilization")},
+	"Disk":             {i18n.M("Disk usage"), i18n.M("disk usage")},
+	"Temperature":      {i18n.M("Temperature"), i18n.M("temperature")},
+	"Voltage":          {i18n.M("Voltage deviation"), i18n.M("voltage deviation")},
+	"File Descriptors": {i18n.M("File descriptor usage"), i18n.M("file descriptor usage")},
+	"CPU Pressure":     {i18n.M("CPU pressure"), i18n.M("CPU pressure")},
+	"Memory Pressure":  {i18n.M("Memory pressure"), i18n.M("memory pressure")},
+	"IO Pressure":      {i18n.M("I/O pressure"), i18n.M("I/O pressure")},
+	"Entropy":          {i18n.M("Available entropy"), i18n.M("available entropy")},
+	"Latency":          {i18n.M("Latency"), i18n.M("latency")},
+	"Packet Loss":      {i18n.M("Packet loss"), i18n.M("packet loss")},
+	"Battery":          {i18n.M("Battery charge"), i18n.M("battery charge")},
+	"GPU Memory":       {i18n.M("GPU memory headroom"), i18n.M("GPU memory headroom")},
+	"GPU Engine":       {i18n.M("GPU engine utilization"), i18n.M("GPU engine utilization")},
+}
+
 func (am *AlertManager) sendSystemAlert(alert SystemAlertData) {
 	// log.Printf("Sending alert %s: val %f | count %d | threshold %f\n", alert.name, alert.val, alert.count, alert.threshold)
 	systemName := alert.systemRecord.GetString("name")
 
-	// change Disk to Disk usage
-	if alert.name == "Disk" {
-		alert.name += " usage"
+	// change Disk to Disk usage, LoadAvg5 to Load average 5m, etc
+	names, ok := alertMetricNames[alert.name]
+	if minutes, isLoad := strings.CutPrefix(alert.name, "LoadAvg"); isLoad {
+		names = [2]i18n.Message{
+			i18n.M("Load average {minutes}m", "minutes", minutes),
+			i18n.M("load average {minutes}m", "minutes", minutes),
+		}
+		if alert.descriptor.IsZero() {
+			alert.descriptor = i18n.M("Load average {minutes}m per core", "minutes", minutes)
+		}
+	} else if alert.expr != nil {
+		names = [2]i18n.Message{i18n.Raw(alert.expr.String()), i18n.Raw(alert.expr.String())}
+	} else if !ok {
+		names = [2]i18n.Message{i18n.Raw(alert.name), i18n.Raw(alert.name)}
 	}
-
-	// make title alert name lowercase if not CPU
-	titleAlertName := alert.name
-	if titleAlertName != "CPU" {
-		titleAlertName = strings.ToLower(titleAlertName)
+	metric, titleMetric := names[0], names[1]
+	if alert.project != "" {
+		titleMetric = i18n.M("{project} {metric}", "project", alert.project, "metric", titleMetric)
+	} else if alert.engine != "" {
+		titleMetric = i18n.M("GPU {engine} engine utilization", "engine", alert.engine)
 	}
 
-	var subject string
-	if alert.triggered {
-		subject = fmt.Sprintf("%s %s above threshold", systemName, titleAlertName)
+	var subject i18n.Message
+	if alert.triggered != alert.below {
+		subject = i18n.M("{system} {metric} above threshold", "system", systemName, "metric", titleMetric)
 	} else {
-		subject = fmt.Sprintf("%s %s below threshold", systemName, titleAlertName)
+		subject = i18n.M("{system} {metric} below threshold", "system", systemName, "metric", titleMetric)
 	}
-	minutesLabel := "minute"
-	if alert.min > 1 {
-		minutesLabel += "s"
+	if alert.descriptor.IsZero() {
+		alert.descriptor = metric
 	}
-	if alert.descriptor == "" {
-		alert.descriptor = alert.name
+	duration := i18n.M("{minutes, plural, one {# minute} other {# minutes}}", "minutes", int(alert.min))
+	status := "resolved"
+	if alert.triggered {
+		status = "triggered"
 	}
-	body := fmt.Sprintf("%s averaged %.2f%s for the previous %v %s.", alert.descriptor, alert.val, alert.unit, alert.min, minutesLabel)
 
 	alert.alertRecord.Set("triggered", alert.triggered)
+	if !alert.triggered {
+		alert.alertRecord.Set("resolved", time.Now().UTC())
+	}
 	if err := am.app.Save(alert.alertRecord); err != nil {
 		// app.Logger().Error("failed to save alert record", "err", err.Error())
 		return
 	}
+	am.recordAlertHistory(alert.alertRecord, alert.triggered, alert.val)
 	// expand the user relation and send the alert
 	if errs := am.app.ExpandRecord(alert.alertRecord, []string{"user"}, nil); len(errs) > 0 {
 		// app.Logger().Error("failed to expand user relation", "errs", errs)
 		return
 	}
 	if user := alert.alertRecord.ExpandedOne("user"); user != nil {
+		window := time.Duration(alert.min) * time.Minute
+		link := am.systemLink(systemName, alert.alertRecord.GetString("name"), alert.time.Add(window), window)
+		// the text and values are formatted for the user's locale when sent
 		am.sendAlert(AlertMessageData{
 			UserID:   user.Id,
-			Title:    subject,
-			Message:  body,
-			Link:     am.app.Settings().Meta.AppURL + "/system/" + url.PathEscape(systemName),
-			LinkText: "View " + systemName,
+			systemId: alert.systemRecord.Id,
+			Link:     link,
+			Data: TemplateData{
+				System: systemName,
+				Metric: metric.String(),
+				Status: status,
+				URL:    link,
+			},
+			text: &alertText{
+				title:    subject,
+				linkText: i18n.M("View {system}", "system", systemName),
+			},
+			value: &alertValue{
+				descriptor: alert.descriptor,
+				value:      alert.val,
+				threshold:  alert.threshold,
+				unit:       alert.unit,
+				duration:   duration,
+			},
 		})
 	}
 }
@@ -380,31 +834,336 @@ func (am *AlertManager) HandleStatusAlerts(newStatus string, oldSystemRecord *co
 		if user == nil {
 			return nil
 		}
+		am.recordAlertHistory(alertRecord, alertStatus == "down", 0)
 		emoji := "\U0001F534"
 		if alertStatus == "up" {
 			emoji = "\u2705"
 		}
 		// send alert
 		systemName := oldSystemRecord.GetString("name")
+		message := i18n.M("Connection to {system} is down", "system", systemName)
+		if alertStatus == "up" {
+			message = i18n.M("Connection to {system} is up", "system", systemName)
+		}
+		link := am.systemLink(systemName, "", time.Now(), eventLinkWindow)
 		am.sendAlert(AlertMessageData{
 			UserID:   user.Id,
-			Title:    fmt.Sprintf("Connection to %s is %s %v", systemName, alertStatus, emoji),
-			Message:  fmt.Sprintf("Connection to %s is %s", systemName, alertStatus),
-			Link:     am.app.Settings().Meta.AppURL + "/system/" + url.PathEscape(systemName),
-			LinkText: "View " + systemName,
+			systemId: oldSystemRecord.Id,
+			Link:     link,
+			Data: TemplateData{
+				System: systemName,
+				Metric: "Status",
+				Value:  alertStatus,
+				Status: alertStatus,
+				URL:    link,
+			},
+			text: &alertText{
+				title:    message,
+				message:  message,
+				linkText: i18n.M("View {system}", "system", systemName),
+				emoji:    emoji,
+			},
+		})
+	}
+	return nil
+}
+
+// Sends a notification about the hub itself to all admin users, translated
+// into each admin's language
+func (am *AlertManager) NotifyAdmins(title, message i18n.Message) error {
+	admins, err := am.app.FindAllRecords("users", dbx.HashExp{"role": "admin"})
+	if err != nil {
+		return err
+	}
+	link := am.app.Settings().Meta.AppURL
+	for _, admin := range admins {
+		go am.sendAlert(AlertMessageData{
+			UserID: admin.Id,
+			Link:   link,
+			Data: TemplateData{
+				Metric: "Hub",
+				Status: "triggered",
+				URL:    link,
+			},
+			text: &alertText{
+				title:    title,
+				message:  message,
+				linkText: i18n.M("Open Beszel"),
+			},
+		})
+	}
+	return nil
+}
+
+// Notifies the users of a system that its stats were rejected because they came
+// from an agent with a different fingerprint, which may be impersonating it
+func (am *AlertManager) HandleFingerprintAlert(systemRecord *core.Record) {
+	systemName := systemRecord.GetString("name")
+	link := am.systemLink(systemName, "", time.Time{}, 0)
+	for _, userID := range systemRecord.GetStringSlice("users") {
+		go am.sendAlert(AlertMessageData{
+			UserID:   userID,
+			systemId: systemRecord.Id,
+			Link:     link,
+			Data: TemplateData{
+				System: systemName,
+				Metric: "Fingerprint",
+				Status: "triggered",
+				URL:    link,
+			},
+			text: &alertText{
+				title: i18n.M("Unknown agent reporting for {system}", "system", systemName),
+				message: i18n.M("Stats for {system} were rejected because the agent's fingerprint doesn't match the one stored by the hub. If the agent was reinstalled, reset the fingerprint in the system's menu. Otherwise another process may be impersonating it.",
+					"system", systemName),
+				linkText: i18n.M("View {system}", "system", systemName),
+				emoji:    "\U0001F534",
+			},
+		})
+	}
+}
+
+// Sends SMART alerts when a drive's health status changes to or from FAILED
+func (am *AlertManager) HandleSmartAlerts(systemRecord *core.Record, diskName string, mounts []string, smartStatus string) error {
+	systemName := systemRecord.GetString("name")
+	failed := smartStatus == "FAILED"
+	message := i18n.M("SMART health check of {disk} on {system} reported {status}", "disk", diskName, "system", systemName, "status", smartStatus)
+	// name the filesystems on the disk, e.g. "/dev/nvme0 (holding /)"
+	if len(mounts) > 0 {
+		message = i18n.M("SMART health check of {disk} (holding {mounts}) on {system} reported {status}",
+			"disk", diskName, "mounts", strings.Join(mounts, ", "), "system", systemName, "status", smartStatus)
+	}
+	// the alert stays triggered while any other disk of the system has failed
+	active := failed
+	if !failed {
+		count, err := am.app.CountRecords("smart_devices", dbx.HashExp{"system": systemRecord.Id, "state": "FAILED"})
+		if err != nil {
+			return err
+		}
+		active = count > 0
+	}
+	return am.handleStateChangeAlerts(systemRecord, "SMART", failed, active,
+		i18n.M("SMART status of {disk} on {system} is {status}", "disk", diskName, "system", systemName, "status", smartStatus),
+		message,
+	)
+}
+
+// Sends service alerts when a systemd service enters or leaves the failed state.
+// An empty state means the agent no longer reports the service.
+func (am *AlertManager) HandleServiceAlerts(systemRecord *core.Record, serviceName, state string) error {
+	systemName := systemRecord.GetString("name")
+	failed := state == "failed"
+	var title i18n.Message
+	message := i18n.M("Service {service} on {system} is now {state}", "service", serviceName, "system", systemName, "state", state)
+	switch {
+	case failed:
+		title = i18n.M("{service} on {system} entered failed state", "service", serviceName, "system", systemName)
+	case state == "":
+		title = i18n.M("{service} on {system} is no longer reported", "service", serviceName, "system", systemName)
+		message = i18n.M("Service {service} on {system} was removed or is no longer monitored", "service", serviceName, "system", systemName)
+	default:
+		title = i18n.M("{service} on {system} recovered", "service", serviceName, "system", systemName)
+	}
+	// the alert stays triggered while any other service of the system has failed
+	active := failed
+	if !failed {
+		count, err := am.app.CountRecords("systemd_services", dbx.HashExp{"system": systemRecord.Id, "state": "failed"})
+		if err != nil {
+			return err
+		}
+		active = count > 0
+	}
+	return am.handleStateChangeAlerts(systemRecord, "Service", failed, active, title, message)
+}
+
+// Sends port alerts when sockets that weren't in the previous inventory start
+// listening. Each new port is notified once, so the alerts don't stay triggered.
+func (am *AlertManager) HandlePortAlerts(systemRecord *core.Record, newPorts []*ports.Port) error {
+	alertRecords, err := am.app.FindAllRecords("alerts",
+		dbx.HashExp{
+			"system": systemRecord.Id,
+			"name":   "Port",
+		},
+	)
+	if err != nil || len(alertRecords) == 0 {
+		return nil
+	}
+	descriptions := make([]string, 0, len(newPorts))
+	for _, port := range newPorts {
+		description := port.Key()
+		if port.Process != "" {
+			description += " (" + port.Process + ")"
+		}
+		descriptions = append(descriptions, description)
+	}
+	systemName := systemRecord.GetString("name")
+	link := am.systemLink(systemName, "", time.Now(), eventLinkWindow)
+	for _, alertRecord := range alertRecords {
+		am.recordAlertHistory(alertRecord, true, float64(len(newPorts)))
+		am.recordAlertHistory(alertRecord, false, 0)
+		am.sendAlert(AlertMessageData{
+			UserID:   alertRecord.GetString("user"),
+			systemId: systemRecord.Id,
+			Link:     link,
+			Data: TemplateData{
+				System: systemName,
+				Metric: "Port",
+				Value:  strings.Join(descriptions, ", "),
+				Status: "triggered",
+				URL:    link,
+			},
+			text: &alertText{
+				title: i18n.M("{count, plural, one {# new listening port} other {# new listening ports}} on {system}",
+					"count", len(newPorts), "system", systemName),
+				message:  i18n.M("Started listening on {system}: {ports}", "system", systemName, "ports", strings.Join(descriptions, ", ")),
+				linkText: i18n.M("View {system}", "system", systemName),
+				emoji:    "\U0001F534",
+			},
+		})
+	}
+	return nil
+}
+
+// Sends HTTP alerts when a container health check goes down or recovers
+func (am *AlertManager) HandleHealthCheckAlerts(systemRecord *core.Record, result *healthcheck.Result) error {
+	systemName := systemRecord.GetString("name")
+	down := result.Status == healthcheck.StatusDown
+	var title, message i18n.Message
+	if down {
+		title = i18n.M("{name} on {system} is down", "name", result.Name, "system", systemName)
+		message = i18n.M("Health check of {url} failed: {error}", "url", result.URL, "error", result.Error)
+	} else {
+		title = i18n.M("{name} on {system} is up", "name", result.Name, "system", systemName)
+		message = i18n.M("Health check of {url} succeeded with status {code}", "url", result.URL, "code", result.StatusCode)
+	}
+	return am.handleStateChangeAlerts(systemRecord, "HTTP", down, down, title, message)
+}
+
+// Sends a notification to the owner of a user defined check when it goes down
+// or recovers
+func (am *AlertManager) HandleCheckAlerts(checkRecord *core.Record, result *healthcheck.Result) error {
+	name := checkRecord.GetString("name")
+	down := result.Status == healthcheck.StatusDown
+	var title, message i18n.Message
+	emoji, status := "\U0001F534", "triggered"
+	if down {
+		title = i18n.M("{name} is down", "name", name)
+		message = i18n.M("Health check of {url} failed: {error}", "url", result.URL, "error", result.Error)
+	} else {
+		title = i18n.M("{name} is up", "name", name)
+		message = i18n.M("Health check of {url} succeeded", "url", result.URL)
+		if result.StatusCode != 0 {
+			message = i18n.M("Health check of {url} succeeded with status {code}", "url", result.URL, "code", result.StatusCode)
+		}
+		emoji, status = "\u2705", "resolved"
+	}
+	// checks run by an agent use the system's quiet hours
+	systemName := ""
+	if systemRecord, err := am.app.FindRecordById("systems", checkRecord.GetString("system")); err == nil {
+		systemName = systemRecord.GetString("name")
+	}
+	link := am.app.Settings().Meta.AppURL + "/settings/checks"
+	am.sendAlert(AlertMessageData{
+		UserID:   checkRecord.GetString("user"),
+		systemId: checkRecord.GetString("system"),
+		Link:     link,
+		Data: TemplateData{
+			System: systemName,
+			Metric: "Check",
+			Value:  result.Status,
+			Status: status,
+			URL:    link,
+		},
+		text: &alertText{
+			title:    title,
+			message:  message,
+			linkText: i18n.M("View checks"),
+			emoji:    emoji,
+		},
+	})
+	return nil
+}
+
+// Sends alerts for a state change to users with a matching alert on the system.
+// Triggered is the new state of the thing that changed, while active is the
+// state of the alert, which can cover several things, like the disks of a system.
+func (am *AlertManager) handleStateChangeAlerts(systemRecord *core.Record, alertName string, triggered, active bool, title, message i18n.Message) error {
+	alertRecords, err := am.app.FindAllRecords("alerts",
+		dbx.HashExp{
+			"system": systemRecord.Id,
+			"name":   alertName,
+		},
+	)
+	if err != nil || len(alertRecords) == 0 {
+		return nil
+	}
+	emoji := "\U0001F534"
+	if !triggered {
+		emoji = "\u2705"
+	}
+	systemName := systemRecord.GetString("name")
+	link := am.systemLink(systemName, alertName, time.Now(), eventLinkWindow)
+	status := "resolved"
+	if triggered {
+		status = "triggered"
+	}
+	for _, alertRecord := range alertRecords {
+		// expand the user relation
+		if errs := am.app.ExpandRecord(alertRecord, []string{"user"}, nil); len(errs) > 0 {
+			return fmt.Errorf("failed to expand: %v", errs)
+		}
+		user := alertRecord.ExpandedOne("user")
+		if user == nil {
+			continue
+		}
+		if alertRecord.GetBool("triggered") != active {
+			alertRecord.Set("triggered", active)
+			if err := am.app.Save(alertRecord); err != nil {
+				return err
+			}
+			am.recordAlertHistory(alertRecord, active, 0)
+		}
+		am.sendAlert(AlertMessageData{
+			UserID:   user.Id,
+			systemId: systemRecord.Id,
+			Link:     link,
+			Data: TemplateData{
+				System: systemName,
+				Metric: alertName,
+				Status: status,
+				URL:    link,
+			},
+			text: &alertText{
+				title:    title,
+				message:  message,
+				linkText: i18n.M("View {system}", "system", systemName),
+				emoji:    emoji,
+			},
 		})
 	}
 	return nil
 }
 
 func (am *AlertManager) sendAlert(data AlertMessageData) {
+	if data.text != nil && data.Title == "" {
+		data.Title = data.text.title.String()
+	}
+	// skip sending if notifications are globally silenced
+	if silence := am.ActiveSilence(); silence != nil {
+		am.logger.Info("Notification silenced", "title", data.Title, "until", silence.GetDateTime("expires").String())
+		return
+	}
+	// skip sending during the user's quiet hours (alert state is still saved)
+	if quiet := am.activeQuietHours(data.UserID, data.systemId); quiet != nil {
+		am.logger.Info("Notification suppressed by quiet hours", "title", data.Title, "user", data.UserID, "window", quiet.GetString("name"))
+		return
+	}
 	// get user settings
 	record, err := am.app.FindFirstRecordByFilter(
 		"user_settings", "user={:user}",
 		dbx.Params{"user": data.UserID},
 	)
 	if err != nil {
-		am.app.Logger().Error("Failed to get user settings", "err", err.Error())
+		am.logger.Error("Failed to get user settings", "err", err.Error())
 		return
 	}
 	// unmarshal user settings
@@ -413,37 +1172,42 @@ func (am *AlertManager) sendAlert(data AlertMessageData) {
 		Webhooks: []string{},
 	}
 	if err := record.UnmarshalJSONField("settings", &userAlertSettings); err != nil {
-		am.app.Logger().Error("Failed to unmarshal user settings", "err", err.Error())
+		am.logger.Error("Failed to unmarshal user settings", "err", err.Error())
+	}
+	if err := secrets.DecryptAll(userAlertSettings.Webhooks); err != nil {
+		am.logger.Error("Failed to decrypt webhooks", "err", err.Error())
+		userAlertSettings.Webhooks = nil
 	}
-	// send alerts via webhooks
+	if data.time.IsZero() {
+		data.time = time.Now()
+	}
+	data = newFormatter(userAlertSettings).localize(data)
+	// queue notifications for webhooks
 	for _, webhook := range userAlertSettings.Webhooks {
-		if err := am.SendShoutrrrAlert(webhook, data.Title, data.Message, data.Link, data.LinkText); err != nil {
-			am.app.Logger().Error("Failed to send shoutrrr alert", "err", err.Error())
-		}
+		channel := webhookChannel(webhook)
+		title, message := am.renderForChannel(userAlertSettings, channel, data)
+		am.enqueueNotification(data.UserID, channel, webhook, title, message, data.Link, data.LinkText)
 	}
-	// send alerts via email
+	// queue notification for email addresses
 	if len(userAlertSettings.Emails) == 0 {
-		// log.Println("No email addresses found")
 		return
 	}
-	addresses := []mail.Address{}
-	for _, email := range userAlertSettings.Emails {
-		addresses = append(addresses, mail.Address{Address: email})
-	}
-	message := mailer.Message{
-		To:      addresses,
-		Subject: data.Title,
-		Text:    data.Message + fmt.Sprintf("\n\n%s", data.Link),
-		From: mail.Address{
-			Address: am.app.Settings().Meta.SenderAddress,
-			Name:    am.app.Settings().Meta.SenderName,
-		},
+	title, text := am.renderForChannel(userAlertSettings, ChannelEmail, data)
+	am.enqueueNotification(data.UserID, ChannelEmail, strings.Join(userAlertSettings.Emails, ","), title, text, data.Link, data.LinkText)
+}
+
+// Returns the title and message for a channel, using the user's template if one is set
+func (am *AlertManager) renderForChannel(settings UserNotificationSettings, channel string, data AlertMessageData) (string, string) {
+	t, ok := am.templateFor(settings, channel)
+	if !ok || data.Data.Title == "" {
+		return data.Title, data.Message
 	}
-	if err := am.app.NewMailClient().Send(&message); err != nil {
-		am.app.Logger().Error("Failed to send alert: ", "err", err.Error())
-	} else {
-		am.app.Logger().Info("Sent email alert", "to", message.To, "subj", message.Subject)
+	title, message, err := t.Render(data.Data)
+	if err != nil {
+		am.logger.Error("Failed to render notification template", "channel", channel, "err", err.Error())
+		return data.Title, data.Message
 	}
+	return title, message
 }
 
 // SendShoutrrrAlert sends an alert via a Shoutrrr URL
@@ -493,9 +1257,9 @@ func (am *AlertManager) SendShoutrrrAlert(notificationUrl, title, message, link,
 	err = shoutrrr.Send(parsedURL.String(), message)
 
 	if err == nil {
-		am.app.Logger().Info("Sent shoutrrr alert", "title", title)
+		am.logger.Info("Sent shoutrrr alert", "title", title)
 	} else {
-		am.app.Logger().Error("Error sending shoutrrr alert", "err", err.Error())
+		am.logger.Error("Error sending shoutrrr alert", "err", err.Error())
 		return err
 	}
 	return nil
@@ -521,9 +1285,22 @@ func (am *AlertManager) SendTestNotification(e *core.RequestEvent) error {
 	if url == "" {
 		return e.JSON(200, map[string]string{"err": "URL is required"})
 	}
-	err := am.SendShoutrrrAlert(url, "Test Alert", "This is a notification from Beszel.", am.app.Settings().Meta.AppURL, "View Beszel")
+	p := i18n.NewPrinter(am.userLocale(info.Auth.Id))
+	err := am.SendShoutrrrAlert(url, p.T(i18n.M("Test Alert")), p.T(i18n.M("This is a notification from Beszel.")),
+		am.app.Settings().Meta.AppURL, p.T(i18n.M("View Beszel")))
 	if err != nil {
 		return e.JSON(200, map[string]string{"err": err.Error()})
 	}
 	return e.JSON(200, map[string]bool{"err": false})
 }
+
+// Returns the locale from a user's notification settings
+func (am *AlertManager) userLocale(userID string) string {
+	record, err := am.app.FindFirstRecordByFilter("user_settings", "user={:user}", dbx.Params{"user": userID})
+	if err != nil {
+		return ""
+	}
+	var settings UserNotificationSettings
+	record.UnmarshalJSONField("settings", &settings)
+	return settings.Locale
+}
@@ -0,0 +1,233 @@
+package alerts
+
+import (
+	"beszel/internal/i18n"
+	"beszel/internal/secrets"
+	"cmp"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/containrrr/shoutrrr"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+)
+
+const (
+	// Admins are notified once a channel has been failing for this long
+	channelFailureNotifyAfter = 3 * time.Hour
+	// Time allowed for an SMTP handshake or webhook ping
+	channelCheckTimeout = 15 * time.Second
+	// Key of the SMTP server's record, which has no user
+	smtpChannelKey = "smtp"
+)
+
+// Verifies notification channels so admins find out about broken alerting
+// before an alert is missed. The SMTP server gets a handshake (with auth for
+// PLAIN) and generic webhooks get a ping payload. Other services aren't
+// pinged, as that would post a message to a chat, so their health comes from
+// the result of real notifications. Runs every hour.
+func (am *AlertManager) CheckNotificationChannels() error {
+	records, err := am.app.FindAllRecords("notification_channels")
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]*core.Record, len(records))
+	for _, record := range records {
+		existing[record.GetString("user")+"/"+record.GetString("key")] = record
+	}
+	configured := make(map[string]bool)
+
+	if config := am.app.Settings().SMTP; config.Enabled {
+		configured["/"+smtpChannelKey] = true
+		am.saveChannelHealth("", smtpChannelKey, config.Host, ChannelEmail, am.checkSMTP())
+	}
+	userSettings, err := am.app.FindAllRecords("user_settings")
+	if err != nil {
+		return err
+	}
+	for _, record := range userSettings {
+		var settings UserNotificationSettings
+		if err := record.UnmarshalJSONField("settings", &settings); err != nil {
+			continue
+		}
+		if err := secrets.DecryptAll(settings.Webhooks); err != nil {
+			am.logger.Error("Failed to decrypt webhooks", "user", record.GetString("user"), "err", err.Error())
+			continue
+		}
+		user := record.GetString("user")
+		for _, webhook := range settings.Webhooks {
+			key, name := webhookKey(webhook)
+			configured[user+"/"+key] = true
+			if webhookChannel(webhook) == ChannelWebhook {
+				am.saveChannelHealth(user, key, name, ChannelWebhook, pingWebhook(webhook))
+			}
+		}
+	}
+
+	// remove channels that are no longer configured
+	for key, record := range existing {
+		if !configured[key] {
+			if err := am.app.Delete(record); err != nil {
+				am.logger.Error("Failed to delete notification channel", "err", err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// Saves the result of a check or notification for a channel, and notifies
+// admins when it has been failing for too long or works again
+func (am *AlertManager) saveChannelHealth(user, key, name, channel string, sendErr error) {
+	am.channelsMutex.Lock()
+	defer am.channelsMutex.Unlock()
+
+	record, err := am.app.FindFirstRecordByFilter("notification_channels", "user = {:user} && key = {:key}", dbx.Params{"user": user, "key": key})
+	if err != nil {
+		collection, err := am.app.FindCachedCollectionByNameOrId("notification_channels")
+		if err != nil {
+			return
+		}
+		record = core.NewRecord(collection)
+		record.Set("user", user)
+		record.Set("key", key)
+		record.Set("type", channel)
+	}
+	now := time.Now().UTC()
+	record.Set("name", name)
+	record.Set("checked", now)
+	record.Set("healthy", sendErr == nil)
+
+	var notify func(label string) (title, message i18n.Message)
+	if sendErr == nil {
+		if record.GetBool("notified") {
+			notify = func(label string) (i18n.Message, i18n.Message) {
+				return i18n.M("Notification channel recovered"),
+					i18n.M("Notifications to {channel} are delivered again.", "channel", label)
+			}
+		}
+		record.Set("error", "")
+		record.Set("failing_since", "")
+		record.Set("notified", false)
+	} else {
+		record.Set("error", sendErr.Error())
+		failingSince := record.GetDateTime("failing_since")
+		if failingSince.IsZero() {
+			record.Set("failing_since", now)
+		} else if failing := now.Sub(failingSince.Time()); failing >= channelFailureNotifyAfter && !record.GetBool("notified") {
+			record.Set("notified", true)
+			notify = func(label string) (i18n.Message, i18n.Message) {
+				return i18n.M("Notification channel failing"),
+					i18n.M("Notifications to {channel} have failed for {hours, plural, one {# hour} other {# hours}}: {error}",
+						"channel", label, "hours", int(math.Round(failing.Hours())), "error", sendErr.Error())
+			}
+		}
+	}
+	if err := am.app.Save(record); err != nil {
+		am.logger.Error("Failed to save notification channel", "err", err.Error())
+		return
+	}
+	if notify == nil {
+		return
+	}
+	label := name
+	if owner, err := am.app.FindRecordById("users", user); err == nil {
+		label += " (" + owner.GetString("email") + ")"
+	}
+	if err := am.NotifyAdmins(notify(label)); err != nil {
+		am.logger.Error("Failed to notify admins", "err", err.Error())
+	}
+}
+
+// Saves the result of sending an email, if it was sent with the SMTP server
+func (am *AlertManager) saveEmailHealth(sendErr error) {
+	if config := am.app.Settings().SMTP; config.Enabled {
+		am.saveChannelHealth("", smtpChannelKey, config.Host, ChannelEmail, sendErr)
+	}
+}
+
+// Returns the key of a webhook, which is a hash so the URL's tokens aren't
+// stored twice, and a name without its credentials or path
+func webhookKey(notificationUrl string) (key, name string) {
+	sum := sha256.Sum256([]byte(notificationUrl))
+	key = hex.EncodeToString(sum[:])
+	name = notificationUrl
+	if parsedURL, err := url.Parse(notificationUrl); err == nil {
+		name = parsedURL.Scheme + "://" + parsedURL.Hostname()
+	}
+	return key, name
+}
+
+// Connects to the SMTP server and checks that it accepts a session, upgrading
+// to TLS and authenticating as the hub would when sending mail. LOGIN auth
+// isn't tested, as net/smtp only implements PLAIN.
+func (am *AlertManager) checkSMTP() error {
+	config := am.app.Settings().SMTP
+	address := net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+	dialer := &net.Dialer{Timeout: channelCheckTimeout}
+	tlsConfig := &tls.Config{ServerName: config.Host}
+	var conn net.Conn
+	var err error
+	if config.TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(channelCheckTimeout))
+	client, err := smtp.NewClient(conn, config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if err := client.Hello(cmp.Or(config.LocalName, "localhost")); err != nil {
+		return err
+	}
+	if ok, _ := client.Extension("STARTTLS"); ok && !config.TLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if ok, _ := client.Extension("AUTH"); ok && config.Username != "" && config.AuthMethod != mailer.SMTPAuthLogin {
+		if err := client.Auth(smtp.PlainAuth("", config.Username, config.Password, config.Host)); err != nil {
+			return err
+		}
+	}
+	return client.Quit()
+}
+
+// Sends a ping payload to a generic webhook, which fails unless the server
+// responds with a 2xx status. A JSON template gets the title "Beszel ping".
+func pingWebhook(notificationUrl string) error {
+	parsedURL, err := url.Parse(notificationUrl)
+	if err != nil {
+		return err
+	}
+	queryParams := parsedURL.Query()
+	if queryParams.Has("template") {
+		queryParams.Set("$"+cmp.Or(queryParams.Get("titlekey"), "title"), "Beszel ping")
+	}
+	parsedURL.RawQuery = queryParams.Encode()
+	// shoutrrr's generic service uses an http client without a timeout
+	result := make(chan error, 1)
+	go func() {
+		result <- shoutrrr.Send(parsedURL.String(), "ping")
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(channelCheckTimeout):
+		return errors.New("timed out")
+	}
+}
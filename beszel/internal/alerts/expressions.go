@@ -0,0 +1,25 @@
+package alerts
+
+import (
+	"beszel/internal/entities/system"
+	"beszel/internal/expr"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ParseMetricExpr parses the expression of an Expression alert, whose variables
+// are the named fields of system stats, e.g. mem_used/mem_total*100
+func ParseMetricExpr(s string) (*expr.Expr, error) {
+	return expr.ParseVars(s, system.IsField)
+}
+
+// ValidateExpression rejects Expression alerts with an invalid expression
+func (am *AlertManager) ValidateExpression(e *core.RecordEvent) error {
+	if e.Record.GetString("name") == "Expression" {
+		if _, err := ParseMetricExpr(e.Record.GetString("expression")); err != nil {
+			return apis.NewBadRequestError("Invalid expression: "+err.Error(), nil)
+		}
+	}
+	return e.Next()
+}
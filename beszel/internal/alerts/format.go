@@ -0,0 +1,118 @@
+package alerts
+
+import (
+	"beszel/internal/i18n"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Unit systems for sizes in notifications. Agents report sizes in binary units,
+// which are labeled GB / MB by default to match the dashboard.
+const (
+	UnitsDecimal = "decimal" // converted to GB / MB (powers of 1000)
+	UnitsBinary  = "binary"  // labeled GiB / MiB (powers of 1024)
+)
+
+// Numeric value of a system alert, formatted for each recipient when rendered
+type alertValue struct {
+	descriptor i18n.Message
+	value      float64
+	threshold  float64
+	unit       string
+	duration   i18n.Message
+}
+
+// Text of an alert, translated into each recipient's language when rendered
+type alertText struct {
+	title     i18n.Message
+	message   i18n.Message // replaced by the averaged value for system alerts
+	linkText  i18n.Message
+	emoji     string       // appended to the title
+	value     i18n.Message // for alerts without a numeric value
+	threshold i18n.Message
+}
+
+// formatter formats numbers, sizes and times using a user's notification preferences
+type formatter struct {
+	printer    *message.Printer
+	translator *i18n.Printer
+	units      string
+	hour12     bool
+}
+
+func newFormatter(settings UserNotificationSettings) formatter {
+	tag := language.English
+	if settings.Locale != "" {
+		if parsed, err := language.Parse(settings.Locale); err == nil {
+			tag = parsed
+		}
+	}
+	return formatter{
+		printer:    message.NewPrinter(tag),
+		translator: i18n.NewPrinter(settings.Locale),
+		units:      settings.Units,
+		hour12:     settings.TimeFormat == "12h",
+	}
+}
+
+// Formats a number with two decimals using the locale's separators
+func (f formatter) number(v float64) string {
+	return f.printer.Sprintf("%.2f", v)
+}
+
+// Formats a value with its unit, converting sizes to the preferred unit system
+func (f formatter) quantity(v float64, unit string) string {
+	switch strings.TrimSpace(unit) {
+	case "GB":
+		if f.units == UnitsBinary {
+			unit = " GiB"
+		} else if f.units == UnitsDecimal {
+			v *= 1.073741824
+		}
+	case "MB/s":
+		if f.units == UnitsBinary {
+			unit = " MiB/s"
+		} else if f.units == UnitsDecimal {
+			v *= 1.048576
+		}
+	}
+	return f.number(v) + unit
+}
+
+// Formats a time in UTC using a 24 or 12 hour clock
+func (f formatter) time(t time.Time) string {
+	if f.hour12 {
+		return t.UTC().Format("2006-01-02 3:04 PM UTC")
+	}
+	return t.UTC().Format("2006-01-02 15:04 UTC")
+}
+
+// Fills in the text and values of a message that depend on the user's preferences
+func (f formatter) localize(data AlertMessageData) AlertMessageData {
+	data.Data.Time = f.time(data.time)
+	if t := data.text; t != nil {
+		data.Title = f.translator.T(t.title)
+		if t.emoji != "" {
+			data.Title += " " + t.emoji
+		}
+		data.Message = f.translator.T(t.message)
+		data.LinkText = f.translator.T(t.linkText)
+		if !t.value.IsZero() {
+			data.Data.Value = f.translator.T(t.value)
+			data.Data.Threshold = f.translator.T(t.threshold)
+		}
+		data.Data.Title, data.Data.Message = data.Title, data.Message
+	}
+	if v := data.value; v != nil {
+		data.Data.Value = f.quantity(v.value, v.unit)
+		data.Data.Threshold = f.quantity(v.threshold, v.unit)
+		data.Data.Duration = f.translator.T(v.duration)
+		data.Message = f.translator.T(i18n.M("{metric} averaged {value} for the previous {duration}.",
+			"metric", v.descriptor, "value", data.Data.Value, "duration", data.Data.Duration))
+		data.Data.Message = data.Message
+	}
+	return data
+}
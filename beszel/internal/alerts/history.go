@@ -0,0 +1,126 @@
+package alerts
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Records an alert triggering in alerts_history, or sets the resolution time
+// of its open entry when it resolves. value is zero for state change alerts.
+func (am *AlertManager) recordAlertHistory(alertRecord *core.Record, triggered bool, value float64) {
+	if !triggered {
+		entry, err := am.app.FindFirstRecordByFilter("alerts_history", "alert={:alert} && resolved=''", dbx.Params{"alert": alertRecord.Id})
+		if err != nil {
+			return
+		}
+		entry.Set("resolved", types.NowDateTime())
+		if err := am.app.SaveNoValidate(entry); err != nil {
+			am.logger.Error("Failed to save alert history", "err", err.Error())
+		}
+		return
+	}
+	collection, err := am.app.FindCachedCollectionByNameOrId("alerts_history")
+	if err != nil {
+		am.logger.Error("Failed to get alerts_history collection", "err", err.Error())
+		return
+	}
+	entry := core.NewRecord(collection)
+	entry.Set("alert", alertRecord.Id)
+	entry.Set("user", alertRecord.GetString("user"))
+	entry.Set("system", alertRecord.GetString("system"))
+	entry.Set("name", alertRecord.GetString("name"))
+	entry.Set("project", alertRecord.GetString("project"))
+	entry.Set("value", math.Round(value*100)/100)
+	entry.Set("threshold", alertRecord.GetFloat("value"))
+	if err := am.app.SaveNoValidate(entry); err != nil {
+		am.logger.Error("Failed to save alert history", "err", err.Error())
+	}
+}
+
+// Number of times an alert triggered in a period and how long it was active
+type alertHistorySummary struct {
+	System   string  `json:"system"`
+	Name     string  `json:"name"`
+	Project  string  `json:"project,omitempty"`
+	Count    int     `json:"count"`
+	Duration float64 `json:"duration"` // seconds triggered within the period
+	MaxValue float64 `json:"max_value"`
+}
+
+// API endpoint that summarizes the user's alert history by system and alert.
+// Query params: system (optional), from and to (dates, default the last 30 days).
+func (am *AlertManager) HandleHistorySummary(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	query := e.Request.URL.Query()
+	to := time.Now().UTC()
+	if value := query.Get("to"); value != "" {
+		parsed, err := types.ParseDateTime(value)
+		if err != nil {
+			return apis.NewBadRequestError("Invalid to date", err)
+		}
+		to = parsed.Time()
+	}
+	from := to.AddDate(0, 0, -30)
+	if value := query.Get("from"); value != "" {
+		parsed, err := types.ParseDateTime(value)
+		if err != nil {
+			return apis.NewBadRequestError("Invalid from date", err)
+		}
+		from = parsed.Time()
+	}
+
+	// include entries that started before the period but were still active in it
+	filter := "user={:user} && created < {:to} && (resolved = '' || resolved > {:from})"
+	params := dbx.Params{
+		"user": info.Auth.Id,
+		"from": from.Format(types.DefaultDateLayout),
+		"to":   to.Format(types.DefaultDateLayout),
+	}
+	if system := query.Get("system"); system != "" {
+		filter += " && system={:system}"
+		params["system"] = system
+	}
+	entries, err := am.app.FindRecordsByFilter("alerts_history", filter, "created", 0, 0, params)
+	if err != nil {
+		return err
+	}
+
+	summaries := make(map[string]*alertHistorySummary)
+	result := make([]*alertHistorySummary, 0)
+	for _, entry := range entries {
+		key := entry.GetString("system") + "|" + entry.GetString("name") + "|" + entry.GetString("project")
+		summary, ok := summaries[key]
+		if !ok {
+			summary = &alertHistorySummary{
+				System:  entry.GetString("system"),
+				Name:    entry.GetString("name"),
+				Project: entry.GetString("project"),
+			}
+			summaries[key] = summary
+			result = append(result, summary)
+		}
+		start := entry.GetDateTime("created").Time()
+		end := to
+		if resolved := entry.GetDateTime("resolved"); !resolved.IsZero() && resolved.Time().Before(to) {
+			end = resolved.Time()
+		}
+		if start.Before(from) {
+			start = from
+		} else {
+			// only count triggers within the period
+			summary.Count++
+		}
+		summary.Duration += math.Max(0, end.Sub(start).Seconds())
+		summary.MaxValue = math.Max(summary.MaxValue, entry.GetFloat("value"))
+	}
+	return e.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,231 @@
+package alerts
+
+import (
+	"beszel/internal/entities/container"
+	"beszel/internal/i18n"
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// The alert window is split into this many parts, and average memory has to
+	// grow from each part to the next. A plateau in any part resets the alert.
+	leakSegments = 6
+	// Each part has to grow by at least this fraction of the first part's memory
+	leakMinStepGrowth = 0.005
+	// Total growth needed over the window, as a fraction and in MB, so small or
+	// idle containers don't trigger on noise
+	leakMinGrowth   = 0.1
+	leakMinGrowthMB = 20
+	// Shortest window in hours
+	leakMinHours = 3
+)
+
+// Container whose memory grew steadily over the alert window
+type memoryLeak struct {
+	name   string
+	growth float64 // percent
+}
+
+// Sends memory leak advisories for systems where the memory of a container
+// grew in every part of the alert window (value in hours), using the stored
+// container stats. The alert resolves when no container keeps growing.
+func (am *AlertManager) HandleMemoryLeakAlerts() error {
+	alertRecords, err := am.app.FindAllRecords("alerts", dbx.HashExp{"name": "MemoryLeak"})
+	if err != nil || len(alertRecords) == 0 {
+		return err
+	}
+	now := time.Now().UTC()
+	// users with the same window on a system share the result
+	type leakKey struct {
+		system string
+		hours  int
+	}
+	results := make(map[leakKey][]memoryLeak)
+	for _, alertRecord := range alertRecords {
+		systemRecord, err := am.app.FindRecordById("systems", alertRecord.GetString("system"))
+		if err != nil {
+			continue
+		}
+		triggered := alertRecord.GetBool("triggered")
+		if systemRecord.GetString("status") != "up" {
+			continue
+		}
+		hours := max(leakMinHours, alertRecord.GetInt("value"))
+		key := leakKey{systemRecord.Id, hours}
+		leaks, ok := results[key]
+		if !ok {
+			if leaks, err = am.findMemoryLeaks(systemRecord.Id, hours, now); err != nil {
+				return err
+			}
+			results[key] = leaks
+		}
+		leaking := len(leaks) > 0
+		if leaking == triggered {
+			continue
+		}
+		if leaking && inCooldown(alertRecord, now) {
+			continue
+		}
+		var maxGrowth float64
+		containers := make([]string, 0, len(leaks))
+		for _, leak := range leaks {
+			maxGrowth = max(maxGrowth, leak.growth)
+			containers = append(containers, fmt.Sprintf("%s (+%.0f%%)", leak.name, leak.growth))
+		}
+		if !leaking {
+			alertRecord.Set("resolved", now)
+		}
+		alertRecord.Set("triggered", leaking)
+		if err := am.app.Save(alertRecord); err != nil {
+			return err
+		}
+		am.recordAlertHistory(alertRecord, leaking, maxGrowth)
+		if errs := am.app.ExpandRecord(alertRecord, []string{"user"}, nil); len(errs) > 0 {
+			return fmt.Errorf("failed to expand: %v", errs)
+		}
+		user := alertRecord.ExpandedOne("user")
+		if user == nil {
+			continue
+		}
+		systemName := systemRecord.GetString("name")
+		duration := i18n.M("{hours, plural, one {# hour} other {# hours}}", "hours", hours)
+		text := &alertText{
+			linkText:  i18n.M("View {system}", "system", systemName),
+			threshold: duration,
+		}
+		status := "resolved"
+		if leaking {
+			text.title = i18n.M("Possible memory leak on {system}", "system", systemName)
+			text.message = i18n.M("Memory of {containers} on {system} grew steadily over the last {hours, plural, one {# hour} other {# hours}}.",
+				"containers", strings.Join(containers, ", "), "system", systemName, "hours", hours)
+			text.value = i18n.Raw(fmt.Sprintf("+%.0f%%", maxGrowth))
+			text.emoji = "\u26A0\uFE0F"
+			status = "triggered"
+		} else {
+			text.title = i18n.M("Memory of containers on {system} stopped growing", "system", systemName)
+			text.message = i18n.M("No container on {system} grew steadily over the last {hours, plural, one {# hour} other {# hours}}.",
+				"system", systemName, "hours", hours)
+			text.emoji = "\u2705"
+		}
+		link := am.systemLink(systemName, "MemoryLeak", time.Now(), time.Duration(hours)*time.Hour)
+		am.sendAlert(AlertMessageData{
+			UserID:   user.Id,
+			systemId: systemRecord.Id,
+			Link:     link,
+			Data: TemplateData{
+				System: systemName,
+				Metric: "MemoryLeak",
+				Status: status,
+				URL:    link,
+			},
+			text: text,
+		})
+	}
+	return nil
+}
+
+// Returns the containers of a system whose memory grew steadily over the last
+// hours, largest growth first. Containers that weren't running for the whole
+// window are skipped.
+func (am *AlertManager) findMemoryLeaks(systemId string, hours int, now time.Time) ([]memoryLeak, error) {
+	window := time.Duration(hours) * time.Hour
+	recordType, interval := leakRecordType(window)
+	start := now.Add(-window)
+	records := []struct {
+		Stats   []byte         `db:"stats"`
+		Created types.DateTime `db:"created"`
+	}{}
+	err := am.app.DB().
+		Select("stats", "created").
+		From("container_stats").
+		Where(dbx.NewExp(
+			"system={:system} AND type={:type} AND created > {:created}",
+			dbx.Params{"system": systemId, "type": recordType, "created": start.Format(types.DefaultDateLayout)},
+		)).
+		OrderBy("created").
+		All(&records)
+	// skip if the history doesn't cover the window yet
+	if err != nil || len(records) < leakSegments*2 || records[0].Created.Time().After(start.Add(interval*3/2)) {
+		return nil, err
+	}
+	series := make(map[string][]float64)
+	var stats []container.Stats
+	for _, record := range records {
+		stats = stats[:0]
+		if err := json.Unmarshal(record.Stats, &stats); err != nil {
+			return nil, err
+		}
+		for _, stat := range stats {
+			series[stat.Name] = append(series[stat.Name], stat.Mem)
+		}
+	}
+	var leaks []memoryLeak
+	for name, values := range series {
+		// allow a few missed records, but not a container that started or stopped
+		if len(values) < len(records)*9/10 {
+			continue
+		}
+		if growth, ok := leakGrowth(values); ok {
+			leaks = append(leaks, memoryLeak{name: name, growth: growth})
+		}
+	}
+	slices.SortFunc(leaks, func(a, b memoryLeak) int {
+		return cmp.Or(cmp.Compare(b.growth, a.growth), strings.Compare(a.name, b.name))
+	})
+	return leaks, nil
+}
+
+// Returns the finest record type whose default retention covers the window,
+// and its interval
+func leakRecordType(window time.Duration) (string, time.Duration) {
+	switch {
+	case window <= 12*time.Hour:
+		return "10m", 10 * time.Minute
+	case window <= 24*time.Hour:
+		return "20m", 20 * time.Minute
+	case window <= 7*24*time.Hour:
+		return "120m", 2 * time.Hour
+	default:
+		return "480m", 8 * time.Hour
+	}
+}
+
+// Returns the growth in percent of a memory series (MB) if its average grew
+// from each part of the series to the next, without a plateau, and by enough
+// in total to not be noise
+func leakGrowth(values []float64) (float64, bool) {
+	if len(values) < leakSegments*2 {
+		return 0, false
+	}
+	var averages [leakSegments]float64
+	for i := range leakSegments {
+		part := values[i*len(values)/leakSegments : (i+1)*len(values)/leakSegments]
+		var sum float64
+		for _, v := range part {
+			sum += v
+		}
+		averages[i] = sum / float64(len(part))
+	}
+	first, last := averages[0], averages[leakSegments-1]
+	if first <= 0 {
+		return 0, false
+	}
+	for i := 1; i < leakSegments; i++ {
+		if averages[i]-averages[i-1] < first*leakMinStepGrowth {
+			return 0, false
+		}
+	}
+	if last-first < leakMinGrowthMB || last-first < first*leakMinGrowth {
+		return 0, false
+	}
+	return math.Round((last-first)/first*100*10) / 10, true
+}
@@ -0,0 +1,74 @@
+package alerts
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Chart anchors on the system page for each alert name
+var chartAnchors = map[string]string{
+	"CPU":              "cpu",
+	"Memory":           "memory",
+	"Swap":             "swap",
+	"Disk":             "disk",
+	"Bandwidth":        "bandwidth",
+	"NIC":              "nic",
+	"Temperature":      "temperature",
+	"Voltage":          "voltage",
+	"GPU Memory":       "gpu",
+	"GPU Engine":       "gpu",
+	"LoadAvg1":         "load",
+	"LoadAvg5":         "load",
+	"LoadAvg15":        "load",
+	"File Descriptors": "fd",
+	"CPU Pressure":     "pressure",
+	"Memory Pressure":  "pressure",
+	"IO Pressure":      "pressure",
+	"Entropy":          "entropy",
+	"Latency":          "latency",
+	"Packet Loss":      "latency",
+	"MemoryLeak":       "container-memory",
+}
+
+// Chart time ranges available in the UI, from shortest to longest
+var chartTimes = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"1h", time.Hour},
+	{"12h", 12 * time.Hour},
+	{"24h", 24 * time.Hour},
+	{"1w", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// Window shown by links of alerts about a change at a single point in time,
+// like a status change or new listening ports
+const eventLinkWindow = time.Hour
+
+// Returns a link to the system page showing the alert's chart from the start
+// of the alert window to the time of the alert. The chart time range is the
+// shortest that includes the window, for versions of the UI without from and to.
+func (am *AlertManager) systemLink(systemName, alertName string, at time.Time, window time.Duration) string {
+	link := am.app.Settings().Meta.AppURL + "/system/" + url.PathEscape(systemName)
+	if window <= 0 {
+		return link
+	}
+	chartTime := chartTimes[len(chartTimes)-1].name
+	for _, ct := range chartTimes {
+		if window <= ct.duration {
+			chartTime = ct.name
+			break
+		}
+	}
+	link += "?" + url.Values{
+		"t":    {chartTime},
+		"from": {strconv.FormatInt(at.Add(-window).UnixMilli(), 10)},
+		"to":   {strconv.FormatInt(at.UnixMilli(), 10)},
+	}.Encode()
+	if anchor, ok := chartAnchors[alertName]; ok {
+		link += "#" + anchor
+	}
+	return link
+}
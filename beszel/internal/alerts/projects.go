@@ -0,0 +1,154 @@
+package alerts
+
+import (
+	"beszel/internal/entities/container"
+	"beszel/internal/i18n"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/cast"
+)
+
+// Returns the total cpu and memory usage of each docker compose project.
+// Memory is converted to a percentage of the system's memory (memTotal in GB).
+func projectUsage(containers []container.Stats, memTotal float64) map[string][2]float64 {
+	usage := make(map[string][2]float64)
+	for _, c := range containers {
+		if c.Project == "" {
+			continue
+		}
+		u := usage[c.Project]
+		u[0] += c.Cpu
+		if memTotal > 0 {
+			u[1] += c.Mem / (memTotal * 1024) * 100
+		}
+		usage[c.Project] = u
+	}
+	return usage
+}
+
+// Handles CPU and Memory alerts that target a docker compose project instead of the whole system.
+// Values are the sums of the project's containers, averaged over the alert's duration.
+func (am *AlertManager) HandleProjectAlerts(systemRecord *core.Record, containers []*container.Stats, memTotal float64) error {
+	alertRecords, err := am.app.FindAllRecords("alerts",
+		dbx.NewExp("system={:system} AND project!=''", dbx.Params{"system": systemRecord.Id}),
+	)
+	if err != nil || len(alertRecords) == 0 {
+		return nil
+	}
+
+	current := make([]container.Stats, 0, len(containers))
+	for _, c := range containers {
+		current = append(current, *c)
+	}
+	usage := projectUsage(current, memTotal)
+
+	var validAlerts []SystemAlertData
+	now := systemRecord.GetDateTime("updated").Time().UTC()
+	oldestTime := now
+
+	for _, alertRecord := range alertRecords {
+		name := alertRecord.GetString("name")
+		project := alertRecord.GetString("project")
+		var val float64
+		switch name {
+		case "CPU":
+			val = usage[project][0]
+		case "Memory":
+			if memTotal == 0 {
+				continue
+			}
+			val = usage[project][1]
+		default:
+			continue
+		}
+		triggered := alertRecord.GetBool("triggered")
+		threshold := alertRecord.GetFloat("value")
+		if triggered == exceedsThreshold(val, threshold, false) {
+			continue
+		}
+		if !triggered && (inCooldown(alertRecord, now) || !inAlertHours(alertRecord, systemRecord, now)) {
+			continue
+		}
+		min := max(1, cast.ToUint8(alertRecord.Get("min")))
+		time := now.Add(-time.Duration(min) * time.Minute)
+		if time.Before(oldestTime) {
+			oldestTime = time
+		}
+		validAlerts = append(validAlerts, SystemAlertData{
+			systemRecord: systemRecord,
+			alertRecord:  alertRecord,
+			name:         name,
+			unit:         "%",
+			threshold:    threshold,
+			triggered:    triggered,
+			time:         time,
+			min:          min,
+			project:      project,
+			descriptor:   i18n.M("{metric} of project {project}", "metric", alertMetricNames[name][0], "project", project),
+		})
+	}
+	if len(validAlerts) == 0 {
+		return nil
+	}
+
+	containerStats := []struct {
+		Stats   []byte         `db:"stats"`
+		Created types.DateTime `db:"created"`
+	}{}
+	err = am.app.DB().
+		Select("stats", "created").
+		From("container_stats").
+		Where(dbx.NewExp(
+			"system={:system} AND type='1m' AND created > {:created}",
+			dbx.Params{
+				"system":  systemRecord.Id,
+				"created": oldestTime.Add(-time.Second * 90),
+			},
+		)).
+		OrderBy("created").
+		All(&containerStats)
+	if err != nil || len(containerStats) == 0 {
+		return err
+	}
+
+	var stats []container.Stats
+	for _, stat := range containerStats {
+		// subtract 10 seconds to give a small time buffer
+		created := stat.Created.Time().Add(-time.Second * 10)
+		stats = stats[:0]
+		if err := json.Unmarshal(stat.Stats, &stats); err != nil {
+			return err
+		}
+		usage := projectUsage(stats, memTotal)
+		for j := range validAlerts {
+			alert := &validAlerts[j]
+			if created.Before(alert.time) {
+				continue
+			}
+			if alert.name == "CPU" {
+				alert.val += usage[alert.project][0]
+			} else {
+				alert.val += usage[alert.project][1]
+			}
+			alert.count++
+		}
+	}
+
+	for _, alert := range validAlerts {
+		// skip if there aren't enough records to cover the alert's duration
+		if alert.count == 0 || float32(alert.count) < float32(alert.min)/1.2 {
+			continue
+		}
+		alert.val = alert.val / float64(alert.count)
+		exceeds := exceedsThreshold(alert.val, alert.threshold, false)
+		if alert.triggered != exceeds {
+			alert.triggered = exceeds
+			go am.sendSystemAlert(alert)
+		}
+	}
+	return nil
+}
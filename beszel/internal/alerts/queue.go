@@ -0,0 +1,288 @@
+package alerts
+
+import (
+	"beszel/internal/secrets"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// Notifications that failed this many times are kept as failed (dead letters)
+	maxNotificationAttempts = 10
+	// Delay before the first retry, doubled after each failed attempt
+	notificationRetryDelay    = 30 * time.Second
+	maxNotificationRetryDelay = time.Hour
+	// Time allowed to deliver a notification. Shoutrrr's generic service uses
+	// an http client without a timeout, which would hold up the queue.
+	notificationSendTimeout = 30 * time.Second
+	// Interval of the queue worker, in addition to running after each new notification
+	notificationQueueInterval = 15 * time.Second
+	// Notifications delivered in one run of the worker
+	notificationQueueBatch = 100
+	// Targets delivered to at the same time in one run of the worker
+	notificationWorkers = 8
+	// Sent and failed notifications are deleted after these many days
+	sentNotificationRetention   = 7
+	failedNotificationRetention = 30
+)
+
+// Returned by deliverNotification if the target didn't respond in time
+var errNotificationTimeout = errors.New("timed out")
+
+// Statuses of notifications in the queue
+const (
+	notificationPending = "pending"
+	notificationSent    = "sent"
+	notificationFailed  = "failed"
+)
+
+// Adds a notification to the queue. The target is a shoutrrr URL, or comma
+// separated email addresses.
+func (am *AlertManager) enqueueNotification(userID, channel, target, title, message, link, linkText string) {
+	collection, err := am.app.FindCachedCollectionByNameOrId("notification_queue")
+	if err != nil {
+		am.logger.Error("Failed to get notification queue", "err", err.Error())
+		return
+	}
+	// webhook urls include credentials
+	encryptedTarget, err := secrets.Encrypt(target)
+	if err != nil {
+		am.logger.Error("Failed to encrypt notification target", "err", err.Error())
+		return
+	}
+	record := core.NewRecord(collection)
+	record.Set("user", userID)
+	record.Set("type", channel)
+	record.Set("target", encryptedTarget)
+	record.Set("title", title)
+	record.Set("message", message)
+	record.Set("link", link)
+	record.Set("link_text", linkText)
+	record.Set("status", notificationPending)
+	record.Set("next_attempt", time.Now().UTC())
+	if err := am.app.Save(record); err != nil {
+		am.logger.Error("Failed to queue notification", "err", err.Error(), "title", title)
+		return
+	}
+	// wake up the worker without waiting for its next tick
+	select {
+	case am.queueSignal <- struct{}{}:
+	default:
+	}
+}
+
+// Delivers queued notifications until stopped. Notifications left in the queue
+// by a previous run of the hub are delivered on start.
+func (am *AlertManager) StartNotificationQueue() {
+	ticker := time.NewTicker(notificationQueueInterval)
+	defer ticker.Stop()
+	for {
+		am.ProcessNotificationQueue()
+		select {
+		case <-ticker.C:
+		case <-am.queueSignal:
+		}
+	}
+}
+
+// Delivers the pending notifications that are due. Notifications for different
+// targets are delivered concurrently, and those for the same target in order.
+// Failed deliveries are retried with exponential backoff, and marked as failed
+// after maxNotificationAttempts so they can be inspected and retried by users.
+func (am *AlertManager) ProcessNotificationQueue() {
+	records, err := am.app.FindRecordsByFilter(
+		"notification_queue",
+		"status = {:status} && next_attempt <= {:now}",
+		"next_attempt",
+		notificationQueueBatch,
+		0,
+		dbx.Params{"status": notificationPending, "now": types.NowDateTime()},
+	)
+	if err != nil {
+		am.logger.Error("Failed to get queued notifications", "err", err.Error())
+		return
+	}
+	// targets are encrypted with a random nonce, so group them by the decrypted value
+	var targets []string
+	byTarget := make(map[string][]*core.Record)
+	for _, record := range records {
+		target, err := secrets.Decrypt(record.GetString("target"))
+		if err != nil {
+			target = record.Id
+		}
+		if _, ok := byTarget[target]; !ok {
+			targets = append(targets, target)
+		}
+		byTarget[target] = append(byTarget[target], record)
+	}
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, notificationWorkers)
+	for _, target := range targets {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func() {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			am.deliverNotifications(byTarget[target])
+		}()
+	}
+	wg.Wait()
+}
+
+// Delivers queued notifications of one target in order. If the target times
+// out, the rest are postponed to its next attempt without counting as attempts,
+// so a target that doesn't respond holds up the worker only once.
+func (am *AlertManager) deliverNotifications(records []*core.Record) {
+	for i, record := range records {
+		sendErr := am.deliverNotification(record)
+		now := time.Now().UTC()
+		attempts := record.GetInt("attempts") + 1
+		record.Set("attempts", attempts)
+		switch {
+		case sendErr == nil:
+			record.Set("status", notificationSent)
+			record.Set("sent", now)
+			record.Set("error", "")
+		case attempts >= maxNotificationAttempts:
+			record.Set("status", notificationFailed)
+			record.Set("error", sendErr.Error())
+			am.logger.Error("Notification failed", "title", record.GetString("title"), "attempts", attempts, "err", sendErr.Error())
+		default:
+			delay := min(notificationRetryDelay<<(attempts-1), maxNotificationRetryDelay)
+			record.Set("next_attempt", now.Add(delay))
+			record.Set("error", sendErr.Error())
+			am.logger.Warn("Notification will be retried", "title", record.GetString("title"), "attempts", attempts, "in", delay.String())
+		}
+		if err := am.app.Save(record); err != nil {
+			am.logger.Error("Failed to save queued notification", "err", err.Error())
+		}
+		if errors.Is(sendErr, errNotificationTimeout) {
+			nextAttempt := record.GetDateTime("next_attempt")
+			for _, postponed := range records[i+1:] {
+				postponed.Set("next_attempt", nextAttempt)
+				if err := am.app.Save(postponed); err != nil {
+					am.logger.Error("Failed to save queued notification", "err", err.Error())
+				}
+			}
+			return
+		}
+	}
+}
+
+// Sends a queued notification and saves the health of its channel
+func (am *AlertManager) deliverNotification(record *core.Record) error {
+	userID := record.GetString("user")
+	channel := record.GetString("type")
+	target, err := secrets.Decrypt(record.GetString("target"))
+	if err != nil {
+		return err
+	}
+	title := record.GetString("title")
+	message := record.GetString("message")
+	link := record.GetString("link")
+
+	result := make(chan error, 1)
+	go func() {
+		if channel == ChannelEmail {
+			result <- am.sendEmail(target, title, message, link)
+		} else {
+			result <- am.SendShoutrrrAlert(target, title, message, link, record.GetString("link_text"))
+		}
+	}()
+	select {
+	case err = <-result:
+	case <-time.After(notificationSendTimeout):
+		err = errNotificationTimeout
+	}
+
+	if channel == ChannelEmail {
+		am.saveEmailHealth(err)
+	} else {
+		key, name := webhookKey(target)
+		am.saveChannelHealth(userID, key, name, channel, err)
+	}
+	return err
+}
+
+// Sends an email to comma separated addresses
+func (am *AlertManager) sendEmail(to, subject, text, link string) error {
+	addresses := []mail.Address{}
+	for _, email := range strings.Split(to, ",") {
+		addresses = append(addresses, mail.Address{Address: email})
+	}
+	message := mailer.Message{
+		To:      addresses,
+		Subject: subject,
+		Text:    text + fmt.Sprintf("\n\n%s", link),
+		From: mail.Address{
+			Address: am.app.Settings().Meta.SenderAddress,
+			Name:    am.app.Settings().Meta.SenderName,
+		},
+	}
+	if err := am.app.NewMailClient().Send(&message); err != nil {
+		am.logger.Error("Failed to send alert: ", "err", err.Error())
+		return err
+	}
+	am.logger.Info("Sent email alert", "to", message.To, "subj", message.Subject)
+	return nil
+}
+
+// Deletes sent and failed notifications after their retention period
+func (am *AlertManager) DeleteOldNotifications() error {
+	now := time.Now().UTC()
+	for status, days := range map[string]int{notificationSent: sentNotificationRetention, notificationFailed: failedNotificationRetention} {
+		_, err := am.app.DB().Delete("notification_queue", dbx.NewExp(
+			"status = {:status} AND updated < {:before}",
+			dbx.Params{"status": status, "before": now.AddDate(0, 0, -days).Format(types.DefaultDateLayout)},
+		)).Execute()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// API endpoint that queues a failed notification of the user again (POST with id)
+func (am *AlertManager) RetryNotification(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	var req struct {
+		Id string `json:"id"`
+	}
+	if err := e.BindBody(&req); err != nil || req.Id == "" {
+		return apis.NewBadRequestError("Missing id", err)
+	}
+	record, err := am.app.FindRecordById("notification_queue", req.Id)
+	if err != nil || record.GetString("user") != info.Auth.Id {
+		return apis.NewNotFoundError("Notification not found", nil)
+	}
+	if record.GetString("status") != notificationFailed {
+		return apis.NewBadRequestError("Only failed notifications can be retried", nil)
+	}
+	record.Set("status", notificationPending)
+	record.Set("attempts", 0)
+	record.Set("next_attempt", time.Now().UTC())
+	if err := am.app.Save(record); err != nil {
+		return err
+	}
+	select {
+	case am.queueSignal <- struct{}{}:
+	default:
+	}
+	return e.NoContent(http.StatusNoContent)
+}
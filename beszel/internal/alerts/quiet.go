@@ -0,0 +1,61 @@
+package alerts
+
+import (
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Returns true if the time falls in a quiet hours window. Recurring windows
+// repeat daily or weekly at the local time of the first window in the timezone.
+func inQuietWindow(now, start, end time.Time, repeat, timezone string) bool {
+	if !end.After(start) || now.Before(start) {
+		return false
+	}
+	var days int
+	switch repeat {
+	case "daily":
+		days = 1
+	case "weekly":
+		days = 7
+	default:
+		return now.Before(end)
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	duration := end.Sub(start)
+	start = start.In(loc)
+	now = now.In(loc)
+	// latest window start at or before now, keeping the wall clock time across DST changes
+	elapsed := int(now.Sub(start).Hours()/24) / days * days
+	windowStart := start.AddDate(0, 0, elapsed)
+	if windowStart.After(now) {
+		windowStart = windowStart.AddDate(0, 0, -days)
+	} else if next := windowStart.AddDate(0, 0, days); !next.After(now) {
+		windowStart = next
+	}
+	return now.Before(windowStart.Add(duration))
+}
+
+// Returns the user's quiet hours window that is active for the system, or nil if
+// notifications aren't suppressed. systemId may be empty for notifications about the hub.
+func (am *AlertManager) activeQuietHours(userId, systemId string) *core.Record {
+	records, err := am.app.FindAllRecords("quiet_hours",
+		dbx.NewExp("user={:user} AND (system='' OR system={:system})", dbx.Params{"user": userId, "system": systemId}),
+	)
+	if err != nil {
+		return nil
+	}
+	now := time.Now()
+	for _, record := range records {
+		start := record.GetDateTime("start").Time()
+		end := record.GetDateTime("end").Time()
+		if inQuietWindow(now, start, end, record.GetString("repeat"), record.GetString("timezone")) {
+			return record
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package alerts
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Days of the week in the format of alert hours, indexed by time.Weekday
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Hours during which an alert can trigger, in the time zone of its system
+type alertHours struct {
+	days       [7]bool
+	start, end int // minutes since midnight, end before start spans midnight
+}
+
+// Parses alert hours like "09:00-17:00", "mon-fri 09:00-17:00" or
+// "sat,sun 22:00-06:00". Days default to every day. A window that ends before
+// it starts runs past midnight and belongs to the day it starts on.
+func parseAlertHours(s string) (*alertHours, error) {
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("expected [days] HH:MM-HH:MM")
+	}
+	hours := &alertHours{}
+	if len(fields) == 1 {
+		hours.days = [7]bool{true, true, true, true, true, true, true}
+	} else {
+		for _, part := range strings.Split(fields[0], ",") {
+			first, last, isRange := strings.Cut(part, "-")
+			from := slices.Index(weekdays, first)
+			to := from
+			if isRange {
+				to = slices.Index(weekdays, last)
+			}
+			if from < 0 || to < 0 {
+				return nil, fmt.Errorf("invalid days %q", part)
+			}
+			// ranges can wrap around the week, e.g. fri-mon
+			for day := from; ; day = (day + 1) % 7 {
+				hours.days[day] = true
+				if day == to {
+					break
+				}
+			}
+		}
+	}
+	start, end, ok := strings.Cut(fields[len(fields)-1], "-")
+	if !ok {
+		return nil, fmt.Errorf("expected HH:MM-HH:MM")
+	}
+	var err error
+	if hours.start, err = parseClock(start); err != nil {
+		return nil, err
+	}
+	if hours.end, err = parseClock(end); err != nil {
+		return nil, err
+	}
+	if hours.start == hours.end {
+		return nil, fmt.Errorf("start and end are the same")
+	}
+	return hours, nil
+}
+
+// Returns the minutes since midnight of a time like 09:30
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Returns true if the local time falls in the hours
+func (h *alertHours) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := int(t.Weekday())
+	if h.start < h.end {
+		return h.days[day] && minute >= h.start && minute < h.end
+	}
+	// the window started today, or yesterday and runs past midnight
+	return (h.days[day] && minute >= h.start) || (h.days[(day+6)%7] && minute < h.end)
+}
+
+// Returns the time zone of a system, UTC if it isn't set
+func systemLocation(systemRecord *core.Record) *time.Location {
+	if loc, err := time.LoadLocation(systemRecord.GetString("timezone")); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// Returns true if an alert can trigger at the time, which is always unless it
+// has hours set. Triggered alerts can resolve at any time.
+func inAlertHours(alertRecord, systemRecord *core.Record, now time.Time) bool {
+	hours, err := parseAlertHours(alertRecord.GetString("hours"))
+	if err != nil {
+		return true
+	}
+	return hours.contains(now.In(systemLocation(systemRecord)))
+}
+
+// CheckAlertHours returns an error if alert hours like "mon-fri 09:00-17:00" are invalid
+func CheckAlertHours(s string) error {
+	_, err := parseAlertHours(s)
+	return err
+}
+
+// ValidateHours rejects alerts with invalid alert hours
+func (am *AlertManager) ValidateHours(e *core.RecordEvent) error {
+	if hours := e.Record.GetString("hours"); hours != "" {
+		if err := CheckAlertHours(hours); err != nil {
+			return apis.NewBadRequestError("Invalid alert hours: "+err.Error(), nil)
+		}
+	}
+	return e.Next()
+}
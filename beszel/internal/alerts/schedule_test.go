@@ -0,0 +1,76 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAlertHours(t *testing.T) {
+	tests := []struct {
+		hours   string
+		wantErr bool
+	}{
+		{hours: "09:00-17:00"},
+		{hours: "mon-fri 09:00-17:00"},
+		{hours: "sat,sun 22:00-06:00"},
+		{hours: "FRI-MON 00:00-23:59"},
+		{hours: ""},
+		{hours: "09:00", wantErr: true},
+		{hours: "09:00-09:00", wantErr: true},
+		{hours: "25:00-26:00", wantErr: true},
+		{hours: "weekdays 09:00-17:00", wantErr: true},
+		{hours: "mon 09:00-17:00 extra", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hours, func(t *testing.T) {
+			_, err := parseAlertHours(tt.hours)
+			// empty hours aren't set, which inAlertHours treats as always
+			wantErr := tt.wantErr || tt.hours == ""
+			if (err != nil) != wantErr {
+				t.Fatalf("parseAlertHours(%q) error = %v, wantErr %v", tt.hours, err, wantErr)
+			}
+		})
+	}
+}
+
+func TestAlertHoursContains(t *testing.T) {
+	// 2026-01-05 is a Monday
+	at := func(day int, clock string) time.Time {
+		minutes, err := parseClock(clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Date(2026, 1, 5+day, minutes/60, minutes%60, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name  string
+		hours string
+		time  time.Time
+		want  bool
+	}{
+		{name: "inside daily hours", hours: "09:00-17:00", time: at(0, "12:00"), want: true},
+		{name: "at start", hours: "09:00-17:00", time: at(0, "09:00"), want: true},
+		{name: "at end", hours: "09:00-17:00", time: at(0, "17:00")},
+		{name: "before start", hours: "09:00-17:00", time: at(0, "08:59")},
+		{name: "weekday", hours: "mon-fri 09:00-17:00", time: at(4, "10:00"), want: true},
+		{name: "weekend", hours: "mon-fri 09:00-17:00", time: at(5, "10:00")},
+		{name: "range wrapping the week", hours: "fri-mon 09:00-17:00", time: at(6, "10:00"), want: true},
+		{name: "outside range wrapping the week", hours: "fri-mon 09:00-17:00", time: at(2, "10:00")},
+		{name: "night window before midnight", hours: "sat,sun 22:00-06:00", time: at(5, "23:00"), want: true},
+		{name: "night window after midnight", hours: "sat,sun 22:00-06:00", time: at(6, "03:00"), want: true},
+		{name: "night window from sunday ending monday", hours: "sat,sun 22:00-06:00", time: at(7, "03:00"), want: true},
+		{name: "night window on a day it doesn't start", hours: "sat,sun 22:00-06:00", time: at(7, "23:00")},
+		{name: "night window after it ends", hours: "sat,sun 22:00-06:00", time: at(6, "07:00")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hours, err := parseAlertHours(tt.hours)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hours.contains(tt.time); got != tt.want {
+				t.Fatalf("contains(%s %s) = %v, want %v", tt.time.Weekday(), tt.time.Format("15:04"), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package alerts
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Returns the active global silence, or nil if notifications aren't silenced
+func (am *AlertManager) ActiveSilence() *core.Record {
+	record, err := am.app.FindFirstRecordByFilter("silences", "expires > {:now}", dbx.Params{"now": types.NowDateTime()})
+	if err != nil {
+		return nil
+	}
+	return record
+}
+
+// Silences all notifications for the duration. userId may be empty (e.g. when using the CLI).
+func (am *AlertManager) Silence(userId string, duration time.Duration, reason string) (*core.Record, error) {
+	collection, err := am.app.FindCollectionByNameOrId("silences")
+	if err != nil {
+		return nil, err
+	}
+	expires, _ := types.ParseDateTime(time.Now().Add(duration))
+	record := core.NewRecord(collection)
+	record.Set("user", userId)
+	record.Set("reason", reason)
+	record.Set("expires", expires)
+	if err := am.app.Save(record); err != nil {
+		return nil, err
+	}
+	am.logger.Info("Notifications silenced", "until", expires.String(), "reason", reason, "user", userId)
+	return record, nil
+}
+
+// Ends all active silences. Records are kept with an updated expiry as an audit log.
+func (am *AlertManager) Unsilence() error {
+	records, err := am.app.FindRecordsByFilter("silences", "expires > {:now}", "", 0, 0, dbx.Params{"now": types.NowDateTime()})
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		record.Set("expires", types.NowDateTime())
+		if err := am.app.Save(record); err != nil {
+			return err
+		}
+	}
+	am.logger.Info("Notifications unsilenced")
+	return nil
+}
+
+// API endpoint to get, create (POST with hours and reason) or end (DELETE) a global silence
+func (am *AlertManager) HandleSilence(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	switch e.Request.Method {
+	case http.MethodPost:
+		var req struct {
+			Hours  float64 `json:"hours"`
+			Reason string  `json:"reason"`
+		}
+		if err := e.BindBody(&req); err != nil || req.Hours <= 0 {
+			return apis.NewBadRequestError("Invalid hours", err)
+		}
+		if _, err := am.Silence(info.Auth.Id, time.Duration(req.Hours*float64(time.Hour)), req.Reason); err != nil {
+			return err
+		}
+	case http.MethodDelete:
+		if err := am.Unsilence(); err != nil {
+			return err
+		}
+	}
+	return e.JSON(http.StatusOK, map[string]any{"silence": am.ActiveSilence()})
+}
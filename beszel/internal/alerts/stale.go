@@ -0,0 +1,88 @@
+package alerts
+
+import (
+	"beszel/internal/i18n"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pocketbase/dbx"
+)
+
+// Sends stale alerts for systems that haven't returned new data for longer than
+// the alert's threshold in minutes. This catches agents that keep the connection
+// open without responding, which status alerts miss.
+func (am *AlertManager) HandleStaleAlerts() error {
+	alertRecords, err := am.app.FindAllRecords("alerts", dbx.HashExp{"name": "Stale"})
+	if err != nil || len(alertRecords) == 0 {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, alertRecord := range alertRecords {
+		systemRecord, err := am.app.FindRecordById("systems", alertRecord.GetString("system"))
+		if err != nil {
+			continue
+		}
+		triggered := alertRecord.GetBool("triggered")
+		// down and paused systems are covered by status alerts
+		if systemRecord.GetString("status") != "up" && !triggered {
+			continue
+		}
+		sampled := systemRecord.GetDateTime("sampled")
+		if sampled.IsZero() {
+			continue
+		}
+		minutes := now.Sub(sampled.Time()).Minutes()
+		stale := minutes > alertRecord.GetFloat("value")
+		if stale == triggered {
+			continue
+		}
+		if !stale {
+			alertRecord.Set("resolved", now)
+		}
+		alertRecord.Set("triggered", stale)
+		if err := am.app.Save(alertRecord); err != nil {
+			return err
+		}
+		am.recordAlertHistory(alertRecord, stale, minutes)
+		if errs := am.app.ExpandRecord(alertRecord, []string{"user"}, nil); len(errs) > 0 {
+			return fmt.Errorf("failed to expand: %v", errs)
+		}
+		user := alertRecord.ExpandedOne("user")
+		if user == nil {
+			continue
+		}
+		systemName := systemRecord.GetString("name")
+		text := &alertText{
+			linkText:  i18n.M("View {system}", "system", systemName),
+			value:     i18n.M("{minutes, plural, one {# minute} other {# minutes}}", "minutes", int(math.Round(minutes))),
+			threshold: i18n.M("{minutes, plural, one {# minute} other {# minutes}}", "minutes", alertRecord.GetInt("value")),
+		}
+		status := "resolved"
+		if stale {
+			text.title = i18n.M("No new data from {system}", "system", systemName)
+			text.message = i18n.M("{system} hasn't returned new data for {minutes, plural, one {# minute} other {# minutes}}.",
+				"system", systemName, "minutes", int(math.Round(minutes)))
+			text.emoji = "\U0001F534"
+			status = "triggered"
+		} else {
+			text.title = i18n.M("{system} is returning data again", "system", systemName)
+			text.message = i18n.M("{system} returned new data.", "system", systemName)
+			text.emoji = "\u2705"
+		}
+		link := am.systemLink(systemName, "", time.Now(), eventLinkWindow)
+		am.sendAlert(AlertMessageData{
+			UserID:   user.Id,
+			systemId: systemRecord.Id,
+			Link:     link,
+			Data: TemplateData{
+				System: systemName,
+				Metric: "Stale",
+				Status: status,
+				URL:    link,
+			},
+			text: text,
+		})
+	}
+	return nil
+}
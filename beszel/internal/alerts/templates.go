@@ -0,0 +1,194 @@
+package alerts
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Notification channels that can have their own message template
+const (
+	ChannelEmail    = "email"
+	ChannelWebhook  = "webhook"
+	ChannelShoutrrr = "shoutrrr"
+)
+
+// NotificationTemplate is a user defined title and body for a notification channel
+type NotificationTemplate struct {
+	Title string `json:"title" yaml:"title"`
+	Body  string `json:"body" yaml:"body"`
+}
+
+// TemplateData holds the variables available in notification templates
+type TemplateData struct {
+	System    string // system name
+	Metric    string // alert name (CPU, Memory, Status, ...)
+	Value     string // current value with unit
+	Threshold string // alert threshold with unit
+	Duration  string // duration the value was averaged over
+	Status    string // triggered / resolved, or the new state for status alerts
+	URL       string // link to the system in the dashboard
+	Time      string // when the alert was sent, in the user's time format
+	Title     string // default title
+	Message   string // default message
+}
+
+// Returns functions for the shorthand variables in templates, so {{value}} can be
+// used in place of {{.Value}}
+func templateFuncs(data TemplateData) template.FuncMap {
+	value := func(s string) func() string {
+		return func() string { return s }
+	}
+	return template.FuncMap{
+		"system":    value(data.System),
+		"metric":    value(data.Metric),
+		"value":     value(data.Value),
+		"threshold": value(data.Threshold),
+		"duration":  value(data.Duration),
+		"status":    value(data.Status),
+		"url":       value(data.URL),
+		"timestamp": value(data.Time),
+		"title":     value(data.Title),
+		"message":   value(data.Message),
+	}
+}
+
+// Returns the template for a channel. The user's own template is preferred, then a
+// default template for the user's language (e.g. "email.de"), then the default for the channel.
+func (am *AlertManager) templateFor(settings UserNotificationSettings, channel string) (NotificationTemplate, bool) {
+	if t, ok := settings.Templates[channel]; ok {
+		return t, true
+	}
+	am.mutex.RLock()
+	defer am.mutex.RUnlock()
+	if lang, _, _ := strings.Cut(settings.Locale, "-"); lang != "" {
+		if t, ok := am.templates[channel+"."+strings.ToLower(lang)]; ok {
+			return t, true
+		}
+	}
+	t, ok := am.templates[channel]
+	return t, ok
+}
+
+// Sets the default templates used for users without their own template.
+// Keys are a channel, optionally followed by a language (e.g. "email" or "email.de").
+func (am *AlertManager) SetDefaultTemplates(templates map[string]NotificationTemplate) error {
+	for key, t := range templates {
+		channel, _, _ := strings.Cut(key, ".")
+		if err := validateTemplate(channel, t, am.app.Settings().Meta.AppURL); err != nil {
+			return err
+		}
+	}
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+	am.templates = templates
+	return nil
+}
+
+// Returns an error if the channel is unknown or the template doesn't render
+func validateTemplate(channel string, t NotificationTemplate, appURL string) error {
+	switch channel {
+	case ChannelEmail, ChannelWebhook, ChannelShoutrrr:
+	default:
+		return fmt.Errorf("invalid notification channel %q", channel)
+	}
+	if _, _, err := t.Render(sampleTemplateData(appURL)); err != nil {
+		return fmt.Errorf("invalid %s template: %v", channel, err)
+	}
+	return nil
+}
+
+// Returns the template channel for a Shoutrrr URL
+func webhookChannel(notificationUrl string) string {
+	if parsedURL, err := url.Parse(notificationUrl); err == nil && strings.HasPrefix(parsedURL.Scheme, "generic") {
+		return ChannelWebhook
+	}
+	return ChannelShoutrrr
+}
+
+// Parses a template, returning an error if the syntax is invalid
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Funcs(templateFuncs(TemplateData{})).Parse(text)
+}
+
+// Renders the title and body of a notification using the template.
+// Empty template fields fall back to the default title / message.
+func (t NotificationTemplate) Render(data TemplateData) (title, body string, err error) {
+	title, body = data.Title, data.Message
+	if t.Title != "" {
+		if title, err = renderTemplate("title", t.Title, data); err != nil {
+			return "", "", err
+		}
+	}
+	if t.Body != "" {
+		if body, err = renderTemplate("body", t.Body, data); err != nil {
+			return "", "", err
+		}
+	}
+	return title, body, nil
+}
+
+func renderTemplate(name, text string, data TemplateData) (string, error) {
+	tmpl, err := parseTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Funcs(templateFuncs(data)).Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Validates notification templates before user settings are saved
+func (am *AlertManager) ValidateTemplates(e *core.RecordEvent) error {
+	settings := UserNotificationSettings{}
+	if err := e.Record.UnmarshalJSONField("settings", &settings); err != nil {
+		return e.Next()
+	}
+	for channel, t := range settings.Templates {
+		if err := validateTemplate(channel, t, am.app.Settings().Meta.AppURL); err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+	}
+	return e.Next()
+}
+
+// Returns example values used to preview and validate templates
+func sampleTemplateData(appURL string) TemplateData {
+	return TemplateData{
+		System:    "my-server",
+		Metric:    "CPU",
+		Value:     "92.50%",
+		Threshold: "80.00%",
+		Duration:  "10 minutes",
+		Status:    "triggered",
+		URL:       appURL + "/system/my-server",
+		Time:      "2025-01-15 14:30 UTC",
+		Title:     "my-server CPU above threshold",
+		Message:   "CPU averaged 92.50% for the previous 10 minutes.",
+	}
+}
+
+// API endpoint that renders a template with sample data
+func (am *AlertManager) PreviewNotification(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	var t NotificationTemplate
+	if err := e.BindBody(&t); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"err": err.Error()})
+	}
+	title, body, err := t.Render(sampleTemplateData(am.app.Settings().Meta.AppURL))
+	if err != nil {
+		return e.JSON(http.StatusOK, map[string]string{"err": err.Error()})
+	}
+	return e.JSON(http.StatusOK, map[string]any{"title": title, "body": body, "err": false})
+}
@@ -0,0 +1,106 @@
+package alerts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNotificationTemplateRender(t *testing.T) {
+	data := sampleTemplateData("https://beszel.example.com")
+	tests := []struct {
+		name      string
+		template  NotificationTemplate
+		wantTitle string
+		wantBody  string
+		wantErr   string
+	}{
+		{
+			name:      "empty template uses defaults",
+			wantTitle: data.Title,
+			wantBody:  data.Message,
+		},
+		{
+			name:      "fields",
+			template:  NotificationTemplate{Title: "{{.System}} {{.Metric}}", Body: "{{.Value}} > {{.Threshold}}"},
+			wantTitle: "my-server CPU",
+			wantBody:  "92.50% > 80.00%",
+		},
+		{
+			name:      "shorthand functions",
+			template:  NotificationTemplate{Body: "{{system}} {{status}} {{url}}"},
+			wantTitle: data.Title,
+			wantBody:  "my-server triggered https://beszel.example.com/system/my-server",
+		},
+		{
+			name:     "unknown field",
+			template: NotificationTemplate{Body: "{{.Password}}"},
+			wantErr:  "Password",
+		},
+		{
+			name:     "unknown function",
+			template: NotificationTemplate{Title: "{{env \"ENCRYPTION_KEY\"}}"},
+			wantErr:  "not defined",
+		},
+		{
+			name:     "invalid syntax",
+			template: NotificationTemplate{Title: "{{.System"},
+			wantErr:  "unclosed action",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title, body, err := tt.template.Render(data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Render() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if title != tt.wantTitle || body != tt.wantBody {
+				t.Fatalf("Render() = %q, %q, want %q, %q", title, body, tt.wantTitle, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	tests := []struct {
+		channel  string
+		template NotificationTemplate
+		wantErr  bool
+	}{
+		{channel: ChannelEmail, template: NotificationTemplate{Title: "{{system}}"}},
+		{channel: ChannelWebhook, template: NotificationTemplate{Body: `{"text": "{{message}}"}`}},
+		{channel: ChannelShoutrrr},
+		{channel: "sms", wantErr: true},
+		{channel: ChannelEmail, template: NotificationTemplate{Body: "{{.Missing}}"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			err := validateTemplate(tt.channel, tt.template, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookChannel(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "generic://example.com/hook", want: ChannelWebhook},
+		{url: "generic+https://example.com/hook", want: ChannelWebhook},
+		{url: "discord://token@id", want: ChannelShoutrrr},
+		{url: "::invalid", want: ChannelShoutrrr},
+	}
+	for _, tt := range tests {
+		if got := webhookChannel(tt.url); got != tt.want {
+			t.Errorf("webhookChannel(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
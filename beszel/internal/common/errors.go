@@ -0,0 +1,35 @@
+// Package common contains values shared by the agent and hub.
+package common
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// ErrorCode identifies why the agent couldn't collect data for a subsystem
+type ErrorCode string
+
+// Error codes returned by the agent in system info
+const (
+	ErrDockerUnavailable ErrorCode = "docker_unavailable" // docker / podman API not reachable
+	ErrPermissionDenied  ErrorCode = "permission_denied"  // agent lacks permission to read the data
+	ErrSmartctlMissing   ErrorCode = "smartctl_missing"   // smartctl not installed
+	ErrCollectionFailed  ErrorCode = "collection_failed"  // any other error
+)
+
+// Subsystems that can report an error code
+const (
+	SubsystemDocker     = "docker"
+	SubsystemSmart      = "smart"
+	SubsystemSystemd    = "systemd"
+	SubsystemKubernetes = "kubernetes"
+	SubsystemProxmox    = "proxmox"
+)
+
+// ErrorCodeOf returns ErrPermissionDenied for permission errors and the fallback code otherwise
+func ErrorCodeOf(err error, fallback ErrorCode) ErrorCode {
+	if errors.Is(err, fs.ErrPermission) {
+		return ErrPermissionDenied
+	}
+	return fallback
+}
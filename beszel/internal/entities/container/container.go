@@ -1,13 +1,12 @@
 package container
 
-import "time"
-
 // Docker container info from /containers/json
 type ApiInfo struct {
 	Id      string
 	IdShort string
 	Names   []string
 	Status  string
+	Labels  map[string]string
 	// Image   string
 	// ImageID string
 	// Command string
@@ -15,7 +14,6 @@ type ApiInfo struct {
 	// Ports      []Port
 	// SizeRw     int64 `json:",omitempty"`
 	// SizeRootFs int64 `json:",omitempty"`
-	// Labels     map[string]string
 	// State      string
 	// HostConfig struct {
 	// 	NetworkMode string            `json:",omitempty"`
@@ -116,19 +114,44 @@ type NetworkStats struct {
 	TxBytes uint64 `json:"tx_bytes"`
 }
 
-type prevNetStats struct {
-	Sent uint64
-	Recv uint64
-	Time time.Time
+// Labels set by docker compose on the containers of a project
+const (
+	LabelComposeProject = "com.docker.compose.project"
+	LabelComposeService = "com.docker.compose.service"
+)
+
+// Kubelet stats from /stats/summary (only the fields used for pods)
+type KubeletSummary struct {
+	Pods []KubeletPodStats `json:"pods"`
+}
+
+type KubeletPodStats struct {
+	PodRef struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		UID       string `json:"uid"`
+	} `json:"podRef"`
+	CPU *struct {
+		UsageNanoCores *uint64 `json:"usageNanoCores"`
+	} `json:"cpu"`
+	Memory *struct {
+		WorkingSetBytes *uint64 `json:"workingSetBytes"`
+	} `json:"memory"`
+	Network *struct {
+		RxBytes *uint64 `json:"rxBytes"`
+		TxBytes *uint64 `json:"txBytes"`
+	} `json:"network"`
 }
 
-// Docker container stats
+// Docker container or Kubernetes pod stats
 type Stats struct {
-	Name        string       `json:"n"`
-	Cpu         float64      `json:"c"`
-	Mem         float64      `json:"m"`
-	NetworkSent float64      `json:"ns"`
-	NetworkRecv float64      `json:"nr"`
-	PrevCpu     [2]uint64    `json:"-"`
-	PrevNet     prevNetStats `json:"-"`
+	Name        string  `json:"n"`
+	Project     string  `json:"p,omitempty"` // docker compose project or kubernetes namespace
+	Service     string  `json:"s,omitempty"` // docker compose service
+	Cpu         float64 `json:"c"`
+	Mem         float64 `json:"m"`
+	NetworkSent float64 `json:"ns"`
+	NetworkRecv float64 `json:"nr"`
+	DiskRead    float64 `json:"dr,omitempty"` // only reported for virtual machines and DOCKER_STATS=cgroup
+	DiskWrite   float64 `json:"dw,omitempty"`
 }
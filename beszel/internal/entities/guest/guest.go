@@ -0,0 +1,12 @@
+package guest
+
+// Virtual machine on a hypervisor host
+type Guest struct {
+	Name       string  `json:"n"`
+	Hypervisor string  `json:"h"`            // kvm or hyperv
+	State      string  `json:"s"`            // running, paused, shutoff, ...
+	Vcpus      uint16  `json:"v,omitempty"`  // allocated virtual cpus
+	MemMax     float64 `json:"mm,omitempty"` // allocated memory (MB)
+	Cpu        float64 `json:"c"`            // percent of the host's cpu
+	Mem        float64 `json:"m"`            // memory in use (MB)
+}
@@ -0,0 +1,112 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Check types
+const (
+	TypeHTTP = "http"
+	TypeTCP  = "tcp"
+)
+
+// Timeout of health check requests and connections
+const Timeout = 5 * time.Second
+
+// Size of the response body searched for a check's keyword
+const maxKeywordBody = 1 << 20
+
+var client = &http.Client{
+	Timeout: Timeout,
+	// report redirects as the final status instead of following them
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// Check of a service, run by the hub or delegated to an agent that can reach it
+type Check struct {
+	Type    string `json:"t"`
+	Target  string `json:"u"`           // url for http, host:port for tcp
+	Status  int    `json:"s,omitempty"` // expected status code (default any 2xx or 3xx)
+	Keyword string `json:"k,omitempty"` // text the response body must contain
+}
+
+// Runs the check and returns its result
+func (c Check) Run() *Result {
+	if c.Type == TypeTCP {
+		return c.dial()
+	}
+	return c.request()
+}
+
+// Requests the url and returns whether it responded with the expected status
+// code, and contains the keyword if one is set
+func (c Check) request() *Result {
+	result := &Result{URL: c.Target, Status: StatusDown}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Target, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("User-Agent", "Beszel")
+	start := time.Now()
+	resp, err := client.Do(req)
+	result.Latency = latency(start)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	switch {
+	case c.Status != 0 && resp.StatusCode != c.Status:
+		result.Error = fmt.Sprintf("expected status %d", c.Status)
+		return result
+	case c.Status == 0 && resp.StatusCode >= 400:
+		result.Error = resp.Status
+		return result
+	}
+	if c.Keyword != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxKeywordBody))
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if !strings.Contains(string(body), c.Keyword) {
+			result.Error = fmt.Sprintf("keyword %q not found", c.Keyword)
+			return result
+		}
+	}
+	result.Status = StatusUp
+	return result
+}
+
+// Opens a tcp connection to the target
+func (c Check) dial() *Result {
+	result := &Result{URL: c.Target, Status: StatusDown}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", c.Target, Timeout)
+	result.Latency = latency(start)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	conn.Close()
+	result.Status = StatusUp
+	return result
+}
+
+// Returns the time since start in ms, rounded to two decimals
+func latency(start time.Time) float64 {
+	return math.Round(float64(time.Since(start).Microseconds())/10) / 100
+}
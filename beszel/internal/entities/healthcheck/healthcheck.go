@@ -0,0 +1,23 @@
+package healthcheck
+
+// Container labels that configure an HTTP health check
+const (
+	LabelURL    = "beszel.healthcheck.url"    // url to request (required)
+	LabelStatus = "beszel.healthcheck.status" // expected status code (default any 2xx or 3xx)
+)
+
+// Check statuses
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Result of a health check of a container or a user defined check
+type Result struct {
+	Name       string  `json:"n"` // container name
+	URL        string  `json:"u"`
+	Status     string  `json:"s"`
+	StatusCode int     `json:"c,omitempty"`
+	Latency    float64 `json:"l"` // response time (ms)
+	Error      string  `json:"e,omitempty"`
+}
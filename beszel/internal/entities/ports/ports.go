@@ -0,0 +1,20 @@
+package ports
+
+import (
+	"net"
+	"strconv"
+)
+
+// Socket listening for connections on the system
+type Port struct {
+	Proto   string `json:"t"` // tcp, tcp6, udp or udp6
+	Address string `json:"a"` // local address, e.g. 0.0.0.0 or ::1
+	Port    uint32 `json:"p"`
+	Process string `json:"n,omitempty"` // name of the owning process, if known
+}
+
+// Returns the protocol and address of the socket, e.g. "tcp 0.0.0.0:22",
+// which identifies it in an inventory
+func (p *Port) Key() string {
+	return p.Proto + " " + net.JoinHostPort(p.Address, strconv.FormatUint(uint64(p.Port), 10))
+}
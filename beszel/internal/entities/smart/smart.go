@@ -0,0 +1,92 @@
+package smart
+
+// smartctl JSON output from `smartctl --scan -j`
+type ScanOutput struct {
+	Devices []ScanDevice `json:"devices"`
+}
+
+type ScanDevice struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Protocol string `json:"protocol"`
+}
+
+// smartctl JSON output from `smartctl -a -j <device>`.
+// Only the fields we use are included.
+type SmartctlOutput struct {
+	Smartctl struct {
+		ExitStatus int `json:"exit_status"`
+	} `json:"smartctl"`
+	Device          ScanDevice `json:"device"`
+	ModelName       string     `json:"model_name"`
+	ScsiModelName   string     `json:"scsi_model_name"`
+	SerialNumber    string     `json:"serial_number"`
+	FirmwareVersion string     `json:"firmware_version"`
+	UserCapacity    struct {
+		Bytes uint64 `json:"bytes"`
+	} `json:"user_capacity"`
+	SmartStatus *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature struct {
+		Current float64 `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime struct {
+		Hours uint64 `json:"hours"`
+	} `json:"power_on_time"`
+	PowerCycleCount uint64 `json:"power_cycle_count"`
+	// SATA
+	AtaSmartAttributes struct {
+		Table []AtaSmartAttribute `json:"table"`
+	} `json:"ata_smart_attributes"`
+	// NVMe
+	NvmeSmartHealthInformationLog *NvmeSmartHealthInformationLog `json:"nvme_smart_health_information_log"`
+	// SCSI
+	ScsiGrownDefectList uint64 `json:"scsi_grown_defect_list"`
+}
+
+type AtaSmartAttribute struct {
+	ID     uint16 `json:"id"`
+	Name   string `json:"name"`
+	Value  uint16 `json:"value"`
+	Worst  uint16 `json:"worst"`
+	Thresh uint16 `json:"thresh"`
+	Raw    struct {
+		Value uint64 `json:"value"`
+	} `json:"raw"`
+}
+
+type NvmeSmartHealthInformationLog struct {
+	CriticalWarning uint64  `json:"critical_warning"`
+	Temperature     float64 `json:"temperature"`
+	AvailableSpare  uint64  `json:"available_spare"`
+	PercentageUsed  uint64  `json:"percentage_used"`
+	PowerCycles     uint64  `json:"power_cycles"`
+	PowerOnHours    uint64  `json:"power_on_hours"`
+	MediaErrors     uint64  `json:"media_errors"`
+}
+
+// SMART status values reported to the hub
+const (
+	StatusPassed  = "PASSED"
+	StatusFailed  = "FAILED"
+	StatusUnknown = "UNKNOWN"
+)
+
+// Drive health data sent to the hub
+type SmartData struct {
+	DiskName           string   `json:"dn"`
+	DiskType           string   `json:"dt,omitempty"`
+	ModelName          string   `json:"mn,omitempty"`
+	SerialNumber       string   `json:"sn,omitempty"`
+	FirmwareVersion    string   `json:"fv,omitempty"`
+	Capacity           uint64   `json:"c,omitempty"`
+	SmartStatus        string   `json:"s"`
+	Temperature        float64  `json:"t,omitempty"`
+	PowerOnHours       uint64   `json:"poh,omitempty"`
+	PowerCycles        uint64   `json:"pc,omitempty"`
+	ReallocatedSectors uint64   `json:"rs"`
+	MediaErrors        uint64   `json:"me,omitempty"`
+	PercentageUsed     uint64   `json:"pu,omitempty"`
+	Mounts             []string `json:"mp,omitempty"` // filesystems on the disk: "/" for root and names of extra filesystems
+}
@@ -1,18 +1,34 @@
 package system
 
 import (
+	"beszel/internal/common"
 	"beszel/internal/entities/container"
-	"time"
+	"beszel/internal/entities/guest"
+	"beszel/internal/entities/healthcheck"
+	"beszel/internal/entities/ports"
+	"beszel/internal/entities/smart"
+	"beszel/internal/entities/systemd"
+	"encoding/json"
+	"maps"
+	"slices"
 )
 
 type Stats struct {
 	Cpu            float64             `json:"cpu"`
 	MaxCpu         float64             `json:"cpum,omitempty"`
+	CpuCores       []float64           `json:"cpuc,omitempty"`  // usage of each logical cpu (whole %), if enabled on the agent
+	CpuUser        float64             `json:"cpuu,omitempty"`  // time in user space, including nice (%)
+	CpuSystem      float64             `json:"cpus,omitempty"`  // time in the kernel, including interrupts (%)
+	CpuIowait      float64             `json:"cpui,omitempty"`  // idle time waiting for i/o (%)
+	CpuSteal       float64             `json:"cpust,omitempty"` // time taken by the hypervisor for other vms (%)
 	Mem            float64             `json:"m"`
 	MemUsed        float64             `json:"mu"`
 	MemPct         float64             `json:"mp"`
 	MemBuffCache   float64             `json:"mb"`
 	MemZfsArc      float64             `json:"mz,omitempty"` // ZFS ARC memory
+	MemAvailable   float64             `json:"ma,omitempty"`
+	HugePages      float64             `json:"mht,omitempty"` // memory reserved for huge pages
+	HugePagesUsed  float64             `json:"mhu,omitempty"`
 	Swap           float64             `json:"s,omitempty"`
 	SwapUsed       float64             `json:"su,omitempty"`
 	DiskTotal      float64             `json:"d"`
@@ -22,64 +38,289 @@ type Stats struct {
 	DiskWritePs    float64             `json:"dw"`
 	MaxDiskReadPs  float64             `json:"drm,omitempty"`
 	MaxDiskWritePs float64             `json:"dwm,omitempty"`
+	DiskReadLat    float64             `json:"drl,omitempty"` // average read latency (ms)
+	DiskWriteLat   float64             `json:"dwl,omitempty"` // average write latency (ms)
+	DiskQueue      float64             `json:"dq,omitempty"`  // i/o queue length
+	DiskIo         map[string]IoStats  `json:"dio,omitempty"` // i/o of each disk device
+	LoadAvg1       float64             `json:"l1,omitempty"`
+	LoadAvg5       float64             `json:"l5,omitempty"`
+	LoadAvg15      float64             `json:"l15,omitempty"`
+	Battery        float64             `json:"bat,omitempty"`  // battery or ups charge (%)
+	Fds            float64             `json:"fd,omitempty"`   // open file descriptors
+	FdMax          float64             `json:"fdm,omitempty"`  // system-wide file descriptor limit
+	FdProcPct      float64             `json:"fdp,omitempty"`  // highest process usage of its own limit (%)
+	Entropy        float64             `json:"ent,omitempty"`  // available entropy (bits)
+	EntropyPool    float64             `json:"entp,omitempty"` // size of the entropy pool (bits)
+	Pressure       *Pressure           `json:"psi,omitempty"`  // nil if the kernel doesn't report pressure stall information
+	Latency        float64             `json:"lat,omitempty"`  // round trip time from the hub (ms), set by the hub
+	PacketLoss     *float64            `json:"pl,omitempty"`   // latency probes from the hub without a reply (%), nil if not measured
 	NetworkSent    float64             `json:"ns"`
 	NetworkRecv    float64             `json:"nr"`
 	MaxNetworkSent float64             `json:"nsm,omitempty"`
 	MaxNetworkRecv float64             `json:"nrm,omitempty"`
+	Nics           map[string]NicStats `json:"ni,omitempty"` // throughput of each network interface
 	Temperatures   map[string]float64  `json:"t,omitempty"`
+	Voltages       map[string]float64  `json:"volt,omitempty"` // voltage of each hwmon voltage sensor (V)
 	ExtraFs        map[string]*FsStats `json:"efs,omitempty"`
 	GPUData        map[string]GPUData  `json:"g,omitempty"`
+	Missing        []string            `json:"mi,omitempty"` // groups of stats that failed to collect
+}
+
+// Groups of stats that are marked as missing when their collector fails
+const (
+	StatsCpu    = "cpu"
+	StatsMem    = "mem"
+	StatsDisk   = "disk"
+	StatsDiskIO = "dio"
+	StatsNet    = "net"
+	StatsLoad   = "load"
+	StatsFd     = "fd"
+	StatsPsi    = "psi"
+)
+
+// JSON keys of the stats in each group, which are set to null if the group is missing
+var statsGroupKeys = map[string][]string{
+	StatsCpu:    {"cpu", "cpum", "cpuc", "cpuu", "cpus", "cpui", "cpust"},
+	StatsMem:    {"m", "mu", "mp", "mb", "mz", "ma", "mht", "mhu", "s", "su"},
+	StatsDisk:   {"d", "du", "dp"},
+	StatsDiskIO: {"dr", "dw", "drm", "dwm", "drl", "dwl", "dq"},
+	StatsNet:    {"ns", "nr", "nsm", "nrm"},
+	StatsLoad:   {"l1", "l5", "l15"},
+	StatsFd:     {"fd", "fdm", "fdp"},
+	StatsPsi:    {"psi"},
+}
+
+// IsMissing returns true if the group of stats failed to collect
+func (s *Stats) IsMissing(group string) bool {
+	return slices.Contains(s.Missing, group)
+}
+
+// Fields returns the stats of each group by name, e.g. "mem_used". The names are
+// used for remote write fields and as variables in metric expressions.
+func (s *Stats) Fields() map[string]map[string]float64 {
+	fields := map[string]map[string]float64{
+		StatsCpu: {
+			"cpu":        s.Cpu,
+			"cpu_user":   s.CpuUser,
+			"cpu_system": s.CpuSystem,
+			"cpu_iowait": s.CpuIowait,
+			"cpu_steal":  s.CpuSteal,
+		},
+		StatsMem: {
+			"mem_total":     s.Mem,
+			"mem_used":      s.MemUsed,
+			"mem_pct":       s.MemPct,
+			"mem_buffcache": s.MemBuffCache,
+			"swap_total":    s.Swap,
+			"swap_used":     s.SwapUsed,
+		},
+		StatsDisk: {
+			"disk_total": s.DiskTotal,
+			"disk_used":  s.DiskUsed,
+			"disk_pct":   s.DiskPct,
+		},
+		StatsDiskIO: {
+			"disk_read":          s.DiskReadPs,
+			"disk_write":         s.DiskWritePs,
+			"disk_read_latency":  s.DiskReadLat,
+			"disk_write_latency": s.DiskWriteLat,
+			"disk_queue":         s.DiskQueue,
+		},
+		StatsNet: {
+			"net_sent": s.NetworkSent,
+			"net_recv": s.NetworkRecv,
+		},
+		StatsLoad: {
+			"load1":  s.LoadAvg1,
+			"load5":  s.LoadAvg5,
+			"load15": s.LoadAvg15,
+		},
+	}
+	if p := s.Pressure; p != nil {
+		fields[StatsPsi] = map[string]float64{
+			"psi_cpu_some":    p.CpuSome,
+			"psi_memory_some": p.MemSome,
+			"psi_memory_full": p.MemFull,
+			"psi_io_some":     p.IoSome,
+			"psi_io_full":     p.IoFull,
+		}
+	}
+	return fields
+}
+
+// Values returns the fields of the groups that were collected
+func (s *Stats) Values() map[string]float64 {
+	values := make(map[string]float64, 24)
+	for group, fields := range s.Fields() {
+		if !s.IsMissing(group) {
+			maps.Copy(values, fields)
+		}
+	}
+	return values
+}
+
+// IsField returns true if name is one of the fields returned by Fields
+func IsField(name string) bool {
+	s := Stats{Pressure: &Pressure{}}
+	for _, fields := range s.Fields() {
+		if _, ok := fields[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON sets stats in missing groups to null so they aren't mistaken for zero values
+func (s Stats) MarshalJSON() ([]byte, error) {
+	type stats Stats // prevents recursion
+	data, err := json.Marshal(stats(s))
+	if err != nil || len(s.Missing) == 0 {
+		return data, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for _, group := range s.Missing {
+		for _, key := range statsGroupKeys[group] {
+			fields[key] = json.RawMessage("null")
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// Pressure stall information: the share of time that some or all non-idle tasks
+// were stalled waiting for the cpu, memory or i/o (%). The kernel doesn't
+// define full cpu pressure for the whole system.
+type Pressure struct {
+	CpuSome float64 `json:"cs,omitempty"`
+	MemSome float64 `json:"ms,omitempty"`
+	MemFull float64 `json:"mf,omitempty"`
+	IoSome  float64 `json:"is,omitempty"`
+	IoFull  float64 `json:"if,omitempty"`
 }
 
 type GPUData struct {
-	Name        string  `json:"n"`
-	Temperature float64 `json:"-"`
-	MemoryUsed  float64 `json:"mu,omitempty"`
-	MemoryTotal float64 `json:"mt,omitempty"`
-	Usage       float64 `json:"u"`
-	Power       float64 `json:"p,omitempty"`
-	Count       float64 `json:"-"`
+	Name        string             `json:"n"`
+	Temperature float64            `json:"-"`
+	MemoryUsed  float64            `json:"mu,omitempty"`
+	MemoryTotal float64            `json:"mt,omitempty"`
+	MemoryFree  float64            `json:"mf,omitempty"` // memory headroom (total - used)
+	Usage       float64            `json:"u"`
+	Power       float64            `json:"p,omitempty"`
+	Processes   float64            `json:"pr,omitempty"` // running compute processes
+	Engines     map[string]float64 `json:"e,omitempty"`  // utilization of each engine (%), e.g. "Video" (intel)
+	Count       float64            `json:"-"`
 }
 
 type FsStats struct {
-	Time           time.Time `json:"-"`
-	Root           bool      `json:"-"`
-	Mountpoint     string    `json:"-"`
-	DiskTotal      float64   `json:"d"`
-	DiskUsed       float64   `json:"du"`
-	TotalRead      uint64    `json:"-"`
-	TotalWrite     uint64    `json:"-"`
-	DiskReadPs     float64   `json:"r"`
-	DiskWritePs    float64   `json:"w"`
-	MaxDiskReadPS  float64   `json:"rm,omitempty"`
-	MaxDiskWritePS float64   `json:"wm,omitempty"`
-}
-
-type NetIoStats struct {
-	BytesRecv uint64
-	BytesSent uint64
-	Time      time.Time
-	Name      string
+	Root           bool    `json:"-"`
+	Mountpoint     string  `json:"-"`
+	DiskTotal      float64 `json:"d"`
+	DiskUsed       float64 `json:"du"`
+	DiskReadPs     float64 `json:"r"`
+	DiskWritePs    float64 `json:"w"`
+	MaxDiskReadPS  float64 `json:"rm,omitempty"`
+	MaxDiskWritePS float64 `json:"wm,omitempty"`
+	ReadLatency    float64 `json:"rl,omitempty"` // average read latency (ms)
+	WriteLatency   float64 `json:"wl,omitempty"` // average write latency (ms)
+	QueueLength    float64 `json:"q,omitempty"`
+}
+
+// I/O of a disk device
+type IoStats struct {
+	Read       float64 `json:"r"`            // MB/s
+	Write      float64 `json:"w"`            // MB/s
+	ReadIops   float64 `json:"ri"`           // read operations per second
+	WriteIops  float64 `json:"wi"`           // write operations per second
+	ReadAwait  float64 `json:"rl,omitempty"` // average time of a read (ms)
+	WriteAwait float64 `json:"wl,omitempty"` // average time of a write (ms)
+	Await      float64 `json:"a,omitempty"`  // average time of any operation (ms)
+	Util       float64 `json:"u,omitempty"`  // time the device was busy (%)
 }
 
 type Info struct {
-	Hostname      string  `json:"h"`
-	KernelVersion string  `json:"k,omitempty"`
-	Cores         int     `json:"c"`
-	Threads       int     `json:"t,omitempty"`
-	CpuModel      string  `json:"m"`
-	Uptime        uint64  `json:"u"`
-	Cpu           float64 `json:"cpu"`
-	MemPct        float64 `json:"mp"`
-	DiskPct       float64 `json:"dp"`
-	Bandwidth     float64 `json:"b"`
-	AgentVersion  string  `json:"v"`
-	Podman        bool    `json:"p,omitempty"`
+	Hostname      string   `json:"h"`
+	KernelVersion string   `json:"k,omitempty"`
+	Cores         int      `json:"c"`
+	Threads       int      `json:"t,omitempty"`
+	CpuModel      string   `json:"m"`
+	Uptime        uint64   `json:"u"`
+	Cpu           float64  `json:"cpu"`
+	MemPct        float64  `json:"mp"`
+	SwapPct       float64  `json:"sp,omitempty"`
+	DiskPct       float64  `json:"dp"`
+	Bandwidth     float64  `json:"b"`
+	NetUtil       float64  `json:"nu,omitempty"` // highest utilization of a network interface's link speed (%)
+	LoadAvg1      float64  `json:"l1,omitempty"`
+	LoadAvg5      float64  `json:"l5,omitempty"`
+	LoadAvg15     float64  `json:"l15,omitempty"`
+	FdPct         float64  `json:"fdp,omitempty"` // highest of system and process file descriptor usage (%)
+	AgentVersion  string   `json:"v"`
+	Os            string   `json:"os,omitempty"` // operating system of the agent (linux, darwin, windows, freebsd)
+	Podman        bool     `json:"p,omitempty"`
+	Kubernetes    bool     `json:"k8s,omitempty"` // containers are kubernetes pods
+	Throttled     string   `json:"th,omitempty"`  // battery or thermal if collection is reduced
+	Battery       *Battery `json:"bat,omitempty"`
+	Entropy       *float64 `json:"ent,omitempty"` // available entropy (bits), nil if not reported
+	Latency       *float64 `json:"lat,omitempty"` // round trip time from the hub (ms), nil if not measured or lost
+	PacketLoss    *float64 `json:"pl,omitempty"`  // latency probes from the hub without a reply (%), nil if not measured
+	// subsystems that failed to collect data
+	Errors map[string]common.ErrorCode `json:"e,omitempty"`
+}
+
+// Throughput of a network interface and its utilization of the link speed
+type NicStats struct {
+	Sent  float64 `json:"ns"`           // MB/s
+	Recv  float64 `json:"nr"`           // MB/s
+	Speed float64 `json:"sp,omitempty"` // link speed (Mb/s), 0 if unknown
+	Util  float64 `json:"u,omitempty"`  // higher of sent and received as a percentage of the link speed
+}
+
+// Charge and state of the host's battery or UPS
+type Battery struct {
+	Capacity float64 `json:"c"`   // percent
+	State    string  `json:"s"`   // charging, discharging, full or idle
+	Source   string  `json:"src"` // sysfs, apcupsd or nut
+}
+
+// Process resource usage
+type Process struct {
+	Pid     int32   `json:"p"`
+	Name    string  `json:"n"`
+	User    string  `json:"u,omitempty"`
+	Cpu     float64 `json:"c"`
+	Mem     float64 `json:"m"`             // resident memory (mb)
+	Fds     int     `json:"fd,omitempty"`  // open file descriptors
+	FdLimit int     `json:"fdl,omitempty"` // soft limit of open file descriptors
+}
+
+// Top processes by cpu, memory and file descriptor usage
+type ProcessList struct {
+	Cpu []Process `json:"cpu"`
+	Mem []Process `json:"mem"`
+	Fd  []Process `json:"fd,omitempty"` // by percentage of their file descriptor limit
+}
+
+// Result of an agent update requested by the hub
+type UpdateResult struct {
+	Version string `json:"v"` // version the agent runs after restarting
+	Updated bool   `json:"u"` // false if the agent was already up to date
+	Error   string `json:"e,omitempty"`
 }
 
 // Final data structure to return to the hub
 type CombinedData struct {
-	Stats      Stats              `json:"stats"`
-	Info       Info               `json:"info"`
-	Containers []*container.Stats `json:"container"`
+	Stats      Stats                      `json:"stats"`
+	Info       Info                       `json:"info"`
+	Containers []*container.Stats         `json:"container"`
+	Smart      map[string]smart.SmartData `json:"smart,omitempty"`
+	Services   []*systemd.Service         `json:"services,omitempty"`
+	Ports      []*ports.Port              `json:"ports,omitempty"`
+	// virtual machines of a hypervisor host, nil on other systems
+	Guests []*guest.Guest `json:"guests,omitempty"`
+	// nil if docker is unavailable, so the hub only removes checks when containers are known
+	HealthChecks []*healthcheck.Result `json:"hc"`
+	// persistent id of the agent, which the hub checks to reject impostors
+	Fingerprint string `json:"fp,omitempty"`
 }
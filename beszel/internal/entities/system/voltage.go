@@ -0,0 +1,48 @@
+package system
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Matches the nominal voltage in labels like +12v, 3.3v or 5vsb
+var nominalVoltageRegex = regexp.MustCompile(`(?:^|[_+])(\d+(?:\.\d+)?)v(?:sb)?(?:_|$)`)
+
+// Nominal voltages of common labels that don't include a voltage
+var nominalVoltages = map[string]float64{
+	"vcc":  3.3,
+	"3vcc": 3.3,
+	"avcc": 3.3,
+	"3vsb": 3.3,
+	"vbat": 3.0,
+}
+
+// NominalVoltage returns the nominal voltage of a voltage sensor from its key,
+// e.g. 12 for nct6775_+12v. Sensors without a fixed nominal voltage, like cpu
+// core voltages that change with load, return false.
+func NominalVoltage(key string) (float64, bool) {
+	key = strings.ToLower(key)
+	if i := strings.LastIndexByte(key, '_'); i >= 0 {
+		if nominal, ok := nominalVoltages[key[i+1:]]; ok {
+			return nominal, true
+		}
+	}
+	if match := nominalVoltageRegex.FindStringSubmatch(key); match != nil {
+		if nominal, err := strconv.ParseFloat(match[1], 64); err == nil && nominal > 0 {
+			return nominal, true
+		}
+	}
+	return 0, false
+}
+
+// VoltageDeviation returns the difference between a voltage and the nominal
+// voltage of its sensor in percent, or false if the nominal voltage is unknown.
+func VoltageDeviation(key string, value float64) (float64, bool) {
+	nominal, ok := NominalVoltage(key)
+	if !ok {
+		return 0, false
+	}
+	return math.Abs(value-nominal) / nominal * 100, true
+}
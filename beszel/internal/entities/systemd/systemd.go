@@ -0,0 +1,10 @@
+package systemd
+
+// Systemd service state and resource usage
+type Service struct {
+	Name  string  `json:"n"`
+	State string  `json:"s"`            // active state (active, failed, activating, ...)
+	Sub   string  `json:"ss,omitempty"` // sub state (running, exited, dead, ...)
+	Cpu   float64 `json:"c"`
+	Mem   float64 `json:"m"`
+}
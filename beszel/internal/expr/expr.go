@@ -0,0 +1,308 @@
+// Package expr evaluates arithmetic expressions of named metrics, such as
+// mem_used/mem_total*100 or disk_read+disk_write.
+//
+// Expressions support numbers, variables, + - * / %, parentheses, unary minus
+// and the functions min, max and abs.
+package expr
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Longest expression accepted by Parse
+const maxLength = 256
+
+// Expr is a parsed expression
+type Expr struct {
+	src  string
+	root node
+	vars []string
+}
+
+type node interface {
+	eval(vars map[string]float64) (float64, bool)
+}
+
+type number float64
+
+type variable string
+
+type negation struct{ x node }
+
+type binary struct {
+	op   byte
+	l, r node
+}
+
+type call struct {
+	fn   string
+	args []node
+}
+
+// Number of arguments of each function, -1 for one or more
+var functions = map[string]int{
+	"min": -1,
+	"max": -1,
+	"abs": 1,
+}
+
+// Parse parses an expression
+func Parse(s string) (*Expr, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("empty expression")
+	}
+	if len(s) > maxLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", maxLength)
+	}
+	p := parser{src: s}
+	root, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q at %d", p.src[p.pos], p.pos+1)
+	}
+	slices.Sort(p.vars)
+	return &Expr{src: s, root: root, vars: slices.Compact(p.vars)}, nil
+}
+
+// ParseVars parses an expression whose variables must be accepted by isVar
+func ParseVars(s string, isVar func(name string) bool) (*Expr, error) {
+	e, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range e.vars {
+		if !isVar(name) {
+			return nil, fmt.Errorf("unknown metric %q", name)
+		}
+	}
+	return e, nil
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Vars returns the names of the variables used in the expression, sorted
+func (e *Expr) Vars() []string {
+	return e.vars
+}
+
+// Eval evaluates the expression. It returns false if a variable is missing or
+// the result isn't a finite number, e.g. after a division by zero.
+func (e *Expr) Eval(vars map[string]float64) (float64, bool) {
+	val, ok := e.root.eval(vars)
+	if !ok || math.IsNaN(val) || math.IsInf(val, 0) {
+		return 0, false
+	}
+	return val, true
+}
+
+func (n number) eval(map[string]float64) (float64, bool) {
+	return float64(n), true
+}
+
+func (v variable) eval(vars map[string]float64) (float64, bool) {
+	val, ok := vars[string(v)]
+	return val, ok
+}
+
+func (n negation) eval(vars map[string]float64) (float64, bool) {
+	x, ok := n.x.eval(vars)
+	return -x, ok
+}
+
+func (b binary) eval(vars map[string]float64) (float64, bool) {
+	l, ok := b.l.eval(vars)
+	if !ok {
+		return 0, false
+	}
+	r, ok := b.r.eval(vars)
+	if !ok {
+		return 0, false
+	}
+	switch b.op {
+	case '+':
+		return l + r, true
+	case '-':
+		return l - r, true
+	case '*':
+		return l * r, true
+	case '/':
+		return l / r, true
+	default:
+		return math.Mod(l, r), true
+	}
+}
+
+func (c call) eval(vars map[string]float64) (float64, bool) {
+	args := make([]float64, len(c.args))
+	for i, arg := range c.args {
+		val, ok := arg.eval(vars)
+		if !ok {
+			return 0, false
+		}
+		args[i] = val
+	}
+	switch c.fn {
+	case "min":
+		return slices.Min(args), true
+	case "max":
+		return slices.Max(args), true
+	default:
+		return math.Abs(args[0]), true
+	}
+}
+
+// parser is a recursive descent parser of the expression grammar:
+//
+//	sum     = product { ("+" | "-") product }
+//	product = unary { ("*" | "/" | "%") unary }
+//	unary   = "-" unary | primary
+//	primary = number | name [ "(" sum { "," sum } ")" ] | "(" sum ")"
+type parser struct {
+	src  string
+	pos  int
+	vars []string
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// Returns the next character without consuming it, or 0 at the end
+func (p *parser) peek() byte {
+	if p.skipSpace(); p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) parseSum() (node, error) {
+	l, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		r, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseProduct() (node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/' || op == '%'; op = p.peek() {
+		p.pos++
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.peek() == '-' {
+		p.pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negation{x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	c := p.peek()
+	start := p.pos
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case c == '(':
+		p.pos++
+		x, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ) at %d", p.pos+1)
+		}
+		p.pos++
+		return x, nil
+	case isDigit(c) || c == '.':
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		val, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", p.src[start:p.pos])
+		}
+		return number(val), nil
+	case isNameStart(c):
+		for p.pos < len(p.src) && (isNameStart(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		name := p.src[start:p.pos]
+		if p.peek() != '(' {
+			p.vars = append(p.vars, name)
+			return variable(name), nil
+		}
+		return p.parseCall(name)
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", c, p.pos+1)
+}
+
+func (p *parser) parseCall(name string) (node, error) {
+	arity, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+	p.pos++ // (
+	var args []node
+	for {
+		arg, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+	if p.peek() != ')' {
+		return nil, fmt.Errorf("missing ) at %d", p.pos+1)
+	}
+	p.pos++
+	if arity >= 0 && len(args) != arity {
+		return nil, fmt.Errorf("%s takes %d argument(s)", name, arity)
+	}
+	return call{fn: name, args: args}, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,156 @@
+//go:build testing
+
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"beszel/internal/testutil/fakeagent"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/crypto/ssh"
+)
+
+// Returns a hub that can connect to agents over SSH, and its public key in
+// authorized_keys format
+func newSSHTestHub(t *testing.T) (*Hub, []byte) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Hub{sshClientConfig: &ssh.ClientConfig{
+		User:            "u",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         4 * time.Second,
+	}}
+	return h, ssh.MarshalAuthorizedKey(signer.PublicKey())
+}
+
+// Returns a system record for the agent
+func newAgentRecord(agent *fakeagent.Agent) *core.Record {
+	record := core.NewRecord(core.NewBaseCollection("systems"))
+	record.Id = "test_system"
+	host, port := agent.HostPort()
+	record.Set("host", host)
+	record.Set("port", port)
+	return record
+}
+
+func TestRequestStatsFromFakeAgent(t *testing.T) {
+	script := []system.CombinedData{
+		{Info: system.Info{Hostname: "web-1", Cores: 4}, Stats: system.Stats{Cpu: 12.5, Mem: 8}},
+		{Info: system.Info{Hostname: "web-1", Cores: 4}, Stats: system.Stats{Cpu: 80, Mem: 8}, Fingerprint: "abc"},
+	}
+	h, pubKey := newSSHTestHub(t)
+	agent, err := fakeagent.New(pubKey, script...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+
+	client, diag, err := h.dialAgent(newAgentRecord(agent))
+	if err != nil {
+		t.Fatalf("dial failed at %s: %v", diag.Stage, err)
+	}
+	defer client.Close()
+
+	// the last entry of the script is repeated once it runs out
+	want := []system.CombinedData{script[0], script[1], script[1]}
+	for i, wantData := range want {
+		var data system.CombinedData
+		if err := h.requestJsonFromAgent(client, "", &data); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if data.Info.Hostname != wantData.Info.Hostname || data.Info.Cores != wantData.Info.Cores ||
+			data.Stats.Cpu != wantData.Stats.Cpu || data.Stats.Mem != wantData.Stats.Mem || data.Fingerprint != wantData.Fingerprint {
+			t.Errorf("request %d = %+v, want %+v", i, data, wantData)
+		}
+	}
+	if requests := agent.Requests(); requests != len(want) {
+		t.Errorf("agent served %d requests, want %d", requests, len(want))
+	}
+}
+
+func TestRequestProcessesFromFakeAgent(t *testing.T) {
+	h, pubKey := newSSHTestHub(t)
+	agent, err := fakeagent.New(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+	agent.SetProcesses(system.ProcessList{Cpu: []system.Process{{Pid: 42, Name: "postgres", Cpu: 93.5}}})
+
+	client, _, err := h.dialAgent(newAgentRecord(agent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	var processes system.ProcessList
+	if err := h.requestJsonFromAgent(client, "processes", &processes); err != nil {
+		t.Fatal(err)
+	}
+	if len(processes.Cpu) != 1 || processes.Cpu[0].Pid != 42 || processes.Cpu[0].Name != "postgres" {
+		t.Fatalf("processes = %+v", processes)
+	}
+	// processes requests don't use the stats script
+	if requests := agent.Requests(); requests != 0 {
+		t.Errorf("agent served %d stats requests, want 0", requests)
+	}
+}
+
+func TestDialFakeAgentFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(t *testing.T, pubKey []byte) *fakeagent.Agent
+		wantStage string
+	}{
+		{
+			name: "agent with another hub's key",
+			setup: func(t *testing.T, _ []byte) *fakeagent.Agent {
+				_, otherKey := newSSHTestHub(t)
+				agent, err := fakeagent.New(otherKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { agent.Close() })
+				return agent
+			},
+			wantStage: stageHandshake,
+		},
+		{
+			name: "agent that stopped",
+			setup: func(t *testing.T, pubKey []byte) *fakeagent.Agent {
+				agent, err := fakeagent.New(pubKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				agent.Close()
+				return agent
+			},
+			wantStage: stageDial,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, pubKey := newSSHTestHub(t)
+			agent := tt.setup(t, pubKey)
+			client, diag, err := h.dialAgent(newAgentRecord(agent))
+			if err == nil {
+				client.Close()
+				t.Fatal("dial succeeded, want error")
+			}
+			if diag.Stage != tt.wantStage || diag.Error == "" {
+				t.Fatalf("diagnostics stage = %q, error = %q, want stage %q with an error", diag.Stage, diag.Error, tt.wantStage)
+			}
+		})
+	}
+}
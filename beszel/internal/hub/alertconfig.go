@@ -0,0 +1,348 @@
+package hub
+
+import (
+	"beszel/internal/alerts"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Alert definitions in the same format as the alerts section of config.yml
+type alertsFile struct {
+	Alerts []AlertConfig `yaml:"alerts"`
+}
+
+// Number of alert records changed by applying alert configs
+type alertChanges struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+}
+
+// Creates or updates the alerts of each config for matching systems and users.
+// Existing alerts are matched by user, system, name, project and expression, and unchanged
+// alerts aren't saved, so applying the same configs again changes nothing.
+// If prune is true, alerts that don't match any config are deleted.
+func (h *Hub) applyAlertConfigs(app core.App, alertConfigs []AlertConfig, prune bool) (alertChanges, error) {
+	var changes alertChanges
+	alertsCollection, err := app.FindCollectionByNameOrId("alerts")
+	if err != nil {
+		return changes, err
+	}
+	// reject unknown alert names and invalid filters before changing anything
+	if nameField, ok := alertsCollection.Fields.GetByName("name").(*core.SelectField); ok {
+		for _, alertConfig := range alertConfigs {
+			if !slices.Contains(nameField.Values, alertConfig.Name) {
+				return changes, fmt.Errorf("invalid alert name %q", alertConfig.Name)
+			}
+			if alertConfig.Name == "Expression" {
+				if _, err := alerts.ParseMetricExpr(alertConfig.Expression); err != nil {
+					return changes, fmt.Errorf("invalid expression %q: %v", alertConfig.Expression, err)
+				}
+			}
+			if alertConfig.Hours != "" {
+				if err := alerts.CheckAlertHours(alertConfig.Hours); err != nil {
+					return changes, fmt.Errorf("invalid hours %q: %v", alertConfig.Hours, err)
+				}
+			}
+		}
+	}
+	selectors := make([]systemSelector, len(alertConfigs))
+	for i, alertConfig := range alertConfigs {
+		if selectors[i], err = parseSelector(app, alertConfig.Filter); err != nil {
+			return changes, fmt.Errorf("invalid filter of %s alert: %v", alertConfig.Name, err)
+		}
+	}
+	users, err := app.FindAllRecords("users")
+	if err != nil {
+		return changes, err
+	}
+	userEmailToID := make(map[string]string, len(users))
+	for _, user := range users {
+		userEmailToID[user.GetString("email")] = user.Id
+	}
+	systems, err := app.FindAllRecords("systems")
+	if err != nil {
+		return changes, err
+	}
+	existingAlerts, err := app.FindAllRecords("alerts")
+	if err != nil {
+		return changes, err
+	}
+	alertKey := func(userID, systemID, name, project, expression string) string {
+		return userID + systemID + name + "/" + project + "/" + expression
+	}
+	existingAlertsMap := make(map[string]*core.Record, len(existingAlerts))
+	for _, alert := range existingAlerts {
+		existingAlertsMap[alertKey(alert.GetString("user"), alert.GetString("system"), alert.GetString("name"), alert.GetString("project"), alert.GetString("expression"))] = alert
+	}
+
+	for i, alertConfig := range alertConfigs {
+		// use the same defaults as the web ui
+		if !slices.Contains(stateAlerts, alertConfig.Name) {
+			if alertConfig.Value == 0 {
+				alertConfig.Value = cmp.Or(alertDefaultValues[alertConfig.Name], 80)
+			}
+			if alertConfig.Min == 0 {
+				alertConfig.Min = 10
+			}
+		}
+		for _, system := range systems {
+			if !matchesAnyPattern(system.GetString("name"), alertConfig.Systems) || !selectors[i].matches(system) {
+				continue
+			}
+			userIDs := system.GetStringSlice("users")
+			if len(alertConfig.Users) > 0 {
+				userIDs = make([]string, 0, len(alertConfig.Users))
+				for _, email := range alertConfig.Users {
+					if id, ok := userEmailToID[email]; ok {
+						userIDs = append(userIDs, id)
+					} else {
+						h.logger.Warn("User not found", "email", email)
+					}
+				}
+			}
+			for _, userID := range userIDs {
+				key := alertKey(userID, system.Id, alertConfig.Name, alertConfig.Project, alertConfig.Expression)
+				alert, ok := existingAlertsMap[key]
+				if ok {
+					delete(existingAlertsMap, key)
+					// skip saving unchanged alerts to keep triggered state
+					if alert.GetFloat("value") == alertConfig.Value && alert.GetInt("min") == int(alertConfig.Min) &&
+						alert.GetInt("cooldown") == alertConfig.Cooldown && alert.GetString("hours") == alertConfig.Hours {
+						continue
+					}
+					changes.Updated++
+				} else {
+					alert = core.NewRecord(alertsCollection)
+					alert.Set("user", userID)
+					alert.Set("system", system.Id)
+					alert.Set("name", alertConfig.Name)
+					alert.Set("project", alertConfig.Project)
+					alert.Set("expression", alertConfig.Expression)
+					changes.Created++
+				}
+				alert.Set("value", alertConfig.Value)
+				alert.Set("min", alertConfig.Min)
+				alert.Set("cooldown", alertConfig.Cooldown)
+				alert.Set("hours", alertConfig.Hours)
+				alert.Set("triggered", false)
+				if err := app.Save(alert); err != nil {
+					return changes, fmt.Errorf("failed to save %s alert: %v", alertConfig.Name, err)
+				}
+			}
+		}
+	}
+
+	if prune {
+		for _, alert := range existingAlertsMap {
+			if err := app.Delete(alert); err != nil {
+				return changes, err
+			}
+			changes.Deleted++
+		}
+	}
+	return changes, nil
+}
+
+// Returns all alerts as alert configs. Alerts with the same settings are
+// grouped, listing the names of their systems and the emails of their users.
+func (h *Hub) exportAlertConfigs() ([]AlertConfig, error) {
+	alerts, err := h.app.FindAllRecords("alerts")
+	if err != nil {
+		return nil, err
+	}
+	systems, err := h.app.FindAllRecords("systems")
+	if err != nil {
+		return nil, err
+	}
+	systemNames := make(map[string]string, len(systems))
+	for _, system := range systems {
+		systemNames[system.Id] = system.GetString("name")
+	}
+	users, err := h.app.FindAllRecords("users")
+	if err != nil {
+		return nil, err
+	}
+	userEmails := make(map[string]string, len(users))
+	for _, user := range users {
+		userEmails[user.Id] = user.GetString("email")
+	}
+
+	settingsKey := func(c *AlertConfig) string {
+		return strings.Join([]string{c.Name, c.Project, c.Expression, strconv.FormatFloat(c.Value, 'f', -1, 64),
+			strconv.Itoa(int(c.Min)), strconv.Itoa(c.Cooldown), c.Hours}, "\x00")
+	}
+	// first group the systems of each user's alerts with the same settings
+	byUser := map[string]*AlertConfig{}
+	for _, alert := range alerts {
+		config := &AlertConfig{
+			Name:       alert.GetString("name"),
+			Project:    alert.GetString("project"),
+			Expression: alert.GetString("expression"),
+			Value:      alert.GetFloat("value"),
+			Min:        uint8(alert.GetInt("min")),
+			Cooldown:   alert.GetInt("cooldown"),
+			Hours:      alert.GetString("hours"),
+			Users:      []string{userEmails[alert.GetString("user")]},
+		}
+		key := settingsKey(config) + "\x00" + config.Users[0]
+		if existing, ok := byUser[key]; ok {
+			config = existing
+		} else {
+			byUser[key] = config
+		}
+		config.Systems = append(config.Systems, systemNames[alert.GetString("system")])
+	}
+	// then group users with the same settings and systems
+	grouped := map[string]*AlertConfig{}
+	for _, config := range byUser {
+		slices.Sort(config.Systems)
+		config.Systems = slices.Compact(config.Systems)
+		key := settingsKey(config) + "\x00" + strings.Join(config.Systems, "\x00")
+		if existing, ok := grouped[key]; ok {
+			existing.Users = append(existing.Users, config.Users...)
+		} else {
+			grouped[key] = config
+		}
+	}
+	configs := make([]AlertConfig, 0, len(grouped))
+	for _, config := range grouped {
+		slices.Sort(config.Users)
+		configs = append(configs, *config)
+	}
+	slices.SortFunc(configs, func(a, b AlertConfig) int {
+		return cmp.Or(
+			cmp.Compare(a.Name, b.Name),
+			cmp.Compare(a.Project, b.Project),
+			slices.Compare(a.Systems, b.Systems),
+			slices.Compare(a.Users, b.Users),
+		)
+	})
+	return configs, nil
+}
+
+// Returns all alerts as YAML
+func (h *Hub) exportAlertsYAML() ([]byte, error) {
+	configs, err := h.exportAlertConfigs()
+	if err != nil {
+		return nil, err
+	}
+	data, err := yaml.Marshal(alertsFile{Alerts: configs})
+	if err != nil {
+		return nil, err
+	}
+	header := "# Alerts exported from Beszel. Import with: beszel alerts import <file>\n\n"
+	return append([]byte(header), data...), nil
+}
+
+// Creates or updates alerts from YAML in a single transaction
+func (h *Hub) importAlertsYAML(data []byte, prune bool) (alertChanges, error) {
+	var file alertsFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return alertChanges{}, fmt.Errorf("invalid alerts file: %w", err)
+	}
+	var changes alertChanges
+	err := h.app.RunInTransaction(func(txApp core.App) error {
+		var err error
+		changes, err = h.applyAlertConfigs(txApp, file.Alerts, prune)
+		return err
+	})
+	return changes, err
+}
+
+// API endpoint that exports all alerts as YAML (GET) or imports alerts from a
+// YAML body (POST). The prune query parameter deletes alerts not in the body.
+// Only available to admins.
+func (h *Hub) handleAlertsYAML(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	if e.Request.Method == http.MethodGet {
+		data, err := h.exportAlertsYAML()
+		if err != nil {
+			return err
+		}
+		return e.Blob(http.StatusOK, "application/yaml", data)
+	}
+	data, err := io.ReadAll(io.LimitReader(e.Request.Body, 5<<20))
+	if err != nil {
+		return apis.NewBadRequestError("Invalid request", err)
+	}
+	changes, err := h.importAlertsYAML(data, e.Request.URL.Query().Get("prune") == "true")
+	if err != nil {
+		return apis.NewBadRequestError(err.Error(), nil)
+	}
+	return e.JSON(http.StatusOK, changes)
+}
+
+// Returns the alerts command, which exports and imports alert definitions as YAML
+func (h *Hub) newAlertsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "alerts",
+		Short: "Export or import alert definitions as YAML",
+	}
+	exportCmd := &cobra.Command{
+		Use:          "export [file]",
+		Short:        "Export all alerts to a YAML file (default stdout)",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := h.app.RunAllMigrations(); err != nil {
+				return err
+			}
+			data, err := h.exportAlertsYAML()
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				_, err = os.Stdout.Write(data)
+				return err
+			}
+			return os.WriteFile(args[0], data, 0644)
+		},
+	}
+	var prune bool
+	importCmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Create or update alerts from a YAML file",
+		Long: `Create or update alerts from a YAML file in the format of the alerts section
+of config.yml. Alerts are matched by name, system, user, project and expression,
+so importing the same file again changes nothing.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := h.app.RunAllMigrations(); err != nil {
+				return err
+			}
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			changes, err := h.importAlertsYAML(data, prune)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Created %d, updated %d and deleted %d alerts\n", changes.Created, changes.Updated, changes.Deleted)
+			return nil
+		},
+	}
+	importCmd.Flags().BoolVar(&prune, "prune", false, "delete alerts that aren't in the file")
+	cmd.AddCommand(exportCmd, importCmd)
+	return cmd
+}
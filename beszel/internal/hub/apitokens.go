@@ -0,0 +1,201 @@
+package hub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// API tokens start with this prefix, so they can be told apart from session tokens
+	apiTokenPrefix = "bsz_"
+	// last_used is updated at most once in this interval
+	apiTokenUsedInterval = time.Minute
+	// set on the auth record of requests made with an API token or impersonation session
+	limitedAuthKey = "beszelLimitedAuth"
+)
+
+// Scopes of API tokens
+const (
+	scopeReadStats     = "read:stats"
+	scopeManageSystems = "manage:systems"
+	scopeManageAlerts  = "manage:alerts"
+)
+
+var apiTokenScopes = []string{scopeReadStats, scopeManageSystems, scopeManageAlerts}
+
+// Read requests allowed with the read:stats scope, by path prefix. Other read
+// requests, like user settings with notification credentials or endpoints with
+// side effects (e.g. sending a test notification), can't be made with API tokens.
+var apiTokenReadPaths = []string{
+	"/api/health",
+	"/api/collections/systems/records",
+	"/api/collections/system_stats/records",
+	"/api/collections/container_stats/records",
+	"/api/collections/fast_stats/records",
+	"/api/collections/smart_devices/records",
+	"/api/collections/systemd_services/records",
+	"/api/collections/listening_ports/records",
+	"/api/collections/guests/records",
+	"/api/collections/system_events/records",
+	"/api/collections/alerts/records",
+	"/api/collections/alerts_history/records",
+	"/api/beszel/export",
+	"/api/beszel/metrics",
+	"/api/beszel/expression",
+	"/api/beszel/live",
+	"/api/beszel/processes",
+	"/api/beszel/containers/noisy",
+	"/api/beszel/topology",
+	"/api/beszel/systems/match",
+	"/api/beszel/changes",
+	"/api/beszel/alerts/history",
+	"/api/beszel/snapshots/diff",
+	"/api/beszel/connection",
+	"/api/beszel/stats/explain",
+}
+
+// Write requests allowed with each manage scope, by path prefix. Other write
+// requests can't be made with API tokens.
+var apiTokenWritePaths = map[string][]string{
+	scopeManageSystems: {"/api/collections/systems/records", "/api/beszel/systems/bulk", "/api/beszel/import", "/api/beszel/agent-update", "/api/beszel/test-connection"},
+	scopeManageAlerts:  {"/api/collections/alerts/records", "/api/beszel/alerts/yaml", "/api/beszel/silence"},
+}
+
+// Returns the hash of a token as stored in the api_tokens collection
+func hashApiToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns the middleware that authenticates requests with an API token in the
+// Authorization header. It runs before PocketBase loads session tokens, and
+// limits the request to the scopes of the token.
+func (h *Hub) apiTokenAuth() *hook.Handler[*core.RequestEvent] {
+	return &hook.Handler[*core.RequestEvent]{
+		Id:       "beszelApiTokenAuth",
+		Priority: apis.DefaultLoadAuthTokenMiddlewarePriority - 1,
+		Func: func(e *core.RequestEvent) error {
+			token := strings.TrimPrefix(e.Request.Header.Get("Authorization"), "Bearer ")
+			if !strings.HasPrefix(token, apiTokenPrefix) {
+				return e.Next()
+			}
+			record, err := e.App.FindFirstRecordByData("api_tokens", "hash", hashApiToken(token))
+			if err != nil {
+				return apis.NewUnauthorizedError("Invalid API token", nil)
+			}
+			now := time.Now().UTC()
+			if expires := record.GetDateTime("expires"); !expires.IsZero() && expires.Time().Before(now) {
+				return apis.NewUnauthorizedError("API token expired", nil)
+			}
+			user, err := e.App.FindRecordById("users", record.GetString("user"))
+			if err != nil {
+				return apis.NewUnauthorizedError("Invalid API token", nil)
+			}
+			if !apiTokenAllows(record.GetStringSlice("scopes"), e.Request.Method, e.Request.URL.Path) {
+				return apis.NewForbiddenError("The API token doesn't have the scope for this request", nil)
+			}
+			if lastUsed := record.GetDateTime("last_used"); lastUsed.Time().Before(now.Add(-apiTokenUsedInterval)) {
+				record.Set("last_used", now)
+				if err := e.App.SaveNoValidate(record); err != nil {
+					h.logger.Error("Failed to update API token", "err", err.Error())
+				}
+			}
+			user.SetRaw(limitedAuthKey, true)
+			e.Auth = user
+			return e.Next()
+		},
+	}
+}
+
+// Returns true if a request with the method and path can be made with a token
+// with the scopes. Tokens can't be used to manage tokens.
+func apiTokenAllows(scopes []string, method, path string) bool {
+	if strings.HasPrefix(path, "/api/beszel/tokens") || strings.HasPrefix(path, "/api/collections/api_tokens/") {
+		return false
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return slices.Contains(scopes, scopeReadStats) && hasPathPrefix(path, apiTokenReadPaths)
+	}
+	for scope, prefixes := range apiTokenWritePaths {
+		if slices.Contains(scopes, scope) && hasPathPrefix(path, prefixes) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the path is one of the prefixes or below one. Prefixes match
+// whole path segments, so /api/beszel/export doesn't match /api/beszel/exports.
+func hasPathPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// API endpoint that creates an API token for the user and returns it. The token
+// is only stored as a hash, so it can't be shown again.
+func (h *Hub) createApiToken(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.Collection().Name != "users" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	var req struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+		Days   int      `json:"days"` // 0 for no expiry
+	}
+	if err := e.BindBody(&req); err != nil {
+		return apis.NewBadRequestError("Invalid request", err)
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Scopes) == 0 || req.Days < 0 {
+		return apis.NewBadRequestError("Name and scopes are required", nil)
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(apiTokenScopes, scope) {
+			return apis.NewBadRequestError("Invalid scope: "+scope, nil)
+		}
+		if scope != scopeReadStats && info.Auth.GetString("role") == "readonly" {
+			return apis.NewForbiddenError("Read only users can only create read:stats tokens", nil)
+		}
+	}
+	collection, err := h.app.FindCollectionByNameOrId("api_tokens")
+	if err != nil {
+		return err
+	}
+	token := apiTokenPrefix + security.RandomString(40)
+	record := core.NewRecord(collection)
+	record.Set("user", info.Auth.Id)
+	record.Set("name", req.Name)
+	record.Set("hash", hashApiToken(token))
+	record.Set("prefix", token[:len(apiTokenPrefix)+6])
+	record.Set("scopes", slices.Compact(slices.Sorted(slices.Values(req.Scopes))))
+	if req.Days > 0 {
+		expires, _ := types.ParseDateTime(time.Now().UTC().AddDate(0, 0, req.Days))
+		record.Set("expires", expires)
+	}
+	if err := h.app.Save(record); err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, map[string]string{"id": record.Id, "token": token})
+}
+
+// Returns true if the auth record is from an API token or impersonation session
+// rather than a session of the user
+func isLimitedAuth(auth *core.Record) bool {
+	limited, _ := auth.GetRaw(limitedAuthKey).(bool)
+	return limited
+}
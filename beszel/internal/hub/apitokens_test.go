@@ -0,0 +1,68 @@
+package hub
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestApiTokenAllows(t *testing.T) {
+	readStats := []string{scopeReadStats}
+	manageSystems := []string{scopeManageSystems}
+	all := apiTokenScopes
+	tests := []struct {
+		name   string
+		scopes []string
+		method string
+		path   string
+		want   bool
+	}{
+		{name: "read stats", scopes: readStats, method: http.MethodGet, path: "/api/collections/system_stats/records", want: true},
+		{name: "read a system", scopes: readStats, method: http.MethodGet, path: "/api/collections/systems/records/abc", want: true},
+		{name: "head request", scopes: readStats, method: http.MethodHead, path: "/api/health", want: true},
+		{name: "read without read scope", scopes: manageSystems, method: http.MethodGet, path: "/api/collections/systems/records"},
+		{name: "read user settings", scopes: all, method: http.MethodGet, path: "/api/collections/user_settings/records"},
+		{name: "read users", scopes: all, method: http.MethodGet, path: "/api/collections/users/records"},
+		{name: "test notification", scopes: all, method: http.MethodGet, path: "/api/beszel/send-test-notification"},
+		{name: "path that extends an allowed path", scopes: readStats, method: http.MethodGet, path: "/api/beszel/exports"},
+		{name: "list tokens", scopes: all, method: http.MethodGet, path: "/api/beszel/tokens"},
+		{name: "read token records", scopes: all, method: http.MethodGet, path: "/api/collections/api_tokens/records"},
+		{name: "delete a token", scopes: all, method: http.MethodDelete, path: "/api/collections/api_tokens/records/abc"},
+		{name: "create a token", scopes: all, method: http.MethodPost, path: "/api/beszel/tokens"},
+		{name: "write with read scope", scopes: readStats, method: http.MethodPost, path: "/api/collections/systems/records"},
+		{name: "create a system", scopes: manageSystems, method: http.MethodPost, path: "/api/collections/systems/records", want: true},
+		{name: "delete a system", scopes: manageSystems, method: http.MethodDelete, path: "/api/collections/systems/records/abc", want: true},
+		{name: "bulk update systems", scopes: manageSystems, method: http.MethodPost, path: "/api/beszel/systems/bulk", want: true},
+		{name: "create an alert without alert scope", scopes: manageSystems, method: http.MethodPost, path: "/api/collections/alerts/records"},
+		{name: "create an alert", scopes: []string{scopeManageAlerts}, method: http.MethodPost, path: "/api/collections/alerts/records", want: true},
+		{name: "update user settings", scopes: all, method: http.MethodPatch, path: "/api/collections/user_settings/records/abc"},
+		{name: "update a user", scopes: all, method: http.MethodPatch, path: "/api/collections/users/records/abc"},
+		{name: "no scopes", method: http.MethodGet, path: "/api/health"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := apiTokenAllows(tt.scopes, tt.method, tt.path); got != tt.want {
+				t.Fatalf("apiTokenAllows(%v, %s, %s) = %v, want %v", tt.scopes, tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	prefixes := []string{"/api/beszel/export", "/api/collections/systems/records"}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "/api/beszel/export", want: true},
+		{path: "/api/beszel/export/csv", want: true},
+		{path: "/api/collections/systems/records/abc", want: true},
+		{path: "/api/beszel/exports"},
+		{path: "/api/beszel"},
+		{path: "/api/collections/systems/recordsx"},
+	}
+	for _, tt := range tests {
+		if got := hasPathPrefix(tt.path, prefixes); got != tt.want {
+			t.Errorf("hasPathPrefix(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package hub
+
+import (
+	"beszel/internal/i18n"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/archive"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/osutils"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/cobra"
+)
+
+// Name prefix of backups created by BACKUP_CRON, so old ones can be removed
+// without touching manual backups
+const scheduledBackupPrefix = "beszel_auto_"
+
+// Entries of the data directory that aren't backed up or replaced by a restore
+var backupExclude = []string{core.LocalBackupsDirName, core.LocalTempDirName, core.LocalAutocertCacheDirName}
+
+// Returns the backup command, which archives the data directory (database,
+// settings, SSH key and certificate authority) into a single zip file
+func (h *Hub) newBackupCommand() *cobra.Command {
+	var s3 bool
+	cmd := &cobra.Command{
+		Use:   "backup [file]",
+		Short: "Back up the database, settings and keys",
+		Long: `Back up the database, settings and keys into a zip archive.
+
+The archive is written to file, or to the backups directory in the data
+directory if no file is given. The hub can keep running, but writes are
+blocked while the archive is created. Use --s3 to upload the archive to the
+S3 storage configured in Settings > Backups.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if s3 && !h.app.Settings().Backups.S3.Enabled {
+				return errors.New("S3 storage isn't enabled in Settings > Backups")
+			}
+			name := backupName("beszel_backup_")
+			dest := filepath.Join(h.app.DataDir(), core.LocalBackupsDirName, name)
+			if len(args) > 0 {
+				dest = args[0]
+				name = filepath.Base(dest)
+			}
+			start := time.Now()
+			if err := h.writeBackup(dest); err != nil {
+				return err
+			}
+			fmt.Printf("Saved backup to %s\n", dest)
+			var size int64
+			if info, err := os.Stat(dest); err == nil {
+				size = info.Size()
+			}
+			if s3 {
+				err := h.uploadBackup(cmd.Context(), dest, name)
+				h.saveBackupResult(name, "s3", size, time.Since(start), err)
+				if err != nil {
+					return fmt.Errorf("failed to upload backup: %w", err)
+				}
+				fmt.Printf("Uploaded backup to S3 as %s\n", name)
+			} else if len(args) == 0 {
+				h.saveBackupResult(name, "local", size, time.Since(start), nil)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&s3, "s3", false, "upload the backup to S3 storage")
+	return cmd
+}
+
+// Returns the restore command, which replaces the data directory with the
+// contents of a backup
+func (h *Hub) newRestoreCommand() *cobra.Command {
+	var s3 bool
+	cmd := &cobra.Command{
+		Use:   "restore <file>",
+		Short: "Restore the database, settings and keys from a backup",
+		Long: `Restore the database, settings and keys from a backup archive.
+
+Stop the hub before restoring. The current data is backed up to the backups
+directory first, so the restore can be undone. Use --s3 to restore a backup
+from the S3 storage configured in Settings > Backups, where file is the
+name of the backup.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			src := args[0]
+			if s3 {
+				if !h.app.Settings().Backups.S3.Enabled {
+					return errors.New("S3 storage isn't enabled in Settings > Backups")
+				}
+				path, err := h.downloadBackup(cmd.Context(), src)
+				if err != nil {
+					return fmt.Errorf("failed to download backup: %w", err)
+				}
+				defer os.Remove(path)
+				src = path
+			}
+			previous := filepath.Join(h.app.DataDir(), core.LocalBackupsDirName, backupName("beszel_pre_restore_"))
+			if err := h.restoreBackup(src, previous); err != nil {
+				return err
+			}
+			fmt.Printf("Restored backup %s\n", args[0])
+			fmt.Printf("Previous data was saved to %s\n", previous)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&s3, "s3", false, "download the backup from S3 storage")
+	return cmd
+}
+
+// Returns a backup file name with the prefix and the current time
+func backupName(prefix string) string {
+	return prefix + time.Now().UTC().Format("20060102150405") + ".zip"
+}
+
+// Archives the data directory to dest. Writes are blocked and the WAL files are
+// checkpointed while the archive is created, so the database is consistent.
+func (h *Hub) writeBackup(dest string) error {
+	dataDir, err := filepath.Abs(h.app.DataDir())
+	if err != nil {
+		return err
+	}
+	dest, err = filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+	// the archive would include itself
+	if rel, err := filepath.Rel(dataDir, dest); err == nil && filepath.IsLocal(rel) {
+		if !slices.Contains(backupExclude, strings.Split(filepath.ToSlash(rel), "/")[0]) {
+			return fmt.Errorf("backup can't be saved inside the data directory, except in %s", core.LocalBackupsDirName)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	return h.app.RunInTransaction(func(txApp core.App) error {
+		return txApp.AuxRunInTransaction(func(txApp core.App) error {
+			txApp.DB().NewQuery("PRAGMA wal_checkpoint(TRUNCATE)").Execute()
+			txApp.AuxDB().NewQuery("PRAGMA wal_checkpoint(TRUNCATE)").Execute()
+			return archive.Create(dataDir, dest, backupExclude...)
+		})
+	})
+}
+
+// Uploads a backup to S3 storage under the name
+func (h *Hub) uploadBackup(ctx context.Context, path, name string) error {
+	fsys, err := h.app.NewBackupsFilesystem()
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+	fsys.SetContext(ctx)
+	file, err := filesystem.NewFileFromPath(path)
+	if err != nil {
+		return err
+	}
+	file.OriginalName = name
+	file.Name = name
+	return fsys.UploadFile(file, name)
+}
+
+// Downloads a backup from S3 storage to a temporary file and returns its path
+func (h *Hub) downloadBackup(ctx context.Context, name string) (string, error) {
+	fsys, err := h.app.NewBackupsFilesystem()
+	if err != nil {
+		return "", err
+	}
+	defer fsys.Close()
+	fsys.SetContext(ctx)
+	reader, err := fsys.GetFile(name)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	tempDir := filepath.Join(h.app.DataDir(), core.LocalTempDirName)
+	if err := os.MkdirAll(tempDir, 0o755); err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(tempDir, "beszel_restore_*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, reader); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// Replaces the data directory with the contents of the backup at src, after
+// backing up the current data to previous. The app's databases are closed, so
+// the process should exit afterwards.
+func (h *Hub) restoreBackup(src, previous string) error {
+	dataDir := h.app.DataDir()
+	tempDir := filepath.Join(dataDir, core.LocalTempDirName)
+	if err := os.MkdirAll(tempDir, 0o755); err != nil {
+		return err
+	}
+	// extract and check the backup before touching the current data
+	extractedDir := filepath.Join(tempDir, "beszel_restore_"+security.PseudorandomString(8))
+	defer os.RemoveAll(extractedDir)
+	if err := archive.Extract(src, extractedDir); err != nil {
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(extractedDir, "data.db")); err != nil {
+		return errors.New("invalid backup: data.db is missing")
+	}
+	if err := h.writeBackup(previous); err != nil {
+		return fmt.Errorf("failed to back up current data: %w", err)
+	}
+	if err := h.app.ResetBootstrapState(); err != nil {
+		return err
+	}
+	// the old data is left in the temp dir, which is removed when the hub starts
+	oldDir := filepath.Join(tempDir, "beszel_old_data_"+security.PseudorandomString(8))
+	if err := osutils.MoveDirContent(dataDir, oldDir, backupExclude...); err != nil {
+		return fmt.Errorf("failed to move current data: %w", err)
+	}
+	if err := osutils.MoveDirContent(extractedDir, dataDir, backupExclude...); err != nil {
+		if revertErr := osutils.MoveDirContent(oldDir, dataDir, backupExclude...); revertErr != nil {
+			return fmt.Errorf("failed to restore backup: %w (reverting failed: %v, previous data is in %s)", err, revertErr, previous)
+		}
+		return fmt.Errorf("failed to restore backup: %w", err)
+	}
+	return nil
+}
+
+// Schedules backups if BACKUP_CRON is set to a cron expression, e.g. "0 3 * * *".
+// Backups are saved to the backups directory, or to S3 if it's enabled in
+// Settings > Backups. Only the latest BACKUP_KEEP (default 7) are kept.
+func (h *Hub) scheduleBackups() {
+	spec, _ := GetEnv("BACKUP_CRON")
+	if spec == "" {
+		return
+	}
+	keepValue, _ := GetEnv("BACKUP_KEEP")
+	keep, err := strconv.Atoi(cmp.Or(keepValue, "7"))
+	if err != nil || keep < 1 {
+		h.logger.Error("Invalid BACKUP_KEEP", "value", keepValue)
+		keep = 7
+	}
+	err = h.app.Cron().Add("scheduled backup", spec, func() {
+		name := backupName(scheduledBackupPrefix)
+		if err := h.app.CreateBackup(context.Background(), name); err != nil {
+			h.logger.Error("Scheduled backup failed", "err", err.Error())
+			return
+		}
+		h.logger.Info("Created scheduled backup", "name", name)
+		if err := h.deleteOldBackups(keep); err != nil {
+			h.logger.Error("Failed to delete old backups", "err", err.Error())
+		}
+	})
+	if err != nil {
+		h.logger.Error("Invalid BACKUP_CRON", "value", spec, "err", err.Error())
+	}
+}
+
+// Deletes scheduled backups except the latest keep
+func (h *Hub) deleteOldBackups(keep int) error {
+	fsys, err := h.app.NewBackupsFilesystem()
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+	files, err := fsys.List(scheduledBackupPrefix)
+	if err != nil {
+		return err
+	}
+	if len(files) <= keep {
+		return nil
+	}
+	// names end with the time they were created, so they sort oldest first
+	keys := make([]string, 0, len(files))
+	for _, file := range files {
+		keys = append(keys, file.Key)
+	}
+	slices.Sort(keys)
+	var errs []error
+	for _, key := range keys[:len(keys)-keep] {
+		errs = append(errs, fsys.Delete(key))
+	}
+	return errors.Join(errs...)
+}
+
+// Default age of the last successful backup after which admins are notified
+const defaultBackupMaxAge = 48 * time.Hour
+
+// Number of backup results kept in the backups collection
+const backupHistoryLimit = 100
+
+// backupStatus is the status of the hub's backups as returned by the API
+type backupStatus struct {
+	Cron        string         `json:"cron"`
+	S3          bool           `json:"s3"`
+	MaxAge      float64        `json:"max_age"` // hours
+	LastSuccess types.DateTime `json:"last_success"`
+	Stale       bool           `json:"stale"`
+	Backups     []*core.Record `json:"backups"`
+}
+
+// Saves the result of each backup created by the hub, whether scheduled with
+// BACKUP_CRON or Settings > Backups, or created manually in the dashboard
+func (h *Hub) recordBackup(e *core.BackupEvent) error {
+	start := time.Now()
+	err := e.Next()
+	storage := "local"
+	if h.app.Settings().Backups.S3.Enabled {
+		storage = "s3"
+	}
+	var size int64
+	if fsys, fsErr := h.app.NewBackupsFilesystem(); err == nil && fsErr == nil {
+		if attrs, err := fsys.Attributes(e.Name); err == nil {
+			size = attrs.Size
+		}
+		fsys.Close()
+	}
+	h.saveBackupResult(e.Name, storage, size, time.Since(start), err)
+	return err
+}
+
+// Saves the result of a backup to the backups collection and removes old results
+func (h *Hub) saveBackupResult(name, storage string, size int64, duration time.Duration, backupErr error) {
+	collection, err := h.app.FindCollectionByNameOrId("backups")
+	if err != nil {
+		return
+	}
+	record := core.NewRecord(collection)
+	record.Set("name", name)
+	record.Set("storage", storage)
+	record.Set("size", size)
+	record.Set("duration", duration.Milliseconds())
+	if backupErr != nil {
+		record.Set("error", backupErr.Error())
+	}
+	if err := h.app.Save(record); err != nil {
+		h.logger.Error("Failed to save backup result", "err", err.Error())
+		return
+	}
+	_, err = h.app.DB().NewQuery("DELETE FROM backups WHERE id NOT IN (SELECT id FROM backups ORDER BY created DESC LIMIT {:limit})").
+		Bind(dbx.Params{"limit": backupHistoryLimit}).Execute()
+	if err != nil {
+		h.logger.Error("Failed to delete old backup results", "err", err.Error())
+	}
+}
+
+// Returns the cron expression of scheduled backups, from BACKUP_CRON or
+// Settings > Backups, or an empty string if backups aren't scheduled
+func (h *Hub) backupCron() string {
+	spec, _ := GetEnv("BACKUP_CRON")
+	return cmp.Or(spec, h.app.Settings().Backups.Cron)
+}
+
+// Returns the age of the last successful backup after which admins are
+// notified, from BACKUP_MAX_AGE (e.g. "36h")
+func (h *Hub) backupMaxAge() time.Duration {
+	value, _ := GetEnv("BACKUP_MAX_AGE")
+	if value == "" {
+		return defaultBackupMaxAge
+	}
+	maxAge, err := time.ParseDuration(value)
+	if err != nil || maxAge <= 0 {
+		h.logger.Error("Invalid BACKUP_MAX_AGE", "value", value)
+		return defaultBackupMaxAge
+	}
+	return maxAge
+}
+
+// Returns the status of scheduled backups and the latest backup results
+func (h *Hub) getBackupStatus() (*backupStatus, error) {
+	status := &backupStatus{
+		Cron:   h.backupCron(),
+		S3:     h.app.Settings().Backups.S3.Enabled,
+		MaxAge: h.backupMaxAge().Hours(),
+	}
+	records, err := h.app.FindRecordsByFilter("backups", "", "-created", 20, 0)
+	if err != nil {
+		return nil, err
+	}
+	status.Backups = records
+	var since time.Time
+	if success, err := h.app.FindRecordsByFilter("backups", "error = ''", "-created", 1, 0); err == nil && len(success) > 0 {
+		status.LastSuccess = success[0].GetDateTime("created")
+		since = status.LastSuccess.Time()
+	} else if len(records) > 0 {
+		// no backup succeeded, so they've been failing since the first one
+		first, err := h.app.FindRecordsByFilter("backups", "", "created", 1, 0)
+		if err != nil {
+			return nil, err
+		}
+		since = first[0].GetDateTime("created").Time()
+	}
+	// backups that were never attempted aren't stale, as they may have just been scheduled
+	status.Stale = status.Cron != "" && !since.IsZero() && time.Since(since) > h.backupMaxAge()
+	return status, nil
+}
+
+// Notifies admins when the last successful backup is older than BACKUP_MAX_AGE.
+// The notification is repeated daily until a backup succeeds.
+func (h *Hub) checkBackupAge() {
+	status, err := h.getBackupStatus()
+	if err != nil || !status.Stale {
+		return
+	}
+	if time.Since(h.lastBackupAlert) < 24*time.Hour {
+		return
+	}
+	h.lastBackupAlert = time.Now()
+	lastSuccess := "never"
+	if !status.LastSuccess.IsZero() {
+		lastSuccess = status.LastSuccess.Time().Format(time.RFC1123)
+	}
+	h.logger.Warn("Backups are stale", "last_success", lastSuccess)
+	message := i18n.M("The last successful backup of the hub was {time}. Check the hub's logs and Settings > Backups.", "time", lastSuccess)
+	if err := h.am.NotifyAdmins(i18n.M("Beszel backups are stale"), message); err != nil {
+		h.logger.Error("Failed to notify admins", "err", err.Error())
+	}
+}
+
+// API endpoint that returns the schedule, last successful backup and latest
+// results of the hub's backups. Only available to admins.
+func (h *Hub) handleBackupStatus(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	status, err := h.getBackupStatus()
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,274 @@
+package hub
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Period of the uptime badge, covered by the 20 minute stats records
+const (
+	badgeUptimePeriod   = 24 * time.Hour
+	badgeUptimeInterval = 20 * time.Minute
+)
+
+// Badge in the format of shields.io endpoint badges
+type badge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+// Colors of badges, as shields.io names and as hex for svg badges
+var badgeColors = map[string]string{
+	"brightgreen": "#4c1",
+	"yellow":      "#dfb317",
+	"orange":      "#fe7d37",
+	"red":         "#e05d44",
+	"lightgrey":   "#9f9f9f",
+}
+
+// Returns the key that signs badge tokens, stored in badge.key in the data
+// directory. Deleting the file and restarting the hub invalidates all badge urls.
+// The badge urls of a single system are invalidated by rotating its badge nonce.
+func (h *Hub) badgeKey() ([]byte, error) {
+	h.badgeKeyMutex.Lock()
+	defer h.badgeKeyMutex.Unlock()
+	if h.badgeKeyData != nil {
+		return h.badgeKeyData, nil
+	}
+	path := filepath.Join(h.app.DataDir(), "badge.key")
+	key, err := os.ReadFile(path)
+	if err == nil && len(key) >= 32 {
+		h.badgeKeyData = key
+		return key, nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		return nil, err
+	}
+	h.badgeKeyData = key
+	return key, nil
+}
+
+// Returns the signature of a badge token for a system shared by a user. The
+// system's badge nonce is included, so rotating it invalidates the system's
+// tokens. Systems without a nonce have the tokens created before nonces existed.
+func (h *Hub) signBadge(systemId, userId, nonce string) (string, error) {
+	key, err := h.badgeKey()
+	if err != nil {
+		return "", err
+	}
+	data := systemId + "." + userId
+	if nonce != "" {
+		data += "." + nonce
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:18]), nil
+}
+
+// Returns the system of a badge token. Tokens stop working when the user who
+// created them loses access to the system or the system's badge nonce is rotated.
+func (h *Hub) verifyBadgeToken(token string) (*core.Record, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid token")
+	}
+	record, err := h.app.FindRecordById("systems", parts[0])
+	if err != nil || !slices.Contains(record.GetStringSlice("users"), parts[1]) {
+		return nil, errors.New("system not found")
+	}
+	signature, err := h.signBadge(record.Id, parts[1], record.GetString("badge_nonce"))
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(signature), []byte(parts[2])) {
+		return nil, errors.New("invalid token")
+	}
+	return record, nil
+}
+
+// Returns a badge token for a system shared by a user
+func (h *Hub) badgeToken(record *core.Record, userId string) (string, error) {
+	signature, err := h.signBadge(record.Id, userId, record.GetString("badge_nonce"))
+	if err != nil {
+		return "", err
+	}
+	return record.Id + "." + userId + "." + signature, nil
+}
+
+// API endpoint that returns a badge token for a system (POST with system)
+func (h *Hub) createBadgeToken(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") == "readonly" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	var req struct {
+		System string `json:"system"`
+	}
+	if err := e.BindBody(&req); err != nil {
+		return apis.NewBadRequestError("Invalid request", err)
+	}
+	record, err := h.getAuthorizedSystem(e, req.System)
+	if err != nil {
+		return err
+	}
+	token, err := h.badgeToken(record, info.Auth.Id)
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, map[string]string{"token": token})
+}
+
+// API endpoint that replaces the badge nonce of a system, invalidating the badge
+// urls of all its users, and returns a new token for the user (POST with system)
+func (h *Hub) rotateBadgeTokens(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") == "readonly" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	var req struct {
+		System string `json:"system"`
+	}
+	if err := e.BindBody(&req); err != nil {
+		return apis.NewBadRequestError("Invalid request", err)
+	}
+	record, err := h.getAuthorizedSystem(e, req.System)
+	if err != nil {
+		return err
+	}
+	record.Set("badge_nonce", security.RandomString(20))
+	if err := h.app.Save(record); err != nil {
+		return err
+	}
+	h.logger.Info("Rotated badge tokens", "system", record.GetString("name"), "user", info.Auth.GetString("email"))
+	token, err := h.badgeToken(record, info.Auth.Id)
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, map[string]string{"token": token})
+}
+
+// Public API endpoint that serves the status or uptime badge of a system as
+// shields.io endpoint json or svg, e.g. /api/beszel/badge/{token}/status.svg
+func (h *Hub) serveBadge(e *core.RequestEvent) error {
+	record, err := h.verifyBadgeToken(e.Request.PathValue("token"))
+	if err != nil {
+		return apis.NewNotFoundError("Badge not found", nil)
+	}
+	kind, format, _ := strings.Cut(e.Request.PathValue("file"), ".")
+	var b *badge
+	switch kind {
+	case "status":
+		b = statusBadge(record)
+	case "uptime":
+		if b, err = h.uptimeBadge(record); err != nil {
+			return err
+		}
+	default:
+		return apis.NewNotFoundError("Badge not found", nil)
+	}
+	e.Response.Header().Set("Cache-Control", "public, max-age=60")
+	switch format {
+	case "json":
+		return e.JSON(http.StatusOK, b)
+	case "svg":
+		e.Response.Header().Set("Content-Type", "image/svg+xml")
+		return e.String(http.StatusOK, b.svg())
+	}
+	return apis.NewNotFoundError("Badge not found", nil)
+}
+
+// Returns a badge with the status of a system
+func statusBadge(record *core.Record) *badge {
+	status := record.GetString("status")
+	colors := map[string]string{"up": "brightgreen", "pending": "yellow", "paused": "lightgrey"}
+	color, ok := colors[status]
+	if !ok {
+		color = "red"
+	}
+	return &badge{SchemaVersion: 1, Label: record.GetString("name"), Message: status, Color: color}
+}
+
+// Returns a badge with the share of 20 minute periods of the last 24 hours
+// in which the system reported stats, counting from when it was added
+func (h *Hub) uptimeBadge(record *core.Record) (*badge, error) {
+	now := time.Now().UTC()
+	since := now.Add(-badgeUptimePeriod)
+	if created := record.GetDateTime("created").Time(); created.After(since) {
+		since = created
+	}
+	expected := int64(now.Sub(since) / badgeUptimeInterval)
+	label := record.GetString("name") + " uptime"
+	if expected == 0 {
+		return &badge{SchemaVersion: 1, Label: label, Message: "n/a", Color: "lightgrey"}, nil
+	}
+	var count int64
+	err := h.app.DB().
+		Select("count(*)").
+		From("system_stats").
+		Where(dbx.NewExp("system={:system} AND type='20m' AND created > {:created}", dbx.Params{
+			"system":  record.Id,
+			"created": since.Format(types.DefaultDateLayout),
+		})).
+		Row(&count)
+	if err != nil {
+		return nil, err
+	}
+	uptime := min(float64(count)/float64(expected)*100, 100)
+	color := "brightgreen"
+	switch {
+	case uptime < 90:
+		color = "red"
+	case uptime < 99:
+		color = "orange"
+	case uptime < 99.9:
+		color = "yellow"
+	}
+	return &badge{SchemaVersion: 1, Label: label, Message: fmt.Sprintf("%.2f%%", uptime), Color: color}, nil
+}
+
+// Renders a flat badge. Text widths are estimated from the number of characters.
+func (b *badge) svg() string {
+	labelWidth := len([]rune(b.Label))*7 + 10
+	messageWidth := len([]rune(b.Message))*7 + 10
+	width := labelWidth + messageWidth
+	label, message := html.EscapeString(b.Label), html.EscapeString(b.Message)
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`+
+		`<rect width="%d" height="20" rx="3" fill="#555"/>`+
+		`<rect x="%d" width="%d" height="20" rx="3" fill="%s"/>`+
+		`<rect x="%d" width="4" height="20" fill="%s"/>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%d" y="14">%s</text><text x="%d" y="14">%s</text></g></svg>`,
+		width, label, message,
+		width,
+		labelWidth, messageWidth, badgeColors[b.Color],
+		labelWidth, badgeColors[b.Color],
+		labelWidth/2, label, labelWidth+messageWidth/2, message,
+	)
+}
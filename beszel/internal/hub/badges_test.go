@@ -0,0 +1,138 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Returns a hub with an app that has a systems collection with the badge fields
+func newBadgeTestHub(t *testing.T) (*Hub, *core.Collection) {
+	t.Helper()
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.ResetBootstrapState() })
+	if err := app.RunSystemMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	collection := core.NewBaseCollection("systems")
+	collection.Fields.Add(
+		&core.TextField{Name: "name"},
+		&core.JSONField{Name: "users"},
+		&core.TextField{Name: "badge_nonce", Hidden: true},
+	)
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+	return &Hub{app: app}, collection
+}
+
+func TestVerifyBadgeToken(t *testing.T) {
+	tests := []struct {
+		name string
+		// changes the system after the token was created, or the token
+		change  func(t *testing.T, h *Hub, record *core.Record, token string) string
+		wantErr bool
+	}{
+		{
+			name:   "valid token",
+			change: func(t *testing.T, h *Hub, record *core.Record, token string) string { return token },
+		},
+		{
+			name: "token created before the system had a nonce",
+			change: func(t *testing.T, h *Hub, record *core.Record, token string) string {
+				record.Set("badge_nonce", "")
+				saveRecord(t, h, record)
+				signature, err := h.signBadge(record.Id, "user1", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return record.Id + ".user1." + signature
+			},
+		},
+		{
+			name: "nonce rotated",
+			change: func(t *testing.T, h *Hub, record *core.Record, token string) string {
+				record.Set("badge_nonce", "rotated")
+				saveRecord(t, h, record)
+				return token
+			},
+			wantErr: true,
+		},
+		{
+			name: "token without nonce after nonce was set",
+			change: func(t *testing.T, h *Hub, record *core.Record, token string) string {
+				signature, err := h.signBadge(record.Id, "user1", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return record.Id + ".user1." + signature
+			},
+			wantErr: true,
+		},
+		{
+			name: "user lost access",
+			change: func(t *testing.T, h *Hub, record *core.Record, token string) string {
+				record.Set("users", []string{"user2"})
+				saveRecord(t, h, record)
+				return token
+			},
+			wantErr: true,
+		},
+		{
+			name: "token of another user",
+			change: func(t *testing.T, h *Hub, record *core.Record, token string) string {
+				signature, err := h.signBadge(record.Id, "user1", record.GetString("badge_nonce"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return record.Id + ".user2." + signature
+			},
+			wantErr: true,
+		},
+		{
+			name:    "malformed token",
+			change:  func(t *testing.T, h *Hub, record *core.Record, token string) string { return record.Id + ".user1" },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, collection := newBadgeTestHub(t)
+			record := core.NewRecord(collection)
+			record.Set("name", "web")
+			record.Set("users", []string{"user1", "user2"})
+			record.Set("badge_nonce", "nonce")
+			saveRecord(t, h, record)
+			token, err := h.badgeToken(record, "user1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			token = tt.change(t, h, record, token)
+
+			verified, err := h.verifyBadgeToken(token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("verifyBadgeToken() accepted the token")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyBadgeToken() error = %v", err)
+			}
+			if verified.Id != record.Id {
+				t.Fatalf("verifyBadgeToken() = system %s, want %s", verified.Id, record.Id)
+			}
+		})
+	}
+}
+
+func saveRecord(t *testing.T, h *Hub, record *core.Record) {
+	t.Helper()
+	if err := h.app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,117 @@
+package hub
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+var bulkActions = []string{"pause", "resume", "delete", "tag", "untag"}
+
+type bulkRequest struct {
+	Filter string   `json:"filter"` // selector query, e.g. "tag:staging"
+	Action string   `json:"action"`
+	Tags   []string `json:"tags"` // for tag and untag
+	DryRun bool     `json:"dry_run"`
+}
+
+// API endpoint that pauses, resumes, deletes, tags or untags the user's systems
+// that match a selector query, e.g. to pause a whole environment during
+// maintenance:
+//
+//	POST /api/beszel/systems/bulk
+//	{"filter": "tag:staging", "action": "pause"}
+//
+// The filter is required, use "*" to match all systems. With dry_run the
+// matching systems are returned without being changed.
+func (h *Hub) bulkUpdateSystems(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") == "readonly" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	var req bulkRequest
+	if err := e.BindBody(&req); err != nil {
+		return apis.NewBadRequestError("Invalid request", err)
+	}
+	if !slices.Contains(bulkActions, req.Action) {
+		return apis.NewBadRequestError("Invalid action, must be one of "+strings.Join(bulkActions, ", "), nil)
+	}
+	req.Tags = cleanTags(req.Tags)
+	if (req.Action == "tag" || req.Action == "untag") && len(req.Tags) == 0 {
+		return apis.NewBadRequestError("Missing tags", nil)
+	}
+	if strings.TrimSpace(req.Filter) == "" {
+		return apis.NewBadRequestError("Missing filter", nil)
+	}
+	selector, err := parseSelector(h.app, req.Filter)
+	if err != nil {
+		return apis.NewBadRequestError("Invalid filter: "+err.Error(), nil)
+	}
+	systems, err := h.app.FindRecordsByFilter("systems", "users.id ?= {:user}", "name", 0, 0, dbx.Params{"user": info.Auth.Id})
+	if err != nil {
+		return err
+	}
+	matched := make([]matchedSystem, 0, len(systems))
+	var errs []error
+	for _, record := range selector.filter(systems) {
+		if !req.DryRun {
+			if err := h.applyBulkAction(record, req); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		matched = append(matched, matchedSystem{
+			Id:     record.Id,
+			Name:   record.GetString("name"),
+			Status: record.GetString("status"),
+		})
+	}
+	if len(errs) > 0 {
+		h.logger.Error("Bulk system update failed", "action", req.Action, "err", errors.Join(errs...).Error())
+	}
+	return e.JSON(http.StatusOK, map[string]any{"systems": matched, "failed": len(errs)})
+}
+
+// Applies a bulk action to a system. Status changes are saved with hooks, so
+// connections are closed or opened as with single updates.
+func (h *Hub) applyBulkAction(record *core.Record, req bulkRequest) error {
+	switch req.Action {
+	case "delete":
+		return h.app.Delete(record)
+	case "pause":
+		if record.GetString("status") == "paused" {
+			return nil
+		}
+		record.Set("status", "paused")
+	case "resume":
+		if record.GetString("status") != "paused" {
+			return nil
+		}
+		record.Set("status", "pending")
+	case "tag", "untag":
+		tags := record.GetStringSlice("tags")
+		if req.Action == "tag" {
+			tags = cleanTags(append(tags, req.Tags...))
+		} else {
+			tags = slices.DeleteFunc(tags, func(tag string) bool { return slices.Contains(req.Tags, tag) })
+		}
+		record.Set("tags", tags)
+	}
+	return h.app.Save(record)
+}
+
+// Trims tags and removes empty and duplicate ones, keeping their order
+func cleanTags(tags []string) []string {
+	cleaned := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(cleaned, tag) {
+			cleaned = append(cleaned, tag)
+		}
+	}
+	return cleaned
+}
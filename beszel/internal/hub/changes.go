@@ -0,0 +1,255 @@
+package hub
+
+import (
+	"beszel/internal/entities/container"
+	"beszel/internal/entities/system"
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Types of fleet changes
+const (
+	changeSystemAdded      = "system_added"
+	changeSystemRemoved    = "system_removed"
+	changeAgentUpgraded    = "agent_upgraded"
+	changeContainerAdded   = "container_added"
+	changeContainerRemoved = "container_removed"
+	changeDiskAdded        = "disk_added"
+	changeRegression       = "regression"
+)
+
+// Increase in average usage (percentage points) between periods reported as a regression
+var regressionThresholds = map[string]float64{
+	"CPU":    20,
+	"Memory": 15,
+	"Disk":   10,
+}
+
+// How long system events are kept
+const systemEventRetention = 30 * 24 * time.Hour
+
+type fleetChange struct {
+	SystemId string     `json:"system_id"`
+	System   string     `json:"system"`
+	Type     string     `json:"type"`
+	Detail   string     `json:"detail"`
+	Time     *time.Time `json:"time,omitempty"` // when known
+}
+
+// Saves a system event for the "what changed" summary
+func (h *Hub) recordSystemEvent(record *core.Record, eventType, detail string) {
+	collection, err := h.app.FindCachedCollectionByNameOrId("system_events")
+	if err != nil {
+		return
+	}
+	event := core.NewRecord(collection)
+	event.Set("system", record.Id)
+	event.Set("name", record.GetString("name"))
+	event.Set("users", record.GetStringSlice("users"))
+	event.Set("type", eventType)
+	event.Set("detail", detail)
+	if err := h.app.SaveNoValidate(event); err != nil {
+		h.logger.Error("Failed to save system event", "err", err.Error())
+	}
+}
+
+// Deletes system events older than the retention
+func (h *Hub) deleteOldSystemEvents() {
+	before := time.Now().UTC().Add(-systemEventRetention).Format(types.DefaultDateLayout)
+	if _, err := h.app.DB().Delete("system_events", dbx.NewExp("created < {:before}", dbx.Params{"before": before})).Execute(); err != nil {
+		h.logger.Error("Failed to delete old system events", "err", err.Error())
+	}
+}
+
+// API endpoint that summarizes notable changes across the user's systems in the
+// last `hours` (default 24, max 72) compared to the period before
+func (h *Hub) getFleetChanges(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	hours, _ := strconv.Atoi(e.Request.URL.Query().Get("hours"))
+	if hours <= 0 {
+		hours = 24
+	}
+	period := time.Duration(min(hours, 72)) * time.Hour
+	now := time.Now().UTC()
+	since := now.Add(-period)
+
+	changes := []fleetChange{}
+
+	// systems added / removed and agent upgrades
+	events, err := h.app.FindRecordsByFilter("system_events", "users.id ?= {:user} && created > {:since}", "created", 0, 0,
+		dbx.Params{"user": info.Auth.Id, "since": since.Format(types.DefaultDateLayout)})
+	if err != nil {
+		return err
+	}
+	eventTypes := map[string]string{"added": changeSystemAdded, "removed": changeSystemRemoved, "upgraded": changeAgentUpgraded}
+	for _, event := range events {
+		changes = append(changes, fleetChange{
+			SystemId: event.GetString("system"),
+			System:   event.GetString("name"),
+			Type:     eventTypes[event.GetString("type")],
+			Detail:   event.GetString("detail"),
+			Time:     types.Pointer(event.GetDateTime("created").Time()),
+		})
+	}
+
+	systems, err := h.app.FindRecordsByFilter("systems", "users.id ?= {:user}", "name", 0, 0, dbx.Params{"user": info.Auth.Id})
+	if err != nil {
+		return err
+	}
+	for _, record := range systems {
+		changes = append(changes, h.systemChanges(record, since, period)...)
+	}
+
+	slices.SortStableFunc(changes, func(a, b fleetChange) int {
+		return cmp.Compare(a.System, b.System)
+	})
+	return e.JSON(http.StatusOK, map[string]any{
+		"since":   since,
+		"changes": changes,
+	})
+}
+
+// Returns container, disk and usage changes of a system since the time
+func (h *Hub) systemChanges(record *core.Record, since time.Time, period time.Duration) []fleetChange {
+	var changes []fleetChange
+	add := func(changeType, detail string, t *time.Time) {
+		changes = append(changes, fleetChange{
+			SystemId: record.Id,
+			System:   record.GetString("name"),
+			Type:     changeType,
+			Detail:   detail,
+			Time:     t,
+		})
+	}
+	previous := since.Add(-period)
+
+	// containers, compared to the previous period if there's data for it
+	before, after := h.containerNames(record.Id, previous, since), h.containerNames(record.Id, since, time.Now().UTC())
+	if len(before) > 0 {
+		for name := range after {
+			if !before[name] {
+				add(changeContainerAdded, name, nil)
+			}
+		}
+		for name := range before {
+			if !after[name] {
+				add(changeContainerRemoved, name, nil)
+			}
+		}
+	}
+
+	// new S.M.A.R.T. devices
+	devices, _ := h.app.FindRecordsByFilter("smart_devices", "system={:system} && created > {:since}", "name", 0, 0,
+		dbx.Params{"system": record.Id, "since": since.Format(types.DefaultDateLayout)})
+	for _, device := range devices {
+		add(changeDiskAdded, device.GetString("name"), types.Pointer(device.GetDateTime("created").Time()))
+	}
+
+	// sustained increase in average usage and new filesystems
+	beforeUsage, beforeFs := h.averageUsage(record.Id, previous, since)
+	afterUsage, afterFs := h.averageUsage(record.Id, since, time.Now().UTC())
+	if beforeUsage != nil && afterUsage != nil {
+		for name, threshold := range regressionThresholds {
+			b, okBefore := beforeUsage[name]
+			a, okAfter := afterUsage[name]
+			if okBefore && okAfter && a-b >= threshold {
+				add(changeRegression, fmt.Sprintf("%s average %.1f%% → %.1f%%", name, b, a), nil)
+			}
+		}
+		for fs := range afterFs {
+			if !beforeFs[fs] {
+				add(changeDiskAdded, fs, nil)
+			}
+		}
+	}
+	return changes
+}
+
+// Returns the names of containers in 120m and 10m container_stats records between the times
+func (h *Hub) containerNames(systemId string, from, to time.Time) map[string]bool {
+	var rows []struct {
+		Stats types.JSONRaw `db:"stats"`
+	}
+	h.app.DB().
+		Select("stats").
+		From("container_stats").
+		Where(dbx.NewExp("system={:system} AND type IN ('10m','120m') AND created > {:from} AND created <= {:to}", dbx.Params{
+			"system": systemId,
+			"from":   from.Format(types.DefaultDateLayout),
+			"to":     to.Format(types.DefaultDateLayout),
+		})).
+		All(&rows)
+	names := make(map[string]bool)
+	for _, row := range rows {
+		var stats []container.Stats
+		if err := json.Unmarshal(row.Stats, &stats); err != nil {
+			continue
+		}
+		for _, stat := range stats {
+			names[stat.Name] = true
+		}
+	}
+	return names
+}
+
+// Returns average cpu, memory and disk usage from 120m system_stats records between
+// the times, and the extra filesystems seen. Usage is nil if there are no records.
+func (h *Hub) averageUsage(systemId string, from, to time.Time) (map[string]float64, map[string]bool) {
+	var rows []struct {
+		Stats types.JSONRaw `db:"stats"`
+	}
+	h.app.DB().
+		Select("stats").
+		From("system_stats").
+		Where(dbx.NewExp("system={:system} AND type='120m' AND created > {:from} AND created <= {:to}", dbx.Params{
+			"system": systemId,
+			"from":   from.Format(types.DefaultDateLayout),
+			"to":     to.Format(types.DefaultDateLayout),
+		})).
+		All(&rows)
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	filesystems := make(map[string]bool)
+	for _, row := range rows {
+		var stats system.Stats
+		if err := json.Unmarshal(row.Stats, &stats); err != nil {
+			continue
+		}
+		if !stats.IsMissing(system.StatsCpu) {
+			sums["CPU"] += stats.Cpu
+			counts["CPU"]++
+		}
+		if !stats.IsMissing(system.StatsMem) {
+			sums["Memory"] += stats.MemPct
+			counts["Memory"]++
+		}
+		if !stats.IsMissing(system.StatsDisk) {
+			sums["Disk"] += stats.DiskPct
+			counts["Disk"]++
+		}
+		for name := range stats.ExtraFs {
+			filesystems[name] = true
+		}
+	}
+	usage := make(map[string]float64, len(sums))
+	for name, sum := range sums {
+		usage[name] = sum / float64(counts[name])
+	}
+	return usage, filesystems
+}
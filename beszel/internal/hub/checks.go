@@ -0,0 +1,193 @@
+package hub
+
+import (
+	"beszel/internal/entities/healthcheck"
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// How often the scheduler looks for due checks
+	checkTickInterval = 10 * time.Second
+	// Interval in seconds of checks without one
+	defaultCheckInterval = 60
+)
+
+// Runs due checks every 10 seconds. Checks without a system are run by the
+// hub, others by the system's agent so services on private networks can be
+// checked from a host that reaches them.
+func (h *Hub) startCheckTicker() {
+	for range time.Tick(checkTickInterval) {
+		h.runDueChecks()
+	}
+}
+
+func (h *Hub) runDueChecks() {
+	records, err := h.app.FindRecordsByFilter("checks", "status != 'paused'", "checked", -1, 0)
+	if err != nil || len(records) == 0 {
+		return
+	}
+	now := time.Now().UTC()
+	for _, record := range records {
+		interval := time.Duration(cmp.Or(record.GetInt("interval"), defaultCheckInterval)) * time.Second
+		// allow half a tick of slack so checks don't slip to the next tick
+		if checked := record.GetDateTime("checked"); !checked.IsZero() && now.Sub(checked.Time()) < interval-checkTickInterval/2 {
+			continue
+		}
+		// skip checks that are still running from the last tick
+		if _, running := h.runningChecks.LoadOrStore(record.Id, true); running {
+			continue
+		}
+		go func() {
+			defer h.runningChecks.Delete(record.Id)
+			h.runCheck(record)
+		}()
+	}
+}
+
+// Runs a check and saves its result
+func (h *Hub) runCheck(record *core.Record) {
+	check := healthcheck.Check{
+		Type:    record.GetString("type"),
+		Target:  record.GetString("target"),
+		Status:  record.GetInt("expected_status"),
+		Keyword: record.GetString("keyword"),
+	}
+	systemId := record.GetString("system")
+	if systemId == "" {
+		h.saveCheckResult(record.Id, check.Run(), nil)
+		return
+	}
+	systemRecord, err := h.app.FindRecordById("systems", systemId)
+	if err != nil {
+		return
+	}
+	// results are unknown while the agent is unreachable, which status alerts cover
+	if systemRecord.GetString("status") != "up" {
+		return
+	}
+	result, err := h.requestCheckFromAgent(systemRecord, check)
+	h.saveCheckResult(record.Id, result, err)
+}
+
+// Saves the result of a check and sends alerts when its status changes to or
+// from down. The status changes to down after more failures in a row than the
+// check's retries. If the agent couldn't run the check, only the error is saved.
+func (h *Hub) saveCheckResult(id string, result *healthcheck.Result, agentErr error) {
+	// reload the record in case it was changed or paused while the check ran
+	record, err := h.app.FindRecordById("checks", id)
+	if err != nil || record.GetString("status") == "paused" {
+		return
+	}
+	record.Set("checked", time.Now().UTC())
+	if agentErr != nil {
+		record.Set("error", "agent: "+agentErr.Error())
+		if err := h.app.SaveNoValidate(record); err != nil {
+			h.logger.Error("Failed to save check", "err", err.Error())
+		}
+		return
+	}
+	oldStatus := record.GetString("status")
+	newStatus := oldStatus
+	failures := 0
+	if result.Status == healthcheck.StatusUp {
+		newStatus = healthcheck.StatusUp
+	} else {
+		failures = record.GetInt("failures") + 1
+		if failures > record.GetInt("retries") {
+			newStatus = healthcheck.StatusDown
+		}
+	}
+	record.Set("status", newStatus)
+	record.Set("failures", failures)
+	record.Set("code", result.StatusCode)
+	record.Set("latency", result.Latency)
+	record.Set("error", result.Error)
+	if err := h.app.SaveNoValidate(record); err != nil {
+		h.logger.Error("Failed to save check", "err", err.Error())
+		return
+	}
+	if record.GetBool("notify") && oldStatus != newStatus && (oldStatus == healthcheck.StatusDown || newStatus == healthcheck.StatusDown) {
+		if err := h.am.HandleCheckAlerts(record, result); err != nil {
+			h.logger.Error("Check alerts error", "err", err.Error())
+		}
+	}
+}
+
+// Asks a system's agent to run a check
+func (h *Hub) requestCheckFromAgent(systemRecord *core.Record, check healthcheck.Check) (*healthcheck.Result, error) {
+	body, err := json.Marshal(check)
+	if err != nil {
+		return nil, err
+	}
+	var result healthcheck.Result
+	if systemRecord.GetString("transport") == "https" {
+		client, err := h.httpsAgentClient(systemRecord)
+		if err != nil {
+			return nil, err
+		}
+		address := net.JoinHostPort(systemRecord.GetString("host"), systemRecord.GetString("port"))
+		res, err := client.Post("https://"+address+"/check", "application/json", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("agent returned %s", res.Status)
+		}
+		if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+			return nil, err
+		}
+	} else {
+		client, err := h.getSystemClient(systemRecord)
+		if err != nil {
+			return nil, err
+		}
+		if err := h.requestJsonFromAgent(client, "check "+base64.StdEncoding.EncodeToString(body), &result); err != nil {
+			return nil, err
+		}
+	}
+	// older agents return their stats for unknown commands
+	if result.Status == "" {
+		return nil, errors.New("agent does not support checks, update it to run checks")
+	}
+	return &result, nil
+}
+
+// Validates the target of a check and sets defaults for new checks
+func (h *Hub) validateCheck(e *core.RecordRequestEvent) error {
+	target := e.Record.GetString("target")
+	switch e.Record.GetString("type") {
+	case healthcheck.TypeHTTP:
+		parsedURL, err := url.Parse(target)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			return apis.NewBadRequestError("Target must be an http or https url", nil)
+		}
+	case healthcheck.TypeTCP:
+		if host, port, err := net.SplitHostPort(target); err != nil || host == "" || port == "" {
+			return apis.NewBadRequestError("Target must be a host:port address", nil)
+		}
+	}
+	if e.Record.GetInt("interval") == 0 {
+		e.Record.Set("interval", defaultCheckInterval)
+	}
+	// users can pause and resume checks, other statuses are set by the hub
+	if status := e.Record.GetString("status"); status != "paused" && (e.Record.IsNew() || e.Record.Original().GetString("status") == "paused") {
+		e.Record.Set("status", "pending")
+		e.Record.Set("failures", 0)
+	} else if status != "paused" {
+		e.Record.Set("status", e.Record.Original().GetString("status"))
+	}
+	return e.Next()
+}
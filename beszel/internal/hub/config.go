@@ -1,11 +1,13 @@
 package hub
 
 import (
+	"beszel/internal/alerts"
 	"beszel/internal/entities/system"
+	"beszel/internal/secrets"
 	"fmt"
-	"log"
 	"os"
-	"path/filepath"
+	"path"
+	"slices"
 	"strconv"
 
 	"github.com/pocketbase/dbx"
@@ -16,7 +18,11 @@ import (
 )
 
 type Config struct {
-	Systems []SystemConfig `yaml:"systems"`
+	Systems       []SystemConfig                         `yaml:"systems"`
+	Alerts        []AlertConfig                          `yaml:"alerts,omitempty"`
+	Notifications []NotificationConfig                   `yaml:"notifications,omitempty"`
+	Templates     map[string]alerts.NotificationTemplate `yaml:"templates,omitempty"` // default notification templates by channel
+	OAuth         *OAuthConfig                           `yaml:"oauth,omitempty"`     // roles and systems of OAuth2 users by group
 }
 
 type SystemConfig struct {
@@ -26,10 +32,47 @@ type SystemConfig struct {
 	Users []string `yaml:"users"`
 }
 
-// Syncs systems with the config.yml file
+type AlertConfig struct {
+	Name       string   `yaml:"name"`
+	Systems    []string `yaml:"systems,omitempty"`    // system names or glob patterns (default all)
+	Filter     string   `yaml:"filter,omitempty"`     // selector query systems also have to match, e.g. "tag:prod os:linux"
+	Project    string   `yaml:"project,omitempty"`    // docker compose project (default whole system)
+	Expression string   `yaml:"expression,omitempty"` // metric expression of Expression alerts, e.g. "mem_used/mem_total*100"
+	Value      float64  `yaml:"value,omitempty"`
+	Min        uint8    `yaml:"min,omitempty"`      // minutes the value is averaged over
+	Cooldown   int      `yaml:"cooldown,omitempty"` // minutes before triggering again after resolving
+	Hours      string   `yaml:"hours,omitempty"`    // when the alert can trigger in the system's time zone, e.g. "mon-fri 09:00-17:00"
+	Users      []string `yaml:"users,omitempty"`    // user emails (default users of the system)
+}
+
+type NotificationConfig struct {
+	User     string   `yaml:"user"`
+	Emails   []string `yaml:"emails"`
+	Webhooks []string `yaml:"webhooks"`
+}
+
+// Alerts that trigger on a state change and don't use a threshold
+var stateAlerts = []string{"Status", "SMART", "Service", "HTTP", "Port"}
+
+// Default thresholds of alerts that don't use the usual default of 80
+var alertDefaultValues = map[string]float64{
+	"Stale":           5,   // minutes
+	"Entropy":         200, // bits
+	"MemoryLeak":      6,   // hours
+	"Latency":         100, // ms
+	"Packet Loss":     10,  // percent
+	"Voltage":         5,   // percent deviation from nominal
+	"CPU Pressure":    20,  // percent of time stalled
+	"Memory Pressure": 10,
+	"IO Pressure":     20,
+}
+
+// Syncs systems, alerts and notification settings with the config.yml file
 func (h *Hub) syncSystemsWithConfig() error {
-	configPath := filepath.Join(h.app.DataDir(), "config.yml")
-	configData, err := os.ReadFile(configPath)
+	h.configMutex.Lock()
+	defer h.configMutex.Unlock()
+
+	configData, err := os.ReadFile(h.configPath())
 	if err != nil {
 		return nil
 	}
@@ -40,11 +83,36 @@ func (h *Hub) syncSystemsWithConfig() error {
 		return fmt.Errorf("failed to parse config.yml: %v", err)
 	}
 
+	if config.OAuth != nil {
+		if err := config.OAuth.validate(h.app); err != nil {
+			h.logger.Error("Invalid oauth config in config.yml", "err", err.Error())
+		} else {
+			h.oauthConfig.Store(config.OAuth)
+		}
+	}
+
 	if len(config.Systems) == 0 {
-		log.Println("No systems defined in config.yml.")
-		return nil
+		h.logger.Info("No systems defined in config.yml")
+	} else if err := h.syncSystems(config.Systems); err != nil {
+		return err
+	}
+	// alerts are only synced if defined so existing alerts aren't removed
+	if config.Alerts != nil {
+		if err := h.syncAlerts(config.Alerts); err != nil {
+			return fmt.Errorf("failed to sync alerts: %v", err)
+		}
+	}
+	if err := h.syncNotifications(config.Notifications); err != nil {
+		return fmt.Errorf("failed to sync notifications: %v", err)
 	}
+	if err := h.am.SetDefaultTemplates(config.Templates); err != nil {
+		return fmt.Errorf("failed to load templates: %v", err)
+	}
+	return nil
+}
 
+// Syncs systems with the systems defined in config.yml
+func (h *Hub) syncSystems(systems []SystemConfig) error {
 	var firstUser *core.Record
 
 	// Create a map of email to user ID
@@ -61,8 +129,8 @@ func (h *Hub) syncSystemsWithConfig() error {
 	}
 
 	// add default settings for systems if not defined in config
-	for i := range config.Systems {
-		system := &config.Systems[i]
+	for i := range systems {
+		system := &systems[i]
 		if system.Port == 0 {
 			system.Port = 45876
 		}
@@ -76,7 +144,7 @@ func (h *Hub) syncSystemsWithConfig() error {
 				if id, ok := userEmailToID[email]; ok {
 					userIDs = append(userIDs, id)
 				} else {
-					log.Printf("User %s not found", email)
+					h.logger.Warn("User not found", "email", email)
 				}
 			}
 			system.Users = userIDs
@@ -97,17 +165,27 @@ func (h *Hub) syncSystemsWithConfig() error {
 	}
 
 	// Process systems from config
-	for _, sysConfig := range config.Systems {
+	for _, sysConfig := range systems {
 		key := sysConfig.Host + ":" + strconv.Itoa(int(sysConfig.Port))
 		if existingSystem, ok := existingSystemsMap[key]; ok {
-			// Update existing system
+			delete(existingSystemsMap, key)
+			// Update existing system if it changed
+			var changed []string
+			if oldName := existingSystem.GetString("name"); oldName != sysConfig.Name {
+				changed = append(changed, "name")
+			}
+			if !sameItems(existingSystem.GetStringSlice("users"), sysConfig.Users) {
+				changed = append(changed, "users")
+			}
+			if len(changed) == 0 {
+				continue
+			}
 			existingSystem.Set("name", sysConfig.Name)
 			existingSystem.Set("users", sysConfig.Users)
-			existingSystem.Set("port", sysConfig.Port)
 			if err := h.app.Save(existingSystem); err != nil {
 				return err
 			}
-			delete(existingSystemsMap, key)
+			h.logger.Info("Updated system from config.yml", "name", sysConfig.Name, "host", key, "changed", changed)
 		} else {
 			// Create new system
 			systemsCollection, err := h.app.FindCollectionByNameOrId("systems")
@@ -124,20 +202,123 @@ func (h *Hub) syncSystemsWithConfig() error {
 			if err := h.app.Save(newSystem); err != nil {
 				return fmt.Errorf("failed to create new system: %v", err)
 			}
+			h.logger.Info("Added system from config.yml", "name", sysConfig.Name, "host", key)
 		}
 	}
 
 	// Delete systems not in config
-	for _, system := range existingSystemsMap {
+	for key, system := range existingSystemsMap {
 		if err := h.app.Delete(system); err != nil {
 			return err
 		}
+		h.logger.Info("Removed system not in config.yml", "name", system.GetString("name"), "host", key)
 	}
 
-	log.Println("Systems synced with config.yml")
+	h.logger.Info("Systems synced with config.yml")
+	return nil
+}
+
+// Syncs alerts with the alerts defined in config.yml.
+// Alerts that aren't defined are deleted.
+func (h *Hub) syncAlerts(alertConfigs []AlertConfig) error {
+	changes, err := h.applyAlertConfigs(h.app, alertConfigs, true)
+	if err != nil {
+		return err
+	}
+	h.logger.Info("Alerts synced with config.yml", "created", changes.Created, "updated", changes.Updated, "deleted", changes.Deleted)
+	return nil
+}
+
+// Syncs notification emails and webhooks of users defined in config.yml
+func (h *Hub) syncNotifications(notificationConfigs []NotificationConfig) error {
+	if len(notificationConfigs) == 0 {
+		return nil
+	}
+	userEmailToID, err := h.getUserEmailToIDMap()
+	if err != nil {
+		return err
+	}
+	for _, notificationConfig := range notificationConfigs {
+		userID, ok := userEmailToID[notificationConfig.User]
+		if !ok {
+			h.logger.Warn("User not found", "email", notificationConfig.User)
+			continue
+		}
+		record, err := h.app.FindFirstRecordByFilter("user_settings", "user={:user}", dbx.Params{"user": userID})
+		if err != nil {
+			collection, err := h.app.FindCollectionByNameOrId("user_settings")
+			if err != nil {
+				return err
+			}
+			record = core.NewRecord(collection)
+			record.Set("user", userID)
+		}
+		// keep other settings like chart time and templates
+		settings := map[string]any{}
+		record.UnmarshalJSONField("settings", &settings)
+		if notificationConfig.Emails == nil {
+			notificationConfig.Emails = []string{}
+		}
+		if notificationConfig.Webhooks == nil {
+			notificationConfig.Webhooks = []string{}
+		}
+		webhooks := cast.ToStringSlice(settings["webhooks"])
+		if err := secrets.DecryptAll(webhooks); err != nil {
+			h.logger.Error("Failed to decrypt webhooks", "user", notificationConfig.User, "err", err.Error())
+		}
+		if !record.IsNew() && slices.Equal(cast.ToStringSlice(settings["emails"]), notificationConfig.Emails) &&
+			slices.Equal(webhooks, notificationConfig.Webhooks) {
+			continue
+		}
+		settings["emails"] = notificationConfig.Emails
+		settings["webhooks"] = notificationConfig.Webhooks
+		record.Set("settings", settings)
+		if err := h.app.Save(record); err != nil {
+			return err
+		}
+		h.logger.Info("Updated notifications from config.yml", "user", notificationConfig.User)
+	}
+	h.logger.Info("Notifications synced with config.yml")
 	return nil
 }
 
+// Returns true if both slices have the same items, in any order
+func sameItems(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// Returns true if name matches any of the glob patterns, or if there are no patterns
+func matchesAnyPattern(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a map of user emails to user IDs
+func (h *Hub) getUserEmailToIDMap() (map[string]string, error) {
+	users, err := h.app.FindAllRecords("users")
+	if err != nil {
+		return nil, err
+	}
+	userEmailToID := make(map[string]string, len(users))
+	for _, user := range users {
+		userEmailToID[user.GetString("email")] = user.Id
+	}
+	return userEmailToID, nil
+}
+
 // Generates content for the config.yml file as a YAML string
 func (h *Hub) generateConfigYAML() (string, error) {
 	// Fetch all systems from the database
@@ -0,0 +1,63 @@
+package hub
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Interval at which config.yml is checked for changes
+const configWatchInterval = 5 * time.Second
+
+// Returns the path of config.yml in the data directory
+func (h *Hub) configPath() string {
+	return filepath.Join(h.app.DataDir(), "config.yml")
+}
+
+// Returns the modification time of config.yml, zero if it doesn't exist
+func (h *Hub) configModTime() time.Time {
+	info, err := os.Stat(h.configPath())
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// Re-syncs systems, alerts and settings when config.yml changes or the hub
+// receives SIGHUP. A change is applied once the file has been left alone for
+// an interval, so a partially written file doesn't remove systems. Removing
+// config.yml keeps the current state.
+func (h *Hub) watchConfig() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	applied := h.configModTime()
+	var pending time.Time
+	for {
+		select {
+		case <-signals:
+			h.logger.Info("Received SIGHUP, reloading config.yml")
+		case <-ticker.C:
+			modTime := h.configModTime()
+			if modTime.IsZero() || modTime.Equal(applied) {
+				pending = time.Time{}
+				continue
+			}
+			// wait for the next tick to make sure the write finished
+			if !modTime.Equal(pending) {
+				pending = modTime
+				continue
+			}
+			h.logger.Info("config.yml changed, reloading")
+		}
+		applied = h.configModTime()
+		pending = time.Time{}
+		if err := h.syncSystemsWithConfig(); err != nil {
+			h.logger.Error("Failed to reload config.yml", "err", err.Error())
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package hub
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/crypto/ssh"
+)
+
+// agentConn is an open connection from the hub to an agent. It counts the
+// bytes transferred and is removed from the hub's list when closed.
+type agentConn struct {
+	net.Conn
+	id        string
+	systemId  string // empty for https connections, which are pooled by address
+	address   string
+	transport string
+	since     time.Time
+	read      atomic.Uint64
+	written   atomic.Uint64
+	closeOnce sync.Once
+	untrack   func()
+}
+
+func (c *agentConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Add(uint64(n))
+	return n, err
+}
+
+func (c *agentConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(uint64(n))
+	return n, err
+}
+
+func (c *agentConn) Close() error {
+	c.closeOnce.Do(c.untrack)
+	return c.Conn.Close()
+}
+
+// agentConnInfo is an open agent connection as returned by the API
+type agentConnInfo struct {
+	Id         string    `json:"id"`
+	System     string    `json:"system"`
+	SystemName string    `json:"system_name"`
+	Transport  string    `json:"transport"`
+	Address    string    `json:"address"`
+	RemoteAddr string    `json:"remote_addr"`
+	Since      time.Time `json:"since"`
+	BytesRead  uint64    `json:"bytes_read"`
+	BytesSent  uint64    `json:"bytes_sent"`
+}
+
+// Wraps a connection to an agent so it's listed until closed
+func (h *Hub) trackAgentConn(conn net.Conn, systemId, address, transport string) net.Conn {
+	c := &agentConn{
+		Conn:      conn,
+		id:        strconv.FormatUint(h.lastAgentConnId.Add(1), 10),
+		systemId:  systemId,
+		address:   address,
+		transport: transport,
+		since:     time.Now().UTC(),
+	}
+	c.untrack = func() { h.agentConns.Delete(c.id) }
+	h.agentConns.Store(c.id, c)
+	return c
+}
+
+// Dials agents using the https transport and tracks the connections
+func (h *Hub) dialHTTPSAgent(ctx context.Context, network, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return h.trackAgentConn(conn, "", address, "https"), nil
+}
+
+// API endpoint that lists the open connections to agents (GET), or closes one
+// (DELETE with ?id=) to debug stuck or duplicate connections. Closed ssh
+// connections are reopened on the next update. Only available to admins.
+func (h *Hub) handleAgentConnections(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	if e.Request.Method == http.MethodDelete {
+		value, ok := h.agentConns.Load(e.Request.URL.Query().Get("id"))
+		if !ok {
+			return apis.NewNotFoundError("Connection not found", nil)
+		}
+		conn := value.(*agentConn)
+		conn.Close()
+		// drop the system's client so the next update doesn't reuse it
+		if client, ok := h.systemConnections.Load(conn.systemId); ok && client.(*ssh.Client).LocalAddr().String() == conn.LocalAddr().String() {
+			h.systemConnections.CompareAndDelete(conn.systemId, client)
+		}
+		h.logger.Info("Agent connection closed", "admin", info.Auth.Email(), "system", conn.systemId, "address", conn.address)
+		return e.NoContent(http.StatusNoContent)
+	}
+
+	// https connections are matched to systems by address
+	systems := map[string]*core.Record{}
+	records, err := h.app.FindAllRecords("systems")
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		systems[record.Id] = record
+		if record.GetString("transport") == "https" {
+			systems[net.JoinHostPort(record.GetString("host"), record.GetString("port"))] = record
+		}
+	}
+	conns := []agentConnInfo{}
+	h.agentConns.Range(func(_, value any) bool {
+		c := value.(*agentConn)
+		conn := agentConnInfo{
+			Id:         c.id,
+			System:     c.systemId,
+			Transport:  c.transport,
+			Address:    c.address,
+			RemoteAddr: c.RemoteAddr().String(),
+			Since:      c.since,
+			BytesRead:  c.read.Load(),
+			BytesSent:  c.written.Load(),
+		}
+		if conn.System == "" {
+			if record := systems[c.address]; record != nil {
+				conn.System = record.Id
+			}
+		}
+		if record := systems[conn.System]; record != nil {
+			conn.SystemName = record.GetString("name")
+		}
+		conns = append(conns, conn)
+		return true
+	})
+	slices.SortFunc(conns, func(a, b agentConnInfo) int {
+		return a.Since.Compare(b.Since)
+	})
+	return e.JSON(http.StatusOK, conns)
+}
@@ -0,0 +1,143 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"cmp"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/crypto/ssh"
+)
+
+// Stages of a connection to an agent
+const (
+	stageDial      = "dial"
+	stageHandshake = "handshake"
+	stageRequest   = "request"
+	stageDone      = "done"
+)
+
+// Details of the last connection attempt to a system
+type connectionDiagnostics struct {
+	Time          time.Time `json:"time"`
+	Duration      float64   `json:"duration"` // milliseconds
+	Address       string    `json:"address"`
+	Transport     string    `json:"transport"`
+	Stage         string    `json:"stage"` // last stage reached (dial, handshake, request, done)
+	Error         string    `json:"error,omitempty"`
+	ServerVersion string    `json:"server_version,omitempty"` // ssh server version string
+	AgentVersion  string    `json:"agent_version,omitempty"`
+}
+
+// Dials the agent and performs the ssh handshake, returning diagnostics for the attempt
+func (h *Hub) dialAgent(record *core.Record) (*ssh.Client, *connectionDiagnostics, error) {
+	diag := &connectionDiagnostics{
+		Time:      time.Now().UTC(),
+		Address:   net.JoinHostPort(record.GetString("host"), record.GetString("port")),
+		Transport: "ssh",
+		Stage:     stageDial,
+	}
+	defer func() {
+		diag.Duration = float64(time.Since(diag.Time).Microseconds()) / 1000
+	}()
+	conn, err := net.DialTimeout("tcp", diag.Address, h.sshClientConfig.Timeout)
+	if err != nil {
+		diag.Error = err.Error()
+		return nil, diag, err
+	}
+	conn = h.trackAgentConn(conn, record.Id, diag.Address, "ssh")
+	diag.Stage = stageHandshake
+	conn.SetDeadline(time.Now().Add(h.sshClientConfig.Timeout))
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, diag.Address, h.sshClientConfig)
+	if err != nil {
+		conn.Close()
+		diag.Error = err.Error()
+		return nil, diag, err
+	}
+	conn.SetDeadline(time.Time{})
+	diag.ServerVersion = string(clientConn.ServerVersion())
+	diag.Stage = stageRequest
+	return ssh.NewClient(clientConn, chans, reqs), diag, nil
+}
+
+// Saves the result of a request to an agent in the system's diagnostics
+func (h *Hub) recordRequestResult(record *core.Record, diag *connectionDiagnostics, start time.Time, err error, agentVersion string) {
+	if diag == nil {
+		// reused connection
+		diag = &connectionDiagnostics{
+			Time:      start.UTC(),
+			Address:   net.JoinHostPort(record.GetString("host"), record.GetString("port")),
+			Transport: cmp.Or(record.GetString("transport"), "ssh"),
+		}
+		if prev, ok := h.connectionDiagnostics.Load(record.Id); ok {
+			diag.ServerVersion = prev.(*connectionDiagnostics).ServerVersion
+		}
+	}
+	diag.Stage = stageRequest
+	if err != nil {
+		diag.Error = err.Error()
+	} else {
+		diag.Stage = stageDone
+		diag.AgentVersion = agentVersion
+	}
+	diag.Duration = float64(time.Since(diag.Time).Microseconds()) / 1000
+	h.connectionDiagnostics.Store(record.Id, diag)
+}
+
+// API endpoint that returns details of the last connection attempt to a system
+func (h *Hub) getConnectionDiagnostics(e *core.RequestEvent) error {
+	record, err := h.getAuthorizedSystem(e, e.Request.URL.Query().Get("system"))
+	if err != nil {
+		return err
+	}
+	diag, ok := h.connectionDiagnostics.Load(record.Id)
+	if !ok {
+		return apis.NewNotFoundError("No connection attempts yet", nil)
+	}
+	return e.JSON(http.StatusOK, diag)
+}
+
+// API endpoint that makes a new connection to a system and returns its diagnostics.
+// The connection is closed afterwards and doesn't affect the existing one.
+func (h *Hub) testConnection(e *core.RequestEvent) error {
+	record, err := h.getAuthorizedSystem(e, e.Request.URL.Query().Get("system"))
+	if err != nil {
+		return err
+	}
+	if record.GetString("transport") == "https" {
+		start := time.Now()
+		diag := &connectionDiagnostics{
+			Time:      start.UTC(),
+			Address:   net.JoinHostPort(record.GetString("host"), record.GetString("port")),
+			Transport: "https",
+			Stage:     stageRequest,
+		}
+		var data system.CombinedData
+		if err := h.requestJsonFromAgentHTTPS(record, "/stats", &data); err != nil {
+			diag.Error = err.Error()
+		} else {
+			diag.Stage = stageDone
+			diag.AgentVersion = data.Info.AgentVersion
+		}
+		diag.Duration = float64(time.Since(start).Microseconds()) / 1000
+		return e.JSON(http.StatusOK, diag)
+	}
+	client, diag, err := h.dialAgent(record)
+	if err != nil {
+		return e.JSON(http.StatusOK, diag)
+	}
+	defer client.Close()
+	// request system info to confirm the agent responds and get its version
+	var data system.CombinedData
+	if err := h.requestJsonFromAgent(client, "", &data); err != nil {
+		diag.Error = err.Error()
+	} else {
+		diag.Stage = stageDone
+		diag.AgentVersion = data.Info.AgentVersion
+	}
+	diag.Duration = float64(time.Since(diag.Time).Microseconds()) / 1000
+	return e.JSON(http.StatusOK, diag)
+}
@@ -0,0 +1,43 @@
+package hub
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Sets down_since when a system goes down and clears it when it's no longer down
+func setDownSince(e *core.RecordEvent) error {
+	switch {
+	case e.Record.GetString("status") != "down":
+		e.Record.Set("down_since", "")
+	case e.Record.Original().GetString("status") != "down" || e.Record.GetDateTime("down_since").IsZero():
+		e.Record.Set("down_since", types.NowDateTime())
+	}
+	return e.Next()
+}
+
+// Deletes systems with a ttl (in hours) that have been down for longer than the ttl.
+// Used for ephemeral systems like autoscaled or spot instances that won't come back.
+func (h *Hub) deleteExpiredSystems() {
+	records, err := h.app.FindRecordsByFilter("systems", "status = 'down' && ttl > 0 && down_since != ''", "", 0, 0)
+	if err != nil {
+		h.logger.Error("Failed to query systems", "err", err.Error())
+		return
+	}
+	now := time.Now().UTC()
+	for _, record := range records {
+		downSince := record.GetDateTime("down_since").Time()
+		ttl := time.Duration(record.GetInt("ttl")) * time.Hour
+		if now.Sub(downSince) < ttl {
+			continue
+		}
+		h.deleteSystemConnection(record)
+		if err := h.app.Delete(record); err != nil {
+			h.logger.Error("Failed to delete expired system", "system", record.GetString("name"), "err", err.Error())
+			continue
+		}
+		h.logger.Info("Deleted expired system", "system", record.GetString("name"), "down since", downSince)
+	}
+}
@@ -0,0 +1,158 @@
+package hub
+
+import (
+	"beszel/internal/records"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Agent payloads kept in memory for each system, so the latest 1m records can be explained
+const rawSampleLimit = 10
+
+// Payload of an update from an agent and the connection it came over
+type rawSample struct {
+	StatsId    string                 `json:"-"`
+	Received   time.Time              `json:"received"`
+	Connection *connectionDiagnostics `json:"connection,omitempty"`
+	Payload    json.RawMessage        `json:"payload"`
+}
+
+// Latest samples of a system, oldest first
+type rawSamples struct {
+	mutex   sync.Mutex
+	samples []*rawSample
+}
+
+// Explanation of how a stats record was created
+type statsExplanation struct {
+	Id          string            `json:"id"`
+	System      string            `json:"system"`
+	Type        string            `json:"type"`
+	Created     types.DateTime    `json:"created"`
+	Stats       types.JSONRaw     `json:"stats"`
+	Sample      *rawSample        `json:"sample,omitempty"`      // 1m records received recently
+	Delay       float64           `json:"delay,omitempty"`       // ms between receiving the payload and saving the record
+	Aggregation *statsAggregation `json:"aggregation,omitempty"` // longer records
+	Note        string            `json:"note,omitempty"`
+}
+
+// Shorter records a longer record was averaged from
+type statsAggregation struct {
+	SourceType  string         `json:"source_type"`
+	Interval    float64        `json:"interval"` // seconds
+	MinRecords  int            `json:"min_records"`
+	WindowStart types.DateTime `json:"window_start"`
+	WindowEnd   types.DateTime `json:"window_end"`
+	Sources     []statsSource  `json:"sources"` // shorter records still kept
+}
+
+type statsSource struct {
+	Id      string         `db:"id" json:"id"`
+	Created types.DateTime `db:"created" json:"created"`
+}
+
+// Keeps the payload of an update from an agent with the id of its stats record
+func (h *Hub) storeRawSample(systemId, statsId string, payload json.RawMessage) {
+	if payload == nil {
+		return
+	}
+	sample := &rawSample{StatsId: statsId, Received: time.Now().UTC(), Payload: payload}
+	if diag, ok := h.connectionDiagnostics.Load(systemId); ok {
+		connection := *diag.(*connectionDiagnostics)
+		sample.Connection = &connection
+	}
+	value, _ := h.rawSamples.LoadOrStore(systemId, &rawSamples{})
+	samples := value.(*rawSamples)
+	samples.mutex.Lock()
+	defer samples.mutex.Unlock()
+	samples.samples = append(samples.samples, sample)
+	if len(samples.samples) > rawSampleLimit {
+		samples.samples = samples.samples[len(samples.samples)-rawSampleLimit:]
+	}
+}
+
+// Returns the kept payload of a stats record, if any
+func (h *Hub) findRawSample(systemId, statsId string) *rawSample {
+	value, ok := h.rawSamples.Load(systemId)
+	if !ok {
+		return nil
+	}
+	samples := value.(*rawSamples)
+	samples.mutex.Lock()
+	defer samples.mutex.Unlock()
+	for _, sample := range samples.samples {
+		if sample.StatsId == statsId {
+			return sample
+		}
+	}
+	return nil
+}
+
+// API endpoint that explains a system_stats record (admin only): the agent's
+// payload and connection for recent 1m records, or the shorter records that
+// longer records were averaged from
+func (h *Hub) explainStats(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	record, err := h.app.FindRecordById("system_stats", e.Request.URL.Query().Get("id"))
+	if err != nil {
+		return apis.NewNotFoundError("Stats record not found", nil)
+	}
+	explanation := statsExplanation{
+		Id:      record.Id,
+		System:  record.GetString("system"),
+		Type:    record.GetString("type"),
+		Created: record.GetDateTime("created"),
+	}
+	explanation.Stats, _ = record.GetRaw("stats").(types.JSONRaw)
+
+	shorterType, interval, minRecords, ok := records.ShorterRecordType(explanation.Type)
+	if !ok {
+		explanation.Sample = h.findRawSample(explanation.System, record.Id)
+		if explanation.Sample == nil {
+			explanation.Note = "The agent's payload is only kept in memory for the last updates of each system"
+		} else {
+			explanation.Delay = float64(explanation.Created.Time().Sub(explanation.Sample.Received).Microseconds()) / 1000
+		}
+		return e.JSON(http.StatusOK, explanation)
+	}
+
+	// longer records are dated to the last millisecond of their interval
+	end := explanation.Created.Time().Add(time.Millisecond)
+	aggregation := &statsAggregation{
+		SourceType: shorterType,
+		Interval:   interval.Seconds(),
+		MinRecords: minRecords,
+		Sources:    []statsSource{},
+	}
+	aggregation.WindowStart, _ = types.ParseDateTime(end.Add(-interval))
+	aggregation.WindowEnd, _ = types.ParseDateTime(end)
+	err = h.app.DB().
+		Select("id", "created").
+		From("system_stats").
+		Where(dbx.NewExp("system={:system} AND type={:type} AND created >= {:start} AND created < {:end}", dbx.Params{
+			"system": explanation.System,
+			"type":   shorterType,
+			"start":  aggregation.WindowStart.String(),
+			"end":    aggregation.WindowEnd.String(),
+		})).
+		OrderBy("created").
+		All(&aggregation.Sources)
+	if err != nil {
+		return err
+	}
+	explanation.Aggregation = aggregation
+	if len(aggregation.Sources) < minRecords {
+		explanation.Note = "Some shorter records were deleted after their retention"
+	}
+	return e.JSON(http.StatusOK, explanation)
+}
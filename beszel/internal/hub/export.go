@@ -0,0 +1,239 @@
+package hub
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"beszel/internal/records"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+type exportRow struct {
+	Created types.DateTime `db:"created" json:"created"`
+	Stats   types.JSONRaw  `db:"stats" json:"stats"`
+}
+
+// API endpoint that streams system_stats or container_stats records of a system as CSV or JSON
+//
+// Query params: system, collection (system_stats | container_stats), type (1m, 10m, ...),
+// from / to (RFC 3339 or unix seconds), format (csv | json)
+func (h *Hub) exportStats(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+	record, err := h.getAuthorizedSystem(e, query.Get("system"))
+	if err != nil {
+		return err
+	}
+
+	collection := query.Get("collection")
+	if collection == "" {
+		collection = "system_stats"
+	}
+	if collection != "system_stats" && collection != "container_stats" {
+		return apis.NewBadRequestError("Invalid collection", nil)
+	}
+	recordType := query.Get("type")
+	if recordType == "" {
+		recordType = "1m"
+	}
+	if !slices.Contains(records.RecordTypes, recordType) {
+		return apis.NewBadRequestError("Invalid type", nil)
+	}
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		return apis.NewBadRequestError("Invalid format", nil)
+	}
+
+	filter := dbx.And(dbx.HashExp{"system": record.Id, "type": recordType})
+	for param, op := range map[string]string{"from": ">=", "to": "<="} {
+		if value := query.Get(param); value != "" {
+			t, err := parseExportTime(value)
+			if err != nil {
+				return apis.NewBadRequestError(fmt.Sprintf("Invalid %s time", param), nil)
+			}
+			filter = dbx.And(filter, dbx.NewExp("created "+op+" {:"+param+"}", dbx.Params{param: t.UTC().Format(types.DefaultDateLayout)}))
+		}
+	}
+	newQuery := func() *dbx.SelectQuery {
+		return h.app.DB().Select("created", "stats").From(collection).Where(filter).OrderBy("created")
+	}
+
+	filename := fmt.Sprintf("%s_%s_%s.%s", record.GetString("name"), collection, recordType, format)
+	e.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if format == "json" {
+		return h.exportJSON(e, newQuery)
+	}
+	if collection == "container_stats" {
+		return h.exportContainerCSV(e, newQuery)
+	}
+	return h.exportSystemCSV(e, newQuery)
+}
+
+// Parses a time in RFC 3339 format or unix seconds
+func parseExportTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Streams rows as a JSON array
+func (h *Hub) exportJSON(e *core.RequestEvent, newQuery func() *dbx.SelectQuery) error {
+	rows, err := newQuery().Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	e.Response.Header().Set("Content-Type", "application/json")
+	e.Response.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(e.Response)
+	e.Response.Write([]byte("["))
+	for i := 0; rows.Next(); i++ {
+		var row exportRow
+		if err := rows.ScanStruct(&row); err != nil {
+			return err
+		}
+		if i > 0 {
+			e.Response.Write([]byte(","))
+		}
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	_, err = e.Response.Write([]byte("]\n"))
+	return err
+}
+
+// Streams system stats as CSV with one column per (flattened) stat.
+// Columns vary by system (sensors, filesystems, GPUs), so they're collected in a first pass.
+func (h *Hub) exportSystemCSV(e *core.RequestEvent, newQuery func() *dbx.SelectQuery) error {
+	rows, err := newQuery().Rows()
+	if err != nil {
+		return err
+	}
+	columnSet := make(map[string]struct{})
+	for rows.Next() {
+		var row exportRow
+		if err := rows.ScanStruct(&row); err != nil {
+			rows.Close()
+			return err
+		}
+		for key := range flattenStats(row.Stats) {
+			columnSet[key] = struct{}{}
+		}
+	}
+	rows.Close()
+	columns := make([]string, 0, len(columnSet))
+	for key := range columnSet {
+		columns = append(columns, key)
+	}
+	slices.Sort(columns)
+
+	rows, err = newQuery().Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	e.Response.Header().Set("Content-Type", "text/csv")
+	e.Response.WriteHeader(http.StatusOK)
+	w := csv.NewWriter(e.Response)
+	w.Write(append([]string{"created"}, columns...))
+	line := make([]string, len(columns)+1)
+	for rows.Next() {
+		var row exportRow
+		if err := rows.ScanStruct(&row); err != nil {
+			return err
+		}
+		values := flattenStats(row.Stats)
+		line[0] = row.Created.Time().Format(time.RFC3339)
+		for i, key := range columns {
+			line[i+1] = values[key]
+		}
+		w.Write(line)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Streams container stats as CSV with one line per container per record
+func (h *Hub) exportContainerCSV(e *core.RequestEvent, newQuery func() *dbx.SelectQuery) error {
+	rows, err := newQuery().Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	e.Response.Header().Set("Content-Type", "text/csv")
+	e.Response.WriteHeader(http.StatusOK)
+	w := csv.NewWriter(e.Response)
+	w.Write([]string{"created", "name", "cpu", "mem", "net_sent", "net_recv"})
+	for rows.Next() {
+		var row exportRow
+		if err := rows.ScanStruct(&row); err != nil {
+			return err
+		}
+		var containers []struct {
+			Name        string  `json:"n"`
+			Cpu         float64 `json:"c"`
+			Mem         float64 `json:"m"`
+			NetworkSent float64 `json:"ns"`
+			NetworkRecv float64 `json:"nr"`
+		}
+		if err := json.Unmarshal(row.Stats, &containers); err != nil {
+			continue
+		}
+		created := row.Created.Time().Format(time.RFC3339)
+		for _, c := range containers {
+			w.Write([]string{created, c.Name, formatFloat(c.Cpu), formatFloat(c.Mem), formatFloat(c.NetworkSent), formatFloat(c.NetworkRecv)})
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Flattens a stats JSON object into a map of dotted keys to string values (e.g. "t.cpu_thermal")
+func flattenStats(data types.JSONRaw) map[string]string {
+	var stats map[string]any
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil
+	}
+	result := make(map[string]string, len(stats))
+	var flatten func(prefix string, value any)
+	flatten = func(prefix string, value any) {
+		switch v := value.(type) {
+		case map[string]any:
+			for key, nested := range v {
+				flatten(prefix+"."+key, nested)
+			}
+		case float64:
+			result[prefix] = formatFloat(v)
+		case nil:
+			// missing stats are left empty
+			result[prefix] = ""
+		default:
+			result[prefix] = fmt.Sprint(v)
+		}
+	}
+	for key, value := range stats {
+		flatten(key, value)
+	}
+	return result
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
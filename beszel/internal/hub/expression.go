@@ -0,0 +1,82 @@
+package hub
+
+import (
+	"beszel/internal/alerts"
+	"beszel/internal/entities/system"
+	"beszel/internal/records"
+	"math"
+	"net/http"
+	"slices"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Value of an expression at the creation time of a system_stats record
+type expressionPoint struct {
+	Created types.DateTime `json:"created"`
+	Value   *float64       `json:"value"` // null if a metric of the expression is missing
+}
+
+// API endpoint that evaluates a metric expression over the system_stats records
+// of a system, so charts can show derived metrics without agent changes.
+//
+// Query params: system, expr (e.g. mem_used/mem_total*100), type (1m, 10m, ...),
+// from (RFC 3339 or unix seconds)
+func (h *Hub) getExpressionSeries(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+	record, err := h.getAuthorizedSystem(e, query.Get("system"))
+	if err != nil {
+		return err
+	}
+	metricExpr, err := alerts.ParseMetricExpr(query.Get("expr"))
+	if err != nil {
+		return apis.NewBadRequestError("Invalid expression: "+err.Error(), nil)
+	}
+	recordType := query.Get("type")
+	if recordType == "" {
+		recordType = "1m"
+	}
+	// 10 second stats of systems with fast polling are kept in their own collection
+	collection := "system_stats"
+	if recordType == "10s" {
+		collection = "fast_stats"
+	} else if !slices.Contains(records.RecordTypes, recordType) {
+		return apis.NewBadRequestError("Invalid type", nil)
+	}
+	filter := dbx.And(dbx.HashExp{"system": record.Id, "type": recordType})
+	if value := query.Get("from"); value != "" {
+		from, err := parseExportTime(value)
+		if err != nil {
+			return apis.NewBadRequestError("Invalid from time", nil)
+		}
+		filter = dbx.And(filter, dbx.NewExp("created >= {:from}", dbx.Params{"from": from.UTC().Format(types.DefaultDateLayout)}))
+	}
+
+	rows, err := h.app.DB().Select("created", "stats").From(collection).Where(filter).OrderBy("created").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	points := []expressionPoint{}
+	for rows.Next() {
+		var row exportRow
+		if err := rows.ScanStruct(&row); err != nil {
+			return err
+		}
+		var stats system.Stats
+		if err := json.Unmarshal(row.Stats, &stats); err != nil {
+			continue
+		}
+		point := expressionPoint{Created: row.Created}
+		if value, ok := metricExpr.Eval(stats.Values()); ok {
+			value = math.Round(value*100) / 100
+			point.Value = &value
+		}
+		points = append(points, point)
+	}
+	return e.JSON(http.StatusOK, points)
+}
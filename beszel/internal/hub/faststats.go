@@ -0,0 +1,111 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"beszel/internal/records"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Seconds between requests for the system stats of systems with fast polling,
+// sent to agents like systemUpdateInterval
+const fastPollInterval = "10"
+
+// Default retention of fast_stats records, set with FAST_STATS_RETENTION
+const defaultFastStatsRetention = time.Hour
+
+// Sets the retention of fast_stats records from FAST_STATS_RETENTION
+func (h *Hub) loadFastStatsRetention() {
+	h.fastStatsRetention = defaultFastStatsRetention
+	value, exists := GetEnv("FAST_STATS_RETENTION")
+	if !exists {
+		return
+	}
+	retention, err := records.ParseRetention(value)
+	if err != nil || retention <= 0 {
+		h.logger.Error("Invalid retention", "type", "10s", "value", value)
+		return
+	}
+	h.fastStatsRetention = retention
+	h.logger.Info("Record retention", "type", "10s", "retention", retention.String())
+}
+
+func (h *Hub) startFastPollTicker() {
+	for range time.Tick(10 * time.Second) {
+		h.pollFastSystems()
+	}
+}
+
+// Requests the system stats of systems with fast polling enabled that are up.
+// Their regular update continues to save 1m records, handle alerts and set
+// the status, so agents that fail here are only skipped.
+func (h *Hub) pollFastSystems() {
+	records, err := h.app.FindRecordsByFilter("systems", "fast_polling = true && status = 'up'", "", -1, 0)
+	if err != nil || len(records) == 0 {
+		return
+	}
+	for _, record := range records {
+		// skip systems whose last request hasn't finished
+		if _, running := h.fastPolls.LoadOrStore(record.Id, true); running {
+			continue
+		}
+		go func() {
+			defer h.fastPolls.Delete(record.Id)
+			h.pollFastSystem(record)
+		}()
+	}
+}
+
+func (h *Hub) pollFastSystem(record *core.Record) {
+	// older agents ignore the scope and return all stats, which still work
+	var systemData system.CombinedData
+	// agents sample the stats when requested, so records are dated by the
+	// request rather than by a response that's slow or saved in a later flush
+	sampled := types.NowDateTime()
+	if record.GetString("transport") == "https" {
+		if err := h.requestJsonFromAgentHTTPS(record, "/stats?interval="+fastPollInterval+"&scope=system", &systemData); err != nil {
+			h.logger.Debug("Failed to get fast stats", "system", record.GetString("name"), "err", err.Error())
+			return
+		}
+	} else {
+		client, err := h.getSystemClient(record)
+		if err == nil {
+			err = h.requestJsonFromAgent(client, "stats "+fastPollInterval+" system", &systemData)
+		}
+		if err != nil {
+			h.logger.Debug("Failed to get fast stats", "system", record.GetString("name"), "err", err.Error())
+			return
+		}
+	}
+	// the regular update rejects and reports agents with a different fingerprint
+	if stored := record.GetString("fingerprint"); stored != "" && stored != systemData.Fingerprint {
+		return
+	}
+	// throttled agents return their last full collection instead of new stats
+	if systemData.Info.Throttled != "" {
+		return
+	}
+	collection, err := h.app.FindCachedCollectionByNameOrId("fast_stats")
+	if err != nil {
+		h.logger.Error("Failed to get collection", "err", err.Error())
+		return
+	}
+	fastStatsRecord := core.NewRecord(collection)
+	fastStatsRecord.Set("system", record.Id)
+	fastStatsRecord.Set("stats", systemData.Stats)
+	fastStatsRecord.Set("type", "10s")
+	fastStatsRecord.SetRaw("created", sampled)
+	h.stats.add(fastStatsRecord)
+	h.publishLiveStats(record.Id, &systemData.Stats)
+}
+
+// Deletes fast_stats records older than their retention
+func (h *Hub) deleteOldFastStats() {
+	before := time.Now().UTC().Add(-h.fastStatsRetention).Format(types.DefaultDateLayout)
+	if _, err := h.app.DB().Delete("fast_stats", dbx.NewExp("created < {:before}", dbx.Params{"before": before})).Execute(); err != nil {
+		h.logger.Error("Failed to delete old fast stats", "err", err.Error())
+	}
+}
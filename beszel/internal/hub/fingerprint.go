@@ -0,0 +1,69 @@
+package hub
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// How often the users of a system are notified while another agent keeps reporting for it
+const fingerprintAlertInterval = time.Hour
+
+// Returns false if stats come from an agent with a different fingerprint than
+// the one stored for the system. The first fingerprint an agent reports is
+// stored (saved with its stats). Systems without a stored fingerprint accept
+// agents that don't send one (older versions).
+func (h *Hub) checkAgentFingerprint(record *core.Record, fingerprint string) bool {
+	stored := record.GetString("fingerprint")
+	if stored == "" {
+		if fingerprint == "" {
+			return true
+		}
+		if !fingerprintRegex.MatchString(fingerprint) {
+			h.logger.Warn("Invalid agent fingerprint", "system", record.GetString("name"))
+			return false
+		}
+		record.Set("fingerprint", fingerprint)
+		h.logger.Info("Stored agent fingerprint", "system", record.GetString("name"))
+		return true
+	}
+	if fingerprint == stored {
+		return true
+	}
+	h.logger.Warn("Rejected stats from an agent with a different fingerprint",
+		"system", record.GetString("name"), "host", record.GetString("host"), "port", record.GetString("port"))
+	h.updateSystemStatus(record, "down")
+	if last, ok := h.fingerprintAlerts.Load(record.Id); !ok || time.Since(last.(time.Time)) > fingerprintAlertInterval {
+		h.fingerprintAlerts.Store(record.Id, time.Now())
+		h.am.HandleFingerprintAlert(record)
+	}
+	return false
+}
+
+// API endpoint that clears the stored fingerprint of a system (POST with id),
+// so a reinstalled agent is accepted on its next update
+func (h *Hub) resetFingerprint(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") == "readonly" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	var req struct {
+		Id string `json:"id"`
+	}
+	if err := e.BindBody(&req); err != nil {
+		return apis.NewBadRequestError("Invalid request", err)
+	}
+	record, err := h.getAuthorizedSystem(e, req.Id)
+	if err != nil {
+		return err
+	}
+	record.Set("fingerprint", "")
+	if err := h.app.SaveNoValidate(record); err != nil {
+		return err
+	}
+	h.fingerprintAlerts.Delete(record.Id)
+	h.logger.Info("Reset agent fingerprint", "system", record.GetString("name"), "user", info.Auth.GetString("email"))
+	return e.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,56 @@
+package hub
+
+import (
+	"beszel/internal/entities/guest"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Syncs guests records with the virtual machines reported by a hypervisor host
+func (h *Hub) updateGuests(systemRecord *core.Record, guests []*guest.Guest) {
+	if guests == nil {
+		return
+	}
+	records, err := h.app.FindAllRecords("guests",
+		dbx.NewExp("system={:system}", dbx.Params{"system": systemRecord.Id}),
+	)
+	if err != nil {
+		h.logger.Error("Failed to get guests", "err", err.Error())
+		return
+	}
+	existing := make(map[string]*core.Record, len(records))
+	for _, record := range records {
+		existing[record.GetString("name")] = record
+	}
+	collection, err := h.app.FindCachedCollectionByNameOrId("guests")
+	if err != nil {
+		h.logger.Error("Failed to get guests collection", "err", err.Error())
+		return
+	}
+	for _, g := range guests {
+		record, ok := existing[g.Name]
+		if ok {
+			delete(existing, g.Name)
+		} else {
+			record = core.NewRecord(collection)
+			record.Set("system", systemRecord.Id)
+			record.Set("name", g.Name)
+		}
+		record.Set("hypervisor", g.Hypervisor)
+		record.Set("state", g.State)
+		record.Set("vcpus", g.Vcpus)
+		record.Set("mem_max", g.MemMax)
+		record.Set("cpu", g.Cpu)
+		record.Set("mem", g.Mem)
+		if err := h.app.SaveNoValidate(record); err != nil {
+			h.logger.Error("Failed to save guest", "err", err.Error())
+		}
+	}
+	// delete guests no longer reported by the host
+	for _, record := range existing {
+		if err := h.app.Delete(record); err != nil {
+			h.logger.Error("Failed to delete guest", "err", err.Error())
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package hub
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Time without a system update tick after which the scheduler is considered stopped
+const schedulerTimeout = time.Minute
+
+// Result of the hub's health checks, included in /api/health responses
+type healthStatus struct {
+	Database  string             `json:"database"`
+	Scheduler string             `json:"scheduler"`
+	Agents    map[string]int     `json:"agents"` // number of systems by status
+	Writes    *statsBufferStatus `json:"writes"`
+}
+
+func (s healthStatus) healthy() bool {
+	return s.Database == "ok" && s.Scheduler == "ok"
+}
+
+// Middleware that adds the hub's health checks to PocketBase's /api/health
+// endpoint and responds with 503 if a check fails. Superusers get PocketBase's
+// response, which the PocketBase dashboard uses.
+func (h *Hub) healthCheck(e *core.RequestEvent) error {
+	if e.Request.Method != http.MethodGet || e.Request.URL.Path != "/api/health" {
+		return e.Next()
+	}
+	status := h.checkHealth(e.Request.Context())
+	code, message := http.StatusOK, "API is healthy."
+	if !status.healthy() {
+		code, message = http.StatusServiceUnavailable, "API is unhealthy."
+	} else if e.HasSuperuserAuth() {
+		return e.Next()
+	}
+	// same format as PocketBase's response
+	return e.JSON(code, map[string]any{
+		"code":    code,
+		"message": message,
+		"data":    status,
+	})
+}
+
+// Checks that the database is reachable and systems are being updated
+func (h *Hub) checkHealth(ctx context.Context) healthStatus {
+	status := healthStatus{Database: "ok", Scheduler: "ok", Agents: map[string]int{}, Writes: h.stats.status()}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var rows []struct {
+		Status string `db:"status"`
+		Count  int    `db:"count"`
+	}
+	err := h.app.DB().NewQuery("SELECT status, COUNT(*) AS count FROM systems GROUP BY status").WithContext(ctx).All(&rows)
+	if err != nil {
+		status.Database = err.Error()
+	}
+	for _, row := range rows {
+		status.Agents[row.Status] = row.Count
+	}
+
+	if lastUpdate := time.Unix(h.lastSystemUpdate.Load(), 0); time.Since(lastUpdate) > schedulerTimeout {
+		status.Scheduler = fmt.Sprintf("systems not updated since %s", lastUpdate.UTC().Format(time.RFC3339))
+	}
+	return status
+}
+
+// Health checks a running hub for use as a container healthcheck command.
+//
+// Usage: beszel health [--url http://localhost:8090] [--insecure]
+func Health(args []string) error {
+	flags := flag.NewFlagSet("health", flag.ExitOnError)
+	url := flags.String("url", "http://localhost:8090", "URL of the hub")
+	// the hub's certificate doesn't match localhost when it serves HTTPS itself
+	insecure := flags.Bool("insecure", false, "Skip verification of the hub's certificate")
+	flags.Parse(args)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	if *insecure {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	res, err := client.Get(strings.TrimSuffix(*url, "/") + "/api/health")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var body struct {
+			Data healthStatus `json:"data"`
+		}
+		json.NewDecoder(res.Body).Decode(&body)
+		return errors.New(res.Status + ": database " + body.Data.Database + ", scheduler " + body.Data.Scheduler)
+	}
+	return nil
+}
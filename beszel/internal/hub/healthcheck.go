@@ -0,0 +1,62 @@
+package hub
+
+import (
+	"beszel/internal/entities/healthcheck"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Syncs http_checks records for a system and fires alerts when a check goes down or recovers
+func (h *Hub) updateHealthChecks(systemRecord *core.Record, results []*healthcheck.Result) {
+	if results == nil {
+		return
+	}
+	records, err := h.app.FindAllRecords("http_checks",
+		dbx.NewExp("system={:system}", dbx.Params{"system": systemRecord.Id}),
+	)
+	if err != nil {
+		h.logger.Error("Failed to get http checks", "err", err.Error())
+		return
+	}
+	existing := make(map[string]*core.Record, len(records))
+	for _, record := range records {
+		existing[record.GetString("name")] = record
+	}
+	collection, err := h.app.FindCachedCollectionByNameOrId("http_checks")
+	if err != nil {
+		h.logger.Error("Failed to get http_checks collection", "err", err.Error())
+		return
+	}
+	for _, result := range results {
+		record, ok := existing[result.Name]
+		if ok {
+			delete(existing, result.Name)
+		} else {
+			record = core.NewRecord(collection)
+			record.Set("system", systemRecord.Id)
+			record.Set("name", result.Name)
+		}
+		oldStatus := record.GetString("status")
+		record.Set("url", result.URL)
+		record.Set("status", result.Status)
+		record.Set("code", result.StatusCode)
+		record.Set("latency", result.Latency)
+		record.Set("error", result.Error)
+		if err := h.app.SaveNoValidate(record); err != nil {
+			h.logger.Error("Failed to save http check", "err", err.Error())
+			continue
+		}
+		if oldStatus != result.Status && (oldStatus == healthcheck.StatusDown || result.Status == healthcheck.StatusDown) {
+			if err := h.am.HandleHealthCheckAlerts(systemRecord, result); err != nil {
+				h.logger.Error("HTTP alerts error", "err", err.Error())
+			}
+		}
+	}
+	// delete checks of containers that were removed or no longer have the label
+	for _, record := range existing {
+		if err := h.app.Delete(record); err != nil {
+			h.logger.Error("Failed to delete http check", "err", err.Error())
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package hub
+
+import (
+	"crypto/tls"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Address the hub listens on for HTTPS when TLS is configured with env vars
+const defaultHttpsAddr = "0.0.0.0:443"
+
+// How often certificate files are checked for changes
+const certReloadInterval = time.Minute
+
+// Returns the arguments of the hub command with the HTTPS settings from env vars
+// added to the serve command, so the dashboard can be served securely without a
+// reverse proxy:
+//
+//	TLS_CERT / TLS_KEY: paths of a certificate and key, reloaded when they change
+//	TLS_DOMAIN: comma separated domains to get Let's Encrypt certificates for
+//	HTTPS_ADDR: address to listen on (default 0.0.0.0:443)
+//
+// Arguments are returned unchanged if the serve command sets its own HTTPS
+// address, or if TLS isn't configured.
+func httpsServeArgs(args []string) []string {
+	if len(args) == 0 || args[0] != "serve" {
+		return args
+	}
+	certFile, _ := GetEnv("TLS_CERT")
+	domains, _ := GetEnv("TLS_DOMAIN")
+	if certFile == "" && domains == "" {
+		return args
+	}
+	for _, arg := range args[1:] {
+		if arg == "--https" || strings.HasPrefix(arg, "--https=") {
+			return args
+		}
+	}
+	addr, _ := GetEnv("HTTPS_ADDR")
+	if addr == "" {
+		addr = defaultHttpsAddr
+	}
+	args = append(slices.Clone(args), "--https", addr)
+	// the certificate files take precedence over Let's Encrypt
+	if certFile == "" {
+		for _, domain := range strings.Split(domains, ",") {
+			if domain = strings.TrimSpace(domain); domain != "" {
+				args = append(args, domain)
+			}
+		}
+	}
+	return args
+}
+
+// Serves the certificate files set by TLS_CERT and TLS_KEY instead of
+// requesting certificates from Let's Encrypt
+func (h *Hub) useCertificateFiles(se *core.ServeEvent) error {
+	certFile, _ := GetEnv("TLS_CERT")
+	if certFile == "" {
+		return se.Next()
+	}
+	keyFile, _ := GetEnv("TLS_KEY")
+	loader := &certLoader{certFile: certFile, keyFile: keyFile}
+	if _, err := loader.getCertificate(nil); err != nil {
+		return err
+	}
+	se.Server.TLSConfig.GetCertificate = loader.getCertificate
+	se.Server.TLSConfig.NextProtos = []string{"h2", "http/1.1"}
+	h.logger.Info("Serving HTTPS with certificate files", "cert", certFile, "key", keyFile)
+	return se.Next()
+}
+
+// certLoader loads a certificate and key from files, and reloads them when
+// they change so renewed certificates are used without a restart
+type certLoader struct {
+	certFile string
+	keyFile  string
+	mutex    sync.Mutex
+	cert     *tls.Certificate
+	modTime  time.Time
+	checked  time.Time
+}
+
+func (l *certLoader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.cert != nil && time.Since(l.checked) < certReloadInterval {
+		return l.cert, nil
+	}
+	l.checked = time.Now()
+	info, err := os.Stat(l.certFile)
+	if err != nil {
+		if l.cert != nil {
+			return l.cert, nil
+		}
+		return nil, err
+	}
+	if l.cert != nil && info.ModTime().Equal(l.modTime) {
+		return l.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		// keep the last certificate if the new files are incomplete
+		if l.cert != nil {
+			return l.cert, nil
+		}
+		return nil, err
+	}
+	l.cert = &cert
+	l.modTime = info.ModTime()
+	return l.cert, nil
+}
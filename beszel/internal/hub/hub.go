@@ -5,21 +5,26 @@ import (
 	"beszel"
 	"beszel/internal/alerts"
 	"beszel/internal/entities/system"
+	"beszel/internal/logging"
+	"beszel/internal/mqtt"
 	"beszel/internal/records"
+	"beszel/internal/remotewrite"
+	"beszel/internal/secrets"
+	"beszel/internal/statushooks"
 	"beszel/internal/users"
 	"beszel/site"
 	"context"
 	"crypto/ed25519"
 	"encoding/pem"
 	"fmt"
-	"log"
-	"net"
+	"log/slog"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/goccy/go-json"
@@ -32,22 +37,83 @@ import (
 
 type Hub struct {
 	app               *pocketbase.PocketBase
+	logger            *slog.Logger
 	systemConnections sync.Map
 	sshClientConfig   *ssh.ClientConfig
 	pubKey            string
 	am                *alerts.AlertManager
 	um                *users.UserManager
 	rm                *records.RecordManager
+	rw                *remotewrite.Writer
+	mqtt              *mqtt.Publisher
+	statusHooks       *statushooks.Sender
+	latency           *latencyProber
+	ca                *certAuthority
+	stats             *statsBuffer
 	systemStats       *core.Collection
 	containerStats    *core.Collection
+
+	// last connection attempt details for each system
+	connectionDiagnostics sync.Map
+
+	// last configuration snapshot of each system
+	lastSnapshots sync.Map
+
+	// group mapping of OAuth2 users from config.yml
+	oauthConfig atomic.Pointer[OAuthConfig]
+
+	// ids of checks that are running, so slow checks don't overlap
+	runningChecks sync.Map
+
+	// unix time of the last system update tick, used by the health check
+	lastSystemUpdate atomic.Int64
+
+	// open connections to agents by id, and the id of the last one
+	agentConns      sync.Map
+	lastAgentConnId atomic.Uint64
+
+	// current or last agent update rollout
+	rollout atomic.Pointer[agentRollout]
+
+	// serializes auto-registration so quotas can't be exceeded by concurrent requests
+	enrollmentMutex     sync.Mutex
+	lastEnrollmentAlert time.Time
+
+	// last notification about stale backups
+	lastBackupAlert time.Time
+
+	// open live streams of stats (*liveSubscriber)
+	liveSubscribers sync.Map
+
+	// serializes syncs with config.yml on start and reload
+	configMutex sync.Mutex
+
+	// last notification about an agent with a different fingerprint, by system id
+	fingerprintAlerts sync.Map
+
+	// latest agent payloads of each system (*rawSamples)
+	rawSamples sync.Map
+
+	// ids of systems with a running fast stats request, and how long fast_stats are kept
+	fastPolls          sync.Map
+	fastStatsRetention time.Duration
+
+	// key that signs badge tokens, loaded on first use
+	badgeKeyMutex sync.Mutex
+	badgeKeyData  []byte
 }
 
+// NewHub creates a hub. Logs are written to the default slog logger and to the
+// app logs shown in the admin UI.
 func NewHub(app *pocketbase.PocketBase) *Hub {
+	logger := slog.New(logging.NewTeeHandler(slog.Default().Handler(), &appLogHandler{app: app}))
 	return &Hub{
-		app: app,
-		am:  alerts.NewAlertManager(app),
-		um:  users.NewUserManager(app),
-		rm:  records.NewRecordManager(app),
+		app:    app,
+		logger: logger,
+		am:     alerts.NewAlertManager(app, logger),
+		um:     users.NewUserManager(app, logger),
+		rm:     records.NewRecordManager(app, logger),
+		stats:  newStatsBuffer(app, logger),
 	}
 }
 
@@ -71,12 +137,16 @@ func (h *Hub) Run() {
 		Dir:         "../../migrations",
 	})
 
+	// add import, silence, db, alerts, backup and restore commands
+	h.app.RootCmd.AddCommand(h.newImportCommand(), h.newSilenceCommand(), h.newDbCommand(), h.newAlertsCommand(), h.newBackupCommand(), h.newRestoreCommand())
+
 	// initial setup
 	h.app.OnServe().BindFunc(func(se *core.ServeEvent) error {
 		// create ssh client config
 		err := h.createSSHClientConfig()
 		if err != nil {
-			log.Fatal(err)
+			h.logger.Error("Failed to create SSH client config", "err", err)
+			os.Exit(1)
 		}
 		// set general settings
 		settings := h.app.Settings()
@@ -106,7 +176,11 @@ func (h *Hub) Run() {
 			return err
 		}
 		// sync systems with config
-		h.syncSystemsWithConfig()
+		if err := h.syncSystemsWithConfig(); err != nil {
+			h.logger.Error("Failed to sync config.yml", "err", err.Error())
+		}
+		// reload config on changes or SIGHUP
+		go h.watchConfig()
 		return se.Next()
 	})
 
@@ -138,22 +212,159 @@ func (h *Hub) Run() {
 
 	// set up scheduled jobs / ticker for system updates
 	h.app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		// set record retention from RETENTION_<TYPE> env vars (e.g. RETENTION_480M=1y)
+		for _, recordType := range records.RecordTypes {
+			if value, exists := GetEnv("RETENTION_" + strings.ToUpper(recordType)); exists {
+				retention, err := records.ParseRetention(value)
+				if err == nil {
+					err = h.rm.SetRetention(recordType, retention)
+				}
+				if err != nil {
+					h.logger.Error("Invalid retention", "type", recordType, "err", err.Error())
+				} else if retention == 0 {
+					h.logger.Info("Record type disabled, existing records are kept", "type", recordType)
+				} else {
+					h.logger.Info("Record retention", "type", recordType, "retention", retention.String())
+				}
+			}
+		}
+		h.loadFastStatsRetention()
+		// mirror stats to an external time-series database if REMOTE_WRITE_URL is set
+		if url, exists := GetEnv("REMOTE_WRITE_URL"); exists {
+			format, _ := GetEnv("REMOTE_WRITE_FORMAT")
+			token, _ := GetEnv("REMOTE_WRITE_TOKEN")
+			username, _ := GetEnv("REMOTE_WRITE_USERNAME")
+			password, _ := GetEnv("REMOTE_WRITE_PASSWORD")
+			// max series per system of each core, gpu, container, fs or temperature, e.g. "container=50,core=0"
+			limitsValue, _ := GetEnv("REMOTE_WRITE_LIMITS")
+			limits, err := remotewrite.ParseLimits(limitsValue)
+			if err != nil {
+				h.logger.Error("Invalid REMOTE_WRITE_LIMITS", "err", err.Error())
+			}
+			rw, err := remotewrite.NewWriter(remotewrite.Config{
+				URL:      url,
+				Format:   format,
+				Token:    token,
+				Username: username,
+				Password: password,
+				Limits:   limits,
+			}, h.logger)
+			if err != nil {
+				h.logger.Error("Invalid remote write config", "err", err.Error())
+			} else {
+				h.rw = rw
+			}
+		}
+		// publish stats to an MQTT broker if MQTT_URL is set
+		if url, exists := GetEnv("MQTT_URL"); exists {
+			topicPrefix, _ := GetEnv("MQTT_TOPIC_PREFIX")
+			discoveryPrefix, _ := GetEnv("MQTT_DISCOVERY_PREFIX")
+			publisher, err := mqtt.NewPublisher(mqtt.Config{
+				URL:             url,
+				TopicPrefix:     topicPrefix,
+				DiscoveryPrefix: discoveryPrefix,
+			}, h.logger)
+			if err != nil {
+				h.logger.Error("Invalid MQTT config", "err", err.Error())
+			} else {
+				h.mqtt = publisher
+				h.app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+					h.mqtt.Close()
+					return e.Next()
+				})
+			}
+		}
+		// post every status change to STATUS_WEBHOOK_URLS (comma separated)
+		if urls, exists := GetEnv("STATUS_WEBHOOK_URLS"); exists {
+			secret, _ := GetEnv("STATUS_WEBHOOK_SECRET")
+			sender, err := statushooks.NewSender(statushooks.Config{
+				URLs:   strings.FieldsFunc(urls, func(r rune) bool { return r == ',' || r == ' ' }),
+				Secret: secret,
+			}, h.logger)
+			if err != nil {
+				h.logger.Error("Invalid status webhook config", "err", err.Error())
+			} else {
+				h.statusHooks = sender
+			}
+		}
+		// measure latency and packet loss to systems if LATENCY_CHECK is icmp or tcp
+		latencyMode, _ := GetEnv("LATENCY_CHECK")
+		if prober, err := newLatencyProber(latencyMode, h.logger); err != nil {
+			h.logger.Error("Invalid LATENCY_CHECK", "err", err.Error())
+		} else {
+			h.latency = prober
+		}
+		// certificate authority for agents using the https transport
+		if ca, err := h.loadCertAuthority(); err != nil {
+			h.logger.Error("Failed to load certificate authority", "err", err.Error())
+		} else {
+			ca.dialContext = h.dialHTTPSAgent
+			h.ca = ca
+		}
+		// encrypt credentials stored before an encryption key was set
+		if err := secrets.EncryptStored(h.app); err != nil {
+			h.logger.Error("Failed to encrypt stored credentials", "err", err.Error())
+		}
 		// 15 second ticker for system updates
 		go h.startSystemUpdateTicker()
+		// 10 second ticker for user defined checks
+		go h.startCheckTicker()
+		// 10 second ticker for systems with fast polling
+		go h.startFastPollTicker()
+		// deliver queued notifications, including those left by a previous run
+		go h.am.StartNotificationQueue()
 		// set up cron jobs
 		// delete old records once every hour
 		h.app.Cron().MustAdd("delete old records", "8 * * * *", h.rm.DeleteOldRecords)
-		// create longer records every 10 minutes
-		h.app.Cron().MustAdd("create longer records", "*/10 * * * *", func() {
+		h.app.Cron().MustAdd("delete old fast stats", "*/10 * * * *", h.deleteOldFastStats)
+		h.app.Cron().MustAdd("delete old system events", "18 3 * * *", h.deleteOldSystemEvents)
+		h.app.Cron().MustAdd("delete old system snapshots", "24 3 * * *", h.deleteOldSystemSnapshots)
+		h.app.Cron().MustAdd("delete old notifications", "30 3 * * *", func() {
+			if err := h.am.DeleteOldNotifications(); err != nil {
+				h.logger.Error("Failed to delete old notifications", "err", err.Error())
+			}
+		})
+		// create longer records every 10 minutes, a minute after each interval ends
+		h.app.Cron().MustAdd("create longer records", "1-59/10 * * * *", func() {
 			if systemStats, containerStats, err := h.getCollections(); err == nil {
 				h.rm.CreateLongerRecords([]*core.Collection{systemStats, containerStats})
 			}
 		})
+		// delete ephemeral systems that have been down longer than their ttl
+		h.app.Cron().MustAdd("delete expired systems", "*/10 * * * *", h.deleteExpiredSystems)
+		// back up the data directory if BACKUP_CRON is set
+		h.scheduleBackups()
+		// alert admins if the last successful backup is older than BACKUP_MAX_AGE
+		h.app.Cron().MustAdd("check backup age", "48 * * * *", h.checkBackupAge)
+		// alert on systems that stopped returning new data
+		h.app.Cron().MustAdd("check stale systems", "* * * * *", func() {
+			if err := h.am.HandleStaleAlerts(); err != nil {
+				h.logger.Error("Stale alerts error", "err", err.Error())
+			}
+		})
+		// advise of containers whose memory keeps growing
+		h.app.Cron().MustAdd("check memory leaks", "28 * * * *", func() {
+			if err := h.am.HandleMemoryLeakAlerts(); err != nil {
+				h.logger.Error("Memory leak alerts error", "err", err.Error())
+			}
+		})
+		// verify the SMTP server and webhooks used for notifications
+		h.app.Cron().MustAdd("check notification channels", "38 * * * *", func() {
+			if err := h.am.CheckNotificationChannels(); err != nil {
+				h.logger.Error("Notification channel check error", "err", err.Error())
+			}
+		})
 		return se.Next()
 	})
 
 	// custom api routes
 	h.app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		// adds database, scheduler and agent status to /api/health
+		se.Router.BindFunc(h.healthCheck)
+		// authenticates requests with scoped API tokens
+		se.Router.Bind(h.apiTokenAuth())
+		// authenticates read only impersonation sessions of admins
+		se.Router.Bind(h.impersonationAuth())
 		// returns public key
 		se.Router.GET("/api/beszel/getkey", func(e *core.RequestEvent) error {
 			info, _ := e.RequestInfo()
@@ -169,8 +380,81 @@ func (h *Hub) Run() {
 		})
 		// send test notification
 		se.Router.GET("/api/beszel/send-test-notification", h.am.SendTestNotification)
+		// preview notification template
+		se.Router.POST("/api/beszel/preview-notification", h.am.PreviewNotification)
+		// queue a failed notification again
+		se.Router.POST("/api/beszel/notifications/retry", h.am.RetryNotification)
 		// API endpoint to get config.yml content
 		se.Router.GET("/api/beszel/config-yaml", h.getYamlConfig)
+		// database size by collection and system
+		se.Router.GET("/api/beszel/storage", h.getStorageUsage)
+		// export / import alert definitions as YAML
+		se.Router.GET("/api/beszel/alerts/yaml", h.handleAlertsYAML)
+		se.Router.POST("/api/beszel/alerts/yaml", h.handleAlertsYAML)
+		// top processes of a system
+		se.Router.GET("/api/beszel/processes", h.getProcesses)
+		// ranks containers of a system by their share of host resources
+		se.Router.GET("/api/beszel/containers/noisy", h.getNoisyNeighbors)
+		// export system / container stats as csv or json
+		se.Router.GET("/api/beszel/export", h.exportStats)
+		// series in the recent stats of a system with their names and units
+		se.Router.GET("/api/beszel/metrics", h.getMetricCatalog)
+		// evaluate a metric expression over the stats of a system
+		se.Router.GET("/api/beszel/expression", h.getExpressionSeries)
+		// stream stats of systems over a websocket as they arrive
+		se.Router.GET("/api/beszel/live", h.handleLiveStream)
+		// systems and their relationships as a graph
+		se.Router.GET("/api/beszel/topology", h.getTopology)
+		// systems matching a selector query
+		se.Router.GET("/api/beszel/systems/match", h.getMatchingSystems)
+		// pause, resume, delete or tag systems matching a selector query
+		se.Router.POST("/api/beszel/systems/bulk", h.bulkUpdateSystems)
+		// API endpoint to accept a reinstalled agent with a new fingerprint
+		se.Router.POST("/api/beszel/systems/reset-fingerprint", h.resetFingerprint)
+		// API endpoint to apply an agent's new address or transport that needs approval
+		se.Router.POST("/api/beszel/systems/approve-move", h.approveMove)
+		// import systems from other monitoring tools
+		se.Router.POST("/api/beszel/import", h.importSystems)
+		// agent registration with enrollment token
+		se.Router.POST("/api/beszel/register", h.registerSystem)
+		// signs certificates for agents using the https transport
+		se.Router.POST("/api/beszel/tls/issue", h.issueAgentCertificate)
+		// get / create / end global notification silence
+		se.Router.GET("/api/beszel/silence", h.am.HandleSilence)
+		se.Router.POST("/api/beszel/silence", h.am.HandleSilence)
+		se.Router.DELETE("/api/beszel/silence", h.am.HandleSilence)
+		// notable changes across the user's systems in the last day
+		se.Router.GET("/api/beszel/changes", h.getFleetChanges)
+		// number of times each alert triggered and for how long
+		se.Router.GET("/api/beszel/alerts/history", h.am.HandleHistorySummary)
+		// update agents in staged batches
+		se.Router.GET("/api/beszel/agent-update", h.handleAgentUpdate)
+		se.Router.POST("/api/beszel/agent-update", h.handleAgentUpdate)
+		// configuration changes of a system between two times
+		se.Router.GET("/api/beszel/snapshots/diff", h.diffSystemSnapshots)
+		// status of the hub's backups (admin only)
+		se.Router.GET("/api/beszel/backups", h.handleBackupStatus)
+		// connection diagnostics
+		se.Router.GET("/api/beszel/connection", h.getConnectionDiagnostics)
+		// how a stats record was created (admin only)
+		se.Router.GET("/api/beszel/stats/explain", h.explainStats)
+		se.Router.POST("/api/beszel/test-connection", h.testConnection)
+		// list or close open connections to agents (admin only)
+		se.Router.GET("/api/beszel/agent-connections", h.handleAgentConnections)
+		se.Router.DELETE("/api/beszel/agent-connections", h.handleAgentConnections)
+		// public status pages
+		se.Router.GET("/status/{slug}", h.serveStatusPage)
+		se.Router.GET("/api/beszel/status/{slug}", h.getStatusPage)
+		se.Router.POST("/api/beszel/status-pages/rotate", h.rotateStatusPage)
+		// public status and uptime badges of systems
+		se.Router.GET("/api/beszel/badge/{token}/{file}", h.serveBadge)
+		se.Router.POST("/api/beszel/badges", h.createBadgeToken)
+		se.Router.POST("/api/beszel/badges/rotate", h.rotateBadgeTokens)
+		// create API tokens (listed and revoked through the api_tokens collection)
+		se.Router.POST("/api/beszel/tokens", h.createApiToken)
+		// view the dashboard as another user (admin only, read only)
+		se.Router.POST("/api/beszel/impersonate", h.startImpersonation)
+		se.Router.POST("/api/beszel/impersonate/end", h.endImpersonation)
 		// create first user endpoint only needed if no users exist
 		if totalUsers, _ := h.app.CountRecords("users"); totalUsers == 0 {
 			se.Router.POST("/api/beszel/create-user", h.um.CreateFirstUser)
@@ -188,6 +472,7 @@ func (h *Hub) Run() {
 	// immediately create connection for new systems
 	h.app.OnRecordAfterCreateSuccess("systems").BindFunc(func(e *core.RecordEvent) error {
 		go h.updateSystem(e.Record)
+		h.recordSystemEvent(e.Record, "added", "")
 		return e.Next()
 	})
 
@@ -195,6 +480,58 @@ func (h *Hub) Run() {
 	h.app.OnRecordCreate("users").BindFunc(h.um.InitializeUserRole)
 	h.app.OnRecordCreate("user_settings").BindFunc(h.um.InitializeUserSettings)
 
+	// set roles and systems of OAuth2 users from their groups
+	h.app.OnRecordAuthWithOAuth2Request("users").BindFunc(h.applyOAuthRoles)
+
+	// validate notification templates
+	h.app.OnRecordUpdate("user_settings").BindFunc(h.am.ValidateTemplates)
+
+	// encrypt webhook urls when saved and decrypt them for their users
+	h.app.OnRecordCreate("user_settings").BindFunc(encryptUserSettings)
+	h.app.OnRecordUpdate("user_settings").BindFunc(encryptUserSettings)
+	h.app.OnRecordEnrich("user_settings").BindFunc(func(e *core.RecordEnrichEvent) error {
+		// only the owner gets the urls, and not through an API token or impersonation session
+		if info := e.RequestInfo; info == nil || info.Auth == nil || info.Auth.Id != e.Record.GetString("user") || isLimitedAuth(info.Auth) {
+			return e.Next()
+		}
+		if _, err := secrets.DecryptUserSettings(e.Record); err != nil {
+			h.logger.Error("Failed to decrypt user settings", "err", err.Error())
+		}
+		return e.Next()
+	})
+
+	// validate the expressions of Expression alerts
+	h.app.OnRecordCreate("alerts").BindFunc(h.am.ValidateExpression)
+	h.app.OnRecordUpdate("alerts").BindFunc(h.am.ValidateExpression)
+
+	// validate the hours during which alerts can trigger
+	h.app.OnRecordCreate("alerts").BindFunc(h.am.ValidateHours)
+	h.app.OnRecordUpdate("alerts").BindFunc(h.am.ValidateHours)
+
+	// validate the time zone of systems
+	h.app.OnRecordCreate("systems").BindFunc(validateSystemTimezone)
+	h.app.OnRecordUpdate("systems").BindFunc(validateSystemTimezone)
+
+	// validate the queries of saved system filters
+	h.app.OnRecordCreate("system_filters").BindFunc(h.validateSystemFilter)
+	h.app.OnRecordUpdate("system_filters").BindFunc(h.validateSystemFilter)
+
+	// validate check targets and keep statuses set by the hub
+	h.app.OnRecordCreateRequest("checks").BindFunc(h.validateCheck)
+	h.app.OnRecordUpdateRequest("checks").BindFunc(h.validateCheck)
+
+	// seconds since the last successful sample of a system
+	h.app.OnRecordEnrich("systems").BindFunc(func(e *core.RecordEnrichEvent) error {
+		if sampled := e.Record.GetDateTime("sampled"); !sampled.IsZero() {
+			e.Record.WithCustomData(true)
+			e.Record.Set("staleness", int(time.Since(sampled.Time()).Seconds()))
+		}
+		return e.Next()
+	})
+
+	// record when systems go down, so systems with a ttl expire from then
+	h.app.OnRecordUpdate("systems").BindFunc(setDownSince)
+
 	// empty info for systems that are paused
 	h.app.OnRecordUpdate("systems").BindFunc(func(e *core.RecordEvent) error {
 		if e.Record.GetString("status") == "paused" {
@@ -209,6 +546,15 @@ func (h *Hub) Run() {
 		oldRecord := newRecord.Original()
 		newStatus := newRecord.GetString("status")
 
+		if oldStatus := oldRecord.GetString("status"); h.statusHooks != nil && newStatus != oldStatus {
+			h.statusHooks.Send(statushooks.System{
+				Id:   newRecord.Id,
+				Name: newRecord.GetString("name"),
+				Host: newRecord.GetString("host"),
+				Port: newRecord.GetString("port"),
+			}, newStatus, oldStatus)
+		}
+
 		// if system is disconnected and connection exists, remove it
 		if newStatus == "down" || newStatus == "paused" {
 			h.deleteSystemConnection(newRecord)
@@ -223,20 +569,47 @@ func (h *Hub) Run() {
 		return e.Next()
 	})
 
+	// save buffered stats before the hub exits
+	h.app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+		h.stats.flush()
+		return e.Next()
+	})
+
+	// save the result of each backup
+	h.app.OnBackupCreate().BindFunc(h.recordBackup)
+
 	// if system is deleted, close connection
 	h.app.OnRecordAfterDeleteSuccess("systems").BindFunc(func(e *core.RecordEvent) error {
 		h.deleteSystemConnection(e.Record)
+		h.lastSnapshots.Delete(e.Record.Id)
+		h.rawSamples.Delete(e.Record.Id)
+		h.recordSystemEvent(e.Record, "removed", "")
 		return e.Next()
 	})
 
+	// serve the dashboard over HTTPS if TLS_CERT or TLS_DOMAIN is set
+	if args := httpsServeArgs(os.Args[1:]); len(args) != len(os.Args)-1 {
+		h.app.RootCmd.SetArgs(args)
+	}
+	h.app.OnServe().BindFunc(h.useCertificateFiles)
+
 	if err := h.app.Start(); err != nil {
-		log.Fatal(err)
+		h.logger.Error(err.Error())
+		os.Exit(1)
 	}
 }
 
+// Seconds between stats requests to each system. Sent to agents so rates like
+// network usage are calculated over it, even if other hubs poll the same agent.
+const systemUpdateInterval = "60"
+
 func (h *Hub) startSystemUpdateTicker() {
+	h.lastSystemUpdate.Store(time.Now().Unix())
 	c := time.Tick(15 * time.Second)
 	for range c {
+		h.lastSystemUpdate.Store(time.Now().Unix())
+		// save the stats of the last tick's updates in batches
+		go h.stats.flush()
 		h.updateSystems()
 	}
 }
@@ -251,7 +624,7 @@ func (h *Hub) updateSystems() {
 	)
 	// log.Println("records", len(records))
 	if err != nil || len(records) == 0 {
-		// h.app.Logger().Error("Failed to query systems")
+		// h.logger.Error("Failed to query systems")
 		return
 	}
 	fiftySecondsAgo := time.Now().UTC().Add(-50 * time.Second)
@@ -272,73 +645,158 @@ func (h *Hub) updateSystems() {
 }
 
 func (h *Hub) updateSystem(record *core.Record) {
+	if record.GetString("transport") == "https" {
+		h.updateSystemHTTPS(record)
+		return
+	}
 	var client *ssh.Client
+	var diag *connectionDiagnostics
 	var err error
+	start := time.Now()
 
 	// check if system connection exists
 	if existingClient, ok := h.systemConnections.Load(record.Id); ok {
 		client = existingClient.(*ssh.Client)
 	} else {
 		// create system connection
-		client, err = h.createSystemConnection(record)
+		client, diag, err = h.createSystemConnection(record)
 		if err != nil {
 			if record.GetString("status") != "down" {
-				h.app.Logger().Error("Failed to connect:", "err", err.Error(), "system", record.GetString("host"), "port", record.GetString("port"))
+				h.logger.Error("Failed to connect:", "err", err.Error(), "system", record.GetString("host"), "port", record.GetString("port"))
 				h.updateSystemStatus(record, "down")
 			}
 			return
 		}
 		h.systemConnections.Store(record.Id, client)
 	}
-	// get system stats from agent
+	// get system stats from agent, keeping the payload to explain the stats record
 	var systemData system.CombinedData
-	if err := h.requestJsonFromAgent(client, &systemData); err != nil {
+	var payload json.RawMessage
+	err = h.requestJsonFromAgent(client, "stats "+systemUpdateInterval, &payload)
+	if err == nil {
+		err = json.Unmarshal(payload, &systemData)
+	}
+	h.recordRequestResult(record, diag, start, err, systemData.Info.AgentVersion)
+	if err != nil {
 		if err.Error() == "bad client" {
 			// if previous connection was closed, try again
-			h.app.Logger().Error("Existing SSH connection closed. Retrying...", "host", record.GetString("host"), "port", record.GetString("port"))
+			h.logger.Error("Existing SSH connection closed. Retrying...", "host", record.GetString("host"), "port", record.GetString("port"))
 			h.deleteSystemConnection(record)
 			time.Sleep(time.Millisecond * 100)
 			h.updateSystem(record)
 			return
 		}
-		h.app.Logger().Error("Failed to get system stats: ", "err", err.Error())
+		h.logger.Error("Failed to get system stats: ", "err", err.Error())
 		h.updateSystemStatus(record, "down")
 		return
 	}
+	h.saveSystemData(record, &systemData, payload)
+}
+
+// Saves stats received from an agent and handles alerts. The agent's payload
+// is kept in memory for a while to explain the stats record.
+func (h *Hub) saveSystemData(record *core.Record, systemData *system.CombinedData, payload json.RawMessage) {
+	// reject stats from an agent impersonating the system's agent
+	if !h.checkAgentFingerprint(record, systemData.Fingerprint) {
+		return
+	}
+	// record agent upgrades
+	var oldInfo system.Info
+	record.UnmarshalJSONField("info", &oldInfo)
+	if oldInfo.AgentVersion != "" && oldInfo.AgentVersion != systemData.Info.AgentVersion {
+		h.recordSystemEvent(record, "upgraded", oldInfo.AgentVersion+" → "+systemData.Info.AgentVersion)
+	}
+	// latency from the hub, added to the stats of the agent
+	if h.latency != nil {
+		latency, loss := h.latency.measure(record.GetString("host"), record.GetString("port"))
+		systemData.Stats.Latency, systemData.Stats.PacketLoss = latency, &loss
+		systemData.Info.PacketLoss = &loss
+		if latency > 0 {
+			systemData.Info.Latency = &latency
+		}
+	}
 	// update system record
 	record.Set("status", "up")
 	record.Set("info", systemData.Info)
+	record.Set("sampled", time.Now().UTC())
 	if err := h.app.SaveNoValidate(record); err != nil {
-		h.app.Logger().Error("Failed to update record: ", "err", err.Error())
+		h.logger.Error("Failed to update record: ", "err", err.Error())
 	}
+	// save configuration snapshot if it changed
+	h.saveSystemSnapshot(record, systemData)
 	// add system_stats and container_stats records
 	if systemStats, containerStats, err := h.getCollections(); err != nil {
-		h.app.Logger().Error("Failed to get collections: ", "err", err.Error())
+		h.logger.Error("Failed to get collections: ", "err", err.Error())
 	} else {
 		// add new system_stats record
 		systemStatsRecord := core.NewRecord(systemStats)
+		systemStatsRecord.Id = core.GenerateDefaultRandomId()
 		systemStatsRecord.Set("system", record.Id)
 		systemStatsRecord.Set("stats", systemData.Stats)
 		systemStatsRecord.Set("type", "1m")
-		if err := h.app.SaveNoValidate(systemStatsRecord); err != nil {
-			h.app.Logger().Error("Failed to save record: ", "err", err.Error())
-		}
+		h.stats.add(systemStatsRecord)
+		h.storeRawSample(record.Id, systemStatsRecord.Id, payload)
+		h.publishLiveStats(record.Id, &systemData.Stats)
 		// add new container_stats record
 		if len(systemData.Containers) > 0 {
 			containerStatsRecord := core.NewRecord(containerStats)
 			containerStatsRecord.Set("system", record.Id)
 			containerStatsRecord.Set("stats", systemData.Containers)
 			containerStatsRecord.Set("type", "1m")
-			if err := h.app.SaveNoValidate(containerStatsRecord); err != nil {
-				h.app.Logger().Error("Failed to save record: ", "err", err.Error())
-			}
+			h.stats.add(containerStatsRecord)
 		}
 	}
+	// mirror stats to remote write endpoint
+	if h.rw != nil {
+		h.rw.WriteSystem(record.GetString("name"), &systemData.Stats, systemData.Containers, time.Now())
+	}
+	// publish stats to mqtt broker
+	if h.mqtt != nil {
+		h.mqtt.PublishSystem(record.Id, record.GetString("name"), &systemData.Stats)
+	}
 
 	// system info alerts
-	if err := h.am.HandleSystemAlerts(record, systemData.Info, systemData.Stats.Temperatures, systemData.Stats.ExtraFs); err != nil {
-		h.app.Logger().Error("System alerts error", "err", err.Error())
+	if err := h.am.HandleSystemAlerts(record, systemData.Info, &systemData.Stats); err != nil {
+		h.logger.Error("System alerts error", "err", err.Error())
 	}
+
+	// docker compose project alerts
+	if err := h.am.HandleProjectAlerts(record, systemData.Containers, systemData.Stats.Mem); err != nil {
+		h.logger.Error("Project alerts error", "err", err.Error())
+	}
+
+	// update S.M.A.R.T. devices
+	h.updateSmartDevices(record, systemData.Smart)
+
+	// update systemd services
+	h.updateSystemdServices(record, systemData.Services)
+
+	// update listening ports
+	h.updateListeningPorts(record, systemData.Ports)
+
+	// update container health checks
+	h.updateHealthChecks(record, systemData.HealthChecks)
+
+	// update virtual machines of hypervisor hosts
+	h.updateGuests(record, systemData.Guests)
+}
+
+// Encrypts the webhook urls of user settings before they're saved
+func encryptUserSettings(e *core.RecordEvent) error {
+	if _, err := secrets.EncryptUserSettings(e.Record); err != nil {
+		return err
+	}
+	return e.Next()
+}
+
+// Rejects systems with an unknown time zone
+func validateSystemTimezone(e *core.RecordEvent) error {
+	if timezone := e.Record.GetString("timezone"); timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return apis.NewBadRequestError("Invalid time zone", nil)
+		}
+	}
+	return e.Next()
 }
 
 // return system_stats and container_stats collections
@@ -365,7 +823,7 @@ func (h *Hub) updateSystemStatus(record *core.Record, status string) {
 	if record.Fresh().GetString("status") != status {
 		record.Set("status", status)
 		if err := h.app.SaveNoValidate(record); err != nil {
-			h.app.Logger().Error("Failed to update record: ", "err", err.Error())
+			h.logger.Error("Failed to update record: ", "err", err.Error())
 		}
 	}
 }
@@ -380,18 +838,19 @@ func (h *Hub) deleteSystemConnection(record *core.Record) {
 	}
 }
 
-func (h *Hub) createSystemConnection(record *core.Record) (*ssh.Client, error) {
-	client, err := ssh.Dial("tcp", net.JoinHostPort(record.GetString("host"), record.GetString("port")), h.sshClientConfig)
+func (h *Hub) createSystemConnection(record *core.Record) (*ssh.Client, *connectionDiagnostics, error) {
+	client, diag, err := h.dialAgent(record)
 	if err != nil {
-		return nil, err
+		h.connectionDiagnostics.Store(record.Id, diag)
+		return nil, diag, err
 	}
-	return client, nil
+	return client, diag, nil
 }
 
 func (h *Hub) createSSHClientConfig() error {
 	key, err := h.getSSHKey()
 	if err != nil {
-		h.app.Logger().Error("Failed to get SSH key: ", "err", err.Error())
+		h.logger.Error("Failed to get SSH key: ", "err", err.Error())
 		return err
 	}
 
@@ -412,8 +871,9 @@ func (h *Hub) createSSHClientConfig() error {
 	return nil
 }
 
-// Fetches system stats from the agent and decodes the json data into the provided struct
-func (h *Hub) requestJsonFromAgent(client *ssh.Client, systemData *system.CombinedData) error {
+// Runs a command on the agent and decodes the json data into the provided struct.
+// An empty command requests system stats.
+func (h *Hub) requestJsonFromAgent(client *ssh.Client, command string, data any) error {
 	session, err := newSessionWithTimeout(client, 4*time.Second)
 	if err != nil {
 		return fmt.Errorf("bad client")
@@ -425,11 +885,16 @@ func (h *Hub) requestJsonFromAgent(client *ssh.Client, systemData *system.Combin
 		return err
 	}
 
-	if err := session.Shell(); err != nil {
+	if command == "" {
+		err = session.Shell()
+	} else {
+		err = session.Start(command)
+	}
+	if err != nil {
 		return err
 	}
 
-	if err := json.NewDecoder(stdout).Decode(systemData); err != nil {
+	if err := json.NewDecoder(stdout).Decode(data); err != nil {
 		return err
 	}
 
@@ -482,27 +947,27 @@ func (h *Hub) getSSHKey() ([]byte, error) {
 	// Generate the Ed25519 key pair
 	pubKey, privKey, err := ed25519.GenerateKey(nil)
 	if err != nil {
-		// h.app.Logger().Error("Error generating key pair:", "err", err.Error())
+		// h.logger.Error("Error generating key pair:", "err", err.Error())
 		return nil, err
 	}
 
 	// Get the private key in OpenSSH format
 	privKeyBytes, err := ssh.MarshalPrivateKey(privKey, "")
 	if err != nil {
-		// h.app.Logger().Error("Error marshaling private key:", "err", err.Error())
+		// h.logger.Error("Error marshaling private key:", "err", err.Error())
 		return nil, err
 	}
 
 	// Save the private key to a file
 	privateFile, err := os.Create(dataDir + "/id_ed25519")
 	if err != nil {
-		// h.app.Logger().Error("Error creating private key file:", "err", err.Error())
+		// h.logger.Error("Error creating private key file:", "err", err.Error())
 		return nil, err
 	}
 	defer privateFile.Close()
 
 	if err := pem.Encode(privateFile, privKeyBytes); err != nil {
-		// h.app.Logger().Error("Error writing private key to file:", "err", err.Error())
+		// h.logger.Error("Error writing private key to file:", "err", err.Error())
 		return nil, err
 	}
 
@@ -526,9 +991,9 @@ func (h *Hub) getSSHKey() ([]byte, error) {
 		return nil, err
 	}
 
-	h.app.Logger().Info("ed25519 SSH key pair generated successfully.")
-	h.app.Logger().Info("Private key saved to: " + dataDir + "/id_ed25519")
-	h.app.Logger().Info("Public key saved to: " + dataDir + "/id_ed25519.pub")
+	h.logger.Info("ed25519 SSH key pair generated successfully.")
+	h.logger.Info("Private key saved to: " + dataDir + "/id_ed25519")
+	h.logger.Info("Public key saved to: " + dataDir + "/id_ed25519.pub")
 
 	existingKey, err = os.ReadFile(dataDir + "/id_ed25519")
 	if err == nil {
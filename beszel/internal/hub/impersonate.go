@@ -0,0 +1,193 @@
+package hub
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// Claim of impersonation tokens with the id of their session. The tokens are
+	// auth tokens of the user, so the web app handles them like its own.
+	impersonationClaim = "beszelImpersonation"
+	// Default and max length of an impersonation session in minutes
+	defaultImpersonationMinutes = 30
+	maxImpersonationMinutes     = 240
+	// Request store key of the impersonation record of a request
+	impersonationKey = "beszelImpersonation"
+)
+
+// Paths that impersonation sessions can't request with any method, by prefix:
+// the user's API tokens, settings with notification credentials, and GET
+// endpoints with side effects
+var impersonationBlockedPaths = []string{
+	"/api/beszel/tokens",
+	"/api/collections/api_tokens/",
+	"/api/collections/user_settings/",
+	"/api/beszel/send-test-notification",
+}
+
+// Requests other than GET that read only impersonation sessions can make
+var impersonationWritePaths = []string{
+	"/api/realtime", // subscriptions
+	"/api/beszel/impersonate/end",
+}
+
+// API endpoint that lets an admin view the dashboard as another user to debug
+// access issues, without the user's password:
+//
+//	POST /api/beszel/impersonate
+//	{"email": "user@example.com", "reason": "can't see system X", "minutes": 30}
+//
+// Returns a token that acts as the user but can only read. Each session is
+// saved in the impersonations collection as an audit log.
+func (h *Hub) startImpersonation(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.Collection().Name != "users" || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	var req struct {
+		Email   string `json:"email"`
+		Reason  string `json:"reason"`
+		Minutes int    `json:"minutes"`
+	}
+	if err := e.BindBody(&req); err != nil {
+		return apis.NewBadRequestError("Invalid request", err)
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return apis.NewBadRequestError("A reason is required", nil)
+	}
+	if req.Minutes <= 0 {
+		req.Minutes = defaultImpersonationMinutes
+	}
+	user, err := h.app.FindAuthRecordByEmail("users", strings.TrimSpace(req.Email))
+	if err != nil {
+		return apis.NewNotFoundError("User not found", nil)
+	}
+	if user.Id == info.Auth.Id {
+		return apis.NewBadRequestError("You can't impersonate yourself", nil)
+	}
+	collection, err := h.app.FindCollectionByNameOrId("impersonations")
+	if err != nil {
+		return err
+	}
+	duration := time.Duration(min(req.Minutes, maxImpersonationMinutes)) * time.Minute
+	expires, _ := types.ParseDateTime(time.Now().UTC().Add(duration))
+	record := core.NewRecord(collection)
+	record.Set("admin", info.Auth.Id)
+	record.Set("user", user.Id)
+	record.Set("reason", req.Reason)
+	record.Set("expires", expires)
+	if err := h.app.Save(record); err != nil {
+		return err
+	}
+	token, err := security.NewJWT(jwt.MapClaims{
+		core.TokenClaimType:         core.TokenTypeAuth,
+		core.TokenClaimId:           user.Id,
+		core.TokenClaimCollectionId: user.Collection().Id,
+		core.TokenClaimRefreshable:  false,
+		impersonationClaim:          record.Id,
+	}, user.TokenKey()+user.Collection().AuthToken.Secret, duration)
+	if err != nil {
+		return err
+	}
+	// the web app shows the email of the user as for its own sessions
+	user.IgnoreEmailVisibility(true)
+	h.logger.Info("Impersonation started", "admin", info.Auth.Email(), "user", user.Email(), "reason", req.Reason, "expires", expires.String())
+	return e.JSON(http.StatusOK, map[string]any{"token": token, "record": user, "expires": expires})
+}
+
+// API endpoint that ends the impersonation session of the request's token
+func (h *Hub) endImpersonation(e *core.RequestEvent) error {
+	record, ok := e.Get(impersonationKey).(*core.Record)
+	if !ok {
+		return apis.NewBadRequestError("Not an impersonation session", nil)
+	}
+	record.Set("ended", time.Now().UTC())
+	if err := h.app.SaveNoValidate(record); err != nil {
+		return err
+	}
+	h.logger.Info("Impersonation ended", "session", record.Id)
+	return e.NoContent(http.StatusNoContent)
+}
+
+// Returns the middleware that authenticates requests with an impersonation
+// token. Requests act as the impersonated user and can only read. Auth refresh
+// requests get the same token back, so it can't be exchanged for a session.
+func (h *Hub) impersonationAuth() *hook.Handler[*core.RequestEvent] {
+	return &hook.Handler[*core.RequestEvent]{
+		Id:       "beszelImpersonationAuth",
+		Priority: apis.DefaultLoadAuthTokenMiddlewarePriority - 1,
+		Func: func(e *core.RequestEvent) error {
+			token := strings.TrimPrefix(e.Request.Header.Get("Authorization"), "Bearer ")
+			claims, err := security.ParseUnverifiedJWT(token)
+			if err != nil {
+				return e.Next()
+			}
+			sessionId, _ := claims[impersonationClaim].(string)
+			if sessionId == "" {
+				return e.Next()
+			}
+			user, err := e.App.FindAuthRecordByToken(token, core.TokenTypeAuth)
+			if err != nil {
+				return apis.NewUnauthorizedError("Invalid impersonation token", nil)
+			}
+			record, err := e.App.FindRecordById("impersonations", sessionId)
+			if err != nil || record.GetString("user") != user.Id {
+				return apis.NewUnauthorizedError("Invalid impersonation token", nil)
+			}
+			now := time.Now().UTC()
+			if !record.GetDateTime("ended").IsZero() || record.GetDateTime("expires").Time().Before(now) {
+				return apis.NewUnauthorizedError("Impersonation session ended", nil)
+			}
+			// admins who lost the role can't keep using their sessions
+			admin, err := e.App.FindFirstRecordByFilter("users", "id = {:id} && role = 'admin'", dbx.Params{"id": record.GetString("admin")})
+			if err != nil {
+				return apis.NewUnauthorizedError("Invalid impersonation token", nil)
+			}
+			path := e.Request.URL.Path
+			if e.Request.Method == http.MethodPost && path == "/api/collections/users/auth-refresh" {
+				user.IgnoreEmailVisibility(true)
+				return e.JSON(http.StatusOK, map[string]any{"token": token, "record": user})
+			}
+			if !impersonationAllows(e.Request.Method, path) {
+				return apis.NewForbiddenError("Impersonation sessions are read only", nil)
+			}
+			if lastUsed := record.GetDateTime("last_used"); lastUsed.Time().Before(now.Add(-apiTokenUsedInterval)) {
+				record.Set("last_used", now)
+				if err := e.App.SaveNoValidate(record); err != nil {
+					h.logger.Error("Failed to update impersonation", "err", err.Error())
+				}
+			}
+			h.logger.Debug("Impersonated request", "admin", admin.Email(), "user", user.Email(), "method", e.Request.Method, "path", path)
+			e.Set(impersonationKey, record)
+			user.SetRaw(limitedAuthKey, true)
+			e.Auth = user
+			return e.Next()
+		},
+	}
+}
+
+// Returns true if an impersonation session can make a request with the method
+// and path. Other than blocked paths, any GET request can be made.
+func impersonationAllows(method, path string) bool {
+	for _, prefix := range impersonationBlockedPaths {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return true
+	}
+	return slices.Contains(impersonationWritePaths, path)
+}
@@ -0,0 +1,40 @@
+package hub
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestImpersonationAllows(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   bool
+	}{
+		{name: "read systems", method: http.MethodGet, path: "/api/collections/systems/records", want: true},
+		{name: "read stats", method: http.MethodGet, path: "/api/collections/system_stats/records", want: true},
+		{name: "head request", method: http.MethodHead, path: "/api/health", want: true},
+		{name: "realtime subscription", method: http.MethodPost, path: "/api/realtime", want: true},
+		{name: "end the session", method: http.MethodPost, path: "/api/beszel/impersonate/end", want: true},
+		{name: "read user settings", method: http.MethodGet, path: "/api/collections/user_settings/records"},
+		{name: "read one user setting", method: http.MethodGet, path: "/api/collections/user_settings/records/abc"},
+		{name: "list tokens", method: http.MethodGet, path: "/api/beszel/tokens"},
+		{name: "read token records", method: http.MethodGet, path: "/api/collections/api_tokens/records"},
+		{name: "test notification", method: http.MethodGet, path: "/api/beszel/send-test-notification"},
+		{name: "create a system", method: http.MethodPost, path: "/api/collections/systems/records"},
+		{name: "update a system", method: http.MethodPatch, path: "/api/collections/systems/records/abc"},
+		{name: "delete an alert", method: http.MethodDelete, path: "/api/collections/alerts/records/abc"},
+		{name: "update a user", method: http.MethodPatch, path: "/api/collections/users/records/abc"},
+		{name: "start another session", method: http.MethodPost, path: "/api/beszel/impersonate"},
+		{name: "create a token", method: http.MethodPost, path: "/api/beszel/tokens"},
+		{name: "path below an allowed write path", method: http.MethodPost, path: "/api/realtime/other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := impersonationAllows(tt.method, tt.path); got != tt.want {
+				t.Fatalf("impersonationAllows(%s, %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
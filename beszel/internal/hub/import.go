@@ -0,0 +1,299 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// System parsed from another monitoring tool's export
+type importedSystem struct {
+	Name   string
+	Host   string
+	Port   string
+	Tags   []string
+	Users  []string           // user emails (only used by the import command)
+	Alerts map[string]float64 // alert name -> threshold (0 = default)
+}
+
+type importResult struct {
+	Created int      `json:"created"`
+	Skipped int      `json:"skipped"`
+	Alerts  int      `json:"alerts"`
+	Errors  []string `json:"errors"`
+}
+
+// Importers for supported sources
+var importers = map[string]func(io.Reader) ([]importedSystem, error){
+	"uptimekuma": parseUptimeKuma,
+	"netdata":    parseNetdata,
+	"csv":        parseImportCSV,
+}
+
+// API endpoint that creates systems and alerts from an exported file of another monitoring tool.
+// Expects a multipart form with "source" (uptimekuma | netdata | csv) and "file".
+func (h *Hub) importSystems(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") == "readonly" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	parse, ok := importers[e.Request.FormValue("source")]
+	if !ok {
+		return apis.NewBadRequestError("Invalid source", nil)
+	}
+	file, _, err := e.Request.FormFile("file")
+	if err != nil {
+		return apis.NewBadRequestError("Missing file", err)
+	}
+	defer file.Close()
+	systems, err := parse(file)
+	if err != nil {
+		return apis.NewBadRequestError("Failed to parse file: "+err.Error(), nil)
+	}
+	result, err := h.createImportedSystems(info.Auth.Id, systems)
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, result)
+}
+
+// Creates systems and their alerts for a user, skipping systems that already exist
+func (h *Hub) createImportedSystems(userID string, systems []importedSystem) (importResult, error) {
+	result := importResult{Errors: []string{}}
+	systemsCollection, err := h.app.FindCollectionByNameOrId("systems")
+	if err != nil {
+		return result, err
+	}
+	alertsCollection, err := h.app.FindCollectionByNameOrId("alerts")
+	if err != nil {
+		return result, err
+	}
+	existingSystems, err := h.app.FindAllRecords("systems")
+	if err != nil {
+		return result, err
+	}
+	existing := make(map[string]bool, len(existingSystems))
+	for _, record := range existingSystems {
+		existing[record.GetString("host")+":"+record.GetString("port")] = true
+	}
+
+	for _, sys := range systems {
+		if sys.Port == "" {
+			sys.Port = "45876"
+		}
+		key := sys.Host + ":" + sys.Port
+		if sys.Host == "" || existing[key] {
+			result.Skipped++
+			continue
+		}
+		existing[key] = true
+		record := core.NewRecord(systemsCollection)
+		record.Set("name", sys.Name)
+		record.Set("host", sys.Host)
+		record.Set("port", sys.Port)
+		record.Set("users", []string{userID})
+		record.Set("tags", sys.Tags)
+		record.Set("info", system.Info{})
+		record.Set("status", "pending")
+		if err := h.app.Save(record); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", sys.Name, err))
+			continue
+		}
+		result.Created++
+		for name, value := range sys.Alerts {
+			// use the same defaults as the web ui
+			var min float64
+			if !slices.Contains(stateAlerts, name) {
+				min = 10
+				if value == 0 {
+					value = cmp.Or(alertDefaultValues[name], 80)
+				}
+			}
+			alert := core.NewRecord(alertsCollection)
+			alert.Set("user", userID)
+			alert.Set("system", record.Id)
+			alert.Set("name", name)
+			alert.Set("value", value)
+			alert.Set("min", min)
+			if err := h.app.Save(alert); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s %s alert: %v", sys.Name, name, err))
+				continue
+			}
+			result.Alerts++
+		}
+	}
+	return result, nil
+}
+
+// Parses an Uptime Kuma backup file. Each monitor with a hostname or url becomes a system
+// with a status alert.
+func parseUptimeKuma(r io.Reader) ([]importedSystem, error) {
+	var backup struct {
+		MonitorList []struct {
+			Name     string `json:"name"`
+			URL      string `json:"url"`
+			Hostname string `json:"hostname"`
+			Tags     []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"tags"`
+		} `json:"monitorList"`
+	}
+	if err := json.NewDecoder(r).Decode(&backup); err != nil {
+		return nil, err
+	}
+	systems := make([]importedSystem, 0, len(backup.MonitorList))
+	for _, monitor := range backup.MonitorList {
+		host := monitor.Hostname
+		if host == "" {
+			if parsed, err := url.Parse(monitor.URL); err == nil {
+				host = parsed.Hostname()
+			}
+		}
+		if host == "" {
+			continue
+		}
+		sys := importedSystem{
+			Name:   monitor.Name,
+			Host:   host,
+			Tags:   []string{},
+			Alerts: map[string]float64{"Status": 0},
+		}
+		for _, tag := range monitor.Tags {
+			if tag.Value != "" {
+				sys.Tags = append(sys.Tags, tag.Name+":"+tag.Value)
+			} else {
+				sys.Tags = append(sys.Tags, tag.Name)
+			}
+		}
+		systems = append(systems, sys)
+	}
+	return systems, nil
+}
+
+// Parses a Netdata Cloud nodes export (JSON array of nodes, or an object with a "nodes" array).
+// Each node gets status, CPU, memory and disk alerts similar to Netdata's default alarms.
+func parseNetdata(r io.Reader) ([]importedSystem, error) {
+	type netdataNode struct {
+		Name     string            `json:"name"`
+		Hostname string            `json:"hostname"`
+		Labels   map[string]string `json:"labels"`
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []netdataNode
+	if err := json.Unmarshal(data, &nodes); err != nil {
+		var wrapped struct {
+			Nodes []netdataNode `json:"nodes"`
+		}
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return nil, err
+		}
+		nodes = wrapped.Nodes
+	}
+	systems := make([]importedSystem, 0, len(nodes))
+	for _, node := range nodes {
+		host := node.Hostname
+		if host == "" {
+			host = node.Name
+		}
+		sys := importedSystem{
+			Name:   node.Name,
+			Host:   host,
+			Tags:   []string{},
+			Alerts: map[string]float64{"Status": 0, "CPU": 85, "Memory": 90, "Disk": 90},
+		}
+		for key, value := range node.Labels {
+			// skip netdata's internal labels
+			if strings.HasPrefix(key, "_") {
+				continue
+			}
+			sys.Tags = append(sys.Tags, key+":"+value)
+		}
+		slices.Sort(sys.Tags)
+		systems = append(systems, sys)
+	}
+	return systems, nil
+}
+
+// Parses a CSV file with a header row. Columns: name, host, port (optional),
+// tags (optional, separated by ";"), users (optional emails, separated by ";") and
+// alerts (optional, separated by ";" with an optional threshold, e.g. "Status;CPU:90;Disk").
+func parseImportCSV(r io.Reader) ([]importedSystem, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["host"]; !ok {
+		return nil, errors.New("missing host column")
+	}
+	get := func(row []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	split := func(value string) []string {
+		values := []string{}
+		for _, v := range strings.Split(value, ";") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+
+	var systems []importedSystem
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		sys := importedSystem{
+			Name:   get(row, "name"),
+			Host:   get(row, "host"),
+			Port:   get(row, "port"),
+			Tags:   split(get(row, "tags")),
+			Users:  split(get(row, "users")),
+			Alerts: map[string]float64{},
+		}
+		// allow host:port in the host column
+		if host, port, err := net.SplitHostPort(sys.Host); err == nil && sys.Port == "" {
+			sys.Host, sys.Port = host, port
+		}
+		if sys.Name == "" {
+			sys.Name = sys.Host
+		}
+		for _, alert := range split(get(row, "alerts")) {
+			name, threshold, _ := strings.Cut(alert, ":")
+			value, _ := strconv.ParseFloat(threshold, 64)
+			sys.Alerts[name] = value
+		}
+		systems = append(systems, sys)
+	}
+	return systems, nil
+}
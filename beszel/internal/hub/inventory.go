@@ -0,0 +1,253 @@
+package hub
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Returns the import command, which creates or updates systems from a CSV file or Ansible inventory
+func (h *Hub) newImportCommand() *cobra.Command {
+	var format, users, port string
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Create or update systems from a CSV file or Ansible inventory",
+		Long: `Create or update systems from a CSV file or Ansible inventory.
+
+CSV files need a header row with a host column. Optional columns are name, port,
+users (emails separated by ";") and tags (separated by ";").
+
+Ansible inventories can be INI or YAML. The inventory hostname is used as the
+system name, ansible_host as the host and beszel_port as the agent port.
+Group names are added as tags.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// make sure collections exist if the hub hasn't been started yet
+			if err := h.app.RunAllMigrations(); err != nil {
+				return err
+			}
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			if format == "" {
+				format = "ansible"
+				if strings.EqualFold(filepath.Ext(args[0]), ".csv") {
+					format = "csv"
+				}
+			}
+			var systems []importedSystem
+			switch format {
+			case "csv":
+				systems, err = parseImportCSV(file)
+			case "ansible":
+				if ext := strings.ToLower(filepath.Ext(args[0])); ext == ".yml" || ext == ".yaml" {
+					systems, err = parseAnsibleYAML(file)
+				} else {
+					systems, err = parseAnsibleINI(file)
+				}
+			default:
+				return fmt.Errorf("invalid format %q", format)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %w", args[0], err)
+			}
+			for i := range systems {
+				if systems[i].Port == "" {
+					systems[i].Port = port
+				}
+				if len(systems[i].Users) == 0 && users != "" {
+					systems[i].Users = strings.Split(users, ",")
+				}
+			}
+			created, updated, err := h.upsertSystems(systems)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Created %d and updated %d systems\n", created, updated)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "", "file format: csv or ansible (default based on file extension)")
+	cmd.Flags().StringVar(&users, "users", "", "comma separated user emails for systems without users (default first user)")
+	cmd.Flags().StringVar(&port, "port", "45876", "agent port for systems without a port")
+	return cmd
+}
+
+// Creates systems or updates the name, users and tags of existing systems with the same host and port
+func (h *Hub) upsertSystems(systems []importedSystem) (created, updated int, err error) {
+	collection, err := h.app.FindCollectionByNameOrId("systems")
+	if err != nil {
+		return 0, 0, err
+	}
+	allUsers, err := h.app.FindAllRecords("users")
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(allUsers) == 0 {
+		return 0, 0, fmt.Errorf("no users found - create a user before importing systems")
+	}
+	userEmailToID := make(map[string]string, len(allUsers))
+	for _, user := range allUsers {
+		userEmailToID[user.GetString("email")] = user.Id
+	}
+	existingSystems, err := h.app.FindAllRecords("systems")
+	if err != nil {
+		return 0, 0, err
+	}
+	existingSystemsMap := make(map[string]*core.Record, len(existingSystems))
+	for _, system := range existingSystems {
+		existingSystemsMap[system.GetString("host")+":"+system.GetString("port")] = system
+	}
+
+	for _, sys := range systems {
+		if sys.Host == "" {
+			continue
+		}
+		userIDs := make([]string, 0, len(sys.Users))
+		for _, email := range sys.Users {
+			if id, ok := userEmailToID[strings.TrimSpace(email)]; ok {
+				userIDs = append(userIDs, id)
+			} else {
+				fmt.Printf("User %s not found\n", email)
+			}
+		}
+		if len(userIDs) == 0 {
+			userIDs = []string{allUsers[0].Id}
+		}
+		key := sys.Host + ":" + sys.Port
+		record, exists := existingSystemsMap[key]
+		if !exists {
+			record = core.NewRecord(collection)
+			record.Set("host", sys.Host)
+			record.Set("port", sys.Port)
+			record.Set("status", "pending")
+			existingSystemsMap[key] = record
+		}
+		record.Set("name", sys.Name)
+		record.Set("users", userIDs)
+		record.Set("tags", sys.Tags)
+		if err := h.app.Save(record); err != nil {
+			return created, updated, fmt.Errorf("failed to save %s: %w", sys.Name, err)
+		}
+		if exists {
+			updated++
+		} else {
+			created++
+		}
+	}
+	return created, updated, nil
+}
+
+// Parses an INI Ansible inventory
+func parseAnsibleINI(r io.Reader) ([]importedSystem, error) {
+	inventory := newAnsibleInventory()
+	group := "ungrouped"
+	skip := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			group = strings.Trim(line, "[]")
+			// group vars and children sections don't list hosts
+			skip = strings.Contains(group, ":")
+			continue
+		}
+		if skip {
+			continue
+		}
+		fields := strings.Fields(line)
+		vars := make(map[string]string, len(fields)-1)
+		for _, field := range fields[1:] {
+			if key, value, ok := strings.Cut(field, "="); ok {
+				vars[key] = strings.Trim(value, `"'`)
+			}
+		}
+		inventory.add(fields[0], group, vars)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return inventory.systems, nil
+}
+
+// Parses a YAML Ansible inventory
+func parseAnsibleYAML(r io.Reader) ([]importedSystem, error) {
+	type yamlGroup struct {
+		Hosts    map[string]map[string]any `yaml:"hosts"`
+		Children map[string]yaml.Node      `yaml:"children"`
+	}
+	var root map[string]yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, err
+	}
+	inventory := newAnsibleInventory()
+	var walk func(name string, node yaml.Node) error
+	walk = func(name string, node yaml.Node) error {
+		var group yamlGroup
+		if err := node.Decode(&group); err != nil {
+			return err
+		}
+		for host, vars := range group.Hosts {
+			stringVars := make(map[string]string, len(vars))
+			for key, value := range vars {
+				stringVars[key] = fmt.Sprint(value)
+			}
+			inventory.add(host, name, stringVars)
+		}
+		for child, childNode := range group.Children {
+			if err := walk(child, childNode); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for name, node := range root {
+		if err := walk(name, node); err != nil {
+			return nil, err
+		}
+	}
+	return inventory.systems, nil
+}
+
+// Collects hosts from an Ansible inventory, merging hosts listed in multiple groups
+type ansibleInventory struct {
+	systems []importedSystem
+	index   map[string]int
+}
+
+func newAnsibleInventory() *ansibleInventory {
+	return &ansibleInventory{index: make(map[string]int)}
+}
+
+func (inv *ansibleInventory) add(name, group string, vars map[string]string) {
+	i, ok := inv.index[name]
+	if !ok {
+		i = len(inv.systems)
+		inv.index[name] = i
+		inv.systems = append(inv.systems, importedSystem{Name: name, Host: name, Tags: []string{}})
+	}
+	sys := &inv.systems[i]
+	if host := vars["ansible_host"]; host != "" {
+		sys.Host = host
+	}
+	if port := vars["beszel_port"]; port != "" {
+		sys.Port = port
+	}
+	if group != "all" && group != "ungrouped" && !slices.Contains(sys.Tags, group) {
+		sys.Tags = append(sys.Tags, group)
+	}
+}
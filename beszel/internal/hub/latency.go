@@ -0,0 +1,150 @@
+package hub
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// Probes sent to a system on each update
+	latencyProbeCount = 3
+	// Probes without a reply within this time are counted as lost
+	latencyProbeTimeout = time.Second
+)
+
+// Measures round trip time and packet loss from the hub to systems, with
+// ICMP echo requests or TCP connections to the agent's port
+type latencyProber struct {
+	icmp   atomic.Bool // false after ICMP sockets failed, so TCP is used instead
+	logger *slog.Logger
+	seq    atomic.Uint32
+}
+
+// Returns a prober for LATENCY_CHECK=icmp or tcp, or nil if it's not set.
+// ICMP uses unprivileged sockets, which need net.ipv4.ping_group_range to
+// include the hub's group on Linux, and falls back to TCP otherwise.
+func newLatencyProber(mode string, logger *slog.Logger) (*latencyProber, error) {
+	p := &latencyProber{logger: logger}
+	switch mode {
+	case "":
+		return nil, nil
+	case "icmp":
+		p.icmp.Store(true)
+	case "tcp":
+	default:
+		return nil, errors.New("must be icmp or tcp")
+	}
+	return p, nil
+}
+
+// Sends probes to the host in parallel and returns the average round trip
+// time of the replies in ms, and the percentage of probes without a reply
+func (p *latencyProber) measure(host, port string) (latency, loss float64) {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var total time.Duration
+	var replies int
+	for range latencyProbeCount {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rtt, err := p.probe(host, port)
+			if err != nil {
+				return
+			}
+			mutex.Lock()
+			total += rtt
+			replies++
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	loss = float64(latencyProbeCount-replies) / latencyProbeCount * 100
+	if replies > 0 {
+		latency = math.Round(float64(total.Microseconds())/float64(replies)/10) / 100
+	}
+	return latency, math.Round(loss*100) / 100
+}
+
+// Sends a single probe and returns its round trip time
+func (p *latencyProber) probe(host, port string) (time.Duration, error) {
+	if p.icmp.Load() {
+		rtt, err := p.pingICMP(host)
+		var socketErr *icmpSocketError
+		if !errors.As(err, &socketErr) {
+			return rtt, err
+		}
+		if p.icmp.Swap(false) {
+			p.logger.Warn("ICMP latency checks unavailable, using TCP", "err", err.Error())
+		}
+	}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), latencyProbeTimeout)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	conn.Close()
+	return rtt, nil
+}
+
+// Error opening an ICMP socket, as opposed to a lost probe
+type icmpSocketError struct{ err error }
+
+func (e *icmpSocketError) Error() string { return e.err.Error() }
+
+// Sends an ICMP echo request from an unprivileged socket and waits for the
+// reply. The kernel only passes replies to the socket's own requests.
+func (p *latencyProber) pingICMP(host string) (time.Duration, error) {
+	addr, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return 0, err
+	}
+	network, protocol := "udp4", 1
+	var requestType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if addr.IP.To4() == nil {
+		network, protocol = "udp6", 58
+		requestType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+	conn, err := icmp.ListenPacket(network, "")
+	if err != nil {
+		return 0, &icmpSocketError{err}
+	}
+	defer conn.Close()
+	seq := int(p.seq.Add(1) & 0xffff)
+	request, err := (&icmp.Message{
+		Type: requestType,
+		Body: &icmp.Echo{ID: seq, Seq: seq, Data: []byte("beszel")},
+	}).Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	if _, err := conn.WriteTo(request, &net.UDPAddr{IP: addr.IP, Zone: addr.Zone}); err != nil {
+		return 0, err
+	}
+	conn.SetReadDeadline(start.Add(latencyProbeTimeout))
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		reply, err := icmp.ParseMessage(protocol, buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.Seq == seq {
+			return time.Since(start), nil
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// Most systems a live stream can subscribe to
+	maxLiveSystems = 20
+	// Stats waiting to be written to a live stream. Stats of slow clients are
+	// dropped once it's full, so they can't hold up the hub.
+	liveBufferSize = 16
+	// Time to write a message before the stream is closed
+	liveWriteTimeout = 10 * time.Second
+)
+
+// Message of a live stream with the stats of a system
+type liveMessage struct {
+	System  string        `json:"system"`
+	Created time.Time     `json:"created"`
+	Polled  bool          `json:"polled,omitempty"` // polled for the stream and not saved
+	Stats   *system.Stats `json:"stats"`
+}
+
+// Browser connection to the live stream endpoint
+type liveSubscriber struct {
+	systems []string
+	send    chan liveMessage
+}
+
+// Sends the stats of a system to the live streams subscribed to it
+func (h *Hub) publishLiveStats(systemId string, stats *system.Stats) {
+	msg := liveMessage{System: systemId, Created: time.Now().UTC(), Stats: stats}
+	h.liveSubscribers.Range(func(key, _ any) bool {
+		sub := key.(*liveSubscriber)
+		if slices.Contains(sub.systems, systemId) {
+			select {
+			case sub.send <- msg:
+			default:
+			}
+		}
+		return true
+	})
+}
+
+// API endpoint that upgrades to a WebSocket and streams the stats of the
+// subscribed systems as they arrive, before they're saved to system_stats.
+// With an interval below the update interval, the stats of a single system are
+// also polled from its agent at that interval for a live view. Polled stats
+// aren't saved.
+//
+// Query params: system (repeatable), interval (seconds, 1-60), token (auth
+// token, as browsers can't set headers on WebSocket requests)
+func (h *Hub) handleLiveStream(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+	if e.Auth == nil && query.Get("token") != "" {
+		token := query.Get("token")
+		// impersonation sessions are checked by middleware that only reads headers
+		if claims, err := security.ParseUnverifiedJWT(token); err == nil && claims[impersonationClaim] != nil {
+			return apis.NewUnauthorizedError("Impersonation tokens must be sent in the Authorization header", nil)
+		}
+		if user, err := h.app.FindAuthRecordByToken(token, core.TokenTypeAuth); err == nil {
+			e.Auth = user
+		}
+	}
+	systemIds := query["system"]
+	if len(systemIds) == 0 {
+		return apis.NewBadRequestError("Missing system", nil)
+	}
+	if len(systemIds) > maxLiveSystems {
+		return apis.NewBadRequestError("Too many systems", nil)
+	}
+	systems := make([]*core.Record, 0, len(systemIds))
+	for _, id := range systemIds {
+		record, err := h.getAuthorizedSystem(e, id)
+		if err != nil {
+			return err
+		}
+		systems = append(systems, record)
+	}
+	updateInterval, _ := strconv.Atoi(systemUpdateInterval)
+	interval := updateInterval
+	if value := query.Get("interval"); value != "" {
+		var err error
+		if interval, err = strconv.Atoi(value); err != nil || interval < 1 || interval > updateInterval {
+			return apis.NewBadRequestError("Invalid interval", nil)
+		}
+	}
+	if interval < updateInterval && len(systems) > 1 {
+		return apis.NewBadRequestError("Live polling is limited to one system", nil)
+	}
+
+	sub := &liveSubscriber{systems: systemIds, send: make(chan liveMessage, liveBufferSize)}
+	server := websocket.Server{
+		// the request is authorized by token, so any origin can connect
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			// clear the deadlines of the http server
+			ws.SetDeadline(time.Time{})
+			h.liveSubscribers.Store(sub, struct{}{})
+			defer h.liveSubscribers.Delete(sub)
+			h.logger.Debug("Live stream opened", "systems", systemIds, "interval", interval)
+
+			// clients don't send anything, so a read only ends when the stream closes
+			closed := make(chan struct{})
+			go func() {
+				var discard string
+				for websocket.Message.Receive(ws, &discard) == nil {
+				}
+				close(closed)
+			}()
+
+			var poll <-chan time.Time
+			if interval < updateInterval {
+				ticker := time.NewTicker(time.Duration(interval) * time.Second)
+				defer ticker.Stop()
+				poll = ticker.C
+			}
+			for {
+				var msg liveMessage
+				select {
+				case <-closed:
+					return
+				case msg = <-sub.send:
+				case <-poll:
+					stats, err := h.pollLiveStats(systems[0], interval)
+					if err != nil {
+						h.logger.Debug("Failed to poll live stats", "system", systems[0].Id, "err", err.Error())
+						continue
+					}
+					msg = liveMessage{System: systems[0].Id, Created: time.Now().UTC(), Polled: true, Stats: stats}
+				}
+				data, err := json.Marshal(msg)
+				if err != nil {
+					continue
+				}
+				ws.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+				if err := websocket.Message.Send(ws, string(data)); err != nil {
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(e.Response, e.Request)
+	return nil
+}
+
+// Requests the stats of a system over the interval from its agent
+func (h *Hub) pollLiveStats(record *core.Record, interval int) (*system.Stats, error) {
+	var data system.CombinedData
+	if record.GetString("transport") == "https" {
+		if err := h.requestJsonFromAgentHTTPS(record, "/stats?interval="+strconv.Itoa(interval), &data); err != nil {
+			return nil, err
+		}
+		return &data.Stats, nil
+	}
+	client, err := h.getSystemClient(record)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.requestJsonFromAgent(client, "stats "+strconv.Itoa(interval), &data); err != nil {
+		return nil, err
+	}
+	return &data.Stats, nil
+}
@@ -0,0 +1,50 @@
+package hub
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Handler that passes records to the app logger, which saves them to the logs
+// shown in the admin UI. The app logger only exists once the app has bootstrapped,
+// so it's looked up for each record and records before then are dropped.
+type appLogHandler struct {
+	app  core.App
+	wrap func(slog.Handler) slog.Handler // applies WithAttrs and WithGroup calls
+}
+
+func (h *appLogHandler) handler() slog.Handler {
+	handler := h.app.Logger().Handler()
+	if h.wrap != nil {
+		handler = h.wrap(handler)
+	}
+	return handler
+}
+
+func (h *appLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.app.IsBootstrapped() && h.app.Logger().Enabled(ctx, level)
+}
+
+func (h *appLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.handler().Handle(ctx, record)
+}
+
+func (h *appLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *appLogHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *appLogHandler) with(fn func(slog.Handler) slog.Handler) slog.Handler {
+	wrap := h.wrap
+	return &appLogHandler{app: h.app, wrap: func(handler slog.Handler) slog.Handler {
+		if wrap != nil {
+			handler = wrap(handler)
+		}
+		return fn(handler)
+	}}
+}
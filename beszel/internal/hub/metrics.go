@@ -0,0 +1,213 @@
+package hub
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Number of recent records whose fields are included in a metric catalog, so
+// fields that are only sent some of the time are found
+const metricCatalogRecords = 10
+
+// Name and unit of a known series. Keys use * for segments named after a
+// sensor, filesystem, disk device, gpu, network interface or cpu.
+type metricMeta struct {
+	Name string
+	Unit string
+}
+
+// Known series of system_stats records
+var systemMetricMeta = map[string]metricMeta{
+	"cpu":      {"CPU usage", "%"},
+	"cpum":     {"Max CPU usage", "%"},
+	"cpuc.*":   {"CPU core usage", "%"},
+	"m":        {"Memory total", "GB"},
+	"mu":       {"Memory used", "GB"},
+	"mp":       {"Memory usage", "%"},
+	"mb":       {"Memory buffers and cache", "GB"},
+	"mz":       {"ZFS ARC", "GB"},
+	"ma":       {"Memory available", "GB"},
+	"mht":      {"Huge pages total", "GB"},
+	"mhu":      {"Huge pages used", "GB"},
+	"s":        {"Swap total", "GB"},
+	"su":       {"Swap used", "GB"},
+	"d":        {"Disk total", "GB"},
+	"du":       {"Disk used", "GB"},
+	"dp":       {"Disk usage", "%"},
+	"dr":       {"Disk read", "MB/s"},
+	"dw":       {"Disk write", "MB/s"},
+	"drm":      {"Max disk read", "MB/s"},
+	"dwm":      {"Max disk write", "MB/s"},
+	"drl":      {"Disk read latency", "ms"},
+	"dwl":      {"Disk write latency", "ms"},
+	"dq":       {"Disk queue length", ""},
+	"l1":       {"Load average 1m", ""},
+	"l5":       {"Load average 5m", ""},
+	"l15":      {"Load average 15m", ""},
+	"bat":      {"Battery", "%"},
+	"fd":       {"Open file descriptors", ""},
+	"fdm":      {"File descriptor limit", ""},
+	"fdp":      {"Highest process file descriptor usage", "%"},
+	"ent":      {"Available entropy", "bits"},
+	"entp":     {"Entropy pool size", "bits"},
+	"lat":      {"Latency", "ms"},
+	"pl":       {"Packet loss", "%"},
+	"ns":       {"Network sent", "MB/s"},
+	"nr":       {"Network received", "MB/s"},
+	"nsm":      {"Max network sent", "MB/s"},
+	"nrm":      {"Max network received", "MB/s"},
+	"ni.*.ns":  {"Interface sent", "MB/s"},
+	"ni.*.nr":  {"Interface received", "MB/s"},
+	"ni.*.sp":  {"Interface link speed", "Mb/s"},
+	"ni.*.u":   {"Interface utilization", "%"},
+	"t.*":      {"Temperature", "°C"},
+	"efs.*.d":  {"Disk total", "GB"},
+	"efs.*.du": {"Disk used", "GB"},
+	"efs.*.r":  {"Disk read", "MB/s"},
+	"efs.*.w":  {"Disk write", "MB/s"},
+	"efs.*.rm": {"Max disk read", "MB/s"},
+	"efs.*.wm": {"Max disk write", "MB/s"},
+	"efs.*.rl": {"Disk read latency", "ms"},
+	"efs.*.wl": {"Disk write latency", "ms"},
+	"efs.*.q":  {"Disk queue length", ""},
+	"dio.*.r":  {"Device read", "MB/s"},
+	"dio.*.w":  {"Device write", "MB/s"},
+	"dio.*.ri": {"Device read IOPS", "ops/s"},
+	"dio.*.wi": {"Device write IOPS", "ops/s"},
+	"dio.*.rl": {"Device read await", "ms"},
+	"dio.*.wl": {"Device write await", "ms"},
+	"dio.*.a":  {"Device await", "ms"},
+	"dio.*.u":  {"Device utilization", "%"},
+	"g.*.mu":   {"GPU memory used", "MB"},
+	"g.*.mt":   {"GPU memory total", "MB"},
+	"g.*.mf":   {"GPU memory free", "MB"},
+	"g.*.u":    {"GPU usage", "%"},
+	"g.*.p":    {"GPU power draw", "W"},
+	"g.*.pr":   {"GPU processes", ""},
+}
+
+// Known series of each container in container_stats records
+var containerMetricMeta = map[string]metricMeta{
+	"c":  {"CPU usage", "%"},
+	"m":  {"Memory usage", "MB"},
+	"ns": {"Network sent", "MB/s"},
+	"nr": {"Network received", "MB/s"},
+	"dr": {"Disk read", "MB/s"},
+	"dw": {"Disk write", "MB/s"},
+}
+
+// Series found in the stats of a system
+type metricSeries struct {
+	Key   string `json:"key"`            // path of the value in stats, e.g. "cpu" or "t.cpu_thermal"
+	Name  string `json:"name,omitempty"` // empty for fields the hub doesn't know
+	Label string `json:"label,omitempty"`
+	Unit  string `json:"unit,omitempty"`
+	Known bool   `json:"known"`
+}
+
+type metricCatalog struct {
+	System     string         `json:"system"`
+	Updated    types.DateTime `json:"updated"` // creation time of the newest record
+	Stats      []metricSeries `json:"stats"`
+	Containers []metricSeries `json:"containers"` // series of each container, by container stats key
+}
+
+// API endpoint that describes the series in the recent stats of a system, so
+// clients can show fields of newer agents without a list of their own.
+//
+// Query params: system
+func (h *Hub) getMetricCatalog(e *core.RequestEvent) error {
+	record, err := h.getAuthorizedSystem(e, e.Request.URL.Query().Get("system"))
+	if err != nil {
+		return err
+	}
+	catalog := metricCatalog{System: record.Id, Stats: []metricSeries{}, Containers: []metricSeries{}}
+	for _, collection := range []string{"system_stats", "container_stats"} {
+		var rows []struct {
+			Stats   types.JSONRaw  `db:"stats"`
+			Created types.DateTime `db:"created"`
+		}
+		err := h.app.DB().Select("stats", "created").From(collection).
+			Where(dbx.HashExp{"system": record.Id, "type": "1m"}).
+			OrderBy("created DESC").
+			Limit(metricCatalogRecords).
+			All(&rows)
+		if err != nil {
+			return err
+		}
+		keys := make(map[string]struct{})
+		for _, row := range rows {
+			if collection == "system_stats" {
+				if row.Created.After(catalog.Updated) {
+					catalog.Updated = row.Created
+				}
+				var stats map[string]any
+				if json.Unmarshal(row.Stats, &stats) == nil {
+					collectMetricKeys("", stats, keys)
+				}
+				continue
+			}
+			// container series are the same for each container
+			var containers []map[string]any
+			if json.Unmarshal(row.Stats, &containers) == nil {
+				for _, container := range containers {
+					collectMetricKeys("", container, keys)
+				}
+			}
+		}
+		if collection == "system_stats" {
+			catalog.Stats = describeMetrics(keys, systemMetricMeta)
+		} else {
+			catalog.Containers = describeMetrics(keys, containerMetricMeta)
+		}
+	}
+	return e.JSON(http.StatusOK, catalog)
+}
+
+// Adds the paths of the numeric values in a stats object to keys. Nested
+// objects and arrays add a path segment for each key or index.
+func collectMetricKeys(prefix string, value any, keys map[string]struct{}) {
+	switch v := value.(type) {
+	case float64:
+		keys[prefix] = struct{}{}
+	case map[string]any:
+		for key, child := range v {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			collectMetricKeys(key, child, keys)
+		}
+	case []any:
+		for i, child := range v {
+			collectMetricKeys(prefix+"."+strconv.Itoa(i), child, keys)
+		}
+	}
+}
+
+// Returns the series of the keys with their name and unit, sorted by key.
+// The segment matched by * is used as the label, e.g. the sensor name.
+func describeMetrics(keys map[string]struct{}, meta map[string]metricMeta) []metricSeries {
+	series := make([]metricSeries, 0, len(keys))
+	for key := range keys {
+		s := metricSeries{Key: key}
+		if m, ok := meta[key]; ok {
+			s.Name, s.Unit, s.Known = m.Name, m.Unit, true
+		} else if parts := strings.Split(key, "."); len(parts) > 1 {
+			label := parts[1]
+			parts[1] = "*"
+			if m, ok := meta[strings.Join(parts, ".")]; ok {
+				s.Name, s.Unit, s.Label, s.Known = m.Name, m.Unit, label, true
+			}
+		}
+		series = append(series, s)
+	}
+	slices.SortFunc(series, func(a, b metricSeries) int { return strings.Compare(a.Key, b.Key) })
+	return series
+}
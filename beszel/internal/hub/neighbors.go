@@ -0,0 +1,144 @@
+package hub
+
+import (
+	"beszel/internal/entities/container"
+	"beszel/internal/entities/system"
+	"cmp"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Containers of a system ranked by how much of the host's resources they used
+type noisyNeighbors struct {
+	Since      time.Time        `json:"since"`
+	Containers []noisyContainer `json:"containers"`
+}
+
+type noisyContainer struct {
+	Name    string  `json:"name"`
+	Project string  `json:"project,omitempty"`
+	Cpu     float64 `json:"cpu"`   // average share of host cpu (%)
+	Mem     float64 `json:"mem"`   // average share of host memory (%)
+	Net     float64 `json:"net"`   // average share of network traffic (%)
+	Score   float64 `json:"score"` // mean of the cpu, memory and network shares
+}
+
+// API endpoint that ranks the containers of a system by their share of host
+// cpu, memory and network usage over the last hour
+func (h *Hub) getNoisyNeighbors(e *core.RequestEvent) error {
+	record, err := h.getAuthorizedSystem(e, e.Request.URL.Query().Get("system"))
+	if err != nil {
+		return err
+	}
+	since := time.Now().UTC().Add(-time.Hour)
+	params := dbx.Params{"system": record.Id, "created": since.Format(types.DefaultDateLayout)}
+	where := dbx.NewExp("system={:system} AND type='1m' AND created > {:created}", params)
+
+	var rows []struct {
+		Stats types.JSONRaw `db:"stats"`
+	}
+	if err := h.app.DB().Select("stats").From("container_stats").Where(where).All(&rows); err != nil {
+		return err
+	}
+	records := make([][]container.Stats, 0, len(rows))
+	for _, row := range rows {
+		var stats []container.Stats
+		if err := json.Unmarshal(row.Stats, &stats); err == nil {
+			records = append(records, stats)
+		}
+	}
+
+	// average host memory and network traffic over the same period
+	var memTotal, hostNet float64
+	var memCount, netCount int
+	rows = rows[:0]
+	if err := h.app.DB().Select("stats").From("system_stats").Where(where).All(&rows); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var stats system.Stats
+		if err := json.Unmarshal(row.Stats, &stats); err != nil {
+			continue
+		}
+		if !stats.IsMissing(system.StatsMem) {
+			memTotal += stats.Mem
+			memCount++
+		}
+		if !stats.IsMissing(system.StatsNet) {
+			hostNet += stats.NetworkSent + stats.NetworkRecv
+			netCount++
+		}
+	}
+	if memCount > 0 {
+		memTotal /= float64(memCount)
+	}
+	if netCount > 0 {
+		hostNet /= float64(netCount)
+	}
+
+	return e.JSON(http.StatusOK, noisyNeighbors{
+		Since:      since,
+		Containers: rankContainers(records, memTotal, hostNet),
+	})
+}
+
+// Averages container usage across records and ranks containers by their score.
+// memTotal is the host memory in GB and hostNet the host network traffic in MB/s.
+func rankContainers(records [][]container.Stats, memTotal, hostNet float64) []noisyContainer {
+	sums := make(map[string]*container.Stats)
+	for _, stats := range records {
+		for _, stat := range stats {
+			sum, ok := sums[stat.Name]
+			if !ok {
+				sum = &container.Stats{Name: stat.Name, Project: stat.Project}
+				sums[stat.Name] = sum
+			}
+			sum.Cpu += stat.Cpu
+			sum.Mem += stat.Mem
+			sum.NetworkSent += stat.NetworkSent + stat.NetworkRecv
+		}
+	}
+	// containers that weren't running for the whole period count as zero while stopped
+	count := float64(len(records))
+	var netTotal float64
+	for _, sum := range sums {
+		sum.Cpu /= count
+		sum.Mem /= count
+		sum.NetworkSent /= count
+		netTotal += sum.NetworkSent
+	}
+	// container traffic may be internal, so it can exceed the host's public interfaces
+	netTotal = max(netTotal, hostNet)
+
+	result := make([]noisyContainer, 0, len(sums))
+	for _, sum := range sums {
+		c := noisyContainer{
+			Name:    sum.Name,
+			Project: sum.Project,
+			Cpu:     twoDecimals(sum.Cpu),
+		}
+		if memTotal > 0 {
+			c.Mem = twoDecimals(sum.Mem / (memTotal * 1024) * 100)
+		}
+		if netTotal > 0 {
+			c.Net = twoDecimals(sum.NetworkSent / netTotal * 100)
+		}
+		c.Score = twoDecimals((c.Cpu + c.Mem + c.Net) / 3)
+		result = append(result, c)
+	}
+	slices.SortFunc(result, func(a, b noisyContainer) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.Name, b.Name))
+	})
+	return result
+}
+
+func twoDecimals(value float64) float64 {
+	return math.Round(value*100) / 100
+}
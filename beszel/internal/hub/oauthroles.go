@@ -0,0 +1,203 @@
+package hub
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Roles in order of increasing privileges
+var userRoles = []string{"readonly", "user", "admin"}
+
+// Maps OAuth2 / OIDC groups to roles and systems, applied each time a user
+// logs in with OAuth2. Set in the oauth section of config.yml:
+//
+//	oauth:
+//	  claim: groups          # claim with the user's groups, e.g. realm_access.roles
+//	  default_role: readonly # role of users without a matching group (default unchanged)
+//	  groups:
+//	    - group: beszel-admins
+//	      role: admin
+//	      systems: ["*"]
+//	    - group: ops
+//	      role: user
+//	      filter: "tag:prod"
+//
+// Users get the most privileged role of their groups. They're added to the
+// systems of their groups and removed from systems that are only assigned to
+// other groups, unless they're the last user. Systems not covered by any group
+// are left as they are.
+type OAuthConfig struct {
+	Claim       string             `yaml:"claim,omitempty"` // default groups
+	DefaultRole string             `yaml:"default_role,omitempty"`
+	Groups      []OAuthGroupConfig `yaml:"groups"`
+}
+
+type OAuthGroupConfig struct {
+	Group   string   `yaml:"group"`
+	Role    string   `yaml:"role,omitempty"`
+	Systems []string `yaml:"systems,omitempty"` // system names or glob patterns
+	Filter  string   `yaml:"filter,omitempty"`  // selector query, e.g. "tag:prod"
+}
+
+// Returns true if the group assigns systems
+func (g OAuthGroupConfig) assignsSystems() bool {
+	return len(g.Systems) > 0 || g.Filter != ""
+}
+
+// Checks the roles and filters of the config
+func (c *OAuthConfig) validate(app core.App) error {
+	if c.DefaultRole != "" && !slices.Contains(userRoles, c.DefaultRole) {
+		return fmt.Errorf("invalid default role %q", c.DefaultRole)
+	}
+	for _, group := range c.Groups {
+		if group.Group == "" {
+			return fmt.Errorf("missing group name")
+		}
+		if group.Role != "" && !slices.Contains(userRoles, group.Role) {
+			return fmt.Errorf("invalid role %q for group %q", group.Role, group.Group)
+		}
+		if _, err := parseSelector(app, group.Filter); err != nil {
+			return fmt.Errorf("invalid filter for group %q: %w", group.Group, err)
+		}
+	}
+	return nil
+}
+
+// Returns the role for a user in the groups, or an empty string if the role
+// shouldn't be changed
+func (c *OAuthConfig) role(groups []string) string {
+	role := -1
+	for _, group := range c.Groups {
+		if group.Role != "" && slices.Contains(groups, group.Group) {
+			role = max(role, slices.Index(userRoles, group.Role))
+		}
+	}
+	if role < 0 {
+		return c.DefaultRole
+	}
+	return userRoles[role]
+}
+
+// Returns the groups of an OAuth2 user from the configured claim, which can be
+// nested with dots (realm_access.roles) and hold a list or a comma separated string
+func (c *OAuthConfig) userGroups(rawUser map[string]any) []string {
+	claim := c.Claim
+	if claim == "" {
+		claim = "groups"
+	}
+	var value any = rawUser
+	for _, key := range strings.Split(claim, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	var groups []string
+	switch value := value.(type) {
+	case []any:
+		for _, group := range value {
+			if group, ok := group.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+	case string:
+		groups = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	return groups
+}
+
+// Sets the role of users logging in with OAuth2 and assigns them to the systems
+// of their groups, if group mapping is configured in config.yml. Roles in the
+// create data of new users are ignored, so users can't choose their own role.
+func (h *Hub) applyOAuthRoles(e *core.RecordAuthWithOAuth2RequestEvent) error {
+	if _, ok := e.CreateData["role"]; ok {
+		e.CreateData = maps.Clone(e.CreateData)
+		delete(e.CreateData, "role")
+	}
+	config := h.oauthConfig.Load()
+	if config == nil {
+		return e.Next()
+	}
+	groups := config.userGroups(e.OAuth2User.RawUser)
+	if role := config.role(groups); role != "" {
+		if e.Record == nil {
+			if e.CreateData == nil {
+				e.CreateData = make(map[string]any)
+			}
+			e.CreateData["role"] = role
+		} else if e.Record.GetString("role") != role {
+			e.Record.Set("role", role)
+			if err := e.App.Save(e.Record); err != nil {
+				return err
+			}
+		}
+	}
+	if err := e.Next(); err != nil {
+		return err
+	}
+	if e.Record != nil {
+		if err := h.assignOAuthSystems(e.App, e.Record.Id, config, groups); err != nil {
+			h.logger.Error("Failed to assign systems to OAuth2 user", "user", e.Record.Email(), "err", err.Error())
+		}
+	}
+	return nil
+}
+
+// Adds the user to the systems of their groups and removes them from systems
+// that are only assigned to other groups
+func (h *Hub) assignOAuthSystems(app core.App, userId string, config *OAuthConfig, groups []string) error {
+	// a group matches a system if it matches the name patterns and the filter
+	type groupSystems struct {
+		patterns []string
+		selector systemSelector
+	}
+	var member, other []groupSystems
+	for _, group := range config.Groups {
+		if !group.assignsSystems() {
+			continue
+		}
+		selector, err := parseSelector(app, group.Filter)
+		if err != nil {
+			return fmt.Errorf("group %q: %w", group.Group, err)
+		}
+		if slices.Contains(groups, group.Group) {
+			member = append(member, groupSystems{group.Systems, selector})
+		} else {
+			other = append(other, groupSystems{group.Systems, selector})
+		}
+	}
+	if len(member) == 0 && len(other) == 0 {
+		return nil
+	}
+	matchesAny := func(record *core.Record, groups []groupSystems) bool {
+		return slices.ContainsFunc(groups, func(g groupSystems) bool {
+			return matchesAnyPattern(record.GetString("name"), g.patterns) && g.selector.matches(record)
+		})
+	}
+	systems, err := app.FindAllRecords("systems")
+	if err != nil {
+		return err
+	}
+	for _, record := range systems {
+		users := record.GetStringSlice("users")
+		hasUser := slices.Contains(users, userId)
+		switch {
+		case !hasUser && matchesAny(record, member):
+			record.Set("users+", userId)
+		// systems aren't left without users
+		case hasUser && len(users) > 1 && !matchesAny(record, member) && matchesAny(record, other):
+			record.Set("users-", userId)
+		default:
+			continue
+		}
+		if err := app.SaveNoValidate(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package hub
+
+import (
+	"beszel/internal/entities/ports"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Syncs listening_ports records for a system and fires alerts when ports
+// appear that weren't in the previous inventory
+func (h *Hub) updateListeningPorts(systemRecord *core.Record, listening []*ports.Port) {
+	if listening == nil {
+		return
+	}
+	records, err := h.app.FindAllRecords("listening_ports",
+		dbx.NewExp("system={:system}", dbx.Params{"system": systemRecord.Id}),
+	)
+	if err != nil {
+		h.logger.Error("Failed to get listening ports", "err", err.Error())
+		return
+	}
+	existing := make(map[string]*core.Record, len(records))
+	for _, record := range records {
+		port := ports.Port{Proto: record.GetString("proto"), Address: record.GetString("address"), Port: uint32(record.GetInt("port"))}
+		existing[port.Key()] = record
+	}
+	collection, err := h.app.FindCachedCollectionByNameOrId("listening_ports")
+	if err != nil {
+		h.logger.Error("Failed to get listening_ports collection", "err", err.Error())
+		return
+	}
+	// the first inventory of a system has nothing to compare with
+	firstInventory := len(records) == 0
+	var newPorts []*ports.Port
+	for _, port := range listening {
+		key := port.Key()
+		record, ok := existing[key]
+		if ok {
+			delete(existing, key)
+			if record.GetString("process") == port.Process {
+				continue
+			}
+		} else {
+			record = core.NewRecord(collection)
+			record.Set("system", systemRecord.Id)
+			record.Set("proto", port.Proto)
+			record.Set("address", port.Address)
+			record.Set("port", port.Port)
+			newPorts = append(newPorts, port)
+		}
+		record.Set("process", port.Process)
+		if err := h.app.SaveNoValidate(record); err != nil {
+			h.logger.Error("Failed to save listening port", "err", err.Error())
+		}
+	}
+	// delete ports that stopped listening
+	for _, record := range existing {
+		if err := h.app.Delete(record); err != nil {
+			h.logger.Error("Failed to delete listening port", "err", err.Error())
+		}
+	}
+	if len(newPorts) > 0 && !firstInventory {
+		if err := h.am.HandlePortAlerts(systemRecord, newPorts); err != nil {
+			h.logger.Error("Port alerts error", "err", err.Error())
+		}
+	}
+}
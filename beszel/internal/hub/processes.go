@@ -0,0 +1,74 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/crypto/ssh"
+)
+
+// API endpoint that returns the top processes by cpu and memory usage for a system
+func (h *Hub) getProcesses(e *core.RequestEvent) error {
+	record, err := h.getAuthorizedSystem(e, e.Request.URL.Query().Get("system"))
+	if err != nil {
+		return err
+	}
+	if record.GetString("status") != "up" {
+		return apis.NewBadRequestError("System is not up", nil)
+	}
+	n, _ := strconv.Atoi(e.Request.URL.Query().Get("n"))
+	if n <= 0 {
+		n = 10
+	}
+	var processes system.ProcessList
+	if record.GetString("transport") == "https" {
+		if err := h.requestJsonFromAgentHTTPS(record, fmt.Sprintf("/processes?n=%d", n), &processes); err != nil {
+			return apis.NewApiError(http.StatusBadGateway, "Failed to get processes", err)
+		}
+		return e.JSON(http.StatusOK, processes)
+	}
+	client, err := h.getSystemClient(record)
+	if err != nil {
+		return apis.NewApiError(http.StatusBadGateway, "Failed to connect to agent", err)
+	}
+	if err := h.requestJsonFromAgent(client, fmt.Sprintf("processes %d", n), &processes); err != nil {
+		return apis.NewApiError(http.StatusBadGateway, "Failed to get processes", err)
+	}
+	return e.JSON(http.StatusOK, processes)
+}
+
+// Returns the system record if the authenticated user has access to it
+func (h *Hub) getAuthorizedSystem(e *core.RequestEvent, systemId string) (*core.Record, error) {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil {
+		return nil, apis.NewForbiddenError("Forbidden", nil)
+	}
+	if systemId == "" {
+		return nil, apis.NewBadRequestError("Missing system", nil)
+	}
+	record, err := h.app.FindRecordById("systems", systemId)
+	if err != nil {
+		return nil, apis.NewNotFoundError("System not found", nil)
+	}
+	if canAccess, _ := h.app.CanAccessRecord(record, info, record.Collection().ViewRule); !canAccess {
+		return nil, apis.NewNotFoundError("System not found", nil)
+	}
+	return record, nil
+}
+
+// Returns the existing ssh client for a system or creates a new one
+func (h *Hub) getSystemClient(record *core.Record) (*ssh.Client, error) {
+	if existingClient, ok := h.systemConnections.Load(record.Id); ok {
+		return existingClient.(*ssh.Client), nil
+	}
+	client, _, err := h.createSystemConnection(record)
+	if err != nil {
+		return nil, err
+	}
+	h.systemConnections.Store(record.Id, client)
+	return client, nil
+}
@@ -0,0 +1,162 @@
+package hub
+
+import (
+	"beszel/internal/records"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/cobra"
+)
+
+// Collections with records of each resolution
+var statsCollections = []string{"system_stats", "container_stats"}
+
+// Options of the db prune command
+type pruneOptions struct {
+	before      time.Time
+	resolutions []string
+	batchSize   int
+	pause       time.Duration
+}
+
+// Returns the db command, which groups database maintenance subcommands
+func (h *Hub) newDbCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Database maintenance",
+	}
+	cmd.AddCommand(h.newPruneCommand())
+	return cmd
+}
+
+// Returns the prune command, which deletes old stats in small batches so it can run while the hub is live
+func (h *Hub) newPruneCommand() *cobra.Command {
+	var before string
+	var opts pruneOptions
+	var vacuum bool
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete stats recorded before a date",
+		Long: `Delete stats recorded before a date.
+
+Records are deleted in batches with a pause between them, so the hub can keep
+running. Use --vacuum to reclaim disk space afterwards. Vacuuming rewrites the
+database and blocks writes from the hub until it finishes.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if opts.before, err = parsePruneDate(before); err != nil {
+				return err
+			}
+			for _, resolution := range opts.resolutions {
+				if !slices.Contains(records.RecordTypes, resolution) {
+					return fmt.Errorf("invalid resolution %q (valid: %s)", resolution, strings.Join(records.RecordTypes, ","))
+				}
+			}
+			if opts.batchSize < 1 {
+				return fmt.Errorf("batch size must be at least 1")
+			}
+			if err := h.app.RunAllMigrations(); err != nil {
+				return err
+			}
+			deleted, err := h.pruneStats(opts)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Deleted %d records\n", deleted)
+			if vacuum {
+				fmt.Println("Vacuuming database...")
+				if err := h.app.Vacuum(); err != nil {
+					return err
+				}
+				fmt.Println("Done")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&before, "before", "", "delete records created before this date (YYYY-MM-DD or RFC 3339)")
+	cmd.Flags().StringSliceVar(&opts.resolutions, "resolutions", records.RecordTypes, "resolutions to delete")
+	cmd.Flags().IntVar(&opts.batchSize, "batch", 1000, "records to delete per batch")
+	cmd.Flags().DurationVar(&opts.pause, "pause", 100*time.Millisecond, "pause between batches")
+	cmd.Flags().BoolVar(&vacuum, "vacuum", false, "vacuum the database afterwards to reclaim disk space")
+	cmd.MarkFlagRequired("before")
+	return cmd
+}
+
+// Parses a date in local time or a full timestamp, which must be in the past
+func parsePruneDate(value string) (time.Time, error) {
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		date, err = time.ParseInLocation(time.DateOnly, value, time.Local)
+		if err != nil {
+			return date, fmt.Errorf("invalid date %q", value)
+		}
+	}
+	if date.After(time.Now()) {
+		return date, fmt.Errorf("date %q is in the future", value)
+	}
+	return date.UTC(), nil
+}
+
+// Deletes stats matching the options in batches, printing progress for each resolution
+func (h *Hub) pruneStats(opts pruneOptions) (int64, error) {
+	date := opts.before.Format(types.DefaultDateLayout)
+	var total int64
+	for _, collection := range statsCollections {
+		for _, resolution := range opts.resolutions {
+			params := dbx.Params{"type": resolution, "date": date, "limit": opts.batchSize}
+			var count int64
+			err := h.app.DB().
+				Select("count(*)").
+				From(collection).
+				Where(dbx.NewExp("[[type]]={:type} AND [[created]]<{:date}", params)).
+				Row(&count)
+			if err != nil {
+				return total, err
+			}
+			if count == 0 {
+				continue
+			}
+			var deleted int64
+			for deleted < count {
+				n, err := h.deleteStatsBatch(collection, params)
+				if err != nil {
+					return total + deleted, fmt.Errorf("failed to delete %s records: %w", collection, err)
+				}
+				if n == 0 {
+					break
+				}
+				deleted += n
+				fmt.Printf("\r%s %s: %d/%d (%.0f%%)", collection, resolution, deleted, count, float64(min(deleted, count))/float64(count)*100)
+				time.Sleep(opts.pause)
+			}
+			fmt.Println()
+			total += deleted
+		}
+	}
+	return total, nil
+}
+
+// Deletes one batch of stats, retrying with backoff if the database is busy
+func (h *Hub) deleteStatsBatch(collection string, params dbx.Params) (int64, error) {
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		result, err := h.app.NonconcurrentDB().
+			NewQuery(fmt.Sprintf("DELETE FROM {{%[1]s}} WHERE [[id]] IN (SELECT [[id]] FROM {{%[1]s}} WHERE [[type]]={:type} AND [[created]]<{:date} LIMIT {:limit})", collection)).
+			Bind(params).
+			Execute()
+		if err == nil {
+			return result.RowsAffected()
+		}
+		if attempt == 5 {
+			return 0, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,344 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"beszel/internal/i18n"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// API endpoint that lets agents register themselves using the ENROLLMENT_TOKEN.
+// Creates the system if it doesn't exist and returns the hub's public key.
+func (h *Hub) registerSystem(e *core.RequestEvent) error {
+	token, _ := GetEnv("ENROLLMENT_TOKEN")
+	if token == "" {
+		return apis.NewNotFoundError("Enrollment is disabled", nil)
+	}
+	var req struct {
+		Token       string `json:"token"`
+		Name        string `json:"name"`
+		Host        string `json:"host"`
+		Port        string `json:"port"`
+		Transport   string `json:"transport"`
+		Fingerprint string `json:"fingerprint"`
+		Secret      string `json:"secret"` // issued by the hub at the agent's first registration
+	}
+	if err := e.BindBody(&req); err != nil {
+		return apis.NewBadRequestError("Invalid request", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(token)) != 1 {
+		return apis.NewUnauthorizedError("Invalid token", nil)
+	}
+	if req.Host == "" {
+		req.Host = e.RealIP()
+	}
+	if req.Port == "" {
+		req.Port = "45876"
+	}
+	if req.Name == "" {
+		req.Name = req.Host
+	}
+	if req.Transport != "https" {
+		req.Transport = "ssh"
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if err := validateRegistration(req.Name, req.Host, req.Port, req.Fingerprint); err != nil {
+		return apis.NewBadRequestError(err.Error(), nil)
+	}
+
+	h.enrollmentMutex.Lock()
+	defer h.enrollmentMutex.Unlock()
+
+	// existing systems are left as is so agents can register on every start
+	record, err := h.findRegisteredSystem(req.Host, req.Port, req.Fingerprint)
+	if err == nil {
+		// agent may have changed address or transport since it was registered. The
+		// fingerprint isn't secret, so only the agent with the secret issued to the
+		// system may change them, others need an admin.
+		move := pendingMove{Host: req.Host, Port: req.Port, Transport: req.Transport, Fingerprint: req.Fingerprint}
+		if move.changes(record) {
+			if !agentSecretMatches(record, req.Secret) {
+				return h.requestMoveApproval(e, record, move)
+			}
+			move.apply(record)
+			if err := h.app.Save(record); err != nil {
+				return apis.NewBadRequestError("Failed to update system", err)
+			}
+		}
+	} else if errors.Is(err, errFingerprintMismatch) {
+		h.logger.Warn("Registration refused: address used by another agent", "host", req.Host, "port", req.Port)
+		return apis.NewApiError(http.StatusConflict, "Address is registered to another agent", nil)
+	} else {
+		if err := h.checkEnrollmentQuota(); err != nil {
+			return err
+		}
+		userID, err := h.enrollmentUserID()
+		if err != nil {
+			return err
+		}
+		collection, err := h.app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		record = core.NewRecord(collection)
+		record.Set("name", req.Name)
+		record.Set("host", req.Host)
+		record.Set("port", req.Port)
+		record.Set("users", []string{userID})
+		record.Set("info", system.Info{})
+		record.Set("status", "pending")
+		record.Set("transport", req.Transport)
+		record.Set("enrolled", true)
+		record.Set("fingerprint", req.Fingerprint)
+		secret := security.RandomString(agentSecretLength)
+		record.Set("agent_secret", hashAgentSecret(secret))
+		if err := h.app.Save(record); err != nil {
+			return apis.NewBadRequestError("Failed to create system", err)
+		}
+		h.logger.Info("Registered system", "name", req.Name, "host", req.Host, "port", req.Port)
+		return e.JSON(http.StatusOK, map[string]string{"key": h.pubKey, "secret": secret})
+	}
+	return e.JSON(http.StatusOK, map[string]string{"key": h.pubKey})
+}
+
+// Length of the secret issued to agents, which they send with later
+// registrations and certificate requests to prove they're the system's agent
+const agentSecretLength = 48
+
+// Returns the hash of an agent secret as stored in the system record
+func hashAgentSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns true if the secret is the one issued to the system's agent. Systems
+// registered before agents got secrets only have one after an approved move.
+func agentSecretMatches(record *core.Record, secret string) bool {
+	stored := record.GetString("agent_secret")
+	return stored != "" && secret != "" && subtle.ConstantTimeCompare([]byte(hashAgentSecret(secret)), []byte(stored)) == 1
+}
+
+// Address and transport of a registering agent that doesn't match its system.
+// The fingerprint is saved in a hidden field, since it's used to issue certificates.
+type pendingMove struct {
+	Host        string         `json:"host"`
+	Port        string         `json:"port"`
+	Transport   string         `json:"transport"`
+	Fingerprint string         `json:"-"`
+	IP          string         `json:"ip,omitempty"` // address the registration came from
+	Requested   types.DateTime `json:"requested"`
+}
+
+// Returns true if the move changes the address or transport of the system. The
+// fingerprint only counts for https, since ssh agents have it stored with their
+// first stats and https agents need it stored to get a certificate.
+func (m pendingMove) changes(record *core.Record) bool {
+	return record.GetString("host") != m.Host || record.GetString("port") != m.Port ||
+		record.GetString("transport") != m.Transport ||
+		(m.Transport == "https" && m.Fingerprint != "" && record.GetString("fingerprint") != m.Fingerprint)
+}
+
+func (m pendingMove) apply(record *core.Record) {
+	record.Set("host", m.Host)
+	record.Set("port", m.Port)
+	record.Set("transport", m.Transport)
+	if m.Fingerprint != "" {
+		record.Set("fingerprint", m.Fingerprint)
+	}
+	record.Set("pending_move", nil)
+	record.Set("pending_fingerprint", "")
+	record.Set("pending_secret", "")
+}
+
+// Saves a move requested by an agent that can't prove it's the system's agent
+// and notifies admins the first time it's requested. The agent that requested
+// it gets a new secret, which becomes the system's secret if the move is approved.
+// Agents asking for the same move again don't get one, so an approval can't
+// hand the system to another agent that registered with the same address.
+func (h *Hub) requestMoveApproval(e *core.RequestEvent, record *core.Record, move pendingMove) error {
+	var previous pendingMove
+	record.UnmarshalJSONField("pending_move", &previous)
+	previous.Fingerprint = record.GetString("pending_fingerprint")
+	move.IP = e.RealIP()
+	move.Requested = previous.Requested
+	res := map[string]string{"status": "pending"}
+	if previous.Host != move.Host || previous.Port != move.Port || previous.Transport != move.Transport || previous.Fingerprint != move.Fingerprint {
+		secret := security.RandomString(agentSecretLength)
+		move.Requested = types.NowDateTime()
+		record.Set("pending_move", move)
+		record.Set("pending_fingerprint", move.Fingerprint)
+		record.Set("pending_secret", hashAgentSecret(secret))
+		if err := h.app.SaveNoValidate(record); err != nil {
+			return err
+		}
+		res["secret"] = secret
+		h.logger.Warn("Registration needs approval: system changed address or transport",
+			"system", record.GetString("name"), "host", move.Host, "port", move.Port, "transport", move.Transport, "ip", move.IP)
+		message := i18n.M("An agent registered for {system} from a new address or transport ({host}:{port}, {transport}) and can't prove it's the system's agent. Approve the move in the system's menu if this is expected.",
+			"system", record.GetString("name"), "host", move.Host, "port", move.Port, "transport", move.Transport)
+		if err := h.am.NotifyAdmins(i18n.M("Beszel agent move needs approval"), message); err != nil {
+			h.logger.Error("Failed to notify admins", "err", err.Error())
+		}
+	}
+	return e.JSON(http.StatusAccepted, res)
+}
+
+// API endpoint that applies the address and transport an agent registered with
+// (POST with id), after the agent couldn't prove it's the system's agent
+func (h *Hub) approveMove(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	var req struct {
+		Id string `json:"id"`
+	}
+	if err := e.BindBody(&req); err != nil {
+		return apis.NewBadRequestError("Invalid request", err)
+	}
+	h.enrollmentMutex.Lock()
+	defer h.enrollmentMutex.Unlock()
+	record, err := h.getAuthorizedSystem(e, req.Id)
+	if err != nil {
+		return err
+	}
+	var move pendingMove
+	if err := record.UnmarshalJSONField("pending_move", &move); err != nil || move.Host == "" {
+		return apis.NewNotFoundError("No pending move", nil)
+	}
+	move.Fingerprint = record.GetString("pending_fingerprint")
+	// the agent that requested the move becomes the system's agent
+	if secret := record.GetString("pending_secret"); secret != "" {
+		record.Set("agent_secret", secret)
+	}
+	move.apply(record)
+	if err := h.app.Save(record); err != nil {
+		return apis.NewBadRequestError("Failed to update system", err)
+	}
+	h.logger.Info("Approved system move", "system", record.GetString("name"), "host", move.Host, "port", move.Port, "user", info.Auth.GetString("email"))
+	return e.NoContent(http.StatusNoContent)
+}
+
+// Returns the id of the user that owns registered systems,
+// set with ENROLLMENT_USER (email) or defaulting to the first user
+func (h *Hub) enrollmentUserID() (string, error) {
+	if email, _ := GetEnv("ENROLLMENT_USER"); email != "" {
+		user, err := h.app.FindAuthRecordByEmail("users", email)
+		if err != nil {
+			return "", apis.NewBadRequestError("Enrollment user not found", nil)
+		}
+		return user.Id, nil
+	}
+	users, err := h.app.FindRecordsByFilter("users", "", "created", 1, 0)
+	if err != nil || len(users) == 0 {
+		return "", apis.NewBadRequestError("No users found", nil)
+	}
+	return users[0].Id, nil
+}
+
+var (
+	hostnameRegex    = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?$`)
+	fingerprintRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{0,128}$`)
+)
+
+// Returned when a system at the agent's address was registered with a different fingerprint
+var errFingerprintMismatch = errors.New("fingerprint mismatch")
+
+// Finds the system of a registering agent by fingerprint, falling back to its address.
+// Systems without a fingerprint are matched by address. Once a system has one, agents
+// at its address must send the same fingerprint, so an empty one doesn't match.
+func (h *Hub) findRegisteredSystem(host, port, fingerprint string) (*core.Record, error) {
+	if fingerprint != "" {
+		if record, err := h.app.FindFirstRecordByData("systems", "fingerprint", fingerprint); err == nil {
+			return record, nil
+		}
+	}
+	record, err := h.app.FindFirstRecordByFilter("systems", "host={:host} && port={:port}", dbx.Params{"host": host, "port": port})
+	if err != nil {
+		return nil, err
+	}
+	if existing := record.GetString("fingerprint"); existing != "" && existing != fingerprint {
+		return nil, errFingerprintMismatch
+	}
+	return record, nil
+}
+
+// Returns an error if the name, host, port or fingerprint of a registering agent is invalid
+func validateRegistration(name, host, port, fingerprint string) error {
+	if len(name) > 100 || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return errors.New("Invalid name")
+	}
+	if net.ParseIP(host) == nil && (len(host) > 253 || !hostnameRegex.MatchString(host)) {
+		return errors.New("Invalid host")
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return errors.New("Invalid port")
+	}
+	if !fingerprintRegex.MatchString(fingerprint) {
+		return errors.New("Invalid fingerprint")
+	}
+	return nil
+}
+
+// Returns an error if auto-registration has created too many systems, per hour
+// (ENROLLMENT_HOURLY_LIMIT, default 20) or in total (ENROLLMENT_TOTAL_LIMIT, default unlimited).
+// Admins are notified at most once an hour when a limit is reached.
+func (h *Hub) checkEnrollmentQuota() error {
+	hourlyLimit := 20
+	if value, exists := GetEnv("ENROLLMENT_HOURLY_LIMIT"); exists {
+		hourlyLimit, _ = strconv.Atoi(value)
+	}
+	totalLimit := 0
+	if value, exists := GetEnv("ENROLLMENT_TOTAL_LIMIT"); exists {
+		totalLimit, _ = strconv.Atoi(value)
+	}
+
+	var reason i18n.Message
+	if hourlyLimit > 0 {
+		since := time.Now().UTC().Add(-time.Hour).Format(types.DefaultDateLayout)
+		count, err := h.app.CountRecords("systems", dbx.NewExp("enrolled=true AND created > {:since}", dbx.Params{"since": since}))
+		if err != nil {
+			return err
+		}
+		if count >= int64(hourlyLimit) {
+			reason = i18n.M("{count, plural, one {# system was registered in the last hour} other {# systems were registered in the last hour}}", "count", count)
+		}
+	}
+	if reason.IsZero() && totalLimit > 0 {
+		count, err := h.app.CountRecords("systems", dbx.HashExp{"enrolled": true})
+		if err != nil {
+			return err
+		}
+		if count >= int64(totalLimit) {
+			reason = i18n.M("{count, plural, one {# system has been registered in total} other {# systems have been registered in total}}", "count", count)
+		}
+	}
+	if reason.IsZero() {
+		return nil
+	}
+
+	h.logger.Warn("Enrollment limit reached", "reason", reason.String())
+	if time.Since(h.lastEnrollmentAlert) > time.Hour {
+		h.lastEnrollmentAlert = time.Now()
+		message := i18n.M("Agent registration was refused because the limit was reached: {reason}. If this is unexpected, the enrollment token may have leaked and should be changed.", "reason", reason)
+		if err := h.am.NotifyAdmins(i18n.M("Beszel enrollment limit reached"), message); err != nil {
+			h.logger.Error("Failed to notify admins", "err", err.Error())
+		}
+	}
+	return apis.NewTooManyRequestsError("Enrollment limit reached", nil)
+}
@@ -0,0 +1,171 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Returns a system record with the address, transport, fingerprint and secret
+func newSystemRecord(host, port, transport, fingerprint, secret string) *core.Record {
+	collection := core.NewBaseCollection("systems")
+	collection.Fields.Add(
+		&core.TextField{Name: "host"},
+		&core.TextField{Name: "port"},
+		&core.TextField{Name: "transport"},
+		&core.TextField{Name: "fingerprint"},
+		&core.TextField{Name: "agent_secret"},
+		&core.JSONField{Name: "pending_move"},
+		&core.TextField{Name: "pending_fingerprint"},
+		&core.TextField{Name: "pending_secret"},
+	)
+	record := core.NewRecord(collection)
+	record.Set("host", host)
+	record.Set("port", port)
+	record.Set("transport", transport)
+	record.Set("fingerprint", fingerprint)
+	if secret != "" {
+		record.Set("agent_secret", hashAgentSecret(secret))
+	}
+	return record
+}
+
+func TestRegistrationMoveApproval(t *testing.T) {
+	tests := []struct {
+		name         string
+		record       *core.Record
+		move         pendingMove
+		secret       string
+		wantChanges  bool
+		wantApproval bool
+	}{
+		{
+			name:   "same address",
+			record: newSystemRecord("10.0.0.1", "45876", "ssh", "fp", "secret"),
+			move:   pendingMove{Host: "10.0.0.1", Port: "45876", Transport: "ssh", Fingerprint: "fp"},
+			secret: "secret",
+		},
+		{
+			name:   "same address without secret",
+			record: newSystemRecord("10.0.0.1", "45876", "ssh", "fp", "secret"),
+			move:   pendingMove{Host: "10.0.0.1", Port: "45876", Transport: "ssh", Fingerprint: "fp"},
+		},
+		{
+			name:        "new address with secret",
+			record:      newSystemRecord("10.0.0.1", "45876", "ssh", "fp", "secret"),
+			move:        pendingMove{Host: "10.0.0.2", Port: "45876", Transport: "ssh", Fingerprint: "fp"},
+			secret:      "secret",
+			wantChanges: true,
+		},
+		{
+			name:         "new address with fingerprint but no secret",
+			record:       newSystemRecord("10.0.0.1", "45876", "ssh", "fp", "secret"),
+			move:         pendingMove{Host: "10.0.0.2", Port: "45876", Transport: "ssh", Fingerprint: "fp"},
+			wantChanges:  true,
+			wantApproval: true,
+		},
+		{
+			name:         "new port with wrong secret",
+			record:       newSystemRecord("10.0.0.1", "45876", "ssh", "fp", "secret"),
+			move:         pendingMove{Host: "10.0.0.1", Port: "45877", Transport: "ssh", Fingerprint: "fp"},
+			secret:       "other",
+			wantChanges:  true,
+			wantApproval: true,
+		},
+		{
+			name:         "new transport with wrong secret",
+			record:       newSystemRecord("10.0.0.1", "45876", "ssh", "fp", "secret"),
+			move:         pendingMove{Host: "10.0.0.1", Port: "45876", Transport: "https", Fingerprint: "fp"},
+			secret:       "other",
+			wantChanges:  true,
+			wantApproval: true,
+		},
+		{
+			name:         "system without secret",
+			record:       newSystemRecord("10.0.0.1", "45876", "ssh", "fp", ""),
+			move:         pendingMove{Host: "10.0.0.2", Port: "45876", Transport: "ssh", Fingerprint: "fp"},
+			wantChanges:  true,
+			wantApproval: true,
+		},
+		{
+			name:         "system without secret and hash of empty secret",
+			record:       newSystemRecord("10.0.0.1", "45876", "ssh", "fp", ""),
+			move:         pendingMove{Host: "10.0.0.2", Port: "45876", Transport: "ssh", Fingerprint: "fp"},
+			secret:       hashAgentSecret(""),
+			wantChanges:  true,
+			wantApproval: true,
+		},
+		{
+			name:         "new https fingerprint without secret",
+			record:       newSystemRecord("10.0.0.1", "45876", "https", "fp", "secret"),
+			move:         pendingMove{Host: "10.0.0.1", Port: "45876", Transport: "https", Fingerprint: "other"},
+			wantChanges:  true,
+			wantApproval: true,
+		},
+		{
+			name:   "new ssh fingerprint",
+			record: newSystemRecord("10.0.0.1", "45876", "ssh", "fp", "secret"),
+			move:   pendingMove{Host: "10.0.0.1", Port: "45876", Transport: "ssh", Fingerprint: "other"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := tt.move.changes(tt.record)
+			if changes != tt.wantChanges {
+				t.Fatalf("changes() = %v, want %v", changes, tt.wantChanges)
+			}
+			approval := changes && !agentSecretMatches(tt.record, tt.secret)
+			if approval != tt.wantApproval {
+				t.Fatalf("needs approval = %v, want %v", approval, tt.wantApproval)
+			}
+		})
+	}
+}
+
+func TestPendingMoveApply(t *testing.T) {
+	record := newSystemRecord("10.0.0.1", "45876", "ssh", "fp", "secret")
+	record.Set("pending_move", pendingMove{Host: "10.0.0.2"})
+	record.Set("pending_fingerprint", "other")
+	record.Set("pending_secret", hashAgentSecret("new"))
+	pendingMove{Host: "10.0.0.2", Port: "45877", Transport: "https", Fingerprint: "other"}.apply(record)
+
+	for field, want := range map[string]string{
+		"host":                "10.0.0.2",
+		"port":                "45877",
+		"transport":           "https",
+		"fingerprint":         "other",
+		"pending_fingerprint": "",
+		"pending_secret":      "",
+	} {
+		if got := record.GetString(field); got != want {
+			t.Errorf("%s = %q, want %q", field, got, want)
+		}
+	}
+	if !agentSecretMatches(record, "secret") {
+		t.Error("secret of the system's agent changed")
+	}
+}
+
+func TestValidateRegistration(t *testing.T) {
+	tests := []struct {
+		name                             string
+		sysName, host, port, fingerprint string
+		wantErr                          bool
+	}{
+		{name: "valid", sysName: "web", host: "10.0.0.1", port: "45876", fingerprint: "abc_123-def"},
+		{name: "hostname", sysName: "web", host: "web.example.com", port: "45876"},
+		{name: "ipv6", sysName: "web", host: "::1", port: "45876"},
+		{name: "control character in name", sysName: "web\n", host: "10.0.0.1", port: "45876", wantErr: true},
+		{name: "invalid host", sysName: "web", host: "web example", port: "45876", wantErr: true},
+		{name: "port out of range", sysName: "web", host: "10.0.0.1", port: "70000", wantErr: true},
+		{name: "invalid fingerprint", sysName: "web", host: "10.0.0.1", port: "45876", fingerprint: "a/b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRegistration(tt.sysName, tt.host, tt.port, tt.fingerprint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateRegistration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/blang/semver"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Saved filters can include other saved filters up to this depth
+const maxSelectorDepth = 5
+
+// Selects systems by their fields, so groups of systems can be defined by a
+// query instead of a list. A query is a list of terms that all have to match:
+//
+//	tag:prod          has the tag
+//	name:web-*        name matches a glob pattern, or name:/^web-\d+$/ a regex
+//	os:linux          operating system of the agent (linux, darwin, windows, freebsd)
+//	version:>=0.12.0  agent version, compared with =, !=, <, <=, > or >=
+//	site:eu-west      site
+//	status:up         up, down, paused or pending
+//	filter:databases  matches the saved filter with the name
+//
+// A term without a key is a name pattern. Values can be quoted ("web servers")
+// and list alternatives separated by commas (tag:prod,staging). A leading minus
+// negates a term (-tag:test).
+type systemSelector []selectorTerm
+
+type selectorTerm struct {
+	negate bool
+	match  func(*core.Record) bool
+}
+
+// Returns true if the system matches all terms. An empty selector matches all systems.
+func (s systemSelector) matches(record *core.Record) bool {
+	for _, term := range s {
+		if term.match(record) == term.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the systems that match the selector
+func (s systemSelector) filter(records []*core.Record) []*core.Record {
+	return slices.DeleteFunc(slices.Clone(records), func(record *core.Record) bool {
+		return !s.matches(record)
+	})
+}
+
+// Parses a selector query. Saved filters referenced with filter:<name> are
+// loaded from the system_filters collection.
+func parseSelector(app core.App, query string) (systemSelector, error) {
+	return parseSelectorDepth(app, query, 0)
+}
+
+func parseSelectorDepth(app core.App, query string, depth int) (systemSelector, error) {
+	if depth > maxSelectorDepth {
+		return nil, errors.New("saved filters are nested too deeply")
+	}
+	fields, err := splitSelector(query)
+	if err != nil {
+		return nil, err
+	}
+	selector := make(systemSelector, 0, len(fields))
+	for _, field := range fields {
+		term := selectorTerm{}
+		if rest, ok := strings.CutPrefix(field, "-"); ok {
+			term.negate = true
+			field = rest
+		}
+		key, value, found := strings.Cut(field, ":")
+		if !found {
+			key, value = "name", field
+		}
+		value = strings.Trim(value, `"`)
+		if value == "" {
+			return nil, fmt.Errorf("missing value in %q", field)
+		}
+		switch key {
+		case "name":
+			term.match, err = nameMatcher(value)
+		case "tag":
+			term.match = func(record *core.Record) bool {
+				return slices.ContainsFunc(record.GetStringSlice("tags"), func(tag string) bool {
+					return equalsAny(tag, value)
+				})
+			}
+		case "os":
+			term.match = func(record *core.Record) bool {
+				var info system.Info
+				record.UnmarshalJSONField("info", &info)
+				return info.Os != "" && equalsAny(info.Os, value)
+			}
+		case "site":
+			term.match = func(record *core.Record) bool {
+				return equalsAny(record.GetString("site"), value)
+			}
+		case "status":
+			term.match = func(record *core.Record) bool {
+				return equalsAny(record.GetString("status"), value)
+			}
+		case "version":
+			term.match, err = versionMatcher(value)
+		case "filter":
+			var saved systemSelector
+			saved, err = loadSavedSelector(app, value, depth)
+			term.match = saved.matches
+		default:
+			err = fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		selector = append(selector, term)
+	}
+	return selector, nil
+}
+
+// Splits a query into terms at spaces that aren't inside quotes
+func splitSelector(query string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			field.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		default:
+			field.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, errors.New("unclosed quote")
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// Returns true if s equals one of the comma separated values, ignoring case
+func equalsAny(s, values string) bool {
+	for _, value := range strings.Split(values, ",") {
+		if strings.EqualFold(s, strings.TrimSpace(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches names against a regex in slashes or comma separated glob patterns
+func nameMatcher(value string) (func(*core.Record) bool, error) {
+	if len(value) > 1 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/") {
+		re, err := regexp.Compile(value[1 : len(value)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid name regex: %w", err)
+		}
+		return func(record *core.Record) bool {
+			return re.MatchString(record.GetString("name"))
+		}, nil
+	}
+	patterns := strings.Split(value, ",")
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid name pattern %q", pattern)
+		}
+	}
+	return func(record *core.Record) bool {
+		return matchesAnyPattern(record.GetString("name"), patterns)
+	}, nil
+}
+
+// Compares agent versions, e.g. ">=0.12.0". Systems that haven't reported a
+// version don't match.
+func versionMatcher(value string) (func(*core.Record) bool, error) {
+	opLen := len(value) - len(strings.TrimLeft(value, "=!<>"))
+	op := value[:opLen]
+	want, err := semver.ParseTolerant(value[opLen:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid version %q", value[opLen:])
+	}
+	var compare func(int) bool
+	switch op {
+	case "", "=":
+		compare = func(c int) bool { return c == 0 }
+	case "!=":
+		compare = func(c int) bool { return c != 0 }
+	case "<":
+		compare = func(c int) bool { return c < 0 }
+	case "<=":
+		compare = func(c int) bool { return c <= 0 }
+	case ">":
+		compare = func(c int) bool { return c > 0 }
+	case ">=":
+		compare = func(c int) bool { return c >= 0 }
+	default:
+		return nil, fmt.Errorf("invalid version comparison %q", op)
+	}
+	return func(record *core.Record) bool {
+		var info system.Info
+		record.UnmarshalJSONField("info", &info)
+		version, err := semver.ParseTolerant(info.AgentVersion)
+		return err == nil && compare(version.Compare(want))
+	}, nil
+}
+
+// Parses the query of a saved filter
+func loadSavedSelector(app core.App, name string, depth int) (systemSelector, error) {
+	record, err := app.FindFirstRecordByData("system_filters", "name", name)
+	if err != nil {
+		return nil, fmt.Errorf("saved filter %q not found", name)
+	}
+	selector, err := parseSelectorDepth(app, record.GetString("query"), depth+1)
+	if err != nil {
+		return nil, fmt.Errorf("saved filter %q: %w", name, err)
+	}
+	return selector, nil
+}
+
+// Rejects saved filters with an invalid query
+func (h *Hub) validateSystemFilter(e *core.RecordEvent) error {
+	if _, err := parseSelector(e.App, e.Record.GetString("query")); err != nil {
+		return apis.NewBadRequestError("Invalid filter: "+err.Error(), nil)
+	}
+	return e.Next()
+}
+
+type matchedSystem struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// API endpoint that returns the systems the user can access that match a
+// selector query (?filter=tag:prod os:linux), so the web app can show groups
+// of systems that stay up to date as systems change
+func (h *Hub) getMatchingSystems(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	selector, err := parseSelector(h.app, e.Request.URL.Query().Get("filter"))
+	if err != nil {
+		return apis.NewBadRequestError("Invalid filter: "+err.Error(), nil)
+	}
+	systems, err := h.app.FindRecordsByFilter("systems", "users.id ?= {:user}", "name", 0, 0, dbx.Params{"user": info.Auth.Id})
+	if err != nil {
+		return err
+	}
+	matched := make([]matchedSystem, 0, len(systems))
+	for _, record := range selector.filter(systems) {
+		matched = append(matched, matchedSystem{
+			Id:     record.Id,
+			Name:   record.GetString("name"),
+			Status: record.GetString("status"),
+		})
+	}
+	return e.JSON(http.StatusOK, matched)
+}
@@ -0,0 +1,50 @@
+package hub
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Returns the silence command, which silences all notifications for a number of hours
+func (h *Hub) newSilenceCommand() *cobra.Command {
+	var hours float64
+	var reason string
+	var clearSilence bool
+	cmd := &cobra.Command{
+		Use:          "silence",
+		Short:        "Silence all notifications for a number of hours (e.g. during maintenance)",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := h.app.RunAllMigrations(); err != nil {
+				return err
+			}
+			switch {
+			case clearSilence:
+				if err := h.am.Unsilence(); err != nil {
+					return err
+				}
+				fmt.Println("Notifications unsilenced")
+			case hours > 0:
+				record, err := h.am.Silence("", time.Duration(hours*float64(time.Hour)), reason)
+				if err != nil {
+					return err
+				}
+				fmt.Println("Notifications silenced until", record.GetDateTime("expires").Time().Local().Format(time.DateTime))
+			default:
+				if silence := h.am.ActiveSilence(); silence != nil {
+					fmt.Println("Notifications silenced until", silence.GetDateTime("expires").Time().Local().Format(time.DateTime))
+				} else {
+					fmt.Println("Notifications are not silenced")
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().Float64Var(&hours, "hours", 0, "hours to silence notifications for")
+	cmd.Flags().StringVar(&reason, "reason", "", "reason for the silence (saved in the silences collection)")
+	cmd.Flags().BoolVar(&clearSilence, "clear", false, "end the active silence")
+	return cmd
+}
@@ -0,0 +1,78 @@
+package hub
+
+import (
+	"beszel/internal/entities/smart"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Syncs smart_devices records for a system and fires alerts on status changes
+func (h *Hub) updateSmartDevices(systemRecord *core.Record, smartData map[string]smart.SmartData) {
+	// agents without SMART data don't send any, so keep the last known devices
+	if len(smartData) == 0 {
+		return
+	}
+	records, err := h.app.FindAllRecords("smart_devices",
+		dbx.NewExp("system={:system}", dbx.Params{"system": systemRecord.Id}),
+	)
+	if err != nil {
+		h.logger.Error("Failed to get smart devices", "err", err.Error())
+		return
+	}
+	existing := make(map[string]*core.Record, len(records))
+	for _, record := range records {
+		existing[record.GetString("name")] = record
+	}
+	collection, err := h.app.FindCachedCollectionByNameOrId("smart_devices")
+	if err != nil {
+		h.logger.Error("Failed to get smart_devices collection", "err", err.Error())
+		return
+	}
+	for name, data := range smartData {
+		record, ok := existing[name]
+		if ok {
+			delete(existing, name)
+		} else {
+			record = core.NewRecord(collection)
+			record.Set("system", systemRecord.Id)
+			record.Set("name", name)
+		}
+		oldState := record.GetString("state")
+		record.Set("type", data.DiskType)
+		record.Set("model", data.ModelName)
+		record.Set("serial", data.SerialNumber)
+		record.Set("firmware", data.FirmwareVersion)
+		record.Set("capacity", data.Capacity)
+		record.Set("state", data.SmartStatus)
+		record.Set("temp", data.Temperature)
+		record.Set("hours", data.PowerOnHours)
+		record.Set("cycles", data.PowerCycles)
+		record.Set("reallocated", data.ReallocatedSectors)
+		record.Set("media_errors", data.MediaErrors)
+		record.Set("mounts", data.Mounts)
+		if err := h.app.SaveNoValidate(record); err != nil {
+			h.logger.Error("Failed to save smart device", "err", err.Error())
+			continue
+		}
+		if oldState != data.SmartStatus && (oldState == smart.StatusFailed || data.SmartStatus == smart.StatusFailed) {
+			if err := h.am.HandleSmartAlerts(systemRecord, name, data.Mounts, data.SmartStatus); err != nil {
+				h.logger.Error("SMART alerts error", "err", err.Error())
+			}
+		}
+	}
+	// delete devices no longer reported by the agent, resolving their alert if they failed
+	for name, record := range existing {
+		if err := h.app.Delete(record); err != nil {
+			h.logger.Error("Failed to delete smart device", "err", err.Error())
+			continue
+		}
+		if record.GetString("state") == smart.StatusFailed {
+			var mounts []string
+			record.UnmarshalJSONField("mounts", &mounts)
+			if err := h.am.HandleSmartAlerts(systemRecord, name, mounts, smart.StatusUnknown); err != nil {
+				h.logger.Error("SMART alerts error", "err", err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// How long snapshots are kept. The latest snapshot of each system is always kept.
+const snapshotRetention = 180 * 24 * time.Hour
+
+// Hardware, OS and container configuration of a system. A snapshot is saved
+// each time the configuration changes.
+type systemSnapshot struct {
+	Hostname     string             `json:"hostname"`
+	Kernel       string             `json:"kernel,omitempty"`
+	CpuModel     string             `json:"cpu_model"`
+	Cores        int                `json:"cores"`
+	Threads      int                `json:"threads,omitempty"`
+	AgentVersion string             `json:"agent_version"`
+	Podman       bool               `json:"podman,omitempty"`
+	Memory       float64            `json:"memory"`                // GB
+	Swap         float64            `json:"swap,omitempty"`        // GB
+	Disk         float64            `json:"disk"`                  // GB
+	Filesystems  map[string]float64 `json:"filesystems,omitempty"` // name -> size (GB)
+	GPUs         map[string]float64 `json:"gpus,omitempty"`        // name -> memory (GB)
+	Containers   []string           `json:"containers,omitempty"`
+}
+
+// Change of one value between two snapshots
+type snapshotChange struct {
+	Key    string `json:"key"`
+	Before string `json:"before,omitempty"` // empty if added
+	After  string `json:"after,omitempty"`  // empty if removed
+}
+
+// Creates a snapshot from the data of an agent. Sizes are rounded so small
+// fluctuations aren't mistaken for changes.
+func newSystemSnapshot(data *system.CombinedData) systemSnapshot {
+	roundGB := func(v float64) float64 { return math.Round(v*10) / 10 }
+	snapshot := systemSnapshot{
+		Hostname:     data.Info.Hostname,
+		Kernel:       data.Info.KernelVersion,
+		CpuModel:     data.Info.CpuModel,
+		Cores:        data.Info.Cores,
+		Threads:      data.Info.Threads,
+		AgentVersion: data.Info.AgentVersion,
+		Podman:       data.Info.Podman,
+		Memory:       roundGB(data.Stats.Mem),
+		Swap:         roundGB(data.Stats.Swap),
+		Disk:         roundGB(data.Stats.DiskTotal),
+	}
+	for name, fs := range data.Stats.ExtraFs {
+		if snapshot.Filesystems == nil {
+			snapshot.Filesystems = make(map[string]float64, len(data.Stats.ExtraFs))
+		}
+		snapshot.Filesystems[name] = roundGB(fs.DiskTotal)
+	}
+	for _, gpu := range data.Stats.GPUData {
+		if snapshot.GPUs == nil {
+			snapshot.GPUs = make(map[string]float64, len(data.Stats.GPUData))
+		}
+		snapshot.GPUs[gpu.Name] = roundGB(gpu.MemoryTotal / 1000)
+	}
+	for _, container := range data.Containers {
+		snapshot.Containers = append(snapshot.Containers, container.Name)
+	}
+	slices.Sort(snapshot.Containers)
+	return snapshot
+}
+
+// Flattens a snapshot into keys and values so snapshots can be compared
+func (s systemSnapshot) values() map[string]string {
+	values := map[string]string{
+		"hostname":      s.Hostname,
+		"kernel":        s.Kernel,
+		"cpu_model":     s.CpuModel,
+		"cores":         strconv.Itoa(s.Cores),
+		"threads":       strconv.Itoa(s.Threads),
+		"agent_version": s.AgentVersion,
+		"podman":        strconv.FormatBool(s.Podman),
+		"memory":        formatGB(s.Memory),
+		"swap":          formatGB(s.Swap),
+		"disk":          formatGB(s.Disk),
+	}
+	for name, size := range s.Filesystems {
+		values["filesystems."+name] = formatGB(size)
+	}
+	for name, size := range s.GPUs {
+		values["gpus."+name] = formatGB(size)
+	}
+	for _, name := range s.Containers {
+		values["containers."+name] = "present"
+	}
+	return values
+}
+
+func formatGB(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64) + " GB"
+}
+
+// Returns the values that differ between two snapshots, sorted by key
+func diffSnapshots(before, after systemSnapshot) []snapshotChange {
+	beforeValues, afterValues := before.values(), after.values()
+	keys := slices.Sorted(maps.Keys(beforeValues))
+	for key := range afterValues {
+		if _, ok := beforeValues[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	changes := []snapshotChange{}
+	for _, key := range keys {
+		if beforeValues[key] != afterValues[key] {
+			changes = append(changes, snapshotChange{Key: key, Before: beforeValues[key], After: afterValues[key]})
+		}
+	}
+	return changes
+}
+
+// Saves a snapshot of a system if its configuration changed since the last snapshot
+func (h *Hub) saveSystemSnapshot(record *core.Record, data *system.CombinedData) {
+	snapshot := newSystemSnapshot(data)
+	encoded, err := json.Marshal(snapshot)
+	if err != nil {
+		return
+	}
+	last, ok := h.lastSnapshots.Load(record.Id)
+	if !ok {
+		// compare with the saved snapshot after restarts
+		var saved systemSnapshot
+		if latest, err := h.findSnapshot(record.Id, time.Now()); err == nil && latest.UnmarshalJSONField("data", &saved) == nil {
+			last, _ = json.Marshal(saved)
+		}
+	}
+	if last, ok := last.([]byte); ok && string(last) == string(encoded) {
+		h.lastSnapshots.Store(record.Id, encoded)
+		return
+	}
+	collection, err := h.app.FindCachedCollectionByNameOrId("system_snapshots")
+	if err != nil {
+		return
+	}
+	snapshotRecord := core.NewRecord(collection)
+	snapshotRecord.Set("system", record.Id)
+	snapshotRecord.Set("data", types.JSONRaw(encoded))
+	if err := h.app.SaveNoValidate(snapshotRecord); err != nil {
+		h.logger.Error("Failed to save system snapshot", "err", err.Error())
+		return
+	}
+	h.lastSnapshots.Store(record.Id, encoded)
+}
+
+// Returns the latest snapshot of a system taken at or before a time
+func (h *Hub) findSnapshot(systemId string, before time.Time) (*core.Record, error) {
+	records, err := h.app.FindRecordsByFilter(
+		"system_snapshots",
+		"system = {:system} && created <= {:before}",
+		"-created",
+		1,
+		0,
+		dbx.Params{"system": systemId, "before": before.UTC().Format(types.DefaultDateLayout)},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no snapshot before %s", before.UTC().Format(time.RFC3339))
+	}
+	return records[0], nil
+}
+
+// Deletes snapshots older than the retention, keeping the latest of each system
+func (h *Hub) deleteOldSystemSnapshots() {
+	before := time.Now().UTC().Add(-snapshotRetention).Format(types.DefaultDateLayout)
+	_, err := h.app.DB().NewQuery(`DELETE FROM system_snapshots WHERE created < {:before} AND id NOT IN (
+		SELECT id FROM system_snapshots s WHERE s.created = (SELECT MAX(created) FROM system_snapshots WHERE system = s.system)
+	)`).Bind(dbx.Params{"before": before}).Execute()
+	if err != nil {
+		h.logger.Error("Failed to delete old system snapshots", "err", err.Error())
+	}
+}
+
+// API endpoint that compares a system's configuration at two times. `from` and
+// `to` are RFC 3339 times or unix seconds, and `to` defaults to now.
+func (h *Hub) diffSystemSnapshots(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+	record, err := h.getAuthorizedSystem(e, query.Get("system"))
+	if err != nil {
+		return err
+	}
+	from, err := parseExportTime(query.Get("from"))
+	if err != nil {
+		return apis.NewBadRequestError("Invalid from time", nil)
+	}
+	to := time.Now()
+	if value := query.Get("to"); value != "" {
+		if to, err = parseExportTime(value); err != nil {
+			return apis.NewBadRequestError("Invalid to time", nil)
+		}
+	}
+	if !from.Before(to) {
+		return apis.NewBadRequestError("from must be before to", nil)
+	}
+
+	type snapshotResponse struct {
+		Time     types.DateTime `json:"time"`
+		Snapshot systemSnapshot `json:"snapshot"`
+	}
+	var snapshots [2]snapshotResponse
+	for i, t := range []time.Time{from, to} {
+		snapshotRecord, err := h.findSnapshot(record.Id, t)
+		if err != nil {
+			return apis.NewNotFoundError(err.Error(), nil)
+		}
+		snapshots[i].Time = snapshotRecord.GetDateTime("created")
+		if err := snapshotRecord.UnmarshalJSONField("data", &snapshots[i].Snapshot); err != nil {
+			return err
+		}
+	}
+	return e.JSON(http.StatusOK, map[string]any{
+		"from":    snapshots[0],
+		"to":      snapshots[1],
+		"changes": diffSnapshots(snapshots[0].Snapshot, snapshots[1].Snapshot),
+	})
+}
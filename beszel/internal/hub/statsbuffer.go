@@ -0,0 +1,119 @@
+package hub
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// Max records saved in one transaction, so other writes aren't blocked for long
+	statsBatchSize = 500
+	// Max records buffered before updates wait for them to be saved
+	statsBufferLimit = 5000
+)
+
+// statsBuffer collects new system_stats and container_stats records and saves
+// them in batches, so large fleets don't write to the database once per record
+type statsBuffer struct {
+	app        core.App
+	logger     *slog.Logger
+	mutex      sync.Mutex
+	records    []*core.Record
+	flushMutex sync.Mutex
+	// counters reported by the health check
+	written   atomic.Uint64
+	failed    atomic.Uint64
+	waits     atomic.Uint64
+	lastBatch atomic.Int64
+	lastFlush atomic.Int64
+}
+
+// statsBufferStatus is the state of the stats buffer, included in /api/health responses
+type statsBufferStatus struct {
+	Pending   int     `json:"pending"`
+	Written   uint64  `json:"written"`
+	Failed    uint64  `json:"failed"`
+	Waits     uint64  `json:"waits"`      // times updates waited because the buffer was full
+	LastBatch int64   `json:"last_batch"` // records saved by the last flush
+	LastFlush float64 `json:"last_flush"` // duration of the last flush in ms
+}
+
+func newStatsBuffer(app core.App, logger *slog.Logger) *statsBuffer {
+	return &statsBuffer{app: app, logger: logger}
+}
+
+// Adds a record to be saved by the next flush. If the buffer is full, the
+// records are saved before returning, which slows down updates until the
+// database keeps up. Records without a creation time get the current time,
+// so they aren't dated by when the flush saves them.
+func (b *statsBuffer) add(record *core.Record) {
+	if record.GetDateTime("created").IsZero() {
+		record.SetRaw("created", types.NowDateTime())
+	}
+	b.mutex.Lock()
+	b.records = append(b.records, record)
+	full := len(b.records) >= statsBufferLimit
+	b.mutex.Unlock()
+	if full {
+		b.waits.Add(1)
+		b.flush()
+	}
+}
+
+// Saves the buffered records in transactions of up to statsBatchSize records
+func (b *statsBuffer) flush() {
+	b.flushMutex.Lock()
+	defer b.flushMutex.Unlock()
+	b.mutex.Lock()
+	records := b.records
+	b.records = nil
+	b.mutex.Unlock()
+	if len(records) == 0 {
+		return
+	}
+	start := time.Now()
+	for batch := range slices.Chunk(records, statsBatchSize) {
+		var saved, failed uint64
+		err := b.app.RunInTransaction(func(txApp core.App) error {
+			saved, failed = 0, 0
+			for _, record := range batch {
+				if err := txApp.SaveNoValidate(record); err != nil {
+					failed++
+					b.logger.Error("Failed to save record: ", "err", err.Error())
+					continue
+				}
+				saved++
+			}
+			return nil
+		})
+		if err != nil {
+			saved, failed = 0, uint64(len(batch))
+			b.logger.Error("Failed to save records: ", "err", err.Error())
+		}
+		b.written.Add(saved)
+		b.failed.Add(failed)
+	}
+	b.lastBatch.Store(int64(len(records)))
+	b.lastFlush.Store(time.Since(start).Microseconds())
+}
+
+// Returns the state of the buffer
+func (b *statsBuffer) status() *statsBufferStatus {
+	b.mutex.Lock()
+	pending := len(b.records)
+	b.mutex.Unlock()
+	return &statsBufferStatus{
+		Pending:   pending,
+		Written:   b.written.Load(),
+		Failed:    b.failed.Load(),
+		Waits:     b.waits.Load(),
+		LastBatch: b.lastBatch.Load(),
+		LastFlush: float64(b.lastFlush.Load()) / 1000,
+	}
+}
@@ -0,0 +1,232 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"cmp"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Public status page for a subset of a user's systems
+type statusPage struct {
+	Name    string             `json:"name"`
+	Updated time.Time          `json:"updated"`
+	Systems []statusPageSystem `json:"systems"`
+}
+
+type statusPageSystem struct {
+	Name   string    `json:"name"`
+	Status string    `json:"status"`
+	Uptime uint64    `json:"uptime"`        // seconds
+	Cpu    []float64 `json:"cpu,omitempty"` // last 24 hours in 20 minute averages
+	Mem    []float64 `json:"mem,omitempty"` // last 24 hours in 20 minute averages
+}
+
+// Returns the enabled status page with the slug
+func (h *Hub) findStatusPage(slug string) (*core.Record, error) {
+	page, err := h.app.FindFirstRecordByFilter("status_pages", "slug={:slug} && enabled=true", dbx.Params{"slug": slug})
+	if err != nil {
+		return nil, apis.NewNotFoundError("Status page not found", nil)
+	}
+	return page, nil
+}
+
+// Builds a status page, skipping systems its owner no longer has access to
+func (h *Hub) buildStatusPage(page *core.Record) (*statusPage, error) {
+	systems, err := h.app.FindRecordsByIds("systems", page.GetStringSlice("systems"))
+	if err != nil {
+		return nil, err
+	}
+	result := &statusPage{
+		Name:    page.GetString("name"),
+		Updated: time.Now().UTC(),
+		Systems: make([]statusPageSystem, 0, len(systems)),
+	}
+	owner := page.GetString("user")
+	for _, record := range systems {
+		if !slices.Contains(record.GetStringSlice("users"), owner) {
+			continue
+		}
+		var info system.Info
+		record.UnmarshalJSONField("info", &info)
+		s := statusPageSystem{
+			Name:   record.GetString("name"),
+			Status: record.GetString("status"),
+		}
+		if s.Status == "up" {
+			s.Uptime = info.Uptime
+		}
+		if page.GetBool("charts") {
+			s.Cpu, s.Mem = h.statusPageSparklines(record.Id)
+		}
+		result.Systems = append(result.Systems, s)
+	}
+	slices.SortFunc(result.Systems, func(a, b statusPageSystem) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return result, nil
+}
+
+// Returns cpu and memory usage of the last 24 hours, skipping records where they're missing
+func (h *Hub) statusPageSparklines(systemId string) (cpu, mem []float64) {
+	var rows []struct {
+		Stats types.JSONRaw `db:"stats"`
+	}
+	h.app.DB().
+		Select("stats").
+		From("system_stats").
+		Where(dbx.NewExp("system={:system} AND type='20m' AND created > {:created}", dbx.Params{
+			"system":  systemId,
+			"created": time.Now().UTC().Add(-24 * time.Hour).Format(types.DefaultDateLayout),
+		})).
+		OrderBy("created").
+		All(&rows)
+	for _, row := range rows {
+		var stats system.Stats
+		if err := json.Unmarshal(row.Stats, &stats); err != nil {
+			continue
+		}
+		if !stats.IsMissing(system.StatsCpu) {
+			cpu = append(cpu, stats.Cpu)
+		}
+		if !stats.IsMissing(system.StatsMem) {
+			mem = append(mem, stats.MemPct)
+		}
+	}
+	return cpu, mem
+}
+
+// Public API endpoint that returns a status page as JSON
+func (h *Hub) getStatusPage(e *core.RequestEvent) error {
+	page, err := h.findStatusPage(e.Request.PathValue("slug"))
+	if err != nil {
+		return err
+	}
+	data, err := h.buildStatusPage(page)
+	if err != nil {
+		return err
+	}
+	e.Response.Header().Set("Cache-Control", "public, max-age=30")
+	return e.JSON(http.StatusOK, data)
+}
+
+// Public endpoint that renders a status page as HTML
+func (h *Hub) serveStatusPage(e *core.RequestEvent) error {
+	page, err := h.findStatusPage(e.Request.PathValue("slug"))
+	if err != nil {
+		return e.String(http.StatusNotFound, "Status page not found")
+	}
+	data, err := h.buildStatusPage(page)
+	if err != nil {
+		return err
+	}
+	e.Response.Header().Set("Content-Type", "text/html; charset=utf-8")
+	e.Response.Header().Set("Cache-Control", "public, max-age=30")
+	e.Response.WriteHeader(http.StatusOK)
+	return statusPageTemplate.Execute(e.Response, data)
+}
+
+// API endpoint that replaces the slug of a status page, invalidating the old url
+func (h *Hub) rotateStatusPage(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") == "readonly" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	var req struct {
+		Id string `json:"id"`
+	}
+	if err := e.BindBody(&req); err != nil {
+		return apis.NewBadRequestError("Invalid request", err)
+	}
+	page, err := h.app.FindRecordById("status_pages", req.Id)
+	if err != nil || page.GetString("user") != info.Auth.Id {
+		return apis.NewNotFoundError("Status page not found", nil)
+	}
+	page.Set("slug", security.RandomStringWithAlphabet(20, "abcdefghijklmnopqrstuvwxyz0123456789"))
+	if err := h.app.Save(page); err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, map[string]string{"slug": page.GetString("slug")})
+}
+
+// Returns svg polyline points for values from 0 to 100 in a 100x24 viewbox
+func sparklinePoints(values []float64) string {
+	if len(values) < 2 {
+		return ""
+	}
+	var sb strings.Builder
+	step := 100 / float64(len(values)-1)
+	for i, v := range values {
+		fmt.Fprintf(&sb, "%.1f,%.1f ", float64(i)*step, 24-min(max(v, 0), 100)*0.24)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// Formats uptime in seconds as days or hours
+func formatUptime(seconds uint64) string {
+	if seconds < 172800 {
+		return fmt.Sprintf("%d hours", seconds/3600)
+	}
+	return fmt.Sprintf("%d days", seconds/86400)
+}
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"sparkline": sparklinePoints,
+	"uptime":    formatUptime,
+	"last": func(values []float64) float64 {
+		return values[len(values)-1]
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="60">
+<title>{{.Name}}</title>
+<style>
+body{font-family:system-ui,sans-serif;background:#f8fafc;color:#0f172a;margin:0;padding:2rem 1rem}
+main{max-width:48rem;margin:0 auto}
+h1{font-size:1.5rem;margin:0 0 1.5rem}
+ul{list-style:none;padding:0;margin:0;border:1px solid #e2e8f0;border-radius:.5rem;background:#fff}
+li{display:flex;flex-wrap:wrap;align-items:center;gap:1rem;padding:1rem;border-top:1px solid #e2e8f0}
+li:first-child{border-top:0}
+.dot{width:.7rem;height:.7rem;border-radius:50%;background:#94a3b8}
+.up .dot{background:#22c55e}.down .dot{background:#ef4444}.paused .dot{background:#eab308}
+.name{font-weight:600;flex:1}
+.meta{color:#64748b;font-size:.875rem}
+.chart{display:flex;align-items:center;gap:.4rem;font-size:.75rem;color:#64748b}
+svg{width:6rem;height:1.5rem}
+polyline{fill:none;stroke:#3b82f6;stroke-width:1.5;vector-effect:non-scaling-stroke}
+footer{margin-top:1rem;font-size:.75rem;color:#94a3b8}
+@media (prefers-color-scheme:dark){body{background:#020617;color:#f1f5f9}ul{background:#0f172a;border-color:#1e293b}li{border-color:#1e293b}}
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Name}}</h1>
+<ul>
+{{range .Systems}}<li class="{{.Status}}">
+<span class="dot"></span>
+<span class="name">{{.Name}}</span>
+{{if .Cpu}}<span class="chart">CPU <svg viewBox="0 0 100 24" preserveAspectRatio="none"><polyline points="{{sparkline .Cpu}}"/></svg> {{printf "%.0f" (last .Cpu)}}%</span>{{end}}
+{{if .Mem}}<span class="chart">Memory <svg viewBox="0 0 100 24" preserveAspectRatio="none"><polyline points="{{sparkline .Mem}}"/></svg> {{printf "%.0f" (last .Mem)}}%</span>{{end}}
+<span class="meta">{{if .Uptime}}Up {{uptime .Uptime}}{{else}}{{.Status}}{{end}}</span>
+</li>
+{{else}}<li>No systems</li>
+{{end}}</ul>
+<footer>Updated {{.Updated.Format "2006-01-02 15:04 UTC"}}</footer>
+</main>
+</body>
+</html>
+`))
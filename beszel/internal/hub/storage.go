@@ -0,0 +1,194 @@
+package hub
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Number of top space consumers returned by the storage endpoint
+const storageTopCount = 10
+
+// Database size broken down by collection and by system
+type storageUsage struct {
+	Size        int64             `json:"size"` // bytes of the database, without logs
+	Free        int64             `json:"free"` // bytes of unused pages, reclaimed by vacuuming
+	Collections []collectionUsage `json:"collections"`
+	Systems     []systemUsage     `json:"systems"`
+	Top         []storageConsumer `json:"top"`
+}
+
+type collectionUsage struct {
+	Name       string `json:"name"`
+	Rows       int64  `json:"rows"`
+	Bytes      int64  `json:"bytes"`       // pages of the table
+	IndexBytes int64  `json:"index_bytes"` // pages of its indexes
+}
+
+// Records of a system in all collections with a system relation. Bytes are
+// estimated from the size of the stored values, as pages are shared by systems.
+type systemUsage struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Rows  int64  `json:"rows"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Records of a system in a collection, by record type for stats
+type storageConsumer struct {
+	System     string `json:"system"`
+	Collection string `json:"collection"`
+	Type       string `json:"type,omitempty"`
+	Rows       int64  `json:"rows"`
+	Bytes      int64  `json:"bytes"`
+}
+
+// API endpoint that reports the database size by collection and by system, and
+// the systems and record types that use the most space, so admins can see what
+// drives growth before changing retention. Pages are counted with dbstat,
+// which reads the whole database, so the request can take a while.
+func (h *Hub) getStorageUsage(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	usage, err := h.storageUsage()
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, usage)
+}
+
+func (h *Hub) storageUsage() (*storageUsage, error) {
+	db := h.app.DB()
+	usage := &storageUsage{Systems: []systemUsage{}, Top: []storageConsumer{}}
+	var pragma struct {
+		Value int64 `db:"value"`
+	}
+	if err := db.NewQuery("SELECT page_count * page_size AS value FROM pragma_page_count(), pragma_page_size()").One(&pragma); err != nil {
+		return nil, err
+	}
+	usage.Size = pragma.Value
+	if err := db.NewQuery("SELECT freelist_count * page_size AS value FROM pragma_freelist_count(), pragma_page_size()").One(&pragma); err != nil {
+		return nil, err
+	}
+	usage.Free = pragma.Value
+
+	// bytes of each table and index, with indexes added to their table
+	var pages []struct {
+		Name  string `db:"name"`
+		Table string `db:"tbl_name"`
+		Bytes int64  `db:"bytes"`
+	}
+	err := db.NewQuery(`SELECT d.name, ifnull(m.tbl_name, d.name) AS tbl_name, d.pgsize AS bytes
+		FROM dbstat AS d LEFT JOIN sqlite_master AS m ON m.name = d.name
+		WHERE d.aggregate = TRUE`).All(&pages)
+	if err != nil {
+		return nil, err
+	}
+	tableBytes := make(map[string]int64)
+	indexBytes := make(map[string]int64)
+	for _, page := range pages {
+		if page.Name == page.Table {
+			tableBytes[page.Table] += page.Bytes
+		} else {
+			indexBytes[page.Table] += page.Bytes
+		}
+	}
+
+	collections, err := h.app.FindAllCollections(core.CollectionTypeBase, core.CollectionTypeAuth)
+	if err != nil {
+		return nil, err
+	}
+	systemNames := make(map[string]string)
+	if systems, err := h.app.FindAllRecords("systems"); err == nil {
+		for _, system := range systems {
+			systemNames[system.Id] = system.GetString("name")
+		}
+	}
+	bySystem := make(map[string]*systemUsage)
+	for _, collection := range collections {
+		var count struct {
+			Rows int64 `db:"rows"`
+		}
+		if err := db.NewQuery("SELECT COUNT(*) AS rows FROM {{" + collection.Name + "}}").One(&count); err != nil {
+			return nil, err
+		}
+		usage.Collections = append(usage.Collections, collectionUsage{
+			Name:       collection.Name,
+			Rows:       count.Rows,
+			Bytes:      tableBytes[collection.Name],
+			IndexBytes: indexBytes[collection.Name],
+		})
+		consumers, err := h.systemConsumers(collection)
+		if err != nil {
+			return nil, err
+		}
+		for _, consumer := range consumers {
+			system, ok := bySystem[consumer.System]
+			if !ok {
+				system = &systemUsage{Id: consumer.System, Name: systemNames[consumer.System]}
+				bySystem[consumer.System] = system
+			}
+			system.Rows += consumer.Rows
+			system.Bytes += consumer.Bytes
+			usage.Top = append(usage.Top, consumer)
+		}
+	}
+
+	slices.SortFunc(usage.Collections, func(a, b collectionUsage) int {
+		return cmp.Or(cmp.Compare(b.Bytes+b.IndexBytes, a.Bytes+a.IndexBytes), strings.Compare(a.Name, b.Name))
+	})
+	for _, system := range bySystem {
+		usage.Systems = append(usage.Systems, *system)
+	}
+	slices.SortFunc(usage.Systems, func(a, b systemUsage) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), strings.Compare(a.Name, b.Name))
+	})
+	slices.SortFunc(usage.Top, func(a, b storageConsumer) int {
+		return cmp.Compare(b.Bytes, a.Bytes)
+	})
+	for i := range usage.Top {
+		usage.Top[i].System = cmp.Or(systemNames[usage.Top[i].System], usage.Top[i].System)
+	}
+	usage.Top = usage.Top[:min(len(usage.Top), storageTopCount)]
+	return usage, nil
+}
+
+// Returns the rows and estimated bytes of each system in a collection with a
+// system relation, by record type if the collection has one
+func (h *Hub) systemConsumers(collection *core.Collection) ([]storageConsumer, error) {
+	relation, ok := collection.Fields.GetByName("system").(*core.RelationField)
+	if !ok || relation.CollectionId != systemsCollectionId(h.app) {
+		return nil, nil
+	}
+	lengths := make([]string, 0, len(collection.Fields))
+	for _, field := range collection.Fields {
+		lengths = append(lengths, "ifnull(length([["+field.GetName()+"]]), 0)")
+	}
+	typeColumn := "''"
+	if collection.Fields.GetByName("type") != nil {
+		typeColumn = "[[type]]"
+	}
+	var consumers []storageConsumer
+	err := h.app.DB().NewQuery(`SELECT [[system]] AS system, ` + typeColumn + ` AS type,
+		COUNT(*) AS rows, SUM(` + strings.Join(lengths, " + ") + `) AS bytes
+		FROM {{` + collection.Name + `}} GROUP BY 1, 2`).All(&consumers)
+	for i := range consumers {
+		consumers[i].Collection = collection.Name
+	}
+	return consumers, err
+}
+
+// Returns the id of the systems collection
+func systemsCollectionId(app core.App) string {
+	collection, err := app.FindCachedCollectionByNameOrId("systems")
+	if err != nil {
+		return ""
+	}
+	return collection.Id
+}
@@ -0,0 +1,67 @@
+package hub
+
+import (
+	"beszel/internal/entities/systemd"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Syncs systemd_services records for a system and fires alerts when a service enters or leaves the failed state
+func (h *Hub) updateSystemdServices(systemRecord *core.Record, services []*systemd.Service) {
+	if services == nil {
+		return
+	}
+	records, err := h.app.FindAllRecords("systemd_services",
+		dbx.NewExp("system={:system}", dbx.Params{"system": systemRecord.Id}),
+	)
+	if err != nil {
+		h.logger.Error("Failed to get systemd services", "err", err.Error())
+		return
+	}
+	existing := make(map[string]*core.Record, len(records))
+	for _, record := range records {
+		existing[record.GetString("name")] = record
+	}
+	collection, err := h.app.FindCachedCollectionByNameOrId("systemd_services")
+	if err != nil {
+		h.logger.Error("Failed to get systemd_services collection", "err", err.Error())
+		return
+	}
+	for _, service := range services {
+		record, ok := existing[service.Name]
+		if ok {
+			delete(existing, service.Name)
+		} else {
+			record = core.NewRecord(collection)
+			record.Set("system", systemRecord.Id)
+			record.Set("name", service.Name)
+		}
+		oldState := record.GetString("state")
+		record.Set("state", service.State)
+		record.Set("sub", service.Sub)
+		record.Set("cpu", service.Cpu)
+		record.Set("mem", service.Mem)
+		if err := h.app.SaveNoValidate(record); err != nil {
+			h.logger.Error("Failed to save systemd service", "err", err.Error())
+			continue
+		}
+		if oldState != service.State && (oldState == "failed" || service.State == "failed") {
+			if err := h.am.HandleServiceAlerts(systemRecord, service.Name, service.State); err != nil {
+				h.logger.Error("Service alerts error", "err", err.Error())
+			}
+		}
+	}
+	// delete services no longer reported by the agent, resolving their alert if they failed
+	for name, record := range existing {
+		if err := h.app.Delete(record); err != nil {
+			h.logger.Error("Failed to delete systemd service", "err", err.Error())
+			continue
+		}
+		if record.GetString("state") == "failed" {
+			if err := h.am.HandleServiceAlerts(systemRecord, name, ""); err != nil {
+				h.logger.Error("Service alerts error", "err", err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Validity of certificates issued by the hub. Agents renew after two thirds of it has passed.
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	certValidity = 90 * 24 * time.Hour
+)
+
+// certAuthority issues certificates for agents using the https transport
+// and the client certificate the hub uses to connect to them
+type certAuthority struct {
+	cert       *x509.Certificate
+	key        *ecdsa.PrivateKey
+	certPEM    []byte
+	mutex      sync.Mutex
+	clientCert *tls.Certificate
+	clients    map[string]*http.Client // by fingerprint of the agent they accept
+	// dials agents, or the default dialer if nil
+	dialContext func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Loads the CA from the data directory, creating it if it doesn't exist
+func (h *Hub) loadCertAuthority() (*certAuthority, error) {
+	certPath := filepath.Join(h.app.DataDir(), "ca.crt")
+	keyPath := filepath.Join(h.app.DataDir(), "ca.key")
+
+	certPEM, certErr := os.ReadFile(certPath)
+	keyPEM, keyErr := os.ReadFile(keyPath)
+	if certErr != nil || keyErr != nil {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		template := &x509.Certificate{
+			SerialNumber:          newSerialNumber(),
+			Subject:               pkix.Name{CommonName: "Beszel Hub CA"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(caValidity),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			return nil, err
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+		if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+			return nil, err
+		}
+		h.logger.Info("Certificate authority generated", "cert", certPath)
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, errors.New("invalid CA files")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &certAuthority{cert: cert, key: key, certPEM: certPEM}, nil
+}
+
+func newSerialNumber() *big.Int {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return serial
+}
+
+// Signs a certificate for the public key and returns it in PEM format.
+// Server certificates are used by agents and client certificates by the hub.
+func (ca *certAuthority) issue(template *x509.Certificate, pub any, server bool) ([]byte, error) {
+	template.SerialNumber = newSerialNumber()
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(certValidity)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	if server {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, pub, ca.key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// Returns the URI in agent certificates that ties them to the fingerprint of their system
+func agentCertURI(fingerprint string) *url.URL {
+	return &url.URL{Scheme: "beszel", Host: "agent", Path: "/" + fingerprint}
+}
+
+// Returns an http client that authenticates with a hub client certificate and
+// only accepts the agent with the fingerprint, verified against the CA. Each
+// agent gets its own client so connections aren't shared between systems.
+// The certificate is rotated before it expires.
+func (ca *certAuthority) client(fingerprint string) (*http.Client, error) {
+	if fingerprint == "" {
+		return nil, errors.New("system has no fingerprint")
+	}
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+	if ca.clientCert == nil || time.Until(ca.clientCert.Leaf.NotAfter) <= certValidity/3 {
+		if err := ca.rotateClientCert(); err != nil {
+			return nil, err
+		}
+	}
+	if client, ok := ca.clients[fingerprint]; ok {
+		return client, nil
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	expectedURI := agentCertURI(fingerprint).String()
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:     ca.dialContext,
+			IdleConnTimeout: 90 * time.Second,
+			TLSClientConfig: &tls.Config{
+				Certificates: []tls.Certificate{*ca.clientCert},
+				// agents are addressed by the host saved in the system record, which may
+				// not match the names in their certificate, so they're verified by the
+				// chain and the fingerprint of their system
+				InsecureSkipVerify: true,
+				VerifyConnection: func(cs tls.ConnectionState) error {
+					if len(cs.PeerCertificates) == 0 {
+						return errors.New("no agent certificate")
+					}
+					leaf := cs.PeerCertificates[0]
+					if _, err := leaf.Verify(x509.VerifyOptions{
+						Roots:     roots,
+						KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+					}); err != nil {
+						return err
+					}
+					if len(leaf.URIs) != 1 || leaf.URIs[0].String() != expectedURI {
+						return errors.New("agent certificate was issued for another system")
+					}
+					return nil
+				},
+			},
+		},
+	}
+	ca.clients[fingerprint] = client
+	return client, nil
+}
+
+// Issues a new hub client certificate and drops the clients using the previous one
+func (ca *certAuthority) rotateClientCert() error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	certPEM, err := ca.issue(&x509.Certificate{Subject: pkix.Name{CommonName: "beszel-hub"}}, &key.PublicKey, false)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	if err != nil {
+		return err
+	}
+	for _, client := range ca.clients {
+		client.CloseIdleConnections()
+	}
+	ca.clientCert = &cert
+	ca.clients = make(map[string]*http.Client)
+	return nil
+}
+
+// Returns the http client for requests to a system using the https transport
+func (h *Hub) httpsAgentClient(record *core.Record) (*http.Client, error) {
+	if h.ca == nil {
+		return nil, errors.New("certificate authority not loaded")
+	}
+	return h.ca.client(record.GetString("fingerprint"))
+}
+
+// API endpoint that signs an agent's certificate request using the ENROLLMENT_TOKEN.
+// Agents call this on first start and again to renew their certificate. Certificates
+// are only issued for https systems registered with the agent's fingerprint, which
+// they include so the hub doesn't accept them from the agents of other systems.
+// The token and fingerprint aren't enough, since the fingerprint can be derived from
+// public ids: agents prove they're the system's agent with the secret the hub issued
+// at registration, or when renewing, with their current certificate and its key.
+func (h *Hub) issueAgentCertificate(e *core.RequestEvent) error {
+	token, _ := GetEnv("ENROLLMENT_TOKEN")
+	if token == "" || h.ca == nil {
+		return apis.NewNotFoundError("Certificate issuance is disabled", nil)
+	}
+	var req struct {
+		Token       string `json:"token"`
+		CSR         string `json:"csr"`
+		Fingerprint string `json:"fingerprint"`
+		Secret      string `json:"secret"`
+		Cert        string `json:"cert"` // current certificate when renewing
+	}
+	if err := e.BindBody(&req); err != nil {
+		return apis.NewBadRequestError("Invalid request", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(token)) != 1 {
+		return apis.NewUnauthorizedError("Invalid token", nil)
+	}
+	block, _ := pem.Decode([]byte(req.CSR))
+	if block == nil {
+		return apis.NewBadRequestError("Invalid CSR", nil)
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		return apis.NewBadRequestError("Invalid CSR", err)
+	}
+	if req.Fingerprint == "" {
+		return apis.NewForbiddenError("No system is registered with this fingerprint", nil)
+	}
+	record, err := h.app.FindFirstRecordByFilter("systems", "fingerprint={:fingerprint} && transport='https'", dbx.Params{"fingerprint": req.Fingerprint})
+	if err != nil {
+		return apis.NewForbiddenError("No system is registered with this fingerprint", nil)
+	}
+	if !agentSecretMatches(record, req.Secret) {
+		if err := h.ca.verifyRenewal(req.Cert, req.Fingerprint, csr.PublicKey); err != nil {
+			h.logger.Warn("Certificate refused: agent didn't prove it's the system's agent", "system", record.GetString("name"), "ip", e.RealIP(), "err", err.Error())
+			return apis.NewForbiddenError("Certificates need the secret issued to the system's agent or its current certificate", nil)
+		}
+	}
+	certPEM, err := h.ca.issue(&x509.Certificate{
+		Subject: pkix.Name{CommonName: csr.Subject.CommonName},
+		URIs:    []*url.URL{agentCertURI(req.Fingerprint)},
+	}, csr.PublicKey, true)
+	if err != nil {
+		return err
+	}
+	h.logger.Info("Issued agent certificate", "system", record.GetString("name"), "ip", e.RealIP())
+	return e.JSON(http.StatusOK, map[string]string{"cert": string(certPEM), "ca": string(h.ca.certPEM)})
+}
+
+// Returns an error unless the certificate is a valid agent certificate issued by
+// the CA for the fingerprint, with the public key of the request. Requests are
+// signed with their key, so this proves the agent has the certificate's key.
+func (ca *certAuthority) verifyRenewal(certPEM, fingerprint string, pub crypto.PublicKey) error {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return errors.New("no current certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		return err
+	}
+	if len(cert.URIs) != 1 || cert.URIs[0].String() != agentCertURI(fingerprint).String() {
+		return errors.New("certificate was issued for another system")
+	}
+	if key, ok := pub.(interface{ Equal(crypto.PublicKey) bool }); !ok || !key.Equal(cert.PublicKey) {
+		return errors.New("request key doesn't match the certificate")
+	}
+	return nil
+}
+
+// Requests a path from an agent using the https transport and decodes the json response
+func (h *Hub) requestJsonFromAgentHTTPS(record *core.Record, path string, data any) error {
+	client, err := h.httpsAgentClient(record)
+	if err != nil {
+		return err
+	}
+	url := "https://" + net.JoinHostPort(record.GetString("host"), record.GetString("port")) + path
+	res, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("agent returned %s", res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(data)
+}
+
+// Requests stats from an agent using the https transport. No connection is kept
+// between requests, other than the keep-alive connections of the http client.
+func (h *Hub) updateSystemHTTPS(record *core.Record) {
+	start := time.Now()
+	var systemData system.CombinedData
+	var payload json.RawMessage
+	err := h.requestJsonFromAgentHTTPS(record, "/stats?interval="+systemUpdateInterval, &payload)
+	if err == nil {
+		err = json.Unmarshal(payload, &systemData)
+	}
+	h.recordRequestResult(record, nil, start, err, systemData.Info.AgentVersion)
+	if err != nil {
+		if record.GetString("status") != "down" {
+			h.logger.Error("Failed to get system stats: ", "err", err.Error(), "system", record.GetString("host"), "port", record.GetString("port"))
+			h.updateSystemStatus(record, "down")
+		}
+		return
+	}
+	h.saveSystemData(record, &systemData, payload)
+}
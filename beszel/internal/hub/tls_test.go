@@ -0,0 +1,156 @@
+package hub
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns a CA with a new key, like the one the hub creates in its data dir
+func newTestCA(t *testing.T) *certAuthority {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          newSerialNumber(),
+		Subject:               pkix.Name{CommonName: "Beszel Hub CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &certAuthority{cert: cert, key: key, certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// Issues an agent certificate for the fingerprint and key
+func issueTestAgentCert(t *testing.T, ca *certAuthority, fingerprint string, pub crypto.PublicKey, server bool) string {
+	t.Helper()
+	certPEM, err := ca.issue(&x509.Certificate{
+		Subject: pkix.Name{CommonName: "agent"},
+		URIs:    []*url.URL{agentCertURI(fingerprint)},
+	}, pub, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(certPEM)
+}
+
+func TestVerifyRenewal(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	key := newTestKey(t)
+	otherKey := newTestKey(t)
+
+	expired := func() string {
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: newSerialNumber(),
+			NotBefore:    time.Now().Add(-2 * time.Hour),
+			NotAfter:     time.Now().Add(-time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			URIs:         []*url.URL{agentCertURI("fp")},
+		}, ca.cert, &key.PublicKey, ca.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+
+	tests := []struct {
+		name        string
+		cert        string
+		fingerprint string
+		pub         crypto.PublicKey
+		wantErr     string
+	}{
+		{
+			name:        "current certificate",
+			cert:        issueTestAgentCert(t, ca, "fp", &key.PublicKey, true),
+			fingerprint: "fp",
+			pub:         &key.PublicKey,
+		},
+		{
+			name:        "no certificate",
+			fingerprint: "fp",
+			pub:         &key.PublicKey,
+			wantErr:     "no current certificate",
+		},
+		{
+			name:        "certificate of another system",
+			cert:        issueTestAgentCert(t, ca, "other", &key.PublicKey, true),
+			fingerprint: "fp",
+			pub:         &key.PublicKey,
+			wantErr:     "another system",
+		},
+		{
+			name:        "request with another key",
+			cert:        issueTestAgentCert(t, ca, "fp", &key.PublicKey, true),
+			fingerprint: "fp",
+			pub:         &otherKey.PublicKey,
+			wantErr:     "doesn't match",
+		},
+		{
+			name:        "certificate from another CA",
+			cert:        issueTestAgentCert(t, otherCA, "fp", &key.PublicKey, true),
+			fingerprint: "fp",
+			pub:         &key.PublicKey,
+			wantErr:     "unknown authority",
+		},
+		{
+			name:        "hub client certificate",
+			cert:        issueTestAgentCert(t, ca, "fp", &key.PublicKey, false),
+			fingerprint: "fp",
+			pub:         &key.PublicKey,
+			wantErr:     "incompatible key usage",
+		},
+		{
+			name:        "expired certificate",
+			cert:        expired(),
+			fingerprint: "fp",
+			pub:         &key.PublicKey,
+			wantErr:     "expired",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ca.verifyRenewal(tt.cert, tt.fingerprint, tt.pub)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verifyRenewal() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("verifyRenewal() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package hub
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Graph of systems and their relationships for rendering a topology map
+type topologyGraph struct {
+	Nodes []topologyNode `json:"nodes"`
+	Edges []topologyEdge `json:"edges"`
+	Sites []topologySite `json:"sites"`
+}
+
+type topologyNode struct {
+	Id     string   `json:"id"`
+	Name   string   `json:"name"`
+	Host   string   `json:"host"`
+	Status string   `json:"status"`
+	Site   string   `json:"site,omitempty"`
+	Tags   []string `json:"tags"`
+}
+
+// Directed edge from a system to a system it depends on
+type topologyEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+}
+
+// Group of systems in the same site
+type topologySite struct {
+	Name    string   `json:"name"`
+	Systems []string `json:"systems"`
+}
+
+// API endpoint that returns the systems the user can access as a graph
+func (h *Hub) getTopology(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	systems, err := h.app.FindRecordsByFilter("systems", "users.id ?= {:user}", "name", 0, 0, dbx.Params{"user": info.Auth.Id})
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, buildTopology(systems))
+}
+
+func buildTopology(systems []*core.Record) topologyGraph {
+	graph := topologyGraph{
+		Nodes: make([]topologyNode, 0, len(systems)),
+		Edges: []topologyEdge{},
+		Sites: []topologySite{},
+	}
+	visible := make(map[string]bool, len(systems))
+	for _, system := range systems {
+		visible[system.Id] = true
+	}
+	sites := make(map[string]int)
+	for _, system := range systems {
+		node := topologyNode{
+			Id:     system.Id,
+			Name:   system.GetString("name"),
+			Host:   system.GetString("host"),
+			Status: system.GetString("status"),
+			Site:   system.GetString("site"),
+			Tags:   []string{},
+		}
+		system.UnmarshalJSONField("tags", &node.Tags)
+		graph.Nodes = append(graph.Nodes, node)
+		if node.Site != "" {
+			i, ok := sites[node.Site]
+			if !ok {
+				i = len(graph.Sites)
+				sites[node.Site] = i
+				graph.Sites = append(graph.Sites, topologySite{Name: node.Site})
+			}
+			graph.Sites[i].Systems = append(graph.Sites[i].Systems, system.Id)
+		}
+		// skip dependencies on systems the user can't see
+		for _, dependency := range system.GetStringSlice("depends_on") {
+			if visible[dependency] && dependency != system.Id {
+				graph.Edges = append(graph.Edges, topologyEdge{Source: system.Id, Target: dependency, Type: "depends_on"})
+			}
+		}
+	}
+	slices.SortFunc(graph.Sites, func(a, b topologySite) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return graph
+}
@@ -0,0 +1,286 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// Time an agent has to download an update
+	agentUpdateTimeout = 5 * time.Minute
+	// Time an updated agent has to come back with the new version
+	agentRestartTimeout = 3 * time.Minute
+)
+
+// Status of a system in an agent update rollout
+const (
+	rolloutPending  = "pending"
+	rolloutUpdating = "updating"
+	rolloutUpdated  = "updated"
+	rolloutCurrent  = "current" // already up to date
+	rolloutFailed   = "failed"
+	rolloutSkipped  = "skipped" // not updated because an earlier batch failed
+)
+
+// Staged update of the agents of many systems. Systems are updated in batches,
+// and the rollout halts if any agent in a batch fails to update.
+type agentRollout struct {
+	mutex    sync.Mutex
+	Channel  string           `json:"channel"`
+	Batch    int              `json:"batch"` // percent of systems updated at a time
+	Started  time.Time        `json:"started"`
+	Finished *time.Time       `json:"finished,omitempty"`
+	Halted   bool             `json:"halted"`
+	Systems  []*rolloutSystem `json:"systems"`
+}
+
+type rolloutSystem struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	From   string `json:"from"`
+	To     string `json:"to,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Options of a rollout
+type rolloutRequest struct {
+	Systems []string `json:"systems"` // all systems that are up if empty
+	Filter  string   `json:"filter"`  // selector query the systems also have to match
+	Channel string   `json:"channel"` // stable or beta
+	Batch   int      `json:"batch"`   // percent of systems updated at a time (default 100)
+}
+
+// API endpoint that starts an agent update rollout (POST) or returns the status
+// of the current or last rollout (GET). Only available to admins.
+func (h *Hub) handleAgentUpdate(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	if e.Request.Method == http.MethodGet {
+		rollout := h.rollout.Load()
+		if rollout == nil {
+			return e.JSON(http.StatusOK, nil)
+		}
+		rollout.mutex.Lock()
+		defer rollout.mutex.Unlock()
+		return e.JSON(http.StatusOK, rollout)
+	}
+
+	var req rolloutRequest
+	if err := e.BindBody(&req); err != nil {
+		return apis.NewBadRequestError("Invalid request", err)
+	}
+	req.Channel = cmp.Or(req.Channel, "stable")
+	if req.Channel != "stable" && req.Channel != "beta" {
+		return apis.NewBadRequestError("Invalid channel", nil)
+	}
+	req.Batch = cmp.Or(req.Batch, 100)
+	if req.Batch < 1 || req.Batch > 100 {
+		return apis.NewBadRequestError("Batch must be between 1 and 100 percent", nil)
+	}
+	previous := h.rollout.Load()
+	if previous.running() {
+		return apis.NewApiError(http.StatusConflict, "An update is already in progress", nil)
+	}
+
+	var filter dbx.Expression = dbx.HashExp{"status": "up"}
+	if len(req.Systems) > 0 {
+		ids := make([]any, len(req.Systems))
+		for i, id := range req.Systems {
+			ids[i] = id
+		}
+		filter = dbx.And(filter, dbx.In("id", ids...))
+	}
+	selector, err := parseSelector(h.app, req.Filter)
+	if err != nil {
+		return apis.NewBadRequestError("Invalid filter: "+err.Error(), nil)
+	}
+	records, err := h.app.FindAllRecords("systems", filter)
+	if err != nil {
+		return err
+	}
+	records = selector.filter(records)
+	if len(records) == 0 {
+		return apis.NewBadRequestError("No matching systems are up", nil)
+	}
+	rollout := &agentRollout{
+		Channel: req.Channel,
+		Batch:   req.Batch,
+		Started: time.Now().UTC(),
+		Systems: make([]*rolloutSystem, 0, len(records)),
+	}
+	for _, record := range records {
+		var info system.Info
+		record.UnmarshalJSONField("info", &info)
+		rollout.Systems = append(rollout.Systems, &rolloutSystem{
+			Id:     record.Id,
+			Name:   record.GetString("name"),
+			From:   info.AgentVersion,
+			Status: rolloutPending,
+		})
+	}
+	if !h.rollout.CompareAndSwap(previous, rollout) {
+		return apis.NewApiError(http.StatusConflict, "An update is already in progress", nil)
+	}
+	err = e.JSON(http.StatusOK, rollout)
+	go h.runRollout(rollout)
+	return err
+}
+
+// Returns true if the rollout hasn't finished
+func (r *agentRollout) running() bool {
+	if r == nil {
+		return false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.Finished == nil
+}
+
+// Updates the systems of a rollout in batches, halting after a batch with failures
+func (h *Hub) runRollout(rollout *agentRollout) {
+	batchSize := max(len(rollout.Systems)*rollout.Batch/100, 1)
+	h.logger.Info("Starting agent update", "systems", len(rollout.Systems), "batch", batchSize, "channel", rollout.Channel)
+	for start := 0; start < len(rollout.Systems); start += batchSize {
+		batch := rollout.Systems[start:min(start+batchSize, len(rollout.Systems))]
+		var wg sync.WaitGroup
+		for _, rs := range batch {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				h.updateRolloutSystem(rollout, rs)
+			}()
+		}
+		wg.Wait()
+
+		rollout.mutex.Lock()
+		for _, rs := range batch {
+			if rs.Status == rolloutFailed {
+				rollout.Halted = true
+			}
+		}
+		if rollout.Halted {
+			for _, rs := range rollout.Systems[start+len(batch):] {
+				rs.Status = rolloutSkipped
+			}
+		}
+		rollout.mutex.Unlock()
+		if rollout.Halted {
+			h.logger.Warn("Agent update halted after failures")
+			break
+		}
+	}
+	rollout.mutex.Lock()
+	finished := time.Now().UTC()
+	rollout.Finished = &finished
+	rollout.mutex.Unlock()
+}
+
+// Updates the agent of one system and waits for it to report the new version
+func (h *Hub) updateRolloutSystem(rollout *agentRollout, rs *rolloutSystem) {
+	setStatus := func(status string, err error) {
+		rollout.mutex.Lock()
+		defer rollout.mutex.Unlock()
+		rs.Status = status
+		if err != nil {
+			rs.Error = err.Error()
+			h.logger.Error("Failed to update agent", "system", rs.Name, "err", rs.Error)
+		}
+	}
+	setStatus(rolloutUpdating, nil)
+	record, err := h.app.FindRecordById("systems", rs.Id)
+	if err != nil {
+		setStatus(rolloutFailed, err)
+		return
+	}
+	result, err := h.requestAgentUpdate(record, rollout.Channel)
+	switch {
+	case err != nil:
+	case result.Error != "":
+		err = errors.New(result.Error)
+	case result.Version == "":
+		// older agents respond to unknown commands with stats
+		err = errors.New("agent version doesn't support remote updates")
+	}
+	if err != nil {
+		setStatus(rolloutFailed, err)
+		return
+	}
+	rollout.mutex.Lock()
+	rs.To = result.Version
+	rollout.mutex.Unlock()
+	if !result.Updated {
+		setStatus(rolloutCurrent, nil)
+		return
+	}
+	if err := h.waitForAgentVersion(rs.Id, result.Version); err != nil {
+		setStatus(rolloutFailed, err)
+		return
+	}
+	setStatus(rolloutUpdated, nil)
+}
+
+// Asks an agent to update itself. The agent responds after downloading the
+// update and restarts shortly after.
+func (h *Hub) requestAgentUpdate(record *core.Record, channel string) (system.UpdateResult, error) {
+	var result system.UpdateResult
+	if record.GetString("transport") != "https" {
+		client, err := h.getSystemClient(record)
+		if err != nil {
+			return result, err
+		}
+		err = h.requestJsonFromAgent(client, "update "+channel, &result)
+		return result, err
+	}
+	client, err := h.httpsAgentClient(record)
+	if err != nil {
+		return result, err
+	}
+	// downloading the update takes longer than the client's usual timeout
+	updateClient := *client
+	updateClient.Timeout = agentUpdateTimeout
+	address := net.JoinHostPort(record.GetString("host"), record.GetString("port"))
+	res, err := updateClient.Post("https://"+address+"/update?channel="+url.QueryEscape(channel), "", nil)
+	if err != nil {
+		return result, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("agent returned %s", res.Status)
+	}
+	err = json.NewDecoder(res.Body).Decode(&result)
+	return result, err
+}
+
+// Waits until a system reports an agent version, which happens on the first
+// successful update after the agent restarts
+func (h *Hub) waitForAgentVersion(systemId, version string) error {
+	deadline := time.Now().Add(agentRestartTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(5 * time.Second)
+		record, err := h.app.FindRecordById("systems", systemId)
+		if err != nil {
+			return err
+		}
+		var info system.Info
+		record.UnmarshalJSONField("info", &info)
+		if info.AgentVersion == version && record.GetString("status") == "up" {
+			return nil
+		}
+	}
+	return fmt.Errorf("agent didn't report version %s within %s", version, agentRestartTimeout)
+}
@@ -0,0 +1,272 @@
+// Package i18n translates text generated by the hub, such as notifications.
+//
+// Translations are gettext catalogs in locales/<lang>.po, the same format as the
+// web app's translations, so they can be translated on Crowdin. Messages use
+// named placeholders like {system} and ICU plurals like
+// {minutes, plural, one {# minute} other {# minutes}}.
+package i18n
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+//go:embed locales/*.po
+var localesFS embed.FS
+
+// Message is text that is translated later, e.g. once for each recipient of a
+// notification. Args are name / value pairs for the placeholders in the text,
+// and values may be Messages themselves.
+type Message struct {
+	ID   string // source text in English
+	Args []any
+}
+
+// M returns a Message with the given source text and placeholder values
+func M(id string, args ...any) Message {
+	return Message{ID: id, Args: args}
+}
+
+// Raw returns a Message that isn't translated, for text like names
+func Raw(text string) Message {
+	return Message{ID: "{text}", Args: []any{"text", text}}
+}
+
+// IsZero reports whether the message is empty
+func (m Message) IsZero() bool {
+	return m.ID == ""
+}
+
+// String returns the message in English
+func (m Message) String() string {
+	return English.T(m)
+}
+
+// Printer translates messages into one language
+type Printer struct {
+	tag      language.Tag
+	messages map[string]string
+	numbers  *message.Printer
+}
+
+// English prints messages in their source language
+var English = &Printer{tag: language.English, numbers: message.NewPrinter(language.English)}
+
+var (
+	loadOnce sync.Once
+	tags     []language.Tag // available languages, English first
+	catalogs map[language.Tag]map[string]string
+	matcher  language.Matcher
+)
+
+// Loads the embedded catalogs. Invalid catalogs are skipped so a bad
+// translation can't break notifications.
+func load() {
+	tags = []language.Tag{language.English}
+	catalogs = map[language.Tag]map[string]string{}
+	files, _ := localesFS.ReadDir("locales")
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".po")
+		tag, err := language.Parse(name)
+		if err != nil || tag == language.English {
+			continue
+		}
+		data, err := localesFS.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			continue
+		}
+		messages, err := parsePO(data)
+		if err != nil {
+			continue
+		}
+		tags = append(tags, tag)
+		catalogs[tag] = messages
+	}
+	matcher = language.NewMatcher(tags)
+}
+
+// Languages returns the tags of the available languages
+func Languages() []string {
+	loadOnce.Do(load)
+	langs := make([]string, len(tags))
+	for i, tag := range tags {
+		langs[i] = tag.String()
+	}
+	return langs
+}
+
+// NewPrinter returns a printer for the available language closest to locale
+// (e.g. "de-AT" uses German), falling back to English.
+func NewPrinter(locale string) *Printer {
+	loadOnce.Do(load)
+	requested, err := language.Parse(locale)
+	if err != nil {
+		return English
+	}
+	_, index, confidence := matcher.Match(requested)
+	if confidence == language.No || index == 0 {
+		return English
+	}
+	tag := tags[index]
+	return &Printer{tag: tag, messages: catalogs[tag], numbers: message.NewPrinter(requested)}
+}
+
+// Language returns the language of the printer
+func (p *Printer) Language() string {
+	return p.tag.String()
+}
+
+// T returns the message translated into the printer's language, with its
+// placeholders replaced. Untranslated messages are returned in English.
+func (p *Printer) T(m Message) string {
+	if m.IsZero() {
+		return ""
+	}
+	text := m.ID
+	if translated := p.messages[m.ID]; translated != "" {
+		text = translated
+	}
+	args := make(map[string]any, len(m.Args)/2)
+	for i := 0; i+1 < len(m.Args); i += 2 {
+		if name, ok := m.Args[i].(string); ok {
+			args[name] = m.Args[i+1]
+		}
+	}
+	return p.format(text, args, "")
+}
+
+// Replaces the placeholders in text. hash is the number printed for # inside a plural.
+func (p *Printer) format(text string, args map[string]any, hash string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexAny(text, "{#")
+		if start < 0 {
+			b.WriteString(text)
+			return b.String()
+		}
+		b.WriteString(text[:start])
+		if text[start] == '#' {
+			if hash != "" {
+				b.WriteString(hash)
+			} else {
+				b.WriteByte('#')
+			}
+			text = text[start+1:]
+			continue
+		}
+		end := closingBrace(text, start)
+		if end < 0 {
+			b.WriteString(text[start:])
+			return b.String()
+		}
+		b.WriteString(p.placeholder(text[start+1:end], args))
+		text = text[end+1:]
+	}
+}
+
+// Returns the value of a placeholder, which is a name or "name, plural, ..."
+func (p *Printer) placeholder(expr string, args map[string]any) string {
+	name, rest, isFormat := strings.Cut(expr, ",")
+	name = strings.TrimSpace(name)
+	value, ok := args[name]
+	if !ok {
+		return "{" + expr + "}"
+	}
+	if kind, options, _ := strings.Cut(rest, ","); isFormat && strings.TrimSpace(kind) == "plural" {
+		return p.plural(options, value, args)
+	}
+	switch v := value.(type) {
+	case Message:
+		return p.T(v)
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return p.numbers.Sprint(v)
+	}
+}
+
+// Selects the plural option for a number, e.g. from "one {# minute} other {# minutes}".
+// Exact matches like "=0 {none}" are preferred over the language's plural forms.
+func (p *Printer) plural(options string, value any, args map[string]any) string {
+	n, ok := toInt(value)
+	if !ok {
+		return fmt.Sprint(value)
+	}
+	form := map[plural.Form]string{
+		plural.Zero: "zero", plural.One: "one", plural.Two: "two",
+		plural.Few: "few", plural.Many: "many", plural.Other: "other",
+	}[plural.Cardinal.MatchPlural(p.tag, abs(n), 0, 0, 0, 0)]
+
+	var formText, otherText string
+	for {
+		start := strings.IndexByte(options, '{')
+		if start < 0 {
+			break
+		}
+		end := closingBrace(options, start)
+		if end < 0 {
+			break
+		}
+		selector, text := strings.TrimSpace(options[:start]), options[start+1:end]
+		options = options[end+1:]
+		switch selector {
+		case fmt.Sprintf("=%d", n):
+			return p.format(text, args, p.numbers.Sprint(n))
+		case form:
+			formText = text
+		case "other":
+			otherText = text
+		}
+	}
+	if formText == "" {
+		formText = otherText
+	}
+	return p.format(formText, args, p.numbers.Sprint(n))
+}
+
+// Returns the index of the brace that closes the one at start, or -1
+func closingBrace(text string, start int) int {
+	depth := 0
+	for i := start; i < len(text); i++ {
+		switch text[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func toInt(value any) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case uint8:
+		return int(v), true
+	case float64:
+		return int(v), v == float64(int(v))
+	}
+	return 0, false
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,62 @@
+package i18n
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parses a gettext catalog into a map of msgid to msgstr. Comments, contexts,
+// the header and untranslated or fuzzy entries are skipped.
+func parsePO(data []byte) (map[string]string, error) {
+	messages := map[string]string{}
+	var msgid, msgstr *strings.Builder
+	var current *strings.Builder
+	fuzzy := false
+
+	flush := func() {
+		if msgid != nil && msgstr != nil && msgid.Len() > 0 && msgstr.Len() > 0 && !fuzzy {
+			messages[msgid.String()] = msgstr.String()
+		}
+		msgid, msgstr, current, fuzzy = nil, nil, nil, false
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "#,"):
+			fuzzy = strings.Contains(line, "fuzzy")
+		case strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "msgctxt "):
+			current = nil
+		case strings.HasPrefix(line, "msgid "):
+			if msgstr != nil {
+				flush()
+			}
+			msgid = &strings.Builder{}
+			current = msgid
+			line = strings.TrimPrefix(line, "msgid ")
+		case strings.HasPrefix(line, "msgstr "):
+			msgstr = &strings.Builder{}
+			current = msgstr
+			line = strings.TrimPrefix(line, "msgstr ")
+		case !strings.HasPrefix(line, `"`):
+			return nil, fmt.Errorf("line %d: unexpected %q", lineNum, line)
+		}
+		if current == nil || !strings.HasPrefix(line, `"`) {
+			continue
+		}
+		value, err := strconv.Unquote(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		current.WriteString(value)
+	}
+	flush()
+	return messages, scanner.Err()
+}
@@ -0,0 +1,113 @@
+// Package logging sets up structured logging for the agent and hub. The level
+// and format are read from the LOG_LEVEL and LOG_FORMAT environment variables.
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Config holds the level and output format of the logs
+type Config struct {
+	Level slog.Level
+	JSON  bool // one JSON object per line instead of key=value text
+}
+
+// ConfigFromEnv reads LOG_LEVEL (debug, info, warn, error) and LOG_FORMAT
+// (text, json) using getEnv, so each binary can apply its own env var prefix.
+// Invalid values are returned as an error along with the default for that value.
+func ConfigFromEnv(getEnv func(key string) (string, bool)) (Config, error) {
+	var config Config
+	var errs []error
+	if value, exists := getEnv("LOG_LEVEL"); exists {
+		switch strings.ToLower(value) {
+		case "debug":
+			config.Level = slog.LevelDebug
+		case "info", "":
+			config.Level = slog.LevelInfo
+		case "warn", "warning":
+			config.Level = slog.LevelWarn
+		case "error":
+			config.Level = slog.LevelError
+		default:
+			errs = append(errs, fmt.Errorf("invalid LOG_LEVEL %q", value))
+		}
+	}
+	if value, exists := getEnv("LOG_FORMAT"); exists {
+		switch strings.ToLower(value) {
+		case "json":
+			config.JSON = true
+		case "text", "":
+		default:
+			errs = append(errs, fmt.Errorf("invalid LOG_FORMAT %q", value))
+		}
+	}
+	return config, errors.Join(errs...)
+}
+
+// NewHandler creates a handler that writes logs to w
+func NewHandler(w io.Writer, config Config) slog.Handler {
+	opts := &slog.HandlerOptions{Level: config.Level}
+	if config.JSON {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// SetDefault configures the default slog logger, which the log package also
+// writes to, from the environment. Logs are written to stderr.
+func SetDefault(getEnv func(key string) (string, bool)) Config {
+	config, err := ConfigFromEnv(getEnv)
+	slog.SetDefault(slog.New(NewHandler(os.Stderr, config)))
+	if err != nil {
+		slog.Warn("Invalid logging config, using defaults", "err", err)
+	}
+	return config
+}
+
+// NewTeeHandler creates a handler that passes each record to all handlers
+func NewTeeHandler(handlers ...slog.Handler) slog.Handler {
+	return teeHandler(handlers)
+}
+
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, record.Level) {
+			errs = append(errs, h.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
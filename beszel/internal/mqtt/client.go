@@ -0,0 +1,152 @@
+// Package mqtt publishes system metrics to an MQTT broker with Home Assistant discovery.
+package mqtt
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Minimal MQTT 3.1.1 client that only supports QoS 0 publishing
+type client struct {
+	url      *url.URL
+	clientId string
+	mu       sync.Mutex
+	conn     net.Conn
+}
+
+func newClient(brokerURL, clientId string) (*client, error) {
+	parsed, err := url.Parse(brokerURL)
+	if err != nil {
+		return nil, err
+	}
+	switch parsed.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts":
+	default:
+		return nil, fmt.Errorf("invalid scheme %q", parsed.Scheme)
+	}
+	return &client{url: parsed, clientId: clientId}, nil
+}
+
+// Opens a connection and performs the CONNECT / CONNACK handshake
+func (c *client) connect() error {
+	secure := c.url.Scheme == "ssl" || c.url.Scheme == "tls" || c.url.Scheme == "mqtts"
+	port := c.url.Port()
+	if port == "" {
+		port = "1883"
+		if secure {
+			port = "8883"
+		}
+	}
+	addr := net.JoinHostPort(c.url.Hostname(), port)
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if secure {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: c.url.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	// variable header: protocol name, level 4 (3.1.1), flags, keep alive (0 = disabled)
+	flags := byte(0x02) // clean session
+	payload := appendString(nil, c.clientId)
+	if username := c.url.User.Username(); username != "" {
+		flags |= 0x80
+		payload = appendString(payload, username)
+		if password, ok := c.url.User.Password(); ok {
+			flags |= 0x40
+			payload = appendString(payload, password)
+		}
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 0x04, flags, 0x00, 0x00)
+	body = append(body, payload...)
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(packet(0x10, body)); err != nil {
+		conn.Close()
+		return err
+	}
+	connack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, connack); err != nil {
+		conn.Close()
+		return err
+	}
+	if connack[0] != 0x20 || connack[3] != 0x00 {
+		conn.Close()
+		return fmt.Errorf("connection refused (code %d)", connack[3])
+	}
+	conn.SetDeadline(time.Time{})
+	c.conn = conn
+	return nil
+}
+
+// Publishes a message with QoS 0, connecting first if needed
+func (c *client) publish(topic string, payload []byte, retain bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return err
+		}
+	}
+	header := byte(0x30)
+	if retain {
+		header |= 0x01
+	}
+	body := append(appendString(nil, topic), payload...)
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(packet(header, body)); err != nil {
+		// drop the connection so the next publish reconnects
+		c.conn.Close()
+		c.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (c *client) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return errors.New("not connected")
+	}
+	c.conn.Write([]byte{0xe0, 0x00}) // DISCONNECT
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Builds a packet from the fixed header byte and body
+func packet(header byte, body []byte) []byte {
+	p := []byte{header}
+	// remaining length as variable length integer
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		p = append(p, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(p, body...)
+}
+
+// Appends a length prefixed UTF-8 string
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
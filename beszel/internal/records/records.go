@@ -4,8 +4,11 @@ package records
 import (
 	"beszel/internal/entities/container"
 	"beszel/internal/entities/system"
-	"log"
+	"fmt"
+	"log/slog"
 	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/goccy/go-json"
@@ -16,134 +19,200 @@ import (
 )
 
 type RecordManager struct {
-	app *pocketbase.PocketBase
+	app       *pocketbase.PocketBase
+	logger    *slog.Logger
+	retention map[string]time.Duration
 }
 
 type LongerRecordData struct {
-	shorterType        string
-	longerType         string
-	longerTimeDuration time.Duration
-	minShorterRecords  int
-}
-
-type RecordDeletionData struct {
-	recordType string
-	retention  time.Duration
+	shorterType       string
+	longerType        string
+	interval          time.Duration
+	minShorterRecords int
 }
 
 type RecordStats []struct {
 	Stats []byte `db:"stats"`
 }
 
-func NewRecordManager(app *pocketbase.PocketBase) *RecordManager {
-	return &RecordManager{app}
+// Record types in order of increasing interval
+var RecordTypes = []string{"1m", "10m", "20m", "120m", "480m"}
+
+// Default retention for each record type (matches the time ranges shown in the UI)
+var defaultRetention = map[string]time.Duration{
+	"1m":   time.Hour,
+	"10m":  12 * time.Hour,
+	"20m":  24 * time.Hour,
+	"120m": 7 * 24 * time.Hour,
+	"480m": 30 * 24 * time.Hour,
 }
 
-// Create longer records by averaging shorter records
-func (rm *RecordManager) CreateLongerRecords(collections []*core.Collection) {
-	// start := time.Now()
-	longerRecordData := []LongerRecordData{
-		{
-			shorterType: "1m",
-			// change to 9 from 10 to allow edge case timing or short pauses
-			minShorterRecords:  9,
-			longerType:         "10m",
-			longerTimeDuration: -10 * time.Minute,
-		},
-		{
-			shorterType:        "10m",
-			minShorterRecords:  2,
-			longerType:         "20m",
-			longerTimeDuration: -20 * time.Minute,
-		},
-		{
-			shorterType:        "20m",
-			minShorterRecords:  6,
-			longerType:         "120m",
-			longerTimeDuration: -120 * time.Minute,
-		},
-		{
-			shorterType:        "120m",
-			minShorterRecords:  4,
-			longerType:         "480m",
-			longerTimeDuration: -480 * time.Minute,
-		},
+func NewRecordManager(app *pocketbase.PocketBase, logger *slog.Logger) *RecordManager {
+	rm := &RecordManager{app: app, logger: logger, retention: make(map[string]time.Duration, len(defaultRetention))}
+	for recordType, retention := range defaultRetention {
+		rm.retention[recordType] = retention
 	}
-	// wrap the operations in a transaction
-	rm.app.RunInTransaction(func(txApp core.App) error {
-		activeSystems, err := txApp.FindAllRecords("systems", dbx.NewExp("status = 'up'"))
-		if err != nil {
-			log.Println("failed to get active systems", "err", err.Error())
-			return err
+	return rm
+}
+
+// Sets the retention for a record type. A retention of zero disables a longer record type:
+// no new records are created and existing ones are kept, not deleted.
+// Otherwise retention can't be shorter than the default, since shorter records are
+// needed to create longer ones and to populate the charts.
+func (rm *RecordManager) SetRetention(recordType string, retention time.Duration) error {
+	defaultValue, ok := defaultRetention[recordType]
+	if !ok {
+		return fmt.Errorf("invalid record type: %s", recordType)
+	}
+	if retention == 0 && recordType == RecordTypes[0] {
+		return fmt.Errorf("%s records can't be disabled", recordType)
+	}
+	if retention != 0 && retention < defaultValue {
+		return fmt.Errorf("retention for %s must be at least %v", recordType, defaultValue)
+	}
+	rm.retention[recordType] = retention
+	return nil
+}
+
+// Returns the retention for a record type
+func (rm *RecordManager) Retention(recordType string) time.Duration {
+	return rm.retention[recordType]
+}
+
+// Parses a retention duration. Supports Go durations plus days (d), weeks (w), and years (y), e.g. "90d" or "1y".
+func ParseRetention(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour, "y": 365 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if number, found := strings.CutSuffix(value, suffix); found {
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid duration: %s", value)
+			}
+			return time.Duration(n * float64(unit)), nil
 		}
+	}
+	return time.ParseDuration(value)
+}
 
-		// loop through all active systems, time periods, and collections
-		for _, system := range activeSystems {
-			// log.Println("processing system", system.GetString("name"))
-			for i := range longerRecordData {
-				recordData := longerRecordData[i]
-				// log.Println("processing longer record type", recordData.longerType)
-				// add one minute padding for longer records because they are created slightly later than the job start time
-				longerRecordPeriod := time.Now().UTC().Add(recordData.longerTimeDuration + time.Minute)
-				// shorter records are created independently of longer records, so we shouldn't need to add padding
-				shorterRecordPeriod := time.Now().UTC().Add(recordData.longerTimeDuration)
-				// loop through both collections
-				for _, collection := range collections {
-					// check creation time of last longer record if not 10m, since 10m is created every run
-					if recordData.longerType != "10m" {
-						lastLongerRecord, err := txApp.FindFirstRecordByFilter(
-							collection.Id,
-							"type = {:type} && system = {:system} && created > {:created}",
-							dbx.Params{"type": recordData.longerType, "system": system.Id, "created": longerRecordPeriod},
-						)
-						// continue if longer record exists
-						if err == nil || lastLongerRecord != nil {
-							// log.Println("longer record found. continuing")
-							continue
-						}
-					}
-					// get shorter records from the past x minutes
-					var stats RecordStats
-
-					err := txApp.DB().
-						Select("stats").
-						From(collection.Name).
-						AndWhere(dbx.NewExp(
-							"type={:type} AND system={:system} AND created > {:created}",
-							dbx.Params{
-								"type":    recordData.shorterType,
-								"system":  system.Id,
-								"created": shorterRecordPeriod,
-							},
-						)).
-						All(&stats)
-
-					// continue if not enough shorter records
-					if err != nil || len(stats) < recordData.minShorterRecords {
-						// log.Println("not enough shorter records. continue.", len(allShorterRecords), recordData.expectedShorterRecords)
-						continue
-					}
-					// average the shorter records and create longer record
-					longerRecord := core.NewRecord(collection)
-					longerRecord.Set("system", system.Id)
-					longerRecord.Set("type", recordData.longerType)
-					switch collection.Name {
-					case "system_stats":
-						longerRecord.Set("stats", rm.AverageSystemStats(stats))
-					case "container_stats":
-						longerRecord.Set("stats", rm.AverageContainerStats(stats))
-					}
-					if err := txApp.SaveNoValidate(longerRecord); err != nil {
-						log.Println("failed to save longer record", "err", err.Error())
-					}
-				}
+// Longer record types, the shorter records they're averaged from, and the number
+// of shorter records an interval needs to have a longer record
+var longerRecordData = []LongerRecordData{
+	// 9 instead of 10 to allow edge case timing or short pauses
+	{shorterType: "1m", longerType: "10m", interval: 10 * time.Minute, minShorterRecords: 9},
+	{shorterType: "10m", longerType: "20m", interval: 20 * time.Minute, minShorterRecords: 2},
+	{shorterType: "20m", longerType: "120m", interval: 120 * time.Minute, minShorterRecords: 6},
+	{shorterType: "120m", longerType: "480m", interval: 480 * time.Minute, minShorterRecords: 4},
+}
+
+// Returns the shorter record type a longer type is averaged from, the length of
+// its intervals and the number of shorter records an interval needs
+func ShorterRecordType(longerType string) (shorterType string, interval time.Duration, minShorterRecords int, ok bool) {
+	for _, recordData := range longerRecordData {
+		if recordData.longerType == longerType {
+			return recordData.shorterType, recordData.interval, recordData.minShorterRecords, true
+		}
+	}
+	return "", 0, 0, false
+}
+
+// Shorter records created less than this long ago may still be waiting to be
+// saved, so intervals are only averaged after it has passed
+const longerRecordDelay = 30 * time.Second
+
+// longerRecordGroup is the shorter records of a system in one interval
+type longerRecordGroup struct {
+	System string `db:"system"`
+	Bucket int64  `db:"bucket"`
+	Stats  string `db:"stats"` // JSON array of the stats of the shorter records
+}
+
+// Creates longer records by averaging the shorter records in each interval.
+// Intervals are aligned to the unix epoch and grouped in SQL, so every complete
+// interval since a system's last longer record is created, including intervals
+// missed while the hub was stopped, as long as their shorter records are kept.
+// Longer records are dated to the last millisecond of their interval, so they
+// fall in the same interval of the next longer type.
+func (rm *RecordManager) CreateLongerRecords(collections []*core.Collection) {
+	now := time.Now().UTC().Add(-longerRecordDelay)
+	for _, recordData := range longerRecordData {
+		// skip disabled record types and types created from disabled types
+		if rm.Retention(recordData.shorterType) == 0 || rm.Retention(recordData.longerType) == 0 {
+			continue
+		}
+		for _, collection := range collections {
+			// each type is created in its own transaction, so the next type includes its records
+			err := rm.app.RunInTransaction(func(txApp core.App) error {
+				return rm.createLongerRecords(txApp, collection, recordData, now)
+			})
+			if err != nil {
+				rm.logger.Error("Failed to create longer records", "type", recordData.longerType, "collection", collection.Name, "err", err.Error())
 			}
 		}
+	}
+}
 
-		return nil
+func (rm *RecordManager) createLongerRecords(txApp core.App, collection *core.Collection, recordData LongerRecordData, now time.Time) error {
+	seconds := int64(recordData.interval.Seconds())
+	// only complete intervals within the retention of the shorter records
+	until := now.Unix() / seconds * seconds
+	since := now.Add(-rm.Retention(recordData.shorterType)).Unix()
+	query := txApp.DB().NewQuery(fmt.Sprintf(`
+		SELECT s.system AS system, CAST(strftime('%%s', s.created) AS INTEGER) / {:seconds} AS bucket,
+			json_group_array(json(s.stats)) AS stats
+		FROM %[1]s s
+		LEFT JOIN (SELECT system, MAX(created) AS last FROM %[1]s WHERE type = {:longer} GROUP BY system) l ON l.system = s.system
+		WHERE s.type = {:shorter} AND s.created >= {:since} AND s.created < {:until}
+			AND (l.last IS NULL OR CAST(strftime('%%s', s.created) AS INTEGER) / {:seconds} * {:seconds} >= CAST(strftime('%%s', l.last) AS INTEGER))
+		GROUP BY s.system, bucket
+		HAVING COUNT(*) >= {:min}`, collection.Name)).Bind(dbx.Params{
+		"seconds": seconds,
+		"longer":  recordData.longerType,
+		"shorter": recordData.shorterType,
+		"since":   time.Unix(since, 0).UTC().Format(types.DefaultDateLayout),
+		"until":   time.Unix(until, 0).UTC().Format(types.DefaultDateLayout),
+		"min":     recordData.minShorterRecords,
 	})
-
-	// log.Println("finished creating longer records", "time (ms)", time.Since(start).Milliseconds())
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	// average each group while reading, so only one group's stats are in memory
+	var longerRecords []*core.Record
+	for rows.Next() {
+		var group longerRecordGroup
+		if err := rows.ScanStruct(&group); err != nil {
+			rows.Close()
+			return err
+		}
+		var stats []json.RawMessage
+		if err := json.Unmarshal([]byte(group.Stats), &stats); err != nil {
+			continue
+		}
+		records := make(RecordStats, len(stats))
+		for i := range stats {
+			records[i].Stats = stats[i]
+		}
+		longerRecord := core.NewRecord(collection)
+		longerRecord.Set("system", group.System)
+		longerRecord.Set("type", recordData.longerType)
+		switch collection.Name {
+		case "system_stats":
+			longerRecord.Set("stats", rm.AverageSystemStats(records))
+		case "container_stats":
+			longerRecord.Set("stats", rm.AverageContainerStats(records))
+		}
+		created, _ := types.ParseDateTime(time.Unix((group.Bucket+1)*seconds, 0).Add(-time.Millisecond))
+		longerRecord.SetRaw("created", created)
+		longerRecords = append(longerRecords, longerRecord)
+	}
+	rows.Close()
+	for _, longerRecord := range longerRecords {
+		if err := txApp.SaveNoValidate(longerRecord); err != nil {
+			rm.logger.Error("Failed to save longer record", "err", err.Error())
+		}
+	}
+	return nil
 }
 
 // Calculate the average stats of a list of system_stats records without reflect
@@ -152,17 +221,44 @@ func (rm *RecordManager) AverageSystemStats(records RecordStats) system.Stats {
 	count := float64(len(records))
 	// use different counter for temps in case some records don't have them
 	tempCount := float64(0)
+	voltCount := float64(0)
+	batteryCount := float64(0)
+	entropyCount := float64(0)
+	pressure := system.Pressure{}
+	pressureCount := float64(0)
+	// records with latency probes, and probes with a reply
+	probeCount := float64(0)
+	latencyCount := float64(0)
+	packetLoss := float64(0)
+	// number of records missing each group of stats (their values are zero after unmarshalling)
+	missingCount := make(map[string]float64)
 
 	var stats system.Stats
 	for i := range records {
 		stats = system.Stats{} // Zero the struct before unmarshalling
 		json.Unmarshal(records[i].Stats, &stats)
+		for _, group := range stats.Missing {
+			missingCount[group]++
+		}
 		sum.Cpu += stats.Cpu
+		sum.CpuUser += stats.CpuUser
+		sum.CpuSystem += stats.CpuSystem
+		sum.CpuIowait += stats.CpuIowait
+		sum.CpuSteal += stats.CpuSteal
+		for i, core := range stats.CpuCores {
+			if i == len(sum.CpuCores) {
+				sum.CpuCores = append(sum.CpuCores, 0)
+			}
+			sum.CpuCores[i] += core
+		}
 		sum.Mem += stats.Mem
 		sum.MemUsed += stats.MemUsed
 		sum.MemPct += stats.MemPct
 		sum.MemBuffCache += stats.MemBuffCache
 		sum.MemZfsArc += stats.MemZfsArc
+		sum.MemAvailable += stats.MemAvailable
+		sum.HugePages += stats.HugePages
+		sum.HugePagesUsed += stats.HugePagesUsed
 		sum.Swap += stats.Swap
 		sum.SwapUsed += stats.SwapUsed
 		sum.DiskTotal += stats.DiskTotal
@@ -170,8 +266,42 @@ func (rm *RecordManager) AverageSystemStats(records RecordStats) system.Stats {
 		sum.DiskPct += stats.DiskPct
 		sum.DiskReadPs += stats.DiskReadPs
 		sum.DiskWritePs += stats.DiskWritePs
+		sum.DiskReadLat += stats.DiskReadLat
+		sum.DiskWriteLat += stats.DiskWriteLat
+		sum.DiskQueue += stats.DiskQueue
+		sum.LoadAvg1 += stats.LoadAvg1
+		sum.LoadAvg5 += stats.LoadAvg5
+		sum.LoadAvg15 += stats.LoadAvg15
+		sum.Fds += stats.Fds
+		sum.FdMax += stats.FdMax
+		sum.FdProcPct += stats.FdProcPct
 		sum.NetworkSent += stats.NetworkSent
 		sum.NetworkRecv += stats.NetworkRecv
+		if stats.Battery > 0 {
+			sum.Battery += stats.Battery
+			batteryCount++
+		}
+		if stats.EntropyPool > 0 {
+			sum.Entropy += stats.Entropy
+			sum.EntropyPool += stats.EntropyPool
+			entropyCount++
+		}
+		if p := stats.Pressure; p != nil {
+			pressure.CpuSome += p.CpuSome
+			pressure.MemSome += p.MemSome
+			pressure.MemFull += p.MemFull
+			pressure.IoSome += p.IoSome
+			pressure.IoFull += p.IoFull
+			pressureCount++
+		}
+		if stats.PacketLoss != nil {
+			packetLoss += *stats.PacketLoss
+			probeCount++
+		}
+		if stats.Latency > 0 {
+			sum.Latency += stats.Latency
+			latencyCount++
+		}
 		// set peak values
 		sum.MaxCpu = max(sum.MaxCpu, stats.MaxCpu, stats.Cpu)
 		sum.MaxNetworkSent = max(sum.MaxNetworkSent, stats.MaxNetworkSent, stats.NetworkSent)
@@ -191,6 +321,16 @@ func (rm *RecordManager) AverageSystemStats(records RecordStats) system.Stats {
 				sum.Temperatures[key] += value
 			}
 		}
+		// add voltages to sum
+		if stats.Voltages != nil {
+			if sum.Voltages == nil {
+				sum.Voltages = make(map[string]float64, len(stats.Voltages))
+			}
+			voltCount++
+			for key, value := range stats.Voltages {
+				sum.Voltages[key] += value
+			}
+		}
 		// add extra fs to sum
 		if stats.ExtraFs != nil {
 			if sum.ExtraFs == nil {
@@ -204,11 +344,46 @@ func (rm *RecordManager) AverageSystemStats(records RecordStats) system.Stats {
 				sum.ExtraFs[key].DiskUsed += value.DiskUsed
 				sum.ExtraFs[key].DiskWritePs += value.DiskWritePs
 				sum.ExtraFs[key].DiskReadPs += value.DiskReadPs
+				sum.ExtraFs[key].ReadLatency += value.ReadLatency
+				sum.ExtraFs[key].WriteLatency += value.WriteLatency
+				sum.ExtraFs[key].QueueLength += value.QueueLength
 				// peak values
 				sum.ExtraFs[key].MaxDiskReadPS = max(sum.ExtraFs[key].MaxDiskReadPS, value.MaxDiskReadPS, value.DiskReadPs)
 				sum.ExtraFs[key].MaxDiskWritePS = max(sum.ExtraFs[key].MaxDiskWritePS, value.MaxDiskWritePS, value.DiskWritePs)
 			}
 		}
+		// add disk devices to sum
+		if stats.DiskIo != nil {
+			if sum.DiskIo == nil {
+				sum.DiskIo = make(map[string]system.IoStats, len(stats.DiskIo))
+			}
+			for name, value := range stats.DiskIo {
+				device := sum.DiskIo[name]
+				device.Read += value.Read
+				device.Write += value.Write
+				device.ReadIops += value.ReadIops
+				device.WriteIops += value.WriteIops
+				device.ReadAwait += value.ReadAwait
+				device.WriteAwait += value.WriteAwait
+				device.Await += value.Await
+				device.Util += value.Util
+				sum.DiskIo[name] = device
+			}
+		}
+		// add network interfaces to sum
+		if stats.Nics != nil {
+			if sum.Nics == nil {
+				sum.Nics = make(map[string]system.NicStats, len(stats.Nics))
+			}
+			for name, value := range stats.Nics {
+				nic := sum.Nics[name]
+				nic.Sent += value.Sent
+				nic.Recv += value.Recv
+				nic.Speed += value.Speed
+				nic.Util += value.Util
+				sum.Nics[name] = nic
+			}
+		}
 		// add GPU data
 		if stats.GPUData != nil {
 			if sum.GPUData == nil {
@@ -222,35 +397,113 @@ func (rm *RecordManager) AverageSystemStats(records RecordStats) system.Stats {
 				gpu.Temperature += value.Temperature
 				gpu.MemoryUsed += value.MemoryUsed
 				gpu.MemoryTotal += value.MemoryTotal
+				gpu.MemoryFree += value.MemoryFree
 				gpu.Usage += value.Usage
 				gpu.Power += value.Power
+				gpu.Processes += value.Processes
 				gpu.Count += value.Count
+				for name, busy := range value.Engines {
+					if gpu.Engines == nil {
+						gpu.Engines = make(map[string]float64, len(value.Engines))
+					}
+					gpu.Engines[name] += busy
+				}
 				sum.GPUData[id] = gpu
 			}
 		}
 	}
 
+	// average each group over the records that have it, marking it missing if none do
+	var missing []string
+	groupCount := func(group string) float64 {
+		n := count - missingCount[group]
+		if n == 0 {
+			missing = append(missing, group)
+			return 1
+		}
+		return n
+	}
+	cpuCount := groupCount(system.StatsCpu)
+	memCount := groupCount(system.StatsMem)
+	diskCount := groupCount(system.StatsDisk)
+	diskIOCount := groupCount(system.StatsDiskIO)
+	netCount := groupCount(system.StatsNet)
+	loadCount := groupCount(system.StatsLoad)
+	fdCount := groupCount(system.StatsFd)
+
 	stats = system.Stats{
-		Cpu:            twoDecimals(sum.Cpu / count),
-		Mem:            twoDecimals(sum.Mem / count),
-		MemUsed:        twoDecimals(sum.MemUsed / count),
-		MemPct:         twoDecimals(sum.MemPct / count),
-		MemBuffCache:   twoDecimals(sum.MemBuffCache / count),
-		MemZfsArc:      twoDecimals(sum.MemZfsArc / count),
-		Swap:           twoDecimals(sum.Swap / count),
-		SwapUsed:       twoDecimals(sum.SwapUsed / count),
-		DiskTotal:      twoDecimals(sum.DiskTotal / count),
-		DiskUsed:       twoDecimals(sum.DiskUsed / count),
-		DiskPct:        twoDecimals(sum.DiskPct / count),
-		DiskReadPs:     twoDecimals(sum.DiskReadPs / count),
-		DiskWritePs:    twoDecimals(sum.DiskWritePs / count),
-		NetworkSent:    twoDecimals(sum.NetworkSent / count),
-		NetworkRecv:    twoDecimals(sum.NetworkRecv / count),
+		Cpu:            twoDecimals(sum.Cpu / cpuCount),
+		CpuUser:        twoDecimals(sum.CpuUser / cpuCount),
+		CpuSystem:      twoDecimals(sum.CpuSystem / cpuCount),
+		CpuIowait:      twoDecimals(sum.CpuIowait / cpuCount),
+		CpuSteal:       twoDecimals(sum.CpuSteal / cpuCount),
+		Mem:            twoDecimals(sum.Mem / memCount),
+		MemUsed:        twoDecimals(sum.MemUsed / memCount),
+		MemPct:         twoDecimals(sum.MemPct / memCount),
+		MemBuffCache:   twoDecimals(sum.MemBuffCache / memCount),
+		MemZfsArc:      twoDecimals(sum.MemZfsArc / memCount),
+		MemAvailable:   twoDecimals(sum.MemAvailable / memCount),
+		HugePages:      twoDecimals(sum.HugePages / memCount),
+		HugePagesUsed:  twoDecimals(sum.HugePagesUsed / memCount),
+		Swap:           twoDecimals(sum.Swap / memCount),
+		SwapUsed:       twoDecimals(sum.SwapUsed / memCount),
+		DiskTotal:      twoDecimals(sum.DiskTotal / diskCount),
+		DiskUsed:       twoDecimals(sum.DiskUsed / diskCount),
+		DiskPct:        twoDecimals(sum.DiskPct / diskCount),
+		DiskReadPs:     twoDecimals(sum.DiskReadPs / diskIOCount),
+		DiskWritePs:    twoDecimals(sum.DiskWritePs / diskIOCount),
+		DiskReadLat:    twoDecimals(sum.DiskReadLat / diskIOCount),
+		DiskWriteLat:   twoDecimals(sum.DiskWriteLat / diskIOCount),
+		DiskQueue:      twoDecimals(sum.DiskQueue / diskIOCount),
+		LoadAvg1:       twoDecimals(sum.LoadAvg1 / loadCount),
+		LoadAvg5:       twoDecimals(sum.LoadAvg5 / loadCount),
+		LoadAvg15:      twoDecimals(sum.LoadAvg15 / loadCount),
+		Fds:            twoDecimals(sum.Fds / fdCount),
+		FdMax:          twoDecimals(sum.FdMax / fdCount),
+		FdProcPct:      twoDecimals(sum.FdProcPct / fdCount),
+		NetworkSent:    twoDecimals(sum.NetworkSent / netCount),
+		NetworkRecv:    twoDecimals(sum.NetworkRecv / netCount),
 		MaxCpu:         sum.MaxCpu,
 		MaxDiskReadPs:  sum.MaxDiskReadPs,
 		MaxDiskWritePs: sum.MaxDiskWritePs,
 		MaxNetworkSent: sum.MaxNetworkSent,
 		MaxNetworkRecv: sum.MaxNetworkRecv,
+		Missing:        missing,
+	}
+
+	if len(sum.CpuCores) > 0 {
+		stats.CpuCores = make([]float64, len(sum.CpuCores))
+		for i, value := range sum.CpuCores {
+			stats.CpuCores[i] = math.Round(value / cpuCount)
+		}
+	}
+
+	if batteryCount > 0 {
+		stats.Battery = twoDecimals(sum.Battery / batteryCount)
+	}
+
+	if entropyCount > 0 {
+		stats.Entropy = twoDecimals(sum.Entropy / entropyCount)
+		stats.EntropyPool = twoDecimals(sum.EntropyPool / entropyCount)
+	}
+
+	if pressureCount > 0 {
+		stats.Pressure = &system.Pressure{
+			CpuSome: twoDecimals(pressure.CpuSome / pressureCount),
+			MemSome: twoDecimals(pressure.MemSome / pressureCount),
+			MemFull: twoDecimals(pressure.MemFull / pressureCount),
+			IoSome:  twoDecimals(pressure.IoSome / pressureCount),
+			IoFull:  twoDecimals(pressure.IoFull / pressureCount),
+		}
+	}
+
+	if probeCount > 0 {
+		avgPacketLoss := twoDecimals(packetLoss / probeCount)
+		stats.PacketLoss = &avgPacketLoss
+	}
+
+	if latencyCount > 0 {
+		stats.Latency = twoDecimals(sum.Latency / latencyCount)
 	}
 
 	if sum.Temperatures != nil {
@@ -260,6 +513,13 @@ func (rm *RecordManager) AverageSystemStats(records RecordStats) system.Stats {
 		}
 	}
 
+	if sum.Voltages != nil {
+		stats.Voltages = make(map[string]float64, len(sum.Voltages))
+		for key, value := range sum.Voltages {
+			stats.Voltages[key] = twoDecimals(value / voltCount)
+		}
+	}
+
 	if sum.ExtraFs != nil {
 		stats.ExtraFs = make(map[string]*system.FsStats, len(sum.ExtraFs))
 		for key, value := range sum.ExtraFs {
@@ -268,22 +528,63 @@ func (rm *RecordManager) AverageSystemStats(records RecordStats) system.Stats {
 				DiskUsed:       twoDecimals(value.DiskUsed / count),
 				DiskWritePs:    twoDecimals(value.DiskWritePs / count),
 				DiskReadPs:     twoDecimals(value.DiskReadPs / count),
+				ReadLatency:    twoDecimals(value.ReadLatency / count),
+				WriteLatency:   twoDecimals(value.WriteLatency / count),
+				QueueLength:    twoDecimals(value.QueueLength / count),
 				MaxDiskReadPS:  value.MaxDiskReadPS,
 				MaxDiskWritePS: value.MaxDiskWritePS,
 			}
 		}
 	}
 
+	if sum.DiskIo != nil {
+		stats.DiskIo = make(map[string]system.IoStats, len(sum.DiskIo))
+		for name, value := range sum.DiskIo {
+			stats.DiskIo[name] = system.IoStats{
+				Read:       twoDecimals(value.Read / diskIOCount),
+				Write:      twoDecimals(value.Write / diskIOCount),
+				ReadIops:   twoDecimals(value.ReadIops / diskIOCount),
+				WriteIops:  twoDecimals(value.WriteIops / diskIOCount),
+				ReadAwait:  twoDecimals(value.ReadAwait / diskIOCount),
+				WriteAwait: twoDecimals(value.WriteAwait / diskIOCount),
+				Await:      twoDecimals(value.Await / diskIOCount),
+				Util:       twoDecimals(value.Util / diskIOCount),
+			}
+		}
+	}
+
+	if sum.Nics != nil {
+		stats.Nics = make(map[string]system.NicStats, len(sum.Nics))
+		for name, value := range sum.Nics {
+			stats.Nics[name] = system.NicStats{
+				Sent:  twoDecimals(value.Sent / netCount),
+				Recv:  twoDecimals(value.Recv / netCount),
+				Speed: twoDecimals(value.Speed / netCount),
+				Util:  twoDecimals(value.Util / netCount),
+			}
+		}
+	}
+
 	if sum.GPUData != nil {
 		stats.GPUData = make(map[string]system.GPUData, len(sum.GPUData))
 		for id, value := range sum.GPUData {
+			var engines map[string]float64
+			if value.Engines != nil {
+				engines = make(map[string]float64, len(value.Engines))
+				for name, busy := range value.Engines {
+					engines[name] = twoDecimals(busy / count)
+				}
+			}
 			stats.GPUData[id] = system.GPUData{
 				Name:        value.Name,
 				Temperature: twoDecimals(value.Temperature / count),
 				MemoryUsed:  twoDecimals(value.MemoryUsed / count),
 				MemoryTotal: twoDecimals(value.MemoryTotal / count),
+				MemoryFree:  twoDecimals(value.MemoryFree / count),
 				Usage:       twoDecimals(value.Usage / count),
 				Power:       twoDecimals(value.Power / count),
+				Processes:   twoDecimals(value.Processes / count),
+				Engines:     engines,
 				Count:       twoDecimals(value.Count / count),
 			}
 		}
@@ -307,12 +608,14 @@ func (rm *RecordManager) AverageContainerStats(records RecordStats) []container.
 		for i := range containerStats {
 			stat := containerStats[i]
 			if _, ok := sums[stat.Name]; !ok {
-				sums[stat.Name] = &container.Stats{Name: stat.Name}
+				sums[stat.Name] = &container.Stats{Name: stat.Name, Project: stat.Project, Service: stat.Service}
 			}
 			sums[stat.Name].Cpu += stat.Cpu
 			sums[stat.Name].Mem += stat.Mem
 			sums[stat.Name].NetworkSent += stat.NetworkSent
 			sums[stat.Name].NetworkRecv += stat.NetworkRecv
+			sums[stat.Name].DiskRead += stat.DiskRead
+			sums[stat.Name].DiskWrite += stat.DiskWrite
 		}
 	}
 
@@ -320,48 +623,38 @@ func (rm *RecordManager) AverageContainerStats(records RecordStats) []container.
 	for _, value := range sums {
 		result = append(result, container.Stats{
 			Name:        value.Name,
+			Project:     value.Project,
+			Service:     value.Service,
 			Cpu:         twoDecimals(value.Cpu / count),
 			Mem:         twoDecimals(value.Mem / count),
 			NetworkSent: twoDecimals(value.NetworkSent / count),
 			NetworkRecv: twoDecimals(value.NetworkRecv / count),
+			DiskRead:    twoDecimals(value.DiskRead / count),
+			DiskWrite:   twoDecimals(value.DiskWrite / count),
 		})
 	}
 	return result
 }
 
-// Deletes records older than what is displayed in the UI
+// Deletes records older than the configured retention
 func (rm *RecordManager) DeleteOldRecords() {
-	collections := []string{"system_stats", "container_stats"}
-	recordData := []RecordDeletionData{
-		{
-			recordType: "1m",
-			retention:  time.Hour,
-		},
-		{
-			recordType: "10m",
-			retention:  12 * time.Hour,
-		},
-		{
-			recordType: "20m",
-			retention:  24 * time.Hour,
-		},
-		{
-			recordType: "120m",
-			retention:  7 * 24 * time.Hour,
-		},
-		{
-			recordType: "480m",
-			retention:  30 * 24 * time.Hour,
-		},
-	}
-	db := rm.app.NonconcurrentDB()
-	for _, recordData := range recordData {
+	rm.deleteOldRecords(rm.app.NonconcurrentDB(), []string{"system_stats", "container_stats"}, time.Now())
+}
+
+// Deletes records in the collections that were created before their retention.
+// Disabled record types are skipped, so their existing records are kept.
+func (rm *RecordManager) deleteOldRecords(db dbx.Builder, collections []string, now time.Time) {
+	for _, recordType := range RecordTypes {
+		retention := rm.Retention(recordType)
+		if retention == 0 {
+			continue
+		}
+		formattedDate := now.UTC().Add(-retention).Format(types.DefaultDateLayout)
 		for _, collectionSlug := range collections {
-			formattedDate := time.Now().UTC().Add(-recordData.retention).Format(types.DefaultDateLayout)
-			expr := dbx.NewExp("[[created]] < {:date} AND [[type]] = {:type}", dbx.Params{"date": formattedDate, "type": recordData.recordType})
+			expr := dbx.NewExp("[[created]] < {:date} AND [[type]] = {:type}", dbx.Params{"date": formattedDate, "type": recordType})
 			_, err := db.Delete(collectionSlug, expr).Execute()
 			if err != nil {
-				rm.app.Logger().Error("Failed to delete records", "err", err.Error())
+				rm.logger.Error("Failed to delete records", "err", err.Error())
 			}
 		}
 	}
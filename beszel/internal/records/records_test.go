@@ -0,0 +1,215 @@
+package records
+
+import (
+	"beszel/internal/entities/system"
+	"log/slog"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Returns an app with a system_stats collection like the hub's
+func newTestApp(t *testing.T) (core.App, *core.Collection) {
+	t.Helper()
+	app := core.NewBaseApp(core.BaseAppConfig{DataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.ResetBootstrapState() })
+	if err := app.RunSystemMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	collection := core.NewBaseCollection("system_stats")
+	collection.Fields.Add(
+		&core.TextField{Name: "system"},
+		&core.JSONField{Name: "stats"},
+		&core.TextField{Name: "type"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+	)
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+	return app, collection
+}
+
+// Saves a system_stats record with the cpu usage at a time
+func saveStats(t *testing.T, app core.App, collection *core.Collection, systemId, recordType string, created time.Time, cpu float64) {
+	t.Helper()
+	record := core.NewRecord(collection)
+	record.Set("system", systemId)
+	record.Set("type", recordType)
+	record.Set("stats", system.Stats{Cpu: cpu})
+	createdAt, _ := types.ParseDateTime(created)
+	record.SetRaw("created", createdAt)
+	if err := app.SaveNoValidate(record); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateLongerRecords(t *testing.T) {
+	// 10m intervals end at 12:00 and 12:10, so now is in an incomplete interval
+	now := time.Date(2026, 1, 1, 12, 15, 0, 0, time.UTC)
+	interval := 10 * time.Minute
+	tests := []struct {
+		name string
+		// number of 1m records in each interval before now, starting at 11:10.
+		// 1m records are kept for an hour, so only those after 11:15 are used.
+		counts []int
+		// a 10m record that already exists, at the end of this interval
+		existing int
+		// cpu of the 10m records by the end of their interval
+		want map[time.Time]float64
+	}{
+		{
+			name:     "complete interval",
+			counts:   []int{0, 0, 0, 0, 0, 10},
+			existing: -1,
+			want:     map[time.Time]float64{time.Date(2026, 1, 1, 12, 10, 0, 0, time.UTC): 4.5},
+		},
+		{
+			name:     "intervals missed while stopped",
+			counts:   []int{0, 0, 0, 10, 10, 10},
+			existing: -1,
+			want: map[time.Time]float64{
+				time.Date(2026, 1, 1, 11, 50, 0, 0, time.UTC): 4.5,
+				time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC):  4.5,
+				time.Date(2026, 1, 1, 12, 10, 0, 0, time.UTC): 4.5,
+			},
+		},
+		{
+			name:     "too few records",
+			counts:   []int{0, 0, 0, 0, 0, 8},
+			existing: -1,
+			want:     map[time.Time]float64{},
+		},
+		{
+			name:     "nine records allow for timing",
+			counts:   []int{0, 0, 0, 0, 0, 9},
+			existing: -1,
+			want:     map[time.Time]float64{time.Date(2026, 1, 1, 12, 10, 0, 0, time.UTC): 4},
+		},
+		{
+			name:     "intervals before the last longer record",
+			counts:   []int{0, 0, 0, 0, 10, 10},
+			existing: 4,
+			want:     map[time.Time]float64{time.Date(2026, 1, 1, 12, 10, 0, 0, time.UTC): 4.5},
+		},
+		{
+			name:     "records older than the retention",
+			counts:   []int{10, 0, 0, 0, 0, 0},
+			existing: -1,
+			want:     map[time.Time]float64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, collection := newTestApp(t)
+			start := time.Date(2026, 1, 1, 11, 10, 0, 0, time.UTC)
+			for i, count := range tt.counts {
+				for j := range count {
+					saveStats(t, app, collection, "sys1", "1m", start.Add(time.Duration(i)*interval+time.Duration(j)*time.Minute+time.Second), float64(j))
+				}
+			}
+			// the current interval is skipped even if it has enough records
+			for j := range 10 {
+				saveStats(t, app, collection, "sys1", "1m", now.Add(-5*time.Minute+time.Duration(j)*time.Second), 100)
+			}
+			if tt.existing >= 0 {
+				saveStats(t, app, collection, "sys1", "10m", start.Add(time.Duration(tt.existing+1)*interval-time.Millisecond), 0)
+			}
+
+			rm := &RecordManager{logger: slog.Default(), retention: maps.Clone(defaultRetention)}
+			if err := rm.createLongerRecords(app, collection, longerRecordData[0], now); err != nil {
+				t.Fatal(err)
+			}
+
+			records, err := app.FindRecordsByFilter(collection, "type = '10m'", "created", 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[time.Time]float64)
+			for _, record := range records {
+				end := record.GetDateTime("created").Time().Add(time.Millisecond)
+				var stats system.Stats
+				record.UnmarshalJSONField("stats", &stats)
+				got[end] = stats.Cpu
+			}
+			if tt.existing >= 0 {
+				delete(got, start.Add(time.Duration(tt.existing+1)*interval))
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Fatalf("10m records = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteOldRecords(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		retention map[string]time.Duration
+		// age of the saved records of each type
+		ages map[string]time.Duration
+		// types with records left after deleting
+		want []string
+	}{
+		{
+			name:      "records older than the retention",
+			retention: defaultRetention,
+			ages:      map[string]time.Duration{"1m": 2 * time.Hour, "20m": 25 * time.Hour},
+			want:      []string{},
+		},
+		{
+			name:      "records within the retention",
+			retention: defaultRetention,
+			ages:      map[string]time.Duration{"1m": 30 * time.Minute, "20m": 23 * time.Hour},
+			want:      []string{"1m", "20m"},
+		},
+		{
+			name:      "longer retention",
+			retention: map[string]time.Duration{"1m": time.Hour, "10m": 12 * time.Hour, "20m": 7 * 24 * time.Hour, "120m": 7 * 24 * time.Hour, "480m": 30 * 24 * time.Hour},
+			ages:      map[string]time.Duration{"1m": 2 * time.Hour, "20m": 25 * time.Hour},
+			want:      []string{"20m"},
+		},
+		{
+			name:      "disabled type keeps its records",
+			retention: map[string]time.Duration{"1m": time.Hour, "10m": 12 * time.Hour, "20m": 0, "120m": 7 * 24 * time.Hour, "480m": 30 * 24 * time.Hour},
+			ages:      map[string]time.Duration{"1m": 2 * time.Hour, "20m": 365 * 24 * time.Hour},
+			want:      []string{"20m"},
+		},
+		{
+			name:      "disabled type keeps new records",
+			retention: map[string]time.Duration{"1m": time.Hour, "10m": 12 * time.Hour, "20m": 24 * time.Hour, "120m": 0, "480m": 0},
+			ages:      map[string]time.Duration{"120m": time.Minute, "480m": 0},
+			want:      []string{"120m", "480m"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, collection := newTestApp(t)
+			for recordType, age := range tt.ages {
+				saveStats(t, app, collection, "sys1", recordType, now.Add(-age), 1)
+			}
+			rm := &RecordManager{logger: slog.Default(), retention: maps.Clone(tt.retention)}
+			rm.deleteOldRecords(app.NonconcurrentDB(), []string{collection.Name}, now)
+
+			records, err := app.FindRecordsByFilter(collection, "", "type", 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(records))
+			for _, record := range records {
+				got = append(got, record.GetString("type"))
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("types left = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package remotewrite
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+)
+
+// Encodes samples as InfluxDB line protocol, with one line per measurement and tag set
+func encodeLineProtocol(samples []Sample, t time.Time) []byte {
+	var buf bytes.Buffer
+	timestamp := strconv.FormatInt(t.UnixNano(), 10)
+	lines := make(map[string][]Sample)
+	var keys []string
+	for _, s := range samples {
+		key := seriesKey(s)
+		if _, ok := lines[key]; !ok {
+			keys = append(keys, key)
+		}
+		lines[key] = append(lines[key], s)
+	}
+	for _, key := range keys {
+		buf.WriteString(key)
+		for i, s := range lines[key] {
+			if i == 0 {
+				buf.WriteByte(' ')
+			} else {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(tagEscaper.Replace(s.Field))
+			buf.WriteByte('=')
+			buf.WriteString(strconv.FormatFloat(s.Value, 'f', -1, 64))
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(timestamp)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// Returns the measurement and sorted tags of a sample in line protocol format
+func seriesKey(s Sample) string {
+	var sb strings.Builder
+	sb.WriteString(measurementEscaper.Replace(s.Measurement))
+	for _, k := range slices.Sorted(maps.Keys(s.Tags)) {
+		if s.Tags[k] == "" {
+			continue
+		}
+		sb.WriteByte(',')
+		sb.WriteString(tagEscaper.Replace(k))
+		sb.WriteByte('=')
+		sb.WriteString(tagEscaper.Replace(s.Tags[k]))
+	}
+	return sb.String()
+}
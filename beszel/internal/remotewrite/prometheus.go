@@ -0,0 +1,82 @@
+package remotewrite
+
+import (
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// Encodes samples as a snappy compressed Prometheus remote write request.
+// The WriteRequest protobuf message is written by hand to avoid pulling in the prometheus module:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label { string name = 1; string value = 2; }
+//	Sample { double value = 1; int64 timestamp = 2; }
+func encodeRemoteWrite(samples []Sample, t time.Time) []byte {
+	var req []byte
+	timestamp := t.UnixMilli()
+	for _, s := range samples {
+		labels := map[string]string{"__name__": metricName(s)}
+		for k, v := range s.Tags {
+			labels[invalidNameChars.ReplaceAllString(k, "_")] = v
+		}
+		var series []byte
+		// labels must be sorted by name
+		for _, name := range slices.Sorted(maps.Keys(labels)) {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, labels[name])
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, label)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(timestamp))
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, series)
+	}
+	return snappyEncode(req)
+}
+
+// Returns the prometheus metric name of a sample (e.g. beszel_system_cpu)
+func metricName(s Sample) string {
+	return "beszel_" + invalidNameChars.ReplaceAllString(s.Measurement+"_"+s.Field, "_")
+}
+
+// Encodes data in the snappy block format as a single uncompressed literal.
+// Remote write payloads are small and sent once per minute, so skipping
+// compression is a fair trade for not adding a dependency.
+func snappyEncode(data []byte) []byte {
+	out := protowire.AppendVarint(make([]byte, 0, len(data)+10), uint64(len(data)))
+	if len(data) == 0 {
+		return out
+	}
+	n := uint32(len(data) - 1)
+	switch {
+	case n < 60:
+		out = append(out, byte(n<<2))
+	case n < 1<<8:
+		out = append(out, 60<<2, byte(n))
+	case n < 1<<16:
+		out = append(out, 61<<2, byte(n), byte(n>>8))
+	case n < 1<<24:
+		out = append(out, 62<<2, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		out = append(out, 63<<2, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(out, data...)
+}
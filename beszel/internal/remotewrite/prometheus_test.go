@@ -0,0 +1,200 @@
+package remotewrite
+
+import (
+	"bytes"
+	"maps"
+	"math"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Decodes a snappy block made of a single literal, as written by snappyEncode
+func snappyDecode(t *testing.T, block []byte) []byte {
+	t.Helper()
+	length, n := protowire.ConsumeVarint(block)
+	if n < 0 {
+		t.Fatal("invalid length")
+	}
+	block = block[n:]
+	if length == 0 {
+		return block
+	}
+	if block[0]&3 != 0 {
+		t.Fatalf("tag %#x isn't a literal", block[0])
+	}
+	literalLen := uint64(block[0] >> 2)
+	block = block[1:]
+	if literalLen >= 60 {
+		extra := int(literalLen - 59)
+		literalLen = 0
+		for i := range extra {
+			literalLen |= uint64(block[i]) << (8 * i)
+		}
+		block = block[extra:]
+	}
+	if literalLen+1 != length || uint64(len(block)) != length {
+		t.Fatalf("literal of %d bytes with %d bytes left, want %d", literalLen+1, len(block), length)
+	}
+	return block
+}
+
+func TestSnappyEncode(t *testing.T) {
+	tests := []struct {
+		name       string
+		length     int
+		wantHeader []byte
+	}{
+		{name: "empty", length: 0, wantHeader: []byte{0}},
+		{name: "short literal", length: 5, wantHeader: []byte{5, 4 << 2}},
+		{name: "longest short literal", length: 60, wantHeader: []byte{60, 59 << 2}},
+		{name: "one byte length", length: 61, wantHeader: []byte{61, 60 << 2, 60}},
+		{name: "two byte length", length: 300, wantHeader: []byte{0xac, 0x02, 61 << 2, 0x2b, 0x01}},
+		{name: "three byte length", length: 70000, wantHeader: []byte{0xf0, 0xa2, 0x04, 62 << 2, 0x6f, 0x11, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.Repeat([]byte{'x'}, tt.length)
+			block := snappyEncode(data)
+			if !bytes.HasPrefix(block, tt.wantHeader) || len(block) != len(tt.wantHeader)+tt.length {
+				t.Fatalf("header = %x, want %x", block[:min(len(block), len(tt.wantHeader))], tt.wantHeader)
+			}
+			if decoded := snappyDecode(t, block); !bytes.Equal(decoded, data) {
+				t.Fatalf("decoded %d bytes, want %d", len(decoded), len(data))
+			}
+		})
+	}
+}
+
+// A time series decoded from a remote write request
+type decodedSeries struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// Returns the fields of a protobuf message with the number
+func consumeFields(t *testing.T, b []byte, number protowire.Number) [][]byte {
+	t.Helper()
+	var fields [][]byte
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		b = b[n:]
+		var value []byte
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+		case protowire.Fixed64Type:
+			n = 8
+			value = b[:n]
+		case protowire.VarintType:
+			_, n = protowire.ConsumeVarint(b)
+			value = b[:n]
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		b = b[n:]
+		if num == number {
+			fields = append(fields, value)
+		}
+	}
+	return fields
+}
+
+// Decodes a remote write request into its time series
+func decodeRemoteWrite(t *testing.T, body []byte) []decodedSeries {
+	t.Helper()
+	var result []decodedSeries
+	for _, series := range consumeFields(t, snappyDecode(t, body), 1) {
+		decoded := decodedSeries{labels: map[string]string{}}
+		for _, label := range consumeFields(t, series, 1) {
+			name := consumeFields(t, label, 1)
+			value := consumeFields(t, label, 2)
+			if len(name) != 1 || len(value) != 1 {
+				t.Fatal("label without name or value")
+			}
+			if _, exists := decoded.labels[string(name[0])]; exists {
+				t.Fatalf("duplicate label %q", name[0])
+			}
+			decoded.labels[string(name[0])] = string(value[0])
+		}
+		samples := consumeFields(t, series, 2)
+		if len(samples) != 1 {
+			t.Fatalf("series has %d samples, want 1", len(samples))
+		}
+		value, _ := protowire.ConsumeFixed64(consumeFields(t, samples[0], 1)[0])
+		timestamp, _ := protowire.ConsumeVarint(consumeFields(t, samples[0], 2)[0])
+		decoded.value = math.Float64frombits(value)
+		decoded.timestamp = int64(timestamp)
+		result = append(result, decoded)
+	}
+	return result
+}
+
+func TestEncodeRemoteWrite(t *testing.T) {
+	now := time.UnixMilli(1767225600123)
+	tests := []struct {
+		name    string
+		samples []Sample
+		want    []decodedSeries
+	}{
+		{
+			name: "no samples",
+		},
+		{
+			name:    "system sample",
+			samples: []Sample{{Measurement: "system", Field: "cpu", Tags: map[string]string{"system": "web-1"}, Value: 12.5}},
+			want:    []decodedSeries{{labels: map[string]string{"__name__": "beszel_system_cpu", "system": "web-1"}, value: 12.5, timestamp: now.UnixMilli()}},
+		},
+		{
+			name:    "invalid characters are replaced",
+			samples: []Sample{{Measurement: "container", Field: "mem.used", Tags: map[string]string{"system": "web-1", "container-name": "nginx"}, Value: 256}},
+			want:    []decodedSeries{{labels: map[string]string{"__name__": "beszel_container_mem_used", "system": "web-1", "container_name": "nginx"}, value: 256, timestamp: now.UnixMilli()}},
+		},
+		{
+			name: "several samples",
+			samples: []Sample{
+				{Measurement: "system", Field: "mem", Tags: map[string]string{"system": "db"}, Value: 3.25},
+				{Measurement: "system", Field: "disk", Tags: map[string]string{"system": "db"}, Value: -1},
+			},
+			want: []decodedSeries{
+				{labels: map[string]string{"__name__": "beszel_system_mem", "system": "db"}, value: 3.25, timestamp: now.UnixMilli()},
+				{labels: map[string]string{"__name__": "beszel_system_disk", "system": "db"}, value: -1, timestamp: now.UnixMilli()},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decodeRemoteWrite(t, encodeRemoteWrite(tt.samples, now))
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d series, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !maps.Equal(got[i].labels, tt.want[i].labels) || got[i].value != tt.want[i].value || got[i].timestamp != tt.want[i].timestamp {
+					t.Errorf("series %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeRemoteWriteSortsLabels(t *testing.T) {
+	body := encodeRemoteWrite([]Sample{{Measurement: "system", Field: "cpu", Tags: map[string]string{"z": "1", "a": "2", "system": "web"}}}, time.Now())
+	series := consumeFields(t, snappyDecode(t, body), 1)
+	var names []string
+	for _, label := range consumeFields(t, series[0], 1) {
+		names = append(names, string(consumeFields(t, label, 1)[0]))
+	}
+	for i := 1; i < len(names); i++ {
+		if names[i-1] >= names[i] {
+			t.Fatalf("labels aren't sorted: %v", names)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Package remotewrite mirrors system and container stats to an external
+// time-series database using InfluxDB line protocol or Prometheus remote write.
+package remotewrite
+
+import (
+	"beszel/internal/entities/container"
+	"beszel/internal/entities/system"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Supported output formats
+const (
+	FormatInflux     = "influx"
+	FormatPrometheus = "prometheus"
+)
+
+// Config holds the remote write destination settings
+type Config struct {
+	URL      string // write endpoint (e.g. http://influx:8086/api/v2/write?org=x&bucket=y)
+	Format   string // influx or prometheus
+	Token    string // sent as "Token <t>" for influx and "Bearer <t>" for prometheus
+	Username string // basic auth username
+	Password string // basic auth password
+	Limits   Limits // max series of each sub-series measurement per system
+}
+
+// Sample is a single metric value of a measurement
+type Sample struct {
+	Measurement string
+	Field       string
+	Tags        map[string]string
+	Value       float64
+}
+
+type batch struct {
+	samples []Sample
+	time    time.Time
+}
+
+// Writer sends samples to the remote endpoint in the background
+type Writer struct {
+	config Config
+	client *http.Client
+	logger *slog.Logger
+	queue  chan batch
+}
+
+// NewWriter validates the config and starts the background sender
+func NewWriter(config Config, logger *slog.Logger) (*Writer, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+	if config.Format == "" {
+		config.Format = FormatInflux
+	}
+	if config.Format != FormatInflux && config.Format != FormatPrometheus {
+		return nil, fmt.Errorf("invalid format %q", config.Format)
+	}
+	w := &Writer{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		logger: logger,
+		queue:  make(chan batch, 100),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Write queues samples to be sent. Samples are dropped if the queue is full
+// so a slow or unreachable endpoint never blocks system updates.
+func (w *Writer) Write(samples []Sample, t time.Time) {
+	if len(samples) == 0 {
+		return
+	}
+	select {
+	case w.queue <- batch{samples: samples, time: t}:
+	default:
+		w.logger.Warn("Remote write queue full, dropping samples")
+	}
+}
+
+// WriteSystem queues the stats of a system, applying the configured limits
+func (w *Writer) WriteSystem(systemName string, stats *system.Stats, containers []*container.Stats, t time.Time) {
+	w.Write(SystemSamples(systemName, stats, containers, w.config.Limits), t)
+}
+
+func (w *Writer) run() {
+	for b := range w.queue {
+		if err := w.send(b); err != nil {
+			w.logger.Error("Remote write failed", "err", err.Error())
+		}
+	}
+}
+
+func (w *Writer) send(b batch) error {
+	var body []byte
+	if w.config.Format == FormatPrometheus {
+		body = encodeRemoteWrite(b.samples, b.time)
+	} else {
+		body = encodeLineProtocol(b.samples, b.time)
+	}
+	req, err := http.NewRequest(http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if w.config.Format == FormatPrometheus {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	} else {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	switch {
+	case w.config.Token != "" && w.config.Format == FormatPrometheus:
+		req.Header.Set("Authorization", "Bearer "+w.config.Token)
+	case w.config.Token != "":
+		req.Header.Set("Authorization", "Token "+w.config.Token)
+	case w.config.Username != "":
+		req.SetBasicAuth(w.config.Username, w.config.Password)
+	}
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package remotewrite
+
+import (
+	"beszel/internal/entities/container"
+	"beszel/internal/entities/system"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Measurements with one series per core, gpu, container, filesystem or sensor,
+// whose number of series per system can be limited
+var subSeriesMeasurements = []string{"core", "gpu", "container", "fs", "temperature"}
+
+// Limits is the max number of series of each sub-series measurement written for
+// a system. Measurements without a limit are written in full, and a limit of 0
+// disables the measurement.
+type Limits map[string]int
+
+// ParseLimits parses comma separated limits, e.g. "container=50,core=0"
+func ParseLimits(s string) (Limits, error) {
+	limits := make(Limits)
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		measurement, value, _ := strings.Cut(item, "=")
+		if !slices.Contains(subSeriesMeasurements, measurement) {
+			return nil, fmt.Errorf("invalid measurement %q (valid: %s)", measurement, strings.Join(subSeriesMeasurements, ","))
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid limit %q for %s", value, measurement)
+		}
+		limits[measurement] = limit
+	}
+	return limits, nil
+}
+
+// Returns true if another series of the measurement can be written
+func (l Limits) allows(measurement string, written int) bool {
+	limit, ok := l[measurement]
+	return !ok || written < limit
+}
+
+// Converts system and container stats of a system to samples. Sub-series are
+// added in order of their name (or index for cores) until their limit is
+// reached, so the same series are kept from one update to the next.
+func SystemSamples(systemName string, stats *system.Stats, containers []*container.Stats, limits Limits) []Sample {
+	samples := make([]Sample, 0, 64)
+	add := func(measurement string, tags map[string]string, fields map[string]float64) {
+		for field, value := range fields {
+			samples = append(samples, Sample{Measurement: measurement, Field: field, Tags: tags, Value: value})
+		}
+	}
+
+	// missing groups are skipped so they aren't written as zero
+	systemTags := map[string]string{"system": systemName}
+	for group, fields := range stats.Fields() {
+		if !stats.IsMissing(group) {
+			add("system", systemTags, fields)
+		}
+	}
+	for i, usage := range stats.CpuCores {
+		if !limits.allows("core", i) {
+			break
+		}
+		add("core", map[string]string{"system": systemName, "core": strconv.Itoa(i)}, map[string]float64{"usage": usage})
+	}
+	for i, id := range slices.Sorted(maps.Keys(stats.GPUData)) {
+		if !limits.allows("gpu", i) {
+			break
+		}
+		gpu := stats.GPUData[id]
+		add("gpu", map[string]string{"system": systemName, "gpu": id, "name": gpu.Name}, map[string]float64{
+			"usage":     gpu.Usage,
+			"mem_used":  gpu.MemoryUsed,
+			"mem_total": gpu.MemoryTotal,
+			"power":     gpu.Power,
+			"processes": gpu.Processes,
+		})
+	}
+	for i, name := range slices.Sorted(maps.Keys(stats.ExtraFs)) {
+		if !limits.allows("fs", i) {
+			break
+		}
+		fs := stats.ExtraFs[name]
+		add("fs", map[string]string{"system": systemName, "fs": name}, map[string]float64{
+			"disk_total":         fs.DiskTotal,
+			"disk_used":          fs.DiskUsed,
+			"disk_read":          fs.DiskReadPs,
+			"disk_write":         fs.DiskWritePs,
+			"disk_read_latency":  fs.ReadLatency,
+			"disk_write_latency": fs.WriteLatency,
+			"disk_queue":         fs.QueueLength,
+		})
+	}
+	for i, sensor := range slices.Sorted(maps.Keys(stats.Temperatures)) {
+		if !limits.allows("temperature", i) {
+			break
+		}
+		add("temperature", map[string]string{"system": systemName, "sensor": sensor}, map[string]float64{"value": stats.Temperatures[sensor]})
+	}
+	containers = slices.SortedFunc(slices.Values(containers), func(a, b *container.Stats) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	for i, c := range containers {
+		if !limits.allows("container", i) {
+			break
+		}
+		tags := map[string]string{"system": systemName, "container": c.Name}
+		if c.Project != "" {
+			tags["project"] = c.Project
+			tags["service"] = c.Service
+		}
+		fields := map[string]float64{
+			"cpu":      c.Cpu,
+			"mem":      c.Mem,
+			"net_sent": c.NetworkSent,
+			"net_recv": c.NetworkRecv,
+		}
+		// only reported for virtual machines and containers read from cgroups
+		if c.DiskRead > 0 || c.DiskWrite > 0 {
+			fields["disk_read"] = c.DiskRead
+			fields["disk_write"] = c.DiskWrite
+		}
+		add("container", tags, fields)
+	}
+	return samples
+}
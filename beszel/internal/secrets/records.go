@@ -0,0 +1,98 @@
+package secrets
+
+import (
+	"slices"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cast"
+)
+
+// EncryptUserSettings encrypts the webhook urls in the settings of a
+// user_settings record. Returns true if any were changed.
+func EncryptUserSettings(record *core.Record) (bool, error) {
+	return updateWebhooks(record, EncryptAll)
+}
+
+// DecryptUserSettings decrypts the webhook urls in the settings of a
+// user_settings record. Returns true if any were changed.
+func DecryptUserSettings(record *core.Record) (bool, error) {
+	return updateWebhooks(record, DecryptAll)
+}
+
+func updateWebhooks(record *core.Record, update func([]string) error) (bool, error) {
+	settings := map[string]any{}
+	if err := record.UnmarshalJSONField("settings", &settings); err != nil || settings["webhooks"] == nil {
+		return false, nil
+	}
+	webhooks := cast.ToStringSlice(settings["webhooks"])
+	updated := slices.Clone(webhooks)
+	if err := update(updated); err != nil {
+		return false, err
+	}
+	if slices.Equal(webhooks, updated) {
+		return false, nil
+	}
+	settings["webhooks"] = updated
+	record.Set("settings", settings)
+	return true, nil
+}
+
+// EncryptStored encrypts credentials stored before encryption was enabled:
+// the SMTP and S3 settings, webhook urls of users and targets of queued
+// notifications. Does nothing if encryption is disabled.
+func EncryptStored(app core.App) error {
+	if !Enabled() {
+		return nil
+	}
+	// settings are encrypted by PocketBase when saved with its encryption key
+	if app.EncryptionEnv() != "" && settingsArePlain(app) {
+		if err := app.Save(app.Settings()); err != nil {
+			return err
+		}
+	}
+	userSettings, err := app.FindAllRecords("user_settings")
+	if err != nil {
+		return err
+	}
+	for _, record := range userSettings {
+		changed, err := EncryptUserSettings(record)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		if err := app.SaveNoValidate(record); err != nil {
+			return err
+		}
+	}
+	notifications, err := app.FindAllRecords("notification_queue")
+	if err != nil {
+		return err
+	}
+	for _, record := range notifications {
+		target := record.GetString("target")
+		if IsEncrypted(target) {
+			continue
+		}
+		encrypted, err := Encrypt(target)
+		if err != nil {
+			return err
+		}
+		record.Set("target", encrypted)
+		if err := app.SaveNoValidate(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns true if the stored settings are plain json
+func settingsArePlain(app core.App) bool {
+	var value string
+	if err := app.DB().NewQuery("SELECT value FROM _params WHERE id = 'settings'").Row(&value); err != nil {
+		return false
+	}
+	return json.Valid([]byte(value)) && len(value) > 0 && value[0] == '{'
+}
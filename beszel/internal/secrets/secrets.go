@@ -0,0 +1,184 @@
+// Package secrets encrypts credentials stored by the hub, like webhook urls,
+// with envelope encryption. Each value is encrypted with its own random data
+// key, which is encrypted (wrapped) with the master key from ENCRYPTION_KEY or
+// the file at ENCRYPTION_KEY_FILE. Without a master key values are stored as is.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Prefix of encrypted values, followed by the wrapped data key and the
+// ciphertext, both base64 encoded and separated by a colon
+const prefix = "enc:v1:"
+
+// ErrNoKey is returned when decrypting a value without a master key
+var ErrNoKey = errors.New("value is encrypted but ENCRYPTION_KEY is not set")
+
+// Key that wraps data keys, nil if encryption is disabled
+var masterKey []byte
+
+// Load reads the master key from ENCRYPTION_KEY or ENCRYPTION_KEY_FILE using
+// getEnv, so each binary can apply its own env var prefix. Keys of any length
+// are hashed to 32 bytes.
+func Load(getEnv func(key string) (string, bool)) error {
+	key, _ := getEnv("ENCRYPTION_KEY")
+	if path, exists := getEnv("ENCRYPTION_KEY_FILE"); exists && key == "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read encryption key: %w", err)
+		}
+		key = strings.TrimSpace(string(data))
+	}
+	if key == "" {
+		masterKey = nil
+		return nil
+	}
+	if len(key) < 16 {
+		return errors.New("encryption key must be at least 16 characters")
+	}
+	sum := sha256.Sum256([]byte(key))
+	masterKey = sum[:]
+	return nil
+}
+
+// Enabled returns true if a master key is loaded
+func Enabled() bool {
+	return masterKey != nil
+}
+
+// DeriveKey returns a 32 character key derived from the master key for
+// another purpose, e.g. the encryption of PocketBase's settings
+func DeriveKey(purpose string) string {
+	if masterKey == nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, masterKey)
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// IsEncrypted returns true if a value was encrypted by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt encrypts a value with a new data key. Empty and already encrypted
+// values, and all values when encryption is disabled, are returned as is.
+func Encrypt(value string) (string, error) {
+	if masterKey == nil || value == "" || IsEncrypted(value) {
+		return value, nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(masterKey, dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dataKey, []byte(value))
+	if err != nil {
+		return "", err
+	}
+	return prefix + base64.RawStdEncoding.EncodeToString(wrapped) + ":" + base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt decrypts a value from Encrypt. Values that aren't encrypted are
+// returned as is, so values stored before encryption was enabled keep working.
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if masterKey == nil {
+		return "", ErrNoKey
+	}
+	wrappedB64, ciphertextB64, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	if !ok {
+		return "", errors.New("invalid encrypted value")
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(wrappedB64)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(ciphertextB64)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := open(masterKey, wrapped)
+	if err != nil {
+		return "", errors.New("failed to decrypt data key, the encryption key may have changed")
+	}
+	plaintext, err := open(dataKey, ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// EncryptAll encrypts each value of a slice in place
+func EncryptAll(values []string) error {
+	for i, value := range values {
+		encrypted, err := Encrypt(value)
+		if err != nil {
+			return err
+		}
+		values[i] = encrypted
+	}
+	return nil
+}
+
+// DecryptAll decrypts each value of a slice in place
+func DecryptAll(values []string) error {
+	for i, value := range values {
+		decrypted, err := Decrypt(value)
+		if err != nil {
+			return err
+		}
+		values[i] = decrypted
+	}
+	return nil
+}
+
+// Encrypts with AES-GCM, prepending the nonce to the ciphertext
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypts the output of seal
+func open(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("invalid encrypted value")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,113 @@
+package secrets
+
+import (
+	"strings"
+	"testing"
+)
+
+// Loads a master key for a test and removes it after
+func loadKey(t *testing.T, key string) {
+	t.Helper()
+	t.Cleanup(func() { masterKey = nil })
+	err := Load(func(name string) (string, bool) {
+		if name == "ENCRYPTION_KEY" && key != "" {
+			return key, true
+		}
+		return "", false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	tests := []struct {
+		name          string
+		key           string
+		value         string
+		wantEncrypted bool
+	}{
+		{name: "webhook url", key: "0123456789abcdef", value: "discord://token@channel", wantEncrypted: true},
+		{name: "unicode", key: "0123456789abcdef", value: "ntfy://ntfy.sh/überwachung", wantEncrypted: true},
+		{name: "empty value", key: "0123456789abcdef", value: "", wantEncrypted: false},
+		{name: "no key", key: "", value: "discord://token@channel", wantEncrypted: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadKey(t, tt.key)
+			encrypted, err := Encrypt(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if IsEncrypted(encrypted) != tt.wantEncrypted {
+				t.Fatalf("Encrypt(%q) = %q, encrypted %v, want %v", tt.value, encrypted, IsEncrypted(encrypted), tt.wantEncrypted)
+			}
+			if tt.wantEncrypted && strings.Contains(encrypted, tt.value) {
+				t.Fatalf("Encrypt(%q) = %q contains the value", tt.value, encrypted)
+			}
+			// encrypting twice doesn't wrap the value again
+			if again, _ := Encrypt(encrypted); again != encrypted {
+				t.Fatalf("Encrypt of an encrypted value = %q, want %q", again, encrypted)
+			}
+			decrypted, err := Decrypt(encrypted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decrypted != tt.value {
+				t.Fatalf("Decrypt(Encrypt(%q)) = %q", tt.value, decrypted)
+			}
+		})
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	loadKey(t, "0123456789abcdef")
+	valid, err := Encrypt("discord://token@channel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		key   string
+		value string
+	}{
+		{name: "no key", key: "", value: valid},
+		{name: "other key", key: "fedcba9876543210", value: valid},
+		{name: "missing ciphertext", key: "0123456789abcdef", value: prefix + "abc"},
+		{name: "invalid base64", key: "0123456789abcdef", value: prefix + "!!!:!!!"},
+		{name: "truncated", key: "0123456789abcdef", value: valid[:len(valid)-8]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadKey(t, tt.key)
+			if decrypted, err := Decrypt(tt.value); err == nil {
+				t.Fatalf("Decrypt(%q) = %q, want error", tt.value, decrypted)
+			}
+		})
+	}
+}
+
+func TestDecryptAll(t *testing.T) {
+	loadKey(t, "0123456789abcdef")
+	values := []string{"discord://token@channel", "plain://stored-before-encryption", ""}
+	encrypted := []string{values[0], values[1], values[2]}
+	if err := EncryptAll(encrypted[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecryptAll(encrypted); err != nil {
+		t.Fatal(err)
+	}
+	for i := range values {
+		if encrypted[i] != values[i] {
+			t.Errorf("value %d = %q, want %q", i, encrypted[i], values[i])
+		}
+	}
+}
+
+func TestLoadShortKey(t *testing.T) {
+	t.Cleanup(func() { masterKey = nil })
+	err := Load(func(name string) (string, bool) { return "short", name == "ENCRYPTION_KEY" })
+	if err == nil {
+		t.Fatal("Load with a short key succeeded, want error")
+	}
+}
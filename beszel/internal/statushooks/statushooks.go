@@ -0,0 +1,152 @@
+// Package statushooks posts every system status change to webhooks configured
+// by the hub admin, independent of users' alert settings.
+package statushooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Config holds the webhook destinations
+type Config struct {
+	URLs   []string // endpoints that receive every event
+	Secret string   // signs the body with HMAC-SHA256 in the X-Beszel-Signature header
+}
+
+// System that changed status
+type System struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Host string `json:"host"`
+	Port string `json:"port"`
+}
+
+// Event is the JSON body posted to each webhook
+type Event struct {
+	Type     string    `json:"type"` // always "status"
+	System   System    `json:"system"`
+	Status   string    `json:"status"`
+	Previous string    `json:"previous"`
+	Time     time.Time `json:"time"`
+}
+
+// Sender posts events to the webhooks in the background, in the order they happened
+type Sender struct {
+	config Config
+	client *http.Client
+	logger *slog.Logger
+	queue  chan Event
+}
+
+// Number of attempts to deliver an event to a webhook
+const maxAttempts = 3
+
+// NewSender validates the config and starts the background sender
+func NewSender(config Config, logger *slog.Logger) (*Sender, error) {
+	if len(config.URLs) == 0 {
+		return nil, fmt.Errorf("missing url")
+	}
+	for _, u := range config.URLs {
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("invalid url %q", u)
+		}
+	}
+	s := &Sender{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		logger: logger,
+		queue:  make(chan Event, 1000),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Send queues an event. Events are dropped if the queue is full so an
+// unreachable webhook never blocks status updates.
+func (s *Sender) Send(system System, status, previous string) {
+	event := Event{
+		Type:     "status",
+		System:   system,
+		Status:   status,
+		Previous: previous,
+		Time:     time.Now().UTC(),
+	}
+	select {
+	case s.queue <- event:
+	default:
+		s.logger.Warn("Status webhook queue full, dropping event", "system", system.Name, "status", status)
+	}
+}
+
+func (s *Sender) run() {
+	for event := range s.queue {
+		body, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		for _, u := range s.config.URLs {
+			if err := s.post(u, body); err != nil {
+				s.logger.Error("Status webhook failed", "url", redact(u), "err", err.Error())
+			}
+		}
+	}
+}
+
+// Posts a body to a webhook, retrying with backoff on errors
+func (s *Sender) post(u string, body []byte) error {
+	backoff := time.Second
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = s.postOnce(u, body); err == nil {
+			return nil
+		}
+		if attempt < maxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return err
+}
+
+func (s *Sender) postOnce(u string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Beszel")
+	if s.config.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.config.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Beszel-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", res.Status)
+	}
+	return nil
+}
+
+// Removes credentials and query parameters from a url for logging
+func redact(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "invalid url"
+	}
+	parsed.User = nil
+	parsed.RawQuery = ""
+	return strings.TrimSuffix(parsed.String(), "?")
+}
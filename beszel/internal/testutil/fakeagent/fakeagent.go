@@ -0,0 +1,133 @@
+//go:build testing
+
+// Package fakeagent provides an agent for integration tests that serves scripted
+// system data over SSH, like a real agent, so collectors and alert logic can be
+// tested against a hub without real systems.
+//
+// It's only built with the testing tag: go test -tags testing ./...
+package fakeagent
+
+import (
+	"beszel/internal/entities/system"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+
+	sshServer "github.com/gliderlabs/ssh"
+)
+
+// Agent is a fake agent listening on a random localhost port
+type Agent struct {
+	mutex     sync.Mutex
+	listener  net.Listener
+	server    *sshServer.Server
+	script    []system.CombinedData
+	next      int
+	requests  int
+	processes system.ProcessList
+}
+
+// New starts a fake agent that accepts connections from the hub with the given
+// public key (in authorized_keys format). Each stats request returns the next
+// entry of data, and the last entry is repeated once the script runs out.
+func New(hubPublicKey []byte, data ...system.CombinedData) (*Agent, error) {
+	allowed, _, _, _, err := sshServer.ParseAuthorizedKey(hubPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	a := &Agent{listener: listener, script: data}
+	a.server = &sshServer.Server{
+		Handler: a.handleSession,
+		PublicKeyHandler: func(ctx sshServer.Context, key sshServer.PublicKey) bool {
+			return sshServer.KeysEqual(key, allowed)
+		},
+	}
+	a.server.SetOption(sshServer.NoPty())
+	go a.server.Serve(listener)
+	return a, nil
+}
+
+// Addr returns the host:port the agent listens on
+func (a *Agent) Addr() string {
+	return a.listener.Addr().String()
+}
+
+// HostPort returns the host and port of the agent, as saved in a system record
+func (a *Agent) HostPort() (host, port string) {
+	host, port, _ = net.SplitHostPort(a.Addr())
+	return host, port
+}
+
+// Push appends data to the script
+func (a *Agent) Push(data ...system.CombinedData) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.script = append(a.script, data...)
+}
+
+// SetProcesses sets the response to processes requests
+func (a *Agent) SetProcesses(processes system.ProcessList) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.processes = processes
+}
+
+// Requests returns the number of stats requests served
+func (a *Agent) Requests() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.requests
+}
+
+// Close stops the agent and closes open connections. The listener is closed
+// as well, in case the server hasn't started serving it yet.
+func (a *Agent) Close() error {
+	err := a.server.Close()
+	a.listener.Close()
+	return err
+}
+
+// Returns the next entry of the script
+func (a *Agent) nextData() (system.CombinedData, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if len(a.script) == 0 {
+		return system.CombinedData{}, errors.New("no data scripted")
+	}
+	data := a.script[min(a.next, len(a.script)-1)]
+	a.next++
+	a.requests++
+	return data, nil
+}
+
+// Responds like a real agent: sessions without a command or with the stats
+// command request system stats
+func (a *Agent) handleSession(s sshServer.Session) {
+	var data any
+	switch cmd := s.Command(); {
+	case len(cmd) > 0 && cmd[0] == "processes":
+		a.mutex.Lock()
+		data = a.processes
+		a.mutex.Unlock()
+	case len(cmd) > 0 && cmd[0] != "stats":
+		s.Exit(1)
+		return
+	default:
+		stats, err := a.nextData()
+		if err != nil {
+			s.Exit(1)
+			return
+		}
+		data = stats
+	}
+	if err := json.NewEncoder(s).Encode(data); err != nil {
+		s.Exit(1)
+		return
+	}
+	s.Exit(0)
+}
@@ -0,0 +1,162 @@
+//go:build testing
+
+// Package fakehub provides a hub for integration tests that accepts agent
+// registrations over https and collects stats from agents over SSH, like a real
+// hub, so agents and collectors can be tested without running PocketBase.
+//
+// It's only built with the testing tag: go test -tags testing ./...
+package fakehub
+
+import (
+	"beszel/internal/entities/system"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Registration is a request from an agent to /api/beszel/register
+type Registration struct {
+	Token       string `json:"token"`
+	Name        string `json:"name"`
+	Host        string `json:"host"`
+	Port        string `json:"port"`
+	Transport   string `json:"transport"`
+	Fingerprint string `json:"fingerprint"`
+	Secret      string `json:"secret"`
+}
+
+// Hub is a fake hub with its own SSH key and https server
+type Hub struct {
+	URL           string // https URL that agents register with
+	Token         string // enrollment token accepted by the hub
+	PublicKey     []byte // public key sent to agents, in authorized_keys format
+	server        *httptest.Server
+	sshConfig     *ssh.ClientConfig
+	mutex         sync.Mutex
+	registrations []Registration
+}
+
+// New starts a fake hub that accepts registrations with the enrollment token.
+// Its certificate is self-signed, so agents need HUB_CERT_FINGERPRINT set to
+// CertFingerprint to register.
+func New(token string) (*Hub, error) {
+	_, privKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(privKey)
+	if err != nil {
+		return nil, err
+	}
+	h := &Hub{
+		Token:     token,
+		PublicKey: ssh.MarshalAuthorizedKey(signer.PublicKey()),
+		sshConfig: &ssh.ClientConfig{
+			User:            "u",
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         4 * time.Second,
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/beszel/register", h.handleRegister)
+	h.server = httptest.NewTLSServer(mux)
+	h.URL = h.server.URL
+	return h, nil
+}
+
+// CertFingerprint returns the SHA-256 fingerprint of the hub's certificate
+func (h *Hub) CertFingerprint() string {
+	sum := sha256.Sum256(h.server.Certificate().Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Registrations returns the registrations received so far
+func (h *Hub) Registrations() []Registration {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]Registration(nil), h.registrations...)
+}
+
+// Close stops the hub's https server
+func (h *Hub) Close() {
+	h.server.Close()
+}
+
+// Responds with the hub's public key if the token is valid, like the real hub.
+// Agents without a secret get one, as when the real hub creates their system.
+func (h *Hub) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var req Registration
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message":"Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(h.Token)) != 1 {
+		http.Error(w, `{"message":"Invalid token"}`, http.StatusUnauthorized)
+		return
+	}
+	if req.Host == "" {
+		req.Host, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+	h.mutex.Lock()
+	h.registrations = append(h.registrations, req)
+	h.mutex.Unlock()
+	res := map[string]string{"key": strings.TrimSpace(string(h.PublicKey))}
+	if req.Secret == "" {
+		secret := make([]byte, 24)
+		rand.Read(secret)
+		res["secret"] = hex.EncodeToString(secret)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// Collect requests system stats from the agent at addr (host:port)
+func (h *Hub) Collect(addr string) (system.CombinedData, error) {
+	var data system.CombinedData
+	err := h.Request(addr, "", &data)
+	return data, err
+}
+
+// Request runs a command on the agent at addr and decodes the json response
+// into data. An empty command requests system stats.
+func (h *Hub) Request(addr, command string, data any) error {
+	client, err := ssh.Dial("tcp", addr, h.sshConfig)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if command == "" {
+		err = session.Shell()
+	} else {
+		err = session.Start(command)
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.NewDecoder(stdout).Decode(data); err != nil {
+		return errors.Join(err, session.Wait())
+	}
+	return session.Wait()
+}
@@ -3,7 +3,7 @@ package users
 
 import (
 	"beszel/migrations"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 
@@ -12,19 +12,22 @@ import (
 )
 
 type UserManager struct {
-	app *pocketbase.PocketBase
+	app    *pocketbase.PocketBase
+	logger *slog.Logger
 }
 
 type UserSettings struct {
-	ChartTime            string   `json:"chartTime"`
-	NotificationEmails   []string `json:"emails"`
-	NotificationWebhooks []string `json:"webhooks"`
+	ChartTime             string         `json:"chartTime"`
+	NotificationEmails    []string       `json:"emails"`
+	NotificationWebhooks  []string       `json:"webhooks"`
+	NotificationTemplates map[string]any `json:"templates,omitempty"`
 	// Language             string   `json:"lang"`
 }
 
-func NewUserManager(app *pocketbase.PocketBase) *UserManager {
+func NewUserManager(app *pocketbase.PocketBase, logger *slog.Logger) *UserManager {
 	return &UserManager{
-		app: app,
+		app:    app,
+		logger: logger,
 	}
 }
 
@@ -54,10 +57,10 @@ func (um *UserManager) InitializeUserSettings(e *core.RecordEvent) error {
 			if user := record.ExpandedOne("user"); user != nil {
 				settings.NotificationEmails = []string{user.GetString("email")}
 			} else {
-				log.Println("Failed to get user email from auth record")
+				um.logger.Error("Failed to get user email from auth record")
 			}
 		} else {
-			log.Println("failed to expand user relation", "errs", errs)
+			um.logger.Error("Failed to expand user relation", "errs", errs)
 		}
 	}
 	// if len(settings.NotificationWebhooks) == 0 {
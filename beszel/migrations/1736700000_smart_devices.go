@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create smart_devices collection
+		collection := core.NewBaseCollection("smart_devices")
+		collection.ListRule = types.Pointer("@request.auth.id != \"\" && system.users.id ?= @request.auth.id")
+		collection.ViewRule = collection.ListRule
+		collection.Fields.Add(
+			&core.RelationField{Name: "system", CollectionId: "2hz5ncl8tizk5nx", MaxSelect: 1, Required: true, CascadeDelete: true},
+			&core.TextField{Name: "name", Required: true},
+			&core.TextField{Name: "type"},
+			&core.TextField{Name: "model"},
+			&core.TextField{Name: "serial"},
+			&core.TextField{Name: "firmware"},
+			&core.NumberField{Name: "capacity"},
+			&core.TextField{Name: "state"},
+			&core.NumberField{Name: "temp"},
+			&core.NumberField{Name: "hours"},
+			&core.NumberField{Name: "cycles"},
+			&core.NumberField{Name: "reallocated"},
+			&core.NumberField{Name: "media_errors"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_smart_devices_system_name", true, "system, name", "")
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+		// add SMART alert type
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = append(field.Values, "SMART")
+		}
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("smart_devices")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
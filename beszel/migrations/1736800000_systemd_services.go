@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create systemd_services collection
+		collection := core.NewBaseCollection("systemd_services")
+		collection.ListRule = types.Pointer("@request.auth.id != \"\" && system.users.id ?= @request.auth.id")
+		collection.ViewRule = collection.ListRule
+		collection.Fields.Add(
+			&core.RelationField{Name: "system", CollectionId: "2hz5ncl8tizk5nx", MaxSelect: 1, Required: true, CascadeDelete: true},
+			&core.TextField{Name: "name", Required: true},
+			&core.TextField{Name: "state"},
+			&core.TextField{Name: "sub"},
+			&core.NumberField{Name: "cpu"},
+			&core.NumberField{Name: "mem"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_systemd_services_system_name", true, "system, name", "")
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+		// add Service alert type
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = append(field.Values, "Service")
+		}
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("systemd_services")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// add site, tags and dependency fields to systems
+		collection, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		collection.Fields.Add(
+			&core.TextField{Name: "site"},
+			&core.JSONField{Name: "tags", MaxSize: 2000},
+			&core.RelationField{Name: "depends_on", CollectionId: collection.Id, MaxSelect: 99},
+		)
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		collection.Fields.RemoveByName("site")
+		collection.Fields.RemoveByName("tags")
+		collection.Fields.RemoveByName("depends_on")
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// add ttl field (hours) to systems for automatic deletion of ephemeral systems
+		collection, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		collection.Fields.Add(&core.NumberField{Name: "ttl", Min: types.Pointer(0.0), OnlyInt: true})
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		collection.Fields.RemoveByName("ttl")
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// add GPU Memory alert type
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = append(field.Values, "GPU Memory")
+		}
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = slices.DeleteFunc(field.Values, func(v string) bool { return v == "GPU Memory" })
+		}
+		return app.Save(alerts)
+	})
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create silences collection (global notification silences, kept as an audit log)
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection := core.NewBaseCollection("silences")
+		collection.ListRule = types.Pointer("@request.auth.role = \"admin\"")
+		collection.ViewRule = collection.ListRule
+		collection.Fields.Add(
+			&core.RelationField{Name: "user", CollectionId: users.Id, MaxSelect: 1},
+			&core.TextField{Name: "reason"},
+			&core.DateField{Name: "expires", Required: true},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_silences_expires", false, "expires", "")
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("silences")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
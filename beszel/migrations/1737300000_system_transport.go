@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// add transport field to systems so agents can be reached over https (mTLS) instead of ssh
+		collection, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		collection.Fields.Add(&core.SelectField{Name: "transport", Values: []string{"ssh", "https"}, MaxSelect: 1})
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		collection.Fields.RemoveByName("transport")
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create status_pages collection (public status pages for a subset of systems)
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection := core.NewBaseCollection("status_pages")
+		collection.ListRule = types.Pointer("@request.auth.id != \"\" && user.id = @request.auth.id")
+		collection.ViewRule = collection.ListRule
+		collection.CreateRule = types.Pointer("@request.auth.id != \"\" && @request.body.user = @request.auth.id && @request.auth.role != \"readonly\"")
+		collection.UpdateRule = types.Pointer("@request.auth.id != \"\" && user.id = @request.auth.id && @request.auth.role != \"readonly\" && @request.body.user:isset = false")
+		collection.DeleteRule = types.Pointer("@request.auth.id != \"\" && user.id = @request.auth.id && @request.auth.role != \"readonly\"")
+		collection.Fields.Add(
+			&core.RelationField{Name: "user", CollectionId: users.Id, MaxSelect: 1, Required: true, CascadeDelete: true},
+			&core.TextField{Name: "name", Required: true, Max: 100},
+			// the slug is random so it acts as the page's access token, and can be rotated
+			&core.TextField{Name: "slug", Required: true, Min: 16, Max: 64, Pattern: "^[a-z0-9]+$", AutogeneratePattern: "[a-z0-9]{20}"},
+			&core.RelationField{Name: "systems", CollectionId: "2hz5ncl8tizk5nx", MaxSelect: 99, CascadeDelete: false},
+			&core.BoolField{Name: "enabled"},
+			&core.BoolField{Name: "charts"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_status_pages_slug", true, "slug", "")
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("status_pages")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
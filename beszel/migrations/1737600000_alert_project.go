@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// alerts can target a docker compose project instead of the whole system
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		alerts.Fields.Add(&core.TextField{Name: "project"})
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		alerts.Fields.RemoveByName("project")
+		return app.Save(alerts)
+	})
+}
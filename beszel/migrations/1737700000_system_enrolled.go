@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// marks systems created by agent auto-registration, used for enrollment quotas
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.Add(&core.BoolField{Name: "enrolled", Hidden: true})
+		return app.Save(systems)
+	}, func(app core.App) error {
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.RemoveByName("enrolled")
+		return app.Save(systems)
+	})
+}
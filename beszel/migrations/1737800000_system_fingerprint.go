@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// identity of the agent, used to match registrations to existing systems
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.Add(&core.TextField{Name: "fingerprint", Max: 128, Hidden: true})
+		systems.AddIndex("idx_systems_fingerprint", false, "fingerprint", "")
+		return app.Save(systems)
+	}, func(app core.App) error {
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.RemoveIndex("idx_systems_fingerprint")
+		systems.Fields.RemoveByName("fingerprint")
+		return app.Save(systems)
+	})
+}
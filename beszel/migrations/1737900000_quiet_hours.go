@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create quiet_hours collection (windows during which a user's notifications are suppressed)
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection := core.NewBaseCollection("quiet_hours")
+		collection.ListRule = types.Pointer("@request.auth.id != \"\" && user.id = @request.auth.id")
+		collection.ViewRule = collection.ListRule
+		collection.CreateRule = types.Pointer("@request.auth.id != \"\" && user.id = @request.auth.id && (system = \"\" || system.users.id ?= @request.auth.id)")
+		collection.UpdateRule = collection.CreateRule
+		collection.DeleteRule = collection.ListRule
+		collection.Fields.Add(
+			&core.RelationField{Name: "user", CollectionId: users.Id, MaxSelect: 1, Required: true, CascadeDelete: true},
+			// optional, applies to all of the user's systems if empty
+			&core.RelationField{Name: "system", CollectionId: "2hz5ncl8tizk5nx", MaxSelect: 1, CascadeDelete: true},
+			&core.TextField{Name: "name"},
+			&core.SelectField{Name: "repeat", Values: []string{"once", "daily", "weekly"}, MaxSelect: 1, Required: true},
+			// start and end of the first window, later windows repeat at the same local time
+			&core.DateField{Name: "start", Required: true},
+			&core.DateField{Name: "end", Required: true},
+			&core.TextField{Name: "timezone"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_quiet_hours_user", false, "user", "")
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("quiet_hours")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
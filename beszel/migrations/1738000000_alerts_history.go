@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create alerts_history collection (every time an alert triggers and when it resolves)
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		collection := core.NewBaseCollection("alerts_history")
+		collection.ListRule = types.Pointer("@request.auth.id != \"\" && user.id = @request.auth.id")
+		collection.ViewRule = collection.ListRule
+		collection.DeleteRule = collection.ListRule
+		collection.Fields.Add(
+			// history is kept when the alert is deleted
+			&core.RelationField{Name: "alert", CollectionId: alerts.Id, MaxSelect: 1},
+			&core.RelationField{Name: "user", CollectionId: users.Id, MaxSelect: 1, Required: true, CascadeDelete: true},
+			&core.RelationField{Name: "system", CollectionId: "2hz5ncl8tizk5nx", MaxSelect: 1, Required: true, CascadeDelete: true},
+			&core.TextField{Name: "name", Required: true},
+			&core.TextField{Name: "project"},
+			&core.NumberField{Name: "value"},
+			&core.NumberField{Name: "threshold"},
+			&core.DateField{Name: "resolved"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_alerts_history_system_created", false, "system, created", "")
+		collection.AddIndex("idx_alerts_history_alert", false, "alert", "")
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("alerts_history")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
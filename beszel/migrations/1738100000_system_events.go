@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create system_events collection (systems added / removed and agent upgrades)
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection := core.NewBaseCollection("system_events")
+		collection.ListRule = types.Pointer("@request.auth.id != \"\" && users.id ?= @request.auth.id")
+		collection.ViewRule = collection.ListRule
+		collection.Fields.Add(
+			// system id and name are kept as text since the system may be deleted
+			&core.TextField{Name: "system", Required: true},
+			&core.TextField{Name: "name"},
+			&core.RelationField{Name: "users", CollectionId: users.Id, MaxSelect: 2147483647},
+			&core.SelectField{Name: "type", Values: []string{"added", "removed", "upgraded"}, MaxSelect: 1, Required: true},
+			&core.TextField{Name: "detail"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_system_events_created", false, "created", "")
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("system_events")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+var loadAverageAlerts = []string{"LoadAvg1", "LoadAvg5", "LoadAvg15"}
+
+func init() {
+	m.Register(func(app core.App) error {
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = append(field.Values, loadAverageAlerts...)
+		}
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = slices.DeleteFunc(field.Values, func(v string) bool {
+				return slices.Contains(loadAverageAlerts, v)
+			})
+		}
+		return app.Save(alerts)
+	})
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// minutes after an alert resolves during which it can't trigger again
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		alerts.Fields.Add(
+			&core.NumberField{Name: "cooldown", Min: types.Pointer(0.0), OnlyInt: true},
+			&core.DateField{Name: "resolved"},
+		)
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		alerts.Fields.RemoveByName("cooldown")
+		alerts.Fields.RemoveByName("resolved")
+		return app.Save(alerts)
+	})
+}
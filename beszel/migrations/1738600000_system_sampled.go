@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// time of the last successful sample, used to detect agents that stopped sending data
+		systems, err := app.FindCollectionByNameOrId("2hz5ncl8tizk5nx")
+		if err != nil {
+			return err
+		}
+		systems.Fields.Add(&core.DateField{Name: "sampled", Hidden: true})
+		if err := app.Save(systems); err != nil {
+			return err
+		}
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = append(field.Values, "Stale")
+		}
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		systems, err := app.FindCollectionByNameOrId("2hz5ncl8tizk5nx")
+		if err != nil {
+			return err
+		}
+		systems.Fields.RemoveByName("sampled")
+		if err := app.Save(systems); err != nil {
+			return err
+		}
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = slices.DeleteFunc(field.Values, func(v string) bool { return v == "Stale" })
+		}
+		return app.Save(alerts)
+	})
+}
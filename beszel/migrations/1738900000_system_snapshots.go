@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create system_snapshots collection (hardware, os and container configuration
+		// of a system, saved each time it changes)
+		collection := core.NewBaseCollection("system_snapshots")
+		collection.ListRule = types.Pointer("@request.auth.id != \"\" && system.users.id ?= @request.auth.id")
+		collection.ViewRule = collection.ListRule
+		collection.Fields.Add(
+			&core.RelationField{Name: "system", CollectionId: "2hz5ncl8tizk5nx", MaxSelect: 1, Required: true, CascadeDelete: true},
+			&core.JSONField{Name: "data", Required: true, MaxSize: 1 << 20},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+		collection.AddIndex("idx_system_snapshots_system_created", false, "system, created", "")
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("system_snapshots")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
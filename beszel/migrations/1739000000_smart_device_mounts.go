@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// filesystems on each disk, e.g. ["/"] for the disk holding the root filesystem
+		collection, err := app.FindCollectionByNameOrId("smart_devices")
+		if err != nil {
+			return err
+		}
+		collection.Fields.Add(&core.JSONField{Name: "mounts", MaxSize: 2000})
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("smart_devices")
+		if err != nil {
+			return err
+		}
+		collection.Fields.RemoveByName("mounts")
+		return app.Save(collection)
+	})
+}
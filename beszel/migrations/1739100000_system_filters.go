@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create system_filters collection (saved selector queries that define groups of systems)
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection := core.NewBaseCollection("system_filters")
+		// filters are shared so they can be used by everyone's dashboards and by alert configs
+		collection.ListRule = types.Pointer("@request.auth.id != \"\"")
+		collection.ViewRule = collection.ListRule
+		collection.CreateRule = types.Pointer("@request.auth.id != \"\" && @request.body.user = @request.auth.id && @request.auth.role != \"readonly\"")
+		collection.UpdateRule = types.Pointer("@request.auth.id != \"\" && (user.id = @request.auth.id || @request.auth.role = \"admin\") && @request.auth.role != \"readonly\" && @request.body.user:isset = false")
+		collection.DeleteRule = types.Pointer("@request.auth.id != \"\" && (user.id = @request.auth.id || @request.auth.role = \"admin\") && @request.auth.role != \"readonly\"")
+		collection.Fields.Add(
+			&core.RelationField{Name: "user", CollectionId: users.Id, MaxSelect: 1, Required: true, CascadeDelete: true},
+			&core.TextField{Name: "name", Required: true, Max: 100, Pattern: `^[\w.-]+$`},
+			&core.TextField{Name: "query", Required: true, Max: 1000},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_system_filters_name", true, "name", "")
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("system_filters")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
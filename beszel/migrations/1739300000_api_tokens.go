@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create api_tokens collection (user scoped tokens for programmatic access)
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection := core.NewBaseCollection("api_tokens")
+		// tokens are created with /api/beszel/tokens, which returns the token once
+		collection.ListRule = types.Pointer("@request.auth.id != \"\" && user.id = @request.auth.id")
+		collection.ViewRule = collection.ListRule
+		collection.DeleteRule = collection.ListRule
+		collection.Fields.Add(
+			&core.RelationField{Name: "user", CollectionId: users.Id, MaxSelect: 1, Required: true, CascadeDelete: true},
+			&core.TextField{Name: "name", Required: true, Max: 100},
+			&core.TextField{Name: "hash", Required: true, Hidden: true},
+			&core.TextField{Name: "prefix", Max: 20},
+			&core.SelectField{Name: "scopes", Required: true, MaxSelect: 3, Values: []string{"read:stats", "manage:systems", "manage:alerts"}},
+			&core.DateField{Name: "expires"},
+			&core.DateField{Name: "last_used"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_api_tokens_hash", true, "hash", "")
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("api_tokens")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create notification_channels collection (health of webhooks and the SMTP server)
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection := core.NewBaseCollection("notification_channels")
+		// records are managed by the hub. The SMTP server has no user and is only listed for admins.
+		collection.ListRule = types.Pointer("@request.auth.id != \"\" && (user.id = @request.auth.id || @request.auth.role = \"admin\")")
+		collection.ViewRule = collection.ListRule
+		collection.Fields.Add(
+			&core.RelationField{Name: "user", CollectionId: users.Id, MaxSelect: 1, CascadeDelete: true},
+			&core.TextField{Name: "key", Required: true, Hidden: true},
+			&core.TextField{Name: "name", Required: true},
+			&core.SelectField{Name: "type", Required: true, MaxSelect: 1, Values: []string{"email", "webhook", "shoutrrr"}},
+			&core.BoolField{Name: "healthy"},
+			&core.TextField{Name: "error"},
+			&core.DateField{Name: "checked"},
+			&core.DateField{Name: "failing_since"},
+			&core.BoolField{Name: "notified", Hidden: true},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_notification_channels_user_key", true, "user, key", "")
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("notification_channels")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create checks collection (user defined http / tcp checks of services)
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		collection := core.NewBaseCollection("checks")
+		collection.ListRule = types.Pointer("@request.auth.id != \"\" && user.id = @request.auth.id")
+		collection.ViewRule = collection.ListRule
+		// checks run by an agent need access to its system
+		collection.CreateRule = types.Pointer("@request.auth.id != \"\" && @request.body.user = @request.auth.id && @request.auth.role != \"readonly\" && (@request.body.system = \"\" || @request.body.system.users.id ?= @request.auth.id)")
+		collection.UpdateRule = types.Pointer("@request.auth.id != \"\" && user.id = @request.auth.id && @request.auth.role != \"readonly\" && @request.body.user:isset = false && (@request.body.system:isset = false || @request.body.system = \"\" || @request.body.system.users.id ?= @request.auth.id)")
+		collection.DeleteRule = types.Pointer("@request.auth.id != \"\" && user.id = @request.auth.id && @request.auth.role != \"readonly\"")
+		collection.Fields.Add(
+			&core.RelationField{Name: "user", CollectionId: users.Id, MaxSelect: 1, Required: true, CascadeDelete: true},
+			// empty to run the check from the hub
+			&core.RelationField{Name: "system", CollectionId: systems.Id, MaxSelect: 1, CascadeDelete: true},
+			&core.TextField{Name: "name", Required: true, Max: 100},
+			&core.SelectField{Name: "type", Required: true, MaxSelect: 1, Values: []string{"http", "tcp"}},
+			&core.TextField{Name: "target", Required: true, Max: 2000},
+			&core.NumberField{Name: "interval", Min: types.Pointer(30.0), Max: types.Pointer(86400.0), OnlyInt: true},
+			&core.NumberField{Name: "expected_status", Min: types.Pointer(0.0), Max: types.Pointer(599.0), OnlyInt: true},
+			&core.TextField{Name: "keyword", Max: 200},
+			// failed checks in a row before the status changes to down
+			&core.NumberField{Name: "retries", Min: types.Pointer(0.0), Max: types.Pointer(10.0), OnlyInt: true},
+			&core.BoolField{Name: "notify"},
+			&core.SelectField{Name: "status", MaxSelect: 1, Values: []string{"pending", "up", "down", "paused"}},
+			&core.NumberField{Name: "code"},
+			&core.NumberField{Name: "latency"},
+			&core.TextField{Name: "error"},
+			&core.NumberField{Name: "failures"},
+			&core.DateField{Name: "checked"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_checks_user", false, "user", "")
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("checks")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
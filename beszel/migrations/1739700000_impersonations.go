@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create impersonations collection (read only sessions of admins viewing as a user, kept as an audit log)
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection := core.NewBaseCollection("impersonations")
+		collection.ListRule = types.Pointer("@request.auth.role = \"admin\"")
+		collection.ViewRule = collection.ListRule
+		collection.Fields.Add(
+			&core.RelationField{Name: "admin", CollectionId: users.Id, MaxSelect: 1, Required: true},
+			&core.RelationField{Name: "user", CollectionId: users.Id, MaxSelect: 1, Required: true},
+			&core.TextField{Name: "reason", Max: 500},
+			&core.DateField{Name: "expires", Required: true},
+			&core.DateField{Name: "ended"},
+			&core.DateField{Name: "last_used"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_impersonations_created", false, "created", "")
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("impersonations")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create listening_ports collection
+		collection := core.NewBaseCollection("listening_ports")
+		collection.ListRule = types.Pointer("@request.auth.id != \"\" && system.users.id ?= @request.auth.id")
+		collection.ViewRule = collection.ListRule
+		collection.Fields.Add(
+			&core.RelationField{Name: "system", CollectionId: "2hz5ncl8tizk5nx", MaxSelect: 1, Required: true, CascadeDelete: true},
+			&core.TextField{Name: "proto", Required: true},
+			&core.TextField{Name: "address"},
+			&core.NumberField{Name: "port", OnlyInt: true},
+			&core.TextField{Name: "process"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_listening_ports_system_port", true, "system, proto, address, port", "")
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+		// add Port alert type
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = append(field.Values, "Port")
+		}
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = slices.DeleteFunc(field.Values, func(v string) bool { return v == "Port" })
+		}
+		if err := app.Save(alerts); err != nil {
+			return err
+		}
+		collection, err := app.FindCollectionByNameOrId("listening_ports")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
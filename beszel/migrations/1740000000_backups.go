@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create backups collection (result of each backup of the hub, to show their status and alert on stale backups)
+		collection := core.NewBaseCollection("backups")
+		collection.ListRule = types.Pointer("@request.auth.role = \"admin\"")
+		collection.ViewRule = collection.ListRule
+		collection.Fields.Add(
+			&core.TextField{Name: "name", Required: true},
+			&core.SelectField{Name: "storage", Values: []string{"local", "s3"}, MaxSelect: 1},
+			&core.NumberField{Name: "size", OnlyInt: true},
+			&core.NumberField{Name: "duration"},
+			&core.TextField{Name: "error"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+		collection.AddIndex("idx_backups_created", false, "created", "")
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("backups")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create notification_queue collection (notifications waiting to be sent, sent or failed)
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection := core.NewBaseCollection("notification_queue")
+		// records are managed by the hub. Users can dismiss their failed notifications.
+		collection.ListRule = types.Pointer("@request.auth.id != \"\" && (user.id = @request.auth.id || @request.auth.role = \"admin\")")
+		collection.ViewRule = collection.ListRule
+		collection.DeleteRule = types.Pointer("@request.auth.id != \"\" && user.id = @request.auth.id && status = \"failed\"")
+		collection.Fields.Add(
+			&core.RelationField{Name: "user", Required: true, CollectionId: users.Id, MaxSelect: 1, CascadeDelete: true},
+			&core.SelectField{Name: "type", Required: true, MaxSelect: 1, Values: []string{"email", "webhook", "shoutrrr"}},
+			// shoutrrr URL or email addresses
+			&core.TextField{Name: "target", Required: true, Hidden: true},
+			&core.TextField{Name: "title"},
+			&core.TextField{Name: "message", Max: 100000},
+			&core.TextField{Name: "link"},
+			&core.TextField{Name: "link_text"},
+			&core.SelectField{Name: "status", Required: true, MaxSelect: 1, Values: []string{"pending", "sent", "failed"}},
+			&core.NumberField{Name: "attempts", OnlyInt: true},
+			&core.DateField{Name: "next_attempt"},
+			&core.TextField{Name: "error"},
+			&core.DateField{Name: "sent"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_notification_queue_status_next_attempt", false, "status, next_attempt", "")
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("notification_queue")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
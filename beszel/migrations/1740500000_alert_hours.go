@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// add time zone of systems (IANA name, UTC if empty)
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.Add(&core.TextField{Name: "timezone", Max: 64})
+		if err := app.Save(systems); err != nil {
+			return err
+		}
+		// add hours during which alerts can trigger, e.g. "mon-fri 09:00-17:00"
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		alerts.Fields.Add(&core.TextField{Name: "hours", Max: 64})
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.RemoveByName("timezone")
+		if err := app.Save(systems); err != nil {
+			return err
+		}
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		alerts.Fields.RemoveByName("hours")
+		return app.Save(alerts)
+	})
+}
@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// create guests collection for virtual machines of hypervisor hosts
+		collection := core.NewBaseCollection("guests")
+		collection.ListRule = types.Pointer("@request.auth.id != \"\" && system.users.id ?= @request.auth.id")
+		collection.ViewRule = collection.ListRule
+		collection.Fields.Add(
+			&core.RelationField{Name: "system", CollectionId: "2hz5ncl8tizk5nx", MaxSelect: 1, Required: true, CascadeDelete: true},
+			&core.TextField{Name: "name", Required: true},
+			&core.TextField{Name: "hypervisor"},
+			&core.TextField{Name: "state"},
+			&core.NumberField{Name: "vcpus", OnlyInt: true},
+			&core.NumberField{Name: "mem_max"},
+			&core.NumberField{Name: "cpu"},
+			&core.NumberField{Name: "mem"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_guests_system_name", true, "system, name", "")
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("guests")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
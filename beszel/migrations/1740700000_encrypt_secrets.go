@@ -0,0 +1,18 @@
+package migrations
+
+import (
+	"beszel/internal/secrets"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// encrypt existing credentials if an encryption key is set. The hub
+		// also does this on start, for keys that are set after upgrading.
+		return secrets.EncryptStored(app)
+	}, func(app core.App) error {
+		return nil
+	})
+}
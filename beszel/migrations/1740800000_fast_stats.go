@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// opt-in 10 second polling of systems
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.Add(&core.BoolField{Name: "fast_polling"})
+		if err := app.Save(systems); err != nil {
+			return err
+		}
+		// 10 second stats, kept separately from system_stats with their own retention
+		collection := core.NewBaseCollection("fast_stats")
+		collection.ListRule = types.Pointer("@request.auth.id != \"\" && system.users.id ?= @request.auth.id")
+		collection.ViewRule = collection.ListRule
+		collection.Fields.Add(
+			&core.RelationField{Name: "system", CollectionId: "2hz5ncl8tizk5nx", MaxSelect: 1, Required: true, CascadeDelete: true},
+			&core.JSONField{Name: "stats", Required: true},
+			&core.SelectField{Name: "type", Values: []string{"10s"}, MaxSelect: 1},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+		collection.AddIndex("idx_fast_stats_system_created", false, "system, created", "")
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("fast_stats")
+		if err != nil {
+			return err
+		}
+		if err := app.Delete(collection); err != nil {
+			return err
+		}
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.RemoveByName("fast_polling")
+		return app.Save(systems)
+	})
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// address or transport an agent registered with that an admin has to approve
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.Add(
+			&core.JSONField{Name: "pending_move"},
+			&core.TextField{Name: "pending_fingerprint", Max: 128, Hidden: true},
+		)
+		return app.Save(systems)
+	}, func(app core.App) error {
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.RemoveByName("pending_move")
+		systems.Fields.RemoveByName("pending_fingerprint")
+		return app.Save(systems)
+	})
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// time a system went down, used to delete systems with a ttl
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.Add(&core.DateField{Name: "down_since"})
+		if err := app.Save(systems); err != nil {
+			return err
+		}
+		// systems that are already down count from their last update
+		_, err = app.DB().Update("systems", dbx.Params{"down_since": dbx.NewExp("updated")}, dbx.HashExp{"status": "down"}).Execute()
+		return err
+	}, func(app core.App) error {
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.RemoveByName("down_since")
+		return app.Save(systems)
+	})
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// hashes of the secret the hub issued to a system's agent at registration
+		// and of the one issued with a move that an admin has to approve
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.Add(
+			&core.TextField{Name: "agent_secret", Max: 64, Hidden: true},
+			&core.TextField{Name: "pending_secret", Max: 64, Hidden: true},
+		)
+		return app.Save(systems)
+	}, func(app core.App) error {
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.RemoveByName("agent_secret")
+		systems.Fields.RemoveByName("pending_secret")
+		return app.Save(systems)
+	})
+}
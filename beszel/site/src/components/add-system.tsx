@@ -124,6 +124,15 @@ export function AddSystemButton({ className }: { className?: string }) {
 								<Trans>Port</Trans>
 							</Label>
 							<Input ref={port} name="port" id="port" defaultValue="45876" className="" required />
+							<Label htmlFor="timezone" className="xs:text-end">
+								<Trans>Time zone</Trans>
+							</Label>
+							<Input
+								id="timezone"
+								name="timezone"
+								defaultValue={Intl.DateTimeFormat().resolvedOptions().timeZone}
+								placeholder="UTC"
+							/>
 							<Label htmlFor="pkey" className="xs:text-end whitespace-pre">
 								<Trans comment="Use 'Key' if your language requires many more characters">Public Key</Trans>
 							</Label>
@@ -1,6 +1,6 @@
-import { memo, useState } from "react"
+import { memo, useEffect, useState } from "react"
 import { useStore } from "@nanostores/react"
-import { $alerts, $systems } from "@/lib/stores"
+import { $alerts, $systems, pb } from "@/lib/stores"
 import {
 	Dialog,
 	DialogTrigger,
@@ -9,10 +9,10 @@ import {
 	DialogHeader,
 	DialogTitle,
 } from "@/components/ui/dialog"
-import { BellIcon, GlobeIcon, ServerIcon } from "lucide-react"
-import { alertInfo, cn } from "@/lib/utils"
+import { BellIcon, GaugeIcon, GlobeIcon, HistoryIcon, LayersIcon, ServerIcon } from "lucide-react"
+import { alertInfo, cn, formatShortDate } from "@/lib/utils"
 import { Button } from "@/components/ui/button"
-import { AlertRecord, SystemRecord } from "@/types"
+import { AlertHistoryRecord, AlertRecord, ContainerStatsRecord, SystemRecord, SystemStatsRecord } from "@/types"
 import { Link } from "../router"
 import { Tabs, TabsContent, TabsList, TabsTrigger } from "@/components/ui/tabs"
 import { Checkbox } from "../ui/checkbox"
@@ -87,6 +87,10 @@ function TheContent({
 						<GlobeIcon className="me-1.5 h-3.5 w-3.5" />
 						<Trans>All Systems</Trans>
 					</TabsTrigger>
+					<TabsTrigger value="history">
+						<HistoryIcon className="me-1.5 h-3.5 w-3.5" />
+						<Trans>History</Trans>
+					</TabsTrigger>
 				</TabsList>
 				<TabsContent value="system">
 					<div className="grid gap-3">
@@ -94,6 +98,8 @@ function TheContent({
 							<SystemAlert key={d.key} system={system} data={d} systemAlerts={systemAlerts} />
 						))}
 					</div>
+					<ProjectAlerts system={system} systemAlerts={systemAlerts} />
+					<GpuEngineAlerts system={system} systemAlerts={systemAlerts} />
 				</TabsContent>
 				<TabsContent value="global">
 					<label
@@ -114,7 +120,160 @@ function TheContent({
 						))}
 					</div>
 				</TabsContent>
+				<TabsContent value="history">
+					<AlertHistory system={system} />
+				</TabsContent>
 			</Tabs>
 		</>
 	)
 }
+
+/** CPU and memory alerts for each docker compose project of the system */
+function ProjectAlerts({ system, systemAlerts }: { system: SystemRecord; systemAlerts: AlertRecord[] }) {
+	const [projects, setProjects] = useState<string[]>([])
+
+	useEffect(() => {
+		pb.collection<ContainerStatsRecord>("container_stats")
+			.getFirstListItem(pb.filter("system={:system}", { system: system.id }), {
+				sort: "-created",
+				fields: "stats",
+			})
+			.then(({ stats }) => {
+				const names = new Set(stats.map((c) => c.p).filter(Boolean) as string[])
+				// include projects with existing alerts that no longer have running containers
+				for (const alert of systemAlerts) {
+					alert.project && names.add(alert.project)
+				}
+				setProjects([...names].sort())
+			})
+			.catch(() => setProjects([]))
+	}, [system.id])
+
+	if (!projects.length) {
+		return null
+	}
+
+	return (
+		<>
+			{projects.map((project) => (
+				<div key={project} className="mt-5">
+					<h4 className="font-semibold mb-3 flex gap-2 items-center">
+						<LayersIcon className="h-4 w-4 opacity-85" />
+						{project}
+					</h4>
+					<div className="grid gap-3">
+						{(["CPU", "Memory"] as const).map((key) => (
+							<SystemAlert
+								key={key}
+								system={system}
+								systemAlerts={systemAlerts}
+								data={{ key, alert: alertInfo[key], system, project }}
+							/>
+						))}
+					</div>
+				</div>
+			))}
+		</>
+	)
+}
+
+/** Utilization alerts for each engine of the system's GPUs (Intel) */
+function GpuEngineAlerts({ system, systemAlerts }: { system: SystemRecord; systemAlerts: AlertRecord[] }) {
+	const [engines, setEngines] = useState<string[]>([])
+
+	useEffect(() => {
+		pb.collection<SystemStatsRecord>("system_stats")
+			.getFirstListItem(pb.filter("system={:system} && type='1m'", { system: system.id }), {
+				sort: "-created",
+				fields: "stats",
+			})
+			.then(({ stats }) => {
+				const names = new Set<string>()
+				for (const gpu of Object.values(stats.g ?? {})) {
+					Object.keys(gpu.e ?? {}).forEach((name) => names.add(name))
+				}
+				// include engines with existing alerts that are no longer reported
+				for (const alert of systemAlerts) {
+					alert.engine && names.add(alert.engine)
+				}
+				setEngines([...names].sort())
+			})
+			.catch(() => setEngines([]))
+	}, [system.id])
+
+	if (!engines.length) {
+		return null
+	}
+
+	return (
+		<>
+			{engines.map((engine) => (
+				<div key={engine} className="mt-5">
+					<h4 className="font-semibold mb-3 flex gap-2 items-center">
+						<GaugeIcon className="h-4 w-4 opacity-85" />
+						<Trans>{engine} engine</Trans>
+					</h4>
+					<SystemAlert
+						system={system}
+						systemAlerts={systemAlerts}
+						data={{ key: "GPU Engine", alert: alertInfo["GPU Engine"], system, engine }}
+					/>
+				</div>
+			))}
+		</>
+	)
+}
+
+/** Recent triggers of the system's alerts and when they resolved */
+function AlertHistory({ system }: { system: SystemRecord }) {
+	const [entries, setEntries] = useState<AlertHistoryRecord[] | null>(null)
+
+	useEffect(() => {
+		pb.collection<AlertHistoryRecord>("alerts_history")
+			.getList(1, 50, {
+				filter: pb.filter("system={:system}", { system: system.id }),
+				sort: "-created",
+			})
+			.then(({ items }) => setEntries(items))
+			.catch(() => setEntries([]))
+	}, [system.id])
+
+	if (!entries) {
+		return null
+	}
+	if (!entries.length) {
+		return (
+			<p className="text-sm text-muted-foreground py-4 text-center">
+				<Trans>No alerts have triggered yet.</Trans>
+			</p>
+		)
+	}
+
+	return (
+		<div className="grid gap-2">
+			{entries.map((entry) => {
+				const info = alertInfo[entry.name as keyof typeof alertInfo]
+				const Icon = info?.icon ?? BellIcon
+				return (
+					<div key={entry.id} className="rounded-md border px-3 py-2 text-sm flex flex-wrap items-center gap-x-3 gap-y-1">
+						<span className="font-semibold flex items-center gap-2 flex-1">
+							<Icon className="h-4 w-4 opacity-85" />
+							{entry.project && `${entry.project} `}
+							{info?.name() ?? entry.name}
+							{entry.value > 0 && (
+								<span className="font-normal text-muted-foreground tabular-nums">
+									{entry.value}
+									{info?.unit}
+								</span>
+							)}
+						</span>
+						<span className="text-muted-foreground tabular-nums">
+							{formatShortDate(entry.created)} &ndash;{" "}
+							{entry.resolved ? formatShortDate(entry.resolved) : <Trans>Active</Trans>}
+						</span>
+					</div>
+				)
+			})}
+		</div>
+	)
+}
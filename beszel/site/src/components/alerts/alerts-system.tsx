@@ -1,6 +1,7 @@
 import { pb } from "@/lib/stores"
 import { alertInfo, cn } from "@/lib/utils"
 import { Switch } from "@/components/ui/switch"
+import { Input } from "@/components/ui/input"
 import { AlertInfo, AlertRecord, SystemRecord } from "@/types"
 import { lazy, Suspense, useRef, useState } from "react"
 import { toast } from "../ui/use-toast"
@@ -11,10 +12,27 @@ interface AlertData {
 	checked?: boolean
 	val?: number
 	min?: number
-	updateAlert?: (checked: boolean, value: number, min: number) => void
+	/** minutes after resolving before the alert can trigger again */
+	cooldown?: number
+	/** metric expression of an Expression alert */
+	expression?: string
+	/** hours the alert can trigger in the system's time zone */
+	hours?: string
+	updateAlert?: (
+		checked: boolean,
+		value: number,
+		min: number,
+		cooldown: number,
+		expression: string,
+		hours: string
+	) => void
 	key: keyof typeof alertInfo
 	alert: AlertInfo
 	system: SystemRecord
+	/** docker compose project targeted by the alert */
+	project?: string
+	/** gpu engine targeted by the alert */
+	engine?: string
 }
 
 const Slider = lazy(() => import("@/components/ui/slider"))
@@ -35,14 +53,25 @@ export function SystemAlert({
 	systemAlerts: AlertRecord[]
 	data: AlertData
 }) {
-	const alert = systemAlerts.find((alert) => alert.name === data.key)
+	const project = data.project ?? ""
+	const engine = data.engine ?? ""
+	const alert = systemAlerts.find(
+		(alert) => alert.name === data.key && (alert.project ?? "") === project && (alert.engine ?? "") === engine
+	)
 
-	data.updateAlert = async (checked: boolean, value: number, min: number) => {
+	data.updateAlert = async (
+		checked: boolean,
+		value: number,
+		min: number,
+		cooldown: number,
+		expression: string,
+		hours: string
+	) => {
 		try {
 			if (alert && !checked) {
 				await pb.collection("alerts").delete(alert.id)
 			} else if (alert && checked) {
-				await pb.collection("alerts").update(alert.id, { value, min, triggered: false })
+				await pb.collection("alerts").update(alert.id, { value, min, cooldown, expression, hours, triggered: false })
 			} else if (checked) {
 				pb.collection("alerts").create({
 					system: system.id,
@@ -50,6 +79,11 @@ export function SystemAlert({
 					name: data.key,
 					value: value,
 					min: min,
+					cooldown,
+					project,
+					engine,
+					expression,
+					hours,
 				})
 			}
 		} catch (e) {
@@ -61,6 +95,9 @@ export function SystemAlert({
 		data.checked = true
 		data.val = alert.value
 		data.min = alert.min || 1
+		data.cooldown = alert.cooldown || 0
+		data.expression = alert.expression
+		data.hours = alert.hours
 	}
 
 	return <AlertContent data={data} />
@@ -83,9 +120,16 @@ export function SystemAlertGlobal({
 	})
 
 	data.checked = false
-	data.val = data.min = 0
+	data.val = data.min = data.cooldown = 0
 
-	data.updateAlert = async (checked: boolean, value: number, min: number) => {
+	data.updateAlert = async (
+		checked: boolean,
+		value: number,
+		min: number,
+		cooldown: number,
+		expression: string,
+		hours: string
+	) => {
 		const { set, populatedSet } = systemsWithExistingAlerts.current
 
 		// if overwrite checked, make sure all alerts will be overwritten
@@ -96,6 +140,9 @@ export function SystemAlertGlobal({
 		const recordData: Partial<AlertRecord> = {
 			value,
 			min,
+			cooldown,
+			expression,
+			hours,
 			triggered: false,
 		}
 
@@ -113,7 +160,9 @@ export function SystemAlertGlobal({
 					continue
 				}
 				// find matching existing alert
-				const existingAlert = alerts.find((alert) => alert.system === system.id && data.key === alert.name)
+				const existingAlert = alerts.find(
+					(alert) => alert.system === system.id && data.key === alert.name && !alert.project && !alert.engine
+				)
 				// if first run, add system to set (alert already existed when global panel was opened)
 				if (existingAlert && !populatedSet && !overwrite) {
 					set.add(system.id)
@@ -159,26 +208,41 @@ export function SystemAlertGlobal({
 
 function AlertContent({ data }: { data: AlertData }) {
 	const { key } = data
+	// unique id for labels when the same alert is shown for several projects or engines
+	const target = data.project || data.engine
+	const id = target ? `${key}-${target}` : key
 
 	const hasSliders = !("single" in data.alert)
 
 	const [checked, setChecked] = useState(data.checked || false)
 	const [min, setMin] = useState(data.min || (hasSliders ? 10 : 0))
-	const [value, setValue] = useState(data.val || (hasSliders ? 80 : 0))
+	const [value, setValue] = useState(data.val || (hasSliders ? data.alert.defaultValue ?? 80 : 0))
+	const [cooldown, setCooldown] = useState(data.cooldown || 0)
 
 	const showSliders = checked && hasSliders
 
 	const newMin = useRef(min)
 	const newValue = useRef(value)
+	const newCooldown = useRef(cooldown)
+	const newExpression = useRef(data.expression ?? "")
+	const newHours = useRef(data.hours ?? "")
 
 	const Icon = alertInfo[key].icon
 
-	const updateAlert = (c?: boolean) => data.updateAlert?.(c ?? checked, newValue.current, newMin.current)
+	const updateAlert = (c?: boolean) =>
+		data.updateAlert?.(
+			c ?? checked,
+			newValue.current,
+			newMin.current,
+			newCooldown.current,
+			newExpression.current,
+			newHours.current
+		)
 
 	return (
 		<div className="rounded-lg border border-muted-foreground/15 hover:border-muted-foreground/20 transition-colors duration-100 group">
 			<label
-				htmlFor={`s${key}`}
+				htmlFor={`s${id}`}
 				className={cn("flex flex-row items-center justify-between gap-4 cursor-pointer p-4", {
 					"pb-0": showSliders,
 				})}
@@ -188,9 +252,21 @@ function AlertContent({ data }: { data: AlertData }) {
 						<Icon className="h-4 w-4 opacity-85" /> {data.alert.name()}
 					</p>
 					{!showSliders && <span className="block text-sm text-muted-foreground">{data.alert.desc()}</span>}
+					{key === "Expression" && (
+						<Input
+							placeholder="mem_used / mem_total * 100"
+							defaultValue={newExpression.current}
+							className="mt-1 font-mono"
+							// the expression is saved with the alert, so only update an enabled alert
+							onBlur={(e) => {
+								newExpression.current = e.target.value.trim()
+								checked && updateAlert()
+							}}
+						/>
+					)}
 				</div>
 				<Switch
-					id={`s${key}`}
+					id={`s${id}`}
 					checked={checked}
 					onCheckedChange={(checked) => {
 						setChecked(checked)
@@ -202,28 +278,46 @@ function AlertContent({ data }: { data: AlertData }) {
 				<div className="grid sm:grid-cols-2 mt-1.5 gap-5 px-4 pb-5 tabular-nums text-muted-foreground">
 					<Suspense fallback={<div className="h-10" />}>
 						<div>
-							<p id={`v${key}`} className="text-sm block h-8">
-								<Trans>
-									Average exceeds{" "}
-									<strong className="text-foreground">
-										{value}
-										{data.alert.unit}
-									</strong>
-								</Trans>
+							<p id={`v${id}`} className="text-sm block h-8">
+								{data.alert.noMin ? (
+									<Trans>
+										Exceeds{" "}
+										<strong className="text-foreground">
+											{value}
+											{data.alert.unit}
+										</strong>
+									</Trans>
+								) : data.alert.below ? (
+									<Trans>
+										Average falls below{" "}
+										<strong className="text-foreground">
+											{value}
+											{data.alert.unit}
+										</strong>
+									</Trans>
+								) : (
+									<Trans>
+										Average exceeds{" "}
+										<strong className="text-foreground">
+											{value}
+											{data.alert.unit}
+										</strong>
+									</Trans>
+								)}
 							</p>
 							<div className="flex gap-3">
 								<Slider
-									aria-labelledby={`v${key}`}
+									aria-labelledby={`v${id}`}
 									defaultValue={[value]}
 									onValueCommit={(val) => (newValue.current = val[0]) && updateAlert()}
 									onValueChange={(val) => setValue(val[0])}
-									min={1}
+									min={alertInfo[key].min ?? 1}
 									max={alertInfo[key].max ?? 99}
 								/>
 							</div>
 						</div>
-						<div>
-							<p id={`t${key}`} className="text-sm block h-8">
+						<div className={cn({ hidden: data.alert.noMin })}>
+							<p id={`t${id}`} className="text-sm block h-8">
 								<Trans>
 									For <strong className="text-foreground">{min}</strong>{" "}
 									<Plural value={min} one=" minute" other=" minutes" />
@@ -231,7 +325,7 @@ function AlertContent({ data }: { data: AlertData }) {
 							</p>
 							<div className="flex gap-3">
 								<Slider
-									aria-labelledby={`v${key}`}
+									aria-labelledby={`v${id}`}
 									defaultValue={[min]}
 									onValueCommit={(val) => (newMin.current = val[0]) && updateAlert()}
 									onValueChange={(val) => setMin(val[0])}
@@ -240,6 +334,46 @@ function AlertContent({ data }: { data: AlertData }) {
 								/>
 							</div>
 						</div>
+						<div className="sm:col-span-2">
+							<p id={`c${id}`} className="text-sm block h-8">
+								{cooldown > 0 ? (
+									<Trans>
+										Don't trigger again for <strong className="text-foreground">{cooldown}</strong>{" "}
+										<Plural value={cooldown} one=" minute" other=" minutes" /> after resolving
+									</Trans>
+								) : (
+									<Trans>No cooldown after resolving</Trans>
+								)}
+							</p>
+							<div className="flex gap-3">
+								<Slider
+									aria-labelledby={`c${id}`}
+									defaultValue={[cooldown]}
+									onValueCommit={(val) => {
+										newCooldown.current = val[0]
+										updateAlert()
+									}}
+									onValueChange={(val) => setCooldown(val[0])}
+									min={0}
+									max={120}
+								/>
+							</div>
+						</div>
+						<div className="sm:col-span-2">
+							<label htmlFor={`h${id}`} className="text-sm block mb-2">
+								<Trans>Only trigger during these hours in the system's time zone</Trans>
+							</label>
+							<Input
+								id={`h${id}`}
+								placeholder="mon-fri 09:00-17:00"
+								defaultValue={newHours.current}
+								className="font-mono"
+								onBlur={(e) => {
+									newHours.current = e.target.value.trim()
+									updateAlert()
+								}}
+							/>
+						</div>
 					</Suspense>
 				</div>
 			)}
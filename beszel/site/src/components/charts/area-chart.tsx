@@ -23,9 +23,10 @@ const getNestedValue = (path: string, max = false, data: any): number | null =>
 	// a max value which doesn't exist, or the value was zero and omitted from the stats object.
 	// so we check if cpum is present. if so, return 0 to make sure the zero value is displayed.
 	// if not, return null - there is no max data so do not display anything.
+	// explicit null values are stats that failed to collect, so they're never shown as zero.
 	return `stats.${path}${max ? "m" : ""}`
 		.split(".")
-		.reduce((acc: any, key: string) => acc?.[key] ?? (data.stats?.cpum ? 0 : null), data)
+		.reduce((acc: any, key: string) => (acc?.[key] === null ? null : acc?.[key] ?? (data.stats?.cpum ? 0 : null)), data)
 }
 
 export default memo(function AreaChartDefault({
@@ -64,6 +65,12 @@ export default memo(function AreaChartDefault({
 				[t({ message: "Sent", comment: "Network bytes sent (upload)" }), "ns", 5, 0.2],
 				[t({ message: "Received", comment: "Network bytes received (download)" }), "nr", 2, 0.2],
 			]
+		} else if (chartName === "ent") {
+			return [[t`Available`, "ent", 4, 0.3]]
+		} else if (chartName === "lat") {
+			return [[t`Latency`, "lat", 2, 0.3]]
+		} else if (chartName === "pl") {
+			return [[t`Packet Loss`, "pl", 5, 0.3]]
 		} else if (chartName.startsWith("efs")) {
 			return [
 				[t`Write`, `${chartName}.w`, 3, 0.3],
@@ -72,7 +79,8 @@ export default memo(function AreaChartDefault({
 		} else if (chartName.startsWith("g.")) {
 			return [chartName.includes("mu") ? [t`Used`, chartName, 2, 0.25] : [t`Usage`, chartName, 1, 0.4]]
 		}
-		return []
+		// other series are charted by their key in stats
+		return [[chartName, chartName, 1, 0.3]]
 	}, [chartName, i18n.locale])
 
 	// console.log('Rendered at', new Date())
@@ -5,7 +5,8 @@ import { ChartTimes } from "@/types"
 import { useStore } from "@nanostores/react"
 import { HistoryIcon } from "lucide-react"
 
-export default function ChartTimeSelect({ className }: { className?: string }) {
+/** The 10 minute option is only shown for systems with fast polling */
+export default function ChartTimeSelect({ className, fastPolling }: { className?: string; fastPolling?: boolean }) {
 	const chartTime = useStore($chartTime)
 
 	return (
@@ -15,11 +16,14 @@ export default function ChartTimeSelect({ className }: { className?: string }) {
 				<SelectValue />
 			</SelectTrigger>
 			<SelectContent>
-				{Object.entries(chartTimeData).map(([value, { label }]) => (
-					<SelectItem key={value} value={value}>
-						{label()}
-					</SelectItem>
-				))}
+				{Object.entries(chartTimeData).map(
+					([value, { label }]) =>
+						(fastPolling || value !== "10m") && (
+							<SelectItem key={value} value={value}>
+								{label()}
+							</SelectItem>
+						)
+				)}
 			</SelectContent>
 		</Select>
 	)
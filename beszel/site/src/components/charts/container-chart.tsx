@@ -34,6 +34,9 @@ export default memo(function ContainerChart({
 	const { containerData } = chartData
 
 	const isNetChart = chartName === "net"
+	const isDiskChart = chartName === "dio"
+	// keys of the two values stacked in net and disk i/o charts
+	const [inKey, outKey] = isDiskChart ? ["dr", "dw"] : ["nr", "ns"]
 
 	const chartConfig = useMemo(() => {
 		let config = {} as Record<
@@ -52,8 +55,9 @@ export default memo(function ContainerChart({
 				if (!(key in totalUsage)) {
 					totalUsage[key] = 0
 				}
-				if (isNetChart) {
-					totalUsage[key] += (stats[key]?.nr ?? 0) + (stats[key]?.ns ?? 0)
+				if (isNetChart || isDiskChart) {
+					// @ts-ignore
+					totalUsage[key] += (stats[key]?.[inKey] ?? 0) + (stats[key]?.[outKey] ?? 0)
 				} else {
 					// @ts-ignore
 					totalUsage[key] += stats[key]?.[dataKey] ?? 0
@@ -89,22 +93,23 @@ export default memo(function ContainerChart({
 		} else {
 			obj.tickFormatter = (value) => {
 				const { v, u } = getSizeAndUnit(value, false)
-				return updateYAxisWidth(`${toFixedFloat(v, 2)}${u}${isNetChart ? "/s" : ""}`)
+				return updateYAxisWidth(`${toFixedFloat(v, 2)}${u}${isNetChart || isDiskChart ? "/s" : ""}`)
 			}
 		}
 		// tooltip formatter
-		if (isNetChart) {
+		if (isNetChart || isDiskChart) {
+			const [inLabel, outLabel] = isDiskChart ? ["read", "write"] : ["rx", "tx"]
 			obj.toolTipFormatter = (item: any, key: string) => {
 				try {
-					const sent = item?.payload?.[key]?.ns ?? 0
-					const received = item?.payload?.[key]?.nr ?? 0
+					const outValue = item?.payload?.[key]?.[outKey] ?? 0
+					const inValue = item?.payload?.[key]?.[inKey] ?? 0
 					return (
 						<span className="flex">
-							{decimalString(received)} MB/s
-							<span className="opacity-70 ms-0.5"> rx </span>
+							{decimalString(inValue)} MB/s
+							<span className="opacity-70 ms-0.5"> {inLabel} </span>
 							<Separator orientation="vertical" className="h-3 mx-1.5 bg-primary/40" />
-							{decimalString(sent)} MB/s
-							<span className="opacity-70 ms-0.5"> tx</span>
+							{decimalString(outValue)} MB/s
+							<span className="opacity-70 ms-0.5"> {outLabel}</span>
 						</span>
 					)
 				} catch (e) {
@@ -115,8 +120,9 @@ export default memo(function ContainerChart({
 			obj.toolTipFormatter = (item: any) => decimalString(item.value) + unit
 		}
 		// data function
-		if (isNetChart) {
-			obj.dataFunction = (key: string, data: any) => (data[key] ? data[key].nr + data[key].ns : null)
+		if (isNetChart || isDiskChart) {
+			obj.dataFunction = (key: string, data: any) =>
+				data[key] ? (data[key][inKey] ?? 0) + (data[key][outKey] ?? 0) : null
 		} else {
 			obj.dataFunction = (key: string, data: any) => data[key]?.[dataKey] ?? null
 		}
@@ -0,0 +1,48 @@
+import { chartTimeData, decimalString, formatShortDate } from "@/lib/utils"
+import { ChartData } from "@/types"
+import { memo } from "react"
+import { t } from "@lingui/macro"
+
+/** Heatmap of the usage of each logical cpu, with a row per core and a column per record */
+export default memo(function CpuCoresChart({ chartData }: { chartData: ChartData }) {
+	const { systemStats, domain, chartTime } = chartData
+	if (systemStats.length === 0) {
+		return null
+	}
+	const cores = Math.max(...systemStats.map((record) => record.stats?.cpuc?.length ?? 0))
+	if (cores === 0) {
+		return null
+	}
+	// each record covers the interval that ends at its time
+	const interval = chartTimeData[chartTime].expectedInterval
+	const [start, end] = domain
+	const width = end - start
+
+	return (
+		<div className="h-full w-full ps-4 pb-4">
+			<svg className="h-full w-full" viewBox={`0 0 ${width} ${cores}`} preserveAspectRatio="none">
+				{systemStats.map((record) =>
+					record.stats?.cpuc?.map((usage, core) => {
+						const created = record.created as number
+						if (created <= start) {
+							return null
+						}
+						return (
+							<rect
+								key={`${created}-${core}`}
+								x={Math.max(created - interval, start) - start}
+								y={core}
+								width={Math.min(interval, created - start)}
+								height={1}
+								fill="hsl(var(--chart-1))"
+								fillOpacity={Math.max(usage / 100, 0.04)}
+							>
+								<title>{`${t`Core`} ${core} · ${decimalString(usage)}% · ${formatShortDate(record.created as string)}`}</title>
+							</rect>
+						)
+					})
+				)}
+			</svg>
+		</div>
+	)
+})
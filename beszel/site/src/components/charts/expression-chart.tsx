@@ -0,0 +1,95 @@
+import { CartesianGrid, Line, LineChart, YAxis } from "recharts"
+
+import { ChartContainer, ChartTooltip, ChartTooltipContent, xAxis } from "@/components/ui/chart"
+import {
+	useYAxisWidth,
+	cn,
+	formatShortDate,
+	toFixedWithoutTrailingZeros,
+	decimalString,
+	chartMargin,
+	chartTimeData,
+} from "@/lib/utils"
+import { pb } from "@/lib/stores"
+import { ChartData, ExpressionPoint, SystemRecord } from "@/types"
+import { memo, useEffect, useState } from "react"
+
+/** Line chart of a metric expression evaluated by the hub, e.g. mem_used/mem_total*100 */
+export default memo(function ExpressionChart({
+	chartData,
+	system,
+	expression,
+}: {
+	chartData: ChartData
+	system: SystemRecord
+	expression: string
+}) {
+	const { yAxisWidth, updateYAxisWidth } = useYAxisWidth()
+	const [data, setData] = useState<{ created: number; value: number | null }[]>([])
+
+	// fetch the series again when new stats arrive or the time range changes
+	useEffect(() => {
+		if (!expression) {
+			setData([])
+			return
+		}
+		pb.send<ExpressionPoint[]>("/api/beszel/expression", {
+			query: {
+				system: system.id,
+				expr: expression,
+				type: chartTimeData[chartData.chartTime].type,
+				from: Math.floor(chartData.domain[0] / 1000),
+			},
+		})
+			.then((points) => setData(points.map(({ created, value }) => ({ created: new Date(created).getTime(), value }))))
+			.catch(() => setData([]))
+	}, [system.id, expression, chartData])
+
+	if (data.length === 0) {
+		return null
+	}
+
+	return (
+		<div>
+			<ChartContainer
+				className={cn("h-full w-full absolute aspect-auto bg-card opacity-0 transition-opacity", {
+					"opacity-100": yAxisWidth,
+				})}
+			>
+				<LineChart accessibilityLayer data={data} margin={chartMargin}>
+					<CartesianGrid vertical={false} />
+					<YAxis
+						direction="ltr"
+						orientation={chartData.orientation}
+						className="tracking-tighter"
+						domain={["auto", "auto"]}
+						width={yAxisWidth}
+						tickFormatter={(value) => updateYAxisWidth(toFixedWithoutTrailingZeros(value, 2))}
+						tickLine={false}
+						axisLine={false}
+					/>
+					{xAxis(chartData)}
+					<ChartTooltip
+						animationEasing="ease-out"
+						animationDuration={150}
+						content={
+							<ChartTooltipContent
+								labelFormatter={(_, data) => formatShortDate(data[0].payload.created)}
+								contentFormatter={(item) => decimalString(item.value)}
+							/>
+						}
+					/>
+					<Line
+						dataKey="value"
+						name={expression}
+						type="monotoneX"
+						dot={false}
+						strokeWidth={1.5}
+						stroke="hsl(var(--chart-1))"
+						isAnimationActive={false}
+					/>
+				</LineChart>
+			</ChartContainer>
+		</div>
+	)
+})
@@ -0,0 +1,86 @@
+import { CartesianGrid, Line, LineChart, YAxis } from "recharts"
+
+import {
+	ChartContainer,
+	ChartLegend,
+	ChartLegendContent,
+	ChartTooltip,
+	ChartTooltipContent,
+	xAxis,
+} from "@/components/ui/chart"
+import { useYAxisWidth, cn, formatShortDate, toFixedWithoutTrailingZeros, decimalString, chartMargin } from "@/lib/utils"
+import { ChartData, SystemStats } from "@/types"
+import { memo } from "react"
+import { t } from "@lingui/macro"
+
+export default memo(function FdChart({ chartData }: { chartData: ChartData }) {
+	const { yAxisWidth, updateYAxisWidth } = useYAxisWidth()
+
+	if (chartData.systemStats.length === 0) {
+		return null
+	}
+
+	// system usage is relative to the kernel limit, process usage to the limit of the busiest process
+	const lines = [
+		{
+			key: "system",
+			name: t`System`,
+			color: "hsl(217, 91%, 60%)",
+			value: ({ stats }: { stats: SystemStats }) => (stats.fdm ? ((stats.fd ?? 0) / stats.fdm) * 100 : 0),
+		},
+		{
+			key: "process",
+			name: t`Top process`,
+			color: "hsl(25, 95%, 53%)",
+			value: ({ stats }: { stats: SystemStats }) => stats.fdp ?? 0,
+		},
+	]
+
+	return (
+		<div>
+			<ChartContainer
+				className={cn("h-full w-full absolute aspect-auto bg-card opacity-0 transition-opacity", {
+					"opacity-100": yAxisWidth,
+				})}
+			>
+				<LineChart accessibilityLayer data={chartData.systemStats} margin={chartMargin}>
+					<CartesianGrid vertical={false} />
+					<YAxis
+						direction="ltr"
+						orientation={chartData.orientation}
+						className="tracking-tighter"
+						domain={[0, "auto"]}
+						width={yAxisWidth}
+						tickFormatter={(value) => updateYAxisWidth(toFixedWithoutTrailingZeros(value, 2) + "%")}
+						tickLine={false}
+						axisLine={false}
+					/>
+					{xAxis(chartData)}
+					<ChartTooltip
+						animationEasing="ease-out"
+						animationDuration={150}
+						content={
+							<ChartTooltipContent
+								labelFormatter={(_, data) => formatShortDate(data[0].payload.created)}
+								contentFormatter={(item) => decimalString(item.value) + "%"}
+							/>
+						}
+					/>
+					{lines.map((line) => (
+						<Line
+							key={line.key}
+							dataKey={line.value}
+							name={line.name}
+							type="monotoneX"
+							dot={false}
+							strokeWidth={1.5}
+							stroke={line.color}
+							isAnimationActive={false}
+						/>
+					))}
+					<ChartLegend content={<ChartLegendContent />} />
+				</LineChart>
+			</ChartContainer>
+		</div>
+	)
+})
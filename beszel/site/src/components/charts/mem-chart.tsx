@@ -97,6 +97,30 @@ export default memo(function MemChart({ chartData }: { chartData: ChartData }) {
 						stackId="1"
 						isAnimationActive={false}
 					/>
+					{chartData.systemStats.at(-1)?.stats.mht && (
+						<Area
+							name={_(t`Huge Pages`)}
+							order={4}
+							dataKey="stats.mht"
+							type="monotoneX"
+							fillOpacity={0}
+							stroke="hsl(var(--chart-5))"
+							strokeDasharray="2 2"
+							isAnimationActive={false}
+						/>
+					)}
+					{chartData.systemStats.at(-1)?.stats.ma !== undefined && (
+						<Area
+							name={_(t`Available`)}
+							order={5}
+							dataKey="stats.ma"
+							type="monotoneX"
+							fillOpacity={0}
+							stroke="hsl(var(--chart-1))"
+							strokeDasharray="4 4"
+							isAnimationActive={false}
+						/>
+					)}
 				</AreaChart>
 			</ChartContainer>
 		</div>
@@ -0,0 +1,116 @@
+import { Button } from "@/components/ui/button"
+import { Dialog, DialogContent, DialogDescription, DialogFooter, DialogHeader, DialogTitle } from "@/components/ui/dialog"
+import { Input } from "@/components/ui/input"
+import { Label } from "@/components/ui/label"
+import { toast } from "@/components/ui/use-toast"
+import { pb } from "@/lib/stores"
+import { Trans, t } from "@lingui/macro"
+import { EyeIcon } from "lucide-react"
+import { getTokenPayload } from "pocketbase"
+import { useState } from "react"
+
+/** Local storage key of the admin's session while impersonating */
+const impersonatorKey = "beszel_impersonator"
+
+/** Returns true if the current session is a read only impersonation by an admin */
+export const isImpersonating = () => Boolean(getTokenPayload(pb.authStore.token).beszelImpersonation)
+
+/** Views the dashboard as another user. The admin's session is kept to switch back. */
+async function startImpersonation(email: string, reason: string) {
+	const { token, record } = await pb.send("/api/beszel/impersonate", {
+		method: "POST",
+		body: { email, reason },
+	})
+	localStorage.setItem(impersonatorKey, JSON.stringify({ token: pb.authStore.token, record: pb.authStore.record }))
+	pb.authStore.save(token, record)
+	// reload so systems, alerts and settings are loaded for the user
+	window.location.href = "/"
+}
+
+/** Ends the impersonation session and restores the admin's session */
+async function stopImpersonation() {
+	await pb.send("/api/beszel/impersonate/end", { method: "POST" }).catch(() => {})
+	const admin = JSON.parse(localStorage.getItem(impersonatorKey) ?? "null")
+	localStorage.removeItem(impersonatorKey)
+	if (admin?.token) {
+		pb.authStore.save(admin.token, admin.record)
+	} else {
+		pb.authStore.clear()
+	}
+	window.location.href = "/"
+}
+
+/** Dialog where admins choose the user to view the dashboard as */
+export function ImpersonateDialog({ open, setOpen }: { open: boolean; setOpen: (open: boolean) => void }) {
+	const [email, setEmail] = useState("")
+	const [reason, setReason] = useState("")
+	const [loading, setLoading] = useState(false)
+
+	async function submit(e: React.FormEvent<HTMLFormElement>) {
+		e.preventDefault()
+		setLoading(true)
+		try {
+			await startImpersonation(email, reason)
+		} catch (error: any) {
+			toast({ title: t`Error`, description: error.message, variant: "destructive" })
+			setLoading(false)
+		}
+	}
+
+	return (
+		<Dialog open={open} onOpenChange={setOpen}>
+			<DialogContent className="w-[90%] sm:max-w-[440px] rounded-lg">
+				<form onSubmit={submit}>
+					<DialogHeader>
+						<DialogTitle className="mb-2">
+							<Trans>View as user</Trans>
+						</DialogTitle>
+						<DialogDescription className="mb-4 leading-normal">
+							<Trans>
+								See the dashboard as a user sees it, to debug missing systems or alerts. The session is read only,
+								ends after 30 minutes and is logged with the reason.
+							</Trans>
+						</DialogDescription>
+					</DialogHeader>
+					<div className="grid gap-3 mb-5">
+						<div className="space-y-1.5">
+							<Label htmlFor="impersonate-email">
+								<Trans>User email</Trans>
+							</Label>
+							<Input id="impersonate-email" type="email" value={email} onChange={(e) => setEmail(e.target.value)} required />
+						</div>
+						<div className="space-y-1.5">
+							<Label htmlFor="impersonate-reason">
+								<Trans>Reason</Trans>
+							</Label>
+							<Input id="impersonate-reason" value={reason} onChange={(e) => setReason(e.target.value)} required />
+						</div>
+					</div>
+					<DialogFooter>
+						<Button type="submit" disabled={loading} className="flex items-center gap-1.5">
+							<EyeIcon className="h-4 w-4" />
+							<Trans>View as user</Trans>
+						</Button>
+					</DialogFooter>
+				</form>
+			</DialogContent>
+		</Dialog>
+	)
+}
+
+/** Banner shown while an admin views the dashboard as another user */
+export function ImpersonationBanner() {
+	return (
+		<div className="flex flex-wrap items-center justify-center gap-x-3 gap-y-1 rounded-md border border-yellow-500/60 bg-yellow-500/10 px-4 py-2 mt-4 text-sm">
+			<EyeIcon className="h-4 w-4" />
+			<span>
+				<Trans>
+					Viewing as <strong>{pb.authStore.record?.email}</strong>. Changes can't be saved.
+				</Trans>
+			</span>
+			<Button variant="outline" size="sm" className="h-7" onClick={stopImpersonation}>
+				<Trans>Stop viewing</Trans>
+			</Button>
+		</div>
+	)
+}
@@ -2,6 +2,7 @@ import { useState, lazy, Suspense } from "react"
 import { Button, buttonVariants } from "@/components/ui/button"
 import {
 	DatabaseBackupIcon,
+	EyeIcon,
 	LogOutIcon,
 	LogsIcon,
 	SearchIcon,
@@ -26,6 +27,7 @@ import {
 	DropdownMenuItem,
 } from "@/components/ui/dropdown-menu"
 import { AddSystemButton } from "./add-system"
+import { ImpersonateDialog } from "./impersonate"
 import { Trans } from "@lingui/macro"
 
 const CommandPalette = lazy(() => import("./command-palette"))
@@ -33,6 +35,8 @@ const CommandPalette = lazy(() => import("./command-palette"))
 const isMac = navigator.platform.toUpperCase().indexOf("MAC") >= 0
 
 export default function Navbar() {
+	const [impersonateOpen, setImpersonateOpen] = useState(false)
+
 	return (
 		<div className="flex items-center h-14 md:h-16 bg-card px-4 pe-3 sm:px-6 border border-border/60 bt-0 rounded-md my-4">
 			<Link href="/" aria-label="Home" className="p-2 ps-0 me-3">
@@ -94,6 +98,12 @@ export default function Navbar() {
 											</span>
 										</a>
 									</DropdownMenuItem>
+									<DropdownMenuItem onSelect={() => setImpersonateOpen(true)}>
+										<EyeIcon className="me-2.5 h-4 w-4" />
+										<span>
+											<Trans>View as user</Trans>
+										</span>
+									</DropdownMenuItem>
 									<DropdownMenuSeparator />
 								</>
 							)}
@@ -108,6 +118,7 @@ export default function Navbar() {
 				</DropdownMenu>
 				<AddSystemButton className="ms-2" />
 			</div>
+			{impersonateOpen && <ImpersonateDialog open={impersonateOpen} setOpen={setImpersonateOpen} />}
 		</div>
 	)
 }
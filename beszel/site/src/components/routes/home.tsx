@@ -74,7 +74,8 @@ export default function Home() {
 										>
 											<info.icon className="h-4 w-4" />
 											<AlertTitle>
-												{alert.sysname} {info.name().toLowerCase().replace("cpu", "CPU")}
+												{alert.sysname} {alert.project && `${alert.project} `}
+												{info.name().toLowerCase().replace("cpu", "CPU")}
 											</AlertTitle>
 											<AlertDescription>
 												<Trans>
@@ -0,0 +1,178 @@
+import { Separator } from "@/components/ui/separator"
+import { Button } from "@/components/ui/button"
+import { Input } from "@/components/ui/input"
+import { Label } from "@/components/ui/label"
+import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from "@/components/ui/select"
+import { Table, TableBody, TableCell, TableHead, TableHeader, TableRow } from "@/components/ui/table"
+import { toast } from "@/components/ui/use-toast"
+import { redirectPage } from "@nanostores/router"
+import { $router } from "@/components/router"
+import { $systems, pb } from "@/lib/stores"
+import { cn, isAdmin } from "@/lib/utils"
+import { AgentRollout } from "@/types"
+import { useStore } from "@nanostores/react"
+import { Trans, t } from "@lingui/macro"
+import { DownloadIcon, LoaderCircleIcon } from "lucide-react"
+import { useEffect, useState } from "react"
+
+function showError(error: any) {
+	toast({
+		title: t`Error`,
+		description: error.message,
+		variant: "destructive",
+	})
+}
+
+export default function AgentUpdates() {
+	const systems = useStore($systems)
+	const [rollout, setRollout] = useState<AgentRollout | null>(null)
+	const [channel, setChannel] = useState("stable")
+	const [batch, setBatch] = useState(100)
+	const [filter, setFilter] = useState("")
+	const running = !!rollout && !rollout.finished
+
+	if (!isAdmin()) {
+		redirectPage($router, "settings", { name: "general" })
+	}
+
+	// poll the rollout status while it's running
+	useEffect(() => {
+		const fetchRollout = () => pb.send<AgentRollout | null>("/api/beszel/agent-update", {}).then(setRollout)
+		fetchRollout().catch(showError)
+		if (!running) {
+			return
+		}
+		const interval = setInterval(() => fetchRollout().catch(() => {}), 5000)
+		return () => clearInterval(interval)
+	}, [running])
+
+	async function startRollout() {
+		try {
+			const rollout = await pb.send<AgentRollout>("/api/beszel/agent-update", {
+				method: "POST",
+				body: { channel, batch, filter },
+			})
+			setRollout(rollout)
+		} catch (error) {
+			showError(error)
+		}
+	}
+
+	const statusLabels = {
+		pending: t`Pending`,
+		updating: t`Updating`,
+		updated: t`Updated`,
+		current: t`Up to date`,
+		failed: t`Failed`,
+		skipped: t`Skipped`,
+	}
+
+	return (
+		<div>
+			<div>
+				<h3 className="text-xl font-medium mb-2">
+					<Trans>Agent Updates</Trans>
+				</h3>
+				<p className="text-sm text-muted-foreground leading-relaxed">
+					<Trans>
+						Update the agents of all connected systems. Agents are updated in batches, and the update stops if any
+						agent in a batch fails.
+					</Trans>
+				</p>
+			</div>
+			<Separator className="my-4" />
+			<div className="flex flex-wrap items-end gap-3">
+				<div className="space-y-2">
+					<Label htmlFor="channel">
+						<Trans>Channel</Trans>
+					</Label>
+					<Select value={channel} onValueChange={setChannel}>
+						<SelectTrigger id="channel" className="w-40">
+							<SelectValue />
+						</SelectTrigger>
+						<SelectContent>
+							<SelectItem value="stable">
+								<Trans>Stable</Trans>
+							</SelectItem>
+							<SelectItem value="beta">
+								<Trans>Pre-release</Trans>
+							</SelectItem>
+						</SelectContent>
+					</Select>
+				</div>
+				<div className="space-y-2">
+					<Label htmlFor="batch">
+						<Trans>Batch size (%)</Trans>
+					</Label>
+					<Input
+						id="batch"
+						type="number"
+						min={1}
+						max={100}
+						className="w-28"
+						value={batch}
+						onChange={(e) => setBatch(Number(e.target.value))}
+					/>
+				</div>
+				<div className="space-y-2">
+					<Label htmlFor="filter">
+						<Trans>Filter</Trans>
+					</Label>
+					<Input
+						id="filter"
+						className="w-64"
+						placeholder="tag:prod version:<0.12.0"
+						value={filter}
+						onChange={(e) => setFilter(e.target.value)}
+					/>
+				</div>
+				<Button className="flex items-center gap-1" onClick={startRollout} disabled={running}>
+					{running ? (
+						<LoaderCircleIcon className="h-4 w-4 me-0.5 animate-spin" />
+					) : (
+						<DownloadIcon className="h-4 w-4 me-0.5" />
+					)}
+					<Trans>Update agents</Trans>
+				</Button>
+			</div>
+			{rollout?.halted && (
+				<p className="text-sm text-destructive mt-4">
+					<Trans>The update stopped because an agent failed to update.</Trans>
+				</p>
+			)}
+			<div className="rounded-md border mt-5">
+				<Table>
+					<TableHeader>
+						<TableRow>
+							<TableHead>
+								<Trans>System</Trans>
+							</TableHead>
+							<TableHead>
+								<Trans>Version</Trans>
+							</TableHead>
+							<TableHead>
+								<Trans>Status</Trans>
+							</TableHead>
+						</TableRow>
+					</TableHeader>
+					<TableBody>
+						{systems.map((system) => {
+							const rs = rollout?.systems.find((s) => s.id === system.id)
+							return (
+								<TableRow key={system.id}>
+									<TableCell className="font-medium">{system.name}</TableCell>
+									<TableCell>{system.info.v || "-"}</TableCell>
+									<TableCell className={cn({ "text-destructive": rs?.status === "failed" })}>
+										{rs ? statusLabels[rs.status] : "-"}
+										{rs?.to && rs.status !== "current" && ` (${rs.from} → ${rs.to})`}
+										{rs?.error && <span className="block text-xs">{rs.error}</span>}
+									</TableCell>
+								</TableRow>
+							)
+						})}
+					</TableBody>
+				</Table>
+			</div>
+		</div>
+	)
+}
@@ -0,0 +1,159 @@
+import { Separator } from "@/components/ui/separator"
+import { Button } from "@/components/ui/button"
+import { Input } from "@/components/ui/input"
+import { Label } from "@/components/ui/label"
+import { Checkbox } from "@/components/ui/checkbox"
+import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from "@/components/ui/select"
+import { toast } from "@/components/ui/use-toast"
+import { pb } from "@/lib/stores"
+import { copyToClipboard, formatDay, formatShortDate, isReadOnlyUser } from "@/lib/utils"
+import { ApiTokenRecord } from "@/types"
+import { Trans, t } from "@lingui/macro"
+import { CopyIcon, PlusIcon, Trash2Icon } from "lucide-react"
+import { useEffect, useState } from "react"
+
+type Scope = ApiTokenRecord["scopes"][number]
+
+const scopes: { value: Scope; label: () => string }[] = [
+	{ value: "read:stats", label: () => t`Read systems and stats` },
+	{ value: "manage:systems", label: () => t`Manage systems` },
+	{ value: "manage:alerts", label: () => t`Manage alerts` },
+]
+
+function showError(error: any) {
+	toast({
+		title: t`Error`,
+		description: error.message,
+		variant: "destructive",
+	})
+}
+
+export default function ApiTokens() {
+	const [tokens, setTokens] = useState<ApiTokenRecord[]>([])
+	const [name, setName] = useState("")
+	const [selected, setSelected] = useState<Scope[]>(["read:stats"])
+	const [days, setDays] = useState("90")
+	// token is only returned once when it's created
+	const [created, setCreated] = useState("")
+
+	useEffect(() => {
+		pb.collection<ApiTokenRecord>("api_tokens").getFullList({ sort: "name" }).then(setTokens).catch(showError)
+	}, [])
+
+	async function createToken(e: React.FormEvent<HTMLFormElement>) {
+		e.preventDefault()
+		try {
+			const { id, token } = await pb.send<{ id: string; token: string }>("/api/beszel/tokens", {
+				method: "POST",
+				body: { name, scopes: selected, days: Number(days) },
+			})
+			const record = await pb.collection<ApiTokenRecord>("api_tokens").getOne(id)
+			setTokens((tokens) => [...tokens, record])
+			setCreated(token)
+			setName("")
+		} catch (error) {
+			showError(error)
+		}
+	}
+
+	async function deleteToken(id: string) {
+		try {
+			await pb.collection("api_tokens").delete(id)
+			setTokens((tokens) => tokens.filter((t) => t.id !== id))
+		} catch (error) {
+			showError(error)
+		}
+	}
+
+	function toggleScope(scope: Scope, checked: boolean) {
+		setSelected((selected) => (checked ? [...selected, scope] : selected.filter((s) => s !== scope)))
+	}
+
+	return (
+		<div>
+			<div>
+				<h3 className="text-xl font-medium mb-2">
+					<Trans>API Tokens</Trans>
+				</h3>
+				<p className="text-sm text-muted-foreground leading-relaxed">
+					<Trans>
+						Use tokens to access the API from scripts and other tools with the <code>Authorization: Bearer</code>{" "}
+						header. Tokens act as your user, limited to their scopes.
+					</Trans>
+				</p>
+			</div>
+			<Separator className="my-4" />
+			{created && (
+				<div className="rounded-md border p-4 mb-4 space-y-2">
+					<p className="text-sm font-medium">
+						<Trans>Copy the token now. It won't be shown again.</Trans>
+					</p>
+					<div className="flex gap-2">
+						<Input readOnly value={created} className="font-mono" />
+						<Button variant="outline" size="icon" onClick={() => copyToClipboard(created)} title={t`Copy`}>
+							<CopyIcon className="h-4 w-4" />
+						</Button>
+					</div>
+				</div>
+			)}
+			<div className="space-y-2">
+				{tokens.map((token) => (
+					<div key={token.id} className="rounded-md border px-4 py-3 flex items-center gap-3">
+						<div className="flex-1 min-w-0">
+							<div className="flex items-center gap-2">
+								<span className="font-semibold truncate">{token.name}</span>
+								<code className="text-xs text-muted-foreground">{token.prefix}…</code>
+							</div>
+							<div className="text-sm text-muted-foreground">
+								{token.scopes.join(", ")}
+								{" · "}
+								{token.expires ? <Trans>Expires {formatDay(token.expires)}</Trans> : <Trans>No expiry</Trans>}
+								{" · "}
+								{token.last_used ? <Trans>Last used {formatShortDate(token.last_used)}</Trans> : <Trans>Never used</Trans>}
+							</div>
+						</div>
+						<Button variant="ghost" size="icon" onClick={() => deleteToken(token.id)} title={t`Revoke`}>
+							<Trash2Icon className="h-4 w-4" />
+						</Button>
+					</div>
+				))}
+			</div>
+			<form onSubmit={createToken} className="mt-5 space-y-3">
+				<div className="flex gap-2">
+					<Input placeholder={t`Token name`} value={name} onChange={(e) => setName(e.target.value)} required />
+					<Select value={days} onValueChange={setDays}>
+						<SelectTrigger className="w-40">
+							<SelectValue />
+						</SelectTrigger>
+						<SelectContent>
+							{["30", "90", "365"].map((days) => (
+								<SelectItem key={days} value={days}>
+									<Trans>{days} days</Trans>
+								</SelectItem>
+							))}
+							<SelectItem value="0">
+								<Trans>No expiry</Trans>
+							</SelectItem>
+						</SelectContent>
+					</Select>
+				</div>
+				<div className="flex flex-wrap gap-5">
+					{scopes.map(({ value, label }) => (
+						<Label key={value} className="flex items-center gap-2 font-normal">
+							<Checkbox
+								checked={selected.includes(value)}
+								disabled={value !== "read:stats" && isReadOnlyUser()}
+								onCheckedChange={(checked) => toggleScope(value, checked === true)}
+							/>
+							{label()}
+						</Label>
+					))}
+				</div>
+				<Button type="submit" className="flex items-center gap-1" disabled={!selected.length}>
+					<PlusIcon className="h-4 w-4" />
+					<Trans>Create token</Trans>
+				</Button>
+			</form>
+		</div>
+	)
+}
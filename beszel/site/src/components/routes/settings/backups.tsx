@@ -0,0 +1,102 @@
+import { Separator } from "@/components/ui/separator"
+import { Table, TableBody, TableCell, TableHead, TableHeader, TableRow } from "@/components/ui/table"
+import { toast } from "@/components/ui/use-toast"
+import { redirectPage } from "@nanostores/router"
+import { $router } from "@/components/router"
+import { pb } from "@/lib/stores"
+import { cn, decimalString, formatShortDate, isAdmin } from "@/lib/utils"
+import { BackupStatus } from "@/types"
+import { Trans, t } from "@lingui/macro"
+import { useEffect, useState } from "react"
+
+function showError(error: any) {
+	toast({
+		title: t`Error`,
+		description: error.message,
+		variant: "destructive",
+	})
+}
+
+export default function Backups() {
+	const [status, setStatus] = useState<BackupStatus | null>(null)
+
+	if (!isAdmin()) {
+		redirectPage($router, "settings", { name: "general" })
+	}
+
+	useEffect(() => {
+		pb.send<BackupStatus>("/api/beszel/backups", {}).then(setStatus).catch(showError)
+	}, [])
+
+	return (
+		<div>
+			<div>
+				<h3 className="text-xl font-medium mb-2">
+					<Trans>Backups</Trans>
+				</h3>
+				<p className="text-sm text-muted-foreground leading-relaxed">
+					<Trans>
+						Backups of the hub's database, settings and keys. Schedule them with the BACKUP_CRON environment
+						variable or in Settings &gt; Backups of the PocketBase dashboard, which also configures S3 storage.
+					</Trans>
+				</p>
+			</div>
+			<Separator className="my-4" />
+			{status && (
+				<div className="grid gap-1.5 text-sm">
+					<p>
+						<Trans>Schedule</Trans>: <code>{status.cron || t`Not scheduled`}</code>
+					</p>
+					<p>
+						<Trans>Storage</Trans>: {status.s3 ? "S3" : t`Local`}
+					</p>
+					<p className={cn({ "text-destructive": status.stale })}>
+						<Trans>Last successful backup</Trans>:{" "}
+						{status.last_success ? formatShortDate(status.last_success) : t`Never`}
+						{status.stale && (
+							<span className="block text-xs">
+								<Trans>Admins are notified when backups are older than {decimalString(status.max_age, 1)} hours.</Trans>
+							</span>
+						)}
+					</p>
+				</div>
+			)}
+			<div className="rounded-md border mt-5">
+				<Table>
+					<TableHeader>
+						<TableRow>
+							<TableHead>
+								<Trans>Name</Trans>
+							</TableHead>
+							<TableHead>
+								<Trans>Created</Trans>
+							</TableHead>
+							<TableHead>
+								<Trans>Size</Trans>
+							</TableHead>
+							<TableHead>
+								<Trans>Status</Trans>
+							</TableHead>
+						</TableRow>
+					</TableHeader>
+					<TableBody>
+						{status?.backups.map((backup) => (
+							<TableRow key={backup.id}>
+								<TableCell className="font-medium">
+									{backup.name}
+									<span className="block text-xs text-muted-foreground">{backup.storage === "s3" ? "S3" : t`Local`}</span>
+								</TableCell>
+								<TableCell>{formatShortDate(backup.created)}</TableCell>
+								<TableCell>{backup.size ? `${decimalString(backup.size / 1_000_000)} MB` : "-"}</TableCell>
+								<TableCell className={cn({ "text-destructive": backup.error })}>
+									{backup.error ? t`Failed` : t`Succeeded`}
+									{backup.error && <span className="block text-xs">{backup.error}</span>}
+								</TableCell>
+							</TableRow>
+						))}
+					</TableBody>
+				</Table>
+			</div>
+		</div>
+	)
+}
@@ -0,0 +1,289 @@
+import { Separator } from "@/components/ui/separator"
+import { Button } from "@/components/ui/button"
+import { Input } from "@/components/ui/input"
+import { Label } from "@/components/ui/label"
+import { Switch } from "@/components/ui/switch"
+import { toast } from "@/components/ui/use-toast"
+import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from "@/components/ui/select"
+import { $systems, pb } from "@/lib/stores"
+import { cn, formatShortDate, isReadOnlyUser } from "@/lib/utils"
+import { CheckRecord } from "@/types"
+import { useStore } from "@nanostores/react"
+import { Trans, t } from "@lingui/macro"
+import { PauseIcon, PlayIcon, PlusIcon, Trash2Icon } from "lucide-react"
+import { useEffect, useState } from "react"
+
+function showError(error: any) {
+	toast({
+		title: t`Error`,
+		description: error.message,
+		variant: "destructive",
+	})
+}
+
+const statusColors: Record<CheckRecord["status"], string> = {
+	up: "bg-green-500",
+	down: "bg-red-500",
+	pending: "bg-yellow-500",
+	paused: "bg-primary/40",
+}
+
+export default function Checks() {
+	const [checks, setChecks] = useState<CheckRecord[]>([])
+	const [name, setName] = useState("")
+	const [type, setType] = useState<CheckRecord["type"]>("http")
+	const [target, setTarget] = useState("")
+	const systems = useStore($systems)
+	const readOnly = isReadOnlyUser()
+
+	useEffect(() => {
+		const checks = pb.collection<CheckRecord>("checks")
+		checks.getFullList({ sort: "name" }).then(setChecks).catch(showError)
+		// results are saved by the hub after each check
+		checks.subscribe("*", (e) => {
+			setChecks((checks) => {
+				if (e.action === "delete") {
+					return checks.filter((c) => c.id !== e.record.id)
+				}
+				const exists = checks.some((c) => c.id === e.record.id)
+				return exists ? checks.map((c) => (c.id === e.record.id ? e.record : c)) : [...checks, e.record]
+			})
+		})
+		return () => {
+			checks.unsubscribe("*")
+		}
+	}, [])
+
+	async function createCheck(e: React.FormEvent<HTMLFormElement>) {
+		e.preventDefault()
+		try {
+			await pb.collection<CheckRecord>("checks").create({
+				name,
+				type,
+				target,
+				user: pb.authStore.record!.id,
+				notify: true,
+			})
+			setName("")
+			setTarget("")
+		} catch (error) {
+			showError(error)
+		}
+	}
+
+	async function updateCheck(id: string, data: Partial<CheckRecord>) {
+		try {
+			await pb.collection<CheckRecord>("checks").update(id, data)
+		} catch (error) {
+			showError(error)
+		}
+	}
+
+	async function deleteCheck(id: string) {
+		try {
+			await pb.collection("checks").delete(id)
+		} catch (error) {
+			showError(error)
+		}
+	}
+
+	return (
+		<div>
+			<div>
+				<h3 className="text-xl font-medium mb-2">
+					<Trans>Checks</Trans>
+				</h3>
+				<p className="text-sm text-muted-foreground leading-relaxed">
+					<Trans>
+						Check that websites and services respond. Checks run from the hub, or from a system's agent for services
+						the hub can't reach, and notify you when they go down.
+					</Trans>
+				</p>
+			</div>
+			<Separator className="my-4" />
+			<div className="space-y-4">
+				{checks.map((check) => (
+					<CheckCard
+						key={check.id}
+						check={check}
+						systemName={systems.find((system) => system.id === check.system)?.name}
+						readOnly={readOnly}
+						onUpdate={(data) => updateCheck(check.id, data)}
+						onDelete={() => deleteCheck(check.id)}
+					/>
+				))}
+			</div>
+			{!readOnly && (
+				<form onSubmit={createCheck} className="flex flex-wrap sm:flex-nowrap gap-2 mt-5">
+					<Input
+						className="sm:w-48"
+						placeholder={t`Check name`}
+						value={name}
+						onChange={(e) => setName(e.target.value)}
+						required
+					/>
+					<Select value={type} onValueChange={(value) => setType(value as CheckRecord["type"])}>
+						<SelectTrigger className="w-28">
+							<SelectValue />
+						</SelectTrigger>
+						<SelectContent>
+							<SelectItem value="http">HTTP(S)</SelectItem>
+							<SelectItem value="tcp">TCP</SelectItem>
+						</SelectContent>
+					</Select>
+					<Input
+						placeholder={type === "http" ? "https://example.com/health" : "db.example.com:5432"}
+						value={target}
+						onChange={(e) => setTarget(e.target.value)}
+						required
+					/>
+					<Button type="submit" className="flex items-center gap-1">
+						<PlusIcon className="h-4 w-4" />
+						<Trans>Create</Trans>
+					</Button>
+				</form>
+			)}
+		</div>
+	)
+}
+
+function CheckCard({
+	check,
+	systemName,
+	readOnly,
+	onUpdate,
+	onDelete,
+}: {
+	check: CheckRecord
+	systemName?: string
+	readOnly: boolean
+	onUpdate: (data: Partial<CheckRecord>) => void
+	onDelete: () => void
+}) {
+	const systems = useStore($systems)
+	const paused = check.status === "paused"
+
+	return (
+		<div className="rounded-md border p-4 space-y-3">
+			<div className="flex items-center gap-2">
+				<span className={cn("h-2.5 w-2.5 shrink-0 rounded-full", statusColors[check.status] ?? statusColors.pending)} />
+				<div className="flex-1 min-w-0">
+					<h4 className="font-semibold truncate">{check.name}</h4>
+					<div className="text-sm text-muted-foreground truncate">
+						{check.target}
+						{check.checked && (
+							<>
+								{" · "}
+								{check.code > 0 && `${check.code} · `}
+								{check.latency.toFixed(0)} ms{" · "}
+								{formatShortDate(check.checked)}
+							</>
+						)}
+						{systemName && (
+							<>
+								{" · "}
+								<Trans>via {systemName}</Trans>
+							</>
+						)}
+					</div>
+					{check.error && <div className="text-sm text-red-600 dark:text-red-400 break-all">{check.error}</div>}
+				</div>
+				{!readOnly && (
+					<>
+						<Button
+							variant="ghost"
+							size="icon"
+							onClick={() => onUpdate({ status: paused ? "pending" : "paused" })}
+							title={paused ? t`Resume` : t`Pause`}
+						>
+							{paused ? <PlayIcon className="h-4 w-4" /> : <PauseIcon className="h-4 w-4" />}
+						</Button>
+						<Button variant="ghost" size="icon" onClick={onDelete} title={t`Delete`}>
+							<Trash2Icon className="h-4 w-4" />
+						</Button>
+					</>
+				)}
+			</div>
+			{!readOnly && (
+				<div className="grid sm:grid-cols-3 gap-3">
+					<div className="space-y-1.5">
+						<Label htmlFor={`system-${check.id}`}>
+							<Trans>Run from</Trans>
+						</Label>
+						<Select value={check.system || "hub"} onValueChange={(value) => onUpdate({ system: value === "hub" ? "" : value })}>
+							<SelectTrigger id={`system-${check.id}`}>
+								<SelectValue />
+							</SelectTrigger>
+							<SelectContent>
+								<SelectItem value="hub">
+									<Trans>Hub</Trans>
+								</SelectItem>
+								{systems.map((system) => (
+									<SelectItem key={system.id} value={system.id}>
+										{system.name}
+									</SelectItem>
+								))}
+							</SelectContent>
+						</Select>
+					</div>
+					<div className="space-y-1.5">
+						<Label htmlFor={`interval-${check.id}`}>
+							<Trans>Interval (seconds)</Trans>
+						</Label>
+						<Input
+							id={`interval-${check.id}`}
+							type="number"
+							min={30}
+							defaultValue={check.interval}
+							onBlur={(e) => onUpdate({ interval: Number(e.target.value) })}
+						/>
+					</div>
+					<div className="space-y-1.5">
+						<Label htmlFor={`retries-${check.id}`}>
+							<Trans>Retries before down</Trans>
+						</Label>
+						<Input
+							id={`retries-${check.id}`}
+							type="number"
+							min={0}
+							max={10}
+							defaultValue={check.retries}
+							onBlur={(e) => onUpdate({ retries: Number(e.target.value) })}
+						/>
+					</div>
+					{check.type === "http" && (
+						<>
+							<div className="space-y-1.5">
+								<Label htmlFor={`status-${check.id}`}>
+									<Trans>Expected status</Trans>
+								</Label>
+								<Input
+									id={`status-${check.id}`}
+									type="number"
+									placeholder={t`Any 2xx or 3xx`}
+									defaultValue={check.expected_status || ""}
+									onBlur={(e) => onUpdate({ expected_status: Number(e.target.value) })}
+								/>
+							</div>
+							<div className="space-y-1.5 sm:col-span-2">
+								<Label htmlFor={`keyword-${check.id}`}>
+									<Trans>Keyword</Trans>
+								</Label>
+								<Input
+									id={`keyword-${check.id}`}
+									placeholder={t`Text the response must contain`}
+									defaultValue={check.keyword}
+									onBlur={(e) => onUpdate({ keyword: e.target.value })}
+								/>
+							</div>
+						</>
+					)}
+					<Label className="flex items-center gap-2 font-normal sm:col-span-3">
+						<Switch checked={check.notify} onCheckedChange={(notify) => onUpdate({ notify })} />
+						<Trans>Notify me when the check goes down or recovers</Trans>
+					</Label>
+				</div>
+			)}
+		</div>
+	)
+}
@@ -89,11 +89,15 @@ export default function SettingsProfilePage({ userSettings }: { userSettings: Us
 							<SelectValue />
 						</SelectTrigger>
 						<SelectContent>
-							{Object.entries(chartTimeData).map(([value, { label }]) => (
-								<SelectItem key={value} value={value}>
-									{label()}
-								</SelectItem>
-							))}
+							{Object.entries(chartTimeData).map(
+								([value, { label }]) =>
+									// 10 minutes is only available for systems with fast polling
+									value !== "10m" && (
+										<SelectItem key={value} value={value}>
+											{label()}
+										</SelectItem>
+									)
+							)}
 						</SelectContent>
 					</Select>
 					<p className="text-[0.8rem] text-muted-foreground">
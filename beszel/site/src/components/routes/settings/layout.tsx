@@ -5,13 +5,29 @@ import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/com
 import { useStore } from "@nanostores/react"
 import { $router } from "@/components/router.tsx"
 import { redirectPage } from "@nanostores/router"
-import { BellIcon, FileSlidersIcon, SettingsIcon } from "lucide-react"
+import {
+	ActivityIcon,
+	ArchiveIcon,
+	BellIcon,
+	BellOffIcon,
+	DownloadIcon,
+	FileSlidersIcon,
+	GlobeIcon,
+	KeyRoundIcon,
+	SettingsIcon,
+} from "lucide-react"
 import { $userSettings, pb } from "@/lib/stores.ts"
 import { toast } from "@/components/ui/use-toast.ts"
 import { UserSettings } from "@/types.js"
 import General from "./general.tsx"
 import Notifications from "./notifications.tsx"
 import ConfigYaml from "./config-yaml.tsx"
+import StatusPages from "./status-pages.tsx"
+import QuietHours from "./quiet-hours.tsx"
+import AgentUpdates from "./agents.tsx"
+import ApiTokens from "./api-tokens.tsx"
+import Checks from "./checks.tsx"
+import Backups from "./backups.tsx"
 import { Trans, t } from "@lingui/macro"
 import { useLingui } from "@lingui/react"
 
@@ -57,6 +73,38 @@ export default function SettingsLayout() {
 			href: "/settings/notifications",
 			icon: BellIcon,
 		},
+		{
+			title: t`Quiet Hours`,
+			href: "/settings/quiet",
+			icon: BellOffIcon,
+		},
+		{
+			title: t`Checks`,
+			href: "/settings/checks",
+			icon: ActivityIcon,
+		},
+		{
+			title: t`Status Pages`,
+			href: "/settings/status",
+			icon: GlobeIcon,
+		},
+		{
+			title: t`API Tokens`,
+			href: "/settings/tokens",
+			icon: KeyRoundIcon,
+		},
+		{
+			title: t`Agent Updates`,
+			href: "/settings/agents",
+			icon: DownloadIcon,
+			admin: true,
+		},
+		{
+			title: t`Backups`,
+			href: "/settings/backups",
+			icon: ArchiveIcon,
+			admin: true,
+		},
 		{
 			title: t`YAML Config`,
 			href: "/settings/config",
@@ -111,5 +159,17 @@ function SettingsContent({ name }: { name: string }) {
 			return <Notifications userSettings={userSettings} />
 		case "config":
 			return <ConfigYaml />
+		case "status":
+			return <StatusPages />
+		case "quiet":
+			return <QuietHours />
+		case "agents":
+			return <AgentUpdates />
+		case "tokens":
+			return <ApiTokens />
+		case "checks":
+			return <Checks />
+		case "backups":
+			return <Backups />
 	}
 }
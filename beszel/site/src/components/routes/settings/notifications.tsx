@@ -4,15 +4,35 @@ import { Label } from "@/components/ui/label"
 import { pb } from "@/lib/stores"
 import { Separator } from "@/components/ui/separator"
 import { Card } from "@/components/ui/card"
-import { BellIcon, LoaderCircleIcon, PlusIcon, SaveIcon, Trash2Icon } from "lucide-react"
+import {
+	TriangleAlertIcon,
+	BellIcon,
+	EyeIcon,
+	LoaderCircleIcon,
+	PlusIcon,
+	RotateCcwIcon,
+	SaveIcon,
+	Trash2Icon,
+	XIcon,
+} from "lucide-react"
 import { ChangeEventHandler, useEffect, useState } from "react"
 import { toast } from "@/components/ui/use-toast"
 import { InputTags } from "@/components/ui/input-tags"
-import { UserSettings } from "@/types"
+import { Textarea } from "@/components/ui/textarea"
+import {
+	NotificationChannel,
+	NotificationChannelRecord,
+	NotificationQueueRecord,
+	NotificationTemplate,
+	UserSettings,
+} from "@/types"
 import { saveSettings } from "./layout"
 import * as v from "valibot"
-import { isAdmin } from "@/lib/utils"
+import { formatShortDate, isAdmin } from "@/lib/utils"
 import { Trans, t } from "@lingui/macro"
+import { useLingui } from "@lingui/react"
+import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from "@/components/ui/select"
+import languages from "@/lib/languages"
 
 interface ShoutrrrUrlCardProps {
 	url: string
@@ -23,17 +43,69 @@ interface ShoutrrrUrlCardProps {
 const NotificationSchema = v.object({
 	emails: v.array(v.pipe(v.string(), v.email())),
 	webhooks: v.array(v.pipe(v.string(), v.url())),
+	locale: v.string(),
+	units: v.picklist(["binary", "decimal"]),
+	timeFormat: v.picklist(["24h", "12h"]),
+	templates: v.record(v.picklist(["email", "webhook", "shoutrrr"]), v.object({ title: v.string(), body: v.string() })),
 })
 
 const SettingsNotificationsPage = ({ userSettings }: { userSettings: UserSettings }) => {
 	const [webhooks, setWebhooks] = useState(userSettings.webhooks ?? [])
 	const [emails, setEmails] = useState<string[]>(userSettings.emails ?? [])
+	const { i18n } = useLingui()
+	const [locale, setLocale] = useState(userSettings.locale ?? i18n.locale)
+	const [units, setUnits] = useState(userSettings.units ?? "binary")
+	const [timeFormat, setTimeFormat] = useState(userSettings.timeFormat ?? "24h")
+	const [templates, setTemplates] = useState(userSettings.templates ?? {})
 	const [isLoading, setIsLoading] = useState(false)
+	const [failingChannels, setFailingChannels] = useState<NotificationChannelRecord[]>([])
+	const [failedNotifications, setFailedNotifications] = useState<NotificationQueueRecord[]>([])
+
+	// channels are checked by the hub every hour and after each notification
+	useEffect(() => {
+		pb.collection<NotificationChannelRecord>("notification_channels")
+			.getFullList({ filter: "healthy = false", sort: "failing_since" })
+			.then(setFailingChannels)
+			.catch(() => setFailingChannels([]))
+	}, [])
+
+	// notifications that failed after all retries
+	useEffect(() => {
+		pb.collection<NotificationQueueRecord>("notification_queue")
+			.getFullList({
+				filter: pb.filter("status = 'failed' && user = {:user}", { user: pb.authStore.record?.id }),
+				sort: "-updated",
+			})
+			.then(setFailedNotifications)
+			.catch(() => setFailedNotifications([]))
+	}, [])
+
+	async function retryNotification(id: string) {
+		try {
+			await pb.send("/api/beszel/notifications/retry", { method: "POST", body: { id } })
+			setFailedNotifications(failedNotifications.filter((n) => n.id !== id))
+		} catch (e: any) {
+			toast({ title: t`Error`, description: e.message, variant: "destructive" })
+		}
+	}
+
+	async function dismissNotification(id: string) {
+		try {
+			await pb.collection("notification_queue").delete(id)
+			setFailedNotifications(failedNotifications.filter((n) => n.id !== id))
+		} catch (e: any) {
+			toast({ title: t`Error`, description: e.message, variant: "destructive" })
+		}
+	}
 
 	// update values when userSettings changes
 	useEffect(() => {
 		setWebhooks(userSettings.webhooks ?? [])
 		setEmails(userSettings.emails ?? [])
+		setLocale(userSettings.locale ?? i18n.locale)
+		setUnits(userSettings.units ?? "binary")
+		setTimeFormat(userSettings.timeFormat ?? "24h")
+		setTemplates(userSettings.templates ?? {})
 	}, [userSettings])
 
 	function addWebhook() {
@@ -55,7 +127,18 @@ const SettingsNotificationsPage = ({ userSettings }: { userSettings: UserSetting
 	async function updateSettings() {
 		setIsLoading(true)
 		try {
-			const parsedData = v.parse(NotificationSchema, { emails, webhooks })
+			// drop empty templates so the default message is used
+			const usedTemplates = Object.fromEntries(
+				Object.entries(templates).filter(([, template]) => template.title || template.body)
+			)
+			const parsedData = v.parse(NotificationSchema, {
+				emails,
+				webhooks,
+				locale,
+				units,
+				timeFormat,
+				templates: usedTemplates,
+			})
 			await saveSettings(parsedData)
 		} catch (e: any) {
 			toast({
@@ -84,6 +167,66 @@ const SettingsNotificationsPage = ({ userSettings }: { userSettings: UserSetting
 				</p>
 			</div>
 			<Separator className="my-4" />
+			{failingChannels.length > 0 && (
+				<Card className="border-destructive/50 p-3 mb-5 space-y-2">
+					<h3 className="font-medium flex items-center gap-2">
+						<TriangleAlertIcon className="h-4 w-4 text-destructive" />
+						<Trans>Failing notification channels</Trans>
+					</h3>
+					{failingChannels.map((channel) => (
+						<div key={channel.id} className="text-sm">
+							<span className="font-medium">
+								{channel.user ? channel.name : <Trans>SMTP server {channel.name}</Trans>}
+							</span>
+							<span className="text-muted-foreground">
+								{" · "}
+								<Trans>Failing since {formatShortDate(channel.failing_since)}</Trans>
+								{" · "}
+								{channel.error}
+							</span>
+						</div>
+					))}
+				</Card>
+			)}
+			{failedNotifications.length > 0 && (
+				<Card className="border-destructive/50 p-3 mb-5 space-y-2">
+					<h3 className="font-medium flex items-center gap-2">
+						<TriangleAlertIcon className="h-4 w-4 text-destructive" />
+						<Trans>Undelivered notifications</Trans>
+					</h3>
+					{failedNotifications.map((notification) => (
+						<div key={notification.id} className="text-sm flex items-center gap-2">
+							<div className="flex-1">
+								<span className="font-medium">{notification.title}</span>
+								<span className="text-muted-foreground">
+									{" · "}
+									{formatShortDate(notification.created)}
+									{" · "}
+									{notification.error}
+								</span>
+							</div>
+							<Button
+								variant="ghost"
+								size="icon"
+								className="h-7 w-7 shrink-0"
+								aria-label={t`Retry`}
+								onClick={() => retryNotification(notification.id)}
+							>
+								<RotateCcwIcon className="h-4 w-4" />
+							</Button>
+							<Button
+								variant="ghost"
+								size="icon"
+								className="h-7 w-7 shrink-0"
+								aria-label={t`Dismiss`}
+								onClick={() => dismissNotification(notification.id)}
+							>
+								<XIcon className="h-4 w-4" />
+							</Button>
+						</div>
+					))}
+				</Card>
+			)}
 			<div className="space-y-5">
 				<div className="space-y-2">
 					<div className="mb-4">
@@ -157,6 +300,73 @@ const SettingsNotificationsPage = ({ userSettings }: { userSettings: UserSetting
 					</Button>
 				</div>
 				<Separator />
+				<div className="space-y-2">
+					<div className="mb-4">
+						<h3 className="mb-1 text-lg font-medium">
+							<Trans>Message format</Trans>
+						</h3>
+						<p className="text-sm text-muted-foreground leading-relaxed">
+							<Trans>
+								Notifications are written in the selected language, with numbers, sizes and times formatted using
+								these options.
+							</Trans>
+						</p>
+					</div>
+					<div className="grid sm:grid-cols-3 gap-3">
+						<div className="space-y-2">
+							<Label className="block" htmlFor="locale">
+								<Trans>Language</Trans>
+							</Label>
+							<Select value={locale} onValueChange={setLocale}>
+								<SelectTrigger id="locale">
+									<SelectValue />
+								</SelectTrigger>
+								<SelectContent>
+									{languages.map((lang) => (
+										<SelectItem key={lang.lang} value={lang.lang}>
+											{lang.label} ({(1234.5).toLocaleString(lang.lang, { minimumFractionDigits: 2 })})
+										</SelectItem>
+									))}
+								</SelectContent>
+							</Select>
+						</div>
+						<div className="space-y-2">
+							<Label className="block" htmlFor="units">
+								<Trans>Size units</Trans>
+							</Label>
+							<Select value={units} onValueChange={(value) => setUnits(value as typeof units)}>
+								<SelectTrigger id="units">
+									<SelectValue />
+								</SelectTrigger>
+								<SelectContent>
+									<SelectItem value="binary">GiB, MiB/s (1024)</SelectItem>
+									<SelectItem value="decimal">GB, MB/s (1000)</SelectItem>
+								</SelectContent>
+							</Select>
+						</div>
+						<div className="space-y-2">
+							<Label className="block" htmlFor="timeFormat">
+								<Trans>Time format</Trans>
+							</Label>
+							<Select value={timeFormat} onValueChange={(value) => setTimeFormat(value as typeof timeFormat)}>
+								<SelectTrigger id="timeFormat">
+									<SelectValue />
+								</SelectTrigger>
+								<SelectContent>
+									<SelectItem value="24h">
+										<Trans>24-hour</Trans>
+									</SelectItem>
+									<SelectItem value="12h">
+										<Trans>12-hour</Trans>
+									</SelectItem>
+								</SelectContent>
+							</Select>
+						</div>
+					</div>
+				</div>
+				<Separator />
+				<TemplateEditor templates={templates} setTemplates={setTemplates} />
+				<Separator />
 				<Button
 					type="button"
 					className="flex items-center gap-1.5 disabled:opacity-100"
@@ -222,4 +432,108 @@ const ShoutrrrUrlCard = ({ url, onUrlChange, onRemove }: ShoutrrrUrlCardProps) =
 	)
 }
 
+function TemplateEditor({
+	templates,
+	setTemplates,
+}: {
+	templates: Partial<Record<NotificationChannel, NotificationTemplate>>
+	setTemplates: (templates: Partial<Record<NotificationChannel, NotificationTemplate>>) => void
+}) {
+	const [channel, setChannel] = useState<NotificationChannel>("email")
+	const [preview, setPreview] = useState<{ title: string; body: string; err: string | false } | null>(null)
+	const template = templates[channel] ?? { title: "", body: "" }
+
+	function update(data: Partial<NotificationTemplate>) {
+		setTemplates({ ...templates, [channel]: { ...template, ...data } })
+		setPreview(null)
+	}
+
+	async function showPreview() {
+		try {
+			setPreview(await pb.send("/api/beszel/preview-notification", { method: "POST", body: template }))
+		} catch (e: any) {
+			setPreview({ title: "", body: "", err: e.message })
+		}
+	}
+
+	return (
+		<div className="space-y-2">
+			<div className="mb-4">
+				<h3 className="mb-1 text-lg font-medium">
+					<Trans>Message templates</Trans>
+				</h3>
+				<p className="text-sm text-muted-foreground leading-relaxed">
+					<Trans>
+						Customize the title and body of notifications. Available variables are{" "}
+						<code>{"{{system}}"}</code>, <code>{"{{metric}}"}</code>, <code>{"{{value}}"}</code>,{" "}
+						<code>{"{{threshold}}"}</code>, <code>{"{{duration}}"}</code>, <code>{"{{status}}"}</code>,{" "}
+						<code>{"{{url}}"}</code>, <code>{"{{timestamp}}"}</code>, <code>{"{{title}}"}</code> and{" "}
+						<code>{"{{message}}"}</code>. Leave blank to use the default message.
+					</Trans>
+				</p>
+			</div>
+			<div className="grid sm:grid-cols-3 gap-3">
+				<div className="space-y-2">
+					<Label className="block" htmlFor="template-channel">
+						<Trans>Channel</Trans>
+					</Label>
+					<Select value={channel} onValueChange={(value) => (setChannel(value as NotificationChannel), setPreview(null))}>
+						<SelectTrigger id="template-channel">
+							<SelectValue />
+						</SelectTrigger>
+						<SelectContent>
+							<SelectItem value="email">
+								<Trans>Email</Trans>
+							</SelectItem>
+							<SelectItem value="webhook">
+								<Trans>Generic webhook</Trans>
+							</SelectItem>
+							<SelectItem value="shoutrrr">
+								<Trans>Other Shoutrrr services</Trans>
+							</SelectItem>
+						</SelectContent>
+					</Select>
+				</div>
+				<div className="space-y-2 sm:col-span-2">
+					<Label className="block" htmlFor="template-title">
+						<Trans>Title</Trans>
+					</Label>
+					<Input
+						id="template-title"
+						placeholder="{{system}} {{metric}} {{status}}"
+						value={template.title}
+						onChange={(e) => update({ title: e.target.value })}
+					/>
+				</div>
+			</div>
+			<Label className="block pt-1" htmlFor="template-body">
+				<Trans>Body</Trans>
+			</Label>
+			<Textarea
+				id="template-body"
+				rows={4}
+				placeholder="{{metric}} on {{system}} is {{value}} (threshold {{threshold}}) at {{timestamp}}"
+				value={template.body}
+				onChange={(e) => update({ body: e.target.value })}
+			/>
+			<Button type="button" variant="outline" size="sm" className="flex items-center gap-1.5" onClick={showPreview}>
+				<EyeIcon className="h-4 w-4" />
+				<Trans>Preview</Trans>
+			</Button>
+			{preview && (
+				<Card className="bg-muted/40 p-3 text-sm whitespace-pre-wrap break-words">
+					{preview.err ? (
+						<span className="text-destructive">{preview.err}</span>
+					) : (
+						<>
+							<p className="font-semibold mb-1">{preview.title}</p>
+							<p>{preview.body}</p>
+						</>
+					)}
+				</Card>
+			)}
+		</div>
+	)
+}
+
 export default SettingsNotificationsPage
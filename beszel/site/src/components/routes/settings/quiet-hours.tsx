@@ -0,0 +1,220 @@
+import { Separator } from "@/components/ui/separator"
+import { Button } from "@/components/ui/button"
+import { Input } from "@/components/ui/input"
+import { Label } from "@/components/ui/label"
+import { toast } from "@/components/ui/use-toast"
+import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from "@/components/ui/select"
+import { $systems, pb } from "@/lib/stores"
+import { QuietHoursRecord } from "@/types"
+import { useStore } from "@nanostores/react"
+import { Trans, t } from "@lingui/macro"
+import { PlusIcon, Trash2Icon } from "lucide-react"
+import { useEffect, useState } from "react"
+
+function showError(error: any) {
+	toast({
+		title: t`Error`,
+		description: error.message,
+		variant: "destructive",
+	})
+}
+
+/** Converts a PocketBase date to a datetime-local input value in local time */
+function toInputValue(date: string) {
+	const d = new Date(date)
+	if (isNaN(d.getTime())) {
+		return ""
+	}
+	d.setMinutes(d.getMinutes() - d.getTimezoneOffset())
+	return d.toISOString().slice(0, 16)
+}
+
+export default function QuietHours() {
+	const [windows, setWindows] = useState<QuietHoursRecord[]>([])
+	const [name, setName] = useState("")
+
+	useEffect(() => {
+		pb.collection<QuietHoursRecord>("quiet_hours").getFullList({ sort: "start" }).then(setWindows).catch(showError)
+	}, [])
+
+	async function createWindow(e: React.FormEvent<HTMLFormElement>) {
+		e.preventDefault()
+		const start = new Date()
+		start.setMinutes(0, 0, 0)
+		start.setHours(start.getHours() + 1)
+		try {
+			const quiet = await pb.collection<QuietHoursRecord>("quiet_hours").create({
+				name,
+				user: pb.authStore.record!.id,
+				repeat: "once",
+				start: start.toISOString(),
+				end: new Date(start.getTime() + 3600_000).toISOString(),
+				timezone: Intl.DateTimeFormat().resolvedOptions().timeZone,
+			})
+			setWindows((windows) => [...windows, quiet])
+			setName("")
+		} catch (error) {
+			showError(error)
+		}
+	}
+
+	async function updateWindow(id: string, data: Partial<QuietHoursRecord>) {
+		try {
+			const quiet = await pb.collection<QuietHoursRecord>("quiet_hours").update(id, data)
+			setWindows((windows) => windows.map((w) => (w.id === id ? quiet : w)))
+		} catch (error) {
+			showError(error)
+		}
+	}
+
+	async function deleteWindow(id: string) {
+		try {
+			await pb.collection("quiet_hours").delete(id)
+			setWindows((windows) => windows.filter((w) => w.id !== id))
+		} catch (error) {
+			showError(error)
+		}
+	}
+
+	return (
+		<div>
+			<div>
+				<h3 className="text-xl font-medium mb-2">
+					<Trans>Quiet Hours</Trans>
+				</h3>
+				<p className="text-sm text-muted-foreground leading-relaxed">
+					<Trans>
+						Suppress your notifications during maintenance or at night. Alerts still change state, but nothing is sent
+						while a window is active.
+					</Trans>
+				</p>
+			</div>
+			<Separator className="my-4" />
+			<div className="space-y-4">
+				{windows.map((quiet) => (
+					<QuietHoursCard
+						key={quiet.id}
+						quiet={quiet}
+						onUpdate={(data) => updateWindow(quiet.id, data)}
+						onDelete={() => deleteWindow(quiet.id)}
+					/>
+				))}
+			</div>
+			<form onSubmit={createWindow} className="flex gap-2 mt-5">
+				<Input placeholder={t`Window name`} value={name} onChange={(e) => setName(e.target.value)} required />
+				<Button type="submit" className="flex items-center gap-1">
+					<PlusIcon className="h-4 w-4" />
+					<Trans>Create</Trans>
+				</Button>
+			</form>
+		</div>
+	)
+}
+
+function QuietHoursCard({
+	quiet,
+	onUpdate,
+	onDelete,
+}: {
+	quiet: QuietHoursRecord
+	onUpdate: (data: Partial<QuietHoursRecord>) => void
+	onDelete: () => void
+}) {
+	const systems = useStore($systems)
+
+	function updateDate(field: "start" | "end", value: string) {
+		const date = new Date(value)
+		if (!isNaN(date.getTime())) {
+			onUpdate({ [field]: date.toISOString() })
+		}
+	}
+
+	return (
+		<div className="rounded-md border p-4 space-y-3">
+			<div className="flex items-center gap-2">
+				<h4 className="font-semibold flex-1 truncate">{quiet.name}</h4>
+				<Button variant="ghost" size="icon" onClick={onDelete} title={t`Delete`}>
+					<Trash2Icon className="h-4 w-4" />
+				</Button>
+			</div>
+			<div className="grid sm:grid-cols-2 gap-3">
+				<div className="space-y-1.5">
+					<Label htmlFor={`system-${quiet.id}`}>
+						<Trans>System</Trans>
+					</Label>
+					<Select value={quiet.system || "all"} onValueChange={(value) => onUpdate({ system: value === "all" ? "" : value })}>
+						<SelectTrigger id={`system-${quiet.id}`}>
+							<SelectValue />
+						</SelectTrigger>
+						<SelectContent>
+							<SelectItem value="all">
+								<Trans>All Systems</Trans>
+							</SelectItem>
+							{systems.map((system) => (
+								<SelectItem key={system.id} value={system.id}>
+									{system.name}
+								</SelectItem>
+							))}
+						</SelectContent>
+					</Select>
+				</div>
+				<div className="space-y-1.5">
+					<Label htmlFor={`repeat-${quiet.id}`}>
+						<Trans>Repeat</Trans>
+					</Label>
+					<Select
+						value={quiet.repeat}
+						onValueChange={(repeat) =>
+							onUpdate({
+								repeat: repeat as QuietHoursRecord["repeat"],
+								timezone: Intl.DateTimeFormat().resolvedOptions().timeZone,
+							})
+						}
+					>
+						<SelectTrigger id={`repeat-${quiet.id}`}>
+							<SelectValue />
+						</SelectTrigger>
+						<SelectContent>
+							<SelectItem value="once">
+								<Trans>Once</Trans>
+							</SelectItem>
+							<SelectItem value="daily">
+								<Trans>Daily</Trans>
+							</SelectItem>
+							<SelectItem value="weekly">
+								<Trans>Weekly</Trans>
+							</SelectItem>
+						</SelectContent>
+					</Select>
+				</div>
+				<div className="space-y-1.5">
+					<Label htmlFor={`start-${quiet.id}`}>
+						<Trans>Start</Trans>
+					</Label>
+					<Input
+						id={`start-${quiet.id}`}
+						type="datetime-local"
+						defaultValue={toInputValue(quiet.start)}
+						onBlur={(e) => updateDate("start", e.target.value)}
+					/>
+				</div>
+				<div className="space-y-1.5">
+					<Label htmlFor={`end-${quiet.id}`}>
+						<Trans>End</Trans>
+					</Label>
+					<Input
+						id={`end-${quiet.id}`}
+						type="datetime-local"
+						defaultValue={toInputValue(quiet.end)}
+						onBlur={(e) => updateDate("end", e.target.value)}
+					/>
+				</div>
+			</div>
+			{quiet.repeat !== "once" && (
+				<p className="text-xs text-muted-foreground">
+					<Trans>Repeats at the same local time ({quiet.timezone || "UTC"}).</Trans>
+				</p>
+			)}
+		</div>
+	)
+}
@@ -0,0 +1,168 @@
+import { Separator } from "@/components/ui/separator"
+import { Button } from "@/components/ui/button"
+import { Input } from "@/components/ui/input"
+import { Label } from "@/components/ui/label"
+import { Switch } from "@/components/ui/switch"
+import { Checkbox } from "@/components/ui/checkbox"
+import { toast } from "@/components/ui/use-toast"
+import { $systems, pb } from "@/lib/stores"
+import { StatusPageRecord } from "@/types"
+import { useStore } from "@nanostores/react"
+import { Trans, t } from "@lingui/macro"
+import { ExternalLinkIcon, PlusIcon, RefreshCwIcon, Trash2Icon } from "lucide-react"
+import { useEffect, useState } from "react"
+
+function showError(error: any) {
+	toast({
+		title: t`Error`,
+		description: error.message,
+		variant: "destructive",
+	})
+}
+
+export default function StatusPages() {
+	const [pages, setPages] = useState<StatusPageRecord[]>([])
+	const [name, setName] = useState("")
+
+	useEffect(() => {
+		pb.collection<StatusPageRecord>("status_pages").getFullList({ sort: "name" }).then(setPages).catch(showError)
+	}, [])
+
+	async function createPage(e: React.FormEvent<HTMLFormElement>) {
+		e.preventDefault()
+		try {
+			const page = await pb.collection<StatusPageRecord>("status_pages").create({
+				name,
+				user: pb.authStore.model!.id,
+				enabled: true,
+				charts: true,
+			})
+			setPages((pages) => [...pages, page])
+			setName("")
+		} catch (error) {
+			showError(error)
+		}
+	}
+
+	async function updatePage(id: string, data: Partial<StatusPageRecord>) {
+		try {
+			const page = await pb.collection<StatusPageRecord>("status_pages").update(id, data)
+			setPages((pages) => pages.map((p) => (p.id === id ? page : p)))
+		} catch (error) {
+			showError(error)
+		}
+	}
+
+	async function rotateSlug(id: string) {
+		try {
+			const { slug } = await pb.send<{ slug: string }>("/api/beszel/status-pages/rotate", {
+				method: "POST",
+				body: { id },
+			})
+			setPages((pages) => pages.map((p) => (p.id === id ? { ...p, slug } : p)))
+			toast({ title: t`URL changed`, description: t`The previous URL no longer works.` })
+		} catch (error) {
+			showError(error)
+		}
+	}
+
+	async function deletePage(id: string) {
+		try {
+			await pb.collection("status_pages").delete(id)
+			setPages((pages) => pages.filter((p) => p.id !== id))
+		} catch (error) {
+			showError(error)
+		}
+	}
+
+	return (
+		<div>
+			<div>
+				<h3 className="text-xl font-medium mb-2">
+					<Trans>Status Pages</Trans>
+				</h3>
+				<p className="text-sm text-muted-foreground leading-relaxed">
+					<Trans>Share the status of selected systems on a public page that doesn't require login.</Trans>
+				</p>
+			</div>
+			<Separator className="my-4" />
+			<div className="space-y-4">
+				{pages.map((page) => (
+					<StatusPageCard
+						key={page.id}
+						page={page}
+						onUpdate={(data) => updatePage(page.id, data)}
+						onRotate={() => rotateSlug(page.id)}
+						onDelete={() => deletePage(page.id)}
+					/>
+				))}
+			</div>
+			<form onSubmit={createPage} className="flex gap-2 mt-5">
+				<Input placeholder={t`Page name`} value={name} onChange={(e) => setName(e.target.value)} required />
+				<Button type="submit" className="flex items-center gap-1">
+					<PlusIcon className="h-4 w-4" />
+					<Trans>Create</Trans>
+				</Button>
+			</form>
+		</div>
+	)
+}
+
+function StatusPageCard({
+	page,
+	onUpdate,
+	onRotate,
+	onDelete,
+}: {
+	page: StatusPageRecord
+	onUpdate: (data: Partial<StatusPageRecord>) => void
+	onRotate: () => void
+	onDelete: () => void
+}) {
+	const systems = useStore($systems)
+	const url = `${location.origin}/status/${page.slug}`
+
+	function toggleSystem(id: string, checked: boolean) {
+		const selected = checked ? [...page.systems, id] : page.systems.filter((s) => s !== id)
+		onUpdate({ systems: selected })
+	}
+
+	return (
+		<div className="rounded-md border p-4 space-y-3">
+			<div className="flex items-center gap-2">
+				<h4 className="font-semibold flex-1 truncate">{page.name}</h4>
+				<Button variant="ghost" size="icon" onClick={onRotate} title={t`Change URL`}>
+					<RefreshCwIcon className="h-4 w-4" />
+				</Button>
+				<Button variant="ghost" size="icon" onClick={onDelete} title={t`Delete`}>
+					<Trash2Icon className="h-4 w-4" />
+				</Button>
+			</div>
+			<a href={url} target="_blank" rel="noopener" className="text-sm text-muted-foreground flex items-center gap-1 break-all">
+				{url}
+				<ExternalLinkIcon className="h-3.5 w-3.5 shrink-0" />
+			</a>
+			<div className="flex flex-wrap gap-5">
+				<Label className="flex items-center gap-2">
+					<Switch checked={page.enabled} onCheckedChange={(enabled) => onUpdate({ enabled })} />
+					<Trans>Enabled</Trans>
+				</Label>
+				<Label className="flex items-center gap-2">
+					<Switch checked={page.charts} onCheckedChange={(charts) => onUpdate({ charts })} />
+					<Trans>CPU and memory charts</Trans>
+				</Label>
+			</div>
+			<div className="grid sm:grid-cols-2 gap-2">
+				{systems.map((system) => (
+					<Label key={system.id} className="flex items-center gap-2 font-normal">
+						<Checkbox
+							checked={page.systems.includes(system.id)}
+							onCheckedChange={(checked) => toggleSystem(system.id, checked === true)}
+						/>
+						{system.name}
+					</Label>
+				))}
+			</div>
+		</div>
+	)
+}
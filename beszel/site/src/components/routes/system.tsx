@@ -1,18 +1,44 @@
-import { $systems, pb, $chartTime, $containerFilter, $userSettings, $direction } from "@/lib/stores"
-import { ChartData, ChartTimes, ContainerStatsRecord, GPUData, SystemRecord, SystemStatsRecord } from "@/types"
+import { $systems, pb, $chartTime, $containerFilter, $containerGroup, $userSettings, $direction } from "@/lib/stores"
+import {
+	Battery,
+	ChartData,
+	ChartTimes,
+	CollectionErrorCode,
+	ContainerStatsRecord,
+	GPUData,
+	MetricCatalog,
+	MetricSeries,
+	SystemRecord,
+	SystemStats,
+	SystemStatsRecord,
+} from "@/types"
 import React, { lazy, useCallback, useEffect, useMemo, useRef, useState } from "react"
 import { Card, CardHeader, CardTitle, CardDescription } from "../ui/card"
 import { useStore } from "@nanostores/react"
 import Spinner from "../spinner"
-import { ClockArrowUp, CpuIcon, GlobeIcon, LayoutGridIcon, MonitorIcon, XIcon } from "lucide-react"
+import {
+	BatteryMediumIcon,
+	Clock3Icon,
+	ClockArrowUp,
+	CpuIcon,
+	GlobeIcon,
+	HourglassIcon,
+	LayersIcon,
+	LayoutGridIcon,
+	MonitorIcon,
+	RadioIcon,
+	TriangleAlertIcon,
+	XIcon,
+} from "lucide-react"
 import ChartTimeSelect from "../charts/chart-time-select"
 import { chartTimeData, cn, getPbTimestamp, getSizeAndUnit, toFixedFloat, useLocalStorage } from "@/lib/utils"
 import { Separator } from "../ui/separator"
 import { Tooltip, TooltipContent, TooltipProvider, TooltipTrigger } from "../ui/tooltip"
 import { Button } from "../ui/button"
 import { Input } from "../ui/input"
-import { ChartAverage, ChartMax, Rows, TuxIcon } from "../ui/icons"
+import { ChartAverage, ChartMax, Rows, ThermometerIcon, TuxIcon } from "../ui/icons"
 import { useIntersectionObserver } from "@/lib/use-intersection-observer"
+import { useLiveStats } from "@/lib/use-live-stats"
 import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from "../ui/select"
 import { timeTicks } from "d3-time"
 import { Plural, Trans, t } from "@lingui/macro"
@@ -24,12 +50,45 @@ const MemChart = lazy(() => import("../charts/mem-chart"))
 const DiskChart = lazy(() => import("../charts/disk-chart"))
 const SwapChart = lazy(() => import("../charts/swap-chart"))
 const TemperatureChart = lazy(() => import("../charts/temperature-chart"))
+const SeriesChart = lazy(() => import("../charts/series-chart"))
+const CpuCoresChart = lazy(() => import("../charts/cpu-cores-chart"))
 const GpuPowerChart = lazy(() => import("../charts/gpu-power-chart"))
+const ExpressionChart = lazy(() => import("../charts/expression-chart"))
+const LoadChart = lazy(() => import("../charts/load-chart"))
+const FdChart = lazy(() => import("../charts/fd-chart"))
 
 const cache = new Map<string, any>()
 
+/** Time range of an alert, shown instead of the chart time while its chart time is selected */
+interface AlertWindow {
+	from: number
+	to: number
+	chartTime: ChartTimes
+}
+
+/** Returns the time range in the from and to url params (used by links in notifications) */
+function getAlertWindow(): AlertWindow | undefined {
+	const params = new URLSearchParams(window.location.search)
+	const from = Number(params.get("from"))
+	const to = Number(params.get("to"))
+	if (!from || !to || from >= to) {
+		return
+	}
+	// shortest chart time with data from the start of the window
+	const now = new Date()
+	const chartTime = (["1h", "12h", "24h", "1w", "30d"] as ChartTimes[]).find(
+		(chartTime) => chartTimeData[chartTime].getOffset(now).getTime() <= from
+	)
+	return chartTime && { from, to, chartTime }
+}
+
 // create ticks and domain for charts
-function getTimeData(chartTime: ChartTimes, lastCreated: number) {
+function getTimeData(chartTime: ChartTimes, lastCreated: number, alertWindow?: AlertWindow) {
+	if (alertWindow) {
+		const { from, to } = alertWindow
+		const ticks = timeTicks(new Date(from), new Date(to), chartTimeData[chartTime].ticks ?? 12)
+		return { ticks: ticks.map((date) => date.getTime()), domain: [from, to] }
+	}
 	const cached = cache.get("td")
 	if (cached && cached.chartTime === chartTime) {
 		if (!lastCreated || cached.time >= lastCreated) {
@@ -75,6 +134,13 @@ function addEmptyValues<T extends SystemStatsRecord | ContainerStatsRecord>(
 
 async function getStats<T>(collection: string, system: SystemRecord, chartTime: ChartTimes): Promise<T[]> {
 	const lastCached = cache.get(`${system.id}_${chartTime}_${collection}`)?.at(-1)?.created as number
+	// 10 second stats are only saved for the system, in their own collection
+	if (chartTimeData[chartTime].type === "10s") {
+		if (collection !== "system_stats") {
+			return []
+		}
+		collection = "fast_stats"
+	}
 	return await pb.collection<T>(collection).getFullList({
 		filter: pb.filter("system={:id} && created > {:created} && type={:type}", {
 			id: system.id,
@@ -87,12 +153,84 @@ async function getStats<T>(collection: string, system: SystemRecord, chartTime:
 }
 
 function dockerOrPodman(str: string, system: SystemRecord) {
+	if (system.info.k8s) {
+		return str.replace("docker containers", "pods").replace("Docker", "Pod")
+	}
 	if (system.info.p) {
 		str = str.replace("docker", "podman").replace("Docker", "Podman")
 	}
 	return str
 }
 
+/** Describes why the agent couldn't collect data for a subsystem */
+function collectionErrorMessage(subsystem: string, code: CollectionErrorCode) {
+	const name =
+		{ docker: "Docker", smart: "S.M.A.R.T.", systemd: "Systemd", kubernetes: "Kubernetes", proxmox: "Proxmox" }[
+			subsystem
+		] ?? subsystem
+	switch (code) {
+		case "docker_unavailable":
+			return t`Docker unavailable`
+		case "smartctl_missing":
+			return t`smartctl not installed`
+		case "permission_denied":
+			return t`${name}: permission denied`
+		default:
+			return t`${name}: collection failed`
+	}
+}
+
+/** Translated name of a battery state */
+/** Returns a value of each key of a stats map, e.g. utilization of each network interface */
+function mapValues<T>(values: Record<string, T> | undefined, getValue: (value: T) => number | undefined) {
+	if (!values) {
+		return undefined
+	}
+	const result = {} as Record<string, number>
+	for (const [key, value] of Object.entries(values)) {
+		const v = value && getValue(value)
+		if (v !== undefined) {
+			result[key] = v
+		}
+	}
+	return result
+}
+
+// values of series charts (interfaces without a link speed have no utilization)
+const nicUtilization = (stats: SystemStats) => mapValues(stats.ni, (nic) => (nic.sp ? nic.u ?? 0 : undefined))
+const deviceThroughput = (stats: SystemStats) => mapValues(stats.dio, (d) => d.r + d.w)
+const deviceIops = (stats: SystemStats) => mapValues(stats.dio, (d) => d.ri + d.wi)
+const deviceAwait = (stats: SystemStats) => mapValues(stats.dio, (d) => d.a ?? 0)
+const voltages = (stats: SystemStats) => stats.volt
+const pressure = ({ psi }: SystemStats) =>
+	psi && {
+		CPU: psi.cs ?? 0,
+		Memory: psi.ms ?? 0,
+		"Memory (full)": psi.mf ?? 0,
+		"I/O": psi.is ?? 0,
+		"I/O (full)": psi.if ?? 0,
+	}
+const cpuBreakdown = (stats: SystemStats) =>
+	stats.cpuu === undefined
+		? undefined
+		: { User: stats.cpuu, System: stats.cpus ?? 0, "I/O Wait": stats.cpui ?? 0, Steal: stats.cpust ?? 0 }
+/** Engine utilization of a gpu, cached so each gpu's chart keeps the same function */
+const gpuEngineGetters = {} as Record<string, (stats: SystemStats) => Record<string, number> | undefined>
+const gpuEngines = (id: string) => (gpuEngineGetters[id] ??= (stats: SystemStats) => stats.g?.[id]?.e)
+
+function batteryStateName(state: Battery["s"]) {
+	switch (state) {
+		case "charging":
+			return t`Charging`
+		case "discharging":
+			return t`Discharging`
+		case "full":
+			return t`Full`
+		default:
+			return t`Idle`
+	}
+}
+
 export default function SystemDetail({ name }: { name: string }) {
 	const direction = useStore($direction)
 	const { _ } = useLingui()
@@ -103,24 +241,45 @@ export default function SystemDetail({ name }: { name: string }) {
 	const bandwidthMaxStore = useState(false)
 	const diskIoMaxStore = useState(false)
 	const [grid, setGrid] = useLocalStorage("grid", true)
+	const [expression, setExpression] = useLocalStorage("expression", "")
 	const [system, setSystem] = useState({} as SystemRecord)
 	const [systemStats, setSystemStats] = useState([] as SystemStatsRecord[])
 	const [containerData, setContainerData] = useState([] as ChartData["containerData"])
+	const containerRecords = useRef([] as ContainerStatsRecord[])
+	const containerGroup = useStore($containerGroup)
 	const netCardRef = useRef<HTMLDivElement>(null)
 	const [containerFilterBar, setContainerFilterBar] = useState(null as null | JSX.Element)
 	const [bottomSpacing, setBottomSpacing] = useState(0)
 	const [chartLoading, setChartLoading] = useState(true)
-	const isLongerChart = chartTime !== "1h"
+	/** Series reported by the agent that don't have a chart of their own */
+	const [otherMetrics, setOtherMetrics] = useState([] as MetricSeries[])
+	/** Time range of the alert the page was opened from, until the chart time changes */
+	const [alertWindow, setAlertWindow] = useState<AlertWindow>()
+	const isLongerChart = chartTime !== "1h" && chartTime !== "10m"
+	/** Poll the agent every second while viewing the last hour */
+	const [live, setLive] = useState(false)
+	const liveStats = useLiveStats(system.id, !isLongerChart, live ? 1 : undefined)
 
 	useEffect(() => {
 		document.title = `${name} / Beszel`
+		// set chart time from url (used by links in notifications)
+		const urlWindow = getAlertWindow()
+		const urlChartTime = new URLSearchParams(window.location.search).get("t") as ChartTimes | null
+		if (urlWindow) {
+			$chartTime.set(urlWindow.chartTime)
+			setAlertWindow(urlWindow)
+		} else if (urlChartTime && urlChartTime in chartTimeData) {
+			$chartTime.set(urlChartTime)
+		}
 		return () => {
 			$chartTime.set($userSettings.get().chartTime)
+			setAlertWindow(undefined)
 			// resetCharts()
 			setSystemStats([])
 			setContainerData([])
 			setContainerFilterBar(null)
 			$containerFilter.set("")
+			setLive(false)
 			cpuMaxStore[1](false)
 			bandwidthMaxStore[1](false)
 			diskIoMaxStore[1](false)
@@ -134,6 +293,20 @@ export default function SystemDetail({ name }: { name: string }) {
 
 	// useEffect(resetCharts, [chartTime])
 
+	// stop showing the alert window when a different chart time is selected
+	useEffect(() => {
+		if (alertWindow && alertWindow.chartTime !== chartTime) {
+			setAlertWindow(undefined)
+		}
+	}, [chartTime])
+
+	// 10 second stats are only available for systems with fast polling
+	useEffect(() => {
+		if (system.id && chartTime === "10m" && !system.fast_polling) {
+			$chartTime.set("1h")
+		}
+	}, [system.id, system.fast_polling, chartTime])
+
 	// find matching system
 	useEffect(() => {
 		if (system.id && system.name === name) {
@@ -158,19 +331,44 @@ export default function SystemDetail({ name }: { name: string }) {
 		}
 	}, [system.id])
 
+	// find series of newer agents or custom metrics in the metric catalog
+	useEffect(() => {
+		if (!system.id) {
+			return
+		}
+		pb.send<MetricCatalog>("/api/beszel/metrics", { query: { system: system.id } })
+			.then((catalog) => setOtherMetrics(catalog.stats.filter((series) => !series.known)))
+			.catch(() => setOtherMetrics([]))
+	}, [system.id])
+
 	const chartData: ChartData = useMemo(() => {
+		// stats from the live stream that are newer than the saved records
+		const lastSaved = (systemStats.at(-1)?.created as number) ?? 0
+		const newStats = liveStats.filter((record) => (record.created as number) > lastSaved)
+		const stats = newStats.length ? systemStats.concat(newStats) : systemStats
 		const lastCreated = Math.max(
-			(systemStats.at(-1)?.created as number) ?? 0,
+			(stats.at(-1)?.created as number) ?? 0,
 			(containerData.at(-1)?.created as number) ?? 0
 		)
 		return {
-			systemStats,
+			systemStats: stats,
 			containerData,
 			chartTime,
 			orientation: direction === "rtl" ? "right" : "left",
-			...getTimeData(chartTime, lastCreated),
+			...getTimeData(chartTime, lastCreated, alertWindow?.chartTime === chartTime ? alertWindow : undefined),
 		}
-	}, [systemStats, containerData, direction])
+	}, [systemStats, liveStats, containerData, direction, alertWindow])
+
+	// virtual machines report disk i/o, containers only if read from cgroups
+	const hasContainerDiskIo = useMemo(
+		() =>
+			containerData.some((stats) =>
+				Object.entries(stats).some(
+					([key, value]) => key !== "created" && (value?.dr !== undefined || value?.dw !== undefined)
+				)
+			),
+		[containerData]
+	)
 
 	// get stats
 	useEffect(() => {
@@ -219,6 +417,8 @@ export default function SystemDetail({ name }: { name: string }) {
 
 	// make container stats for charts
 	const makeContainerData = useCallback((containers: ContainerStatsRecord[]) => {
+		containerRecords.current = containers
+		const group = $containerGroup.get()
 		const containerData = [] as ChartData["containerData"]
 		for (let { created, stats } of containers) {
 			if (!created) {
@@ -230,13 +430,33 @@ export default function SystemDetail({ name }: { name: string }) {
 			// @ts-ignore not dealing with this rn
 			let containerStats: ChartData["containerData"][0] = { created }
 			for (let container of stats) {
-				containerStats[container.n] = container
+				// sum the containers of each compose project when grouped
+				const key = (group && container.p) || container.n
+				const existing = containerStats[key]
+				if (existing && key !== container.n) {
+					containerStats[key] = {
+						...existing,
+						c: existing.c + container.c,
+						m: existing.m + container.m,
+						ns: existing.ns + container.ns,
+						nr: existing.nr + container.nr,
+						dr: (existing.dr ?? 0) + (container.dr ?? 0),
+						dw: (existing.dw ?? 0) + (container.dw ?? 0),
+					}
+				} else {
+					containerStats[key] = { ...container, n: key }
+				}
 			}
 			containerData.push(containerStats)
 		}
 		setContainerData(containerData)
 	}, [])
 
+	// regroup container charts when toggled
+	useEffect(() => {
+		makeContainerData(containerRecords.current)
+	}, [containerGroup])
+
 	// values for system info bar
 	const systemInfo = useMemo(() => {
 		if (!system.info) {
@@ -259,19 +479,51 @@ export default function SystemDetail({ name }: { name: string }) {
 				hide: system.info.h === system.host || system.info.h === system.name,
 			},
 			{ value: uptime, Icon: ClockArrowUp, label: t`Uptime` },
+			{
+				value:
+					system.timezone &&
+					new Date().toLocaleTimeString(undefined, { timeZone: system.timezone, hour: "2-digit", minute: "2-digit" }),
+				Icon: Clock3Icon,
+				label: t`Local time (${system.timezone})`,
+				hide: !system.timezone,
+			},
 			{ value: system.info.k, Icon: TuxIcon, label: t({ comment: "Linux kernel", message: "Kernel" }) },
 			{
 				value: `${system.info.m} (${system.info.c}c${system.info.t ? `/${system.info.t}t` : ""})`,
 				Icon: CpuIcon,
 				hide: !system.info.m,
 			},
+			{
+				value: system.info.bat && `${Math.round(system.info.bat.c)}% (${batteryStateName(system.info.bat.s)})`,
+				Icon: BatteryMediumIcon,
+				label: system.info.bat?.src === "sysfs" ? t`Battery` : t`UPS`,
+				hide: !system.info.bat,
+			},
+			{
+				value: t`No new data for ${Math.floor((system.staleness ?? 0) / 60)} min`,
+				Icon: HourglassIcon,
+				label: t`Stale data`,
+				// samples are taken every minute
+				hide: system.status !== "up" || (system.staleness ?? 0) < 180,
+			},
+			{
+				value: system.info.th === "battery" ? t`On battery` : t`Thermal pressure`,
+				Icon: ThermometerIcon,
+				label: t`Reduced collection`,
+				hide: !system.info.th,
+			},
+			...Object.entries(system.info.e ?? {}).map(([subsystem, code]) => ({
+				value: collectionErrorMessage(subsystem, code),
+				Icon: TriangleAlertIcon,
+				label: t`Collection error`,
+			})),
 		] as {
 			value: string | number | undefined
 			label?: string
 			Icon: any
 			hide?: boolean
 		}[]
-	}, [system.info])
+	}, [system.info, system.staleness, system.timezone])
 
 	/** Space for tooltip if more than 12 containers */
 	useEffect(() => {
@@ -296,6 +548,12 @@ export default function SystemDetail({ name }: { name: string }) {
 	const lastGpuVals = Object.values(systemStats.at(-1)?.stats.g ?? {})
 	const hasGpuData = lastGpuVals.length > 0
 	const hasGpuPowerData = lastGpuVals.some((gpu) => gpu.p !== undefined)
+	// packet loss is set on every record with latency probes, even without replies
+	const hasLatencyData = systemStats.at(-1)?.stats.pl !== undefined
+	const hasCpuBreakdown = systemStats.at(-1)?.stats.cpuu !== undefined
+	const hasCpuCores = (systemStats.at(-1)?.stats.cpuc?.length ?? 0) > 0
+	const hasNicSpeed = Object.values(systemStats.at(-1)?.stats.ni ?? {}).some((nic) => nic.sp)
+	const hasDiskDevices = Object.keys(systemStats.at(-1)?.stats.dio ?? {}).length > 0
 
 	return (
 		<>
@@ -353,7 +611,25 @@ export default function SystemDetail({ name }: { name: string }) {
 							</div>
 						</div>
 						<div className="xl:ms-auto flex items-center gap-2 max-sm:-mb-1">
-							<ChartTimeSelect className="w-full xl:w-40" />
+							<ChartTimeSelect className="w-full xl:w-40" fastPolling={system.fast_polling} />
+							{!isLongerChart && (
+								<TooltipProvider delayDuration={100}>
+									<Tooltip>
+										<TooltipTrigger asChild>
+											<Button
+												aria-label={t`Live`}
+												variant={live ? "default" : "outline"}
+												size="icon"
+												className={cn("shrink-0 p-0", { "text-primary": !live })}
+												onClick={() => setLive(!live)}
+											>
+												<RadioIcon className="h-[1.2rem] w-[1.2rem] opacity-85" />
+											</Button>
+										</TooltipTrigger>
+										<TooltipContent>{t`Update every second`}</TooltipContent>
+									</Tooltip>
+								</TooltipProvider>
+							)}
 							<TooltipProvider delayDuration={100}>
 								<Tooltip>
 									<TooltipTrigger asChild>
@@ -381,6 +657,7 @@ export default function SystemDetail({ name }: { name: string }) {
 				{/* main charts */}
 				<div className="grid xl:grid-cols-2 gap-4">
 					<ChartCard
+						id="cpu"
 						empty={dataEmpty}
 						grid={grid}
 						title={_(t`CPU Usage`)}
@@ -390,6 +667,32 @@ export default function SystemDetail({ name }: { name: string }) {
 						<AreaChartDefault chartData={chartData} chartName="CPU Usage" maxToggled={cpuMaxStore[0]} unit="%" />
 					</ChartCard>
 
+					{/* CPU time by state, e.g. steal time of VMs on a busy host */}
+					{hasCpuBreakdown && (
+						<ChartCard
+							id="cpu-breakdown"
+							empty={dataEmpty}
+							grid={grid}
+							title={t`CPU Time`}
+							description={t`Share of CPU time spent in user space, kernel, I/O wait and steal`}
+						>
+							<SeriesChart chartData={chartData} unit="%" getValues={cpuBreakdown} />
+						</ChartCard>
+					)}
+
+					{/* usage of each logical cpu, e.g. to spot single-threaded workloads */}
+					{hasCpuCores && (
+						<ChartCard
+							id="cpu-cores"
+							empty={dataEmpty}
+							grid={grid}
+							title={t`CPU Cores`}
+							description={t`Usage of each logical CPU`}
+						>
+							<CpuCoresChart chartData={chartData} />
+						</ChartCard>
+					)}
+
 					{containerFilterBar && (
 						<ChartCard
 							empty={dataEmpty}
@@ -403,6 +706,7 @@ export default function SystemDetail({ name }: { name: string }) {
 					)}
 
 					<ChartCard
+						id="memory"
 						empty={dataEmpty}
 						grid={grid}
 						title={t`Memory Usage`}
@@ -413,6 +717,7 @@ export default function SystemDetail({ name }: { name: string }) {
 
 					{containerFilterBar && (
 						<ChartCard
+							id="container-memory"
 							empty={dataEmpty}
 							grid={grid}
 							title={dockerOrPodman(t`Docker Memory Usage`, system)}
@@ -423,7 +728,7 @@ export default function SystemDetail({ name }: { name: string }) {
 						</ChartCard>
 					)}
 
-					<ChartCard empty={dataEmpty} grid={grid} title={t`Disk Usage`} description={t`Usage of root partition`}>
+					<ChartCard id="disk" empty={dataEmpty} grid={grid} title={t`Disk Usage`} description={t`Usage of root partition`}>
 						<DiskChart chartData={chartData} dataKey="stats.du" diskSize={systemStats.at(-1)?.stats.d ?? NaN} />
 					</ChartCard>
 
@@ -438,6 +743,7 @@ export default function SystemDetail({ name }: { name: string }) {
 					</ChartCard>
 
 					<ChartCard
+						id="bandwidth"
 						empty={dataEmpty}
 						grid={grid}
 						title={t`Bandwidth`}
@@ -447,6 +753,50 @@ export default function SystemDetail({ name }: { name: string }) {
 						<AreaChartDefault chartData={chartData} maxToggled={bandwidthMaxStore[0]} chartName="bw" />
 					</ChartCard>
 
+					{/* Utilization of network interfaces with a known link speed */}
+					{hasNicSpeed && (
+						<ChartCard
+							id="nic"
+							empty={dataEmpty}
+							grid={grid}
+							title={t`Network Utilization`}
+							description={t`Traffic of each interface as a percentage of its link speed`}
+						>
+							<SeriesChart chartData={chartData} unit="%" getValues={nicUtilization} />
+						</ChartCard>
+					)}
+
+					{/* I/O of each disk device */}
+					{hasDiskDevices && (
+						<>
+							<ChartCard
+								id="disk-devices"
+								empty={dataEmpty}
+								grid={grid}
+								title={t`Disk I/O by Device`}
+								description={t`Read and write throughput of each disk`}
+							>
+								<SeriesChart chartData={chartData} unit=" MB/s" getValues={deviceThroughput} />
+							</ChartCard>
+							<ChartCard
+								empty={dataEmpty}
+								grid={grid}
+								title={t`IOPS by Device`}
+								description={t`Read and write operations per second of each disk`}
+							>
+								<SeriesChart chartData={chartData} unit="" getValues={deviceIops} />
+							</ChartCard>
+							<ChartCard
+								empty={dataEmpty}
+								grid={grid}
+								title={t`Disk Await by Device`}
+								description={t`Average time of read and write operations of each disk`}
+							>
+								<SeriesChart chartData={chartData} unit=" ms" getValues={deviceAwait} />
+							</ChartCard>
+						</>
+					)}
+
 					{containerFilterBar && containerData.length > 0 && (
 						<div
 							ref={netCardRef}
@@ -466,9 +816,98 @@ export default function SystemDetail({ name }: { name: string }) {
 						</div>
 					)}
 
+					{/* Disk I/O of virtual machines and containers */}
+					{containerFilterBar && hasContainerDiskIo && (
+						<ChartCard
+							empty={dataEmpty}
+							grid={grid}
+							title={t`Container Disk I/O`}
+							description={t`Disk throughput of containers and virtual machines`}
+							cornerEl={containerFilterBar}
+						>
+							<ContainerChart chartData={chartData} chartName="dio" dataKey="d" />
+						</ChartCard>
+					)}
+
+					{/* Load average chart */}
+					{systemStats.at(-1)?.stats.l1 !== undefined && (
+						<ChartCard
+							id="load"
+							empty={dataEmpty}
+							grid={grid}
+							title={t`Load Average`}
+							description={t`System load averaged over 1, 5 and 15 minutes`}
+						>
+							<LoadChart chartData={chartData} />
+						</ChartCard>
+					)}
+
+					{/* Pressure stall information chart */}
+					{systemStats.at(-1)?.stats.psi && (
+						<ChartCard
+							id="pressure"
+							empty={dataEmpty}
+							grid={grid}
+							title={t`Pressure`}
+							description={t`Time that tasks were stalled waiting for the CPU, memory or I/O`}
+						>
+							<SeriesChart chartData={chartData} unit="%" getValues={pressure} />
+						</ChartCard>
+					)}
+
+					{/* File descriptors chart */}
+					{systemStats.at(-1)?.stats.fdm !== undefined && (
+						<ChartCard
+							id="fd"
+							empty={dataEmpty}
+							grid={grid}
+							title={t`File Descriptors`}
+							description={t`Open files of the system and of the process closest to its limit`}
+						>
+							<FdChart chartData={chartData} />
+						</ChartCard>
+					)}
+
+					{/* Entropy chart */}
+					{systemStats.at(-1)?.stats.entp !== undefined && (
+						<ChartCard
+							id="entropy"
+							empty={dataEmpty}
+							grid={grid}
+							title={t`Entropy`}
+							description={t`Entropy available to the kernel's random number generator`}
+						>
+							<AreaChartDefault chartData={chartData} chartName="ent" unit=" bits" />
+						</ChartCard>
+					)}
+
+					{/* Latency and packet loss charts (measured by the hub with LATENCY_CHECK) */}
+					{hasLatencyData && (
+						<>
+							<ChartCard
+								id="latency"
+								empty={dataEmpty}
+								grid={grid}
+								title={t`Latency`}
+								description={t`Round trip time from the hub to the system`}
+							>
+								<AreaChartDefault chartData={chartData} chartName="lat" unit=" ms" />
+							</ChartCard>
+							<ChartCard
+								empty={dataEmpty}
+								grid={grid}
+								title={t`Packet Loss`}
+								description={t`Latency probes from the hub without a reply`}
+							>
+								<AreaChartDefault chartData={chartData} chartName="pl" unit="%" max={100} />
+							</ChartCard>
+						</>
+					)}
+
 					{/* Swap chart */}
 					{(systemStats.at(-1)?.stats.su ?? 0) > 0 && (
 						<ChartCard
+							id="swap"
 							empty={dataEmpty}
 							grid={grid}
 							title={t`Swap Usage`}
@@ -481,6 +920,7 @@ export default function SystemDetail({ name }: { name: string }) {
 					{/* Temperature chart */}
 					{systemStats.at(-1)?.stats.t && (
 						<ChartCard
+							id="temperature"
 							empty={dataEmpty}
 							grid={grid}
 							title={t`Temperature`}
@@ -490,6 +930,19 @@ export default function SystemDetail({ name }: { name: string }) {
 						</ChartCard>
 					)}
 
+					{/* Voltage chart */}
+					{systemStats.at(-1)?.stats.volt && (
+						<ChartCard
+							id="voltage"
+							empty={dataEmpty}
+							grid={grid}
+							title={t`Voltage`}
+							description={t`Voltages of motherboard rails and power supplies`}
+						>
+							<SeriesChart chartData={chartData} unit=" V" getValues={voltages} />
+						</ChartCard>
+					)}
+
 					{/* GPU power draw chart */}
 					{hasGpuPowerData && (
 						<ChartCard
@@ -501,12 +954,43 @@ export default function SystemDetail({ name }: { name: string }) {
 							<GpuPowerChart chartData={chartData} />
 						</ChartCard>
 					)}
+
+					{/* Series without a chart of their own */}
+					{otherMetrics.map((series) => (
+						<ChartCard
+							key={series.key}
+							empty={dataEmpty}
+							grid={grid}
+							title={series.key}
+							description={t`Reported by the agent`}
+						>
+							<AreaChartDefault chartData={chartData} chartName={series.key} unit="" />
+						</ChartCard>
+					))}
+
+					{/* Metric expression evaluated by the hub */}
+					<ChartCard
+						empty={dataEmpty}
+						grid={grid}
+						title={t`Expression`}
+						description={t`Derived metric, e.g. mem_used / mem_total * 100`}
+						cornerEl={
+							<Input
+								placeholder={t`Expression`}
+								defaultValue={expression}
+								onBlur={(e) => setExpression(e.target.value.trim())}
+								onKeyDown={(e) => e.key === "Enter" && setExpression(e.currentTarget.value.trim())}
+							/>
+						}
+					>
+						<ExpressionChart chartData={chartData} system={system} expression={expression} />
+					</ChartCard>
 				</div>
 
 				{/* GPU charts */}
 				{hasGpuData && (
 					<div className="grid xl:grid-cols-2 gap-4">
-						{Object.keys(systemStats.at(-1)?.stats.g ?? {}).map((id) => {
+						{Object.keys(systemStats.at(-1)?.stats.g ?? {}).map((id, i) => {
 							const gpu = systemStats.at(-1)?.stats.g?.[id] as GPUData
 							return (
 								<div key={id} className="contents">
@@ -519,6 +1003,7 @@ export default function SystemDetail({ name }: { name: string }) {
 										<AreaChartDefault chartData={chartData} chartName={`g.${id}.u`} unit="%" />
 									</ChartCard>
 									<ChartCard
+										id={i === 0 ? "gpu" : undefined}
 										empty={dataEmpty}
 										grid={grid}
 										title={`${gpu.n} VRAM`}
@@ -535,6 +1020,26 @@ export default function SystemDetail({ name }: { name: string }) {
 											}}
 										/>
 									</ChartCard>
+									{gpu.pr !== undefined && (
+										<ChartCard
+											empty={dataEmpty}
+											grid={grid}
+											title={`${gpu.n} ${t`Compute Processes`}`}
+											description={t`Running compute processes on ${gpu.n}`}
+										>
+											<AreaChartDefault chartData={chartData} chartName={`g.${id}.pr`} unit="" />
+										</ChartCard>
+									)}
+									{gpu.e && (
+										<ChartCard
+											empty={dataEmpty}
+											grid={grid}
+											title={`${gpu.n} ${t`Engines`}`}
+											description={t`Average utilization of each engine of ${gpu.n}`}
+										>
+											<SeriesChart chartData={chartData} unit="%" getValues={gpuEngines(id)} />
+										</ChartCard>
+									)}
 								</div>
 							)
 						})}
@@ -588,6 +1093,7 @@ export default function SystemDetail({ name }: { name: string }) {
 function ContainerFilterBar() {
 	const containerFilter = useStore($containerFilter)
 	const { _ } = useLingui()
+	const containerGroup = useStore($containerGroup)
 
 	const handleChange = useCallback((e: React.ChangeEvent<HTMLInputElement>) => {
 		$containerFilter.set(e.target.value)
@@ -595,7 +1101,20 @@ function ContainerFilterBar() {
 
 	return (
 		<>
-			<Input placeholder={_(t`Filter...`)} className="ps-4 pe-8" value={containerFilter} onChange={handleChange} />
+			<Button
+				type="button"
+				variant="ghost"
+				size="icon"
+				aria-label={_(t`Group by compose project`)}
+				title={_(t`Group by compose project`)}
+				className={cn("absolute left-1 top-1/2 -translate-y-1/2 h-7 w-7 text-gray-500", {
+					"text-primary": containerGroup,
+				})}
+				onClick={() => $containerGroup.set(!containerGroup)}
+			>
+				<LayersIcon className="h-4 w-4" />
+			</Button>
+			<Input placeholder={_(t`Filter...`)} className="ps-9 pe-8" value={containerFilter} onChange={handleChange} />
 			{containerFilter && (
 				<Button
 					type="button"
@@ -635,6 +1154,7 @@ function SelectAvgMax({ store }: { store: [boolean, React.Dispatch<React.SetStat
 }
 
 function ChartCard({
+	id,
 	title,
 	description,
 	children,
@@ -642,6 +1162,7 @@ function ChartCard({
 	empty,
 	cornerEl,
 }: {
+	id?: string
 	title: string
 	description: string
 	children: React.ReactNode
@@ -651,8 +1172,19 @@ function ChartCard({
 }) {
 	const { isIntersecting, ref } = useIntersectionObserver()
 
+	// scroll to chart if linked to directly
+	useEffect(() => {
+		if (id && window.location.hash === `#${id}`) {
+			document.getElementById(id)?.scrollIntoView({ behavior: "smooth", block: "center" })
+		}
+	}, [id])
+
 	return (
-		<Card className={cn("pb-2 sm:pb-4 odd:last-of-type:col-span-full", { "col-span-full": !grid })} ref={ref}>
+		<Card
+			id={id}
+			className={cn("pb-2 sm:pb-4 odd:last-of-type:col-span-full scroll-mt-4", { "col-span-full": !grid })}
+			ref={ref}
+		>
 			<CardHeader className="pb-5 pt-4 relative space-y-1 max-sm:py-3 max-sm:px-4">
 				<CardTitle className="text-xl sm:text-2xl">{title}</CardTitle>
 				<CardDescription>{description}</CardDescription>
@@ -59,11 +59,16 @@ import {
 	ArrowUpIcon,
 	Settings2Icon,
 	EyeIcon,
+	FingerprintIcon,
+	ArrowRightLeftIcon,
+	BadgeCheckIcon,
+	RotateCcwIcon,
+	TimerIcon,
 } from "lucide-react"
 import { useEffect, useMemo, useState } from "react"
 import { $hubVersion, $systems, pb } from "@/lib/stores"
 import { useStore } from "@nanostores/react"
-import { cn, copyToClipboard, decimalString, isReadOnlyUser, useLocalStorage } from "@/lib/utils"
+import { cn, copyToClipboard, decimalString, isAdmin, isReadOnlyUser, useLocalStorage } from "@/lib/utils"
 import AlertsButton from "../alerts/alert-button"
 import { Link, navigate } from "../router"
 import { EthernetIcon } from "../ui/icons"
@@ -71,6 +76,7 @@ import { Trans, t } from "@lingui/macro"
 import { useLingui } from "@lingui/react"
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "../ui/card"
 import { Input } from "../ui/input"
+import { toast } from "../ui/use-toast"
 import { ClassValue } from "clsx"
 
 type ViewMode = "table" | "grid"
@@ -526,7 +532,7 @@ function IndicatorDot({ system, className }: { system: SystemRecord; className?:
 
 function ActionsButton({ system }: { system: SystemRecord }) {
 	// const [opened, setOpened] = useState(false)
-	const { id, status, host, name } = system
+	const { id, status, host, name, fast_polling, pending_move } = system
 	return (
 		<AlertDialog>
 			<DropdownMenu>
@@ -559,10 +565,73 @@ function ActionsButton({ system }: { system: SystemRecord }) {
 							</>
 						)}
 					</DropdownMenuItem>
+					<DropdownMenuItem
+						className={cn(isReadOnlyUser() && "hidden")}
+						onClick={() => {
+							pb.collection("systems").update(id, { fast_polling: !fast_polling })
+						}}
+					>
+						<TimerIcon className="me-2.5 size-4" />
+						{fast_polling ? <Trans>Disable 10s polling</Trans> : <Trans>Enable 10s polling</Trans>}
+					</DropdownMenuItem>
 					<DropdownMenuItem onClick={() => copyToClipboard(host)}>
 						<CopyIcon className="me-2.5 size-4" />
 						<Trans>Copy host</Trans>
 					</DropdownMenuItem>
+					<DropdownMenuItem
+						className={cn(isReadOnlyUser() && "hidden")}
+						onClick={() => {
+							pb.send("/api/beszel/badges", { method: "POST", body: { system: id } })
+								.then(({ token }) =>
+									copyToClipboard(new URL(pb.buildURL(`/api/beszel/badge/${token}/status.svg`), window.location.href).href)
+								)
+								.catch((error) => toast({ title: t`Error`, description: error.message, variant: "destructive" }))
+						}}
+					>
+						<BadgeCheckIcon className="me-2.5 size-4" />
+						<Trans>Copy badge URL</Trans>
+					</DropdownMenuItem>
+					<DropdownMenuItem
+						className={cn(isReadOnlyUser() && "hidden")}
+						onClick={() => {
+							pb.send("/api/beszel/badges/rotate", { method: "POST", body: { system: id } })
+								.then(({ token }) => {
+									copyToClipboard(new URL(pb.buildURL(`/api/beszel/badge/${token}/status.svg`), window.location.href).href)
+									toast({ description: t`Previous badge URLs for ${name} no longer work.` })
+								})
+								.catch((error) => toast({ title: t`Error`, description: error.message, variant: "destructive" }))
+						}}
+					>
+						<RotateCcwIcon className="me-2.5 size-4" />
+						<Trans>Reset badge URLs</Trans>
+					</DropdownMenuItem>
+					<DropdownMenuItem
+						className={cn(isReadOnlyUser() && "hidden")}
+						onClick={() => {
+							pb.send("/api/beszel/systems/reset-fingerprint", { method: "POST", body: { id } })
+								.then(() => toast({ description: t`The next agent to report for ${name} will be trusted.` }))
+								.catch((error) => toast({ title: t`Error`, description: error.message, variant: "destructive" }))
+						}}
+					>
+						<FingerprintIcon className="me-2.5 size-4" />
+						<Trans>Reset fingerprint</Trans>
+					</DropdownMenuItem>
+					{pending_move && isAdmin() && (
+						<DropdownMenuItem
+							onClick={() => {
+								pb.send("/api/beszel/systems/approve-move", { method: "POST", body: { id } })
+									.then(() =>
+										toast({
+											description: t`${name} was moved to ${pending_move.host}:${pending_move.port} (${pending_move.transport}).`,
+										})
+									)
+									.catch((error) => toast({ title: t`Error`, description: error.message, variant: "destructive" }))
+							}}
+						>
+							<ArrowRightLeftIcon className="me-2.5 size-4" />
+							<Trans>Approve move to {pending_move.host}</Trans>
+						</DropdownMenuItem>
+					)}
 					<DropdownMenuSeparator className={cn(isReadOnlyUser() && "hidden")} />
 					<AlertDialogTrigger asChild>
 						<DropdownMenuItem className={cn(isReadOnlyUser() && "hidden")}>
@@ -37,6 +37,9 @@ $userSettings.subscribe((value) => {
 /** Container chart filter */
 export const $containerFilter = atom("")
 
+/** Combine container charts by docker compose project */
+export const $containerGroup = atom(false)
+
 /** Fallback copy to clipboard dialog content */
 export const $copyContent = atom("")
 
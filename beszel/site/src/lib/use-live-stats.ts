@@ -0,0 +1,61 @@
+import { useEffect, useState } from "react"
+import { pb } from "@/lib/stores"
+import { LiveStatsMessage, SystemStatsRecord } from "@/types"
+
+/** Most stats kept from a live stream (one hour at one second intervals) */
+const maxLiveStats = 3600
+
+/**
+ * Streams the stats of a system from the hub's live endpoint as they arrive.
+ * With `interval` set, the hub also polls the agent at that many seconds.
+ * Stats are cleared when the system or interval changes.
+ */
+export function useLiveStats(systemId: string | undefined, enabled: boolean, interval?: number) {
+	const [stats, setStats] = useState([] as SystemStatsRecord[])
+
+	useEffect(() => {
+		setStats([])
+		if (!systemId || !enabled) {
+			return
+		}
+		let ws: WebSocket | undefined
+		let retry: ReturnType<typeof setTimeout>
+		let stopped = false
+
+		const connect = () => {
+			const url = new URL(pb.buildURL("/api/beszel/live"), window.location.href)
+			url.protocol = url.protocol === "https:" ? "wss:" : "ws:"
+			url.searchParams.set("system", systemId)
+			url.searchParams.set("token", pb.authStore.token)
+			interval && url.searchParams.set("interval", String(interval))
+			ws = new WebSocket(url)
+			ws.onmessage = (e) => {
+				const msg = JSON.parse(e.data) as LiveStatsMessage
+				const record = {
+					id: "",
+					collectionId: "",
+					collectionName: "system_stats",
+					system: msg.system,
+					stats: msg.stats,
+					created: new Date(msg.created).getTime(),
+				} as SystemStatsRecord
+				setStats((prev) => prev.concat(record).slice(-maxLiveStats))
+			}
+			// reconnect after the hub restarts or the connection drops
+			ws.onclose = () => {
+				if (!stopped) {
+					retry = setTimeout(connect, 5000)
+				}
+			}
+		}
+		connect()
+
+		return () => {
+			stopped = true
+			clearTimeout(retry)
+			ws?.close()
+		}
+	}, [systemId, enabled, interval])
+
+	return stats
+}
@@ -5,9 +5,24 @@ import { $alerts, $copyContent, $systems, $userSettings, pb } from "./stores"
 import { AlertInfo, AlertRecord, ChartTimeData, ChartTimes, SystemRecord } from "@/types"
 import { RecordModel, RecordSubscription } from "pocketbase"
 import { WritableAtom } from "nanostores"
-import { timeDay, timeHour } from "d3-time"
+import { timeDay, timeHour, timeMinute } from "d3-time"
 import { useEffect, useState } from "react"
-import { CpuIcon, HardDriveIcon, MemoryStickIcon, ServerIcon } from "lucide-react"
+import {
+	BatteryMediumIcon,
+	CpuIcon,
+	DicesIcon,
+	FilesIcon,
+	GaugeIcon,
+	GlobeIcon,
+	HardDriveIcon,
+	HourglassIcon,
+	MemoryStickIcon,
+	NetworkIcon,
+	RadioTowerIcon,
+	ServerIcon,
+	SigmaIcon,
+	ZapIcon,
+} from "lucide-react"
 import { EthernetIcon, ThermometerIcon } from "@/components/ui/icons"
 import { t } from "@lingui/macro"
 
@@ -140,6 +155,15 @@ export function getPbTimestamp(timeString: ChartTimes, d?: Date) {
 }
 
 export const chartTimeData: ChartTimeData = {
+	/** only for systems with fast polling */
+	"10m": {
+		type: "10s",
+		expectedInterval: 10_000,
+		label: () => t`10 minutes`,
+		ticks: 10,
+		format: (timestamp: string) => hourWithMinutes(timestamp),
+		getOffset: (endTime: Date) => timeMinute.offset(endTime, -10),
+	},
 	"1h": {
 		type: "1m",
 		expectedInterval: 60_000,
@@ -304,6 +328,12 @@ export const alertInfo: Record<string, AlertInfo> = {
 		icon: MemoryStickIcon,
 		desc: () => t`Triggers when memory usage exceeds a threshold`,
 	},
+	Swap: {
+		name: () => t`Swap Usage`,
+		unit: "%",
+		icon: MemoryStickIcon,
+		desc: () => t`Triggers when swap usage exceeds a threshold`,
+	},
 	Disk: {
 		name: () => t`Disk Usage`,
 		unit: "%",
@@ -317,10 +347,169 @@ export const alertInfo: Record<string, AlertInfo> = {
 		desc: () => t`Triggers when combined up/down exceeds a threshold`,
 		max: 125,
 	},
+	NIC: {
+		name: () => t`Network Utilization`,
+		unit: "%",
+		icon: EthernetIcon,
+		desc: () => t`Triggers when traffic of any interface exceeds a threshold of its link speed`,
+	},
 	Temperature: {
 		name: () => t`Temperature`,
 		unit: "°C",
 		icon: ThermometerIcon,
 		desc: () => t`Triggers when any sensor exceeds a threshold`,
 	},
+	Voltage: {
+		name: () => t`Voltage`,
+		unit: "%",
+		icon: ZapIcon,
+		desc: () => t`Triggers when any voltage rail deviates from its nominal voltage by more than a threshold`,
+		max: 50,
+		defaultValue: 5,
+	},
+	LoadAvg1: {
+		name: () => t`Load Average 1m`,
+		unit: "%",
+		icon: GaugeIcon,
+		desc: () => t`Triggers when 1 minute load per CPU thread exceeds a threshold`,
+		max: 200,
+	},
+	LoadAvg5: {
+		name: () => t`Load Average 5m`,
+		unit: "%",
+		icon: GaugeIcon,
+		desc: () => t`Triggers when 5 minute load per CPU thread exceeds a threshold`,
+		max: 200,
+	},
+	LoadAvg15: {
+		name: () => t`Load Average 15m`,
+		unit: "%",
+		icon: GaugeIcon,
+		desc: () => t`Triggers when 15 minute load per CPU thread exceeds a threshold`,
+		max: 200,
+	},
+	"File Descriptors": {
+		name: () => t`File Descriptors`,
+		unit: "%",
+		icon: FilesIcon,
+		desc: () => t`Triggers when open files of the system or any process exceed a threshold of their limit`,
+	},
+	"CPU Pressure": {
+		name: () => t`CPU Pressure`,
+		unit: "%",
+		icon: CpuIcon,
+		desc: () => t`Triggers when tasks are stalled waiting for the CPU for more than a threshold of the time`,
+		defaultValue: 20,
+	},
+	"Memory Pressure": {
+		name: () => t`Memory Pressure`,
+		unit: "%",
+		icon: MemoryStickIcon,
+		desc: () => t`Triggers when tasks are stalled waiting for memory for more than a threshold of the time`,
+		defaultValue: 10,
+	},
+	"IO Pressure": {
+		name: () => t`I/O Pressure`,
+		unit: "%",
+		icon: HardDriveIcon,
+		desc: () => t`Triggers when tasks are stalled waiting for I/O for more than a threshold of the time`,
+		defaultValue: 20,
+	},
+	Battery: {
+		name: () => t`Battery`,
+		unit: "%",
+		icon: BatteryMediumIcon,
+		desc: () => t`Triggers when battery or UPS charge falls below a threshold`,
+		below: true,
+	},
+	Entropy: {
+		name: () => t`Entropy`,
+		unit: " bits",
+		icon: DicesIcon,
+		desc: () => t`Triggers when available entropy for random numbers falls below a threshold`,
+		max: 1000,
+		below: true,
+		defaultValue: 200,
+	},
+	Latency: {
+		name: () => t`Latency`,
+		unit: " ms",
+		icon: RadioTowerIcon,
+		desc: () => t`Triggers when round trip time from the hub exceeds a threshold`,
+		max: 1000,
+		defaultValue: 100,
+	},
+	"Packet Loss": {
+		name: () => t`Packet Loss`,
+		unit: "%",
+		icon: RadioTowerIcon,
+		desc: () => t`Triggers when lost latency probes from the hub exceed a threshold`,
+		defaultValue: 10,
+	},
+	"GPU Memory": {
+		name: () => t`GPU Memory Headroom`,
+		unit: " GB",
+		icon: MemoryStickIcon,
+		desc: () => t`Triggers when free memory of any GPU falls below a threshold`,
+	},
+	"GPU Engine": {
+		name: () => t`GPU Engine Utilization`,
+		unit: "%",
+		icon: GaugeIcon,
+		desc: () => t`Triggers when utilization of any GPU engine exceeds a threshold`,
+	},
+	Expression: {
+		name: () => t`Metric Expression`,
+		unit: "",
+		icon: SigmaIcon,
+		desc: () => t`Triggers when a derived metric like mem_used / mem_total * 100 exceeds a threshold`,
+		max: 1000,
+	},
+	MemoryLeak: {
+		name: () => t`Memory Leak`,
+		unit: " h",
+		icon: MemoryStickIcon,
+		desc: () => t`Triggers when memory of a container grows steadily for longer than a threshold`,
+		min: 3,
+		max: 168,
+		defaultValue: 6,
+		noMin: true,
+	},
+	Stale: {
+		name: () => t`Stale Data`,
+		unit: " min",
+		icon: HourglassIcon,
+		desc: () => t`Triggers when a system returns no new data for longer than a threshold`,
+		max: 60,
+		defaultValue: 5,
+		noMin: true,
+	},
+	SMART: {
+		name: () => t`S.M.A.R.T. Status`,
+		unit: "",
+		icon: HardDriveIcon,
+		desc: () => t`Triggers when the health status of any drive changes to or from failed`,
+		single: true,
+	},
+	Service: {
+		name: () => t`Service Status`,
+		unit: "",
+		icon: ServerIcon,
+		desc: () => t`Triggers when a systemd service enters or leaves the failed state`,
+		single: true,
+	},
+	Port: {
+		name: () => t`New Listening Port`,
+		unit: "",
+		icon: NetworkIcon,
+		desc: () => t`Triggers when a port that wasn't in the previous inventory starts listening`,
+		single: true,
+	},
+	HTTP: {
+		name: () => t`HTTP Checks`,
+		unit: "",
+		icon: GlobeIcon,
+		desc: () => t`Triggers when an HTTP health check of a container goes down or recovers`,
+		single: true,
+	},
 }
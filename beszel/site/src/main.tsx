@@ -12,6 +12,7 @@ import { Toaster } from "./components/ui/toaster.tsx"
 import { $router } from "./components/router.tsx"
 import SystemDetail from "./components/routes/system.tsx"
 import Navbar from "./components/navbar.tsx"
+import { ImpersonationBanner, isImpersonating } from "./components/impersonate.tsx"
 import { I18nProvider } from "@lingui/react"
 import { i18n } from "@lingui/core"
 
@@ -94,6 +95,7 @@ const Layout = () => {
 			) : (
 				<>
 					<div className="container">
+						{isImpersonating() && <ImpersonationBanner />}
 						<Navbar />
 					</div>
 					<div className="container mb-14 relative">
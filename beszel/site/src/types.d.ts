@@ -7,6 +7,22 @@ export interface SystemRecord extends RecordModel {
 	port: string
 	info: SystemInfo
 	v: string
+	site?: string
+	tags?: string[]
+	depends_on?: string[]
+	/** hours a down system is kept before it's deleted (0 = never) */
+	ttl?: number
+	/** time the system went down */
+	down_since?: string
+	/** IANA time zone used for alert hours, UTC if empty */
+	timezone?: string
+	transport?: "ssh" | "https"
+	/** seconds since the last successful sample */
+	staleness?: number
+	/** system stats are also requested every 10 seconds */
+	fast_polling?: boolean
+	/** address and transport an agent registered with that an admin has to approve */
+	pending_move?: { host: string; port: string; transport: "ssh" | "https"; ip?: string; requested: string } | null
 }
 
 export interface SystemInfo {
@@ -28,21 +44,68 @@ export interface SystemInfo {
 	u: number
 	/** memory percent */
 	mp: number
+	/** swap percent */
+	sp?: number
 	/** disk percent */
 	dp: number
 	/** bandwidth (mb) */
 	b: number
+	/** load average 1 min */
+	l1?: number
+	/** load average 5 min */
+	l5?: number
+	/** load average 15 min */
+	l15?: number
+	/** highest of system and process file descriptor usage (%) */
+	fdp?: number
 	/** agent version */
 	v: string
+	/** operating system of the agent */
+	os?: string
 	/** system is using podman */
 	p?: boolean
+	/** containers are kubernetes pods */
+	k8s?: boolean
+	/** reduced collection mode (battery or thermal) */
+	th?: "battery" | "thermal"
+	/** battery or ups charge */
+	bat?: Battery
+	/** available entropy (bits) */
+	ent?: number
+	/** round trip time from the hub (ms) */
+	lat?: number
+	/** latency probes from the hub without a reply (%) */
+	pl?: number
+	/** subsystems that failed to collect data */
+	e?: Record<string, CollectionErrorCode>
 }
 
+export interface Battery {
+	/** capacity (%) */
+	c: number
+	/** state */
+	s: "charging" | "discharging" | "full" | "idle"
+	/** source */
+	src: "sysfs" | "apcupsd" | "nut"
+}
+
+export type CollectionErrorCode = "docker_unavailable" | "permission_denied" | "smartctl_missing" | "collection_failed"
+
 export interface SystemStats {
 	/** cpu percent */
 	cpu: number
 	/** peak cpu */
 	cpum?: number
+	/** usage of each logical cpu (%), if enabled with CPU_CORES on the agent */
+	cpuc?: number[]
+	/** cpu time in user space (%) */
+	cpuu?: number
+	/** cpu time in the kernel (%) */
+	cpus?: number
+	/** cpu time waiting for i/o (%) */
+	cpui?: number
+	/** cpu time stolen by the hypervisor (%) */
+	cpust?: number
 	/** total memory (gb) */
 	m: number
 	/** memory used (gb) */
@@ -53,6 +116,12 @@ export interface SystemStats {
 	mb: number
 	/** zfs arc memory (gb) */
 	mz?: number
+	/** available memory (gb) */
+	ma?: number
+	/** memory reserved for huge pages (gb) */
+	mht?: number
+	/** huge pages memory in use (gb) */
+	mhu?: number
 	/** swap space (gb) */
 	s: number
 	/** swap used (gb) */
@@ -71,6 +140,30 @@ export interface SystemStats {
 	drm?: number
 	/** max disk write (mb) */
 	dwm?: number
+	/** load average 1 min */
+	l1?: number
+	/** load average 5 min */
+	l5?: number
+	/** load average 15 min */
+	l15?: number
+	/** battery or ups charge (%) */
+	bat?: number
+	/** open file descriptors */
+	fd?: number
+	/** system-wide file descriptor limit */
+	fdm?: number
+	/** highest process usage of its own file descriptor limit (%) */
+	fdp?: number
+	/** available entropy (bits) */
+	ent?: number
+	/** size of the entropy pool (bits) */
+	entp?: number
+	/** pressure stall information, if reported by the kernel */
+	psi?: Pressure
+	/** round trip time from the hub (ms) */
+	lat?: number
+	/** latency probes from the hub without a reply (%) */
+	pl?: number
 	/** network sent (mb) */
 	ns: number
 	/** network received (mb) */
@@ -79,12 +172,83 @@ export interface SystemStats {
 	nsm?: number
 	/** max network received (mb) */
 	nrm?: number
+	/** network interfaces */
+	ni?: Record<string, NicStats>
+	/** disk devices */
+	dio?: Record<string, IoStats>
 	/** temperatures */
 	t?: Record<string, number>
+	/** voltages of hwmon sensors (V) */
+	volt?: Record<string, number>
 	/** extra filesystems */
 	efs?: Record<string, ExtraFsStats>
 	/** GPU data */
 	g?: Record<string, GPUData>
+	/** groups of stats that failed to collect (their values are null) */
+	mi?: ("cpu" | "mem" | "disk" | "dio" | "net" | "load" | "fd" | "psi")[]
+}
+
+export interface MetricSeries {
+	/** path of the value in stats, e.g. "cpu" or "t.cpu_thermal" */
+	key: string
+	/** empty for series the hub doesn't know */
+	name?: string
+	/** sensor, filesystem, disk, gpu, interface or core of the series */
+	label?: string
+	unit?: string
+	known: boolean
+}
+
+export interface MetricCatalog {
+	system: string
+	/** creation time of the newest record */
+	updated: string
+	stats: MetricSeries[]
+	/** series of each container */
+	containers: MetricSeries[]
+}
+
+export interface IoStats {
+	/** read (mb/s) */
+	r: number
+	/** write (mb/s) */
+	w: number
+	/** read operations per second */
+	ri: number
+	/** write operations per second */
+	wi: number
+	/** average time of a read (ms) */
+	rl?: number
+	/** average time of a write (ms) */
+	wl?: number
+	/** average time of any operation (ms) */
+	a?: number
+	/** time the device was busy (%) */
+	u?: number
+}
+
+export interface Pressure {
+	/** time some tasks were stalled on the cpu (%) */
+	cs?: number
+	/** time some tasks were stalled on memory (%) */
+	ms?: number
+	/** time all non-idle tasks were stalled on memory (%) */
+	mf?: number
+	/** time some tasks were stalled on i/o (%) */
+	is?: number
+	/** time all non-idle tasks were stalled on i/o (%) */
+	if?: number
+}
+
+export interface NicStats {
+	/** network sent (mb) */
+	ns: number
+	/** network received (mb) */
+	nr: number
+	/** link speed (Mb/s) */
+	sp?: number
+	/** higher of sent and received as a percentage of the link speed */
+	u?: number
 }
 
 export interface GPUData {
@@ -94,10 +258,16 @@ export interface GPUData {
 	mu?: number
 	/** memory total (mb) */
 	mt?: number
+	/** memory free (mb) */
+	mf?: number
 	/** usage (%) */
 	u: number
 	/** power (w) */
 	p?: number
+	/** running compute processes */
+	pr?: number
+	/** utilization of each engine (%), e.g. "Video" (intel) */
+	e?: Record<string, number>
 }
 
 export interface ExtraFsStats {
@@ -124,6 +294,10 @@ export interface ContainerStatsRecord extends RecordModel {
 interface ContainerStats {
 	/** name */
 	n: string
+	/** docker compose project */
+	p?: string
+	/** docker compose service */
+	s?: string
 	/** cpu percent */
 	c: number
 	/** memory used (gb) */
@@ -132,6 +306,10 @@ interface ContainerStats {
 	ns: number
 	// network received (mb)
 	nr: number
+	/** disk read (mb/s), only reported for virtual machines */
+	dr?: number
+	/** disk write (mb/s), only reported for virtual machines */
+	dw?: number
 }
 
 export interface SystemStatsRecord extends RecordModel {
@@ -145,15 +323,139 @@ export interface AlertRecord extends RecordModel {
 	system: string
 	name: string
 	triggered: boolean
+	/** docker compose project targeted by the alert */
+	project?: string
+	/** gpu engine targeted by a GPU Engine alert, any engine if empty */
+	engine?: string
+	/** metric expression of an Expression alert, e.g. mem_used/mem_total*100 */
+	expression?: string
+	/** when the alert can trigger in the system's time zone, e.g. "mon-fri 09:00-17:00" */
+	hours?: string
+	/** minutes after resolving before the alert can trigger again */
+	cooldown?: number
 	sysname?: string
 	// user: string
 }
 
-export type ChartTimes = "1h" | "12h" | "24h" | "1w" | "30d"
+/** value of a metric expression at the time of a system_stats record */
+export interface ExpressionPoint {
+	created: string
+	/** null if a metric of the expression is missing */
+	value: number | null
+}
+
+/** stats of a system sent by the hub's live stream */
+export interface LiveStatsMessage {
+	system: string
+	created: string
+	/** polled for the stream and not saved */
+	polled?: boolean
+	stats: SystemStats
+}
+
+export interface AlertHistoryRecord extends RecordModel {
+	/** empty if the alert was deleted */
+	alert: string
+	system: string
+	name: string
+	project: string
+	/** average value when triggered (0 for state change alerts) */
+	value: number
+	threshold: number
+	/** empty while the alert is active */
+	resolved: string
+	created: string
+}
+
+export interface StatusPageRecord extends RecordModel {
+	user: string
+	name: string
+	/** random path segment of the public url */
+	slug: string
+	systems: string[]
+	enabled: boolean
+	/** show cpu and memory sparklines */
+	charts: boolean
+}
+
+export interface ApiTokenRecord extends RecordModel {
+	user: string
+	name: string
+	/** first characters of the token, to tell tokens apart */
+	prefix: string
+	scopes: ("read:stats" | "manage:systems" | "manage:alerts")[]
+	expires: string
+	last_used: string
+}
+
+export interface NotificationChannelRecord extends RecordModel {
+	/** empty for the hub's SMTP server */
+	user: string
+	/** scheme and host of a webhook, or the SMTP host */
+	name: string
+	type: NotificationChannel
+	healthy: boolean
+	error: string
+	checked: string
+	failing_since: string
+}
+
+/** notification in the hub's delivery queue */
+export interface NotificationQueueRecord extends RecordModel {
+	user: string
+	type: NotificationChannel
+	title: string
+	message: string
+	status: "pending" | "sent" | "failed"
+	attempts: number
+	next_attempt: string
+	error: string
+	sent: string
+}
+
+export interface CheckRecord extends RecordModel {
+	user: string
+	/** system whose agent runs the check, empty to run it from the hub */
+	system: string
+	name: string
+	type: "http" | "tcp"
+	/** url for http, host:port for tcp */
+	target: string
+	/** seconds between checks */
+	interval: number
+	/** expected status code, 0 for any 2xx or 3xx */
+	expected_status: number
+	keyword: string
+	/** failed checks in a row before the status changes to down */
+	retries: number
+	notify: boolean
+	status: "pending" | "up" | "down" | "paused"
+	code: number
+	/** response time (ms) */
+	latency: number
+	error: string
+	checked: string
+}
+
+export interface QuietHoursRecord extends RecordModel {
+	user: string
+	/** empty for all systems */
+	system: string
+	name: string
+	repeat: "once" | "daily" | "weekly"
+	/** start of the first window */
+	start: string
+	/** end of the first window */
+	end: string
+	/** IANA timezone that recurring windows follow */
+	timezone: string
+}
+
+export type ChartTimes = "10m" | "1h" | "12h" | "24h" | "1w" | "30d"
 
 export interface ChartTimeData {
 	[key: string]: {
-		type: "1m" | "10m" | "20m" | "120m" | "480m"
+		type: "10s" | "1m" | "10m" | "20m" | "120m" | "480m"
 		expectedInterval: number
 		label: () => string
 		ticks?: number
@@ -167,6 +469,21 @@ export type UserSettings = {
 	chartTime: ChartTimes
 	emails?: string[]
 	webhooks?: string[]
+	/** language of notifications, also used to format numbers */
+	locale?: string
+	/** size units in notifications */
+	units?: "binary" | "decimal"
+	/** time format in notifications */
+	timeFormat?: "24h" | "12h"
+	/** custom notification title and body by channel */
+	templates?: Partial<Record<NotificationChannel, NotificationTemplate>>
+}
+
+export type NotificationChannel = "email" | "webhook" | "shoutrrr"
+
+export interface NotificationTemplate {
+	title: string
+	body: string
 }
 
 type ChartDataContainer = {
@@ -190,5 +507,53 @@ interface AlertInfo {
 	icon: any
 	desc: () => string
 	single?: boolean
+	min?: number
 	max?: number
+	/** triggers when the value falls below the threshold */
+	below?: boolean
+	/** threshold of new alerts (default 80) */
+	defaultValue?: number
+	/** the alert doesn't average over a duration */
+	noMin?: boolean
+}
+
+export interface AgentRollout {
+	channel: "stable" | "beta"
+	/** percent of systems updated at a time */
+	batch: number
+	started: string
+	finished?: string
+	/** stopped after an agent failed to update */
+	halted: boolean
+	systems: {
+		id: string
+		name: string
+		/** agent version before updating */
+		from: string
+		to?: string
+		status: "pending" | "updating" | "updated" | "current" | "failed" | "skipped"
+		error?: string
+	}[]
+}
+
+export interface BackupRecord extends RecordModel {
+	name: string
+	storage: "local" | "s3"
+	/** bytes */
+	size: number
+	/** milliseconds */
+	duration: number
+	error: string
+	created: string
+}
+
+export interface BackupStatus {
+	/** schedule from BACKUP_CRON or Settings > Backups, empty if not scheduled */
+	cron: string
+	s3: boolean
+	/** hours after the last successful backup before admins are notified */
+	max_age: number
+	last_success: string
+	stale: boolean
+	backups: BackupRecord[]
 }